@@ -0,0 +1,48 @@
+// bundle 把一次运行的结果打包成一个 tar.gz，大小适合附到 pulsar-client-go 的 GitHub issue，
+// 与 runner bundle 相同 (打包逻辑见 pkg/bundle)，保留给只构建了这一个命令的环境。
+//
+// 用法: bundle [-o bundle.tar.gz] [-max-size 24MB] [-sanitize] <run-dir>
+//
+//	bundle [-o bundle.tar.gz] -scenario <name> <results-dir>
+//
+// run 布局 (-layout=run) 传入 results/<scenario>/<run-id>；flat 布局传入 results 目录和 -scenario。
+// -sanitize 把文本文件中的主机名、IP 和 tenant/namespace 替换为占位名，公开的 issue 中不会暴露内部基础设施。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"pulsar-memory-test/pkg/bundle"
+)
+
+var (
+	outputFile = flag.String("o", "", "Bundle file to write (empty = <scenario>[-<run-id>]-bundle.tar.gz in the current directory)")
+	scenario   = flag.String("scenario", "", "Scenario name for the flat layout, where <results-dir> holds stats_<scenario>.json and friends")
+	maxSize    = flag.Int64("max-size", bundle.GitHubAttachmentLimit, "Compressed size budget in bytes; optional files that do not fit are left out and listed in README.md")
+	sanitize   = flag.Bool("sanitize", false, "Replace hostnames, IPs, URL hosts and tenant/namespace names in stats, logs, manifests and README with placeholders (host-1, ip-1, tenant-1/namespace-1) so the bundle can be shared publicly")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <run-dir | results-dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *maxSize <= 0 {
+		log.Fatalf("-max-size must be positive")
+	}
+	res, err := bundle.Write(bundle.Options{Dir: flag.Arg(0), Scenario: *scenario, Output: *outputFile, MaxSize: *maxSize, Sanitize: *sanitize})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	res.Log(log.Printf)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/progress"
+	"pulsar-memory-test/pkg/results"
+)
+
+// abPass A/B 测试中的一轮消费
+type abPass struct {
+	Name           string                `json:"name"`
+	ReleasePayload bool                  `json:"release_payload"`
+	Summary        metrics.MemorySummary `json:"summary"`
+}
+
+// abResult A/B 对比结果，Delta 为 (release - keep) / keep 的百分比
+type abResult struct {
+	Passes []abPass           `json:"passes"`
+	Delta  map[string]float64 `json:"delta_percent"`
+}
+
+// abMetric 参与对比的指标
+type abMetric struct {
+	key   string
+	label string
+	value func(s metrics.MemorySummary) float64
+}
+
+var abMetrics = []abMetric{
+	{"max_heap_alloc", "Max HeapAlloc (MB)", func(s metrics.MemorySummary) float64 { return float64(s.MaxHeapAlloc) / 1024 / 1024 }},
+	{"avg_heap_alloc", "Avg HeapAlloc (MB)", func(s metrics.MemorySummary) float64 { return s.AvgHeapAlloc / 1024 / 1024 }},
+	{"max_heap_inuse", "Max HeapInuse (MB)", func(s metrics.MemorySummary) float64 { return float64(s.MaxHeapInuse) / 1024 / 1024 }},
+	{"max_rss", "Max RSS (MB)", func(s metrics.MemorySummary) float64 { return float64(s.MaxRSS) / 1024 / 1024 }},
+	{"avg_rss", "Avg RSS (MB)", func(s metrics.MemorySummary) float64 { return s.AvgRSS / 1024 / 1024 }},
+	{"heap_ratio", "Heap ratio (x)", func(s metrics.MemorySummary) float64 { return s.HeapRatio }},
+	{"num_gc", "GC count", func(s metrics.MemorySummary) float64 { return float64(s.NumGC) }},
+	{"gc_cpu_seconds", "GC CPU (s)", func(s metrics.MemorySummary) float64 { return s.GCCPUSeconds }},
+	{"gc_assist_seconds", "Mark assist (s)", func(s metrics.MemorySummary) float64 { return s.GCAssistSeconds }},
+	{"pause_total_ms", "GC pause (ms)", func(s metrics.MemorySummary) float64 { return s.PauseTotalMs }},
+	{"duration_ms", "Duration (ms)", func(s metrics.MemorySummary) float64 { return float64(s.Duration.Milliseconds()) }},
+}
+
+// runABTest 先不释放 payload 消费一轮，seek 回第一轮最早的发布时间后再开启 ReleasePayload 消费同样多的批次，
+// 每轮使用独立的 MemoryMonitor 并分别保存 stats/heap 文件，最后打印对比并写入 ab 结果，
+// 返回最后一轮的 heap profile 路径和各轮摘要
+func runABTest(ctx context.Context, cancel context.CancelFunc, sigCh <-chan os.Signal, consumer pulsar.Consumer,
+	cfg BatchConfig, base *metrics.MemoryMonitor, reporter *progress.Reporter, a *app.App) (string, []metrics.MemorySummary) {
+	layout := a.Layout
+	// base 只用于记录启动阶段，两轮都从同样的起点开始采样
+	base.Stop()
+
+	passes := []abPass{{Name: "keep"}, {Name: "release", ReleasePayload: true}}
+	maxBatches := *maxBatches
+	var firstPublish time.Time
+	var heapProfilePath string
+	for i := range passes {
+		pass := &passes[i]
+		if i > 0 {
+			if firstPublish.IsZero() {
+				log.Printf("A/B: first pass consumed nothing, skipping %q pass", pass.Name)
+				passes = passes[:i]
+				break
+			}
+			// seek 会清空 receiver queue 并从该时间点重新投递
+			if err := consumer.SeekByTime(firstPublish); err != nil {
+				log.Printf("A/B: seek to %v failed, skipping %q pass: %v", firstPublish, pass.Name, err)
+				passes = passes[:i]
+				break
+			}
+		}
+
+		// 回收上一轮的内存，避免残留影响下一轮的基线
+		runtime.GC()
+		debug.FreeOSMemory()
+
+		// 由 App 创建，中途退出时各轮的样本保存为与 saveResults 相同的 stats_<pass>.json
+		monitor, err := a.NewPassMonitor("_" + pass.Name)
+		if err != nil {
+			a.Exit(results.StatusError, "%v", err)
+		}
+		for k, v := range base.GetMetadata() {
+			monitor.SetMetadata(k, v)
+		}
+		monitor.SetMetadata("ab_pass", pass.Name)
+		monitor.SetReceiverQueueSize(*receiverQueueSize)
+		monitor.SetMetadata("flag.release-payload", strconv.FormatBool(pass.ReleasePayload))
+		monitor.EnableLatency()
+		if i > 0 {
+			// 每轮各自一个监控器和审计日志，记录本轮相对第一轮的修改
+			monitor.RecordChange("subscription.position", "", firstPublish.Format(time.RFC3339Nano), "A/B: replay the first pass")
+			monitor.RecordChange("release-payload", strconv.FormatBool(passes[0].ReleasePayload), strconv.FormatBool(pass.ReleasePayload), "A/B pass "+pass.Name)
+		}
+		monitor.Start(ctx, time.Second)
+
+		passCfg := cfg
+		passCfg.ReleasePayload = pass.ReleasePayload
+		bp := NewBatchProcessor(passCfg, consumer, monitor)
+
+		log.Printf("========== A/B pass %d/%d: %s (release payload: %v) ==========", i+1, len(passes), pass.Name, pass.ReleasePayload)
+		// 两轮在 CPU profile 中按 phase 标签区分
+		passCtx := pprof.WithLabels(ctx, pprof.Labels("phase", pass.Name))
+		elapsed := runPass(passCtx, cancel, sigCh, bp, reporter, maxBatches)
+		monitor.Stop()
+		log.Printf("A/B pass %q: %d batches in %v", pass.Name, bp.Count(), elapsed.Round(time.Millisecond))
+
+		heapProfilePath = saveResults(monitor, layout, "_"+pass.Name)
+		pass.Summary = monitor.GetSummary()
+
+		if ctx.Err() != nil {
+			passes = passes[:i+1]
+			break
+		}
+		if i == 0 {
+			firstPublish = bp.FirstPublish()
+			// 第二轮消费与第一轮同样多的批次
+			if maxBatches == 0 {
+				maxBatches = bp.Count()
+			}
+		}
+	}
+
+	result := abResult{Passes: passes, Delta: make(map[string]float64)}
+	printABComparison(&result)
+
+	path := layout.File("ab", "ab", "json")
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save A/B result: %v", err)
+	} else {
+		log.Printf("A/B result saved to: %s", path)
+	}
+	summaries := make([]metrics.MemorySummary, len(passes))
+	for i, p := range passes {
+		summaries[i] = p.Summary
+	}
+	return heapProfilePath, summaries
+}
+
+// printABComparison 打印两轮的对比并填充 Delta
+func printABComparison(r *abResult) {
+	log.Println("")
+	log.Println("========== ReleasePayload A/B ==========")
+	if len(r.Passes) < 2 {
+		log.Println("  Incomplete: only one pass finished, nothing to compare")
+		log.Println("========================================")
+		return
+	}
+	keep, release := r.Passes[0].Summary, r.Passes[1].Summary
+	log.Printf("  %-20s %12s %12s %9s", "", "keep", "release", "delta")
+	log.Printf("  %-20s %12d %12d", "Messages", keep.MessageCount, release.MessageCount)
+	for _, m := range abMetrics {
+		a, b := m.value(keep), m.value(release)
+		if a != 0 {
+			r.Delta[m.key] = (b - a) / a * 100
+			log.Printf("  %-20s %12.2f %12.2f %+8.1f%%", m.label, a, b, r.Delta[m.key])
+		} else {
+			log.Printf("  %-20s %12.2f %12.2f %9s", m.label, a, b, "-")
+		}
+	}
+	if keep.MessageCount != release.MessageCount {
+		log.Printf("  WARNING: passes consumed different message counts, comparison is approximate")
+	}
+	log.Println("========================================")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/batch"
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// ackBatcher 与处理批次无关的确认批次: 处理完成的消息只留下 MessageID 加入当前确认批次，
+// 攒到 size 条或最早的一条等待了 interval 时一起发出，模拟把确认交给独立提交线程的消费者。
+// 等待期间客户端和 broker 都把这些消息记为未确认，样本的 buffered_acks 为当前批次的大小
+type ackBatcher struct {
+	consumer pulsar.Consumer
+	monitor  *metrics.MemoryMonitor
+	clock    clock.Clock   // 与 monitor 相同，按时间发出和批次等待时长的来源
+	size     int           // 0 表示只按时间发出
+	interval time.Duration // 0 表示只按数量发出
+	timeAcks bool
+
+	mu       sync.Mutex // 定时器在自己的 goroutine 中发出
+	ids      []pulsar.MessageID
+	received []time.Duration // 与 ids 一一对应，各消息 Receive 返回时的 batch.HoldClock
+	first    time.Time       // 当前批次第一条确认加入的时间
+	timer    clock.Timer
+	gen      int // 每发出一个批次加一，之前启动的定时器据此失效
+
+	sending sync.Mutex // 发出中的批次，flush 等它完成后才返回
+}
+
+func newAckBatcher(consumer pulsar.Consumer, monitor *metrics.MemoryMonitor, size int, interval time.Duration, timeAcks bool) *ackBatcher {
+	return &ackBatcher{consumer: consumer, monitor: monitor, clock: monitor.Clock(), size: size, interval: interval, timeAcks: timeAcks}
+}
+
+// add 把一条消息的确认加入当前批次，批次满时在调用方的 goroutine 中发出
+func (b *ackBatcher) add(id pulsar.MessageID, received time.Duration) {
+	b.mu.Lock()
+	if len(b.ids) == 0 {
+		b.first = b.clock.Now()
+		if b.interval > 0 {
+			gen := b.gen
+			b.timer = b.clock.AfterFunc(b.interval, func() { b.expire(gen) })
+		}
+	}
+	b.ids = append(b.ids, id)
+	b.received = append(b.received, received)
+	b.monitor.RecordBufferedAcks(1)
+	if b.size == 0 || len(b.ids) < b.size {
+		b.mu.Unlock()
+		return
+	}
+	ids, rec, age := b.take()
+	b.mu.Unlock()
+	b.send(ids, rec, age, metrics.AckFlushSize)
+}
+
+// expire 定时器到期，批次在此期间已按数量发出时什么也不做
+func (b *ackBatcher) expire(gen int) {
+	b.mu.Lock()
+	if gen != b.gen || len(b.ids) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	ids, rec, age := b.take()
+	b.mu.Unlock()
+	b.send(ids, rec, age, metrics.AckFlushTimer)
+}
+
+// take 取出当前批次并停止其定时器，调用方持有 mu
+func (b *ackBatcher) take() ([]pulsar.MessageID, []time.Duration, time.Duration) {
+	ids, rec := b.ids, b.received
+	b.ids = make([]pulsar.MessageID, 0, b.size)
+	b.received = make([]time.Duration, 0, b.size)
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.gen++
+	return ids, rec, b.clock.Since(b.first)
+}
+
+// send 逐条发出一个批次的确认，持有时长算到确认真正发出为止
+func (b *ackBatcher) send(ids []pulsar.MessageID, received []time.Duration, age time.Duration, cause metrics.AckFlushCause) {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+	for i, id := range ids {
+		start := time.Now()
+		err := b.consumer.AckID(id)
+		if b.timeAcks {
+			b.monitor.RecordAck(time.Since(start), err)
+		}
+		b.monitor.RecordHolding(batch.HoldClock() - received[i])
+		if err != nil {
+			logging.Debugf("  Batched ack failed: %v", err)
+		}
+	}
+	b.monitor.RecordBufferedAcks(-int64(len(ids)))
+	b.monitor.RecordAckFlush(len(ids), age, cause)
+	logging.Debugf("  Flushed %d acks (%s, oldest waited %v)", len(ids), ackFlushNames[cause], age.Round(time.Millisecond))
+}
+
+// ackFlushNames 调试日志中的发出原因
+var ackFlushNames = map[metrics.AckFlushCause]string{
+	metrics.AckFlushSize:     "size",
+	metrics.AckFlushTimer:    "timer",
+	metrics.AckFlushShutdown: "shutdown",
+}
+
+// flush 立即发出当前批次，并等待定时器发出中的批次完成，在关闭 consumer 之前调用
+func (b *ackBatcher) flush() {
+	b.mu.Lock()
+	if len(b.ids) == 0 {
+		b.mu.Unlock()
+		b.sending.Lock()
+		b.sending.Unlock()
+		return
+	}
+	ids, rec, age := b.take()
+	b.mu.Unlock()
+	b.send(ids, rec, age, metrics.AckFlushShutdown)
+	log.Printf("Ack batching: sent %d buffered acks at shutdown", len(ids))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// ackRecorder 只实现 AckID 的 pulsar.Consumer，记录发出的确认
+type ackRecorder struct {
+	pulsar.Consumer
+	mu    sync.Mutex
+	acked []pulsar.MessageID
+}
+
+func (c *ackRecorder) AckID(id pulsar.MessageID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acked = append(c.acked, id)
+	return nil
+}
+
+func (c *ackRecorder) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.acked)
+}
+
+func newFakeAckBatcher(t *testing.T, size int, interval time.Duration) (*ackBatcher, *ackRecorder, *clock.Fake, *metrics.MemoryMonitor) {
+	t.Helper()
+	monitor, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	monitor.SetClock(fake)
+	c := &ackRecorder{}
+	return newAckBatcher(c, monitor, size, interval, false), c, fake, monitor
+}
+
+// TestAckBatcherTimerFlush 只按时间发出: 第一条确认加入后 interval 到期时整批发出，
+// 记录的等待时长正好是 interval；之后加入的确认重新开始计时
+func TestAckBatcherTimerFlush(t *testing.T) {
+	b, c, fake, monitor := newFakeAckBatcher(t, 0, 5*time.Second)
+
+	b.add(pulsar.NewMessageID(1, 0, -1, 0), 0)
+	fake.Advance(2 * time.Second)
+	b.add(pulsar.NewMessageID(1, 1, -1, 0), 0)
+	b.add(pulsar.NewMessageID(1, 2, -1, 0), 0)
+	fake.Advance(2999 * time.Millisecond)
+	if n := c.count(); n != 0 {
+		t.Fatalf("%d acks sent before the interval", n)
+	}
+	fake.Advance(time.Millisecond)
+	if n := c.count(); n != 3 {
+		t.Fatalf("%d acks sent when the interval expired, want 3", n)
+	}
+	if n := fake.Waiters(); n != 0 {
+		t.Fatalf("Waiters after the flush = %d, want 0", n)
+	}
+
+	b.add(pulsar.NewMessageID(1, 3, -1, 0), 0)
+	fake.Advance(4 * time.Second)
+	if n := c.count(); n != 3 {
+		t.Fatalf("%d acks sent, want the new batch still waiting", n)
+	}
+	fake.Advance(time.Second)
+	if n := c.count(); n != 4 {
+		t.Fatalf("%d acks sent, want 4", n)
+	}
+
+	monitor.Collect() // 没有样本时摘要为空
+	s := monitor.GetSummary().AckBatches
+	if s == nil || s.Flushes != 2 || s.ByTimer != 2 || s.Acks != 4 || s.MaxAgeMs != 5000 {
+		t.Fatalf("ack batches %+v, want 2 timer flushes of 4 acks, max age 5000 ms", s)
+	}
+}
+
+// TestAckBatcherSizeCancelsTimer 按数量发出后该批次的定时器停止，到期时不会再发出
+func TestAckBatcherSizeCancelsTimer(t *testing.T) {
+	b, c, fake, monitor := newFakeAckBatcher(t, 2, 5*time.Second)
+
+	b.add(pulsar.NewMessageID(1, 0, -1, 0), 0)
+	fake.Advance(time.Second)
+	b.add(pulsar.NewMessageID(1, 1, -1, 0), 0)
+	if n := c.count(); n != 2 {
+		t.Fatalf("%d acks sent when the batch filled, want 2", n)
+	}
+	if n := fake.Waiters(); n != 0 {
+		t.Fatalf("Waiters after the size flush = %d, want 0", n)
+	}
+	fake.Advance(10 * time.Second)
+
+	b.add(pulsar.NewMessageID(1, 2, -1, 0), 0)
+	b.flush()
+	if n := c.count(); n != 3 {
+		t.Fatalf("%d acks sent after flush, want 3", n)
+	}
+
+	monitor.Collect() // 没有样本时摘要为空
+	s := monitor.GetSummary().AckBatches
+	if s == nil || s.BySize != 1 || s.ByTimer != 0 || s.AtShutdown != 1 || s.MaxAgeMs != 1000 {
+		t.Fatalf("ack batches %+v, want 1 size flush (age 1000 ms) and 1 at shutdown", s)
+	}
+}
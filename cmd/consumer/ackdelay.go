@@ -0,0 +1,145 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/batch"
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// pendingAck 一个批次推迟中的确认
+type pendingAck struct {
+	due      time.Time
+	ids      []pulsar.MessageID
+	received []time.Duration // 与 ids 一一对应，各消息 Receive 返回时的 batch.HoldClock
+}
+
+// delayedAcker 把每个批次的确认推迟 delay + [0, jitter) 后再发出，模拟下游提交之后才确认的应用。
+// 推迟期间只保留 MessageID，消息本身随批次释放；客户端的 ack 跟踪结构 (批量消息的 ack 位图、
+// ack grouping) 和 broker 的未确认计数在确认发出前一直保留这些消息
+type delayedAcker struct {
+	consumer pulsar.Consumer
+	monitor  *metrics.MemoryMonitor
+	clock    clock.Clock // 与 monitor 相同，推迟到期的来源
+	delay    time.Duration
+	jitter   time.Duration
+	timeAcks bool
+	rng      *rand.Rand // 只在 add 中使用，add 只由处理批次的 goroutine 调用
+
+	mu      sync.Mutex
+	pending []pendingAck // 按 due 排序
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newDelayedAcker 创建并启动推迟确认的 goroutine，结束时调用 flush
+func newDelayedAcker(consumer pulsar.Consumer, monitor *metrics.MemoryMonitor, delay, jitter time.Duration, timeAcks bool) *delayedAcker {
+	a := &delayedAcker{
+		consumer: consumer,
+		monitor:  monitor,
+		clock:    monitor.Clock(),
+		delay:    delay,
+		jitter:   jitter,
+		timeAcks: timeAcks,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// add 推迟一个批次的确认；抖动可能让后处理的批次先确认
+func (a *delayedAcker) add(ids []pulsar.MessageID, received []time.Duration) {
+	if len(ids) == 0 {
+		return
+	}
+	d := a.delay
+	if a.jitter > 0 {
+		d += time.Duration(a.rng.Int63n(int64(a.jitter)))
+	}
+	p := pendingAck{due: a.clock.Now().Add(d), ids: ids, received: received}
+	a.monitor.RecordPendingAcks(int64(len(ids)))
+	a.mu.Lock()
+	i, _ := slices.BinarySearchFunc(a.pending, p.due, func(e pendingAck, t time.Time) int { return e.due.Compare(t) })
+	a.pending = slices.Insert(a.pending, i, p)
+	a.mu.Unlock()
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *delayedAcker) run() {
+	defer close(a.done)
+	timer := a.clock.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		a.mu.Lock()
+		wait := time.Hour
+		var due []pendingAck
+		now := a.clock.Now()
+		for len(a.pending) > 0 && !a.pending[0].due.After(now) {
+			due = append(due, a.pending[0])
+			a.pending = a.pending[1:]
+		}
+		if len(a.pending) > 0 {
+			wait = a.pending[0].due.Sub(now)
+		}
+		a.mu.Unlock()
+		for _, p := range due {
+			a.ack(p)
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C():
+		case <-a.wake:
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// ack 发出一个批次的确认，持有时长算到确认真正发出为止
+func (a *delayedAcker) ack(p pendingAck) {
+	for i, id := range p.ids {
+		start := time.Now()
+		err := a.consumer.AckID(id)
+		if a.timeAcks {
+			a.monitor.RecordAck(time.Since(start), err)
+		}
+		a.monitor.RecordHolding(batch.HoldClock() - p.received[i])
+		if err != nil {
+			logging.Debugf("  Delayed ack failed: %v", err)
+		}
+	}
+	a.monitor.RecordPendingAcks(-int64(len(p.ids)))
+}
+
+// flush 停止推迟，立即发出剩余的确认，在关闭 consumer 之前调用
+func (a *delayedAcker) flush() {
+	close(a.stop)
+	<-a.done
+	a.mu.Lock()
+	rest := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+	n := 0
+	for _, p := range rest {
+		a.ack(p)
+		n += len(p.ids)
+	}
+	if n > 0 {
+		log.Printf("Ack delay: sent %d pending acks early at shutdown", n)
+	}
+}
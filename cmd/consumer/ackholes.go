@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// ackHoles -check-ack-holes 时跟踪批次 entry 各索引的状态，nil 表示不检查；
+// 在 -alloc-audit 之后设置，NewBatchProcessor 据此包装 consumer
+var ackHoles *ackHoleTracker
+
+// indexState 批次 entry 中一个索引的状态
+type indexState uint8
+
+const (
+	indexPending   indexState = iota // 还没交给批处理
+	indexReceived                    // 已交给批处理，尚未确认
+	indexAcked                       // 确认成功
+	indexAckFailed                   // Ack 返回错误
+	indexSkipped                     // 按 -ack-ratio 故意不确认
+	indexNacked                      // 已 Nack，等待重投递
+)
+
+// entryKey 批次 entry 的位置，ledger ID 在集群内唯一，不需要 topic 和分区
+type entryKey struct {
+	ledger, entry int64
+}
+
+// batchEntry 一个批次 entry 各索引的状态，acked 为 indexAcked 的个数
+type batchEntry struct {
+	states []indexState
+	acked  int
+}
+
+// ackHoleTracker 按 entry 记录各索引收到、确认、跳过和 Nack 的情况；全部索引都确认后删除该 entry，
+// 内存只随未完成的 entry 增长 (-ack-ratio < 1 且不 Nack 时被跳过的 entry 一直保留)
+type ackHoleTracker struct {
+	mu       sync.Mutex
+	entries  map[entryKey]*batchEntry
+	seen     int64
+	complete int64
+}
+
+func newAckHoleTracker() *ackHoleTracker {
+	return &ackHoleTracker{entries: make(map[entryKey]*batchEntry)}
+}
+
+// set 记录一个索引的新状态，非批量消息 (BatchSize <= 1) 忽略
+func (t *ackHoleTracker) set(id pulsar.MessageID, s indexState) {
+	size, idx := id.BatchSize(), id.BatchIdx()
+	if size <= 1 || idx < 0 || idx >= size {
+		return
+	}
+	key := entryKey{id.LedgerID(), id.EntryID()}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.entries[key]
+	if e == nil {
+		e = &batchEntry{states: make([]indexState, size)}
+		t.entries[key] = e
+		t.seen++
+	}
+	prev := e.states[idx]
+	if prev == s {
+		return
+	}
+	// 已确认的索引又被收到说明 broker 没有记下这次确认，需要重新确认
+	if prev == indexAcked {
+		e.acked--
+	}
+	e.states[idx] = s
+	if s == indexAcked {
+		e.acked++
+		if e.acked == len(e.states) {
+			delete(t.entries, key)
+			t.complete++
+		}
+	}
+}
+
+// stats 退出时 (确认全部发出之后) 的检查结果
+func (t *ackHoleTracker) stats() *metrics.AckHoleStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &metrics.AckHoleStats{Entries: t.seen, Complete: t.complete}
+	keys := make([]entryKey, 0, len(t.entries))
+	for key, e := range t.entries {
+		if e.acked > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ledger != keys[j].ledger {
+			return keys[i].ledger < keys[j].ledger
+		}
+		return keys[i].entry < keys[j].entry
+	})
+	for _, key := range keys {
+		s.Partial++
+		var holes []string
+		for idx, st := range t.entries[key].states {
+			switch st {
+			case indexReceived, indexAckFailed:
+				s.Holes++
+				if st == indexAckFailed {
+					s.AckFailed++
+				}
+				holes = append(holes, fmt.Sprint(idx))
+			case indexSkipped:
+				s.Skipped++
+			case indexNacked:
+				s.Nacked++
+			case indexPending:
+				s.NotReceived++
+			}
+		}
+		if len(holes) > 0 && len(s.Examples) < 10 {
+			s.Examples = append(s.Examples, fmt.Sprintf("%d:%d [%s]", key.ledger, key.entry, strings.Join(holes, ",")))
+		}
+	}
+	return s
+}
+
+// reportAckHoles 把检查结果写入 monitor 的摘要，未开启检查时什么也不做
+func reportAckHoles(monitor *metrics.MemoryMonitor) {
+	if ackHoles == nil {
+		return
+	}
+	s := ackHoles.stats()
+	monitor.SetAckHoles(s)
+	if s.Holes > 0 {
+		log.Printf("Ack holes: %d received index(es) never acked in %d partially acked batch entries", s.Holes, s.Partial)
+	}
+}
+
+// ackTrackingConsumer 把经过它的 Ack/Nack 记入 ackHoles，其余方法直接转发
+type ackTrackingConsumer struct {
+	pulsar.Consumer
+	t *ackHoleTracker
+}
+
+func (c ackTrackingConsumer) acked(id pulsar.MessageID, err error) {
+	if err != nil {
+		c.t.set(id, indexAckFailed)
+	} else {
+		c.t.set(id, indexAcked)
+	}
+}
+
+func (c ackTrackingConsumer) Ack(msg pulsar.Message) error {
+	err := c.Consumer.Ack(msg)
+	c.acked(msg.ID(), err)
+	return err
+}
+
+func (c ackTrackingConsumer) AckID(id pulsar.MessageID) error {
+	err := c.Consumer.AckID(id)
+	c.acked(id, err)
+	return err
+}
+
+func (c ackTrackingConsumer) AckIDList(ids []pulsar.MessageID) error {
+	err := c.Consumer.AckIDList(ids)
+	for _, id := range ids {
+		c.acked(id, err)
+	}
+	return err
+}
+
+func (c ackTrackingConsumer) Nack(msg pulsar.Message) {
+	c.Consumer.Nack(msg)
+	c.t.set(msg.ID(), indexNacked)
+}
+
+func (c ackTrackingConsumer) NackID(id pulsar.MessageID) {
+	c.Consumer.NackID(id)
+	c.t.set(id, indexNacked)
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// setCPUAffinity 将进程绑定到指定 CPU
+//
+// sched_setaffinity 只作用于单个线程，runtime 启动时已创建多个线程，
+// 因此遍历 /proc/self/task 逐个设置；之后新建的线程继承创建者的掩码
+func setCPUAffinity(cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return unix.SchedSetaffinity(0, &set)
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		// 线程可能已退出，忽略 ESRCH
+		if err := unix.SchedSetaffinity(tid, &set); err != nil && err != unix.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
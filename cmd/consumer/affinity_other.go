@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// setCPUAffinity 非 Linux 平台不支持
+func setCPUAffinity([]int) error {
+	return errors.New("cpu affinity is only supported on linux")
+}
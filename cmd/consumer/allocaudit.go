@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+)
+
+// auditRuns -alloc-audit 每个探针的调用次数，Add 的每次调用需要一条新消息
+const auditRuns = 5000
+
+// auditAllocs -alloc-audit: 在开始消费前测量框架自身的每条消息代码的分配。
+// 用 loopback 的合成消息 (与 -loopback-size 同样大小) 和独立的 monitor 调用与运行时相同配置的
+// BatchProcessor.Add，计数不会混进本次运行的统计；重投递风暴和推迟确认的后台 goroutine 不启动。
+// Add 里按配置有意保留的数据 (-sink、-export 的副本、-decode 的结果) 也计入分配。
+// 两种 -receive-mode 都会测量，对比接收循环每次等待的开销
+func auditAllocs(cfg BatchConfig) []metrics.AllocProbe {
+	monitor, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		log.Printf("Alloc audit skipped: %v", err)
+		return nil
+	}
+	cfg.StormInterval, cfg.AckDelay, cfg.AckJitter = 0, 0, 0
+	cfg.AckBatchSize, cfg.AckFlushAfter = 0, 0
+	consumer := &loopbackConsumer{topic: *topic, sub: "alloc-audit"}
+	bp := NewBatchProcessor(cfg, consumer, monitor)
+
+	// 预先构造消息，不计入 Add 的分配；ReleasePayload 会清空 payload，每次调用用一条新消息
+	gen := payload.NewGenerator(payload.Config{Sizes: payload.Fixed(*loopbackSize), Header: true}, 0)
+	msgs := make([]pulsar.Message, auditRuns+1)
+	now := time.Now()
+	for i := range msgs {
+		msgs[i] = &loopbackMessage{
+			topic:   *topic,
+			id:      pulsar.NewMessageID(0, int64(i), -1, 0),
+			payload: gen.Build(*loopbackSize, 0, uint64(i), now),
+			publish: now,
+		}
+	}
+	next := 0
+	probes := []metrics.AllocProbe{
+		metrics.MeasureAllocs("add", auditRuns, func() {
+			if bp.Add(msgs[next]) {
+				bp.reset()
+			}
+			next++
+		}),
+		metrics.MeasureAllocs("record_message", auditRuns, func() {
+			monitor.RecordMessage(int64(*loopbackSize))
+		}),
+		metrics.MeasureAllocs("record_receive", auditRuns, func() {
+			monitor.RecordReceive(time.Millisecond, true)
+		}),
+		metrics.MeasureAllocs("progress", auditRuns/10, func() {
+			progressLine(monitor, metrics.MemoryStats{}, nil)
+		}),
+	}
+	bp.reset()
+	for _, mode := range []string{receiveModeTimeout, receiveModeChan} {
+		probes = append(probes, auditReceive(mode, msgs[0]))
+	}
+	return probes
+}
+
+// auditReceive 测量 -receive-mode 每次接收的分配: channel 中预先放好消息，只计等待机制本身的开销
+func auditReceive(mode string, msg pulsar.Message) metrics.AllocProbe {
+	consumer := &loopbackConsumer{ch: make(chan pulsar.ConsumerMessage, auditRuns+1)}
+	for range auditRuns + 1 {
+		consumer.ch <- pulsar.ConsumerMessage{Consumer: consumer, Message: msg}
+	}
+	recv := newReceiver(consumer, mode)
+	defer recv.stop()
+	ctx := context.Background()
+	return metrics.MeasureAllocs("receive_"+mode, auditRuns, func() {
+		recv.receive(ctx)
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// -gc-after-batch 的取值: 每个批次处理完成后主动做什么
+const (
+	batchGCForce = "gc"      // runtime.GC()，观察批次释放后的存活堆
+	batchGCFree  = "gc+free" // debug.FreeOSMemory()，GC 之后再把空闲页还给 OS
+	batchGCNone  = "none"    // 不主动触发，完全交给 GOGC/GOMEMLIMIT
+)
+
+// validateBatchGC 检查 -gc-after-batch 和 -gc-every
+func validateBatchGC(mode string, every int) error {
+	switch mode {
+	case batchGCForce, batchGCFree, batchGCNone:
+	default:
+		return fmt.Errorf("invalid -gc-after-batch %q: must be none, gc or gc+free", mode)
+	}
+	if every < 1 {
+		return fmt.Errorf("invalid -gc-every %d: must be >= 1", every)
+	}
+	return nil
+}
+
+// collect 批次处理完成后按 GCMode 每 GCEvery 个批次主动 GC 一次，返回是否触发了
+func (bp *BatchProcessor) collect() bool {
+	if bp.GCMode == batchGCNone || bp.Count()%bp.GCEvery != 0 {
+		return false
+	}
+	start := time.Now()
+	if bp.GCMode == batchGCFree {
+		debug.FreeOSMemory()
+	} else {
+		runtime.GC()
+	}
+	bp.monitor.RecordForcedGC(time.Since(start))
+	return true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// catchUpPoll -catch-up-backlog 查询订阅 backlog 的间隔
+const catchUpPoll = time.Second
+
+// parseInitialPosition 解析 -initial-position 参数
+func parseInitialPosition(s string) (pulsar.SubscriptionInitialPosition, error) {
+	switch s {
+	case "earliest":
+		return pulsar.SubscriptionPositionEarliest, nil
+	case "latest":
+		return pulsar.SubscriptionPositionLatest, nil
+	default:
+		return pulsar.SubscriptionPositionEarliest, fmt.Errorf("unknown initial position %q (want earliest|latest)", s)
+	}
+}
+
+// catchUpEnabled -catch-up-after 或 -catch-up-backlog 开启追赶模式
+func catchUpEnabled() bool {
+	return *catchUpAfter > 0 || *catchUpBacklog > 0
+}
+
+// catchUp 追赶模式: 订阅在 Latest 创建后先不接收，生产端持续写入形成积压，
+// 触发后把订阅 seek 到 Earliest 一次性追赶。同一进程内先后得到空闲 (只有 receiver queue 预取)
+// 和追赶积压两段的内存，分别记为 region catch-up-wait 和 catch-up-drain
+type catchUp struct {
+	drain *metrics.Region
+}
+
+// waitAndSeek 等到 -catch-up-after 到期或 backlog 达到 -catch-up-backlog (先到为准)，然后把全部订阅 seek 到 Earliest；
+// 等待中收到信号时 cancel 并返回 nil，之后的消费循环随 ctx 直接结束
+func waitAndSeek(ctx context.Context, cancel context.CancelFunc, sigCh <-chan os.Signal, consumers []pulsar.Consumer, names []string, monitor *metrics.MemoryMonitor) (*catchUp, error) {
+	log.Printf("Catch-up: subscribed at Latest, waiting for a backlog (after %v, backlog %d; 0 = unused)...", *catchUpAfter, *catchUpBacklog)
+	region := monitor.BeginRegion("catch-up-wait")
+	start := time.Now()
+	trigger, backlog, err := waitCatchUp(ctx, sigCh, names)
+	region.End()
+	if trigger == "signal" {
+		log.Println("Received signal, stopping...")
+		cancel()
+	}
+	if err != nil || ctx.Err() != nil {
+		return nil, err
+	}
+
+	// 分区 topic 的消费者不支持按 MessageID seek，按时间 seek 到纪元之前的位置即 Earliest
+	for i, c := range consumers {
+		if err := c.SeekByTime(time.Unix(0, 0)); err != nil {
+			return nil, fmt.Errorf("failed to seek %s to earliest: %w", names[i], err)
+		}
+	}
+	waited := time.Since(start)
+	monitor.RecordChange("subscription.position", "latest", "earliest", "catch-up: "+trigger+" trigger")
+	monitor.SetMetadata("catch_up.trigger", trigger)
+	monitor.SetMetadata("catch_up.wait_ms", strconv.FormatInt(waited.Milliseconds(), 10))
+	monitor.SetMetadata("catch_up.seek_time", time.Now().Format(time.RFC3339Nano))
+	if backlog >= 0 {
+		monitor.SetMetadata("catch_up.backlog", strconv.FormatInt(backlog, 10))
+	}
+	log.Printf("Catch-up: %s trigger after %v (backlog %d, -1 = not queried), seeked %d subscription(s) to earliest",
+		trigger, waited.Round(time.Millisecond), backlog, len(consumers))
+	return &catchUp{drain: monitor.BeginRegion("catch-up-drain")}, nil
+}
+
+// waitCatchUp 返回触发原因 (after|backlog|signal) 和触发时的 backlog，未查询 backlog 时为 -1
+func waitCatchUp(ctx context.Context, sigCh <-chan os.Signal, names []string) (string, int64, error) {
+	var deadline <-chan time.Time
+	if *catchUpAfter > 0 {
+		timer := time.NewTimer(*catchUpAfter)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var poll <-chan time.Time
+	var client *admin.Client
+	if *catchUpBacklog > 0 {
+		ticker := time.NewTicker(catchUpPoll)
+		defer ticker.Stop()
+		poll = ticker.C
+		client = admin.New(*adminURL)
+	}
+	backlog := int64(-1)
+	for {
+		select {
+		case <-deadline:
+			return "after", backlog, nil
+		case <-poll:
+			n, err := subscriptionBacklog(ctx, client, names)
+			if err != nil {
+				// 只有 backlog 触发时 admin 不可用就永远等不到
+				if deadline == nil {
+					return "", -1, fmt.Errorf("failed to read the subscription backlog: %w", err)
+				}
+				log.Printf("Catch-up: failed to read the subscription backlog: %v", err)
+				continue
+			}
+			backlog = n
+			if n >= *catchUpBacklog {
+				return "backlog", backlog, nil
+			}
+		case <-sigCh:
+			return "signal", backlog, nil
+		case <-ctx.Done():
+			return "", backlog, nil
+		}
+	}
+}
+
+// subscriptionBacklog names 各订阅中最小的 backlog: -fanout 时每个订阅都积压同样的消息，全部达到阈值才触发
+func subscriptionBacklog(ctx context.Context, client *admin.Client, names []string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	stats, err := client.Stats(ctx, *topic)
+	if err != nil {
+		return 0, err
+	}
+	backlog := int64(-1)
+	for _, name := range names {
+		sub, ok := stats.Subscriptions[name]
+		if !ok {
+			return 0, fmt.Errorf("subscription %q not found on %s", name, *topic)
+		}
+		if backlog < 0 || sub.MsgBacklog < backlog {
+			backlog = sub.MsgBacklog
+		}
+	}
+	return backlog, nil
+}
+
+// end 追赶阶段结束 (消费完成、保存结果之前)，未开启追赶模式时不做任何事
+func (c *catchUp) end() {
+	if c != nil {
+		c.drain.End()
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+)
+
+// latencyClock 选取计算消费延迟 (lag) 所用的消息时间戳，并换算到本机时钟
+//
+// publish 为 producer 客户端设置的 publish time，producer 与 consumer 在不同主机时会带上两者的时钟偏差；
+// header 为 payload 头部的发布时间，producer 使用 -ntp-server 时已在 NTP 时间轴上，
+// 本机也用 -ntp-server 估算偏差后即可互相换算；property 为 producer 写入的 timestamp property (纳秒，producer 时钟)，
+// 比毫秒精度的 publish time 更适合亚毫秒的端到端延迟；broker 为 broker entry metadata 中的
+// broker publish time (需要 broker 开启 AppendBrokerTimestampMetadataInterceptor)，假定 broker 已与 NTP 同步。
+// 取不到所选时间戳的消息回退到 publish time 并计数。
+type latencyClock struct {
+	source     string          // publish|header|property|broker
+	ntp        *clock.Estimate // 本机相对 NTP 的偏差，未使用 -ntp-server 时为 nil
+	fallbacks  atomic.Int64    // 回退到 publish time 的消息数
+	minLatency atomic.Int64    // 观察到的最小延迟 (ns)，为负说明仍有未校正的时钟偏差
+}
+
+// latency 为 nil 时直接使用 publish time
+var latency *latencyClock
+
+func newLatencyClock(source, ntpServer string) (*latencyClock, error) {
+	switch source {
+	case "publish", "header", "property", "broker":
+	default:
+		return nil, fmt.Errorf("unknown latency source %q: want publish, header, property or broker", source)
+	}
+	c := &latencyClock{source: source}
+	c.minLatency.Store(math.MaxInt64)
+	if ntpServer != "" {
+		if source == "publish" || source == "property" {
+			return nil, fmt.Errorf("-ntp-server needs -latency-source=header or broker: the %s time is on the producer's unknown clock", source)
+		}
+		ntp, err := clock.Query(ntpServer, 4, 2*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		c.ntp = ntp
+	}
+	return c, nil
+}
+
+// Time 返回消息在本机时钟上的发布时间，必须在 ReleasePayload 之前调用
+func (c *latencyClock) Time(msg pulsar.Message, data []byte) time.Time {
+	if c == nil {
+		return msg.PublishTime()
+	}
+	var t time.Time
+	corrected := false
+	switch c.source {
+	case "header":
+		if h, err := payload.Parse(data); err == nil {
+			t = h.PublishTime
+			corrected = h.Flags&payload.FlagNTPTime != 0
+		}
+	case "property":
+		if ns, err := strconv.ParseInt(msg.Properties()["timestamp"], 10, 64); err == nil {
+			t = time.Unix(0, ns)
+		}
+	case "broker":
+		if bt := msg.BrokerPublishTime(); bt != nil {
+			t, corrected = *bt, true
+		}
+	}
+	if t.IsZero() {
+		c.fallbacks.Add(1)
+		t, corrected = msg.PublishTime(), false
+	}
+	if corrected && c.ntp != nil {
+		t = c.ntp.ToLocal(t)
+	}
+
+	d := int64(time.Since(t))
+	for {
+		cur := c.minLatency.Load()
+		if d >= cur || c.minLatency.CompareAndSwap(cur, d) {
+			break
+		}
+	}
+	return t
+}
+
+// Describe 启动时写入 metadata 的配置和估算的偏差
+func (c *latencyClock) Describe(monitor *metrics.MemoryMonitor) {
+	if c == nil {
+		return
+	}
+	monitor.SetMetadata("latency_source", c.source)
+	if c.ntp != nil {
+		log.Printf("Clock: %v", c.ntp)
+		monitor.SetMetadata("ntp_server", c.ntp.Server)
+		monitor.SetMetadata("clock_offset_ms", strconv.FormatFloat(float64(c.ntp.Offset)/float64(time.Millisecond), 'f', 3, 64))
+		monitor.SetMetadata("clock_rtt_ms", strconv.FormatFloat(float64(c.ntp.RTT)/float64(time.Millisecond), 'f', 3, 64))
+	}
+}
+
+// Close 把观察到的最小延迟和回退计数写入 metadata；最小延迟为负时，
+// 其绝对值是剩余时钟偏差的下界，记为 clock_skew_ms
+func (c *latencyClock) Close(monitor *metrics.MemoryMonitor) {
+	if c == nil {
+		return
+	}
+	fallbacks := c.fallbacks.Load()
+	monitor.SetMetadata("latency_fallbacks", strconv.FormatInt(fallbacks, 10))
+	if fallbacks > 0 {
+		log.Printf("Latency: %d messages had no %s timestamp, used publish time", fallbacks, c.source)
+	}
+	minLatency := c.minLatency.Load()
+	if minLatency == math.MaxInt64 {
+		return
+	}
+	minMs := float64(minLatency) / float64(time.Millisecond)
+	monitor.SetMetadata("min_latency_ms", strconv.FormatFloat(minMs, 'f', 3, 64))
+	if minLatency < 0 {
+		monitor.SetMetadata("clock_skew_ms", strconv.FormatFloat(-minMs, 'f', 3, 64))
+		log.Printf("Warning: messages arrived up to %.3f ms before they were published; clocks are skewed by at least that much (try -latency-source=header with -ntp-server on both sides)", -minMs)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"pulsar-memory-test/pkg/control"
+)
+
+// producerPoll -producer-url 的轮询间隔
+const producerPoll = 100 * time.Millisecond
+
+// completion 非 nil 时按 producer 的已发送计数判断是否消费完，而不是接收超时
+var completion *producerWatch
+
+// producerWatch 轮询 producer 的 /control/status，直到读到 Done 状态 (之后 producer 可能已退出)
+type producerWatch struct {
+	client *control.Client
+
+	mu   sync.Mutex
+	last control.Status
+	seen bool
+}
+
+// startProducerWatch 在后台轮询 producer 直到读到 Done 或 ctx 取消
+func startProducerWatch(ctx context.Context, url string) *producerWatch {
+	w := &producerWatch{client: control.NewClient(url)}
+	go w.run(ctx)
+	return w
+}
+
+func (w *producerWatch) run(ctx context.Context) {
+	ticker := time.NewTicker(producerPoll)
+	defer ticker.Stop()
+	failing := false
+	for {
+		s, err := w.client.Status(ctx)
+		if err != nil {
+			if !failing && ctx.Err() == nil {
+				log.Printf("Waiting for producer at %s: %v", w.client.URL, err)
+			}
+			failing = true
+		} else {
+			failing = false
+			w.mu.Lock()
+			w.last, w.seen = s, true
+			w.mu.Unlock()
+			if s.Done {
+				log.Printf("Producer at %s finished: %d messages, %.2f MB sent", w.client.URL, s.Messages, float64(s.Bytes)/1024/1024)
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// complete producer 已发送完毕且 processed 达到其已发送消息数
+func (w *producerWatch) complete(processed int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last.Done && processed >= w.last.Messages
+}
+
+// check 结束时的核对: 没有读到 producer 的最终计数或处理数少于已发送数时返回错误
+func (w *producerWatch) check(processed int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case !w.seen:
+		return fmt.Errorf("never reached the producer at %s", w.client.URL)
+	case !w.last.Done:
+		return fmt.Errorf("producer at %s had not finished (%d messages sent so far)", w.client.URL, w.last.Messages)
+	case processed < w.last.Messages:
+		return fmt.Errorf("processed %d of %d messages sent by the producer", processed, w.last.Messages)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/progress"
+	"pulsar-memory-test/pkg/results"
+)
+
+// cycleLeakBytes 退订后存活堆每个周期增长超过此值时判定为疑似泄漏
+const cycleLeakBytes = 64 << 10
+
+// subCycle 订阅生命周期中的一个周期: 订阅、消费、退订并关闭，之后 GC 两次再测量
+type subCycle struct {
+	Cycle            int    `json:"cycle"`
+	Messages         int64  `json:"messages"`
+	Batches          int    `json:"batches"`
+	DurationMs       int64  `json:"duration_ms"`
+	HeapAlloc        uint64 `json:"heap_alloc"` // 退订关闭并 GC 之后
+	HeapObjects      uint64 `json:"heap_objects"`
+	Goroutines       int    `json:"goroutines"`
+	HeapDelta        int64  `json:"heap_delta"` // 相对第一次订阅之前的基线
+	UnsubscribeError string `json:"unsubscribe_error,omitempty"`
+}
+
+// subCycleResult -sub-cycles 的结果
+type subCycleResult struct {
+	BaselineHeap       uint64     `json:"baseline_heap"`
+	BaselineGoroutines int        `json:"baseline_goroutines"`
+	Cycles             []subCycle `json:"cycles"`
+	// 第 2 个周期起退订后存活堆对周期序号的最小二乘斜率；第一个周期包含一次性的初始化，不参与拟合
+	HeapPerCycle    float64 `json:"heap_bytes_per_cycle"`
+	GoroutineGrowth int     `json:"goroutine_growth"` // 最后一个周期相对第一个周期
+	SuspectedLeak   bool    `json:"suspected_leak"`
+}
+
+// runSubCycles 重复 订阅 → 消费 interval (或消费完、达到 -max-batches) → Unsubscribe → Close，
+// 退订会删除游标，每个周期都从最早的消息重新消费。first 为已经创建好的第一个消费者。
+// 每个周期记录为一个 region，退订后的存活堆和 goroutine 数写入 sub_cycles 结果
+func runSubCycles(ctx context.Context, cancel context.CancelFunc, sigCh <-chan os.Signal, client pulsar.Client, opts pulsar.ConsumerOptions,
+	first pulsar.Consumer, cfg BatchConfig, monitor *metrics.MemoryMonitor, reporter *progress.Reporter, layout *results.Layout) time.Duration {
+	startTime := time.Now()
+	base := settle()
+	result := subCycleResult{BaselineHeap: base.HeapAlloc, BaselineGoroutines: runtime.NumGoroutine()}
+
+	consumer := first
+	for i := 1; i <= *subCycles; i++ {
+		if consumer == nil {
+			app.Label(ctx, "client")
+			c, err := client.Subscribe(opts)
+			pprof.SetGoroutineLabels(ctx)
+			if err != nil {
+				log.Printf("Cycle %d: subscribe failed, stopping: %v", i, err)
+				break
+			}
+			consumer = c
+		}
+		log.Printf("========== Subscription cycle %d/%d ==========", i, *subCycles)
+		region := monitor.BeginRegion(fmt.Sprintf("cycle-%d", i))
+		before, _, _ := monitor.GetCurrentStats()
+		cycleStart := time.Now()
+
+		cycleCtx, cycleCancel := pprof.WithLabels(ctx, pprof.Labels("cycle", strconv.Itoa(i))), context.CancelFunc(func() {})
+		if *subCycleInterval > 0 {
+			cycleCtx, cycleCancel = context.WithTimeout(cycleCtx, *subCycleInterval)
+		}
+		bp := NewBatchProcessor(cfg, consumer, monitor)
+		runPass(cycleCtx, cancel, sigCh, bp, reporter, *maxBatches)
+		cycleCancel()
+
+		c := subCycle{Cycle: i, Batches: bp.Count(), DurationMs: time.Since(cycleStart).Milliseconds()}
+		after, _, _ := monitor.GetCurrentStats()
+		c.Messages = after - before
+		if err := consumer.Unsubscribe(); err != nil {
+			c.UnsubscribeError = err.Error()
+			log.Printf("Cycle %d: unsubscribe failed: %v", i, err)
+		}
+		consumer.Close()
+		consumer = nil
+		region.End()
+
+		s := settle()
+		c.HeapAlloc, c.HeapObjects, c.Goroutines = s.HeapAlloc, s.HeapObjects, runtime.NumGoroutine()
+		c.HeapDelta = int64(s.HeapAlloc) - int64(base.HeapAlloc)
+		result.Cycles = append(result.Cycles, c)
+		log.Printf("Cycle %d: %d msgs, %d batches in %v | after unsubscribe: heap %.2f MB (%+.2f MB vs baseline), %d objects, %d goroutines",
+			i, c.Messages, c.Batches, time.Duration(c.DurationMs)*time.Millisecond, float64(c.HeapAlloc)/1024/1024,
+			float64(c.HeapDelta)/1024/1024, c.HeapObjects, c.Goroutines)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if consumer != nil {
+		consumer.Close()
+	}
+
+	result.analyze()
+	printSubCycles(&result)
+	path := layout.File("cycles", "sub_cycles", "json")
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save subscription cycles: %v", err)
+	} else {
+		log.Printf("Subscription cycles saved to: %s", path)
+	}
+	return time.Since(startTime)
+}
+
+// settle GC 两次 (第二次回收第一次 GC 时才可回收的 finalizer 对象) 后采集一次
+func settle() runtime.MemStats {
+	runtime.GC()
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms
+}
+
+// analyze 拟合退订后存活堆的增长并判断是否疑似泄漏
+func (r *subCycleResult) analyze() {
+	cycles := r.Cycles
+	if len(cycles) > 1 {
+		cycles = cycles[1:]
+	}
+	if len(cycles) >= 2 {
+		var sumX, sumY, sumXY, sumXX float64
+		for _, c := range cycles {
+			x, y := float64(c.Cycle), float64(c.HeapAlloc)
+			sumX += x
+			sumY += y
+			sumXY += x * y
+			sumXX += x * x
+		}
+		n := float64(len(cycles))
+		if d := n*sumXX - sumX*sumX; d != 0 {
+			r.HeapPerCycle = (n*sumXY - sumX*sumY) / d
+		}
+		r.GoroutineGrowth = cycles[len(cycles)-1].Goroutines - r.Cycles[0].Goroutines
+	}
+	r.SuspectedLeak = r.HeapPerCycle > cycleLeakBytes || r.GoroutineGrowth > 0
+}
+
+// printSubCycles 打印各周期退订后的内存
+func printSubCycles(r *subCycleResult) {
+	log.Println("")
+	log.Println("========== Subscription Cycles ==========")
+	log.Printf("  Baseline: heap %.2f MB, %d goroutines", float64(r.BaselineHeap)/1024/1024, r.BaselineGoroutines)
+	log.Printf("  %5s %10s %8s %12s %12s %11s %10s", "cycle", "msgs", "batches", "heap MB", "delta MB", "objects", "goroutines")
+	for _, c := range r.Cycles {
+		log.Printf("  %5d %10d %8d %12.2f %+12.2f %11d %10d", c.Cycle, c.Messages, c.Batches,
+			float64(c.HeapAlloc)/1024/1024, float64(c.HeapDelta)/1024/1024, c.HeapObjects, c.Goroutines)
+	}
+	if len(r.Cycles) < 3 {
+		log.Println("  Too few cycles to fit a trend (need at least 3)")
+	} else {
+		log.Printf("  Retained heap: %+.1f KB per cycle | goroutines: %+d since cycle 1", r.HeapPerCycle/1024, r.GoroutineGrowth)
+	}
+	if r.SuspectedLeak {
+		log.Printf("  WARNING: memory or goroutines grow with each subscribe/unsubscribe cycle, suspected leak")
+	}
+	log.Println("=========================================")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/progress"
+	"pulsar-memory-test/pkg/results"
+)
+
+// subscriptionNames -fanout 为 1 时即 -sub，否则为 <sub>-0 ... <sub>-(N-1)
+func subscriptionNames() []string {
+	if *fanout <= 1 {
+		return []string{*subscription}
+	}
+	names := make([]string, *fanout)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", *subscription, i)
+	}
+	return names
+}
+
+// fanoutSub 单个订阅的消费统计和堆分摊估算
+//
+// 同一进程内无法直接按订阅拆分堆，这里按各订阅持有的数据量分摊:
+// 权重 = 批次峰值字节数 + 估算的 receiver queue 字节数 (min(消息数, queue-size) × 平均消息大小)，
+// EstHeapMB = 权重占比 × (MaxHeapAlloc - 创建消费者前的 HeapAlloc)。
+type fanoutSub struct {
+	Subscription   string  `json:"subscription"`
+	Messages       int64   `json:"messages"`
+	Bytes          int64   `json:"bytes"`
+	Batches        int     `json:"batches"`
+	PeakBatchBytes int64   `json:"peak_batch_bytes"`
+	EstQueueBytes  int64   `json:"est_queue_bytes"`
+	HeapShare      float64 `json:"heap_share"`
+	EstHeapMB      float64 `json:"est_heap_mb"`
+}
+
+// fanoutResult fanout 结果文件
+type fanoutResult struct {
+	Subscriptions  []fanoutSub `json:"subscriptions"`
+	BaselineHeapMB float64     `json:"baseline_heap_mb"` // 创建消费者前的 HeapAlloc
+	MaxHeapMB      float64     `json:"max_heap_mb"`
+	MaxRSSMB       float64     `json:"max_rss_mb"`
+}
+
+// runFanout 每个订阅一个 goroutine 独立消费，共用 monitor；全部结束或收到信号后返回各订阅统计和耗时
+func runFanout(ctx context.Context, cancel context.CancelFunc, sigCh <-chan os.Signal, consumers []pulsar.Consumer,
+	names []string, cfg BatchConfig, monitor *metrics.MemoryMonitor, reporter *progress.Reporter) ([]fanoutSub, time.Duration) {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	startTime := time.Now()
+	if reporter.Enabled() {
+		go reportProgress(ctx, reporter, monitor, nil)
+	}
+	go func() {
+		select {
+		case <-sigCh:
+			log.Println("Received signal, stopping...")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	subs := make([]fanoutSub, len(consumers))
+	var wg sync.WaitGroup
+	for i, c := range consumers {
+		subs[i].Subscription = names[i]
+		wg.Add(1)
+		go func(bp *BatchProcessor, s *fanoutSub) {
+			defer wg.Done()
+			consumeSubscription(ctx, bp, s)
+			log.Printf("Subscription %s done: %d messages, %d batches", s.Subscription, s.Messages, s.Batches)
+		}(NewBatchProcessor(cfg, c, monitor), &subs[i])
+	}
+	wg.Wait()
+	return subs, time.Since(startTime)
+}
+
+// consumeSubscription 单个订阅的消费循环，与 runPass 的同步模式相同: 处理过数据后一次接收超时即结束
+func consumeSubscription(ctx context.Context, bp *BatchProcessor, s *fanoutSub) {
+	ctx = app.Label(ctx, "receive", "subscription", s.Subscription)
+	recv := newReceiver(bp.consumer, *receiveMode)
+	defer recv.stop()
+	for ctx.Err() == nil {
+		recvStart := time.Now()
+		msg, err := recv.receive(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		bp.monitor.RecordReceive(time.Since(recvStart), err == nil)
+		if err != nil {
+			if bp.Count() > 0 {
+				break
+			}
+			continue
+		}
+		activity.Touch()
+
+		s.Messages++
+		s.Bytes += int64(len(msg.Payload()))
+		full := bp.Add(msg)
+		s.PeakBatchBytes = max(s.PeakBatchBytes, bp.Bytes())
+		if full {
+			bp.Process(ctx)
+			if *maxBatches > 0 && bp.Count() >= *maxBatches {
+				break
+			}
+		}
+	}
+	if bp.Bytes() > 0 {
+		bp.Process(ctx)
+	}
+	bp.finish()
+	s.Batches = bp.Count()
+}
+
+// writeFanout 按持有数据量分摊堆，打印并保存 fanout 结果
+func writeFanout(layout *results.Layout, subs []fanoutSub, summary metrics.MemorySummary, baselineHeap uint64) {
+	var total float64
+	for i := range subs {
+		s := &subs[i]
+		if s.Messages > 0 {
+			s.EstQueueBytes = min(s.Messages, int64(*receiverQueueSize)) * (s.Bytes / s.Messages)
+		}
+		total += float64(s.PeakBatchBytes + s.EstQueueBytes)
+	}
+	attributable := 0.0
+	if summary.MaxHeapAlloc > baselineHeap {
+		attributable = float64(summary.MaxHeapAlloc-baselineHeap) / 1024 / 1024
+	}
+	result := fanoutResult{
+		Subscriptions:  subs,
+		BaselineHeapMB: float64(baselineHeap) / 1024 / 1024,
+		MaxHeapMB:      float64(summary.MaxHeapAlloc) / 1024 / 1024,
+		MaxRSSMB:       float64(summary.MaxRSS) / 1024 / 1024,
+	}
+
+	log.Println("")
+	log.Printf("========== Fan-out (%d subscriptions) ==========", len(subs))
+	log.Printf("  %-24s %10s %10s %14s %16s", "Subscription", "Messages", "MB", "Peak batch MB", "Est. heap MB")
+	for i := range subs {
+		s := &subs[i]
+		if total > 0 {
+			s.HeapShare = float64(s.PeakBatchBytes+s.EstQueueBytes) / total
+		}
+		s.EstHeapMB = s.HeapShare * attributable
+		log.Printf("  %-24s %10d %10.2f %14.2f %9.2f (%3.0f%%)", s.Subscription, s.Messages,
+			float64(s.Bytes)/1024/1024, float64(s.PeakBatchBytes)/1024/1024, s.EstHeapMB, s.HeapShare*100)
+	}
+	log.Printf("  Heap above baseline: %.2f MB (baseline %.2f MB, max %.2f MB) | Max RSS: %.2f MB",
+		attributable, result.BaselineHeapMB, result.MaxHeapMB, result.MaxRSSMB)
+	log.Println("  (estimates split the heap by data held per subscription: peak batch + receiver queue)")
+	log.Println("=================================================")
+
+	path := layout.File("fanout", "fanout", "json")
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save fan-out result: %v", err)
+	} else {
+		log.Printf("Fan-out result saved to: %s", path)
+	}
+}
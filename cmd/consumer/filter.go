@@ -0,0 +1,33 @@
+package main
+
+import (
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/batch"
+)
+
+// filtered 按 FilterRatio 决定当前消息是否被过滤，过滤掉的消息在接收顺序上均匀分布
+func (bp *BatchProcessor) filtered() bool {
+	if bp.FilterRatio <= 0 {
+		return false
+	}
+	bp.filterCredit += bp.FilterRatio
+	if bp.filterCredit >= 1 {
+		bp.filterCredit--
+		return true
+	}
+	return false
+}
+
+// drop 模拟客户端过滤: 消息只计数并立即确认，不解码、不进入批次，payload 随 Message 一起可被回收
+func (bp *BatchProcessor) drop(msg pulsar.Message, size int64, publishTime time.Time, received time.Duration) {
+	bp.monitor.RecordMessage(size)
+	bp.monitor.RecordFiltered(size)
+	bp.monitor.RecordPartition(msg.Topic(), size, msg.ID())
+	bp.monitor.RecordPublishTime(publishTime)
+	bp.SeePublish(msg.PublishTime())
+	start := time.Now()
+	bp.recordAck(start, bp.consumer.Ack(msg))
+	bp.monitor.RecordHolding(batch.HoldClock() - received)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// gcTrace 开启 -gctrace 时的 stderr 捕获，saveResults 把记录并入 stats
+var gcTrace *gcTraceCapture
+
+// gcTraceCapture 从重定向的 stderr 中解析 gctrace 行，所有内容原样转发到原 stderr
+type gcTraceCapture struct {
+	mu      sync.Mutex
+	records []metrics.GCTraceRecord
+}
+
+// hasGCTrace 判断 GODEBUG 是否已开启 gctrace；runtime 只在启动时读取该设置
+func hasGCTrace(godebug string) bool {
+	for _, kv := range strings.Split(godebug, ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(kv), "gctrace="); ok {
+			return v != "" && v != "0"
+		}
+	}
+	return false
+}
+
+func (c *gcTraceCapture) read(r io.Reader, out io.Writer) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		io.WriteString(out, line+"\n")
+		if rec, ok := metrics.ParseGCTraceLine(line); ok {
+			rec.Timestamp = time.Now()
+			c.mu.Lock()
+			c.records = append(c.records, rec)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Records 返回目前解析到的所有 GC 记录
+func (c *gcTraceCapture) Records() []metrics.GCTraceRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]metrics.GCTraceRecord(nil), c.records...)
+}
+
+// godebugWithGCTrace 在现有 GODEBUG 后追加 gctrace=1
+func godebugWithGCTrace() string {
+	if v := os.Getenv("GODEBUG"); v != "" {
+		return v + ",gctrace=1"
+	}
+	return "gctrace=1"
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startGCTrace 开启并捕获 gctrace
+//
+// GODEBUG 未开启 gctrace 时以相同参数 exec 自身 (PID 不变，cgroup 等外部监控不受影响)；
+// 否则把 fd 2 换成 pipe，runtime 直接写 fd 2 的 trace 行和 log 输出都经过解析 goroutine 转发到原 stderr
+func startGCTrace() (*gcTraceCapture, error) {
+	if !hasGCTrace(os.Getenv("GODEBUG")) {
+		env := append(os.Environ(), "GODEBUG="+godebugWithGCTrace())
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("re-exec with gctrace: %w", syscall.Exec(exe, os.Args, env))
+	}
+
+	orig, err := unix.Dup(2)
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		unix.Close(orig)
+		return nil, err
+	}
+	if err := unix.Dup3(int(w.Fd()), 2, 0); err != nil {
+		unix.Close(orig)
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	w.Close()
+
+	out := os.NewFile(uintptr(orig), "stderr")
+	// 进程崩溃时解析 goroutine 可能来不及转发，崩溃信息直接写到原 stderr
+	if err := debug.SetCrashOutput(out, debug.CrashOptions{}); err != nil {
+		return nil, err
+	}
+	c := &gcTraceCapture{}
+	go c.read(r, out)
+	return c, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// startGCTrace 非 Linux 平台不支持
+func startGCTrace() (*gcTraceCapture, error) {
+	return nil, errors.New("gctrace capture is only supported on linux")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"pulsar-memory-test/pkg/hook"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// msgHook 非 nil 时 (-hook-plugin) BatchProcessor.Add 把每条消息先交给插件，按其结果决定是否进入批次
+var msgHook *messageHook
+
+// messageHook 包装插件的 Processor，统计各结果的条数和插件耗时；
+// -fanout 时多个消费 goroutine 并发调用 apply
+type messageHook struct {
+	path string
+	proc hook.Processor
+
+	kept    atomic.Int64
+	dropped atomic.Int64
+	nacked  atomic.Int64
+	errors  atomic.Int64
+	nanos   atomic.Int64
+}
+
+// newMessageHook 加载 -hook-plugin
+func newMessageHook(path, config string) (*messageHook, error) {
+	proc, err := hook.Load(path, config)
+	if err != nil {
+		return nil, err
+	}
+	return &messageHook{path: path, proc: proc}, nil
+}
+
+// apply 调用插件处理 msg，data 为 msg.Payload()；出错的消息按 Nack 处理
+func (h *messageHook) apply(msg pulsar.Message, data []byte) hook.Action {
+	m := hook.Message{
+		Topic:           msg.Topic(),
+		Key:             msg.Key(),
+		Properties:      msg.Properties(),
+		Payload:         data,
+		PublishTime:     msg.PublishTime(),
+		RedeliveryCount: msg.RedeliveryCount(),
+	}
+	start := time.Now()
+	action, err := h.proc.Process(&m)
+	h.nanos.Add(int64(time.Since(start)))
+	if err != nil {
+		// 插件有 bug 时每条消息都会失败，只有第一次用 Warn
+		if h.errors.Add(1) == 1 {
+			logging.Warnf("Hook %s failed, nacking the message (further failures at debug level): %v", h.path, err)
+		} else {
+			logging.Debugf("Hook %s failed: %v", h.path, err)
+		}
+		return hook.Nack
+	}
+	switch action {
+	case hook.Drop:
+		h.dropped.Add(1)
+	case hook.Nack:
+		h.nacked.Add(1)
+	default:
+		h.kept.Add(1)
+		action = hook.Keep
+	}
+	return action
+}
+
+// close 消费结束后关闭插件，打印各结果的条数并写入元数据
+func (h *messageHook) close(monitor *metrics.MemoryMonitor) {
+	if h == nil {
+		return
+	}
+	if c, ok := h.proc.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("Hook %s: Close failed: %v", h.path, err)
+		}
+	}
+	kept, dropped, nacked, errs := h.kept.Load(), h.dropped.Load(), h.nacked.Load(), h.errors.Load()
+	elapsed := time.Duration(h.nanos.Load())
+	var avg time.Duration
+	if n := kept + dropped + nacked + errs; n > 0 {
+		avg = elapsed / time.Duration(n)
+	}
+	log.Printf("Hook %s: kept %d, dropped %d, nacked %d, errors %d | %v in the plugin (avg %v per message)",
+		h.path, kept, dropped, nacked, errs, elapsed.Round(time.Millisecond), avg)
+	monitor.SetMetadata("hook.kept", strconv.FormatInt(kept, 10))
+	monitor.SetMetadata("hook.dropped", strconv.FormatInt(dropped, 10))
+	monitor.SetMetadata("hook.nacked", strconv.FormatInt(nacked, 10))
+	monitor.SetMetadata("hook.errors", strconv.FormatInt(errs, 10))
+	monitor.SetMetadata("hook.time_ms", strconv.FormatInt(elapsed.Milliseconds(), 10))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/payload"
+)
+
+// messageSequence 取消息的 producer worker 和序号: 优先解析 payload 头部，
+// 其次使用 worker/sequence property；都没有时 ok 为 false。需在 ReleasePayload 之前调用
+func messageSequence(msg pulsar.Message, data []byte) (worker uint32, seq uint64, ok bool) {
+	if h, err := payload.Parse(data); err == nil {
+		return h.Worker, h.Sequence, true
+	}
+	props := msg.Properties()
+	w, err := strconv.ParseUint(props["worker"], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	s, err := strconv.ParseUint(props["sequence"], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint32(w), s, true
+}
+
+// recordKey -key-stats 时记录消息的 key 和序号；重投递的消息只记录到达
+func (bp *BatchProcessor) recordKey(msg pulsar.Message, data []byte) {
+	worker, seq, ok := messageSequence(msg, data)
+	bp.monitor.RecordKey(msg.Key(), worker, seq, ok && msg.RedeliveryCount() == 0)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/payload"
+)
+
+const (
+	backendPulsar   = "pulsar"
+	backendLoopback = "loopback"
+)
+
+// errLoopback loopback 后端不支持的操作 (seek、事务、重试 topic 等)
+var errLoopback = errors.New("not supported by -backend=loopback")
+
+// loopbackConsumer 不经过 Pulsar 客户端的消息源: 生成 goroutine 按 producer 的方式构造 payload
+// (带头部，-verify 可用)，写入容量为 -queue-size 的 channel，Receive 和 Chan 直接读取这个 channel。
+// 批处理、确认、监控等其余流程与 pulsar 后端完全相同，两次运行的内存之差即为客户端所占。
+// 确认为空操作，Nack 的消息不会重投递
+type loopbackConsumer struct {
+	topic string
+	sub   string
+	ch    chan pulsar.ConsumerMessage
+	stop  chan struct{}
+}
+
+// newLoopbackConsumer 创建消息源并开始生成 total 字节、每条 size 字节的消息；
+// 生成完毕后 Receive 阻塞到超时，与积压已消费完的订阅一致
+func newLoopbackConsumer(topic, sub string, queueSize int, total int64, size int) *loopbackConsumer {
+	c := &loopbackConsumer{
+		topic: topic,
+		sub:   sub,
+		ch:    make(chan pulsar.ConsumerMessage, max(queueSize, 1)),
+		stop:  make(chan struct{}),
+	}
+	go c.generate(total, size)
+	return c
+}
+
+func (c *loopbackConsumer) generate(total int64, size int) {
+	gen := payload.NewGenerator(payload.Config{Sizes: payload.Fixed(size), Header: true}, 0)
+	for seq := int64(0); seq*int64(size) < total; seq++ {
+		now := time.Now()
+		msg := &loopbackMessage{
+			topic:   c.topic,
+			id:      pulsar.NewMessageID(0, seq, -1, 0),
+			payload: gen.Build(size, 0, uint64(seq), now),
+			publish: now,
+		}
+		select {
+		case c.ch <- pulsar.ConsumerMessage{Consumer: c, Message: msg}:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *loopbackConsumer) Receive(ctx context.Context) (pulsar.Message, error) {
+	select {
+	case cm := <-c.ch:
+		return cm.Message, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *loopbackConsumer) Close() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+}
+
+func (c *loopbackConsumer) Subscription() string                                { return c.sub }
+func (c *loopbackConsumer) Name() string                                        { return backendLoopback }
+func (c *loopbackConsumer) Unsubscribe() error                                  { return nil }
+func (c *loopbackConsumer) UnsubscribeForce() error                             { return nil }
+func (c *loopbackConsumer) Chan() <-chan pulsar.ConsumerMessage                 { return c.ch }
+func (c *loopbackConsumer) Ack(pulsar.Message) error                            { return nil }
+func (c *loopbackConsumer) AckID(pulsar.MessageID) error                        { return nil }
+func (c *loopbackConsumer) AckIDList([]pulsar.MessageID) error                  { return nil }
+func (c *loopbackConsumer) AckWithTxn(pulsar.Message, pulsar.Transaction) error { return errLoopback }
+func (c *loopbackConsumer) AckCumulative(pulsar.Message) error                  { return nil }
+func (c *loopbackConsumer) AckIDCumulative(pulsar.MessageID) error              { return nil }
+func (c *loopbackConsumer) ReconsumeLater(pulsar.Message, time.Duration)        {}
+func (c *loopbackConsumer) Nack(pulsar.Message)                                 {}
+func (c *loopbackConsumer) NackID(pulsar.MessageID)                             {}
+func (c *loopbackConsumer) Seek(pulsar.MessageID) error                         { return errLoopback }
+func (c *loopbackConsumer) SeekByTime(time.Time) error                          { return errLoopback }
+
+func (c *loopbackConsumer) GetLastMessageIDs() ([]pulsar.TopicMessageID, error) {
+	return nil, errLoopback
+}
+
+func (c *loopbackConsumer) ReconsumeLaterWithCustomProperties(pulsar.Message, map[string]string, time.Duration) {
+}
+
+// loopbackMessage 只带 payload、ID 和发布时间的消息，没有 key 和 properties
+type loopbackMessage struct {
+	topic   string
+	id      pulsar.MessageID
+	payload []byte
+	publish time.Time
+}
+
+func (m *loopbackMessage) Topic() string                                   { return m.topic }
+func (m *loopbackMessage) ProducerName() string                            { return backendLoopback }
+func (m *loopbackMessage) Properties() map[string]string                   { return nil }
+func (m *loopbackMessage) Payload() []byte                                 { return m.payload }
+func (m *loopbackMessage) ID() pulsar.MessageID                            { return m.id }
+func (m *loopbackMessage) PublishTime() time.Time                          { return m.publish }
+func (m *loopbackMessage) EventTime() time.Time                            { return time.Time{} }
+func (m *loopbackMessage) Key() string                                     { return "" }
+func (m *loopbackMessage) OrderingKey() string                             { return "" }
+func (m *loopbackMessage) RedeliveryCount() uint32                         { return 0 }
+func (m *loopbackMessage) IsReplicated() bool                              { return false }
+func (m *loopbackMessage) GetReplicatedFrom() string                       { return "" }
+func (m *loopbackMessage) GetSchemaValue(interface{}) error                { return errLoopback }
+func (m *loopbackMessage) SchemaVersion() []byte                           { return nil }
+func (m *loopbackMessage) GetEncryptionContext() *pulsar.EncryptionContext { return nil }
+func (m *loopbackMessage) Index() *uint64                                  { return nil }
+func (m *loopbackMessage) BrokerPublishTime() *time.Time                   { return nil }
+func (m *loopbackMessage) ReleasePayload()                                 { m.payload = nil }
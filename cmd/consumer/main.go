@@ -1,253 +1,1410 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	_ "net/http/pprof"
+	"maps"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
-	"syscall"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/pulsar-client-go/pulsar/backoff"
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/batch"
+	"pulsar-memory-test/pkg/control"
+	"pulsar-memory-test/pkg/hook"
+	"pulsar-memory-test/pkg/logging"
 	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+	"pulsar-memory-test/pkg/precheck"
+	"pulsar-memory-test/pkg/profview"
+	"pulsar-memory-test/pkg/progress"
+	"pulsar-memory-test/pkg/results"
+	"pulsar-memory-test/pkg/workload"
 )
 
 var (
-	pulsarURL         = flag.String("url", "pulsar://localhost:6650", "Pulsar broker URL")
+	backend           = flag.String("backend", backendPulsar, "Message source: pulsar (subscribe via -url) or loopback (no client: an in-process generator feeds -loopback-total bytes through a -queue-size channel into the same batch pipeline, measuring the harness's own memory to subtract from a pulsar run)")
+	loopbackTotal     = flag.Int64("loopback-total", 100*1024*1024, "With -backend=loopback, total bytes to generate")
+	loopbackSize      = flag.Int("loopback-size", 1024, "With -backend=loopback, message size in bytes")
+	pulsarURL         = flag.String("url", "pulsar://localhost:6650", "Pulsar service URL: a broker, or a Pulsar proxy (lookups then route through the proxy)")
+	listenerName      = flag.String("listener-name", "", "Listener name for brokers with advertisedListeners (e.g. internal/external behind a Kubernetes load balancer): lookups return that listener's address (empty = the default listener)")
 	topic             = flag.String("topic", "persistent://public/default/memory-test", "Topic name")
 	subscription      = flag.String("sub", "memory-test-sub", "Subscription name")
-	batchSize         = flag.Int64("batch-size", 50*1024*1024, "Batch size in bytes before processing")
+	batchSize         = flag.Int64("batch-size", batch.DefaultSize, "Batch size in bytes before processing")
 	receiverQueueSize = flag.Int("queue-size", 1000, "Consumer receiver queue size")
+	queueEstimate     = flag.String("queue-estimate", "client", "How to estimate messages buffered in the receiver queue per sample: client (client prefetch metrics) or broker (msgOutCounter from -admin-url topic stats minus received)")
+	opTimeout         = flag.Duration("operation-timeout", 30*time.Second, "OperationTimeout: producer-create, subscribe and lookup requests are retried (100ms backoff, doubling) until this timeout")
+	connTimeout       = flag.Duration("connection-timeout", 30*time.Second, "ConnectionTimeout: TCP connect timeout to a broker")
+	keepAlive         = flag.Duration("keep-alive", 0, "KeepAliveInterval: ping interval; a connection with no data from the broker for two intervals is closed (0 = client default 30s)")
+	maxReconnect      = flag.Int("max-reconnect", -1, "MaxReconnectToBroker: reconnect attempts (each one a fresh lookup) after losing the broker connection (-1 = unlimited)")
+	backoffStart      = flag.Duration("initial-backoff", 0, "Initial reconnect backoff, doubled up to 60s (0 = client default 100ms)")
+	maxConns          = flag.Int("max-connections-per-broker", 0, "Connection pool: MaxConnectionsPerBroker, connections opened to each broker, producers/consumers spread across them (0 = client default 1)")
+	connMaxIdle       = flag.Duration("connection-max-idle", 0, "Connection pool: ConnectionMaxIdleTime, close a connection unused for this long (0 = client default 3m, minimum 1m, negative = never)")
 	memoryLimit       = flag.Int64("memory-limit", 0, "Client memory limit in bytes (0 = no limit)")
 	gcPercent         = flag.Int("gc-percent", 100, "GOGC value")
+	gomaxprocs        = flag.Int("gomaxprocs", 0, "GOMAXPROCS value (0 = runtime default, or the -cpu-affinity CPU count)")
+	cpuAffinity       = flag.String("cpu-affinity", "", "Pin the process to these CPUs, taskset-style (e.g. 0-3,6; Linux only)")
 	pprofPort         = flag.Int("pprof-port", 6060, "pprof HTTP server port")
+	metricsPort       = flag.Int("metrics-port", 0, "Also serve /metrics and /stats/current (no pprof) on this port on all interfaces for Prometheus/Grafana (0 = only on the pprof server)")
 	outputDir         = flag.String("output", "./results", "Output directory for results")
-	processDelay      = flag.Duration("process-delay", 0, "Simulated processing delay per batch")
+	processDelay      = flag.Duration("process-delay", 0, "Simulated processing delay: per batch, or the mean per-message delay with a per-message -process-delay-dist")
+	processDelayDist  = flag.String("process-delay-dist", "batch", "How -process-delay is applied: batch (once per batch), or per message with fixed, exponential or pareto[:alpha] (default alpha 1.5) delays whose sum is the batch's processing time")
 	maxBatches        = flag.Int("max-batches", 0, "Maximum number of batches to process (0 = unlimited)")
-	scenario          = flag.String("scenario", "default", "Test scenario name for output files")
+	pipelineDepth     = flag.Int("pipeline-depth", 0, "Decouple Receive from processing via a bounded channel of this many messages (0 = synchronous loop)")
+	hookPlugin        = flag.String("hook-plugin", "", "Load a Go plugin (.so built with -buildmode=plugin, see plugins/example) whose NewProcessor handles every message before batching and returns keep, drop (ack now) or nack; batching, acks and metrics stay in the harness")
+	hookConfig        = flag.String("hook-config", "", "Configuration string passed to the -hook-plugin's NewProcessor")
+	routeBy           = flag.String("route-by", "", "Demultiplex messages by key or property:<name> (hashed) into -route-queues in-memory queues, each batching to its own threshold, and report how partially filled batches inflate steady-state memory in route_<scenario>.json (empty = one queue)")
+	routeQueues       = flag.Int("route-queues", 4, "Number of queues for -route-by")
+	routeBatchSizes   = flag.String("route-batch-sizes", "", "Comma-separated batch sizes in bytes for the -route-by queues, reused cyclically when shorter than -route-queues (empty = -batch-size for every queue)")
+	scenario          = flag.String("scenario", "", "Test scenario name for output files (empty = generated from the backend, -preset, -batch-size, -queue-size, -memory-limit and -fanout plus the start time, e.g. consumer-batch50m-q1000-20261015-130405)")
+	precheckFlag      = flag.Bool("precheck", true, "Before connecting, check broker reachability, the topic (via -admin-url), free disk in the output dir, the open-files limit and available memory vs -memory-limit + -batch-size; exit on failures")
+	precheckCreate    = flag.Bool("precheck-create-topic", false, "With -precheck, create -topic (non-partitioned) via -admin-url when it does not exist instead of only warning")
+	force             = flag.Bool("force", false, "Overwrite the results of an earlier consumer run with the same -scenario (and -run-id with -layout=run) instead of refusing to start")
 	releasePayload    = flag.Bool("release-payload", false, "Release payload after business processing to save memory")
+	retainMode        = flag.String("retain", "message", "What a batch retains until ack: message (pulsar.Message) or id (MessageID + payload size only)")
+	gcAfterBatch      = flag.String("gc-after-batch", "gc", "Forced GC after each processed batch: gc (runtime.GC, the long-standing default), gc+free (debug.FreeOSMemory: GC and return free pages to the OS) or none (leave it to GOGC/GOMEMLIMIT, for throughput-oriented runs)")
+	gcEvery           = flag.Int("gc-every", 1, "With -gc-after-batch=gc or gc+free, only collect after every Nth batch")
+	ackDelay          = flag.Duration("ack-delay", 0, "Ack each processed batch this long after processing instead of immediately, like an app that acks after a downstream commit (only MessageIDs are kept meanwhile; the broker stops dispatching at maxUnackedMessagesPerConsumer)")
+	ackJitter         = flag.Duration("ack-jitter", 0, "Extra random delay in [0, jitter) added to -ack-delay per batch; batches may then be acked out of order")
+	ackBatchSize      = flag.Int("ack-batch-size", 0, "Buffer the acks of processed messages independently of the processing batch and send them once this many are buffered (0 = no size trigger); buffered acks per sample go to buffered_acks")
+	ackBatchInterval  = flag.Duration("ack-batch-interval", 0, "With ack batching, also send the buffered acks once the oldest has waited this long (timer flush; 0 = no time trigger)")
+	ackRatio          = flag.Float64("ack-ratio", 1.0, "Fraction of messages to ack (0-1); the rest are skipped per -skip-action")
+	filterRatio       = flag.Float64("filter-ratio", 0, "Fraction of messages (0-1) acked and dropped on receipt without processing, simulating client-side filtering; they still count as consumed")
+	skipAction        = flag.String("skip-action", "leave", "What to do with skipped (non-acked) messages: leave (stay unacked) or nack (redeliver after -nack-delay)")
+	stormInterval     = flag.Duration("redelivery-storm", 0, "Chaos mode: at this interval, nack every message left unacked since the last storm (needs -ack-ratio < 1 with -skip-action=leave) so they are all redelivered together after -nack-delay; per-storm redeliveries and memory go to summary.storms")
+	ttlLag            = flag.Duration("ttl-lag", 0, "TTL expiry mode: after the first batch, stop receiving for this long (longer than the namespace message TTL set with scripts/set-ttl.sh), then expire the subscription's messages older than the TTL via -admin-url and keep consuming; expired messages, ack holes, redeliveries and memory go to ttl_<scenario>.json")
+	nackDelay         = flag.Duration("nack-delay", 0, "NackRedeliveryDelay for nacked messages (0 = client default 1m)")
+	subType           = flag.String("sub-type", "shared", "Subscription type: exclusive, shared, failover, key_shared")
+	readCompacted     = flag.Bool("read-compacted", false, "Read the compacted view of the topic (requires exclusive or failover subscription)")
+	subMode           = flag.String("subscription-mode", "durable", "Subscription mode: durable or non_durable (cursor not persisted, like a Reader)")
+	replicateSubState = flag.Bool("replicate-subscription", false, "Replicate subscription state (cursor) across geo-replicated clusters")
+	topicsPattern     = flag.String("topics-pattern", "", "Subscribe to all topics matching this regex instead of -topic (e.g. persistent://public/default/churn-.*)")
+	discoveryPeriod   = flag.Duration("auto-discovery-period", time.Minute, "How often a pattern subscription looks for new/deleted topics, or a partitioned -topic for added partitions")
+	consumerName      = flag.String("name", "", "Consumer name shown in broker stats (empty = client generated)")
+	priorityLevel     = flag.Int("priority", -1, "Consumer priority level for Shared dispatch, 0 = highest (-1 = unset)")
+	subProperties     = flag.String("sub-properties", "", "Subscription properties as comma-separated key=value pairs")
+	decodeMode        = flag.String("decode", "none", "Unmarshal each payload into a struct before processing: none|json|proto (producer must use the same -encoding)")
+	sinkKind          = flag.String("sink", "", "Write each processed batch downstream: blackhole|file|http (empty = none)")
+	sinkPath          = flag.String("sink-path", "", "Output file for -sink=file (default <output>/sink_<scenario>.bin)")
+	sinkURL           = flag.String("sink-url", "", "Endpoint for -sink=http (batches are POSTed)")
+	sinkLatency       = flag.Duration("sink-latency", 0, "Extra latency added to every sink write")
+	sinkFailureRate   = flag.Float64("sink-failure-rate", 0, "Probability (0-1) that a sink write fails")
+	sinkRetries       = flag.Int("sink-retries", 3, "Retries per batch before giving up and nacking it")
+	sinkBackoff       = flag.Duration("sink-retry-backoff", 100*time.Millisecond, "Initial sink retry backoff (doubles per retry)")
+	exportFormat      = flag.String("export", "", "Serialize each batch to a temporary file before ack: ndjson|parquet (empty = none)")
+	openPprof         = flag.String("open-pprof", "", "After the run, serve the heap profile with go tool pprof -http on this address (e.g. localhost:8080), or \"embedded\" to keep serving it under /debug/profiles/")
+	pprofHost         = flag.String("pprof-host", "localhost", "Bind address of the pprof/diagnostics HTTP server (0.0.0.0 for remote access)")
+	layoutMode        = flag.String("layout", "flat", "Results layout: flat (<output>/stats_<scenario>.json ...) or run (<output>/<scenario>/<run-id>/ with manifest.json)")
+	runID             = flag.String("run-id", "", "Run ID for -layout=run (default: current time); pass the producer's ID to share a directory")
+	artifactURL       = flag.String("artifact-url", "", "Upload this run's artifacts (stats, profiles, logs, manifest) to s3://bucket[/prefix] (aws CLI) or gs://bucket[/prefix] (gcloud CLI) when done")
+	labels            = flag.String("labels", "", "Labels attached to exported metrics, progress lines, stats/summary files, result.json and manifest.json, as comma-separated key=value pairs (e.g. client_version=v0.14.0,experiment=exp-42)")
+	trackPIDs         = flag.String("track-pids", "", "Comma-separated [name=]pid of co-located processes (e.g. a local Pulsar standalone or proxy) whose RSS is sampled with this process's, reported per process and as a total in the stats")
+	sizeUnit          = flag.String("size-unit", "MiB", metrics.SizeUnitUsage)
+	pushGateway       = flag.String("push-gateway", "", "Push client and monitor metrics to this Prometheus Pushgateway (http://host:9091) every -push-interval and once more at exit")
+	statsdAddr        = flag.String("statsd-addr", "", "Send client and monitor metrics as DogStatsD gauges over UDP to this host:port every -push-interval and once more at exit")
+	statsdPrefix      = flag.String("statsd-prefix", "", "Prefix prepended to every StatsD metric name")
+	pushInterval      = flag.Duration("push-interval", 10*time.Second, "Interval between pushes for -push-gateway and -statsd-addr")
+	tsdbKind          = flag.String("tsdb", "", "Write every monitor sample to a time-series database as soon as it is taken: influx|timescale (empty = none)")
+	tsdbURL           = flag.String("tsdb-url", "", "Write endpoint for -tsdb: InfluxDB write URL (http://host:8086/api/v2/write?org=o&bucket=b) or PostgREST table URL for TimescaleDB (http://host:3000/pulsar_memory)")
+	tsdbToken         = flag.String("tsdb-token", os.Getenv("TSDB_TOKEN"), "API token for -tsdb (InfluxDB token or PostgREST JWT; default $TSDB_TOKEN)")
+	logFile           = flag.String("log-file", "", "Also write logs to this file (rotated by size)")
+	logLevel          = flag.String("log-level", "info", "Log level: debug, info, warn (hide per-batch and progress lines) or error")
+	logMaxSize        = flag.Int64("log-max-size", 100*1024*1024, "Rotate -log-file when it exceeds this many bytes (0 = never)")
+	logMaxBackups     = flag.Int("log-max-backups", 5, "Number of rotated log files to keep")
+	progressInterval  = flag.Duration("progress-interval", 5*time.Second, "Progress report interval")
+	progressFormat    = flag.String("progress-format", "log", "Progress report format: log, json (one object per line on stdout) or none")
+	abRelease         = flag.Bool("ab-release-payload", false, "A/B test: consume twice in one process, without then with -release-payload (seeking back in between), and compare memory")
+	checkRelease      = flag.Bool("check-release", false, "After ReleasePayload, read Payload()/Properties() again (right away and at ack time) and count nil/empty/stale/changed results")
+	checkAckHoles     = flag.Bool("check-ack-holes", false, "Track the batch index acks of every batched entry and report, at exit, entries left partially acked (received indexes never acked) as summary.ack_holes; any hole fails the run with status 4 (verification_failure)")
+	maxHeapMB         = flag.Int("max-heap-mb", 0, "Exit with status 2 (threshold_breach) if HeapAlloc ever exceeds this many MB (0 = no limit)")
+	maxRSSMB          = flag.Int("max-rss-mb", 0, "Exit with status 2 (threshold_breach) if RSS ever exceeds this many MB (0 = no limit)")
+	ballastMB         = flag.Int("ballast-mb", 0, "Allocate a heap ballast of this many MB at startup (raises the GC heap goal without touching RSS; 0 = none)")
+	profileEvery      = flag.Int("profile-every", 0, "Save heap and goroutine profiles every N batches (0 = off); the inuse growth between the first and last snapshot goes into summary.heap_growth")
+	profileInterval   = flag.Duration("profile-interval", 0, "Save heap and goroutine profiles at this interval (0 = off); combinable with -profile-every")
+	gcTraceFlag       = flag.Bool("gctrace", false, "Run with GODEBUG=gctrace=1 (re-execs itself if needed) and merge the parsed per-GC records into the stats JSON (Linux only)")
+	verifyPayload     = flag.Bool("verify", false, "Verify each payload's CRC32 (header or crc32 property) and count corrupted messages")
+	preset            = flag.String("preset", "", "Apply a built-in scenario's flag defaults (explicit flags win); -preset=list shows them")
+	stallTimeout      = flag.Duration("stall-timeout", 0, "Exit with status 5 (stalled) after this long without receiving a message while the subscription still has backlog; dumps goroutine stacks (0 = disabled)")
+	receiveMode       = flag.String("receive-mode", receiveModeTimeout, "How the consume loop waits for a message: timeout (Receive with a new 100ms context per call) or chan (consumer.Chan() with one reused timer, no per-call allocations); compare with -alloc-audit")
+	allocAudit        = flag.Bool("alloc-audit", false, "Before consuming, measure the harness's own allocations per call (batch Add, RecordMessage, RecordReceive, progress line) with synthetic -loopback-size messages; reported as summary.harness_allocs")
+	adminURL          = flag.String("admin-url", admin.DefaultURL, "Pulsar admin REST URL, used by -stall-timeout to read the subscription backlog and by -precheck to check the topic")
+	ackWithResponse   = flag.Bool("ack-with-response", false, "Enable AckWithResponse (each Ack waits for the broker) and record per-ack and per-batch ack latency")
+	seekBack          = flag.Duration("seek-back", 0, "After subscribing, seek the subscription to (now - this) and drain to the head, e.g. 2h (0 = start from the current cursor)")
+	initialPosition   = flag.String("initial-position", "earliest", "Where a new subscription starts: earliest or latest (an existing subscription keeps its cursor)")
+	catchUpAfter      = flag.Duration("catch-up-after", 0, "Catch-up mode: subscribe at latest, receive nothing for this long while the producer builds a backlog, then seek to earliest and drain it; the wait and the drain are recorded as regions catch-up-wait and catch-up-drain (0 = off; use a new -sub)")
+	catchUpBacklog    = flag.Int64("catch-up-backlog", 0, "Catch-up mode: seek to earliest once the subscription backlog (read via -admin-url every second) reaches this many messages; with -catch-up-after, whichever comes first (0 = off)")
+	topicStats        = flag.Bool("topic-stats", false, "Record broker-side topic stats (storage, backlog, entries) via -admin-url before and after consuming, into manifest.json")
+	recordTrace       = flag.String("record-trace", "", "Record each received message's time, size, key and topic to this trace file (.gz = compressed) for replay with the producer's -trace")
+	latencySource     = flag.String("latency-source", "publish", "Timestamp used for lag: publish (client publish time, producer clock), header (payload header time, NTP-corrected with the producer's -ntp-server), property (the producer's timestamp property, ns precision, producer clock) or broker (broker entry metadata publish time); also the start of the end-to-end latency in summary.latency and the per-sample latency_p*_ms")
+	ntpServer         = flag.String("ntp-server", "", "Estimate the local clock offset against this NTP server (host[:port]) and convert header/broker timestamps to the local clock; the offset is recorded in metadata")
+	recordTraceTime   = flag.String("record-trace-time", "publish", "Timestamp recorded by -record-trace: publish (broker arrival, keeps the original pattern when draining a backlog) or receive")
+	maxPendingChunks  = flag.Int("max-pending-chunks", 0, "MaxPendingChunkedMessage: chunked messages assembled at once before the oldest is dropped (0 = client default 100)")
+	chunkExpiry       = flag.Duration("chunk-expiry", 0, "ExpireTimeOfIncompleteChunk: drop a chunked message still incomplete after this long (0 = client default 1m)")
+	autoAckChunk      = flag.Bool("auto-ack-incomplete-chunk", false, "AutoAckIncompleteChunk: ack incomplete chunked messages dropped by -max-pending-chunks/-chunk-expiry instead of leaving them for redelivery")
+	keyStats          = flag.Bool("key-stats", false, "Track per-key arrival gaps and ordering (out-of-order deliveries per key and producer worker); meant for -sub-type=key_shared with a keyed producer, state grows with the key count")
+	producerURL       = flag.String("producer-url", "", "Producer diagnostics server (e.g. http://localhost:6070): stop once its exact sent count has been processed instead of after a 100ms receive timeout, and fail verification if fewer were processed")
+	untilSignal       = flag.Bool("until-signal", false, "Keep receiving through idle periods: only SIGINT/SIGTERM or -max-batches end the run, the remaining batch is then processed and acked (for runner-controlled consumers that join and leave a live subscription)")
+	fanout            = flag.Int("fanout", 1, "Consume N independent subscriptions <sub>-0..<sub>-(N-1) on the same topic in this process, with per-subscription heap estimates (1 = just -sub)")
+	clientPerConsumer = flag.Bool("client-per-consumer", false, "With -fanout, create a separate pulsar.Client (own connections and memory limit) for each subscription instead of sharing one")
+	samplesMode       = flag.String("samples", "full", "Per-second data kept in the stats JSON: full (raw samples + 1-minute rollups), rollup (rollups only) or none (summary only)")
+	rollupMessages    = flag.Int64("rollup-messages", 0, "Also summarize samples every N processed messages into msg_rollups of the stats JSON, indexed by cumulative messages instead of wall-clock so runs at different throughputs line up (0 = off; not with -samples=none)")
+	statsGzip         = flag.Bool("stats-gzip", false, "Write the stats file gzip-compressed as stats_<scenario>.json.gz")
+	statsFormat       = flag.String("stats-format", "json", "Format of the per-second samples: json (inside stats_<scenario>.json) or csv|parquet|influx (InfluxDB line protocol) written to samples_<scenario>.<ext>, the stats JSON then keeps summary and rollups; requires -samples=full for non-json")
+	subCycles         = flag.Int("sub-cycles", 0, "Repeat subscribe -> consume -> Unsubscribe -> Close N times, recording retained heap and goroutines after each cycle to catch subscription lifecycle leaks; each cycle re-reads from the earliest message (0 = off)")
+	subCycleInterval  = flag.Duration("sub-cycle-interval", 10*time.Second, "With -sub-cycles, consume at most this long per cycle before unsubscribing (0 = until drained or -max-batches)")
+	configFile        = flag.String("config", "", "Load flag defaults from a YAML scenario file (see runner init); explicit flags win, then -config, then -preset")
 )
 
-// BatchProcessor 模拟批量处理
+// BatchConfig 批处理行为配置
+type BatchConfig struct {
+	BatchSize      int64
+	ProcessDelay   *delayModel
+	ReleasePayload bool
+	RetainIDOnly   bool
+	AckRatio       float64 // 确认比例，1 表示全部确认
+	NackSkipped    bool    // 跳过的消息是否 Nack，否则保持未确认
+	Verify         bool    // 是否校验 payload CRC
+	Decode         payload.Encoding
+	CheckRelease   bool           // ReleasePayload 后再次访问 payload，检查 API 约定
+	TimeAcks       bool           // AckWithResponse 开启时记录每次 Ack 的往返耗时
+	Sink           *sinkWriter    // 非 nil 时处理后的批次写入下游，失败的批次整体 Nack
+	Exporter       *batchExporter // 非 nil 时每个批次序列化到磁盘
+	KeyStats       bool           // 记录每个 key 的到达间隔和顺序
+	FilterRatio    float64        // 收到后立即确认并丢弃的比例，不进入批次
+	AckDelay       time.Duration  // 批次处理完成后推迟确认的时长
+	AckJitter      time.Duration  // AckDelay 之外每个批次的随机推迟上限
+	AckBatchSize   int            // 确认批次攒到这么多条时发出，0 表示不按数量
+	AckFlushAfter  time.Duration  // 确认批次中最早的确认等待这么久时发出，0 表示不按时间
+	GCMode         string         // 批次处理完成后的 GC 动作，见 -gc-after-batch
+	GCEvery        int            // 每隔多少个批次执行一次 GCMode
+	StormInterval  time.Duration  // 非 0 时按此间隔把留下未确认的消息一起 Nack
+}
+
+// BatchProcessor 模拟批量处理: 攒批由 batch.Batch 完成 (与 pkg/workload 相同)，
+// 这里加上确认比例、下游写入、导出、推迟确认等命令行场景
 type BatchProcessor struct {
-	messages       []pulsar.Message
-	currentBytes   int64
-	batchSize      int64
-	batchCount     int
-	processDelay   time.Duration
-	consumer       pulsar.Consumer
-	monitor        *metrics.MemoryMonitor
-	releasePayload bool
+	BatchConfig
+	*batch.Batch
+	records      []payload.Record  // 解码结果，与消息一起保留到批次处理完成
+	out          []byte            // 发往下游的批次数据，写入成功前一直保留
+	rows         []exportRow       // 待导出的行
+	snapshots    []releaseSnapshot // 与 messages 一一对应，确认前再次检查已释放的消息
+	ackCredit    float64
+	filterCredit float64
+	consumer     pulsar.Consumer
+	monitor      *metrics.MemoryMonitor
+	acker        *delayedAcker // AckDelay/AckJitter 时推迟确认，否则为 nil
+	ackBatch     *ackBatcher   // AckBatchSize/AckFlushAfter 时攒批确认，否则为 nil
+	storm        *redeliveryStorm
+	route        string // -route-by 时所属队列的名称 (q0, q1 ...)，加在日志和 region 名前
+}
+
+func NewBatchProcessor(cfg BatchConfig, consumer pulsar.Consumer, monitor *metrics.MemoryMonitor) *BatchProcessor {
+	// 推迟确认、攒批确认和重投递风暴都经过包装后的 consumer，确认空洞检查不遗漏任何一条路径
+	if ackHoles != nil {
+		consumer = ackTrackingConsumer{Consumer: consumer, t: ackHoles}
+	}
+	bp := &BatchProcessor{
+		BatchConfig: cfg,
+		Batch: batch.New(batch.Config{
+			Size:           cfg.BatchSize,
+			ReleasePayload: cfg.ReleasePayload,
+			RetainIDOnly:   cfg.RetainIDOnly,
+			Verify:         cfg.Verify,
+		}, monitor),
+		consumer: consumer,
+		monitor:  monitor,
+	}
+	if cfg.AckDelay > 0 || cfg.AckJitter > 0 {
+		bp.acker = newDelayedAcker(consumer, monitor, cfg.AckDelay, cfg.AckJitter, cfg.TimeAcks)
+	}
+	if cfg.AckBatchSize > 0 || cfg.AckFlushAfter > 0 {
+		bp.ackBatch = newAckBatcher(consumer, monitor, cfg.AckBatchSize, cfg.AckFlushAfter, cfg.TimeAcks)
+	}
+	if cfg.StormInterval > 0 {
+		bp.storm = newRedeliveryStorm(consumer, monitor, cfg.StormInterval)
+	}
+	return bp
 }
 
-func NewBatchProcessor(batchSize int64, processDelay time.Duration, consumer pulsar.Consumer, monitor *metrics.MemoryMonitor, releasePayload bool) *BatchProcessor {
-	return &BatchProcessor{
-		messages:       make([]pulsar.Message, 0, 10000),
-		batchSize:      batchSize,
-		processDelay:   processDelay,
-		consumer:       consumer,
-		monitor:        monitor,
-		releasePayload: releasePayload,
+// finish 消费结束时调用，发出仍被推迟或攒批的确认并停止重投递风暴
+func (bp *BatchProcessor) finish() {
+	if bp.acker != nil {
+		bp.acker.flush()
+	}
+	if bp.ackBatch != nil {
+		bp.ackBatch.flush()
+	}
+	if bp.storm != nil {
+		bp.storm.close()
 	}
 }
 
+// Add 加入一条刚由 Receive 返回的消息，返回批次是否已满
 func (bp *BatchProcessor) Add(msg pulsar.Message) (shouldProcess bool) {
-	msgSize := int64(len(msg.Payload()))
+	return bp.AddReceived(msg, batch.HoldClock())
+}
+
+// AddReceived 与 Add 相同，received 为消息 Receive 返回时的 batch.HoldClock (-pipeline-depth 时消息先在 channel 中等待)
+func (bp *BatchProcessor) AddReceived(msg pulsar.Message, received time.Duration) (shouldProcess bool) {
+	if ackHoles != nil {
+		ackHoles.set(msg.ID(), indexReceived)
+	}
+	bp.monitor.RecordPhase(msg.Properties()[payload.PhaseProperty])
+	// ReleasePayload 会同时释放 properties，需在释放前估算线路大小
+	msgSize := bp.Inspect(msg)
 
 	// 模拟业务处理：读取 payload 数据
 	// 实际业务中这里会解析消息内容进行处理
-	_ = msg.Payload()
+	data := msg.Payload()
+	publishTime := latency.Time(msg, data)
+	if bp.KeyStats {
+		bp.recordKey(msg, data)
+	}
+	// 过滤掉的消息不校验、不解码
+	if bp.filtered() {
+		bp.drop(msg, msgSize, publishTime, received)
+		return false
+	}
+	// -hook-plugin 决定消息是否进入批次，在校验、解码和 ReleasePayload 之前
+	if msgHook != nil {
+		switch msgHook.apply(msg, data) {
+		case hook.Drop:
+			bp.drop(msg, msgSize, publishTime, received)
+			return false
+		case hook.Nack:
+			bp.monitor.RecordUnacked()
+			bp.consumer.Nack(msg)
+			return false
+		}
+	}
+	if !publishTime.IsZero() {
+		bp.monitor.RecordLatency(time.Since(publishTime))
+	}
+	bp.VerifyPayload(msg, data)
+	// 反序列化必须在 ReleasePayload 之前完成
+	if bp.Decode != payload.EncodingNone {
+		var rec payload.Record
+		if err := rec.Unmarshal(bp.Decode, payload.Body(data)); err != nil {
+			bp.monitor.RecordDecodeError()
+		} else {
+			bp.records = append(bp.records, rec)
+		}
+	}
+
+	if bp.Sink != nil {
+		bp.out = append(bp.out, data...)
+	}
+	if bp.Exporter != nil {
+		bp.rows = append(bp.rows, exportRow{
+			MessageID:   msg.ID().String(),
+			Key:         msg.Key(),
+			PublishTime: msg.PublishTime().UnixNano(),
+			Properties:  maps.Clone(msg.Properties()),
+			Payload:     bytes.Clone(data),
+		})
+	}
 
 	// 如果启用了 releasePayload，处理完后立即释放 payload 内存
 	// 只保留 MessageID 用于后续 ACK
-	if bp.releasePayload {
-		msg.ReleasePayload()
+	var snap releaseSnapshot
+	if bp.ReleasePayload && bp.CheckRelease {
+		snap = snapshotPayload(data)
+	}
+	if bp.Release(msg) && bp.CheckRelease {
+		bp.monitor.RecordReleaseCheck(snap.check(msg))
+		if !bp.RetainIDOnly {
+			bp.snapshots = append(bp.snapshots, snap)
+		}
+	}
+
+	// id 模式下只保留 MessageID，pulsar.Message 对象随即可被 GC 回收
+	// 用于区分 Message 包装对象本身（及其内部引用）占用的内存
+	return bp.Append(msg, msgSize, publishTime, received)
+}
+
+// shouldAck 按 AckRatio 决定当前消息是否确认，跳过的消息在批次内均匀分布
+func (bp *BatchProcessor) shouldAck() bool {
+	bp.ackCredit += bp.AckRatio
+	if bp.ackCredit >= 1 {
+		bp.ackCredit--
+		return true
+	}
+	return false
+}
+
+// recordAck TimeAcks 时记录一次 Ack 的往返耗时 (AckWithResponse 下 Ack 会等待 broker 响应)
+func (bp *BatchProcessor) recordAck(start time.Time, err error) {
+	if !bp.TimeAcks {
+		return
+	}
+	bp.monitor.RecordAck(time.Since(start), err)
+	if err != nil {
+		logging.Debugf("  Ack failed: %v", err)
 	}
+}
 
-	bp.messages = append(bp.messages, msg)
-	bp.currentBytes += msgSize
-	bp.monitor.RecordMessage(msgSize)
+// skip 记录一条故意不确认的消息，NackSkipped 时触发重投递
+func (bp *BatchProcessor) skip(id pulsar.MessageID) {
+	bp.monitor.RecordUnacked()
+	if bp.NackSkipped {
+		bp.consumer.NackID(id)
+		return
+	}
+	if ackHoles != nil {
+		ackHoles.set(id, indexSkipped)
+	}
+	if bp.storm != nil {
+		bp.storm.track(id)
+	}
+}
 
-	return bp.currentBytes >= bp.batchSize
+// nackAll 将当前批次全部 Nack
+func (bp *BatchProcessor) nackAll() {
+	for _, msg := range bp.Messages() {
+		bp.monitor.RecordUnacked()
+		bp.consumer.Nack(msg)
+	}
+	for _, e := range bp.IDs() {
+		bp.monitor.RecordUnacked()
+		bp.consumer.NackID(e.ID)
+	}
+}
+
+// reset 清空批次
+func (bp *BatchProcessor) reset() {
+	bp.Reset()
+	bp.snapshots = bp.snapshots[:0]
+	clear(bp.records)
+	bp.records = bp.records[:0]
+	bp.out = bp.out[:0]
+	clear(bp.rows)
+	bp.rows = bp.rows[:0]
 }
 
 func (bp *BatchProcessor) Process(ctx context.Context) error {
-	if len(bp.messages) == 0 {
+	if bp.Len() == 0 {
 		return nil
 	}
 
-	bp.batchCount++
-	log.Printf("Processing batch #%d: %d messages, %.2f MB",
-		bp.batchCount, len(bp.messages), float64(bp.currentBytes)/1024/1024)
+	n := bp.Begin()
+	defer pprof.SetGoroutineLabels(ctx)
+	app.Label(ctx, "process")
+	// 处理完成也算一次活动，避免 -process-delay 或下游重试期间被误判为卡住
+	defer activity.Touch()
+	name := fmt.Sprintf("batch-%d", n)
+	label := fmt.Sprintf("batch #%d", n)
+	if bp.route != "" {
+		name, label = bp.route+"-"+name, bp.route+" "+label
+	}
+	logging.Infof(metrics.Unitf("Processing %s: %d messages, %.2f MB"), label, bp.Len(), metrics.InUnit(bp.Bytes()))
 
-	// 记录处理前的内存状态
+	// 整个处理过程 (含处理后的 GC) 作为一个区域记录到 stats
+	region := bp.monitor.BeginRegion(name)
+	defer region.End()
+
+	// 记录处理前的内存状态，与处理后、GC 后一起按批次字节数计算各阶段的放大倍数
+	batchBytes := bp.Bytes()
 	beforeStats := bp.monitor.Collect()
-	log.Printf("  Before processing - HeapAlloc: %.2f MB, RSS: %.2f MB",
-		float64(beforeStats.HeapAlloc)/1024/1024, float64(beforeStats.RSS)/1024/1024)
+	bp.monitor.RecordBatchPhase(metrics.PhaseBuffered, batchBytes, beforeStats)
+	logging.Infof(metrics.Unitf("  Before processing - HeapAlloc: %.2f MB, RSS: %.2f MB"),
+		metrics.InUnit(beforeStats.HeapAlloc), metrics.InUnit(beforeStats.RSS))
 
 	// 模拟业务处理
-	if bp.processDelay > 0 {
-		time.Sleep(bp.processDelay)
+	if d, longest := bp.ProcessDelay.forBatch(bp.Len()); d > 0 {
+		if bp.ProcessDelay.perMessage() {
+			logging.Infof("  Processing %d messages took %v (longest message %v)", bp.Len(), d.Round(time.Millisecond), longest.Round(time.Microsecond))
+		}
+		time.Sleep(d)
 	}
 
-	// 逐个确认消息
-	for _, msg := range bp.messages {
-		bp.consumer.Ack(msg)
+	if bp.Exporter != nil {
+		n, err := bp.Exporter.Export(n, bp.rows)
+		if err != nil {
+			logging.Warnf("  Export failed: %v", err)
+		} else {
+			logging.Infof(metrics.Unitf("  Exported %d rows, %.2f MB %s"), len(bp.rows), metrics.InUnit(n), bp.Exporter.format)
+		}
 	}
 
-	bp.monitor.RecordBatch()
+	// 写入下游，重试耗尽仍失败则整批 Nack 等待重投递
+	if bp.Sink != nil {
+		if err := bp.Sink.Deliver(ctx, bp.out); err != nil {
+			logging.Warnf("  Sink write failed, nacking batch: %v", err)
+			bp.nackAll()
+			bp.reset()
+			return err
+		}
+	}
+
+	// 经过整个批次的处理后再访问一次已释放的消息
+	for i, snap := range bp.snapshots {
+		bp.monitor.RecordReleaseCheck(snap.check(bp.Messages()[i]))
+	}
+
+	// 逐个确认消息；推迟确认时只收集 MessageID 和接收时刻，交给 acker 到期后发出，
+	// 攒批确认时交给 ackBatch 按数量或时间发出。
+	// Messages 和 IDs 只有一个非空，Received 与其一一对应
+	received := bp.Received()
+	var deferred []pulsar.MessageID
+	var deferredAt []time.Duration
+	ackStart := time.Now()
+	acked := 0
+	for i, msg := range bp.Messages() {
+		if !bp.shouldAck() {
+			bp.skip(msg.ID())
+			continue
+		}
+		if bp.acker != nil {
+			deferred = append(deferred, msg.ID())
+			deferredAt = append(deferredAt, received[i])
+			continue
+		}
+		if bp.ackBatch != nil {
+			bp.ackBatch.add(msg.ID(), received[i])
+			continue
+		}
+		start := time.Now()
+		bp.recordAck(start, bp.consumer.Ack(msg))
+		bp.monitor.RecordHolding(batch.HoldClock() - received[i])
+		acked++
+	}
+	for i, e := range bp.IDs() {
+		if !bp.shouldAck() {
+			bp.skip(e.ID)
+			continue
+		}
+		if bp.acker != nil {
+			deferred = append(deferred, e.ID)
+			deferredAt = append(deferredAt, received[i])
+			continue
+		}
+		if bp.ackBatch != nil {
+			bp.ackBatch.add(e.ID, received[i])
+			continue
+		}
+		start := time.Now()
+		bp.recordAck(start, bp.consumer.AckID(e.ID))
+		bp.monitor.RecordHolding(batch.HoldClock() - received[i])
+		acked++
+	}
+	if bp.acker != nil {
+		bp.acker.add(deferred, deferredAt)
+	}
+	if bp.TimeAcks && acked > 0 {
+		d := time.Since(ackStart)
+		bp.monitor.RecordBatchAck(d)
+		logging.Infof("  Acked %d messages in %v (avg %v)", acked, d.Round(time.Microsecond), (d / time.Duration(acked)).Round(time.Microsecond))
+	}
 
-	// 清空批次
-	bp.messages = bp.messages[:0]
-	bp.currentBytes = 0
+	bp.monitor.RecordBatchPhase(metrics.PhaseProcessing, batchBytes, bp.monitor.Point())
+	bp.Done()
+	bp.reset()
+	if profiler != nil {
+		profiler.RecordBatch()
+	}
 
-	// 处理完成后强制 GC，观察内存释放情况
-	runtime.GC()
+	// 处理完成后按 -gc-after-batch 主动 GC，观察内存释放情况
+	step := "processing"
+	if bp.collect() {
+		step = "processing+" + bp.GCMode
+	}
 
 	afterStats := bp.monitor.Collect()
-	log.Printf("  After processing+GC - HeapAlloc: %.2f MB, RSS: %.2f MB",
-		float64(afterStats.HeapAlloc)/1024/1024, float64(afterStats.RSS)/1024/1024)
+	bp.monitor.RecordBatchPhase(metrics.PhasePostAck, batchBytes, afterStats)
+	logging.Infof(metrics.Unitf("  After %s - HeapAlloc: %.2f MB, RSS: %.2f MB (%s)"), step,
+		metrics.InUnit(afterStats.HeapAlloc), metrics.InUnit(afterStats.RSS),
+		metrics.Diff(beforeStats, afterStats))
 
+	if expiry != nil {
+		expiry.afterBatch(ctx)
+	}
 	return nil
 }
 
 const logPrefix = "[CONSUMER] "
 
+// ballast 堆 ballast，包级变量保证其在整个运行期间可达
+var ballast []byte
+
+// topRetainers 写入 stats 的 top retainer 调用栈数
+const topRetainers = 20
+
+// lagWindow 估算追赶速度所用的采样窗口
+const lagWindow = 10 * time.Second
+
+// parseKeyValues 解析 "k1=v1,k2=v2" 格式的参数
+func parseKeyValues(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	result := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// parseSubscriptionMode 解析 -subscription-mode 参数
+func parseSubscriptionMode(s string) (pulsar.SubscriptionMode, error) {
+	switch s {
+	case "durable":
+		return pulsar.Durable, nil
+	case "non_durable":
+		return pulsar.NonDurable, nil
+	default:
+		return pulsar.Durable, fmt.Errorf("unknown subscription mode %q", s)
+	}
+}
+
 func main() {
 	flag.Parse()
 
+	// 需要在启动其它 goroutine 之前完成，可能 exec 自身
+	if *gcTraceFlag {
+		var err error
+		if gcTrace, err = startGCTrace(); err != nil {
+			log.Fatalf("Failed to enable -gctrace: %v", err)
+		}
+	}
+
 	// 设置日志前缀
 	log.SetPrefix(logPrefix)
 
+	// 内置场景，命令行显式指定的参数优先
+	if listed, err := app.LoadFlags("consumer", *preset, *configFile); err != nil {
+		log.Fatalf("%v", err)
+	} else if listed {
+		return
+	}
+
+	if *scenario == "" {
+		*scenario = consumerScenario()
+	}
+	a, err := app.New(app.Options{
+		Program:       "consumer",
+		LogLevel:      *logLevel,
+		LogFile:       *logFile,
+		LogMaxSize:    *logMaxSize,
+		LogMaxBackups: *logMaxBackups,
+		Layout:        *layoutMode,
+		OutputDir:     *outputDir,
+		Scenario:      *scenario,
+		RunID:         *runID,
+		Force:         *force,
+		ArtifactURL:   *artifactURL,
+		Labels:        *labels,
+		TrackPIDs:     *trackPIDs,
+		SizeUnit:      *sizeUnit,
+		PushGateway:   *pushGateway,
+		PushInterval:  *pushInterval,
+		StatsDAddr:    *statsdAddr,
+		StatsDPrefix:  *statsdPrefix,
+		TSDB:          *tsdbKind,
+		TSDBURL:       *tsdbURL,
+		TSDBToken:     *tsdbToken,
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer a.Close()
+	defer a.Recover()
+	layout := a.Layout
+	clientMetrics := a.ClientMetrics
+	// CPU/goroutine profile 按角色分组，见 app.Label
+	mainCtx := app.Label(a.ProfileContext(), "main")
+
+	if *retainMode != "message" && *retainMode != "id" {
+		log.Fatalf("Invalid -retain value %q: must be message or id", *retainMode)
+	}
+	if *stormInterval < 0 {
+		log.Fatalf("Invalid -redelivery-storm %v: must be >= 0", *stormInterval)
+	}
+	if *stormInterval > 0 && (*ackRatio >= 1 || *skipAction != "leave") {
+		log.Fatalf("-redelivery-storm needs messages left unacked: use -ack-ratio < 1 with -skip-action=leave")
+	}
+	if *receiveMode != receiveModeTimeout && *receiveMode != receiveModeChan {
+		log.Fatalf("Invalid -receive-mode %q: must be timeout or chan", *receiveMode)
+	}
+	if *ttlLag < 0 {
+		log.Fatalf("Invalid -ttl-lag %v: must be >= 0", *ttlLag)
+	}
+	if err := validateBatchGC(*gcAfterBatch, *gcEvery); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if procDelay, err = parseProcessDelay(*processDelayDist, *processDelay); err != nil {
+		log.Fatalf("Invalid -process-delay-dist: %v", err)
+	}
+	if *ackDelay < 0 || *ackJitter < 0 {
+		log.Fatalf("-ack-delay and -ack-jitter must be >= 0")
+	}
+	if *ackBatchSize < 0 || *ackBatchInterval < 0 {
+		log.Fatalf("-ack-batch-size and -ack-batch-interval must be >= 0")
+	}
+	if (*ackBatchSize > 0 || *ackBatchInterval > 0) && (*ackDelay > 0 || *ackJitter > 0) {
+		log.Fatalf("-ack-batch-size/-ack-batch-interval cannot be combined with -ack-delay/-ack-jitter")
+	}
+	if *filterRatio < 0 || *filterRatio > 1 {
+		log.Fatalf("Invalid -filter-ratio %v: must be within [0, 1]", *filterRatio)
+	}
+	if *ackRatio < 0 || *ackRatio > 1 {
+		log.Fatalf("Invalid -ack-ratio %v: must be within [0, 1]", *ackRatio)
+	}
+	if *skipAction != "leave" && *skipAction != "nack" {
+		log.Fatalf("Invalid -skip-action value %q: must be leave or nack", *skipAction)
+	}
+	subscriptionType, err := workload.ParseSubscriptionType(*subType)
+	if err != nil {
+		log.Fatalf("Invalid -sub-type: %v", err)
+	}
+	subscriptionMode, err := parseSubscriptionMode(*subMode)
+	if err != nil {
+		log.Fatalf("Invalid -subscription-mode: %v", err)
+	}
+	initialPos, err := parseInitialPosition(*initialPosition)
+	if err != nil {
+		log.Fatalf("Invalid -initial-position: %v", err)
+	}
+	if _, err := metrics.ParseSampleMode(*samplesMode); err != nil {
+		log.Fatalf("Invalid -samples: %v", err)
+	}
+	if _, err := metrics.NewEncoder(*statsFormat); err != nil {
+		log.Fatalf("Invalid -stats-format: %v", err)
+	}
+	if *rollupMessages < 0 {
+		log.Fatalf("-rollup-messages must be >= 0")
+	}
+	if *rollupMessages > 0 && *samplesMode == string(metrics.SamplesNone) {
+		log.Fatalf("-rollup-messages needs the samples and cannot be combined with -samples=none")
+	}
+	if *statsFormat != "json" && *samplesMode != string(metrics.SamplesFull) {
+		log.Fatalf("-stats-format=%s writes the raw samples and requires -samples=full", *statsFormat)
+	}
+	if *statsFormat == "parquet" && *statsGzip {
+		log.Fatalf("-stats-gzip cannot be combined with -stats-format=parquet (parquet pages are compressed already)")
+	}
+	queueSource, err := metrics.ParseQueueSource(*queueEstimate)
+	if err != nil {
+		log.Fatalf("Invalid -queue-estimate: %v", err)
+	}
+	if queueSource == metrics.QueueBroker && (*topicsPattern != "" || *abRelease) {
+		log.Fatalf("-queue-estimate=broker requires -topic and cannot be combined with -ab-release-payload")
+	}
+	subscriptionProperties, err := parseKeyValues(*subProperties)
+	if err != nil {
+		log.Fatalf("Invalid -sub-properties: %v", err)
+	}
+	decodeEncoding, err := payload.ParseEncoding(*decodeMode)
+	if err != nil {
+		log.Fatalf("Invalid -decode: %v", err)
+	}
+	progressFmt, err := progress.ParseFormat(*progressFormat)
+	if err != nil {
+		log.Fatalf("Invalid -progress-format: %v", err)
+	}
+	if *progressInterval <= 0 {
+		log.Fatalf("Invalid -progress-interval %v: must be positive", *progressInterval)
+	}
+	if *checkRelease && !*releasePayload && !*abRelease {
+		log.Fatalf("-check-release requires -release-payload or -ab-release-payload")
+	}
+	if *profileEvery < 0 || *profileInterval < 0 {
+		log.Fatalf("-profile-every and -profile-interval must be >= 0")
+	}
+	if *abRelease && (*profileEvery > 0 || *profileInterval > 0) {
+		log.Fatalf("-profile-every/-profile-interval cannot be combined with -ab-release-payload")
+	}
+	if *abRelease && *topicsPattern != "" {
+		log.Fatalf("-ab-release-payload requires -topic: pattern subscriptions cannot seek")
+	}
+	if *topicStats && *topicsPattern != "" {
+		log.Fatalf("-topic-stats requires -topic: pattern subscriptions have no single topic")
+	}
+	if *maxPendingChunks < 0 || *chunkExpiry < 0 {
+		log.Fatalf("-max-pending-chunks and -chunk-expiry must be >= 0")
+	}
+	if *fanout < 1 {
+		log.Fatalf("Invalid -fanout %d: must be >= 1", *fanout)
+	}
+	if *fanout > 1 && (*abRelease || *pipelineDepth > 0 || *sinkKind != "" || *exportFormat != "" || *recordTrace != "") {
+		log.Fatalf("-fanout cannot be combined with -ab-release-payload, -pipeline-depth, -sink, -export or -record-trace")
+	}
+	if *producerURL != "" && (*fanout > 1 || *abRelease || *topicsPattern != "") {
+		log.Fatalf("-producer-url requires -topic and cannot be combined with -fanout or -ab-release-payload")
+	}
+	if *untilSignal && (*fanout > 1 || *abRelease || *subCycles > 0 || *producerURL != "") {
+		log.Fatalf("-until-signal cannot be combined with -fanout, -ab-release-payload, -sub-cycles or -producer-url")
+	}
+	if *keyStats && (*fanout > 1 || *abRelease) {
+		log.Fatalf("-key-stats cannot be combined with -fanout or -ab-release-payload: the same keys would be delivered more than once")
+	}
+	if *subCycles < 0 {
+		log.Fatalf("Invalid -sub-cycles %d: must be >= 0", *subCycles)
+	}
+	if *subCycles > 0 && (*fanout > 1 || *abRelease || *producerURL != "" || *seekBack > 0 || *keyStats) {
+		log.Fatalf("-sub-cycles cannot be combined with -fanout, -ab-release-payload, -producer-url, -seek-back or -key-stats: each cycle unsubscribes and re-reads the topic")
+	}
+	if *clientPerConsumer && *fanout <= 1 {
+		log.Fatalf("-client-per-consumer requires -fanout > 1")
+	}
+	if *seekBack > 0 && *topicsPattern != "" {
+		log.Fatalf("-seek-back requires -topic: pattern subscriptions cannot seek")
+	}
+	var routeProperty string
+	var routeSizes []int64
+	if *routeBy != "" {
+		if routeProperty, err = parseRouteBy(*routeBy); err != nil {
+			log.Fatalf("Invalid -route-by: %v", err)
+		}
+		if *routeQueues < 1 {
+			log.Fatalf("Invalid -route-queues %d: must be >= 1", *routeQueues)
+		}
+		if *fanout > 1 || *abRelease || *subCycles > 0 || *pipelineDepth > 0 || *stormInterval > 0 {
+			log.Fatalf("-route-by cannot be combined with -fanout, -ab-release-payload, -sub-cycles, -pipeline-depth or -redelivery-storm")
+		}
+		if routeSizes, err = parseRouteBatchSizes(*routeBatchSizes, *routeQueues, *batchSize); err != nil {
+			log.Fatalf("Invalid -route-batch-sizes: %v", err)
+		}
+	}
+	if *catchUpAfter < 0 || *catchUpBacklog < 0 {
+		log.Fatalf("-catch-up-after and -catch-up-backlog must be >= 0")
+	}
+	if catchUpEnabled() && (*abRelease || *subCycles > 0 || *seekBack > 0 || *topicsPattern != "" || *backend != backendPulsar) {
+		log.Fatalf("-catch-up-after/-catch-up-backlog need -topic with the pulsar backend and cannot be combined with -ab-release-payload, -sub-cycles or -seek-back")
+	}
+	if catchUpEnabled() {
+		// 追赶模式总是在 Latest 订阅，积压从订阅之后开始形成
+		initialPos = pulsar.SubscriptionPositionLatest
+	}
+	loopback := *backend == backendLoopback
+	if !loopback && *backend != backendPulsar {
+		log.Fatalf("Invalid -backend %q: must be pulsar or loopback", *backend)
+	}
+	if loopback && (*fanout > 1 || *abRelease || *subCycles > 0 || *seekBack > 0 || *producerURL != "" || *topicsPattern != "" || *topicStats || *stormInterval > 0 || queueSource == metrics.QueueBroker) {
+		log.Fatalf("-backend=loopback cannot be combined with -fanout, -ab-release-payload, -sub-cycles, -seek-back, -producer-url, -topics-pattern, -topic-stats, -redelivery-storm or -queue-estimate=broker: they need a broker")
+	}
+	if *ttlLag > 0 && (loopback || *fanout > 1 || *abRelease || *subCycles > 0 || *topicsPattern != "") {
+		log.Fatalf("-ttl-lag needs a single subscription on -topic with the pulsar backend: it cannot be combined with -fanout, -ab-release-payload, -sub-cycles or -topics-pattern")
+	}
+	if *ttlLag > 0 && *stallTimeout > 0 && *stallTimeout <= *ttlLag {
+		log.Fatalf("-stall-timeout must exceed -ttl-lag: the consumer receives nothing during the lag")
+	}
+	if loopback && (*loopbackTotal <= 0 || *loopbackSize <= 0) {
+		log.Fatalf("-loopback-total and -loopback-size must be positive")
+	}
+	// broker 只允许 Exclusive/Failover 订阅读取压缩视图
+	if *readCompacted && subscriptionType != pulsar.Exclusive && subscriptionType != pulsar.Failover {
+		log.Fatalf("-read-compacted requires -sub-type=exclusive or failover, got %s", *subType)
+	}
+
 	// 设置 GOGC
 	oldGC := debug.SetGCPercent(*gcPercent)
 	log.Printf("GOGC: %d -> %d", oldGC, *gcPercent)
 
-	// 启动 pprof 服务
-	go func() {
-		addr := fmt.Sprintf("localhost:%d", *pprofPort)
-		log.Printf("Starting pprof server at http://%s/debug/pprof/", addr)
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Printf("pprof server error: %v", err)
+	// 堆 ballast: 从未写入的大块内存只占虚拟地址，却计入 GC 的存活堆，
+	// 从而抬高 heap goal、降低 GC 频率；与 GOGC/GOMEMLIMIT 调优对比用
+	if *ballastMB > 0 {
+		ballast = make([]byte, *ballastMB<<20)
+		log.Printf("Heap ballast: %d MB", *ballastMB)
+	}
+
+	// CPU 绑定和 GOMAXPROCS，使不同规格机器上的结果可比，或模拟容器 CPU 限制
+	// runtime 只在启动时根据亲和性掩码确定 GOMAXPROCS，绑定后需显式设置
+	procs := *gomaxprocs
+	if *cpuAffinity != "" {
+		cpus, err := parseCPUList(*cpuAffinity)
+		if err != nil {
+			log.Fatalf("Invalid -cpu-affinity: %v", err)
+		}
+		if err := setCPUAffinity(cpus); err != nil {
+			log.Fatalf("Failed to set CPU affinity: %v", err)
+		}
+		log.Printf("CPU affinity: %v", cpus)
+		if procs == 0 {
+			procs = len(cpus)
 		}
-	}()
+	}
+	if procs > 0 {
+		old := runtime.GOMAXPROCS(procs)
+		log.Printf("GOMAXPROCS: %d -> %d", old, procs)
+	}
 
-	// 创建输出目录
-	if err := os.MkdirAll(*outputDir, 0755); err != nil {
-		log.Fatalf("Failed to create output directory: %v", err)
+	// 已保存 profile 的内嵌 pprof UI
+	profiles := profview.New(layout.Dir, "/debug/profiles/")
+	a.Handle(profiles.Prefix(), "saved profiles", profiles)
+
+	// 存活检测: /healthz 报告最后一次收到消息的时间，-stall-timeout 时检测卡住
+	activity = newStallWatchdog(a)
+	// 精确的已处理计数，producer -lead-messages/-lead-mb 据此控制领先量
+	endpoint := control.NewEndpoint("consumer")
+	a.Handle(control.Path, "processed counters", endpoint)
+	a.ServeDiagnostics(fmt.Sprintf("%s:%d", *pprofHost, *pprofPort))
+	if *metricsPort != 0 {
+		a.ServeMetrics(fmt.Sprintf(":%d", *metricsPort))
 	}
 
 	log.Println("========== Consumer Config ==========")
-	log.Printf("  URL: %s", *pulsarURL)
-	log.Printf("  Topic: %s", *topic)
-	log.Printf("  Subscription: %s", *subscription)
-	log.Printf("  Batch size: %.2f MB", float64(*batchSize)/1024/1024)
-	log.Printf("  ReceiverQueueSize: %d", *receiverQueueSize)
+	if loopback {
+		log.Printf(metrics.Unitf("  Backend: loopback (%.2f MB of %d-byte messages, no Pulsar client)"), metrics.InUnit(*loopbackTotal), *loopbackSize)
+	} else {
+		log.Printf("  URL: %s", *pulsarURL)
+	}
+	if *listenerName != "" {
+		log.Printf("  Listener: %s", *listenerName)
+	}
+	if *topicsPattern != "" {
+		log.Printf("  Topics pattern: %s (discovery every %v)", *topicsPattern, *discoveryPeriod)
+	} else {
+		log.Printf("  Topic: %s (partition discovery every %v)", *topic, *discoveryPeriod)
+	}
+	log.Printf("  Subscription: %s (%s, %s)", *subscription, *subType, *subMode)
+	if *producerURL != "" {
+		log.Printf("  Completion: processed count reaches the sent count of %s", *producerURL)
+	}
+	if *untilSignal {
+		log.Printf("  Completion: on SIGINT/SIGTERM only (-until-signal)")
+	}
+	if *fanout > 1 {
+		log.Printf("  Fan-out: %d subscriptions (%s), client per consumer: %v",
+			*fanout, strings.Join(subscriptionNames(), ", "), *clientPerConsumer)
+	}
+	if *keyStats {
+		log.Printf("  Key stats: per-key gaps and ordering")
+	}
+	log.Printf("  Read compacted: %v", *readCompacted)
+	log.Printf("  Replicate subscription state: %v", *replicateSubState)
+	log.Printf("  Consumer name: %q, priority: %d (-1=unset)", *consumerName, *priorityLevel)
+	if len(subscriptionProperties) > 0 {
+		log.Printf("  Subscription properties: %v", subscriptionProperties)
+	}
+	log.Printf(metrics.Unitf("  Batch size: %.2f MB"), metrics.InUnit(*batchSize))
+	if *hookPlugin != "" {
+		log.Printf("  Hook plugin: %s (config %q)", *hookPlugin, *hookConfig)
+	}
+	if *routeBy != "" {
+		log.Printf("  Routing: by %s into %d queues (batch sizes: %q, empty = batch size)", *routeBy, *routeQueues, *routeBatchSizes)
+	}
+	log.Printf("  ReceiverQueueSize: %d (occupancy estimated from %s)", *receiverQueueSize, queueSource)
+	if *maxPendingChunks > 0 || *chunkExpiry > 0 || *autoAckChunk {
+		log.Printf("  Chunks: max pending %d, expiry %v (0=client default), auto-ack incomplete: %v", *maxPendingChunks, *chunkExpiry, *autoAckChunk)
+	}
 	log.Printf("  Memory limit: %d bytes", *memoryLimit)
-	log.Printf("  GOGC: %d", *gcPercent)
+	log.Printf("  Connections per broker: %d (0=default 1), max idle: %v (0=default)", *maxConns, *connMaxIdle)
+	log.Printf("  Operation timeout: %v, connection timeout: %v, keep-alive: %v (0=default)", *opTimeout, *connTimeout, *keepAlive)
+	log.Printf("  Max reconnect: %d (-1=unlimited), initial backoff: %v", *maxReconnect, *backoffStart)
+	log.Printf("  GOGC: %d, heap ballast: %d MB", *gcPercent, *ballastMB)
+	log.Printf("  GOMAXPROCS: %d (0=default), CPU affinity: %q", *gomaxprocs, *cpuAffinity)
 	log.Printf("  Max batches: %d (0=unlimited)", *maxBatches)
+	log.Printf("  Seek back: %v (0=none)", *seekBack)
+	if catchUpEnabled() {
+		log.Printf("  Initial position: latest, catch-up to earliest after %v / at backlog %d (0=unused)", *catchUpAfter, *catchUpBacklog)
+	} else {
+		log.Printf("  Initial position: %s", *initialPosition)
+	}
+	if *subCycles > 0 {
+		log.Printf("  Subscription cycles: %d, up to %v each", *subCycles, *subCycleInterval)
+	}
 	log.Printf("  Scenario: %s", *scenario)
-	log.Printf("  Release payload: %v", *releasePayload)
+	log.Printf("  Results: %s", layout.Dir)
+	if *abRelease {
+		log.Printf("  Release payload: A/B (off, then on)")
+	} else {
+		log.Printf("  Release payload: %v", *releasePayload)
+	}
+	log.Printf("  Retain: %s", *retainMode)
+	log.Printf("  Check release: %v", *checkRelease)
+	log.Printf("  Check ack holes: %v", *checkAckHoles)
+	log.Printf("  gctrace: %v", *gcTraceFlag)
+	if *profileEvery > 0 || *profileInterval > 0 {
+		log.Printf("  Profile snapshots: every %d batches, every %v (0 = off)", *profileEvery, *profileInterval)
+	}
+	log.Printf("  Verify payload: %v", *verifyPayload)
+	log.Printf("  Decode: %s", decodeEncoding)
+	if *ntpServer != "" {
+		log.Printf("  Latency source: %s (NTP %s)", *latencySource, *ntpServer)
+	} else {
+		log.Printf("  Latency source: %s", *latencySource)
+	}
+	if *recordTrace != "" {
+		log.Printf("  Record trace: %s (%s time)", *recordTrace, *recordTraceTime)
+	}
+	log.Printf("  Pipeline depth: %d", *pipelineDepth)
+	log.Printf("  Progress: %s every %v", progressFmt, *progressInterval)
+	if *exportFormat != "" {
+		log.Printf("  Export: %s", *exportFormat)
+	}
+	if *sinkKind != "" {
+		log.Printf("  Sink: %s (latency %v, failure rate %.2f, retries %d)",
+			*sinkKind, *sinkLatency, *sinkFailureRate, *sinkRetries)
+	}
+	log.Printf("  Ack ratio: %.2f (skip action: %s, nack delay: %v)", *ackRatio, *skipAction, *nackDelay)
+	if *stormInterval > 0 {
+		log.Printf("  Redelivery storm: nack all unacked messages every %v", *stormInterval)
+	}
+	if *receiveMode != receiveModeTimeout {
+		log.Printf("  Receive mode: %s", *receiveMode)
+	}
+	if *ttlLag > 0 {
+		log.Printf("  TTL expiry: lag %v after the first batch, then expire the subscription", *ttlLag)
+	}
+	if *gcAfterBatch != batchGCForce || *gcEvery > 1 {
+		log.Printf("  GC after batch: %s every %d batches", *gcAfterBatch, *gcEvery)
+	}
+	if *processDelay > 0 {
+		log.Printf("  Process delay: %s", procDelay)
+	}
+	if *ackDelay > 0 || *ackJitter > 0 {
+		log.Printf("  Ack delay: %v + jitter [0, %v) per batch", *ackDelay, *ackJitter)
+	}
+	if *ackBatchSize > 0 || *ackBatchInterval > 0 {
+		log.Printf("  Ack batching: every %d acks or %v after the oldest (0 = off), independent of -batch-size", *ackBatchSize, *ackBatchInterval)
+	}
+	if *filterRatio > 0 {
+		log.Printf("  Filter ratio: %.2f (acked and dropped on receipt)", *filterRatio)
+	}
+	log.Printf("  Ack with response: %v", *ackWithResponse)
 	log.Println("======================================")
 
-	// 创建内存监控器
-	monitor, err := metrics.NewMemoryMonitor()
+	if *precheckFlag {
+		a.Precheck(mainCtx, consumerPrecheck(loopback, routeSizes))
+	}
+
+	// 插件在订阅之前加载，加载失败时不必等到消费开始
+	var hooked *messageHook
+	if *hookPlugin != "" {
+		if hooked, err = newMessageHook(*hookPlugin, *hookConfig); err != nil {
+			a.Exit(results.StatusError, "failed to load -hook-plugin: %v", err)
+		}
+		log.Printf("Loaded hook plugin %s", *hookPlugin)
+	}
+
+	// 创建内存监控器，运行配置写入 metadata 便于对比不同运行
+	monitor, err := a.NewMonitor()
 	if err != nil {
-		log.Fatalf("Failed to create memory monitor: %v", err)
+		a.Exit(results.StatusError, "%v", err)
+	}
+	monitor.SetReceiverQueueSize(*receiverQueueSize)
+	monitor.SetQueueSource(queueSource)
+	monitor.SetMessageRollup(*rollupMessages)
+	if !loopback {
+		monitor.SetClientMemoryLimit(max(*memoryLimit, 0)) // 只有正数传给客户端，其余按默认值
 	}
+	if *keyStats {
+		monitor.EnableKeyStats()
+	}
+	monitor.SetMetadata("pulsar_client_version", pulsarClientVersion())
+	monitor.SetMetadata("ballast_bytes", strconv.Itoa(len(ballast)))
+	var consumeDone atomic.Bool
+	endpoint.SetSource(func() (int64, int64, bool) {
+		count, size, _ := monitor.GetCurrentStats()
+		return count, size, consumeDone.Load()
+	})
 
 	// 开始内存采集 (每秒一次)
-	monitor.Start(time.Second)
+	monitor.EnableLatency()
+	monitor.Start(context.Background(), time.Second)
+
+	if *profileEvery > 0 || *profileInterval > 0 {
+		profiler = startProfiler(mainCtx, layout, *profileEvery, *profileInterval)
+	}
 
 	// 记录初始内存状态
 	initialStats := monitor.Collect()
-	log.Printf("Initial memory - HeapAlloc: %.2f MB, RSS: %.2f MB",
-		float64(initialStats.HeapAlloc)/1024/1024, float64(initialStats.RSS)/1024/1024)
+	log.Printf(metrics.Unitf("Initial memory - HeapAlloc: %.2f MB, RSS: %.2f MB"),
+		metrics.InUnit(initialStats.HeapAlloc), metrics.InUnit(initialStats.RSS))
 
 	// 创建 Pulsar 客户端
 	clientOptions := pulsar.ClientOptions{
 		URL:               *pulsarURL,
-		OperationTimeout:  30 * time.Second,
-		ConnectionTimeout: 30 * time.Second,
+		ListenerName:      *listenerName,
+		OperationTimeout:  *opTimeout,
+		ConnectionTimeout: *connTimeout,
+		KeepAliveInterval: *keepAlive,
+		MetricsRegisterer: clientMetrics.Registerer(),
+
+		MaxConnectionsPerBroker: *maxConns,
+		ConnectionMaxIdleTime:   *connMaxIdle,
 	}
 	if *memoryLimit > 0 {
 		clientOptions.MemoryLimitBytes = *memoryLimit
 	}
 
-	client, err := pulsar.NewClient(clientOptions)
-	if err != nil {
-		log.Fatalf("Failed to create Pulsar client: %v", err)
-	}
-	defer client.Close()
+	// 客户端内部的 goroutine 在创建客户端和订阅时启动，继承 client 标签
+	app.Label(mainCtx, "client")
+	// loopback 后端不创建客户端，客户端创建后的内存即初始内存
+	var client pulsar.Client
+	postClientStats := initialStats
+	if !loopback {
+		client, err = pulsar.NewClient(clientOptions)
+		if err != nil {
+			a.Exit(results.StatusBrokerError, "failed to create Pulsar client: %v", err)
+		}
+		defer client.Close()
 
-	// 记录客户端创建后的内存
-	postClientStats := monitor.Collect()
-	log.Printf("After client creation - HeapAlloc: %.2f MB, RSS: %.2f MB (delta: +%.2f MB)",
-		float64(postClientStats.HeapAlloc)/1024/1024,
-		float64(postClientStats.RSS)/1024/1024,
-		float64(postClientStats.HeapAlloc-initialStats.HeapAlloc)/1024/1024)
+		// 记录客户端创建后的内存
+		postClientStats = monitor.Collect()
+		log.Printf(metrics.Unitf("After client creation - HeapAlloc: %.2f MB, RSS: %.2f MB (%s)"),
+			metrics.InUnit(postClientStats.HeapAlloc),
+			metrics.InUnit(postClientStats.RSS),
+			metrics.Diff(initialStats, postClientStats))
+	}
 
 	// 创建消费者
-	consumer, err := client.Subscribe(pulsar.ConsumerOptions{
-		Topic:                       *topic,
-		SubscriptionName:            *subscription,
-		Type:                        pulsar.Shared,
-		SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
-		ReceiverQueueSize:           *receiverQueueSize,
+	// 注意：当前 pulsar-client-go 版本没有 AckTimeout，未确认的消息只能通过 Nack
+	// 或重连/重新订阅才会被重投递
+	consumerOptions := pulsar.ConsumerOptions{
+		SubscriptionName:               *subscription,
+		Type:                           subscriptionType,
+		SubscriptionInitialPosition:    initialPos,
+		ReceiverQueueSize:              *receiverQueueSize,
 		EnableBatchIndexAcknowledgment: true,
-	})
-	if err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
+		NackRedeliveryDelay:            *nackDelay,
+		ReadCompacted:                  *readCompacted,
+		SubscriptionMode:               subscriptionMode,
+		ReplicateSubscriptionState:     *replicateSubState,
+		Name:                           *consumerName,
+		SubscriptionProperties:         subscriptionProperties,
+		AckWithResponse:                *ackWithResponse,
+		MaxPendingChunkedMessage:       *maxPendingChunks,
+		ExpireTimeOfIncompleteChunk:    *chunkExpiry,
+		AutoAckIncompleteChunk:         *autoAckChunk,
+	}
+	if *maxReconnect >= 0 {
+		n := uint(*maxReconnect)
+		consumerOptions.MaxReconnectToBroker = &n
+	}
+	if *backoffStart > 0 {
+		consumerOptions.BackOffPolicyFunc = func() backoff.Policy {
+			return backoff.NewDefaultBackoffWithInitialBackOff(*backoffStart)
+		}
+	}
+	if *priorityLevel >= 0 {
+		level := int32(*priorityLevel)
+		consumerOptions.PriorityLevel = &level
 	}
-	defer consumer.Close()
+	if *topicsPattern != "" {
+		consumerOptions.TopicsPattern = *topicsPattern
+	} else {
+		consumerOptions.Topic = *topic
+	}
+	consumerOptions.AutoDiscoveryPeriod = *discoveryPeriod
+	// -fanout 时每个订阅一个消费者，consumers[0] 用于单订阅的代码路径；
+	// -client-per-consumer 时除第一个外每个消费者使用新建的客户端
+	names := subscriptionNames()
+	consumers := make([]pulsar.Consumer, 0, len(names))
+	clients := 1
+	if loopback {
+		lb := newLoopbackConsumer(*topic, names[0], *receiverQueueSize, *loopbackTotal, *loopbackSize)
+		defer lb.Close()
+		consumers = append(consumers, lb)
+		clients = 0
+	} else {
+		for i, name := range names {
+			owner := client
+			if *clientPerConsumer && i > 0 {
+				if owner, err = pulsar.NewClient(clientOptions); err != nil {
+					a.Exit(results.StatusBrokerError, "failed to create Pulsar client for %s: %v", name, err)
+				}
+				defer owner.Close()
+				clients++
+			}
+			opts := consumerOptions
+			opts.SubscriptionName = name
+			c, err := owner.Subscribe(opts)
+			if err != nil {
+				a.Exit(results.StatusBrokerError, "failed to subscribe %s: %v", name, err)
+			}
+			defer c.Close()
+			consumers = append(consumers, c)
+		}
+	}
+	consumer := consumers[0]
+	pprof.SetGoroutineLabels(mainCtx)
+
+	// 回退到指定时间点重新消费，模拟值班时从积压中追赶
+	if *seekBack > 0 {
+		seekTime := time.Now().Add(-*seekBack)
+		for i, c := range consumers {
+			if err := c.SeekByTime(seekTime); err != nil {
+				a.Exit(results.StatusBrokerError, "failed to seek %s to %v: %v", names[i], seekTime, err)
+			}
+		}
+		monitor.SetMetadata("seek_time", seekTime.Format(time.RFC3339))
+		log.Printf("Seeked %d subscription(s) to %v (%v ago)", len(consumers), seekTime.Format(time.RFC3339), *seekBack)
+	}
+	before := snapshotTopic(layout, "consumer_before", *topic)
 
 	// 记录消费者创建后的内存
 	postConsumerStats := monitor.Collect()
-	log.Printf("After consumer creation - HeapAlloc: %.2f MB, RSS: %.2f MB (delta: +%.2f MB)",
-		float64(postConsumerStats.HeapAlloc)/1024/1024,
-		float64(postConsumerStats.RSS)/1024/1024,
-		float64(postConsumerStats.HeapAlloc-postClientStats.HeapAlloc)/1024/1024)
+	log.Printf(metrics.Unitf("After consumer creation - HeapAlloc: %.2f MB, RSS: %.2f MB (%s)"),
+		metrics.InUnit(postConsumerStats.HeapAlloc),
+		metrics.InUnit(postConsumerStats.RSS),
+		metrics.Diff(postClientStats, postConsumerStats))
+	// 客户端和消费者的创建开销，用于对比共享客户端与每个消费者一个客户端
+	setup := metrics.Diff(initialStats, postConsumerStats)
+	log.Printf("Setup cost (%d client(s), %d consumer(s)) - %s", clients, len(consumers), setup)
+	monitor.SetMetadata("clients", strconv.Itoa(clients))
+	monitor.SetMetadata("setup_heap_alloc", strconv.FormatInt(setup.HeapAlloc, 10))
+	monitor.SetMetadata("setup_rss", strconv.FormatInt(setup.RSS, 10))
+	// 内存模型以创建完成时为基线
+	monitor.SetModel(metrics.ModelConfig{
+		BaselineHeap:   postConsumerStats.HeapAlloc,
+		BaselineRSS:    postConsumerStats.RSS,
+		Consumers:      len(consumers),
+		QueueSize:      *receiverQueueSize,
+		BatchBytes:     *batchSize,
+		PipelineDepth:  *pipelineDepth,
+		ReleasePayload: *releasePayload,
+		RetainIDOnly:   *retainMode == "id",
+	})
 
 	// 设置信号处理
-	ctx, cancel := context.WithCancel(context.Background())
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(mainCtx)
+	sigCh := app.Signals()
 
-	// 创建批处理器
-	batchProcessor := NewBatchProcessor(*batchSize, *processDelay, consumer, monitor, *releasePayload)
+	if *producerURL != "" {
+		completion = startProducerWatch(ctx, *producerURL)
+	}
+	if queueSource == metrics.QueueBroker {
+		go pollBrokerQueue(ctx, monitor, names, consumers)
+	}
+	// 追赶模式在 -producer-url 的轮询开始之后等待，producer 在等待期间结束也能读到它的发送数
+	var catchup *catchUp
+	if catchUpEnabled() {
+		if catchup, err = waitAndSeek(ctx, cancel, sigCh, consumers, names, monitor); err != nil {
+			a.Exit(results.StatusBrokerError, "catch-up: %v", err)
+		}
+	}
+	if *ttlLag > 0 {
+		var err error
+		if expiry, err = newTTLExpiry(ctx, monitor, names[0], *ttlLag); err != nil {
+			a.Exit(results.StatusBrokerError, "failed to read the message TTL: %v", err)
+		}
+		if err := validateTTLLag(expiry.ttl, *ttlLag); err != nil {
+			a.Exit(results.StatusError, "%v", err)
+		}
+		log.Printf("Namespace message TTL: %v", expiry.ttl)
+	}
 
-	// 消费消息
-	log.Println("Starting to consume messages...")
-	startTime := time.Now()
+	// 卡住检测从订阅成功后开始计时
+	if *stallTimeout > 0 {
+		activity.Touch()
+		go activity.Run(ctx)
+	}
+
+	// 下游模拟
+	var sink *sinkWriter
+	if *sinkKind != "" {
+		sinkCfg := SinkConfig{
+			Kind:         *sinkKind,
+			Path:         *sinkPath,
+			URL:          *sinkURL,
+			Latency:      *sinkLatency,
+			FailureRate:  *sinkFailureRate,
+			MaxRetries:   *sinkRetries,
+			RetryBackoff: *sinkBackoff,
+		}
+		if sinkCfg.Path == "" {
+			sinkCfg.Path = layout.File("sink", "sink", "bin")
+		}
+		s, err := NewSink(sinkCfg)
+		if err != nil {
+			a.Exit(results.StatusError, "failed to create sink: %v", err)
+		}
+		sink = newSinkWriter(sinkCfg, s)
+	}
+
+	var exporter *batchExporter
+	if *exportFormat != "" {
+		exporter, err = newBatchExporter(*exportFormat, layout.Dir, "export_"+*scenario)
+		if err != nil {
+			a.Exit(results.StatusError, "invalid -export: %v", err)
+		}
+	}
+
+	if *recordTrace != "" {
+		if recorder, err = newTraceRecorder(*recordTrace, *recordTraceTime); err != nil {
+			a.Exit(results.StatusError, "failed to create trace: %v", err)
+		}
+	}
+
+	if latency, err = newLatencyClock(*latencySource, *ntpServer); err != nil {
+		a.Exit(results.StatusError, "invalid latency clock: %v", err)
+	}
+	latency.Describe(monitor)
+
+	closeDownstream := func() {
+		catchup.end()
+		msgHook.close(monitor)
+		recorder.Close()
+		latency.Close(monitor)
+		if sink != nil {
+			sink.Close()
+		}
+		if exporter != nil {
+			exporter.Summary()
+		}
+	}
+
+	batchConfig := BatchConfig{
+		BatchSize:      *batchSize,
+		ProcessDelay:   procDelay,
+		ReleasePayload: *releasePayload,
+		RetainIDOnly:   *retainMode == "id",
+		AckRatio:       *ackRatio,
+		NackSkipped:    *skipAction == "nack",
+		Verify:         *verifyPayload,
+		Decode:         decodeEncoding,
+		CheckRelease:   *checkRelease,
+		TimeAcks:       *ackWithResponse,
+		Sink:           sink,
+		Exporter:       exporter,
+		KeyStats:       *keyStats,
+		AckDelay:       *ackDelay,
+		AckJitter:      *ackJitter,
+		AckBatchSize:   *ackBatchSize,
+		AckFlushAfter:  *ackBatchInterval,
+		GCMode:         *gcAfterBatch,
+		GCEvery:        *gcEvery,
+		StormInterval:  *stormInterval,
+		FilterRatio:    *filterRatio,
+	}
+	if *allocAudit {
+		probes := auditAllocs(batchConfig)
+		monitor.SetHarnessAllocs(probes)
+		log.Printf("Harness allocations per call: %s", metrics.FormatAllocs(probes))
+	}
+	// 在 -alloc-audit 之后启用，审计只测 harness 自身的分配
+	msgHook = hooked
+	if *checkAckHoles {
+		ackHoles = newAckHoleTracker()
+	}
+	reporter := progress.NewReporter(progressFmt, "consumer")
+	reporter.SetLabels(a.Labels)
 
-	// 进度报告
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				msgCount, msgBytes, batchCount := monitor.GetCurrentStats()
-				currentStats := monitor.Collect()
-				log.Printf("Progress: %d messages (%.2f MB), %d batches | Heap: %.2f MB | RSS: %.2f MB | Ratio: %.2fx",
-					msgCount,
-					float64(msgBytes)/1024/1024,
-					batchCount,
-					float64(currentStats.HeapAlloc)/1024/1024,
-					float64(currentStats.RSS)/1024/1024,
-					float64(currentStats.HeapAlloc)/float64(msgBytes+1))
-			case <-ctx.Done():
-				return
+	var heapProfilePath string
+	var summaries []metrics.MemorySummary
+	if *abRelease {
+		heapProfilePath, summaries = runABTest(ctx, cancel, sigCh, consumer, batchConfig, monitor, reporter, a)
+		closeDownstream()
+	} else if len(consumers) > 1 {
+		log.Printf("Starting to consume %d subscriptions...", len(consumers))
+		subs, elapsed := runFanout(ctx, cancel, sigCh, consumers, names, batchConfig, monitor, reporter)
+		closeDownstream()
+		monitor.Stop()
+
+		heapProfilePath = saveResults(monitor, layout, "")
+		summaries = append(summaries, monitor.GetSummary())
+		monitor.PrintSummary()
+		writeFanout(layout, subs, summaries[0], postClientStats.HeapAlloc)
+
+		log.Println("")
+		log.Printf("Duration: %v", elapsed.Round(time.Millisecond))
+	} else {
+		var elapsed time.Duration
+		if *subCycles > 0 {
+			opts := consumerOptions
+			opts.SubscriptionName = names[0]
+			log.Printf("Starting %d subscription cycles...", *subCycles)
+			elapsed = runSubCycles(ctx, cancel, sigCh, client, opts, consumer, batchConfig, monitor, reporter, layout)
+		} else {
+			// 创建批处理器
+			batchProcessor := NewBatchProcessor(batchConfig, consumer, monitor)
+			if *routeBy != "" {
+				router = newMessageRouter(batchConfig, routeProperty, routeSizes, consumer, monitor)
+				log.Printf("Routing by %s into %d queues, batch sizes %v", *routeBy, *routeQueues, routeSizes)
 			}
+
+			// 消费消息
+			log.Println("Starting to consume messages...")
+			elapsed = runPass(ctx, cancel, sigCh, batchProcessor, reporter, *maxBatches)
+		}
+		closeDownstream()
+		if expiry != nil {
+			expiry.report(layout)
+		}
+		monitor.Stop()
+
+		heapProfilePath = saveResults(monitor, layout, "")
+		summaries = append(summaries, monitor.GetSummary())
+		// 打印摘要
+		monitor.PrintSummary()
+		if router != nil {
+			router.report(layout, summaries[0], *routeBy)
+		}
+
+		log.Println("")
+		log.Printf("Duration: %v", elapsed.Round(time.Millisecond))
+		if secs := elapsed.Seconds(); secs > 0 {
+			s := summaries[0]
+			log.Printf(metrics.Unitf("Throughput: %.0f msg/s, %.2f MB/s"), float64(s.MessageCount)/secs, metrics.InUnit(float64(s.MessageBytes)/secs))
+		}
+	}
+
+	consumeDone.Store(true)
+
+	if after := snapshotTopic(layout, "consumer_after", *topic); after != nil && before != nil {
+		s := summaries[len(summaries)-1]
+		var drained int64
+		for _, name := range names {
+			drained += before.Backlogs[name] - after.Backlogs[name]
 		}
-	}()
+		log.Printf("Broker drained %d msgs from %d subscription(s) | max RSS / broker storage: %.2fx",
+			drained, len(names), float64(s.MaxRSS)/float64(max(before.StorageSize, 1)))
+	}
+
+	status, reason := evaluateRun(summaries)
+	a.WriteResult(status, reason, resultMetrics(summaries[len(summaries)-1]))
+
+	if err := layout.WriteManifest("consumer", monitor.GetMetadata()); err != nil {
+		log.Printf("Failed to write manifest: %v", err)
+	}
+	a.Finish()
+
+	showHeapProfile(heapProfilePath, profiles, sigCh)
+	if code := status.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// runPass 消费直到没有更多消息、达到 maxBatches 或收到信号，返回耗时
+func runPass(ctx context.Context, cancel context.CancelFunc, sigCh <-chan os.Signal, bp *BatchProcessor, reporter *progress.Reporter, maxBatches int) time.Duration {
+	// 接收循环标为 receive (批处理在 Process 中标为 process)，返回后恢复调用方的标签
+	defer pprof.SetGoroutineLabels(ctx)
+	ctx = app.Label(ctx, "receive")
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// 可选的接收/处理解耦流水线
+	var pipe *pipeline
+	if *pipelineDepth > 0 {
+		pipe = newPipeline(*pipelineDepth, bp, maxBatches, stop)
+		go pipe.run(ctx)
+	}
+
+	recv := newReceiver(bp.consumer, *receiveMode)
+	defer recv.stop()
+
+	startTime := time.Now()
+	if reporter.Enabled() {
+		go reportProgress(ctx, reporter, bp.monitor, pipe)
+	}
 
 	// 主消费循环
 consumeLoop:
@@ -263,64 +1420,275 @@ consumeLoop:
 		}
 
 		// 带超时的接收
-		recvCtx, recvCancel := context.WithTimeout(ctx, 100*time.Millisecond)
-		msg, err := consumer.Receive(recvCtx)
-		recvCancel()
+		recvStart := time.Now()
+		msg, err := recv.receive(ctx)
+		if ctx.Err() == nil {
+			bp.monitor.RecordReceive(time.Since(recvStart), err == nil)
+		}
+		if err == nil {
+			activity.Touch()
+			recorder.Record(msg)
+		}
 
 		if err != nil {
 			if ctx.Err() != nil {
 				break consumeLoop
 			}
-			// 超时，检查是否还有更多消息
-			if batchProcessor.currentBytes > 0 && batchProcessor.batchCount > 0 {
+			// -until-signal 时空闲不结束，等待信号
+			if *untilSignal {
+				continue
+			}
+			// 超时，检查是否还有更多消息；-producer-url 时只有处理数达到 producer 的已发送数才算消费完
+			if completion != nil {
+				processed, _, _ := bp.monitor.GetCurrentStats()
+				if completion.complete(processed) && (pipe == nil || pipe.idle()) {
+					log.Printf("Processed all %d messages sent by the producer, processing remaining batch...", processed)
+					break consumeLoop
+				}
+				continue
+			}
+			if pipe != nil {
+				// 剩余批次在 pipe.close 时处理
+				if pipe.idle() {
+					log.Println("No more messages, processing remaining batch...")
+					break consumeLoop
+				}
+				continue
+			}
+			if router != nil {
+				// 各队列未满的批次在 router.flush 时处理
+				if router.idle() {
+					log.Println("No more messages, processing remaining batches...")
+					break consumeLoop
+				}
+				continue
+			}
+			if bp.Bytes() > 0 && bp.Count() > 0 {
 				// 没有更多消息且已经有数据，处理最后一批
 				log.Println("No more messages, processing remaining batch...")
-				batchProcessor.Process(ctx)
+				bp.Process(ctx)
+				break consumeLoop
+			}
+			continue
+		}
+
+		if pipe != nil {
+			if !pipe.push(ctx, msg) {
+				break consumeLoop
+			}
+			continue
+		}
+
+		// 按 -route-by 分到各队列，每个队列达到自己的阈值时处理
+		if router != nil {
+			if router.add(ctx, msg) && maxBatches > 0 && router.batches() >= maxBatches {
+				log.Printf("Reached max batches (%d), stopping...", maxBatches)
 				break consumeLoop
 			}
 			continue
 		}
 
 		// 添加到批次
-		if batchProcessor.Add(msg) {
-			batchProcessor.Process(ctx)
+		if bp.Add(msg) {
+			bp.Process(ctx)
 
 			// 检查是否达到最大批次数
-			if *maxBatches > 0 && batchProcessor.batchCount >= *maxBatches {
-				log.Printf("Reached max batches (%d), stopping...", *maxBatches)
+			if maxBatches > 0 && bp.Count() >= maxBatches {
+				log.Printf("Reached max batches (%d), stopping...", maxBatches)
 				break consumeLoop
 			}
 		}
 	}
 
 	// 处理剩余消息
-	if batchProcessor.currentBytes > 0 {
-		batchProcessor.Process(ctx)
+	if pipe != nil {
+		pipe.close()
+	} else if router != nil {
+		router.flush(ctx)
+		router.finish()
+	} else if bp.Bytes() > 0 {
+		bp.Process(ctx)
+	}
+	bp.finish()
+	return time.Since(startTime)
+}
+
+// reportProgress 按 -progress-interval 报告进度，直到 ctx 取消
+func reportProgress(ctx context.Context, reporter *progress.Reporter, monitor *metrics.MemoryMonitor, pipe *pipeline) {
+	ticker := monitor.Clock().NewTicker(*progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			reporter.Report(progressLine(monitor, monitor.Collect(), pipe))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// progressLine 由当前计数和样本生成一行进度及其结构化字段
+func progressLine(monitor *metrics.MemoryMonitor, currentStats metrics.MemoryStats, pipe *pipeline) (string, map[string]any) {
+	msgCount, msgBytes, batchCount := monitor.GetCurrentStats()
+	ratio := float64(currentStats.HeapAlloc) / float64(msgBytes+1)
+	text := fmt.Sprintf(metrics.Unitf("Progress: %d messages (%.2f MB), %d batches | Heap: %.2f MB | RSS: %.2f MB | Ratio: %.2fx"),
+		msgCount,
+		metrics.InUnit(msgBytes),
+		batchCount,
+		metrics.InUnit(currentStats.HeapAlloc),
+		metrics.InUnit(currentStats.RSS),
+		ratio)
+	fields := map[string]any{
+		"messages":   msgCount,
+		"bytes":      msgBytes,
+		"batches":    batchCount,
+		"heap_alloc": currentStats.HeapAlloc,
+		"rss":        currentStats.RSS,
+		"heap_ratio": ratio,
+	}
+	if lag, ok := monitor.EstimateLag(lagWindow); ok {
+		text += fmt.Sprintf(" | Lag: %s", lag)
+		fields["lag_ms"] = lag.Lag.Milliseconds()
+		fields["catch_up_rate"] = lag.CatchUpRate
+		fields["time_to_drain_ms"] = lag.TimeToDrain.Milliseconds()
+	}
+	if pipe != nil {
+		text += fmt.Sprintf(" | Pipeline: %d/%d", pipe.depth(), *pipelineDepth)
+		fields["pipeline_depth"] = pipe.depth()
+	}
+	return text, fields
+}
+
+// consumerPrecheck 运行前检查的资源；loopback 后端不连接 broker，只检查本地资源
+func consumerPrecheck(loopback bool, routeSizes []int64) precheck.Config {
+	// 客户端缓存的消息受 memory limit 约束 (0 为客户端默认的 64MB，负数不限制，无法估算)，
+	// 每个订阅再攒一个批次，-route-by 时每个队列一个
+	need := *batchSize * int64(*fanout)
+	if len(routeSizes) > 0 {
+		need = 0
+		for _, size := range routeSizes {
+			need += size
+		}
+	}
+	switch {
+	case *memoryLimit > 0:
+		need += *memoryLimit
+	case *memoryLimit == 0 && !loopback:
+		need += 64 << 20
+	}
+	cfg := precheck.Config{MemoryBytes: need}
+	if loopback {
+		return cfg
+	}
+	cfg.ServiceURL = *pulsarURL
+	cfg.AdminURL = *adminURL
+	cfg.CreateTopic = *precheckCreate
+	if *topicsPattern == "" {
+		cfg.Topics = []string{*topic}
+	}
+	return cfg
+}
+
+// consumerScenario 未给 -scenario 时由关键参数生成场景名，默认值的参数省略
+func consumerScenario() string {
+	params := []string{*preset, app.SizeParam("batch", *batchSize), "q" + strconv.Itoa(*receiverQueueSize)}
+	if *backend != backendPulsar {
+		params = append([]string{*backend}, params...)
+	}
+	if *memoryLimit > 0 {
+		params = append(params, app.SizeParam("ml", *memoryLimit))
+	}
+	if *fanout > 1 {
+		params = append(params, "fanout"+strconv.Itoa(*fanout))
 	}
+	return app.AutoScenario("consumer", params...)
+}
 
-	elapsed := time.Since(startTime)
-	monitor.Stop()
+// saveResults 写入堆 profile (附带 top retainers) 和统计数据，文件名加 suffix 区分 A/B 轮次，返回 profile 路径
+func saveResults(monitor *metrics.MemoryMonitor, layout *results.Layout, suffix string) string {
+	if gcTrace != nil {
+		monitor.AddGCTrace(gcTrace.Records())
+	}
+	reportAckHoles(monitor)
 
-	// 写入堆 profile
-	heapProfilePath := filepath.Join(*outputDir, fmt.Sprintf("heap_%s.pprof", *scenario))
+	heapProfilePath := layout.File("profile", "heap"+suffix, "pprof")
 	if err := metrics.WriteHeapProfile(heapProfilePath); err != nil {
 		log.Printf("Failed to write heap profile: %v", err)
 	} else {
 		log.Printf("Heap profile saved to: %s", heapProfilePath)
+		if retainers, err := metrics.TopRetainers(heapProfilePath, topRetainers); err != nil {
+			log.Printf("Failed to extract top retainers: %v", err)
+		} else {
+			monitor.SetTopRetainers(retainers)
+			for i, r := range retainers[:min(5, len(retainers))] {
+				log.Printf(metrics.Unitf("  #%d %6.2f MB (%5.1f%%) %s"), i+1, metrics.InUnit(r.Bytes), r.Percent, r.Function)
+			}
+		}
+	}
+
+	if profiler != nil {
+		reportHeapGrowth(monitor)
+	}
+
+	// 客户端仍未关闭，调用栈包含各连接、consumer 的 goroutine
+	goroutinesPath := layout.File("profile", "goroutines"+suffix, "txt")
+	if err := monitor.DumpGoroutines(goroutinesPath); err != nil {
+		log.Printf("Failed to dump goroutines: %v", err)
+	} else {
+		log.Printf("Goroutine stacks saved to: %s", goroutinesPath)
 	}
 
-	// 保存统计数据
-	statsPath := filepath.Join(*outputDir, fmt.Sprintf("stats_%s.json", *scenario))
-	if err := monitor.SaveToFile(statsPath); err != nil {
+	gz := ""
+	if *statsGzip {
+		gz = ".gz"
+	}
+	mode, _ := metrics.ParseSampleMode(*samplesMode)
+	if enc, _ := metrics.NewEncoder(*statsFormat); enc.Name() != "json" {
+		// 样本写入单独的文件，stats JSON 仍保留摘要和 rollup，compare/bundle 等工具照常可用
+		samplesPath := layout.File("stats", "samples"+suffix, enc.Ext()+gz)
+		if err := monitor.SaveAs(samplesPath, mode, enc); err != nil {
+			log.Printf("Failed to save samples: %v", err)
+		} else {
+			log.Printf("Samples (%s) saved to: %s", enc.Name(), samplesPath)
+		}
+		mode = metrics.SamplesRollup
+	}
+	if n, mean, longest := procDelay.stats(); n > 0 {
+		log.Printf("Process delay (%s): %d messages, mean %v, longest %v", *processDelayDist, n, mean, longest)
+		monitor.SetMetadata("process_delay_dist", *processDelayDist)
+		monitor.SetMetadata("process_delay_mean_ns", strconv.FormatInt(int64(mean), 10))
+		monitor.SetMetadata("process_delay_max_ns", strconv.FormatInt(int64(longest), 10))
+	}
+	auditPath := layout.File("audit", "audit"+suffix, "jsonl")
+	if err := monitor.SaveAuditLog(auditPath); err != nil {
+		log.Printf("Failed to save audit log: %v", err)
+	} else {
+		log.Printf("Audit log (%d changes) saved to: %s", len(monitor.GetChanges()), auditPath)
+	}
+	statsPath := layout.File("stats", "stats"+suffix, "json"+gz)
+	if err := monitor.Save(statsPath, mode); err != nil {
 		log.Printf("Failed to save stats: %v", err)
 	} else {
 		log.Printf("Stats saved to: %s", statsPath)
 	}
+	return heapProfilePath
+}
 
-	// 打印摘要
-	monitor.PrintSummary()
-
-	log.Println("")
-	log.Printf("Duration: %v", elapsed.Round(time.Millisecond))
-	log.Printf("pprof command: go tool pprof -http=:8080 %s", heapProfilePath)
+// showHeapProfile 按 -open-pprof 打开 heap profile 的 web UI，未设置时只打印命令
+func showHeapProfile(heapProfilePath string, profiles *profview.Viewer, sigCh <-chan os.Signal) {
+	if *openPprof == "" {
+		log.Printf("pprof command: go tool pprof -http=:8080 %s", heapProfilePath)
+		return
+	}
+	embeddedURL := fmt.Sprintf("http://%s:%d%s%s/top", *pprofHost, *pprofPort, profiles.Prefix(), filepath.Base(heapProfilePath))
+	if *openPprof != "embedded" {
+		// 运行结束后 SIGINT 仍由 sigCh 接收，Ctrl-C 只会结束 pprof 子进程
+		err := openPprofUI(*openPprof, heapProfilePath)
+		if err == nil {
+			return
+		}
+		log.Printf("pprof web UI: %v, falling back to the embedded viewer", err)
+	}
+	log.Printf("Serving heap profile at %s (Ctrl-C to exit)", embeddedURL)
+	<-sigCh
 }
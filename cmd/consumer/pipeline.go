@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/batch"
+)
+
+// pipeline 将 Receive 循环与批处理解耦: 接收端写入有界 channel，
+// 单独的 goroutine 负责 Add/Process。channel 中缓冲的消息是同步模式下不存在的额外内存
+type pipeline struct {
+	ch         chan receivedMsg
+	done       chan struct{}
+	bp         *BatchProcessor
+	maxBatches int
+	stop       context.CancelFunc // 达到 maxBatches 时停止接收
+
+	batches atomic.Int64 // 已处理批次数，供接收端判断空闲退出
+
+	// 以下字段只由接收端 goroutine 访问
+	received int64
+	peak     int
+	blocked  time.Duration
+}
+
+// receivedMsg channel 中的一条消息和它 Receive 返回时的 batch.HoldClock，channel 中等待的时间也计入持有时长
+type receivedMsg struct {
+	msg pulsar.Message
+	at  time.Duration
+}
+
+func newPipeline(depth int, bp *BatchProcessor, maxBatches int, stop context.CancelFunc) *pipeline {
+	return &pipeline{
+		ch:         make(chan receivedMsg, depth),
+		done:       make(chan struct{}),
+		bp:         bp,
+		maxBatches: maxBatches,
+		stop:       stop,
+	}
+}
+
+// run 处理 goroutine，channel 关闭后处理剩余批次
+func (p *pipeline) run(ctx context.Context) {
+	defer close(p.done)
+	ctx = app.Label(ctx, "process")
+	stopped := false
+	for r := range p.ch {
+		// 达到 maxBatches 后只排空 channel，不再处理
+		if stopped {
+			continue
+		}
+		if p.bp.AddReceived(r.msg, r.at) {
+			p.bp.Process(ctx)
+			p.batches.Store(int64(p.bp.Count()))
+			if p.maxBatches > 0 && p.bp.Count() >= p.maxBatches {
+				log.Printf("Reached max batches (%d), stopping...", p.maxBatches)
+				stopped = true
+				p.stop()
+			}
+		}
+	}
+	if !stopped && p.bp.Bytes() > 0 {
+		p.bp.Process(ctx)
+	}
+}
+
+// push 将消息交给处理 goroutine，channel 满时阻塞，ctx 取消时返回 false
+func (p *pipeline) push(ctx context.Context, msg pulsar.Message) bool {
+	r := receivedMsg{msg: msg, at: batch.HoldClock()}
+	select {
+	case p.ch <- r:
+	default:
+		start := time.Now()
+		select {
+		case p.ch <- r:
+			p.blocked += time.Since(start)
+		case <-ctx.Done():
+			return false
+		}
+	}
+	p.received++
+	if n := len(p.ch); n > p.peak {
+		p.peak = n
+	}
+	return true
+}
+
+// idle 接收超时时判断是否可以退出: 已收到消息且至少处理过一个批次
+func (p *pipeline) idle() bool {
+	return p.received > 0 && p.batches.Load() > 0
+}
+
+// depth 当前 channel 中等待处理的消息数
+func (p *pipeline) depth() int {
+	return len(p.ch)
+}
+
+// close 停止写入并等待处理 goroutine 结束
+func (p *pipeline) close() {
+	close(p.ch)
+	<-p.done
+	log.Printf("Pipeline: capacity %d, peak depth %d, receive blocked %v",
+		cap(p.ch), p.peak, p.blocked.Round(time.Millisecond))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// openPprofUI 以 go tool pprof -http 打开堆 profile 的 Web UI，阻塞到 pprof 退出 (Ctrl-C)
+func openPprofUI(addr, profile string) error {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("go toolchain not found in PATH: %w", err)
+	}
+	cmd := exec.Command(goBin, "tool", "pprof", "-http="+addr, profile)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	log.Printf("Opening pprof web UI at http://%s (Ctrl-C to exit)...", addr)
+	err = cmd.Run()
+	// 被 Ctrl-C 结束是正常退出方式
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && !exitErr.Exited() {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -process-delay-dist 的取值
+const (
+	delayBatch       = "batch"       // 每个批次固定 -process-delay (原有行为)
+	delayFixed       = "fixed"       // 每条消息固定 -process-delay
+	delayExponential = "exponential" // 每条消息服从均值为 -process-delay 的指数分布
+	delayPareto      = "pareto"      // 每条消息服从均值为 -process-delay 的 Pareto 分布，pareto:<alpha>
+
+	// defaultParetoAlpha alpha 越接近 1 尾部越重，<= 2 时方差无穷
+	defaultParetoAlpha = 1.5
+	// paretoCap 单条消息的延迟不超过均值的倍数，避免一次抽样卡住整个测试
+	paretoCap = 1000
+)
+
+// procDelay 由 -process-delay 和 -process-delay-dist 创建，所有批次处理器共享，结束时其抽样统计写入元数据
+var procDelay *delayModel
+
+// delayModel 模拟处理耗时: batch 时每个批次等待固定时长；否则每条消息按分布各抽一个延迟，
+// 批次依次处理其中的消息，耗时为各消息延迟之和，长尾的抽样让个别批次 (及其缓冲的消息) 保留得更久
+type delayModel struct {
+	dist  string
+	mean  time.Duration
+	alpha float64
+
+	mu    sync.Mutex // route/fanout 时多个批次处理器共享
+	rng   *rand.Rand
+	count int64         // 抽样的消息数
+	total time.Duration // 抽样的延迟之和
+	max   time.Duration // 单条消息的最大延迟
+}
+
+// parseProcessDelay 解析 -process-delay-dist，mean 为 -process-delay
+func parseProcessDelay(s string, mean time.Duration) (*delayModel, error) {
+	if mean < 0 {
+		return nil, fmt.Errorf("-process-delay must be >= 0")
+	}
+	d := &delayModel{mean: mean, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	dist, param, hasParam := strings.Cut(s, ":")
+	switch dist {
+	case delayBatch, delayFixed, delayExponential:
+		if hasParam {
+			return nil, fmt.Errorf("%s takes no parameter", dist)
+		}
+	case delayPareto:
+		d.alpha = defaultParetoAlpha
+		if hasParam {
+			a, err := strconv.ParseFloat(param, 64)
+			if err != nil || a <= 1 {
+				return nil, fmt.Errorf("pareto alpha %q must be a number > 1 (finite mean)", param)
+			}
+			d.alpha = a
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution %q (want batch, fixed, exponential or pareto[:alpha])", s)
+	}
+	d.dist = dist
+	return d, nil
+}
+
+// perMessage 是否按消息抽样
+func (d *delayModel) perMessage() bool {
+	return d.dist != delayBatch
+}
+
+// String 用于配置日志和元数据
+func (d *delayModel) String() string {
+	switch d.dist {
+	case delayBatch:
+		return fmt.Sprintf("%v per batch", d.mean)
+	case delayPareto:
+		return fmt.Sprintf("pareto (alpha %.2f), mean %v per message, capped at %v", d.alpha, d.mean, d.mean*paretoCap)
+	}
+	return fmt.Sprintf("%s, mean %v per message", d.dist, d.mean)
+}
+
+// sample 抽取一条消息的延迟，调用方持有 mu
+func (d *delayModel) sample() time.Duration {
+	switch d.dist {
+	case delayExponential:
+		return time.Duration(d.rng.ExpFloat64() * float64(d.mean))
+	case delayPareto:
+		// 最小值 xm 使均值 alpha*xm/(alpha-1) 等于 mean
+		xm := float64(d.mean) * (d.alpha - 1) / d.alpha
+		v := xm / math.Pow(1-d.rng.Float64(), 1/d.alpha)
+		return time.Duration(min(v, float64(d.mean)*paretoCap))
+	}
+	return d.mean
+}
+
+// forBatch 一个 n 条消息的批次的处理耗时，以及其中单条消息的最大延迟
+func (d *delayModel) forBatch(n int) (total, longest time.Duration) {
+	if d.mean == 0 {
+		return 0, 0
+	}
+	if !d.perMessage() {
+		return d.mean, 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for range n {
+		v := d.sample()
+		total += v
+		longest = max(longest, v)
+	}
+	d.count += int64(n)
+	d.total += total
+	d.max = max(d.max, longest)
+	return total, longest
+}
+
+// stats 已抽样的消息数、平均和最大延迟
+func (d *delayModel) stats() (count int64, mean, longest time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.count > 0 {
+		mean = d.total / time.Duration(d.count)
+	}
+	return d.count, mean, d.max
+}
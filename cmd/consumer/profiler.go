@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// profiler 开启 -profile-every/-profile-interval 时的定期 heap/goroutine profile 快照，
+// Process 每批次通知，saveResults 最后再快照一次并把首尾之差写入摘要
+var profiler *metrics.Profiler
+
+// startProfiler 快照写在结果目录下: heap-001_<scenario>.pprof、goroutine-001_<scenario>.pprof ... (run 布局为 heap-001.pprof)
+func startProfiler(ctx context.Context, layout *results.Layout, everyBatches int, interval time.Duration) *metrics.Profiler {
+	p := metrics.NewProfiler(everyBatches, interval, func(kind string, seq int) string {
+		return layout.File("profile", fmt.Sprintf("%s-%03d", kind, seq), "pprof")
+	})
+	go p.Run(ctx)
+	return p
+}
+
+// reportHeapGrowth 结束时的快照作为最后一个，与第一个快照比较后交给 monitor
+func reportHeapGrowth(monitor *metrics.MemoryMonitor) {
+	profiler.Capture("final")
+	growth, err := profiler.Growth(topRetainers)
+	if err != nil {
+		log.Printf("Failed to diff heap profile snapshots: %v", err)
+		return
+	}
+	if growth == nil {
+		log.Printf("Only one profile snapshot, no heap growth to report (lower -profile-every/-profile-interval)")
+		return
+	}
+	monitor.SetHeapGrowth(growth)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// brokerQueuePoll -queue-estimate=broker 时读取 topic stats 的间隔，与采样间隔一致
+const brokerQueuePoll = time.Second
+
+// pollBrokerQueue 定期从 -admin-url 读取 broker 推送给本进程各消费者的消息数 (按订阅和消费者名匹配)，
+// 交给 monitor 与 Receive 计数相减得到 receiver queue 中的消息数；失败只在首次记录日志
+func pollBrokerQueue(ctx context.Context, monitor *metrics.MemoryMonitor, names []string, consumers []pulsar.Consumer) {
+	client := admin.New(*adminURL)
+	ticker := time.NewTicker(brokerQueuePoll)
+	defer ticker.Stop()
+	failed := false
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, brokerQueuePoll)
+		stats, err := client.Stats(reqCtx, *topic)
+		cancel()
+		if err != nil {
+			if !failed && ctx.Err() == nil {
+				log.Printf("Queue estimate: topic stats failed: %v", err)
+				failed = true
+			}
+		} else {
+			var dispatched int64
+			for i, name := range names {
+				// 分区 topic 的 partitioned-stats 中，同一消费者在每个分区各有一条
+				for _, c := range stats.Subscriptions[name].Consumers {
+					if c.ConsumerName == consumers[i].Name() {
+						dispatched += c.MsgOutCounter
+					}
+				}
+			}
+			monitor.SetBrokerDispatched(dispatched)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
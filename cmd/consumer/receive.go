@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+const (
+	receiveModeTimeout = "timeout"
+	receiveModeChan    = "chan"
+)
+
+// receiveWait 接收循环每次等待消息的上限，超时后检查是否已经消费完
+const receiveWait = 100 * time.Millisecond
+
+var (
+	errReceiveTimeout = errors.New("receive timeout")
+	errConsumerClosed = errors.New("consumer closed")
+)
+
+// receiver 接收循环取一条消息的方式 (-receive-mode)。
+// timeout 每次调用 Receive 都新建一个带超时的 context 和它的 timer (数次分配，见 -alloc-audit 的 receive_timeout)；
+// chan 从 consumer.Chan() 读取，超时用同一个 timer 反复 Reset，不产生分配。
+// 客户端的 Receive 本身就是读取同一个 channel，两种方式收到的消息相同
+type receiver struct {
+	consumer pulsar.Consumer
+	ch       <-chan pulsar.ConsumerMessage // 只在 chan 模式下非 nil
+	timer    *time.Timer
+}
+
+func newReceiver(consumer pulsar.Consumer, mode string) *receiver {
+	r := &receiver{consumer: consumer}
+	if mode == receiveModeChan {
+		r.ch = consumer.Chan()
+		r.timer = time.NewTimer(receiveWait)
+	}
+	return r
+}
+
+// receive 最多等待 receiveWait 取一条消息，超时或 ctx 取消时返回错误
+func (r *receiver) receive(ctx context.Context) (pulsar.Message, error) {
+	if r.ch == nil {
+		recvCtx, cancel := context.WithTimeout(ctx, receiveWait)
+		defer cancel()
+		return r.consumer.Receive(recvCtx)
+	}
+	// Go 1.23 起 Reset 会丢弃已到期未读的值，无需先排空 timer.C
+	r.timer.Reset(receiveWait)
+	select {
+	case cm, ok := <-r.ch:
+		if !ok {
+			return nil, errConsumerClosed
+		}
+		return cm.Message, nil
+	case <-r.timer.C:
+		return nil, errReceiveTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// stop 释放 chan 模式的 timer
+func (r *receiver) stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"hash/crc32"
+	"runtime/debug"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// releaseSnapshot 释放前记录的 payload 大小和校验和，用来判断释放后读到的是旧数据还是被复用的内存
+type releaseSnapshot struct {
+	size int
+	sum  uint32
+}
+
+func snapshotPayload(data []byte) releaseSnapshot {
+	return releaseSnapshot{size: len(data), sum: crc32.ChecksumIEEE(data)}
+}
+
+// check 再次访问已释放消息的 Payload() 和 Properties()
+func (s releaseSnapshot) check(msg pulsar.Message) (metrics.ReleaseOutcome, bool) {
+	data := msg.Payload()
+	propsRetained := len(msg.Properties()) > 0
+	switch {
+	case data == nil:
+		return metrics.ReleaseNil, propsRetained
+	case len(data) == 0:
+		return metrics.ReleaseEmpty, propsRetained
+	case len(data) == s.size && crc32.ChecksumIEEE(data) == s.sum:
+		return metrics.ReleaseStale, propsRetained
+	default:
+		return metrics.ReleaseChanged, propsRetained
+	}
+}
+
+// pulsarClientVersion 从构建信息读取 pulsar-client-go 的版本，有 replace 时附带替换目标，
+// 写入 metadata 以便对照不同客户端版本下 ReleasePayload 的行为
+func pulsarClientVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != "github.com/apache/pulsar-client-go" {
+			continue
+		}
+		if r := dep.Replace; r != nil {
+			if r.Version != "" {
+				return dep.Version + " => " + r.Path + " " + r.Version
+			}
+			return dep.Version + " => " + r.Path
+		}
+		return dep.Version
+	}
+	return "unknown"
+}
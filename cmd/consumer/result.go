@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// evaluateRun 按数据校验和 -max-heap-mb/-max-rss-mb 阈值判定结论，校验失败优先；
+// A/B 模式下每一轮都参与判定
+func evaluateRun(summaries []metrics.MemorySummary) (results.Status, string) {
+	for _, s := range summaries {
+		if s.CorruptCount > 0 {
+			return results.StatusVerification, fmt.Sprintf("%d corrupted payloads", s.CorruptCount)
+		}
+		if s.DecodeErrors > 0 {
+			return results.StatusVerification, fmt.Sprintf("%d payloads failed to decode", s.DecodeErrors)
+		}
+		if c := s.ReleaseCheck; c != nil && c.Violations() > 0 {
+			return results.StatusVerification, fmt.Sprintf("Payload() returned data after ReleasePayload %d times", c.Violations())
+		}
+		if h := s.AckHoles; h != nil && h.Holes > 0 {
+			return results.StatusVerification, fmt.Sprintf("%d batch indexes received but never acked in %d partially acked entries", h.Holes, h.Partial)
+		}
+	}
+	// -producer-url: 按计数核对是否处理完 producer 发送的全部消息，-max-batches 提前停止时不核对
+	if completion != nil && *maxBatches == 0 {
+		if err := completion.check(summaries[len(summaries)-1].MessageCount); err != nil {
+			return results.StatusVerification, err.Error()
+		}
+	}
+	for _, s := range summaries {
+		if limit := *maxHeapMB; limit > 0 && s.MaxHeapAlloc > uint64(limit)<<20 {
+			return results.StatusThreshold, fmt.Sprintf("max HeapAlloc %.2f MB exceeds -max-heap-mb=%d", float64(s.MaxHeapAlloc)/1024/1024, limit)
+		}
+		if limit := *maxRSSMB; limit > 0 && s.MaxRSS > uint64(limit)<<20 {
+			return results.StatusThreshold, fmt.Sprintf("max RSS %.2f MB exceeds -max-rss-mb=%d", float64(s.MaxRSS)/1024/1024, limit)
+		}
+	}
+	return results.StatusOK, ""
+}
+
+// resultMetrics result.json 中的关键指标
+func resultMetrics(s metrics.MemorySummary) map[string]float64 {
+	return map[string]float64{
+		"duration_s":      s.Duration.Seconds(),
+		"messages":        float64(s.MessageCount),
+		"message_bytes":   float64(s.MessageBytes),
+		"batches":         float64(s.BatchCount),
+		"max_heap_alloc":  float64(s.MaxHeapAlloc),
+		"max_rss":         float64(s.MaxRSS),
+		"heap_ratio":      s.HeapRatio,
+		"rss_ratio":       s.RSSRatio,
+		"num_gc":          float64(s.NumGC),
+		"gc_cpu_fraction": s.GCCPUFraction,
+		"corrupt":         float64(s.CorruptCount),
+		"msgs_per_s":      perSecond(float64(s.MessageCount), s.Duration),
+		"bytes_per_s":     perSecond(float64(s.MessageBytes), s.Duration),
+	}
+}
+
+func perSecond(v float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return v / d.Seconds()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// router 非 nil 时 (-route-by) 消费循环把消息交给它分发，而不是单个 BatchProcessor
+var router *messageRouter
+
+// messageRouter 按消息 key 或某个 property 的哈希把消息分到 N 个内存队列，每个队列是独立的 BatchProcessor，
+// 有自己的批次阈值，模拟按类型/目标 topic 路由后分别攒批的消费者。
+//
+// 单队列时缓冲的数据平均约为半个批次；N 个队列各自攒批时，多数时刻每个队列都有一个未满的批次，
+// 稳态内存随队列数增长而不是随吞吐增长。router 在每条消息加入后统计未满批次的个数和缓冲字节数，
+// 结束时与单队列的期望 (阈值的一半) 比较。
+type messageRouter struct {
+	property string // 为空时按 key 路由
+	queues   []*BatchProcessor
+	stats    []routeQueue
+
+	buffered int64 // 各队列未处理批次的字节数之和
+	partial  int   // 有未处理消息的队列数
+
+	// 每条消息加入后的累计，用于平均值
+	adds        int64
+	sumBuffered float64
+	sumPartial  float64
+	maxBuffered int64
+	maxPartial  int
+}
+
+// routeQueue 一个队列的计数，写入 route_<scenario>.json
+type routeQueue struct {
+	Queue          int   `json:"queue"`
+	BatchSize      int64 `json:"batch_size"`
+	Messages       int64 `json:"messages"`
+	Bytes          int64 `json:"bytes"`
+	Batches        int   `json:"batches"`
+	PeakBatchBytes int64 `json:"peak_batch_bytes"`
+	FinalBytes     int64 `json:"final_bytes"` // 结束时未满、在最后一并处理的批次
+}
+
+// routeResult 写入 route_<scenario>.json
+type routeResult struct {
+	RouteBy        string       `json:"route_by"`
+	Queues         []routeQueue `json:"queues"`
+	AvgPartial     float64      `json:"avg_partial_batches"`
+	MaxPartial     int          `json:"max_partial_batches"`
+	AvgBufferedMB  float64      `json:"avg_buffered_mb"`
+	MaxBufferedMB  float64      `json:"max_buffered_mb"`
+	SingleQueueMB  float64      `json:"single_queue_mb"` // 单队列 (平均阈值) 的期望缓冲: 半个批次
+	Inflation      float64      `json:"inflation"`       // AvgBufferedMB / SingleQueueMB
+	AvgHeapAllocMB float64      `json:"avg_heap_alloc_mb"`
+	MaxHeapAllocMB float64      `json:"max_heap_alloc_mb"`
+}
+
+// parseRouteBy 解析 -route-by: key 或 property:<name>，返回 property 名 (按 key 时为空)
+func parseRouteBy(s string) (string, error) {
+	if s == "key" {
+		return "", nil
+	}
+	if name, ok := strings.CutPrefix(s, "property:"); ok && name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown routing %q (want key or property:<name>)", s)
+}
+
+// parseRouteBatchSizes 解析 -route-batch-sizes (逗号分隔的字节数)，为空时每个队列都用 def；
+// 少于 n 个时循环使用
+func parseRouteBatchSizes(s string, n int, def int64) ([]int64, error) {
+	sizes := make([]int64, n)
+	if s == "" {
+		for i := range sizes {
+			sizes[i] = def
+		}
+		return sizes, nil
+	}
+	var list []int64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseInt(strings.TrimSpace(f), 10, 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid batch size %q: want a positive number of bytes", f)
+		}
+		list = append(list, v)
+	}
+	for i := range sizes {
+		sizes[i] = list[i%len(list)]
+	}
+	return sizes, nil
+}
+
+// newMessageRouter 每个队列一个 BatchProcessor，BatchSize 依次取 sizes
+func newMessageRouter(cfg BatchConfig, property string, sizes []int64, consumer pulsar.Consumer, monitor *metrics.MemoryMonitor) *messageRouter {
+	r := &messageRouter{property: property}
+	for i, size := range sizes {
+		c := cfg
+		c.BatchSize = size
+		bp := NewBatchProcessor(c, consumer, monitor)
+		bp.route = fmt.Sprintf("q%d", i)
+		r.queues = append(r.queues, bp)
+		r.stats = append(r.stats, routeQueue{Queue: i, BatchSize: size})
+	}
+	return r
+}
+
+// pick 消息所属的队列
+func (r *messageRouter) pick(msg pulsar.Message) int {
+	value := msg.Key()
+	if r.property != "" {
+		value = msg.Properties()[r.property]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return int(h.Sum32() % uint32(len(r.queues)))
+}
+
+// add 把消息加入所属队列，队列达到自己的阈值时处理该批次；返回是否处理了批次
+func (r *messageRouter) add(ctx context.Context, msg pulsar.Message) bool {
+	i := r.pick(msg)
+	q, st := r.queues[i], &r.stats[i]
+	before := q.Bytes()
+	full := q.Add(msg)
+	st.Messages++
+	st.Bytes += q.Bytes() - before
+	r.buffered += q.Bytes() - before
+	if before == 0 && q.Bytes() > 0 {
+		r.partial++
+	}
+	// 统计取处理之前: 刚满的批次此刻仍在内存中
+	r.adds++
+	r.sumBuffered += float64(r.buffered)
+	r.sumPartial += float64(r.partial)
+	r.maxBuffered = max(r.maxBuffered, r.buffered)
+	r.maxPartial = max(r.maxPartial, r.partial)
+	if full {
+		r.process(ctx, i)
+	}
+	return full
+}
+
+// process 处理队列 i 的当前批次
+func (r *messageRouter) process(ctx context.Context, i int) {
+	q, st := r.queues[i], &r.stats[i]
+	bytes := q.Bytes()
+	if bytes == 0 {
+		return
+	}
+	q.Process(ctx)
+	st.Batches = q.Count()
+	st.PeakBatchBytes = max(st.PeakBatchBytes, bytes)
+	r.buffered -= bytes
+	r.partial--
+}
+
+// batches 各队列已处理的批次数之和
+func (r *messageRouter) batches() int {
+	n := 0
+	for _, q := range r.queues {
+		n += q.Count()
+	}
+	return n
+}
+
+// idle 接收超时时判断是否可以退出: 与单队列相同，已有数据且至少处理过一个批次
+func (r *messageRouter) idle() bool {
+	return r.buffered > 0 && r.batches() > 0
+}
+
+// flush 消费结束时处理所有未满的批次
+func (r *messageRouter) flush(ctx context.Context) {
+	for i, q := range r.queues {
+		r.stats[i].FinalBytes = q.Bytes()
+		r.process(ctx, i)
+	}
+}
+
+// finish 对应 BatchProcessor.finish，每个队列各自发出推迟的确认
+func (r *messageRouter) finish() {
+	for _, q := range r.queues {
+		q.finish()
+	}
+}
+
+// report 打印各队列和未满批次的统计，写入 route_<scenario>.json
+func (r *messageRouter) report(layout *results.Layout, summary metrics.MemorySummary, routeBy string) {
+	mb := func(v float64) float64 { return v / 1024 / 1024 }
+	res := routeResult{
+		RouteBy:        routeBy,
+		Queues:         r.stats,
+		MaxPartial:     r.maxPartial,
+		MaxBufferedMB:  mb(float64(r.maxBuffered)),
+		AvgHeapAllocMB: mb(summary.AvgHeapAlloc),
+		MaxHeapAllocMB: mb(float64(summary.MaxHeapAlloc)),
+	}
+	if r.adds > 0 {
+		res.AvgPartial = r.sumPartial / float64(r.adds)
+		res.AvgBufferedMB = mb(r.sumBuffered / float64(r.adds))
+	}
+	var total int64
+	for _, q := range r.stats {
+		total += q.BatchSize
+	}
+	res.SingleQueueMB = mb(float64(total) / float64(len(r.stats)) / 2)
+	if res.SingleQueueMB > 0 {
+		res.Inflation = res.AvgBufferedMB / res.SingleQueueMB
+	}
+
+	log.Println("")
+	log.Printf("========== Routing (%s, %d queues) ==========", routeBy, len(r.queues))
+	log.Printf("  %-6s %12s %10s %10s %8s %14s %14s", "Queue", "Batch MB", "Messages", "MB", "Batches", "Peak batch MB", "Final MB")
+	for _, q := range r.stats {
+		log.Printf("  q%-5d %12.2f %10d %10.2f %8d %14.2f %14.2f", q.Queue, mb(float64(q.BatchSize)), q.Messages,
+			mb(float64(q.Bytes)), q.Batches, mb(float64(q.PeakBatchBytes)), mb(float64(q.FinalBytes)))
+	}
+	log.Printf("  Partial batches: avg %.1f, max %d of %d queues", res.AvgPartial, res.MaxPartial, len(r.queues))
+	log.Printf("  Buffered: avg %.2f MB, max %.2f MB (%.1fx a single queue's %.2f MB) | HeapAlloc avg %.2f MB, max %.2f MB",
+		res.AvgBufferedMB, res.MaxBufferedMB, res.Inflation, res.SingleQueueMB, res.AvgHeapAllocMB, res.MaxHeapAllocMB)
+	log.Println("=================================================")
+
+	path := layout.File("route", "route", "json")
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("Failed to save routing report: %v", err)
+	} else {
+		log.Printf("Routing report saved to: %s", path)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+
+	"pulsar-memory-test/pkg/logging"
+)
+
+// Sink 模拟下游系统，处理后的批次数据写入其中
+type Sink interface {
+	Write(ctx context.Context, batch []byte) error
+	Close() error
+}
+
+// blackholeSink 丢弃所有数据
+type blackholeSink struct{}
+
+func (blackholeSink) Write(context.Context, []byte) error { return nil }
+func (blackholeSink) Close() error                        { return nil }
+
+// fileSink 顺序写入本地文件，启动时截断
+type fileSink struct {
+	f *os.File
+}
+
+func (s *fileSink) Write(_ context.Context, batch []byte) error {
+	_, err := s.f.Write(batch)
+	return err
+}
+
+func (s *fileSink) Close() error { return s.f.Close() }
+
+// httpSink 每个批次 POST 一次，非 2xx 视为失败
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Write(ctx context.Context, batch []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sink: http status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error { return nil }
+
+// errInjected 由 -sink-failure-rate 注入的失败
+var errInjected = errors.New("sink: injected failure")
+
+// SinkConfig 下游模拟配置
+type SinkConfig struct {
+	Kind         string // blackhole|file|http
+	Path         string
+	URL          string
+	Latency      time.Duration // 每次写入附加的延迟
+	FailureRate  float64       // 每次写入注入失败的概率
+	MaxRetries   int
+	RetryBackoff time.Duration // 首次重试等待，之后每次翻倍
+}
+
+// NewSink 按配置创建 Sink
+func NewSink(cfg SinkConfig) (Sink, error) {
+	switch cfg.Kind {
+	case "blackhole":
+		return blackholeSink{}, nil
+	case "file":
+		f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{f: f}, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("sink: http requires -sink-url")
+		}
+		return &httpSink{url: cfg.URL, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q", cfg.Kind)
+	}
+}
+
+// sinkWriter 在 Sink 之上叠加延迟、故障注入和重试，并统计结果，仅由处理 goroutine 调用
+type sinkWriter struct {
+	SinkConfig
+	sink Sink
+	rng  *rand.Rand
+
+	batches  int64
+	bytes    int64
+	retries  int64
+	failures int64 // 重试耗尽后仍失败的批次
+	total    time.Duration
+	max      time.Duration
+}
+
+func newSinkWriter(cfg SinkConfig, sink Sink) *sinkWriter {
+	return &sinkWriter{
+		SinkConfig: cfg,
+		sink:       sink,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (w *sinkWriter) writeOnce(ctx context.Context, batch []byte) error {
+	if w.Latency > 0 {
+		time.Sleep(w.Latency)
+	}
+	if w.FailureRate > 0 && w.rng.Float64() < w.FailureRate {
+		return errInjected
+	}
+	return w.sink.Write(ctx, batch)
+}
+
+// Deliver 写入一个批次，失败时按退避重试；重试期间 batch 一直被持有，模拟重试缓冲
+func (w *sinkWriter) Deliver(ctx context.Context, batch []byte) error {
+	start := time.Now()
+	backoff := w.RetryBackoff
+	err := w.writeOnce(ctx, batch)
+	for attempt := 0; err != nil && attempt < w.MaxRetries && ctx.Err() == nil; attempt++ {
+		w.retries++
+		logging.Debugf("Sink write attempt %d failed, retrying in %v: %v", attempt+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		err = w.writeOnce(ctx, batch)
+	}
+
+	d := time.Since(start)
+	w.total += d
+	if d > w.max {
+		w.max = d
+	}
+	if err != nil {
+		w.failures++
+		return err
+	}
+	w.batches++
+	w.bytes += int64(len(batch))
+	return nil
+}
+
+// Close 关闭下游并打印统计
+func (w *sinkWriter) Close() {
+	if err := w.sink.Close(); err != nil {
+		log.Printf("Sink close error: %v", err)
+	}
+	var avg time.Duration
+	if n := w.batches + w.failures; n > 0 {
+		avg = w.total / time.Duration(n)
+	}
+	log.Printf("Sink (%s): %d batches, %.2f MB delivered, %d retries, %d failed | write avg %v, max %v",
+		w.Kind, w.batches, float64(w.bytes)/1024/1024, w.retries, w.failures,
+		avg.Round(time.Millisecond), w.max.Round(time.Millisecond))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/watchdog"
+)
+
+// activity 记录最后一次收到消息的时间，供 /healthz 和 -stall-timeout 使用
+var activity *watchdog.Watchdog
+
+// newStallWatchdog 创建 watchdog: 空闲超过 -stall-timeout 且订阅仍有 backlog 时，
+// 保存 goroutine 调用栈并以 stalled 状态退出；-fanout 时任一订阅有 backlog 即算；
+// -topics-pattern 时无法查询单个 backlog，空闲即视为卡住
+func newStallWatchdog(a *app.App) *watchdog.Watchdog {
+	var pending watchdog.PendingFunc
+	if *topicsPattern == "" {
+		client := admin.New(*adminURL)
+		pending = func(ctx context.Context) (bool, string, error) {
+			stats, err := client.Stats(ctx, *topic)
+			if err != nil {
+				return false, "", err
+			}
+			var backlog int64
+			for _, name := range subscriptionNames() {
+				sub, ok := stats.Subscriptions[name]
+				if !ok {
+					return false, "", fmt.Errorf("subscription %q not found on %s", name, *topic)
+				}
+				backlog += sub.MsgBacklog
+			}
+			return backlog > 0, fmt.Sprintf("%d messages in backlog of %s", backlog, strings.Join(subscriptionNames(), ",")), nil
+		}
+	}
+	return a.Watchdog(*stallTimeout, pending)
+}
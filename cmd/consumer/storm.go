@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// redeliveryStorm 每隔 interval 把此前故意留下未确认的消息一次性 NackID，制造可控的重投递风暴。
+// Go 客户端没有 AckTimeout，也没有公开的 RedeliverUnackedMessages，因此由这里记录未确认的
+// MessageID (-ack-ratio < 1 且 -skip-action=leave 时跳过的消息)，风暴时统一 Nack，
+// 它们在 -nack-delay 之后一起回到消费者
+type redeliveryStorm struct {
+	consumer pulsar.Consumer
+	monitor  *metrics.MemoryMonitor
+
+	mu      sync.Mutex
+	pending []pulsar.MessageID // 上次风暴之后留下未确认的消息
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newRedeliveryStorm 创建并启动风暴 goroutine，结束时调用 close
+func newRedeliveryStorm(consumer pulsar.Consumer, monitor *metrics.MemoryMonitor, interval time.Duration) *redeliveryStorm {
+	s := &redeliveryStorm{
+		consumer: consumer,
+		monitor:  monitor,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+// track 记录一条留下未确认的消息，下一次风暴时 Nack
+func (s *redeliveryStorm) track(id pulsar.MessageID) {
+	s.mu.Lock()
+	s.pending = append(s.pending, id)
+	s.mu.Unlock()
+}
+
+func (s *redeliveryStorm) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.fire()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// fire Nack 此前留下的全部未确认消息
+func (s *redeliveryStorm) fire() {
+	s.mu.Lock()
+	ids := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	s.monitor.RecordStorm(int64(len(ids)))
+	for _, id := range ids {
+		s.consumer.NackID(id)
+	}
+	log.Printf("Redelivery storm: nacked %d unacked messages", len(ids))
+}
+
+// close 停止风暴；最后一次风暴之后留下的消息保持未确认
+func (s *redeliveryStorm) close() {
+	close(s.stop)
+	<-s.done
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/trace"
+)
+
+// traceRecorder 把收到的消息元数据写入轨迹文件，供生产端 -trace 回放；仅由消费循环调用
+type traceRecorder struct {
+	w          *trace.Writer
+	path       string
+	byReceive  bool // 按接收时间而不是发布时间记录
+	failed     bool
+	firstError error
+}
+
+// recorder -record-trace 未开启时为 nil
+var recorder *traceRecorder
+
+func newTraceRecorder(path, timeSource string) (*traceRecorder, error) {
+	if timeSource != "publish" && timeSource != "receive" {
+		return nil, fmt.Errorf("unknown time source %q: want publish or receive", timeSource)
+	}
+	w, err := trace.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &traceRecorder{w: w, path: path, byReceive: timeSource == "receive"}, nil
+}
+
+// Record 记录一条消息，写入失败后停止记录，r 为 nil 时不做任何事
+func (r *traceRecorder) Record(msg pulsar.Message) {
+	if r == nil || r.failed {
+		return
+	}
+	t := msg.PublishTime()
+	if r.byReceive || t.IsZero() {
+		t = time.Now()
+	}
+	if err := r.w.Write(t, len(msg.Payload()), msg.Key(), msg.Topic()); err != nil {
+		r.failed, r.firstError = true, err
+		log.Printf("Trace recording stopped: %v", err)
+	}
+}
+
+// Close 关闭轨迹文件并打印记录数
+func (r *traceRecorder) Close() {
+	if r == nil {
+		return
+	}
+	if err := r.w.Close(); err != nil && r.firstError == nil {
+		r.firstError = err
+	}
+	if r.firstError != nil {
+		log.Printf("Trace %s incomplete (%d records): %v", r.path, r.w.Count(), r.firstError)
+		return
+	}
+	log.Printf("Trace saved to: %s (%d records)", r.path, r.w.Count())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// expiry 非 nil 时 (-ttl-lag) 第一个批次之后故意落后于 namespace 的消息 TTL
+var expiry *ttlExpiry
+
+// ttlExpiry 第一个批次处理完后停止接收 lag，让订阅的积压超过 TTL，再通过 admin API 立即过期
+// (broker 自身的 TTL 检查默认每 5 分钟一次，时机不可控)，之后继续消费。
+// 过期直接移动订阅的 mark-delete 位置: 已预取到 receiver queue 的消息照常交付，确认空洞随之消失，
+// 留下未确认或 Nack 的过期消息不再重投递
+type ttlExpiry struct {
+	admin   *admin.Client
+	monitor *metrics.MemoryMonitor
+	sub     string
+	ttl     time.Duration
+	lag     time.Duration
+
+	started bool
+	at      metrics.MemoryStats // 过期前采集的样本，未过期时为零值
+	result  ttlResult
+}
+
+// ttlResult 写入 ttl_<scenario>.json
+type ttlResult struct {
+	TTLSeconds       float64   `json:"ttl_seconds"`
+	LagSeconds       float64   `json:"lag_seconds"`
+	ExpiredAt        time.Time `json:"expired_at"`
+	ReceivedBefore   int64     `json:"received_before"` // 过期前处理的消息数
+	BacklogBefore    int64     `json:"backlog_before"`
+	BacklogAfter     int64     `json:"backlog_after"`
+	Expired          int64     `json:"expired"` // 订阅 totalMsgExpired 的增量
+	AckHolesBefore   int       `json:"ack_holes_before"`
+	AckHolesAfter    int       `json:"ack_holes_after"`
+	ReceivedAfter    int64     `json:"received_after"` // 过期后处理的消息数，多为过期前已预取的
+	RedeliveredAfter int64     `json:"redelivered_after"`
+	FinalBacklog     int64     `json:"final_backlog"`
+	FinalAckHoles    int       `json:"final_ack_holes"`
+	HeapAtExpiry     uint64    `json:"heap_at_expiry"`
+	RSSAtExpiry      uint64    `json:"rss_at_expiry"`
+	MaxHeapAfter     uint64    `json:"max_heap_after"`
+	MaxRSSAfter      uint64    `json:"max_rss_after"`
+}
+
+// newTTLExpiry 读取 -topic 所在 namespace 的消息 TTL，未设置时 ttl 为 0
+func newTTLExpiry(ctx context.Context, monitor *metrics.MemoryMonitor, sub string, lag time.Duration) (*ttlExpiry, error) {
+	client := admin.New(*adminURL)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	ttl, err := client.MessageTTL(ctx, *topic)
+	if err != nil {
+		return nil, err
+	}
+	return &ttlExpiry{admin: client, monitor: monitor, sub: sub, ttl: ttl, lag: lag}, nil
+}
+
+// afterBatch 在第一个批次之后停止接收 lag 并触发过期，之后的批次直接返回
+func (e *ttlExpiry) afterBatch(ctx context.Context) {
+	if e.started {
+		return
+	}
+	e.started = true
+	e.result.ReceivedBefore, _, _ = e.monitor.GetCurrentStats()
+	log.Printf("TTL expiry: pausing %v so the backlog ages past the %v TTL...", e.lag, e.ttl)
+	e.monitor.RecordChange("receive", "running", "paused", fmt.Sprintf("ttl expiry: let the backlog age %v", e.lag))
+	region := e.monitor.BeginRegion("ttl-lag")
+	select {
+	case <-time.After(e.lag):
+	case <-ctx.Done():
+	}
+	region.End()
+	e.monitor.RecordChange("receive", "paused", "running", "ttl expiry")
+	if ctx.Err() == nil {
+		e.expire(ctx)
+	}
+}
+
+// expire 让订阅过期早于 TTL 的消息，并记录前后的 backlog 和确认空洞
+func (e *ttlExpiry) expire(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	before, err := e.admin.Subscription(ctx, *topic, e.sub)
+	if err != nil {
+		log.Printf("TTL expiry: failed to read subscription stats: %v", err)
+		return
+	}
+	at := e.monitor.Collect()
+	if err := e.admin.ExpireMessages(ctx, *topic, e.sub, e.ttl); err != nil {
+		log.Printf("TTL expiry: failed to expire messages: %v", err)
+		return
+	}
+	e.monitor.RecordChange("subscription.expire-messages", "", e.ttl.String(), "ttl expiry: expire messages older than the topic TTL")
+	after, err := e.admin.Subscription(ctx, *topic, e.sub)
+	if err != nil {
+		log.Printf("TTL expiry: failed to read subscription stats: %v", err)
+		return
+	}
+	e.at = at
+	r := &e.result
+	r.ExpiredAt = at.Timestamp
+	r.BacklogBefore, r.BacklogAfter = before.MsgBacklog, after.MsgBacklog
+	r.AckHolesBefore, r.AckHolesAfter = before.AckHoles, after.AckHoles
+	r.Expired = after.MsgExpired - before.MsgExpired
+	r.HeapAtExpiry, r.RSSAtExpiry = at.HeapAlloc, at.RSS
+	log.Printf("TTL expiry: %d messages expired, backlog %d -> %d, ack holes %d -> %d",
+		r.Expired, r.BacklogBefore, r.BacklogAfter, r.AckHolesBefore, r.AckHolesAfter)
+}
+
+// report 消费结束时 (订阅仍存在) 汇总过期之后的消费、重投递和内存，打印并写入 ttl_<scenario>.json
+func (e *ttlExpiry) report(layout *results.Layout) {
+	r := &e.result
+	r.TTLSeconds, r.LagSeconds = e.ttl.Seconds(), e.lag.Seconds()
+	if e.at.Timestamp.IsZero() {
+		log.Printf("TTL expiry: messages were not expired (the run ended before or during the lag)")
+	} else {
+		final := e.monitor.Collect()
+		r.ReceivedAfter = final.MessageCount - e.at.MessageCount
+		r.RedeliveredAfter = final.RedeliveryCount - e.at.RedeliveryCount
+		for _, s := range e.monitor.GetStats() {
+			if s.Timestamp.After(e.at.Timestamp) {
+				r.MaxHeapAfter = max(r.MaxHeapAfter, s.HeapAlloc)
+				r.MaxRSSAfter = max(r.MaxRSSAfter, s.RSS)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if sub, err := e.admin.Subscription(ctx, *topic, e.sub); err != nil {
+			log.Printf("TTL expiry: failed to read subscription stats: %v", err)
+		} else {
+			r.FinalBacklog, r.FinalAckHoles = sub.MsgBacklog, sub.AckHoles
+		}
+	}
+
+	mb := func(v uint64) float64 { return float64(v) / 1024 / 1024 }
+	log.Println("")
+	log.Printf("========== TTL expiry (TTL %v, lag %v) ==========", e.ttl, e.lag)
+	log.Printf("  Received: %d before expiry, %d after (%d redelivered)", r.ReceivedBefore, r.ReceivedAfter, r.RedeliveredAfter)
+	log.Printf("  Backlog: %d -> %d at expiry (%d expired), %d at end", r.BacklogBefore, r.BacklogAfter, r.Expired, r.FinalBacklog)
+	log.Printf("  Ack holes: %d -> %d at expiry, %d at end", r.AckHolesBefore, r.AckHolesAfter, r.FinalAckHoles)
+	log.Printf("  Memory: heap %.2f MB, RSS %.2f MB at expiry; max after: heap %.2f MB, RSS %.2f MB",
+		mb(r.HeapAtExpiry), mb(r.RSSAtExpiry), mb(r.MaxHeapAfter), mb(r.MaxRSSAfter))
+	log.Println("=================================================")
+
+	path := layout.File("ttl", "ttl", "json")
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("Failed to save TTL report: %v", err)
+	} else {
+		log.Printf("TTL report saved to: %s", path)
+	}
+}
+
+// validateTTLLag 检查 namespace TTL 已设置且短于 lag，否则暂停后没有消息会过期
+func validateTTLLag(ttl, lag time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("-ttl-lag: no message TTL on the namespace of %s, set one with scripts/set-ttl.sh", *topic)
+	}
+	if ttl >= lag {
+		return fmt.Errorf("-ttl-lag %v must exceed the namespace message TTL %v", lag, ttl)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// entities 在一个进程中分阶段创建成千上万个轻量的 producer 或 consumer，分布在多个 topic 上，
+// 每个阶段之后 GC 并测量，报告每个实体的增量内存 (堆、RSS、goroutine)。
+//
+// 用法: entities -kind=consumer -count=5000 -topics=500 -stages=10
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/precheck"
+	"pulsar-memory-test/pkg/results"
+)
+
+const (
+	kindProducer = "producer"
+	kindConsumer = "consumer"
+)
+
+var (
+	pulsarURL         = flag.String("url", "pulsar://localhost:6650", "Pulsar service URL: a broker, or a Pulsar proxy (lookups then route through the proxy)")
+	listenerName      = flag.String("listener-name", "", "Listener name for brokers with advertisedListeners (e.g. internal/external behind a Kubernetes load balancer): lookups return that listener's address (empty = the default listener)")
+	kind              = flag.String("kind", kindConsumer, "Entities to create: producer or consumer")
+	count             = flag.Int("count", 1000, "Total number of producers/consumers to create")
+	topicCount        = flag.Int("topics", 100, "Number of topics <topic-prefix>-0..N-1 the entities are spread across round-robin")
+	topicPrefix       = flag.String("topic-prefix", "persistent://public/default/entities", "Topic name prefix")
+	stages            = flag.Int("stages", 10, "Create the entities in this many equal stages, measuring memory after each")
+	stageHold         = flag.Duration("stage-hold", 5*time.Second, "Wait this long after each stage before measuring, so background work (lookups, flow permits, timers) settles")
+	createConcurrency = flag.Int("create-concurrency", 16, "Entities created (and closed) concurrently within a stage")
+	subscription      = flag.String("sub", "entities", "Consumers: subscription name, shared by all consumers of a topic")
+	subType           = flag.String("sub-type", "shared", "Consumers: subscription type (shared, key_shared, failover, or exclusive with at most one consumer per topic)")
+	queueSize         = flag.Int("queue-size", 0, "Consumers: ReceiverQueueSize (0 = client default 1000)")
+	batching          = flag.Bool("batching", true, "Producers: enable batching")
+	maxPending        = flag.Int("max-pending", 0, "Producers: MaxPendingMessages (0 = client default)")
+	messages          = flag.Int("messages", 0, "Producers: messages each producer sends right after creation, to include lazily allocated send state (0 = idle producers)")
+	messageSize       = flag.Int("size", 1024, "Producers: size of the -messages payloads")
+	opTimeout         = flag.Duration("operation-timeout", 30*time.Second, "OperationTimeout: producer-create, subscribe and lookup requests are retried (100ms backoff, doubling) until this timeout")
+	connTimeout       = flag.Duration("connection-timeout", 30*time.Second, "ConnectionTimeout: TCP connect timeout to a broker")
+	keepAlive         = flag.Duration("keep-alive", 0, "KeepAliveInterval: ping interval; a connection with no data from the broker for two intervals is closed (0 = client default 30s)")
+	maxConns          = flag.Int("max-connections-per-broker", 0, "Connection pool: MaxConnectionsPerBroker, connections opened to each broker, producers/consumers spread across them (0 = client default 1)")
+	connMaxIdle       = flag.Duration("connection-max-idle", 0, "Connection pool: ConnectionMaxIdleTime, close a connection unused for this long (0 = client default 3m, minimum 1m, negative = never)")
+	memoryLimit       = flag.Int64("memory-limit", 0, "Client memory limit in bytes (0 = client default 64MB)")
+	pprofPort         = flag.Int("pprof-port", 6080, "pprof HTTP server port")
+	outputDir         = flag.String("output", "./results", "Output directory")
+	scenario          = flag.String("scenario", "", "Test scenario name for output files (empty = generated from -kind and -count plus the start time, e.g. entities-consumer-1000-20261015-130405)")
+	precheckFlag      = flag.Bool("precheck", true, "Before connecting, check broker reachability, free disk in the output dir and the open-files limit; exit on failures")
+	force             = flag.Bool("force", false, "Overwrite the results of an earlier run with the same -scenario (and -run-id with -layout=run) instead of refusing to start")
+	layoutMode        = flag.String("layout", "flat", "Results layout: flat (<output>/entities_<scenario>.json) or run (<output>/<scenario>/<run-id>/ with manifest.json)")
+	runID             = flag.String("run-id", "", "Run ID for -layout=run (default: current time, printed at start)")
+	labels            = flag.String("labels", "", "Labels attached to the stats, result.json and manifest.json, as comma-separated key=value pairs")
+	trackPIDs         = flag.String("track-pids", "", "Comma-separated [name=]pid of co-located processes (e.g. a local Pulsar standalone or proxy) whose RSS is sampled with this process's, reported per process and as a total in the stats")
+	logLevel          = flag.String("log-level", "info", "Log level: debug, info, warn or error")
+)
+
+var subscriptionType pulsar.SubscriptionType
+
+func main() {
+	flag.Parse()
+
+	if *scenario == "" {
+		*scenario = app.AutoScenario("entities", *kind, strconv.Itoa(*count))
+	}
+	a, err := app.New(app.Options{
+		Program:   "entities",
+		LogLevel:  *logLevel,
+		Layout:    *layoutMode,
+		OutputDir: *outputDir,
+		Scenario:  *scenario,
+		RunID:     *runID,
+		Force:     *force,
+		Labels:    *labels,
+		TrackPIDs: *trackPIDs,
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer a.Close()
+	defer a.Recover()
+	layout := a.Layout
+
+	if *kind != kindProducer && *kind != kindConsumer {
+		log.Fatalf("Invalid -kind %q: must be producer or consumer", *kind)
+	}
+	if *count < 1 || *topicCount < 1 || *stages < 1 || *createConcurrency < 1 {
+		log.Fatalf("-count, -topics, -stages and -create-concurrency must be >= 1")
+	}
+	if *stages > *count {
+		log.Fatalf("-stages %d is more than -count %d", *stages, *count)
+	}
+	if subscriptionType, err = parseSubscriptionType(*subType); err != nil {
+		log.Fatalf("Invalid -sub-type: %v", err)
+	}
+	if *kind == kindConsumer && subscriptionType == pulsar.Exclusive && *count > *topicCount {
+		log.Fatalf("-sub-type=exclusive allows one consumer per topic: -count %d exceeds -topics %d", *count, *topicCount)
+	}
+
+	a.ServeDiagnostics(fmt.Sprintf("localhost:%d", *pprofPort))
+
+	log.Println("========== Entities Config ==========")
+	log.Printf("  URL: %s", *pulsarURL)
+	if *listenerName != "" {
+		log.Printf("  Listener: %s", *listenerName)
+	}
+	log.Printf("  Entities: %d %ss across %d topics (%s-0..%d)", *count, *kind, *topicCount, *topicPrefix, *topicCount-1)
+	log.Printf("  Stages: %d, hold %v, create concurrency %d", *stages, *stageHold, *createConcurrency)
+	if *kind == kindConsumer {
+		log.Printf("  Subscription: %s (%s), queue size %d (0=default)", *subscription, *subType, *queueSize)
+	} else {
+		log.Printf("  Batching: %v, max pending %d (0=default), %d messages of %d bytes each", *batching, *maxPending, *messages, *messageSize)
+	}
+	log.Printf("  Memory limit: %d bytes", *memoryLimit)
+	log.Printf("  Connections per broker: %d (0=default 1), max idle: %v (0=default)", *maxConns, *connMaxIdle)
+	log.Printf("  Operation timeout: %v, connection timeout: %v, keep-alive: %v (0=default)", *opTimeout, *connTimeout, *keepAlive)
+	log.Printf("  Results: %s", layout.Dir)
+	log.Println("=====================================")
+
+	if *precheckFlag {
+		a.Precheck(context.Background(), precheck.Config{ServiceURL: *pulsarURL})
+	}
+
+	monitor, err := a.NewMonitor()
+	if err != nil {
+		a.Exit(results.StatusError, "%v", err)
+	}
+	monitor.Start(context.Background(), time.Second)
+
+	client, err := pulsar.NewClient(pulsar.ClientOptions{
+		URL:               *pulsarURL,
+		ListenerName:      *listenerName,
+		OperationTimeout:  *opTimeout,
+		ConnectionTimeout: *connTimeout,
+		KeepAliveInterval: *keepAlive,
+		MetricsRegisterer: a.ClientMetrics.Registerer(),
+		MemoryLimitBytes:  *memoryLimit,
+
+		MaxConnectionsPerBroker: *maxConns,
+		ConnectionMaxIdleTime:   *connMaxIdle,
+	})
+	if err != nil {
+		a.Exit(results.StatusBrokerError, "failed to create Pulsar client: %v", err)
+	}
+	defer client.Close()
+
+	r := &ramp{client: client, monitor: monitor, goroutines: layout.File("profile", "goroutines", "txt")}
+	for i := range *topicCount {
+		r.topics = append(r.topics, fmt.Sprintf("%s-%d", *topicPrefix, i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := app.Signals()
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	rep := &Report{Kind: *kind, Topics: *topicCount, Target: *count}
+	r.run(ctx, rep)
+	monitor.Stop()
+	printReport(rep)
+
+	path := layout.File("entities", "entities", "json")
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("Failed to save entities report: %v", err)
+	} else {
+		log.Printf("Entities report saved to: %s", path)
+	}
+	statsPath := layout.File("stats", "stats", "json")
+	if err := monitor.SaveToFile(statsPath); err != nil {
+		log.Printf("Failed to save stats: %v", err)
+	} else {
+		log.Printf("Stats saved to: %s", statsPath)
+	}
+
+	status, reason := results.StatusOK, ""
+	created := 0
+	if n := len(rep.Stages); n > 0 {
+		created = rep.Stages[n-1].Entities
+	}
+	if created < *count {
+		status, reason = results.StatusBrokerError, fmt.Sprintf("created %d of %d %ss", created, *count, *kind)
+	}
+	a.WriteResult(status, reason, map[string]float64{
+		"entities":              float64(created),
+		"heap_per_entity":       rep.HeapPerEntity,
+		"rss_per_entity":        rep.RSSPerEntity,
+		"goroutines_per_entity": rep.GoroutinesPerEntity,
+	})
+	if err := layout.WriteManifest("entities", monitor.GetMetadata()); err != nil {
+		log.Printf("Failed to write manifest: %v", err)
+	}
+	a.Finish()
+	if code := status.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// parseSubscriptionType 解析 -sub-type 参数
+func parseSubscriptionType(s string) (pulsar.SubscriptionType, error) {
+	switch s {
+	case "exclusive":
+		return pulsar.Exclusive, nil
+	case "shared":
+		return pulsar.Shared, nil
+	case "failover":
+		return pulsar.Failover, nil
+	case "key_shared":
+		return pulsar.KeyShared, nil
+	default:
+		return pulsar.Shared, fmt.Errorf("unknown subscription type %q", s)
+	}
+}
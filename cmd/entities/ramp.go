@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// entity 一个 producer 或 consumer
+type entity interface {
+	Close()
+}
+
+// Stage 分阶段爬升中的一个阶段，内存在本阶段的实体全部创建、保持 -stage-hold 并 GC 之后测量
+type Stage struct {
+	Stage    int   `json:"stage"`
+	Entities int   `json:"entities"` // 本阶段结束时存活的实体总数
+	Added    int   `json:"added"`
+	Failed   int   `json:"failed"`
+	CreateMs int64 `json:"create_ms"`
+
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapObjects uint64 `json:"heap_objects"`
+	RSS         uint64 `json:"rss"`
+	Goroutines  int    `json:"goroutines"`
+
+	// 相对上一阶段的增量除以本阶段新增的实体数
+	HeapPerEntity       float64 `json:"heap_per_entity"`
+	RSSPerEntity        float64 `json:"rss_per_entity"`
+	GoroutinesPerEntity float64 `json:"goroutines_per_entity"`
+}
+
+// Footprint 某一时刻 GC 之后的内存
+type Footprint struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapObjects uint64 `json:"heap_objects"`
+	RSS         uint64 `json:"rss"`
+	Goroutines  int    `json:"goroutines"`
+}
+
+// Report -kind 实体的爬升结果，写入 entities_<scenario>.json
+type Report struct {
+	Kind     string     `json:"kind"`
+	Topics   int        `json:"topics"`
+	Target   int        `json:"target"`
+	Baseline Footprint  `json:"baseline"` // 客户端创建之后、第一个实体之前
+	Stages   []Stage    `json:"stages"`
+	Closed   *Footprint `json:"closed,omitempty"` // 全部实体关闭之后，明显高于 Baseline 说明关闭路径有残留
+
+	// 最后一个阶段相对 Baseline 的平均值
+	HeapPerEntity       float64 `json:"heap_per_entity"`
+	RSSPerEntity        float64 `json:"rss_per_entity"`
+	GoroutinesPerEntity float64 `json:"goroutines_per_entity"`
+	CloseMs             int64   `json:"close_ms"`
+}
+
+// ramp 按阶段创建实体，阶段内用 -create-concurrency 个 goroutine 并发创建
+type ramp struct {
+	client  pulsar.Client
+	monitor *metrics.MemoryMonitor
+	topics  []string
+	// goroutines 关闭实体前写入 goroutine 调用栈的路径
+	goroutines string
+
+	mu       sync.Mutex
+	entities []entity
+}
+
+// topicOf 第 i 个实体所在的 topic，实体按序号轮流分配到各 topic
+func (r *ramp) topicOf(i int) string {
+	return r.topics[i%len(r.topics)]
+}
+
+// create 创建第 i 个实体
+func (r *ramp) create(i int) (entity, error) {
+	topic := r.topicOf(i)
+	if *kind == kindConsumer {
+		return r.client.Subscribe(pulsar.ConsumerOptions{
+			Topic:                       topic,
+			SubscriptionName:            *subscription,
+			Type:                        subscriptionType,
+			SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+			ReceiverQueueSize:           *queueSize,
+		})
+	}
+	p, err := r.client.CreateProducer(pulsar.ProducerOptions{
+		Topic:              topic,
+		DisableBatching:    !*batching,
+		MaxPendingMessages: *maxPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 发送之后 producer 才分配批次缓冲区等按需创建的结构
+	for j := 0; j < *messages; j++ {
+		if _, err := p.Send(context.Background(), &pulsar.ProducerMessage{Payload: make([]byte, *messageSize)}); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("send: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// stage 创建序号 [from, to) 的实体，返回失败数；ctx 取消后不再创建新的实体
+func (r *ramp) stage(ctx context.Context, from, to int) (failed int) {
+	next := atomic.Int64{}
+	next.Store(int64(from))
+	var errs atomic.Int64
+	var logged atomic.Bool
+	var wg sync.WaitGroup
+	for range min(*createConcurrency, to-from) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= to {
+					return
+				}
+				e, err := r.create(i)
+				if err != nil {
+					errs.Add(1)
+					// 同一原因通常会让整批失败，只打印第一条
+					if logged.CompareAndSwap(false, true) {
+						log.Printf("Failed to create %s %d on %s: %v", *kind, i, r.topicOf(i), err)
+					}
+					continue
+				}
+				r.mu.Lock()
+				r.entities = append(r.entities, e)
+				r.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return int(errs.Load())
+}
+
+// close 并发关闭全部实体
+func (r *ramp) close() {
+	r.mu.Lock()
+	entities := r.entities
+	r.entities = nil
+	r.mu.Unlock()
+	ch := make(chan entity)
+	var wg sync.WaitGroup
+	for range *createConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range ch {
+				e.Close()
+			}
+		}()
+	}
+	for _, e := range entities {
+		ch <- e
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// live 存活的实体数
+func (r *ramp) live() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entities)
+}
+
+// footprint GC 两次后测量；第二次 GC 回收第一次 GC 时才可回收的 finalizer 对象
+func (r *ramp) footprint() Footprint {
+	runtime.GC()
+	runtime.GC()
+	s := r.monitor.Collect()
+	return Footprint{HeapAlloc: s.HeapAlloc, HeapObjects: s.HeapObjects, RSS: s.RSS, Goroutines: runtime.NumGoroutine()}
+}
+
+// run 分 -stages 个阶段创建 -count 个实体，每个阶段记录为一个 region；
+// ctx 取消 (收到信号) 时停在当前阶段
+func (r *ramp) run(ctx context.Context, rep *Report) {
+	rep.Baseline = r.footprint()
+	prev := rep.Baseline
+	n, s := *count, *stages
+	for k := range s {
+		from, to := k*n/s, (k+1)*n/s
+		if from == to {
+			continue
+		}
+		log.Printf("========== Stage %d/%d: %s %d-%d ==========", k+1, s, *kind, from, to-1)
+		region := r.monitor.BeginRegion(fmt.Sprintf("stage-%d", k+1))
+		start := time.Now()
+		before := r.live()
+		failed := r.stage(ctx, from, to)
+		st := Stage{Stage: k + 1, Failed: failed, CreateMs: time.Since(start).Milliseconds()}
+		st.Entities = r.live()
+		st.Added = st.Entities - before
+		select {
+		case <-time.After(*stageHold):
+		case <-ctx.Done():
+		}
+		region.End()
+
+		fp := r.footprint()
+		st.HeapAlloc, st.HeapObjects, st.RSS, st.Goroutines = fp.HeapAlloc, fp.HeapObjects, fp.RSS, fp.Goroutines
+		if st.Added > 0 {
+			added := float64(st.Added)
+			st.HeapPerEntity = (float64(fp.HeapAlloc) - float64(prev.HeapAlloc)) / added
+			st.RSSPerEntity = (float64(fp.RSS) - float64(prev.RSS)) / added
+			st.GoroutinesPerEntity = float64(fp.Goroutines-prev.Goroutines) / added
+		}
+		prev = fp
+		rep.Stages = append(rep.Stages, st)
+		log.Printf("Stage %d: %d %ss (+%d, %d failed) in %v | heap %.2f MB (%.1f KB/entity), RSS %.2f MB (%.1f KB/entity), %d goroutines (%.1f/entity)",
+			st.Stage, st.Entities, *kind, st.Added, st.Failed, time.Duration(st.CreateMs)*time.Millisecond,
+			float64(st.HeapAlloc)/1024/1024, st.HeapPerEntity/1024, float64(st.RSS)/1024/1024, st.RSSPerEntity/1024,
+			st.Goroutines, st.GoroutinesPerEntity)
+
+		if ctx.Err() != nil {
+			log.Println("Received signal, stopping ramp-up...")
+			break
+		}
+		if st.Added == 0 {
+			log.Printf("Stage %d created no %ss, stopping ramp-up", st.Stage, *kind)
+			break
+		}
+	}
+
+	if n := len(rep.Stages); n > 0 {
+		last := rep.Stages[n-1]
+		if last.Entities > 0 {
+			total := float64(last.Entities)
+			rep.HeapPerEntity = (float64(last.HeapAlloc) - float64(rep.Baseline.HeapAlloc)) / total
+			rep.RSSPerEntity = (float64(last.RSS) - float64(rep.Baseline.RSS)) / total
+			rep.GoroutinesPerEntity = float64(last.Goroutines-rep.Baseline.Goroutines) / total
+		}
+	}
+
+	if err := r.monitor.DumpGoroutines(r.goroutines); err != nil {
+		log.Printf("Failed to dump goroutines: %v", err)
+	} else {
+		log.Printf("Goroutine stacks saved to: %s", r.goroutines)
+	}
+
+	log.Printf("Closing %d %ss...", r.live(), *kind)
+	start := time.Now()
+	r.close()
+	rep.CloseMs = time.Since(start).Milliseconds()
+	closed := r.footprint()
+	rep.Closed = &closed
+}
+
+// printReport 打印各阶段的增量
+func printReport(rep *Report) {
+	mb := func(v uint64) float64 { return float64(v) / 1024 / 1024 }
+	log.Println("")
+	log.Printf("========== %s scalability (%d topics) ==========", *kind, rep.Topics)
+	log.Printf("  Baseline: heap %.2f MB, RSS %.2f MB, %d goroutines", mb(rep.Baseline.HeapAlloc), mb(rep.Baseline.RSS), rep.Baseline.Goroutines)
+	log.Printf("  %5s %9s %7s %9s %10s %10s %10s %10s %11s", "stage", "entities", "failed", "create s", "heap MB", "KB/entity", "RSS MB", "KB/entity", "goroutines")
+	for _, s := range rep.Stages {
+		log.Printf("  %5d %9d %7d %9.1f %10.2f %10.1f %10.2f %10.1f %11d", s.Stage, s.Entities, s.Failed, float64(s.CreateMs)/1000,
+			mb(s.HeapAlloc), s.HeapPerEntity/1024, mb(s.RSS), s.RSSPerEntity/1024, s.Goroutines)
+	}
+	log.Printf("  Per %s: heap %.1f KB, RSS %.1f KB, %.1f goroutines", *kind, rep.HeapPerEntity/1024, rep.RSSPerEntity/1024, rep.GoroutinesPerEntity)
+	if c := rep.Closed; c != nil {
+		log.Printf("  After closing all (%.1fs): heap %.2f MB (%+.2f MB vs baseline), %d goroutines (%+d)",
+			float64(rep.CloseMs)/1000, mb(c.HeapAlloc), (float64(c.HeapAlloc)-float64(rep.Baseline.HeapAlloc))/1024/1024,
+			c.Goroutines, c.Goroutines-rep.Baseline.Goroutines)
+	}
+	log.Println("=================================================")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+	"pulsar-memory-test/pkg/results"
+)
+
+// 消费循环检查结束条件和打印进度的间隔
+const (
+	checkInterval    = 100 * time.Millisecond
+	progressInterval = 5 * time.Second
+)
+
+// Report 一次生产+消费的结果，写入 loop_<scenario>.json
+type Report struct {
+	Target      int64   `json:"target"` // -messages
+	Sent        int64   `json:"sent"`   // 发送成功的消息
+	SendErrors  int64   `json:"send_errors"`
+	Received    int64   `json:"received"`
+	Corrupt     int64   `json:"corrupt"` // 头部或 CRC 校验失败
+	ProduceMs   int64   `json:"produce_ms"`
+	DurationMs  int64   `json:"duration_ms"` // 第一条发送到最后一条接收
+	SendRate    float64 `json:"send_rate"`   // msg/s
+	ReceiveRate float64 `json:"receive_rate"`
+	Interrupted bool    `json:"interrupted,omitempty"`
+
+	// -mode=rpc: Sent/Received 为请求和收到的回复，DurationMs 到最后一个回复
+	RPC *RPCStats `json:"rpc,omitempty"`
+}
+
+// run 一个 goroutine 按 -rate 发送 -messages 条消息，当前 goroutine 同时接收、校验并确认；
+// 收齐发送成功的消息、发送结束后 -idle-timeout 内没有新消息或 ctx 取消时返回
+func run(ctx context.Context, producer pulsar.Producer, consumer pulsar.Consumer, monitor *metrics.MemoryMonitor) *Report {
+	rep := &Report{Target: *messages}
+	var sent, sendErrors atomic.Int64
+	var produceDone atomic.Bool
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer produceDone.Store(true)
+		gen := payload.NewGenerator(payload.Config{Sizes: payload.Fixed(*messageSize), Header: true, Seed: start.UnixNano()}, 0)
+		for i := int64(0); i < *messages; i++ {
+			if *rate > 0 {
+				due := start.Add(time.Duration(float64(i) / *rate * float64(time.Second)))
+				if d := time.Until(due); d > 0 {
+					select {
+					case <-time.After(d):
+					case <-ctx.Done():
+					}
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			msg := &pulsar.ProducerMessage{Payload: gen.Build(*messageSize, 0, uint64(i), time.Now())}
+			producer.SendAsync(ctx, msg, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+				if err != nil {
+					sendErrors.Add(1)
+					return
+				}
+				sent.Add(1)
+			})
+		}
+		if err := producer.FlushWithCtx(ctx); err != nil {
+			log.Printf("Flush failed: %v", err)
+		}
+		rep.ProduceMs = time.Since(start).Milliseconds()
+	}()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	lastReceive, lastProgress := time.Now(), time.Now()
+	var end time.Time
+loop:
+	for {
+		select {
+		case cm := <-consumer.Chan():
+			now := time.Now()
+			lastReceive, end = now, now
+			rep.Received++
+			data := cm.Payload()
+			h, err := payload.Verify(data)
+			monitor.RecordVerification(err)
+			if err != nil {
+				rep.Corrupt++
+			} else {
+				monitor.RecordLatency(now.Sub(h.PublishTime))
+			}
+			monitor.RecordMessage(int64(len(data)))
+			consumer.Ack(cm.Message)
+			if produceDone.Load() && rep.Received >= sent.Load() {
+				break loop
+			}
+		case <-ticker.C:
+			if produceDone.Load() {
+				if rep.Received >= sent.Load() {
+					break loop
+				}
+				if time.Since(lastReceive) > *idleTimeout {
+					log.Printf("Nothing received for %v after the last send, stopping", *idleTimeout)
+					break loop
+				}
+			}
+			if time.Since(lastProgress) >= progressInterval {
+				lastProgress = time.Now()
+				log.Printf("Progress: sent %d (%d errors) | received %d | rate %.0f msg/s",
+					sent.Load(), sendErrors.Load(), rep.Received, float64(rep.Received)/time.Since(start).Seconds())
+			}
+		case <-ctx.Done():
+			rep.Interrupted = true
+			break loop
+		}
+	}
+	wg.Wait()
+
+	rep.Sent, rep.SendErrors = sent.Load(), sendErrors.Load()
+	if end.IsZero() {
+		end = time.Now()
+	}
+	rep.DurationMs = end.Sub(start).Milliseconds()
+	if rep.ProduceMs > 0 {
+		rep.SendRate = float64(rep.Sent) / (float64(rep.ProduceMs) / 1000)
+	}
+	if rep.DurationMs > 0 {
+		rep.ReceiveRate = float64(rep.Received) / (float64(rep.DurationMs) / 1000)
+	}
+	return rep
+}
+
+// evaluate 判定结论: 校验失败或少收为 verification_failure，发送失败为 broker_error
+func evaluate(rep *Report) (results.Status, string) {
+	switch {
+	case rep.Corrupt > 0:
+		return results.StatusVerification, fmt.Sprintf("%d corrupt messages", rep.Corrupt)
+	case rep.Interrupted:
+		return results.StatusError, "interrupted"
+	case rep.RPC != nil && rep.RPC.Timeouts > 0:
+		return results.StatusVerification, fmt.Sprintf("%d of %d requests got no reply within %v", rep.RPC.Timeouts, rep.Sent, *rpcTimeout)
+	case rep.Received < rep.Sent:
+		return results.StatusVerification, fmt.Sprintf("received %d of %d sent messages", rep.Received, rep.Sent)
+	case rep.SendErrors > 0:
+		return results.StatusBrokerError, fmt.Sprintf("%d sends failed", rep.SendErrors)
+	case rep.RPC != nil && rep.RPC.ReplyErrors > 0:
+		return results.StatusBrokerError, fmt.Sprintf("%d replies failed", rep.RPC.ReplyErrors)
+	}
+	return results.StatusOK, ""
+}
+
+// printReport 打印发送和接收的结果
+func printReport(rep *Report) {
+	log.Println("")
+	log.Println("========== Loop Summary ==========")
+	log.Printf("  Sent:      %d / %d (errors: %d) in %v, %.0f msg/s", rep.Sent, rep.Target, rep.SendErrors,
+		time.Duration(rep.ProduceMs)*time.Millisecond, rep.SendRate)
+	log.Printf("  Received:  %d (corrupt: %d) in %v, %.0f msg/s", rep.Received, rep.Corrupt,
+		time.Duration(rep.DurationMs)*time.Millisecond, rep.ReceiveRate)
+	if r := rep.RPC; r != nil {
+		log.Printf("  RPC (%s): %d timed out, %d late replies, max pending %d | served %d (reply errors: %d)",
+			r.Role, r.Timeouts, r.Late, r.MaxPending, r.Served, r.ReplyErrors)
+	}
+	if rep.Interrupted {
+		log.Printf("  Interrupted before all messages were consumed")
+	}
+	log.Println("==================================")
+}
@@ -0,0 +1,283 @@
+// loop 在一个进程中用同一个客户端对同一个 topic 同时生产和消费，对应既发布又订阅的服务；
+// 两端的客户端内存进入同一份样本和堆 profile，而不是分别在 producer、consumer 两个进程中测量。
+// -mode=rpc 为请求-回复: 每个请求带关联 ID，由 responder 回复到 -reply-topic，测量往返延迟和等待回复的 pending 表的内存。
+//
+// 用法: loop -messages=1000000 -size=1024 -rate=20000
+//
+//	loop -mode=rpc -messages=100000 -rpc-inflight=500
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+	"pulsar-memory-test/pkg/precheck"
+	"pulsar-memory-test/pkg/results"
+)
+
+var (
+	pulsarURL         = flag.String("url", "pulsar://localhost:6650", "Pulsar service URL: a broker, or a Pulsar proxy (lookups then route through the proxy)")
+	listenerName      = flag.String("listener-name", "", "Listener name for brokers with advertisedListeners (e.g. internal/external behind a Kubernetes load balancer): lookups return that listener's address (empty = the default listener)")
+	topic             = flag.String("topic", "persistent://public/default/memory-test-loop", "Topic produced to and consumed from")
+	subscription      = flag.String("sub", "loop", "Subscription name; created before the first send so every message is consumed")
+	mode              = flag.String("mode", modeStream, "stream (produce and consume -topic) or rpc (requests on -topic answered on -reply-topic, round-trip latency)")
+	replyTopic        = flag.String("reply-topic", "", "-mode=rpc: topic replies are sent to (empty = -topic with a -reply suffix)")
+	rpcRole           = flag.String("rpc-role", roleBoth, "-mode=rpc: both (requester and responder in this process), requester, or responder (start it before the requester)")
+	rpcInflight       = flag.Int("rpc-inflight", 100, "-mode=rpc: requests awaiting a reply at most, i.e. the size of the pending reply map")
+	rpcTimeout        = flag.Duration("rpc-timeout", 10*time.Second, "-mode=rpc: a request without a reply for this long is dropped from the pending map and counted as timed out")
+	messages          = flag.Int64("messages", 100000, "Messages to produce (and consume)")
+	messageSize       = flag.Int("size", 1024, "Message size in bytes (at least the 28-byte payload header)")
+	rate              = flag.Float64("rate", 0, "Produce at most this many messages per second (0 = as fast as the producer allows)")
+	receiverQueueSize = flag.Int("receiver-queue-size", 1000, "Consumer ReceiverQueueSize")
+	maxPending        = flag.Int("max-pending", 0, "Producer MaxPendingMessages (0 = client default 1000)")
+	batching          = flag.Bool("batching", true, "Producer batching")
+	memoryLimit       = flag.Int64("memory-limit", 0, "Client memory limit in bytes, shared by the producer and the consumer (0 = client default 64MB)")
+	idleTimeout       = flag.Duration("idle-timeout", 30*time.Second, "After the last send, stop if nothing is received for this long")
+	sampleInterval    = flag.Duration("sample-interval", time.Second, "Memory sampling interval")
+	opTimeout         = flag.Duration("operation-timeout", 30*time.Second, "OperationTimeout: producer-create, subscribe and lookup requests are retried (100ms backoff, doubling) until this timeout")
+	connTimeout       = flag.Duration("connection-timeout", 30*time.Second, "ConnectionTimeout: TCP connect timeout to a broker")
+	pprofPort         = flag.Int("pprof-port", 6090, "pprof HTTP server port")
+	outputDir         = flag.String("output", "./results", "Output directory")
+	scenario          = flag.String("scenario", "", "Test scenario name for output files (empty = generated from -size and -messages plus the start time, e.g. loop-size1k-100000-20261015-130405)")
+	precheckFlag      = flag.Bool("precheck", true, "Before connecting, check broker reachability, the topic (via -admin-url), free disk in the output dir and the open-files limit; exit on failures")
+	adminURL          = flag.String("admin-url", admin.DefaultURL, "Pulsar admin REST URL for the -precheck topic check")
+	force             = flag.Bool("force", false, "Overwrite the results of an earlier run with the same -scenario (and -run-id with -layout=run) instead of refusing to start")
+	layoutMode        = flag.String("layout", "flat", "Results layout: flat (<output>/loop_<scenario>.json) or run (<output>/<scenario>/<run-id>/ with manifest.json)")
+	runID             = flag.String("run-id", "", "Run ID for -layout=run (default: current time, printed at start)")
+	labels            = flag.String("labels", "", "Labels attached to the stats, result.json and manifest.json, as comma-separated key=value pairs")
+	trackPIDs         = flag.String("track-pids", "", "Comma-separated [name=]pid of co-located processes (e.g. a local Pulsar standalone or proxy) whose RSS is sampled with this process's, reported per process and as a total in the stats")
+	sizeUnit          = flag.String("size-unit", "MiB", metrics.SizeUnitUsage)
+	logLevel          = flag.String("log-level", "info", "Log level: debug, info, warn or error")
+)
+
+// topRetainers 堆 profile 中记入 stats 的 retainer 数
+const topRetainers = 20
+
+func main() {
+	flag.Parse()
+
+	if *scenario == "" {
+		m := ""
+		if *mode != modeStream {
+			m = *mode
+		}
+		*scenario = app.AutoScenario("loop", m, app.SizeParam("size", int64(*messageSize)), strconv.FormatInt(*messages, 10))
+	}
+	a, err := app.New(app.Options{
+		Program:   "loop",
+		LogLevel:  *logLevel,
+		Layout:    *layoutMode,
+		OutputDir: *outputDir,
+		Scenario:  *scenario,
+		RunID:     *runID,
+		Force:     *force,
+		Labels:    *labels,
+		TrackPIDs: *trackPIDs,
+		SizeUnit:  *sizeUnit,
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer a.Close()
+	defer a.Recover()
+	layout := a.Layout
+
+	if *messages < 1 || *messageSize < payload.HeaderSize || *rate < 0 || *receiverQueueSize < 1 {
+		log.Fatalf("-messages and -receiver-queue-size must be >= 1, -size >= %d and -rate >= 0", payload.HeaderSize)
+	}
+	if *mode != modeStream && *mode != modeRPC {
+		log.Fatalf("Invalid -mode %q: must be stream or rpc", *mode)
+	}
+	if *rpcRole != roleBoth && *rpcRole != roleRequester && *rpcRole != roleResponder {
+		log.Fatalf("Invalid -rpc-role %q: must be both, requester or responder", *rpcRole)
+	}
+	if *rpcInflight < 1 || *rpcTimeout <= 0 {
+		log.Fatalf("-rpc-inflight must be >= 1 and -rpc-timeout > 0")
+	}
+	if *replyTopic == "" {
+		*replyTopic = *topic + "-reply"
+	}
+
+	a.ServeDiagnostics(fmt.Sprintf("localhost:%d", *pprofPort))
+
+	log.Println("========== Loop Config ==========")
+	log.Printf("  URL: %s", *pulsarURL)
+	if *listenerName != "" {
+		log.Printf("  Listener: %s", *listenerName)
+	}
+	log.Printf("  Topic: %s, subscription: %s", *topic, *subscription)
+	log.Printf("  Messages: %d of %d bytes, rate %.0f msg/s (0=unlimited)", *messages, *messageSize, *rate)
+	if *mode == modeRPC {
+		log.Printf("  RPC: role %s, replies on %s, at most %d pending, timeout %v", *rpcRole, *replyTopic, *rpcInflight, *rpcTimeout)
+	}
+	log.Printf("  Producer: batching %v, max pending %d (0=default)", *batching, *maxPending)
+	log.Printf("  Consumer: receiver queue size %d", *receiverQueueSize)
+	log.Printf("  Memory limit: %d bytes (0=default 64MB, shared)", *memoryLimit)
+	log.Printf("  Results: %s", layout.Dir)
+	log.Println("=================================")
+
+	if *precheckFlag {
+		a.Precheck(context.Background(), precheck.Config{
+			ServiceURL: *pulsarURL,
+			AdminURL:   *adminURL,
+			Topics:     []string{*topic},
+			OutputDir:  *outputDir,
+		})
+	}
+
+	monitor, err := a.NewMonitor()
+	if err != nil {
+		a.Exit(results.StatusError, "%v", err)
+	}
+	monitor.SetReceiverQueueSize(*receiverQueueSize)
+	monitor.EnableLatency()
+	monitor.SetClientMemoryLimit(*memoryLimit)
+
+	client, err := pulsar.NewClient(pulsar.ClientOptions{
+		URL:               *pulsarURL,
+		ListenerName:      *listenerName,
+		OperationTimeout:  *opTimeout,
+		ConnectionTimeout: *connTimeout,
+		MetricsRegisterer: a.ClientMetrics.Registerer(),
+		MemoryLimitBytes:  *memoryLimit,
+	})
+	if err != nil {
+		a.Exit(results.StatusBrokerError, "failed to create Pulsar client: %v", err)
+	}
+	defer client.Close()
+
+	// subscribe/createProducer 失败时退出；每个 topic 都先订阅再生产，保证生产的每条消息都在订阅之后
+	subscribe := func(topic string) pulsar.Consumer {
+		consumer, err := client.Subscribe(pulsar.ConsumerOptions{
+			Topic:             topic,
+			SubscriptionName:  *subscription,
+			Type:              pulsar.Shared,
+			ReceiverQueueSize: *receiverQueueSize,
+		})
+		if err != nil {
+			a.Exit(results.StatusBrokerError, "failed to subscribe to %s: %v", topic, err)
+		}
+		return consumer
+	}
+	createProducer := func(topic string) pulsar.Producer {
+		producer, err := client.CreateProducer(pulsar.ProducerOptions{
+			Topic:              topic,
+			DisableBatching:    !*batching,
+			MaxPendingMessages: *maxPending,
+		})
+		if err != nil {
+			a.Exit(results.StatusBrokerError, "failed to create producer for %s: %v", topic, err)
+		}
+		return producer
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := app.Signals()
+	go func() {
+		<-sigCh
+		log.Println("Received signal, stopping...")
+		cancel()
+	}()
+
+	var rep *Report
+	switch *mode {
+	case modeStream:
+		consumer := subscribe(*topic)
+		defer consumer.Close()
+		producer := createProducer(*topic)
+		defer producer.Close()
+		monitor.Start(context.Background(), *sampleInterval)
+		rep = run(ctx, producer, consumer, monitor)
+	case modeRPC:
+		r := &rpc{monitor: monitor}
+		if *rpcRole != roleRequester {
+			r.requests = subscribe(*topic)
+			defer r.requests.Close()
+			r.replier = createProducer(*replyTopic)
+			defer r.replier.Close()
+		}
+		if *rpcRole != roleResponder {
+			r.replies = subscribe(*replyTopic)
+			defer r.replies.Close()
+			r.requester = createProducer(*topic)
+			defer r.requester.Close()
+		}
+		monitor.SetMetadata("latency", "round-trip")
+		monitor.Start(context.Background(), *sampleInterval)
+		rep = r.run(ctx)
+	}
+	monitor.Stop()
+	printReport(rep)
+
+	// 客户端仍未关闭，堆 profile 中同时包含 producer 和 consumer 的内存
+	heapPath := layout.File("profile", "heap", "pprof")
+	if err := metrics.WriteHeapProfile(heapPath); err != nil {
+		log.Printf("Failed to write heap profile: %v", err)
+	} else {
+		log.Printf("Heap profile saved to: %s", heapPath)
+		if retainers, err := metrics.TopRetainers(heapPath, topRetainers); err != nil {
+			log.Printf("Failed to extract top retainers: %v", err)
+		} else {
+			monitor.SetTopRetainers(retainers)
+		}
+	}
+	monitor.PrintSummary()
+
+	path := layout.File("loop", "loop", "json")
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("Failed to save loop report: %v", err)
+	} else {
+		log.Printf("Loop report saved to: %s", path)
+	}
+	statsPath := layout.File("stats", "stats", "json")
+	if err := monitor.SaveToFile(statsPath); err != nil {
+		log.Printf("Failed to save stats: %v", err)
+	} else {
+		log.Printf("Stats saved to: %s", statsPath)
+	}
+
+	status, reason := evaluate(rep)
+	summary := monitor.GetSummary()
+	m := map[string]float64{
+		"duration_s":  float64(rep.DurationMs) / 1000,
+		"sent":        float64(rep.Sent),
+		"received":    float64(rep.Received),
+		"send_errors": float64(rep.SendErrors),
+		"corrupt":     float64(rep.Corrupt),
+		"max_rss":     float64(summary.MaxRSS),
+		"max_heap":    float64(summary.MaxHeapAlloc),
+		"avg_heap":    summary.AvgHeapAlloc,
+	}
+	if summary.Latency != nil {
+		m["p99_latency_ms"] = summary.Latency.P99Ms
+	}
+	if rep.RPC != nil {
+		m["rpc_timeouts"] = float64(rep.RPC.Timeouts)
+		m["rpc_max_pending"] = float64(rep.RPC.MaxPending)
+		m["rpc_served"] = float64(rep.RPC.Served)
+	}
+	a.WriteResult(status, reason, m)
+	if err := layout.WriteManifest("loop", monitor.GetMetadata()); err != nil {
+		log.Printf("Failed to write manifest: %v", err)
+	}
+	a.Finish()
+	if code := status.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+}
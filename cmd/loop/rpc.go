@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+)
+
+const (
+	modeStream = "stream"
+	modeRPC    = "rpc"
+
+	roleBoth      = "both"
+	roleRequester = "requester"
+	roleResponder = "responder"
+
+	// 请求携带的关联 ID 和回复 topic，回复中原样带回关联 ID
+	correlationProperty = "correlation_id"
+	replyToProperty     = "reply_to"
+)
+
+// RPCStats -mode=rpc 的请求-回复统计
+type RPCStats struct {
+	Role        string `json:"role"`
+	Timeouts    int64  `json:"timeouts"`     // -rpc-timeout 内没有收到回复、已从 pending 表移除的请求
+	Late        int64  `json:"late"`         // 超时之后才到达、或关联 ID 未知的回复
+	MaxPending  int    `json:"max_pending"`  // pending 表的最大长度
+	Served      int64  `json:"served"`       // responder 发出的回复
+	ReplyErrors int64  `json:"reply_errors"` // responder 发送回复失败
+}
+
+// rpc 请求-回复模式: requester 向 -topic 发送带关联 ID 的请求并在 pending 表中等待，
+// responder 消费请求、把 payload 原样回复到 -reply-topic，requester 按关联 ID 取出请求、记录往返延迟。
+// role 为 both 时两端在同一进程中，否则各自运行 (先启动 responder)
+type rpc struct {
+	monitor *metrics.MemoryMonitor
+
+	// responder
+	requests pulsar.Consumer
+	replier  pulsar.Producer
+	// requester
+	replies   pulsar.Consumer
+	requester pulsar.Producer
+
+	mu      sync.Mutex
+	pending map[string]time.Time // 关联 ID -> 发送时间；在表中的请求各占用一个 slots 槽位
+	slots   chan struct{}        // 限制未收到回复的请求数 (-rpc-inflight)
+	stats   RPCStats
+}
+
+// take 从 pending 表中取出请求并释放槽位，请求已不在表中 (超时或已回复) 时返回 false
+func (r *rpc) take(id string) (time.Time, bool) {
+	r.mu.Lock()
+	sent, ok := r.pending[id]
+	delete(r.pending, id)
+	r.mu.Unlock()
+	if ok {
+		<-r.slots
+	}
+	return sent, ok
+}
+
+// expire 移除等待超过 -rpc-timeout 的请求
+func (r *rpc) expire(now time.Time) {
+	r.mu.Lock()
+	n := 0
+	for id, sent := range r.pending {
+		if now.Sub(sent) > *rpcTimeout {
+			delete(r.pending, id)
+			n++
+		}
+	}
+	r.stats.Timeouts += int64(n)
+	r.mu.Unlock()
+	for ; n > 0; n-- {
+		<-r.slots
+	}
+}
+
+func (r *rpc) pendingLen() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// run requester 发完 -messages 个请求并且每个请求都收到回复或超时后返回；只有 responder 时
+// -idle-timeout 内没有新请求时返回；ctx 取消时立即返回
+func (r *rpc) run(ctx context.Context) *Report {
+	rep := &Report{RPC: &r.stats}
+	r.stats.Role = *rpcRole
+	r.pending = make(map[string]time.Time)
+	r.slots = make(chan struct{}, *rpcInflight)
+	var sent, sendErrors, served, replyErrors atomic.Int64
+	var produceDone atomic.Bool
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	if r.requester != nil {
+		rep.Target = *messages
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer produceDone.Store(true)
+			gen := payload.NewGenerator(payload.Config{Sizes: payload.Fixed(*messageSize), Header: true, Seed: start.UnixNano()}, 0)
+			for i := int64(0); i < *messages; i++ {
+				if *rate > 0 {
+					due := start.Add(time.Duration(float64(i) / *rate * float64(time.Second)))
+					if d := time.Until(due); d > 0 {
+						select {
+						case <-time.After(d):
+						case <-ctx.Done():
+						}
+					}
+				}
+				select {
+				case r.slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				id := strconv.FormatInt(i, 10)
+				now := time.Now()
+				r.mu.Lock()
+				r.pending[id] = now
+				r.stats.MaxPending = max(r.stats.MaxPending, len(r.pending))
+				r.mu.Unlock()
+				msg := &pulsar.ProducerMessage{
+					Payload:    gen.Build(*messageSize, 0, uint64(i), now),
+					Properties: map[string]string{correlationProperty: id, replyToProperty: *replyTopic},
+				}
+				r.requester.SendAsync(ctx, msg, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+					if err != nil {
+						sendErrors.Add(1)
+						r.take(id)
+						return
+					}
+					sent.Add(1)
+				})
+			}
+			if err := r.requester.FlushWithCtx(ctx); err != nil {
+				log.Printf("Flush failed: %v", err)
+			}
+			rep.ProduceMs = time.Since(start).Milliseconds()
+		}()
+	}
+
+	// 没有对应角色时 channel 为 nil，select 不会选中
+	var requestCh, replyCh <-chan pulsar.ConsumerMessage
+	if r.requests != nil {
+		requestCh = r.requests.Chan()
+	}
+	if r.replies != nil {
+		replyCh = r.replies.Chan()
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	lastRequest, lastProgress := time.Now(), time.Now()
+	var end time.Time
+loop:
+	for {
+		select {
+		case cm := <-requestCh:
+			lastRequest = time.Now()
+			reply := &pulsar.ProducerMessage{
+				Payload:    cm.Payload(),
+				Properties: map[string]string{correlationProperty: cm.Properties()[correlationProperty]},
+			}
+			r.replier.SendAsync(ctx, reply, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+				if err != nil {
+					replyErrors.Add(1)
+					return
+				}
+				served.Add(1)
+			})
+			r.requests.Ack(cm.Message)
+		case cm := <-replyCh:
+			now := time.Now()
+			data := cm.Payload()
+			r.replies.Ack(cm.Message)
+			sentAt, ok := r.take(cm.Properties()[correlationProperty])
+			if !ok {
+				r.mu.Lock()
+				r.stats.Late++
+				r.mu.Unlock()
+				continue
+			}
+			end = now
+			rep.Received++
+			_, err := payload.Verify(data)
+			r.monitor.RecordVerification(err)
+			if err != nil {
+				rep.Corrupt++
+			}
+			r.monitor.RecordLatency(now.Sub(sentAt))
+			r.monitor.RecordMessage(int64(len(data)))
+		case now := <-ticker.C:
+			if r.requester != nil {
+				r.expire(now)
+				if produceDone.Load() && r.pendingLen() == 0 {
+					break loop
+				}
+			} else if now.Sub(lastRequest) > *idleTimeout {
+				log.Printf("No request for %v, stopping", *idleTimeout)
+				end = lastRequest
+				break loop
+			}
+			if now.Sub(lastProgress) >= progressInterval {
+				lastProgress = now
+				log.Printf("Progress: requests sent %d (%d errors) | replies %d, pending %d | served %d",
+					sent.Load(), sendErrors.Load(), rep.Received, r.pendingLen(), served.Load())
+			}
+		case <-ctx.Done():
+			rep.Interrupted = true
+			break loop
+		}
+	}
+	wg.Wait()
+	if r.replier != nil {
+		if err := r.replier.FlushWithCtx(ctx); err != nil {
+			log.Printf("Flush failed: %v", err)
+		}
+	}
+
+	rep.Sent, rep.SendErrors = sent.Load(), sendErrors.Load()
+	r.mu.Lock()
+	r.stats.Served, r.stats.ReplyErrors = served.Load(), replyErrors.Load()
+	r.mu.Unlock()
+	if end.IsZero() {
+		end = time.Now()
+	}
+	rep.DurationMs = end.Sub(start).Milliseconds()
+	if rep.ProduceMs > 0 {
+		rep.SendRate = float64(rep.Sent) / (float64(rep.ProduceMs) / 1000)
+	}
+	if rep.DurationMs > 0 {
+		rep.ReceiveRate = float64(rep.Received) / (float64(rep.DurationMs) / 1000)
+	}
+	return rep
+}
@@ -0,0 +1,128 @@
+// merge 把同时运行的多个进程 (如 scale-consumers.sh 启动的消费者) 的 stats JSON
+// 合并为一份数据: 时间轴对齐后按固定步长重采样，输出每个进程的序列和 fleet 合计序列。
+//
+// 用法: merge [-o merged.json] [-interval 1s] [-align wall|start] stats_a.json stats_b.json ...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+var (
+	outputFile = flag.String("o", "", "Write the merged dataset to this JSON file (empty = print the summary only)")
+	interval   = flag.Duration("interval", time.Second, "Resampling step of the merged timeline")
+	align      = flag.String("align", "wall", "Timeline alignment: wall (absolute timestamps, needs synchronized clocks) or start (every process starts at offset 0)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <stats.json>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *interval <= 0 {
+		log.Fatalf("-interval must be positive")
+	}
+	if *align != "wall" && *align != "start" {
+		log.Fatalf("unknown -align %q (want wall or start)", *align)
+	}
+
+	inputs := make([]input, 0, flag.NArg())
+	names := make(map[string]int)
+	for _, path := range flag.Args() {
+		in, err := load(path)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		if len(in.stats.Samples) == 0 {
+			log.Printf("Warning: %s has no samples (saved with -samples=rollup|none?), skipped", path)
+			continue
+		}
+		// run 布局下文件名都是 stats.json，同名时追加序号
+		if n := names[in.name]; n > 0 {
+			in.name = fmt.Sprintf("%s#%d", in.name, n)
+		}
+		names[in.name]++
+		inputs = append(inputs, in)
+	}
+	if len(inputs) == 0 {
+		log.Fatalf("no samples in any input")
+	}
+
+	merged := merge(inputs, *interval, *align == "start")
+	printSummary(merged)
+
+	if *outputFile != "" {
+		data, err := json.MarshalIndent(merged, "", "  ")
+		if err != nil {
+			log.Fatalf("encode: %v", err)
+		}
+		if err := results.WriteBytes(*outputFile, append(data, '\n')); err != nil {
+			log.Fatalf("write %s: %v", *outputFile, err)
+		}
+		log.Printf("Merged dataset saved to %s", *outputFile)
+	}
+}
+
+// input 一个进程的 stats 文件
+type input struct {
+	name  string
+	path  string
+	stats metrics.StatsOutput
+}
+
+// load 读取 stats 文件 (可为 .json.gz)，进程名优先取 metadata 中的 -scenario，否则取文件名
+func load(path string) (input, error) {
+	stats, err := metrics.LoadStats(path)
+	if err != nil {
+		return input{}, err
+	}
+	in := input{path: path, stats: stats}
+	in.name = in.stats.Metadata["flag.scenario"]
+	if in.name == "" {
+		base := strings.TrimSuffix(filepath.Base(path), ".gz")
+		in.name = strings.TrimPrefix(strings.TrimSuffix(base, ".json"), "stats_")
+	}
+	return in, nil
+}
+
+func printSummary(m *Merged) {
+	mb := func(v uint64) float64 { return float64(v) / 1024 / 1024 }
+
+	log.Println("========== Merged Report ==========")
+	log.Printf("  Processes: %d, timeline %s aligned, %v step, %v long",
+		len(m.Processes), m.Align, m.Interval, time.Duration(m.DurationMs)*time.Millisecond)
+	log.Println("")
+	log.Printf("  %-24s %9s %9s %12s %10s %10s", "Process", "Offset", "Duration", "Messages", "Max Heap", "Max RSS")
+	for _, p := range m.Processes {
+		log.Printf("  %-24s %8.1fs %8.1fs %12d %9.2fM %9.2fM", p.Name,
+			float64(p.OffsetMs)/1000, float64(p.DurationMs)/1000, p.Summary.MessageCount,
+			mb(p.Summary.MaxHeapAlloc), mb(p.Summary.MaxRSS))
+	}
+	t := m.Total
+	log.Println("")
+	log.Println("  --- Fleet ---")
+	log.Printf("    Messages:          %d (%.2f MB)", t.MessageCount, float64(t.MessageBytes)/1024/1024)
+	log.Printf("    Peak Heap:         %.2f MB at %.1fs (sum of per-process max: %.2f MB)",
+		mb(t.PeakHeapAlloc), float64(t.PeakHeapOffsetMs)/1000, mb(t.SumMaxHeapAlloc))
+	log.Printf("    Peak RSS:          %.2f MB at %.1fs (sum of per-process max: %.2f MB)",
+		mb(t.PeakRSS), float64(t.PeakRSSOffsetMs)/1000, mb(t.SumMaxRSS))
+	log.Printf("    Max concurrent:    %d processes", t.MaxActive)
+	log.Println("===================================")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// Point 重采样后某一时刻的进程状态，取该时刻之前最近的一个样本
+type Point struct {
+	OffsetMs     int64  `json:"offset_ms"` // 距合并时间轴起点的毫秒数
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	RSS          uint64 `json:"rss"`
+	MessageCount int64  `json:"message_count"`
+	MessageBytes int64  `json:"message_bytes"`
+}
+
+// FleetPoint fleet 合计: 内存只累加该时刻仍在运行的进程，消息数累加所有已启动进程
+type FleetPoint struct {
+	Point
+	Active int `json:"active"` // 该时刻运行中的进程数
+}
+
+// Process 一个进程在合并时间轴上的位置和序列
+type Process struct {
+	Name       string                `json:"name"`
+	File       string                `json:"file"`
+	Start      time.Time             `json:"start"`       // 第一个样本的时间戳 (本机时钟)
+	OffsetMs   int64                 `json:"offset_ms"`   // 在合并时间轴上的起点
+	DurationMs int64                 `json:"duration_ms"` // 第一个到最后一个样本
+	Metadata   map[string]string     `json:"metadata,omitempty"`
+	Summary    metrics.MemorySummary `json:"summary"`
+	Series     []Point               `json:"series"`
+}
+
+// FleetTotal fleet 级别的汇总
+type FleetTotal struct {
+	Processes    int   `json:"processes"`
+	MaxActive    int   `json:"max_active"`
+	MessageCount int64 `json:"message_count"`
+	MessageBytes int64 `json:"message_bytes"`
+
+	// 合计序列上的峰值，即同一时刻真实占用的最大值
+	PeakHeapAlloc    uint64 `json:"peak_heap_alloc"`
+	PeakHeapOffsetMs int64  `json:"peak_heap_offset_ms"`
+	PeakRSS          uint64 `json:"peak_rss"`
+	PeakRSSOffsetMs  int64  `json:"peak_rss_offset_ms"`
+
+	// 各进程峰值之和，峰值不一定同时出现，是上界
+	SumMaxHeapAlloc uint64 `json:"sum_max_heap_alloc"`
+	SumMaxRSS       uint64 `json:"sum_max_rss"`
+}
+
+// Merged 合并后的数据集
+type Merged struct {
+	Start      time.Time    `json:"start"` // 合并时间轴起点，-align=start 时为最早启动的进程
+	Align      string       `json:"align"`
+	Interval   string       `json:"interval"`
+	DurationMs int64        `json:"duration_ms"`
+	Processes  []Process    `json:"processes"`
+	Fleet      []FleetPoint `json:"fleet"`
+	Total      FleetTotal   `json:"total"`
+}
+
+// merge 对齐各进程的时间轴并按 step 重采样。
+// wall 模式按样本的绝对时间戳对齐，要求各主机时钟同步；
+// fromStart 时每个进程的第一个样本都对齐到 0，适合错开启动但负载相同的进程
+func merge(inputs []input, step time.Duration, fromStart bool) *Merged {
+	m := &Merged{Align: "wall", Interval: step.String()}
+	if fromStart {
+		m.Align = "start"
+	}
+
+	for _, in := range inputs {
+		sort.SliceStable(in.stats.Samples, func(i, j int) bool {
+			return in.stats.Samples[i].Timestamp.Before(in.stats.Samples[j].Timestamp)
+		})
+	}
+	m.Start = inputs[0].stats.Samples[0].Timestamp
+	for _, in := range inputs[1:] {
+		if t := in.stats.Samples[0].Timestamp; t.Before(m.Start) {
+			m.Start = t
+		}
+	}
+
+	// 每个进程在合并时间轴上的 [offset, offset+duration]
+	var end int64
+	for _, in := range inputs {
+		samples := in.stats.Samples
+		p := Process{
+			Name:       in.name,
+			File:       in.path,
+			Start:      samples[0].Timestamp,
+			DurationMs: samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp).Milliseconds(),
+			Metadata:   in.stats.Metadata,
+			Summary:    in.stats.Summary,
+		}
+		if !fromStart {
+			p.OffsetMs = p.Start.Sub(m.Start).Milliseconds()
+		}
+		end = max(end, p.OffsetMs+p.DurationMs)
+		m.Processes = append(m.Processes, p)
+	}
+	m.DurationMs = end
+
+	stepMs := step.Milliseconds()
+	if stepMs == 0 {
+		stepMs = 1
+	}
+	for t := int64(0); ; t += stepMs {
+		// 最后一个点对齐到终点，保证每个进程的最终值都被采到
+		t = min(t, end)
+		fp := FleetPoint{Point: Point{OffsetMs: t}}
+		for i := range m.Processes {
+			p := &m.Processes[i]
+			if t < p.OffsetMs {
+				continue
+			}
+			s := sampleAt(inputs[i].stats.Samples, p.Start, t-p.OffsetMs)
+			pt := Point{
+				OffsetMs:     t,
+				HeapAlloc:    s.HeapAlloc,
+				HeapInuse:    s.HeapInuse,
+				RSS:          s.RSS,
+				MessageCount: s.MessageCount,
+				MessageBytes: s.MessageBytes,
+			}
+			fp.MessageCount += pt.MessageCount
+			fp.MessageBytes += pt.MessageBytes
+			if t > p.OffsetMs+p.DurationMs {
+				// 进程已结束，不再占用内存
+				continue
+			}
+			p.Series = append(p.Series, pt)
+			fp.HeapAlloc += pt.HeapAlloc
+			fp.HeapInuse += pt.HeapInuse
+			fp.RSS += pt.RSS
+			fp.Active++
+		}
+		m.Fleet = append(m.Fleet, fp)
+		if t >= end {
+			break
+		}
+	}
+
+	m.Total = total(m)
+	return m
+}
+
+// sampleAt 返回 start+offsetMs 时刻之前最近的样本
+func sampleAt(samples []metrics.MemoryStats, start time.Time, offsetMs int64) metrics.MemoryStats {
+	at := start.Add(time.Duration(offsetMs) * time.Millisecond)
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(at) })
+	return samples[max(i-1, 0)]
+}
+
+func total(m *Merged) FleetTotal {
+	t := FleetTotal{Processes: len(m.Processes)}
+	for _, p := range m.Processes {
+		t.MessageCount += p.Summary.MessageCount
+		t.MessageBytes += p.Summary.MessageBytes
+		t.SumMaxHeapAlloc += p.Summary.MaxHeapAlloc
+		t.SumMaxRSS += p.Summary.MaxRSS
+	}
+	for _, fp := range m.Fleet {
+		t.MaxActive = max(t.MaxActive, fp.Active)
+		if fp.HeapAlloc > t.PeakHeapAlloc {
+			t.PeakHeapAlloc, t.PeakHeapOffsetMs = fp.HeapAlloc, fp.OffsetMs
+		}
+		if fp.RSS > t.PeakRSS {
+			t.PeakRSS, t.PeakRSSOffsetMs = fp.RSS, fp.OffsetMs
+		}
+	}
+	return t
+}
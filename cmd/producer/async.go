@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// drainWindow 占满 -async-window 的所有槽位再全部释放，即等待该 worker 发送中的消息全部回调；
+// ctx 取消 (drain 超时) 时放弃等待
+func drainWindow(ctx context.Context, window chan struct{}) {
+	n := 0
+	defer func() {
+		for ; n > 0; n-- {
+			<-window
+		}
+	}()
+	for n < cap(window) {
+		select {
+		case window <- struct{}{}:
+			n++
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// recordBlocked 发送耗时超过 -blocked-threshold 时计为一次阻塞
+func recordBlocked(d time.Duration, count, nanos *int64) {
+	if d > *blockedAfter {
+		atomic.AddInt64(count, 1)
+		atomic.AddInt64(nanos, int64(d))
+	}
+}
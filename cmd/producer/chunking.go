@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/payload"
+)
+
+// defaultBrokerMaxMessageSize broker.conf 中 maxMessageSize 的默认值 (5 MB)
+const defaultBrokerMaxMessageSize = 5 << 20
+
+// maxPayloadSize 分布的最大消息大小，没有上限时返回 0
+func maxPayloadSize(d payload.SizeDistribution) int {
+	switch d := d.(type) {
+	case payload.Fixed:
+		return int(d)
+	case payload.Uniform:
+		return d.Max
+	case payload.Exponential:
+		return d.Max
+	}
+	return 0
+}
+
+// validateChunking 检查 -chunking/-chunk-size，并对超过 broker 默认上限的消息给出配置提示
+func validateChunking(sizes payload.SizeDistribution) error {
+	if *chunkSize < 0 {
+		return fmt.Errorf("invalid -chunk-size %d: must be >= 0", *chunkSize)
+	}
+	if *chunking && *chunkSize > defaultBrokerMaxMessageSize {
+		log.Printf("Warning: -chunk-size=%d exceeds the broker's default maxMessageSize (%d); raise maxMessageSize in broker.conf or chunks will be rejected",
+			*chunkSize, defaultBrokerMaxMessageSize)
+	}
+	largest := maxPayloadSize(sizes)
+	switch {
+	case *chunking:
+	case largest == 0 && sizes.Mean() > defaultBrokerMaxMessageSize/8:
+		log.Printf("Warning: %s has no upper bound; messages above the broker's maxMessageSize (default %d) fail with message too large unless -chunking is set or the distribution is capped (e.g. exp:%d-8388608)",
+			sizes, defaultBrokerMaxMessageSize, sizes.Mean())
+	case largest > defaultBrokerMaxMessageSize:
+		log.Printf("Warning: messages up to %d bytes exceed the broker's default maxMessageSize (%d); use -chunking, or raise maxMessageSize in broker.conf (plus nettyMaxFrameSizeBytes and the bookies' nettyMaxFrameSizeBytes)",
+			largest, defaultBrokerMaxMessageSize)
+	}
+	return nil
+}
+
+// applyChunking 把 -chunking/-chunk-size 写入 producer 选项；chunking 要求关闭批量发送
+func applyChunking(opts *pulsar.ProducerOptions) {
+	if !*chunking {
+		return
+	}
+	opts.EnableChunking = true
+	opts.DisableBatching = true
+	opts.ChunkMaxMessageSize = uint(*chunkSize)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// sendErrorKind 发送错误分类
+type sendErrorKind int
+
+const (
+	errKindTimeout sendErrorKind = iota
+	errKindQueueFull
+	errKindConnection
+	errKindOther
+	numErrorKinds
+)
+
+var errorKindNames = [numErrorKinds]string{"timeout", "queue_full", "connection", "other"}
+
+func (k sendErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+// classifySendError 将 Send 返回的错误归类，便于区分超时、队列满和连接问题
+func classifySendError(err error) sendErrorKind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errKindTimeout
+	}
+	var pulsarErr *pulsar.Error
+	if !errors.As(err, &pulsarErr) {
+		return errKindOther
+	}
+	switch pulsarErr.Result() {
+	case pulsar.TimeoutError:
+		return errKindTimeout
+	case pulsar.ProducerQueueIsFull, pulsar.ClientMemoryBufferIsFull:
+		return errKindQueueFull
+	case pulsar.ConnectError, pulsar.NotConnectedError, pulsar.LookupError,
+		pulsar.ProducerClosed, pulsar.AlreadyClosedError, pulsar.ServiceUnitNotReady:
+		return errKindConnection
+	default:
+		return errKindOther
+	}
+}
+
+// errorCounters 按分类统计的发送错误数，可并发更新
+type errorCounters [numErrorKinds]int64
+
+func (c *errorCounters) add(err error) sendErrorKind {
+	kind := classifySendError(err)
+	atomic.AddInt64(&c[kind], 1)
+	return kind
+}
+
+func (c *errorCounters) load(kind sendErrorKind) int64 {
+	return atomic.LoadInt64(&c[kind])
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/logging"
+)
+
+// flushStats 周期性 Flush 的耗时统计，仅由 flushLoop 写入
+type flushStats struct {
+	count  int64
+	errors int64
+	total  time.Duration
+	max    time.Duration
+}
+
+func (s *flushStats) avg() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return s.total / time.Duration(s.count)
+}
+
+// flushLoop 按固定间隔调用 Flush() 并记录耗时，直到 ctx 结束
+func flushLoop(ctx context.Context, producer pulsar.Producer, interval time.Duration, stats *flushStats) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			err := producer.FlushWithCtx(ctx)
+			d := time.Since(start)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				stats.errors++
+				logging.Warnf("Flush error: %v", err)
+				continue
+			}
+			stats.count++
+			stats.total += d
+			if d > stats.max {
+				stats.max = d
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
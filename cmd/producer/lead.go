@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pulsar-memory-test/pkg/control"
+)
+
+// leadEnabled 是否开启 -lead-messages/-lead-mb 受控积压
+func leadEnabled() bool {
+	return *leadMessages > 0 || *leadMB > 0
+}
+
+// validateLead 检查受控积压相关参数
+func validateLead() error {
+	if *leadMessages < 0 || *leadMB < 0 {
+		return fmt.Errorf("-lead-messages and -lead-mb must be >= 0")
+	}
+	if leadEnabled() && *consumerURL == "" {
+		return fmt.Errorf("-lead-messages/-lead-mb require -consumer-url")
+	}
+	if *leadPoll <= 0 {
+		return fmt.Errorf("invalid -lead-poll %v: must be positive", *leadPoll)
+	}
+	return nil
+}
+
+// startLead 创建领先量控制并在后台轮询 consumer，未开启时返回 nil；
+// issued 返回已发出 (含发送中) 的消息数和字节数
+func startLead(ctx context.Context, issued func() (int64, int64)) *control.Lead {
+	if !leadEnabled() {
+		return nil
+	}
+	lead := control.NewLead(control.NewClient(*consumerURL), *leadMessages, *leadMB<<20, *leadPoll)
+	go lead.Run(ctx, issued)
+	return lead
+}
+
+// leadSummary 一行摘要
+func leadSummary(s control.LeadStats) string {
+	return fmt.Sprintf("target %d msgs / %d MB | lag avg %.0f msgs (%.2f MB), max %d msgs (%.2f MB) | waited %d times, %v | poll errors %d",
+		s.TargetMessages, s.TargetBytes>>20, s.AvgLagMessages, s.AvgLagBytes/1024/1024,
+		s.MaxLagMessages, float64(s.MaxLagBytes)/1024/1024, s.Waits,
+		(time.Duration(s.WaitMs) * time.Millisecond).Round(time.Millisecond), s.PollErrors)
+}
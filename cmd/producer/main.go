@@ -5,67 +5,407 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
-	"net/http"
-	_ "net/http/pprof"
 	"os"
-	"os/signal"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/pulsar-client-go/pulsar/backoff"
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/app"
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/control"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+	"pulsar-memory-test/pkg/precheck"
+	"pulsar-memory-test/pkg/progress"
+	"pulsar-memory-test/pkg/results"
+	"pulsar-memory-test/pkg/trace"
 )
 
 var (
-	pulsarURL    = flag.String("url", "pulsar://localhost:6650", "Pulsar broker URL")
+	pulsarURL    = flag.String("url", "pulsar://localhost:6650", "Pulsar service URL: a broker, or a Pulsar proxy (lookups then route through the proxy)")
+	listenerName = flag.String("listener-name", "", "Listener name for brokers with advertisedListeners (e.g. internal/external behind a Kubernetes load balancer): lookups return that listener's address (empty = the default listener)")
 	topic        = flag.String("topic", "persistent://public/default/memory-test", "Topic name")
 	messageSize  = flag.Int("size", 1024, "Message size in bytes")
 	totalSize    = flag.Int64("total", 200*1024*1024, "Total data size to produce in bytes")
 	concurrency  = flag.Int("concurrency", 10, "Number of concurrent producers")
+	sendRate     = flag.Float64("rate", 0, "Send at most this many messages per second across all workers (0 = as fast as possible)")
 	batchingTime = flag.Duration("batching-time", 10*time.Millisecond, "Batching max publish delay")
+	batchingMsgs = flag.Uint("batching-max-messages", 1000, "BatchingMaxMessages: messages per batch")
+	batchingSize = flag.Uint("batching-max-size", 0, "BatchingMaxSize: bytes per batch (0 = client default 128KB)")
+	maxPending   = flag.Int("max-pending", 0, "MaxPendingMessages: messages awaiting acks before Send blocks (0 = client default 1000); raise with -async-window")
+	asyncWindow  = flag.Int("async-window", 0, "Send with SendAsync, keeping up to this many messages in flight per worker (0 = synchronous Send); needed for high message rates")
+	propsMode    = flag.String("properties", "full", "Per-message metadata: full (worker, sequence, timestamp properties), none (no descriptive properties; crc32, phase and -keys still sent) or bare (no properties and no key at all, trace keys dropped: the payload-only baseline)")
 	compression  = flag.String("compression", "none", "Compression type: none, lz4, zlib, zstd")
+	chunking     = flag.Bool("chunking", false, "Enable producer chunking (disables batching) so messages above the broker's maxMessageSize are split into chunks")
+	chunkSize    = flag.Int("chunk-size", 0, "With -chunking, the max payload bytes per chunk (0 = the broker's maxMessageSize; ignored without -chunking)")
+	compSweep    = flag.String("compression-sweep", "", "Split -total into equal phases, one per comma-separated compression[:level] (e.g. none,lz4,zstd:faster,zstd:better; levels default|faster|better), each with its own producer and a phase message property; prints a compression/throughput table (use with -compressibility)")
 	pprofPort    = flag.Int("pprof-port", 6070, "pprof HTTP server port")
+	metricsPort  = flag.Int("metrics-port", 0, "Also serve /metrics and /stats/current (no pprof) on this port on all interfaces for Prometheus/Grafana (0 = only on the pprof server)")
+	keySpace     = flag.Int("keys", 0, "Number of distinct message keys, cycled per worker (0 = no key); needed for meaningful compaction")
+	replClusters = flag.String("replication-clusters", "", "Comma-separated clusters to replicate each message to (empty = namespace policy)")
+	disableRepl  = flag.Bool("disable-replication", false, "Disable geo-replication for produced messages")
+	producerName = flag.String("name", "", "Producer name (empty = broker generated)")
+	partDiscover = flag.Duration("partition-discovery", 0, "PartitionsAutoDiscoveryInterval: how often the producer of a partitioned topic looks for added partitions (0 = client default 1m)")
+	accessMode   = flag.String("access-mode", "shared", "Producer access mode: shared, exclusive, wait_for_exclusive")
+	verifyExcl   = flag.Bool("verify-exclusive", false, "After creating the producer, try a second producer with the same access mode and report whether it was excluded")
+	sendTimeout  = flag.Duration("send-timeout", 30*time.Second, "Producer SendTimeout (negative = disabled)")
+	sendRetries  = flag.Int("send-retries", 0, "Retry a failed send up to this many times before counting the message as failed (0 = no retry, the message is skipped)")
+	retryBackoff = flag.Duration("retry-backoff", 100*time.Millisecond, "Wait before the first -send-retries retry, doubled for each further retry")
+	retryMaxWait = flag.Duration("retry-max-backoff", 5*time.Second, "Upper bound of the -send-retries backoff")
+	maxReconnect = flag.Int("max-reconnect", -1, "MaxReconnectToBroker (-1 = unlimited)")
+	backoffStart = flag.Duration("initial-backoff", 0, "Initial reconnect backoff, doubled up to 60s (0 = client default 100ms)")
+	opTimeout    = flag.Duration("operation-timeout", 30*time.Second, "OperationTimeout: producer-create, subscribe and lookup requests are retried (100ms backoff, doubling) until this timeout")
+	connTimeout  = flag.Duration("connection-timeout", 30*time.Second, "ConnectionTimeout: TCP connect timeout to a broker")
+	keepAlive    = flag.Duration("keep-alive", 0, "KeepAliveInterval: ping interval; a connection with no data from the broker for two intervals is closed (0 = client default 30s)")
+	maxConns     = flag.Int("max-connections-per-broker", 0, "Connection pool: MaxConnectionsPerBroker, connections opened to each broker, producers/consumers spread across them (0 = client default 1)")
+	connMaxIdle  = flag.Duration("connection-max-idle", 0, "Connection pool: ConnectionMaxIdleTime, close a connection unused for this long (0 = client default 3m, minimum 1m, negative = never)")
+	memoryLimit  = flag.Int64("memory-limit", 0, "Client memory limit in bytes (0 = client default 64MB)")
+	disableBlock = flag.Bool("disable-block", false, "Fail sends with queue_full instead of blocking when the pending queue or memory limit is full")
+	blockedAfter = flag.Duration("blocked-threshold", 50*time.Millisecond, "A Send taking longer than this is counted as blocked")
+	flushEvery   = flag.Duration("flush-interval", 0, "Call Flush() periodically at this interval and record its latency (0 = only flush at the end)")
+	exactTotal   = flag.Bool("exact-total", false, "Send the -total remainder that doesn't fill a whole -size message as one final smaller message")
+	sizeDist     = flag.String("size-dist", "", "Payload size distribution: fixed:N, uniform:MIN-MAX, exp:MEAN[-MAX] (empty = fixed -size); the mean sets the message count for -total")
+	compressible = flag.Float64("compressibility", 0, "Fraction of each payload filled with repeated bytes (0 = random, 1 = fully compressible)")
+	encoding     = flag.String("encoding", "none", "Payload body encoding for consumer decode tests: none|json|proto")
+	layoutMode   = flag.String("layout", "flat", "Results layout: flat (<output>/producer_<scenario>.json) or run (<output>/<scenario>/<run-id>/ with manifest.json)")
+	runID        = flag.String("run-id", "", "Run ID for -layout=run (default: current time, printed at start)")
+	artifactURL  = flag.String("artifact-url", "", "Upload this run's artifacts (stats, profiles, logs, manifest) to s3://bucket[/prefix] (aws CLI) or gs://bucket[/prefix] (gcloud CLI) when done")
+	labels       = flag.String("labels", "", "Labels attached to exported metrics, progress lines, the report, result.json and manifest.json, as comma-separated key=value pairs (e.g. client_version=v0.14.0,experiment=exp-42)")
+	trackPIDs    = flag.String("track-pids", "", "Comma-separated [name=]pid of co-located processes (e.g. a local Pulsar standalone or proxy) whose RSS is sampled with this process's, reported per process and as a total in the stats")
+	sizeUnit     = flag.String("size-unit", "MiB", metrics.SizeUnitUsage)
+	pushGateway  = flag.String("push-gateway", "", "Push client metrics to this Prometheus Pushgateway (http://host:9091) every -push-interval and once more at exit")
+	statsdAddr   = flag.String("statsd-addr", "", "Send client metrics as DogStatsD gauges over UDP to this host:port every -push-interval and once more at exit")
+	statsdPrefix = flag.String("statsd-prefix", "", "Prefix prepended to every StatsD metric name")
+	pushInterval = flag.Duration("push-interval", 10*time.Second, "Interval between pushes for -push-gateway and -statsd-addr")
+	logFile      = flag.String("log-file", "", "Also write logs to this file (rotated by size)")
+	logLevel     = flag.String("log-level", "info", "Log level: debug, info, warn (hide progress lines) or error")
+	logMaxSize   = flag.Int64("log-max-size", 100*1024*1024, "Rotate -log-file when it exceeds this many bytes (0 = never)")
+	logMaxBack   = flag.Int("log-max-backups", 5, "Number of rotated log files to keep")
+	progressIntv = flag.Duration("progress-interval", 2*time.Second, "Progress report interval")
+	progressFmt  = flag.String("progress-format", "log", "Progress report format: log, json (one object per line on stdout) or none")
+	withHeader   = flag.Bool("payload-header", true, "Embed a header (worker, sequence, publish time, CRC32) at the start of each payload; if false a crc32 property is sent instead")
+	seed         = flag.Int64("seed", 0, "Seed for payload generation, making runs reproducible (0 = time based, logged)")
+	outputDir    = flag.String("output", "./results", "Output directory for the producer report")
+	scenario     = flag.String("scenario", "", "Test scenario name for output files (empty = generated from -preset, -size/-size-dist and -total plus the start time, e.g. producer-size1k-total200m-20261015-130405)")
+	precheckFlag = flag.Bool("precheck", true, "Before connecting, check broker reachability, the topic (via -admin-url), free disk in the output dir, the open-files limit and available memory vs -memory-limit; exit on failures")
+	createTopic  = flag.Bool("precheck-create-topic", false, "With -precheck, create -topic (non-partitioned) via -admin-url when it does not exist instead of only warning")
+	force        = flag.Bool("force", false, "Overwrite the report of an earlier producer run with the same -scenario (and -run-id with -layout=run) instead of refusing to start")
+	drainTimeout = flag.Duration("drain-timeout", 10*time.Second, "On SIGINT/SIGTERM, how long to wait for in-flight sends and the final flush before abandoning them")
+	preset       = flag.String("preset", "", "Apply a built-in scenario's flag defaults (explicit flags win); -preset=list shows them")
+	stallTimeout = flag.Duration("stall-timeout", 0, "Exit with status 5 (stalled) after this long without a successful send while messages remain; dumps goroutine stacks (0 = disabled)")
+	topicStats   = flag.Bool("topic-stats", false, "Record broker-side topic stats (storage, backlog, entries) via -admin-url before and after producing, into manifest.json")
+	adminURL     = flag.String("admin-url", admin.DefaultURL, "Pulsar admin REST URL for -topic-stats and the -precheck topic check")
+	traceFile    = flag.String("trace", "", "Replay a recorded traffic trace (offsets, sizes, keys; see the consumer's -record-trace) instead of -total/-size/-size-dist/-keys")
+	traceSpeed   = flag.Float64("trace-speed", 1, "Replay speed for -trace: 1 = original timing, 2 = twice as fast, 0 = as fast as possible")
+	ntpServer    = flag.String("ntp-server", "", "Estimate the local clock offset against this NTP server (host[:port]) and stamp NTP-corrected publish times into payload headers, so consumers on other hosts get skew-free latency (empty = local clock)")
+	leadMessages = flag.Int64("lead-messages", 0, "Controlled backlog: never get more than this many messages ahead of the consumer at -consumer-url (0 = no limit)")
+	leadMB       = flag.Int64("lead-mb", 0, "Controlled backlog: never get more than this many MB ahead of the consumer at -consumer-url (0 = no limit)")
+	consumerURL  = flag.String("consumer-url", "", "Consumer diagnostics server (e.g. http://localhost:6060) polled for exact processed counts by -lead-messages/-lead-mb")
+	leadPoll     = flag.Duration("lead-poll", 20*time.Millisecond, "How often -lead-messages/-lead-mb poll the consumer's counters; keep well below the consumer's 100ms receive timeout so it does not see the topic as drained")
+	configFile   = flag.String("config", "", "Load flag defaults from a YAML scenario file (see runner init); explicit flags win, then -config, then -preset")
 )
 
 const logPrefix = "[PRODUCER] "
 
+// controlLinger 发送完成后等待 consumer (-producer-url) 读到最终计数的最长时间
+const controlLinger = 10 * time.Second
+
+// parseAccessMode 解析 -access-mode 参数
+func parseAccessMode(s string) (pulsar.ProducerAccessMode, error) {
+	switch s {
+	case "shared":
+		return pulsar.ProducerAccessModeShared, nil
+	case "exclusive":
+		return pulsar.ProducerAccessModeExclusive, nil
+	case "wait_for_exclusive":
+		return pulsar.ProducerAccessModeWaitForExclusive, nil
+	default:
+		return pulsar.ProducerAccessModeShared, fmt.Errorf("unknown access mode %q", s)
+	}
+}
+
+// verifyExclusion 用同样的 access mode 再创建一个 producer，验证 broker 是否拒绝
+// Exclusive 期望立即失败，WaitForExclusive 期望一直阻塞直到超时，Shared 期望成功；
+// 结果不符合期望时返回 false
+func verifyExclusion(client pulsar.Client, options pulsar.ProducerOptions, timeout time.Duration) bool {
+	options.Name = ""
+	type result struct {
+		producer pulsar.Producer
+		err      error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		p, err := client.CreateProducer(options)
+		resultCh <- result{p, err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		if r.err != nil {
+			log.Printf("Exclusion check: second producer rejected: %v", r.err)
+			return options.ProducerAccessMode != pulsar.ProducerAccessModeShared
+		}
+		log.Printf("Exclusion check: second producer created (%s), topic is NOT exclusive", r.producer.Name())
+		r.producer.Close()
+		return options.ProducerAccessMode == pulsar.ProducerAccessModeShared
+	case <-time.After(timeout):
+		log.Printf("Exclusion check: second producer still pending after %v (waiting for exclusive access)", timeout)
+		// 后台等待创建结果并关闭，避免泄漏
+		go func() {
+			if r := <-resultCh; r.err == nil {
+				r.producer.Close()
+			}
+		}()
+		return options.ProducerAccessMode == pulsar.ProducerAccessModeWaitForExclusive
+	}
+}
+
 func main() {
 	flag.Parse()
 
 	// 设置日志前缀
 	log.SetPrefix(logPrefix)
 
-	// 启动 pprof 服务
-	go func() {
-		addr := fmt.Sprintf("localhost:%d", *pprofPort)
-		log.Printf("Starting pprof server at http://%s/debug/pprof/", addr)
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Printf("pprof server error: %v", err)
+	// 内置场景，命令行显式指定的参数优先
+	if listed, err := app.LoadFlags("producer", *preset, *configFile); err != nil {
+		log.Fatalf("%v", err)
+	} else if listed {
+		return
+	}
+
+	if *scenario == "" {
+		size := app.SizeParam("size", int64(*messageSize))
+		if *sizeDist != "" {
+			size = "size-" + strings.NewReplacer(":", "", "-", "to").Replace(*sizeDist)
 		}
-	}()
+		*scenario = app.AutoScenario("producer", *preset, size, app.SizeParam("total", *totalSize))
+	}
+	a, err := app.New(app.Options{
+		Program:       "producer",
+		LogLevel:      *logLevel,
+		LogFile:       *logFile,
+		LogMaxSize:    *logMaxSize,
+		LogMaxBackups: *logMaxBack,
+		Layout:        *layoutMode,
+		OutputDir:     *outputDir,
+		Scenario:      *scenario,
+		RunID:         *runID,
+		Force:         *force,
+		ArtifactURL:   *artifactURL,
+		Labels:        *labels,
+		TrackPIDs:     *trackPIDs,
+		SizeUnit:      *sizeUnit,
+		PushGateway:   *pushGateway,
+		PushInterval:  *pushInterval,
+		StatsDAddr:    *statsdAddr,
+		StatsDPrefix:  *statsdPrefix,
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer a.Close()
+	defer a.Recover()
+	layout := a.Layout
+	clientMetrics := a.ClientMetrics
+	// CPU/goroutine profile 按角色分组，见 app.Label
+	mainCtx := app.Label(a.ProfileContext(), "main")
+
+	// 存活检测: /healthz 报告最后一次发送成功的时间；生产端在 worker 结束前总有待发送的消息
+	activity := a.Watchdog(*stallTimeout, nil)
+	// 精确的已发送计数，consumer -producer-url 据此判断是否消费完
+	endpoint := control.NewEndpoint("producer")
+	a.Handle(control.Path, "sent counters", endpoint)
+	a.ServeDiagnostics(fmt.Sprintf("localhost:%d", *pprofPort))
+	if *metricsPort != 0 {
+		a.ServeMetrics(fmt.Sprintf(":%d", *metricsPort))
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	sizes := payload.SizeDistribution(payload.Fixed(*messageSize))
+	if *sizeDist != "" {
+		var err error
+		if sizes, err = payload.ParseSizeDistribution(*sizeDist); err != nil {
+			log.Fatalf("Invalid -size-dist: %v", err)
+		}
+	}
+	if err := validateChunking(sizes); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *compressible < 0 || *compressible > 1 {
+		log.Fatalf("Invalid -compressibility %v: must be within [0, 1]", *compressible)
+	}
+
+	payloadEncoding, err := payload.ParseEncoding(*encoding)
+	if err != nil {
+		log.Fatalf("Invalid -encoding: %v", err)
+	}
+
+	progressFormat, err := progress.ParseFormat(*progressFmt)
+	if err != nil {
+		log.Fatalf("Invalid -progress-format: %v", err)
+	}
+	if *progressIntv <= 0 {
+		log.Fatalf("Invalid -progress-interval %v: must be positive", *progressIntv)
+	}
+
+	producerAccessMode, err := parseAccessMode(*accessMode)
+	if err != nil {
+		log.Fatalf("Invalid -access-mode: %v", err)
+	}
+	if err := validateLead(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *asyncWindow < 0 || *maxPending < 0 {
+		log.Fatalf("-async-window and -max-pending must be >= 0")
+	}
+	if err := validateProperties(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := validateRetry(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *sendRate < 0 || (*sendRate > 0 && *traceFile != "") {
+		log.Fatalf("-rate must be >= 0 and cannot be combined with -trace (the trace sets the timing)")
+	}
+	var sweepSettings []sweepSetting
+	if *compSweep != "" {
+		if sweepSettings, err = parseSweep(*compSweep); err != nil {
+			log.Fatalf("Invalid -compression-sweep: %v", err)
+		}
+		if *traceFile != "" || *producerName != "" || *accessMode != "shared" || *verifyExcl {
+			log.Fatalf("-compression-sweep cannot be combined with -trace, -name, -verify-exclusive or a non-shared -access-mode")
+		}
+		if *compressible == 0 {
+			log.Printf("Warning: -compression-sweep with -compressibility=0 sends random payloads that do not compress")
+		}
+	}
+
+	// 轨迹回放: 消息数、大小和 key 都来自轨迹
+	var replay *trace.Trace
+	if *traceFile != "" {
+		if *traceSpeed < 0 {
+			log.Fatalf("Invalid -trace-speed %v: must be >= 0", *traceSpeed)
+		}
+		if replay, err = trace.Read(*traceFile); err != nil {
+			log.Fatalf("Failed to read trace: %v", err)
+		}
+		*totalSize = replay.Bytes()
+	}
 
 	log.Println("========== Producer Config ==========")
 	log.Printf("  URL: %s", *pulsarURL)
-	log.Printf("  Topic: %s", *topic)
-	log.Printf("  Message size: %d bytes", *messageSize)
-	log.Printf("  Total size: %.2f MB", float64(*totalSize)/1024/1024)
+	if *listenerName != "" {
+		log.Printf("  Listener: %s", *listenerName)
+	}
+	log.Printf("  Topic: %s (partition discovery every %v, 0=client default)", *topic, *partDiscover)
+	log.Printf("  Message size: %d bytes (%s)", *messageSize, sizes)
+	log.Printf("  Compressibility: %.2f, header: %v, encoding: %s", *compressible, *withHeader, payloadEncoding)
+	log.Printf(metrics.Unitf("  Total size: %.2f MB"), metrics.InUnit(*totalSize))
 	log.Printf("  Concurrency: %d", *concurrency)
+	if *sendRate > 0 {
+		log.Printf("  Rate: %.0f msg/s", *sendRate)
+	}
+	if *asyncWindow > 0 {
+		log.Printf("  Async: up to %d in-flight messages per worker, max pending %d (0=client default 1000)", *asyncWindow, *maxPending)
+	}
+	log.Printf("  Batching: %v delay, max %d msgs, max %d bytes (0=client default), properties: %s", *batchingTime, *batchingMsgs, *batchingSize, *propsMode)
+	log.Printf("  Exact total: %v", *exactTotal)
+	if replay != nil {
+		log.Printf("  Trace: %s (%d messages over %v, speed %.2fx)",
+			*traceFile, len(replay.Records), replay.Duration().Round(time.Millisecond), *traceSpeed)
+	}
+	log.Printf("  Seed: %d", *seed)
+	log.Printf("  Results: %s", layout.Dir)
+	log.Printf("  Progress: %s every %v", progressFormat, *progressIntv)
 	log.Printf("  Compression: %s", *compression)
+	if *chunking {
+		log.Printf("  Chunking: enabled (batching disabled), chunk size %d (0=broker max)", *chunkSize)
+	}
+	if sweepSettings != nil {
+		log.Printf("  Compression sweep: %d phases (%s)", len(sweepSettings), *compSweep)
+	}
+	log.Printf("  Keys: %d (0=none)", *keySpace)
+	log.Printf("  Replication clusters: %q (disabled: %v)", *replClusters, *disableRepl)
+	log.Printf("  Name: %q, access mode: %s", *producerName, *accessMode)
+	log.Printf("  Flush interval: %v (0=end only)", *flushEvery)
+	if leadEnabled() {
+		log.Printf("  Lead: at most %d msgs / %d MB ahead of %s (0=no limit), polled every %v", *leadMessages, *leadMB, *consumerURL, *leadPoll)
+	}
+	log.Printf("  Memory limit: %d bytes, disable block: %v", *memoryLimit, *disableBlock)
+	log.Printf("  Connections per broker: %d (0=default 1), max idle: %v (0=default)", *maxConns, *connMaxIdle)
+	log.Printf("  Send timeout: %v, max reconnect: %d (-1=unlimited), initial backoff: %v", *sendTimeout, *maxReconnect, *backoffStart)
+	if *sendRetries > 0 {
+		log.Printf("  Send retries: %d, backoff %v doubling up to %v", *sendRetries, *retryBackoff, *retryMaxWait)
+	}
+	log.Printf("  Operation timeout: %v, connection timeout: %v, keep-alive: %v (0=default)", *opTimeout, *connTimeout, *keepAlive)
 	log.Printf("  pprof: http://localhost:%d/debug/pprof/", *pprofPort)
 	log.Println("======================================")
 
+	if *precheckFlag {
+		// 客户端 memory limit 为 0 时按默认的 64MB 估算，负数不限制
+		need := *memoryLimit
+		if need == 0 {
+			need = 64 << 20
+		}
+		a.Precheck(mainCtx, precheck.Config{
+			ServiceURL:  *pulsarURL,
+			AdminURL:    *adminURL,
+			Topics:      []string{*topic},
+			CreateTopic: *createTopic,
+			MemoryBytes: need,
+		})
+	}
+
 	// 创建客户端
-	client, err := pulsar.NewClient(pulsar.ClientOptions{
+	clientOptions := pulsar.ClientOptions{
 		URL:               *pulsarURL,
-		OperationTimeout:  30 * time.Second,
-		ConnectionTimeout: 30 * time.Second,
-	})
+		ListenerName:      *listenerName,
+		OperationTimeout:  *opTimeout,
+		ConnectionTimeout: *connTimeout,
+		KeepAliveInterval: *keepAlive,
+		MetricsRegisterer: clientMetrics.Registerer(),
+
+		MaxConnectionsPerBroker: *maxConns,
+		ConnectionMaxIdleTime:   *connMaxIdle,
+	}
+	if *memoryLimit > 0 {
+		clientOptions.MemoryLimitBytes = *memoryLimit
+	}
+
+	// 客户端内部的 goroutine 在创建客户端和 producer 时启动，继承 client 标签
+	app.Label(mainCtx, "client")
+	client, err := pulsar.NewClient(clientOptions)
 	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+		a.Exit(results.StatusBrokerError, "failed to create client: %v", err)
 	}
 	defer client.Close()
+	pprof.SetGoroutineLabels(mainCtx)
+
+	// 连接数随时间的变化，与连接池参数对照
+	connSampler := metrics.NewConnectionSampler(clientMetrics)
+	connCtx, stopConnSampler := context.WithCancel(context.Background())
+	connDone := make(chan struct{})
+	go func() {
+		defer close(connDone)
+		connSampler.Run(connCtx, time.Second)
+	}()
+	// 内存和发送计数的逐秒采样，只用于 /metrics 和 /stats/current 的实时观察
+	monitor, err := a.NewMonitor()
+	if err != nil {
+		a.Exit(results.StatusError, "%v", err)
+	}
+	monitor.SetClientMemoryLimit(max(*memoryLimit, 0))
+	monitor.Start(connCtx, time.Second)
 
 	// 确定压缩类型
 	var compressionType pulsar.CompressionType
@@ -81,111 +421,416 @@ func main() {
 	}
 
 	// 创建 producer
-	producer, err := client.CreateProducer(pulsar.ProducerOptions{
+	producerOptions := pulsar.ProducerOptions{
 		Topic:                   *topic,
+		Name:                    *producerName,
 		CompressionType:         compressionType,
 		BatchingMaxPublishDelay: *batchingTime,
-		BatchingMaxMessages:     1000,
-	})
+		BatchingMaxMessages:     *batchingMsgs,
+		BatchingMaxSize:         *batchingSize,
+		MaxPendingMessages:      *maxPending,
+		ProducerAccessMode:      producerAccessMode,
+		SendTimeout:             *sendTimeout,
+		DisableBlockIfQueueFull: *disableBlock,
+
+		PartitionsAutoDiscoveryInterval: *partDiscover,
+	}
+	applyChunking(&producerOptions)
+	if *maxReconnect >= 0 {
+		n := uint(*maxReconnect)
+		producerOptions.MaxReconnectToBroker = &n
+	}
+	if *backoffStart > 0 {
+		producerOptions.BackOffPolicyFunc = func() backoff.Policy {
+			return backoff.NewDefaultBackoffWithInitialBackOff(*backoffStart)
+		}
+	}
+	app.Label(mainCtx, "client")
+	producer, err := client.CreateProducer(producerOptions)
 	if err != nil {
-		log.Fatalf("Failed to create producer: %v", err)
+		a.Exit(results.StatusBrokerError, "failed to create producer: %v", err)
 	}
 	defer producer.Close()
+	log.Printf("Producer created: %s", producer.Name())
+	var sw *sweep
+	if sweepSettings != nil {
+		if sw, err = newSweep(client, producerOptions, sweepSettings, *concurrency, monitor); err != nil {
+			a.Exit(results.StatusBrokerError, "compression sweep: %v", err)
+		}
+		defer sw.close()
+	}
+	pprof.SetGoroutineLabels(mainCtx)
+	before := snapshotTopic(layout, "producer_before", *topic)
 
-	// 生成消息模板
-	messagePayload := make([]byte, *messageSize)
-	rand.Read(messagePayload)
+	exclusionOK := true
+	if *verifyExcl {
+		exclusionOK = verifyExclusion(client, producerOptions, 5*time.Second)
+	}
+
+	// geo-replication 目标集群
+	var replicationClusters []string
+	if *replClusters != "" {
+		replicationClusters = strings.Split(*replClusters, ",")
+	}
+
+	// payload 生成配置，每个 worker 用独立的 Generator
+	payloadConfig := payload.Config{
+		Sizes:           sizes,
+		Compressibility: *compressible,
+		Header:          *withHeader,
+		Encoding:        payloadEncoding,
+		Seed:            *seed,
+	}
+
+	// 跨主机延迟: 头部 publish time 使用 NTP 时间轴
+	publishNow := time.Now
+	var ntp *clock.Estimate
+	if *ntpServer != "" {
+		if ntp, err = clock.Query(*ntpServer, 4, 2*time.Second); err != nil {
+			a.Exit(results.StatusError, "clock offset estimation failed: %v", err)
+		}
+		log.Printf("Clock: %v", ntp)
+		publishNow = ntp.Now
+		payloadConfig.NTPTime = true
+	}
 
 	// 处理信号
-	ctx, cancel := context.WithCancel(context.Background())
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	// ctx 取消后 worker 不再发起新的发送；sendCtx 只在 drain 超时后才取消，
+	// 保证已经发出的消息有机会得到确认
+	ctx, cancel := context.WithCancel(mainCtx)
+	sendCtx, abortSends := context.WithCancel(context.Background())
+	defer abortSends()
+	sigCh := app.Signals()
 	go func() {
 		<-sigCh
-		log.Println("Received signal, stopping...")
+		log.Println("Received signal, stopping new sends and draining...")
 		cancel()
 	}()
 
 	// 统计
 	var sentBytes int64
+	var wireBytes int64 // 含 key、properties 和协议开销的估算线路字节数
 	var sentCount int64
-	var errorCount int64
+	var errorCount int64 // 重试用尽后仍失败的消息数
+	var errorsByKind errorCounters
+	var retried retryStats
+	// 阻塞统计：Send 耗时超过阈值视为被 pending 队列或 MemoryLimitBytes 阻塞
+	var blockedCount int64
+	var blockedNanos int64
+	var sendDone atomic.Bool
+	endpoint.SetSource(func() (int64, int64, bool) {
+		return atomic.LoadInt64(&sentCount), atomic.LoadInt64(&sentBytes), sendDone.Load()
+	})
+	// 优雅退出统计：发送中的消息数，以及 drain 超时被放弃的消息数
+	var inflight int64
+	var abandonedCount int64
+	// 受控积压: 已发出 (含发送中) 的消息数和字节数，与 consumer 已处理的计数比较
+	var issuedCount, issuedBytes int64
+	lead := startLead(ctx, func() (int64, int64) {
+		return atomic.LoadInt64(&issuedCount), atomic.LoadInt64(&issuedBytes)
+	})
 
 	startTime := time.Now()
 
 	// 进度报告
+	reporter := progress.NewReporter(progressFormat, "producer")
+	reporter.SetLabels(a.Labels)
 	go func() {
-		ticker := time.NewTicker(2 * time.Second)
+		if !reporter.Enabled() {
+			return
+		}
+		ticker := monitor.Clock().NewTicker(*progressIntv)
 		defer ticker.Stop()
 		for {
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 				sent := atomic.LoadInt64(&sentBytes)
 				count := atomic.LoadInt64(&sentCount)
 				errors := atomic.LoadInt64(&errorCount)
-				progress := float64(sent) / float64(*totalSize) * 100
-				rate := float64(sent) / time.Since(startTime).Seconds() / 1024 / 1024
-				log.Printf("Progress: %.1f%% | Sent: %.2f MB | Messages: %d | Errors: %d | Rate: %.2f MB/s",
-					progress, float64(sent)/1024/1024, count, errors, rate)
+				blocked := atomic.LoadInt64(&blockedCount)
+				pct := float64(sent) / float64(*totalSize) * 100
+				rate := metrics.InUnit(float64(sent) / time.Since(startTime).Seconds())
+				reporter.Report(fmt.Sprintf(metrics.Unitf("Progress: %.1f%% | Sent: %.2f MB | Messages: %d | Errors: %d | Blocked: %d | Rate: %.2f MB/s"),
+					pct, metrics.InUnit(sent), count, errors, blocked, rate),
+					map[string]any{
+						"percent":  pct,
+						"bytes":    sent,
+						"messages": count,
+						"errors":   errors,
+						"blocked":  blocked,
+						"rate_mbs": rate,
+					})
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
+	// 周期性 Flush
+	var flushes flushStats
+	var flushWg sync.WaitGroup
+	flushCtx, stopFlush := context.WithCancel(ctx)
+	if *flushEvery > 0 {
+		flushWg.Add(1)
+		go func() {
+			defer flushWg.Done()
+			flushLoop(flushCtx, producer, *flushEvery, &flushes)
+		}()
+	}
+
 	// 并发发送
 	var wg sync.WaitGroup
-	messagesPerWorker := int(*totalSize) / *messageSize / *concurrency
+	plan := planWorkload(*totalSize, sizes.Mean(), *concurrency, *exactTotal)
+	expectedMessages, expectedBytes := plan.expectedMessages(), plan.expectedBytes()
+	var replayCh chan replayItem
+	var replayed replayStats
+	if replay != nil {
+		expectedMessages, expectedBytes = int64(len(replay.Records)), replay.Bytes()
+		replayCh = make(chan replayItem)
+		go replayTrace(ctx, replay, *traceSpeed, replayCh, &replayed)
+	}
+	// 供校验工具解析的期望值
+	log.Printf("Expected messages: %d (%d bytes)", expectedMessages, expectedBytes)
+	if sw != nil {
+		sw.begin()
+	}
+	var shares []int
+	if replay == nil {
+		shares = plan.perWorker
+	}
+	workers := newWorkerTracker(*concurrency, shares)
+	pace := newPacer(*sendRate)
 
 	for i := 0; i < *concurrency; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
+			gen := payload.NewGenerator(payloadConfig, int64(workerID))
+			// CPU profile 按 worker 和压缩阶段分组
+			labels := app.Label(ctx, "worker", "worker", strconv.Itoa(workerID))
+			// -compression-sweep: 当前阶段决定使用的 producer
+			phase := 0
+			if sw != nil {
+				app.Label(labels, "worker", "phase", sw.settings[phase].label)
+				defer func() { sw.finish(phase) }()
+			}
+			// -async-window: 每个 worker 最多 window 条发送中的消息；阶段切换和退出前等它们全部确认
+			var window chan struct{}
+			if *asyncWindow > 0 {
+				window = make(chan struct{}, *asyncWindow)
+				defer drainWindow(sendCtx, window)
+			}
+
+			// send 发送一条消息，发送被 drain 超时放弃时返回 false
+			send := func(j, size int, key string) bool {
+				if pace != nil && pace.wait(ctx) != nil {
+					return false
+				}
+				if lead != nil {
+					if lead.Wait(ctx, atomic.LoadInt64(&issuedCount), atomic.LoadInt64(&issuedBytes), int64(size)) != nil {
+						return false
+					}
+					atomic.AddInt64(&issuedCount, 1)
+					atomic.AddInt64(&issuedBytes, int64(size))
+				}
+				data := gen.Build(size, uint32(workerID), uint64(j), publishNow())
+				if bareMessages() {
+					key = ""
+				}
+
+				msg := &pulsar.ProducerMessage{
+					Payload:             data,
+					Key:                 key,
+					Properties:          messageProperties(workerID, j, publishNow()),
+					ReplicationClusters: replicationClusters,
+					DisableReplication:  *disableRepl,
+				}
+				p, ph := producer, phase
+				if sw != nil {
+					p = sw.producers[ph]
+					msg.Properties[payload.PhaseProperty] = sw.settings[ph].label
+				}
+				// 没有头部 (关闭或消息太小) 时通过 property 携带 CRC，消费端仍可校验完整性
+				if !bareMessages() && (!*withHeader || len(data) < payload.HeaderSize) {
+					msg.Properties[payload.ChecksumProperty] = payload.Checksum(data)
+				}
+
+				// done 记录发送的最终结果 (attempt 为已重试次数)，发送被 drain 超时放弃时返回 false；异步发送时在回调中执行
+				done := func(err error, attempt int) bool {
+					if err != nil {
+						if sendCtx.Err() != nil {
+							atomic.AddInt64(&abandonedCount, 1)
+							return false
+						}
+						atomic.AddInt64(&errorCount, 1)
+						workers.failed(workerID)
+						kind := errorsByKind.add(err)
+						logging.Warnf("Worker %d: Send error (%s): %v", workerID, kind, err)
+						return true
+					}
+
+					atomic.AddInt64(&sentBytes, int64(len(data)))
+					atomic.AddInt64(&wireBytes, metrics.EstimateWireSize(len(msg.Payload), msg.Key, msg.Properties))
+					atomic.AddInt64(&sentCount, 1)
+					if attempt > 0 {
+						atomic.AddInt64(&retried.recovered, 1)
+					}
+					workers.sent(workerID)
+					monitor.RecordMessage(int64(len(data)))
+					if sw != nil {
+						sw.record(ph, len(data))
+					}
+					activity.Touch()
+					return true
+				}
+
+				// 异步发送时阻塞指的是 SendAsync 本身 (pending 队列或内存上限已满)，而不是确认耗时
+				sendStart := time.Now()
+				atomic.AddInt64(&inflight, 1)
+				if window != nil {
+					select {
+					case window <- struct{}{}:
+					case <-sendCtx.Done():
+						atomic.AddInt64(&inflight, -1)
+						atomic.AddInt64(&abandonedCount, 1)
+						return false
+					}
+					// 重试在新的 goroutine 中等待并重新 SendAsync，不阻塞客户端的回调；重试期间消息仍占用窗口槽位
+					attempt := 0
+					var callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)
+					callback = func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+						if err != nil && attempt < *sendRetries && sendCtx.Err() == nil {
+							attempt++
+							go func() {
+								if retried.wait(sendCtx, workerID, attempt, err) {
+									p.SendAsync(sendCtx, msg, callback)
+									return
+								}
+								atomic.AddInt64(&inflight, -1)
+								done(err, attempt)
+								<-window
+							}()
+							return
+						}
+						atomic.AddInt64(&inflight, -1)
+						done(err, attempt)
+						<-window
+					}
+					sendStart = time.Now()
+					p.SendAsync(sendCtx, msg, callback)
+					recordBlocked(time.Since(sendStart), &blockedCount, &blockedNanos)
+					return sendCtx.Err() == nil
+				}
+				for attempt := 0; ; attempt++ {
+					_, err := p.Send(sendCtx, msg)
+					recordBlocked(time.Since(sendStart), &blockedCount, &blockedNanos)
+					if err == nil || attempt >= *sendRetries || sendCtx.Err() != nil || !retried.wait(sendCtx, workerID, attempt+1, err) {
+						atomic.AddInt64(&inflight, -1)
+						return done(err, attempt)
+					}
+					sendStart = time.Now()
+				}
+			}
+
+			// 轨迹回放: 调度 goroutine 按时间分发，ctx 取消后 replayCh 关闭
+			if replayCh != nil {
+				for item := range replayCh {
+					if !send(item.seq, item.rec.Size, item.rec.Key) {
+						return
+					}
+				}
+				return
+			}
 
-			for j := 0; j < messagesPerWorker; j++ {
+			for j := 0; j < plan.perWorker[workerID]; j++ {
 				select {
 				case <-ctx.Done():
 					return
 				default:
 				}
-
-				// 每条消息稍微变化一下，避免压缩效果太好
-				payload := make([]byte, *messageSize)
-				copy(payload, messagePayload)
-				payload[0] = byte(workerID)
-				payload[1] = byte(j % 256)
-				payload[2] = byte((j / 256) % 256)
-
-				_, err := producer.Send(ctx, &pulsar.ProducerMessage{
-					Payload: payload,
-					Properties: map[string]string{
-						"worker":    fmt.Sprintf("%d", workerID),
-						"sequence":  fmt.Sprintf("%d", j),
-						"timestamp": fmt.Sprintf("%d", time.Now().UnixNano()),
-					},
-				})
-
-				if err != nil {
-					if ctx.Err() != nil {
-						return
+				if sw != nil {
+					if k := sw.phaseOf(j, plan.perWorker[workerID]); k != phase {
+						if window != nil {
+							drainWindow(sendCtx, window)
+						}
+						ok := sw.enter(ctx, phase, k)
+						phase = k
+						app.Label(labels, "worker", "phase", sw.settings[phase].label)
+						if !ok {
+							return
+						}
 					}
-					atomic.AddInt64(&errorCount, 1)
-					log.Printf("Worker %d: Send error: %v", workerID, err)
-					continue
 				}
 
-				atomic.AddInt64(&sentBytes, int64(*messageSize))
-				atomic.AddInt64(&sentCount, 1)
+				size := gen.NextSize()
+				if plan.isTail(workerID, j) {
+					size = plan.tailSize
+				}
+				var key string
+				if *keySpace > 0 {
+					key = fmt.Sprintf("key-%d", j%*keySpace)
+				}
+				if !send(j, size, key) {
+					return
+				}
 			}
 		}(i)
 	}
 
-	wg.Wait()
+	workersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+	if *stallTimeout > 0 {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go func() {
+			<-workersDone
+			stopWatch()
+		}()
+		activity.Touch()
+		go activity.Run(watchCtx)
+	}
 
-	// 确保所有消息都发送完成
-	producer.Flush()
+	interrupted := false
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		interrupted = true
+		log.Printf("Draining %d in-flight sends (timeout %v)...", atomic.LoadInt64(&inflight), *drainTimeout)
+		select {
+		case <-workersDone:
+		case <-time.After(*drainTimeout):
+			log.Printf("Drain timeout, abandoning %d in-flight sends", atomic.LoadInt64(&inflight))
+			abortSends()
+			<-workersDone
+		}
+	}
+	stopFlush()
+	flushWg.Wait()
+
+	// 确保所有消息都发送完成；被中断时 flush 同样受 drain 超时约束
+	if interrupted {
+		finalCtx, finalCancel := context.WithTimeout(sendCtx, *drainTimeout)
+		if err := producer.FlushWithCtx(finalCtx); err != nil {
+			log.Printf("Final flush failed: %v", err)
+		}
+		finalCancel()
+	} else {
+		producer.Flush()
+	}
+	if sw != nil {
+		sw.flush(sendCtx)
+	}
+	sendDone.Store(true)
+	stopConnSampler()
+	<-connDone
+	monitor.Stop()
+	connStats, connSeries := connSampler.Stats()
 
 	elapsed := time.Since(startTime)
+	workerStats, stragglers, stuckWorkers := workers.stats(time.Now())
 	finalSent := atomic.LoadInt64(&sentBytes)
 	finalCount := atomic.LoadInt64(&sentCount)
 	finalErrors := atomic.LoadInt64(&errorCount)
@@ -193,10 +838,164 @@ func main() {
 	log.Println("")
 	log.Println("========== Producer Summary ==========")
 	log.Printf("  Duration:     %v", elapsed.Round(time.Millisecond))
-	log.Printf("  Messages:     %d", finalCount)
-	log.Printf("  Data size:    %.2f MB", float64(finalSent)/1024/1024)
+	log.Printf("  Messages:     %d / %d expected", finalCount, expectedMessages)
+	if interrupted {
+		log.Printf("  Confirmed:    %d", finalCount)
+		log.Printf("  Abandoned:    %d", atomic.LoadInt64(&abandonedCount))
+	}
+	log.Printf(metrics.Unitf("  Data size:    %.2f MB"), metrics.InUnit(finalSent))
+	finalWire := atomic.LoadInt64(&wireBytes)
+	if finalSent > 0 {
+		log.Printf(metrics.Unitf("  Wire size:    %.2f MB (estimated, +%.1f%% headers/properties)"),
+			metrics.InUnit(finalWire), float64(finalWire-finalSent)/float64(finalSent)*100)
+	}
 	log.Printf("  Errors:       %d", finalErrors)
-	log.Printf("  Throughput:   %.2f MB/s", float64(finalSent)/elapsed.Seconds()/1024/1024)
+	if *sendRetries > 0 {
+		log.Printf("  Retries:      %d | recovered: %d messages | failed after %d retries: %d messages",
+			atomic.LoadInt64(&retried.retries), atomic.LoadInt64(&retried.recovered), *sendRetries, finalErrors)
+	}
+	for kind := sendErrorKind(0); kind < numErrorKinds; kind++ {
+		if n := errorsByKind.load(kind); n > 0 {
+			log.Printf("    %-11s %d", kind.String()+":", n)
+		}
+	}
+	finalBlocked := atomic.LoadInt64(&blockedCount)
+	log.Printf("  Blocked:      %d sends (> %v), total %v", finalBlocked, *blockedAfter,
+		time.Duration(atomic.LoadInt64(&blockedNanos)).Round(time.Millisecond))
+	if *flushEvery > 0 {
+		log.Printf("  Flushes:      %d (errors: %d) | avg: %v | max: %v", flushes.count, flushes.errors,
+			flushes.avg().Round(time.Microsecond), flushes.max.Round(time.Microsecond))
+	}
+	if replay != nil {
+		log.Printf("  Trace replay: %d dispatched | late (> %v): %d | max lag: %v", replayed.dispatched,
+			replayLateThreshold, replayed.late, replayed.maxLag.Round(time.Millisecond))
+	}
+	if lead != nil {
+		log.Printf("  Lead:         %s", leadSummary(lead.Stats()))
+	}
+	if connStats != nil {
+		log.Printf("  Connections:  max %.0f, avg %.1f | opened %.0f, closed %.0f", connStats.Max, connStats.Avg, connStats.Opened, connStats.Closed)
+	}
+	printWorkers(workerStats, stragglers, stuckWorkers)
+	log.Printf(metrics.Unitf("  Throughput:   %.2f MB/s"), metrics.InUnit(float64(finalSent)/elapsed.Seconds()))
 	log.Printf("  TPS:          %.0f msg/s", float64(finalCount)/elapsed.Seconds())
+	log.Println("")
+	log.Println(metrics.FormatMachine("machine-summary:", []metrics.MachineField{
+		{Key: "duration_ns", Value: int64(elapsed)},
+		{Key: "messages", Value: finalCount},
+		{Key: "expected_messages", Value: expectedMessages},
+		{Key: "message_bytes", Value: finalSent},
+		{Key: "wire_bytes", Value: finalWire},
+		{Key: "errors", Value: finalErrors},
+		{Key: "blocked", Value: finalBlocked},
+		{Key: "bytes_per_second", Value: float64(finalSent) / elapsed.Seconds()},
+	}))
 	log.Println("=======================================")
+	if sw != nil {
+		printSweep(sw.results())
+	}
+
+	report := ProducerReport{
+		Labels: a.Labels,
+		Metadata: map[string]string{
+			"scenario":     *scenario,
+			"topic":        *topic,
+			"seed":         strconv.FormatInt(*seed, 10),
+			"message_size": strconv.Itoa(*messageSize),
+			"concurrency":  strconv.Itoa(*concurrency),
+			"rate":         strconv.FormatFloat(*sendRate, 'g', -1, 64),
+			"compression":  *compression,
+			"size_dist":    sizes.String(),
+			"chunking":     strconv.FormatBool(*chunking),
+			"chunk_size":   strconv.Itoa(*chunkSize),
+			"keys":         strconv.Itoa(*keySpace),
+			"properties":   *propsMode,
+			"run_id":       layout.RunID,
+			"trace":        *traceFile,
+			"trace_speed":  strconv.FormatFloat(*traceSpeed, 'g', -1, 64),
+
+			"url":                        *pulsarURL,
+			"listener_name":              *listenerName,
+			"max_connections_per_broker": strconv.Itoa(*maxConns),
+			"connection_max_idle":        connMaxIdle.String(),
+			"operation_timeout":          opTimeout.String(),
+			"connection_timeout":         connTimeout.String(),
+			"keep_alive":                 keepAlive.String(),
+			"send_timeout":               sendTimeout.String(),
+			"send_retries":               strconv.Itoa(*sendRetries),
+			"retry_backoff":              retryBackoff.String(),
+			"retry_max_backoff":          retryMaxWait.String(),
+			"max_reconnect":              strconv.Itoa(*maxReconnect),
+			"initial_backoff":            backoffStart.String(),
+		},
+		Summary: ProducerSummary{
+			DurationMs:       elapsed.Milliseconds(),
+			ExpectedMessages: expectedMessages,
+			ExpectedBytes:    expectedBytes,
+			MessageCount:     finalCount,
+			MessageBytes:     finalSent,
+			WireBytes:        atomic.LoadInt64(&wireBytes),
+			ErrorCount:       finalErrors,
+			RetryCount:       atomic.LoadInt64(&retried.retries),
+			RecoveredCount:   atomic.LoadInt64(&retried.recovered),
+			ErrorsByKind:     make(map[string]int64),
+			BlockedCount:     finalBlocked,
+			AbandonedCount:   atomic.LoadInt64(&abandonedCount),
+			Connections:      connStats,
+			Workers:          workerStats,
+			Stragglers:       stragglers,
+			StuckWorkers:     stuckWorkers,
+		},
+		ConnectionSeries: connSeries,
+		ClientMetrics:    clientMetrics.Snapshot(),
+	}
+	if lead != nil {
+		s := lead.Stats()
+		report.Summary.Lead = &s
+	}
+	if sw != nil {
+		report.Summary.Sweep = sw.results()
+		report.Metadata["compression_sweep"] = *compSweep
+	}
+	if ntp != nil {
+		report.Metadata["ntp_server"] = ntp.Server
+		report.Metadata["clock_offset_ms"] = strconv.FormatFloat(float64(ntp.Offset)/float64(time.Millisecond), 'f', 3, 64)
+		report.Metadata["clock_rtt_ms"] = strconv.FormatFloat(float64(ntp.RTT)/float64(time.Millisecond), 'f', 3, 64)
+	}
+	for kind := sendErrorKind(0); kind < numErrorKinds; kind++ {
+		if n := errorsByKind.load(kind); n > 0 {
+			report.Summary.ErrorsByKind[kind.String()] = n
+		}
+	}
+	reportPath := layout.File("report", "producer", "json")
+	if err := report.SaveToFile(reportPath); err != nil {
+		log.Printf("Failed to save producer report: %v", err)
+	} else {
+		log.Printf("Producer report saved to: %s", reportPath)
+	}
+	auditPath := layout.File("audit", "producer-audit", "jsonl")
+	if err := monitor.SaveAuditLog(auditPath); err != nil {
+		log.Printf("Failed to save audit log: %v", err)
+	} else {
+		log.Printf("Audit log (%d changes) saved to: %s", len(monitor.GetChanges()), auditPath)
+	}
+	status, reason := evaluateRun(report.Summary, exclusionOK)
+	a.WriteResult(status, reason, resultMetrics(report.Summary))
+
+	if after := snapshotTopic(layout, "producer_after", *topic); after != nil && before != nil {
+		log.Printf(metrics.Unitf("Broker received %d msgs, %.2f MB | storage grew %.2f MB"),
+			after.MsgInCounter-before.MsgInCounter, metrics.InUnit(after.BytesInCounter-before.BytesInCounter),
+			metrics.InUnit(after.StorageSize-before.StorageSize))
+	}
+
+	if err := layout.WriteManifest("producer", report.Metadata); err != nil {
+		log.Printf("Failed to write manifest: %v", err)
+	}
+	if endpoint.WaitDoneRead(controlLinger) {
+		log.Printf("Consumer read the final sent counters")
+	}
+	a.Finish()
+	if code := status.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
 }
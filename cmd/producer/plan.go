@@ -0,0 +1,52 @@
+package main
+
+// workloadPlan 描述每个 worker 要发送的消息数，保证各 worker 之和与 -total 一致
+type workloadPlan struct {
+	messageSize int
+	fullCount   int64 // 完整大小的消息总数
+	tailSize    int   // exact-total 模式下追加的最后一条消息大小 (0 = 无)
+	perWorker   []int
+}
+
+// planWorkload 把 total/size 条消息分给 concurrency 个 worker，余数依次分给前面的 worker；
+// exact 为 true 时 total 不能整除 size 的部分作为一条较小的消息由最后一个 worker 发送
+func planWorkload(totalSize int64, messageSize, concurrency int, exact bool) workloadPlan {
+	p := workloadPlan{
+		messageSize: messageSize,
+		fullCount:   totalSize / int64(messageSize),
+		perWorker:   make([]int, concurrency),
+	}
+	base := int(p.fullCount / int64(concurrency))
+	rem := int(p.fullCount % int64(concurrency))
+	for i := range p.perWorker {
+		p.perWorker[i] = base
+		if i < rem {
+			p.perWorker[i]++
+		}
+	}
+	if exact {
+		p.tailSize = int(totalSize % int64(messageSize))
+		if p.tailSize > 0 {
+			p.perWorker[concurrency-1]++
+		}
+	}
+	return p
+}
+
+// isTail 判断 worker 第 seq 条消息是否是 exact-total 模式追加的尾部消息
+func (p workloadPlan) isTail(workerID, seq int) bool {
+	return p.tailSize > 0 && workerID == len(p.perWorker)-1 && seq == p.perWorker[workerID]-1
+}
+
+// expectedMessages 返回计划发送的消息总数
+func (p workloadPlan) expectedMessages() int64 {
+	if p.tailSize > 0 {
+		return p.fullCount + 1
+	}
+	return p.fullCount
+}
+
+// expectedBytes 返回计划发送的 payload 总字节数
+func (p workloadPlan) expectedBytes() int64 {
+	return p.fullCount*int64(p.messageSize) + int64(p.tailSize)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// -properties 的取值
+const (
+	propsFull = "full" // worker、sequence、timestamp
+	propsNone = "none" // 不加描述性 properties，crc32、phase 和 key 仍按需加入
+	propsBare = "bare" // 不带任何 property 和 key，只有 payload，作为元数据开销的基线
+)
+
+// validateProperties 检查 -properties 及与之冲突的参数
+func validateProperties() error {
+	switch *propsMode {
+	case propsFull, propsNone:
+		return nil
+	case propsBare:
+	default:
+		return fmt.Errorf("invalid -properties %q: want full, none or bare", *propsMode)
+	}
+	if *keySpace > 0 || *compSweep != "" {
+		return fmt.Errorf("-properties=bare sends no keys or phase property; it cannot be combined with -keys or -compression-sweep")
+	}
+	if !*withHeader {
+		log.Printf("Warning: -properties=bare with -payload-header=false sends no checksum; consumer verification counts messages as unverifiable")
+	}
+	return nil
+}
+
+// bareMessages -properties=bare: 消息不带 property 和 key (-trace 中的 key 也丢弃)
+func bareMessages() bool {
+	return *propsMode == propsBare
+}
+
+// messageProperties 每条消息的 properties；none 时为空 map，之后仍可能加入 phase、crc32；bare 时为 nil
+func messageProperties(worker, seq int, now time.Time) map[string]string {
+	switch *propsMode {
+	case propsBare:
+		return nil
+	case propsNone:
+		return map[string]string{}
+	}
+	return map[string]string{
+		"worker":    strconv.Itoa(worker),
+		"sequence":  strconv.Itoa(seq),
+		"timestamp": strconv.FormatInt(now.UnixNano(), 10),
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// pacer 把 -rate 的发送时刻依次分给所有 worker: 第 n 次发送不早于 start + n/rate，
+// 发送被阻塞而落后于计划时，之后的发送不再等待直到追上
+type pacer struct {
+	start    time.Time
+	interval float64 // 每条消息的纳秒数
+	n        atomic.Int64
+}
+
+// newPacer -rate 为 0 时返回 nil
+func newPacer(rate float64) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &pacer{start: time.Now(), interval: float64(time.Second) / rate}
+}
+
+// wait 等到下一个发送时刻，ctx 取消时返回其错误
+func (p *pacer) wait(ctx context.Context) error {
+	due := p.start.Add(time.Duration(float64(p.n.Add(1)-1) * p.interval))
+	d := time.Until(due)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
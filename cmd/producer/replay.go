@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"pulsar-memory-test/pkg/trace"
+)
+
+// replayLateThreshold 分发晚于轨迹时间超过此值的消息计为 late
+const replayLateThreshold = 10 * time.Millisecond
+
+// replayItem 分发给 worker 的一条轨迹记录，seq 为其在轨迹中的序号
+type replayItem struct {
+	seq int
+	rec trace.Record
+}
+
+// replayStats 回放调度统计: worker 被 Send 阻塞时消息会晚于轨迹时间发出
+type replayStats struct {
+	dispatched int64
+	late       int64
+	maxLag     time.Duration
+}
+
+// replayTrace 按轨迹中的时间间隔把记录分发到 out，speed 为回放倍速 (0 = 不等待，尽快发送)；
+// 结束或 ctx 取消时关闭 out。stats 只在 out 关闭后读取
+func replayTrace(ctx context.Context, t *trace.Trace, speed float64, out chan<- replayItem, stats *replayStats) {
+	defer close(out)
+	if len(t.Records) == 0 {
+		return
+	}
+	start := time.Now()
+	base := t.Records[0].Offset
+	for i, rec := range t.Records {
+		due := start
+		if speed > 0 {
+			due = start.Add(time.Duration(float64(rec.Offset-base) / speed))
+			// 间隔很小时直接发送，避免每条消息一次定时器
+			if d := time.Until(due); d > time.Millisecond {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+		}
+		select {
+		case out <- replayItem{seq: i, rec: rec}:
+		case <-ctx.Done():
+			return
+		}
+		stats.dispatched++
+		if speed > 0 {
+			lag := time.Since(due)
+			if lag > replayLateThreshold {
+				stats.late++
+			}
+			stats.maxLag = max(stats.maxLag, lag)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"pulsar-memory-test/pkg/control"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// ProducerReport 生产端结果文件 producer_<scenario>.json
+type ProducerReport struct {
+	Metadata map[string]string `json:"metadata"`
+	Labels   map[string]string `json:"labels,omitempty"` // -labels
+	Summary  ProducerSummary   `json:"summary"`
+	// ClientMetrics 结束时 pulsar-client-go 内部指标快照
+	ClientMetrics map[string]float64 `json:"client_metrics,omitempty"`
+	// ConnectionSeries 每秒一次的连接数
+	ConnectionSeries []metrics.ConnectionPoint `json:"connection_series,omitempty"`
+}
+
+// ProducerSummary 生产端统计摘要
+type ProducerSummary struct {
+	DurationMs       int64            `json:"duration_ms"`
+	ExpectedMessages int64            `json:"expected_messages"`
+	ExpectedBytes    int64            `json:"expected_bytes"`
+	MessageCount     int64            `json:"message_count"`
+	MessageBytes     int64            `json:"message_bytes"`
+	WireBytes        int64            `json:"wire_bytes"`
+	ErrorCount       int64            `json:"error_count"`     // 重试用尽后仍失败、未发出的消息
+	RetryCount       int64            `json:"retry_count"`     // -send-retries 的重试次数
+	RecoveredCount   int64            `json:"recovered_count"` // 重试之后发送成功的消息
+	ErrorsByKind     map[string]int64 `json:"errors_by_kind,omitempty"`
+	BlockedCount     int64            `json:"blocked_count"`
+	AbandonedCount   int64            `json:"abandoned_count"`
+
+	// -lead-messages/-lead-mb 受控积压的实际领先量
+	Lead *control.LeadStats `json:"lead,omitempty"`
+	// 发送期间的连接数，对照 -max-connections-per-broker/-connection-max-idle
+	Connections *metrics.ConnectionStats `json:"connections,omitempty"`
+	// -compression-sweep 各阶段的吞吐和压缩比
+	Sweep []SweepPhase `json:"sweep,omitempty"`
+	// 各 worker 的发送量，以及发送速率明显低于其它 worker、或中途停止发送的 worker 数
+	Workers      []WorkerStats `json:"workers,omitempty"`
+	Stragglers   int           `json:"stragglers"`
+	StuckWorkers int           `json:"stuck_workers"`
+}
+
+// SaveToFile 保存生产端结果
+func (r *ProducerReport) SaveToFile(filename string) error {
+	return results.WriteFile(filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// evaluateRun 判定生产端结论: 排他性检查失败为 verification_failure，
+// 连接或超时类发送错误为 broker_error (queue_full 是 -disable-block 下的预期结果，不计入)
+func evaluateRun(s ProducerSummary, exclusionOK bool) (results.Status, string) {
+	if !exclusionOK {
+		return results.StatusVerification, "second producer was not excluded (-verify-exclusive)"
+	}
+	broker := s.ErrorsByKind[errKindConnection.String()] + s.ErrorsByKind[errKindTimeout.String()]
+	if broker > 0 {
+		return results.StatusBrokerError, fmt.Sprintf("%d sends failed with connection/timeout errors", broker)
+	}
+	return results.StatusOK, ""
+}
+
+// resultMetrics result.json 中的关键指标
+func resultMetrics(s ProducerSummary) map[string]float64 {
+	return map[string]float64{
+		"duration_s":    float64(s.DurationMs) / 1000,
+		"messages":      float64(s.MessageCount),
+		"message_bytes": float64(s.MessageBytes),
+		"errors":        float64(s.ErrorCount),
+		"retries":       float64(s.RetryCount),
+		"recovered":     float64(s.RecoveredCount),
+		"blocked":       float64(s.BlockedCount),
+		"abandoned":     float64(s.AbandonedCount),
+		"stragglers":    float64(s.Stragglers),
+		"stuck_workers": float64(s.StuckWorkers),
+	}
+}
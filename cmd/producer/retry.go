@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"pulsar-memory-test/pkg/logging"
+)
+
+// validateRetry 检查 -send-retries/-retry-backoff/-retry-max-backoff
+func validateRetry() error {
+	if *sendRetries < 0 {
+		return fmt.Errorf("-send-retries must be >= 0")
+	}
+	if *sendRetries > 0 && (*retryBackoff <= 0 || *retryMaxWait < *retryBackoff) {
+		return fmt.Errorf("-retry-backoff must be > 0 and -retry-max-backoff >= -retry-backoff")
+	}
+	return nil
+}
+
+// retryDelay 第 attempt 次重试 (从 1 开始) 前的等待: -retry-backoff 每次翻倍，不超过 -retry-max-backoff
+func retryDelay(attempt int) time.Duration {
+	d := *retryBackoff
+	for i := 1; i < attempt && d < *retryMaxWait; i++ {
+		d *= 2
+	}
+	return min(d, *retryMaxWait)
+}
+
+// retryStats 发送重试统计，可并发更新
+type retryStats struct {
+	retries   int64 // 重试次数
+	recovered int64 // 重试之后发送成功的消息数
+}
+
+// wait 发送失败后等待第 attempt 次重试；ctx 取消 (drain 超时) 时返回 false，消息按放弃处理
+func (r *retryStats) wait(ctx context.Context, workerID, attempt int, err error) bool {
+	atomic.AddInt64(&r.retries, 1)
+	d := retryDelay(attempt)
+	logging.Warnf("Worker %d: Send error (%s), retry %d/%d in %v: %v", workerID, classifySendError(err), attempt, *sendRetries, d, err)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// sweepSetting -compression-sweep 中的一种压缩设置
+type sweepSetting struct {
+	label string // 原样写入消息的 phase property，如 zstd:better
+	typ   pulsar.CompressionType
+	level pulsar.CompressionLevel
+}
+
+// parseSweep 解析 -compression-sweep，逗号分隔的 type[:level]，
+// type 为 none|lz4|zlib|zstd，level 为 default|faster|better
+func parseSweep(s string) ([]sweepSetting, error) {
+	var out []sweepSetting
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		name, lvl, hasLevel := strings.Cut(item, ":")
+		var st sweepSetting
+		switch name {
+		case "none":
+			st.typ = pulsar.NoCompression
+		case "lz4":
+			st.typ = pulsar.LZ4
+		case "zlib":
+			st.typ = pulsar.ZLib
+		case "zstd":
+			st.typ = pulsar.ZSTD
+		default:
+			return nil, fmt.Errorf("unknown compression %q in %q", name, item)
+		}
+		if hasLevel {
+			switch lvl {
+			case "default":
+				st.level = pulsar.Default
+			case "faster":
+				st.level = pulsar.Faster
+			case "better":
+				st.level = pulsar.Better
+			default:
+				return nil, fmt.Errorf("unknown compression level %q in %q (default, faster, better)", lvl, item)
+			}
+			if st.typ == pulsar.NoCompression {
+				return nil, fmt.Errorf("%q: none has no compression level", item)
+			}
+		}
+		st.label = item
+		if slices.ContainsFunc(out, func(o sweepSetting) bool { return o.label == item }) {
+			return nil, fmt.Errorf("duplicate setting %q", item)
+		}
+		out = append(out, st)
+	}
+	if len(out) < 2 {
+		return nil, fmt.Errorf("need at least two settings, got %q", s)
+	}
+	return out, nil
+}
+
+// SweepPhase 压缩扫描中一个阶段的结果，写入 producer 报告
+type SweepPhase struct {
+	Compression string  `json:"compression"`
+	Messages    int64   `json:"messages"`
+	Bytes       int64   `json:"bytes"`
+	DurationMs  int64   `json:"duration_ms"`
+	MsgsPerSec  float64 `json:"msgs_per_s"`
+	BytesPerSec float64 `json:"bytes_per_s"`
+	// -topic-stats 时 broker 端 bytesInCounter 的增量，即压缩后的线路字节数
+	BrokerBytesIn int64   `json:"broker_bytes_in,omitempty"`
+	Ratio         float64 `json:"compression_ratio,omitempty"` // Bytes / BrokerBytesIn
+}
+
+// sweep 把一次运行分成 len(settings) 个阶段，每个阶段用一个独立的 producer 发送 total/N 的数据。
+// 阶段之间是所有 worker 的屏障，阶段耗时即该压缩设置下的发送耗时；每条消息带 phase property，
+// 消费端据此分段统计内存。
+type sweep struct {
+	settings  []sweepSetting
+	producers []pulsar.Producer
+	workers   int
+	admin     *admin.Client // -topic-stats 时读取 bytesInCounter
+	monitor   *metrics.MemoryMonitor
+
+	mu       sync.Mutex      // 保护 arrived、start 和 brokerIn
+	arrived  []int           // 到达边界 k (阶段 k-1 结束) 的 worker 数，k = 1..N
+	release  []chan struct{} // 所有 worker 到达边界 k 后关闭
+	start    []time.Time     // 阶段 k 的开始时间，start[N] 为结束时间
+	brokerIn []int64         // 边界处的 bytesInCounter，-1 表示读取失败
+	messages []atomic.Int64
+	bytes    []atomic.Int64
+}
+
+// newSweep 为每种设置创建一个 producer，其余选项与 base 相同
+func newSweep(client pulsar.Client, base pulsar.ProducerOptions, settings []sweepSetting, workers int, monitor *metrics.MemoryMonitor) (*sweep, error) {
+	n := len(settings)
+	s := &sweep{
+		settings: settings,
+		workers:  workers,
+		monitor:  monitor,
+		arrived:  make([]int, n+1),
+		release:  make([]chan struct{}, n+1),
+		start:    make([]time.Time, n+1),
+		brokerIn: make([]int64, n+1),
+		messages: make([]atomic.Int64, n),
+		bytes:    make([]atomic.Int64, n),
+	}
+	for k := range s.release {
+		s.release[k] = make(chan struct{})
+	}
+	if *topicStats {
+		s.admin = admin.New(*adminURL)
+	}
+	for _, st := range settings {
+		opts := base
+		opts.CompressionType = st.typ
+		opts.CompressionLevel = st.level
+		p, err := client.CreateProducer(opts)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("create producer for %s: %w", st.label, err)
+		}
+		s.producers = append(s.producers, p)
+	}
+	return s, nil
+}
+
+// begin 在 worker 启动前调用，开始第一个阶段
+func (s *sweep) begin() {
+	s.start[0] = time.Now()
+	s.brokerIn[0] = s.bytesIn()
+	log.Printf("=== Sweep phase 1/%d: %s ===", len(s.settings), s.settings[0].label)
+}
+
+// phaseOf worker 的第 j 条 (共 n 条) 消息所属的阶段
+func (s *sweep) phaseOf(j, n int) int {
+	return j * len(s.settings) / n
+}
+
+// enter worker 从阶段 from 进入阶段 to 前调用，等所有 worker 完成之前的阶段；ctx 取消时返回 false
+func (s *sweep) enter(ctx context.Context, from, to int) bool {
+	for k := from + 1; k <= to; k++ {
+		s.arrive(k)
+	}
+	select {
+	case <-s.release[to]:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// finish worker 退出时调用 (defer)，from 为它所在的阶段，到达之后的所有边界，避免其他 worker 等待它
+func (s *sweep) finish(from int) {
+	for k := from + 1; k <= len(s.settings); k++ {
+		s.arrive(k)
+	}
+}
+
+// arrive 到达边界 k，最后一个到达的 worker 结束阶段 k-1；边界处的时间和计数都在锁内写入
+func (s *sweep) arrive(k int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.arrived[k]++
+	if s.arrived[k] < s.workers {
+		return
+	}
+	s.start[k] = time.Now()
+	s.brokerIn[k] = s.bytesIn()
+	p := s.phase(k - 1)
+	log.Printf(metrics.Unitf("Sweep phase %d/%d (%s) done: %d msgs, %.2f MB in %v (%.2f MB/s)"), k, len(s.settings), p.Compression,
+		p.Messages, metrics.InUnit(p.Bytes), (time.Duration(p.DurationMs) * time.Millisecond).Round(time.Millisecond), metrics.InUnit(p.BytesPerSec))
+	if k < len(s.settings) {
+		log.Printf("=== Sweep phase %d/%d: %s ===", k+1, len(s.settings), s.settings[k].label)
+		s.monitor.RecordChange("compression", s.settings[k-1].label, s.settings[k].label,
+			fmt.Sprintf("compression sweep phase %d/%d", k+1, len(s.settings)))
+	}
+	close(s.release[k])
+}
+
+// record 记录阶段 k 中一条发送成功的消息
+func (s *sweep) record(k int, bytes int) {
+	s.messages[k].Add(1)
+	s.bytes[k].Add(int64(bytes))
+}
+
+// bytesIn 读取 broker 端的 bytesInCounter，未开启 -topic-stats 或失败时返回 -1
+func (s *sweep) bytesIn() int64 {
+	if s.admin == nil {
+		return -1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stats, err := s.admin.Stats(ctx, *topic)
+	if err != nil {
+		log.Printf("Sweep: topic stats failed: %v", err)
+		return -1
+	}
+	return stats.BytesInCounter
+}
+
+// phase 阶段 k 的结果；阶段未开始或未结束时耗时为 0
+func (s *sweep) phase(k int) SweepPhase {
+	p := SweepPhase{
+		Compression: s.settings[k].label,
+		Messages:    s.messages[k].Load(),
+		Bytes:       s.bytes[k].Load(),
+	}
+	if s.start[k].IsZero() || s.start[k+1].IsZero() {
+		return p
+	}
+	d := s.start[k+1].Sub(s.start[k])
+	p.DurationMs = d.Milliseconds()
+	if secs := d.Seconds(); secs > 0 {
+		p.MsgsPerSec = float64(p.Messages) / secs
+		p.BytesPerSec = float64(p.Bytes) / secs
+	}
+	if before, after := s.brokerIn[k], s.brokerIn[k+1]; before >= 0 && after > before {
+		p.BrokerBytesIn = after - before
+		p.Ratio = float64(p.Bytes) / float64(p.BrokerBytesIn)
+	}
+	return p
+}
+
+// results 所有阶段的结果，在 worker 全部退出后调用
+func (s *sweep) results() []SweepPhase {
+	out := make([]SweepPhase, len(s.settings))
+	for k := range out {
+		out[k] = s.phase(k)
+	}
+	return out
+}
+
+// flush 等待所有阶段的 producer 发送完成
+func (s *sweep) flush(ctx context.Context) {
+	for i, p := range s.producers {
+		if err := p.FlushWithCtx(ctx); err != nil {
+			log.Printf("Sweep: flush %s failed: %v", s.settings[i].label, err)
+		}
+	}
+}
+
+func (s *sweep) close() {
+	for _, p := range s.producers {
+		p.Close()
+	}
+}
+
+// printSweep 打印各阶段对比表
+func printSweep(phases []SweepPhase) {
+	log.Println("--- Compression sweep ---")
+	unit := string(metrics.Unit())
+	log.Printf("  %-14s %10s %10s %10s %10s %8s", "compression", "msgs", unit, "seconds", unit+"/s", "ratio")
+	for _, p := range phases {
+		ratio := "-"
+		if p.Ratio > 0 {
+			ratio = fmt.Sprintf("%.2fx", p.Ratio)
+		}
+		log.Printf("  %-14s %10d %10.2f %10.2f %10.2f %8s", p.Compression, p.Messages,
+			metrics.InUnit(p.Bytes), float64(p.DurationMs)/1000, metrics.InUnit(p.BytesPerSec), ratio)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"pulsar-memory-test/pkg/admin"
+	"pulsar-memory-test/pkg/results"
+)
+
+// snapshotTopic -topic-stats 时记录 broker 端的 topic 数据量并登记到 manifest，失败只记录日志
+func snapshotTopic(layout *results.Layout, phase, topic string) *admin.TopicSnapshot {
+	if !*topicStats {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	s, err := admin.New(*adminURL).Snapshot(ctx, phase, topic)
+	if err != nil {
+		log.Printf("Topic stats (%s) failed: %v", phase, err)
+		return nil
+	}
+	layout.RecordTopicStats(s)
+	log.Printf("Topic stats (%s): storage %.2f MB, backlog %.2f MB, %d entries, %d msgs in",
+		phase, float64(s.StorageSize)/1024/1024, float64(s.BacklogSize)/1024/1024, s.Entries, s.MsgInCounter)
+	return &s
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 摘要中判断 worker 异常的阈值
+const (
+	// stragglerRatio 发送速率低于各 worker 中位数该比例的 worker 视为掉队
+	stragglerRatio = 0.5
+	// workerStuckAfter 未发完份额、且最后一次成功发送比最晚的 worker 早该时间以上的 worker 视为卡住
+	workerStuckAfter = 10 * time.Second
+)
+
+// workerCounters 一个 worker 的计数，可并发更新
+type workerCounters struct {
+	sent     int64
+	errors   int64
+	lastSend int64 // 最后一次成功发送的 UnixNano，0 表示还没有
+}
+
+// workerTracker 各 worker 的发送计数；总数相同的情况下，一个 worker 卡住或变慢只体现为整体吞吐下降，
+// 按 worker 统计才能看出来
+type workerTracker struct {
+	start    time.Time
+	expected []int // 各 worker 的份额，轨迹回放时为 nil (由调度决定)
+	workers  []workerCounters
+}
+
+func newWorkerTracker(n int, expected []int) *workerTracker {
+	return &workerTracker{start: time.Now(), expected: expected, workers: make([]workerCounters, n)}
+}
+
+// sent 记录 worker 的一次成功发送
+func (t *workerTracker) sent(id int) {
+	w := &t.workers[id]
+	atomic.AddInt64(&w.sent, 1)
+	atomic.StoreInt64(&w.lastSend, time.Now().UnixNano())
+}
+
+// failed 记录 worker 的一次发送错误
+func (t *workerTracker) failed(id int) {
+	atomic.AddInt64(&t.workers[id].errors, 1)
+}
+
+// WorkerStats 一个 worker 的发送统计
+type WorkerStats struct {
+	ID         int     `json:"id"`
+	Expected   int     `json:"expected,omitempty"` // 份额，轨迹回放时为 0
+	Sent       int64   `json:"sent"`
+	Errors     int64   `json:"errors"`
+	LastSendMs int64   `json:"last_send_ms"` // 最后一次成功发送距开始的毫秒数，没有成功发送时为 0
+	IdleMs     int64   `json:"idle_ms"`      // 发送结束时距最后一次成功发送的毫秒数
+	Rate       float64 `json:"rate"`         // 开始到最后一次成功发送之间的 msg/s
+	Straggler  bool    `json:"straggler,omitempty"`
+	Stuck      bool    `json:"stuck,omitempty"`
+}
+
+// stats 在所有 worker 退出后调用，end 为发送结束时间；返回各 worker 的统计和掉队、卡住的 worker 数
+func (t *workerTracker) stats(end time.Time) ([]WorkerStats, int, int) {
+	out := make([]WorkerStats, len(t.workers))
+	rates := make([]float64, len(t.workers))
+	var minIdle time.Duration = -1
+	for i := range t.workers {
+		w := &t.workers[i]
+		s := WorkerStats{ID: i, Sent: atomic.LoadInt64(&w.sent), Errors: atomic.LoadInt64(&w.errors)}
+		if t.expected != nil {
+			s.Expected = t.expected[i]
+		}
+		idle := end.Sub(t.start)
+		if last := atomic.LoadInt64(&w.lastSend); last > 0 {
+			active := time.Unix(0, last).Sub(t.start)
+			s.LastSendMs = active.Milliseconds()
+			idle = end.Sub(time.Unix(0, last))
+			if active > 0 {
+				s.Rate = float64(s.Sent) / active.Seconds()
+			}
+		}
+		s.IdleMs = idle.Milliseconds()
+		if minIdle < 0 || idle < minIdle {
+			minIdle = idle
+		}
+		out[i], rates[i] = s, s.Rate
+	}
+	if len(out) < 2 {
+		return out, 0, 0
+	}
+	slices.Sort(rates)
+	median := rates[len(rates)/2]
+	stragglers, stuck := 0, 0
+	for i := range out {
+		s := &out[i]
+		completed := s.Expected > 0 && s.Sent+s.Errors >= int64(s.Expected)
+		s.Straggler = s.Rate < median*stragglerRatio
+		s.Stuck = !completed && time.Duration(s.IdleMs)*time.Millisecond-minIdle > workerStuckAfter
+		if s.Straggler {
+			stragglers++
+		}
+		if s.Stuck {
+			stuck++
+		}
+	}
+	return out, stragglers, stuck
+}
+
+// printWorkers 打印 worker 发送量的分布，并逐个列出掉队或卡住的 worker
+func printWorkers(workers []WorkerStats, stragglers, stuck int) {
+	if len(workers) < 2 {
+		return
+	}
+	sent := make([]int64, len(workers))
+	for i, w := range workers {
+		sent[i] = w.Sent
+	}
+	slices.Sort(sent)
+	log.Printf("  Workers:      %d | sent min: %d, median: %d, max: %d | stragglers: %d | stuck: %d",
+		len(workers), sent[0], sent[len(sent)/2], sent[len(sent)-1], stragglers, stuck)
+	for _, w := range workers {
+		if !w.Straggler && !w.Stuck {
+			continue
+		}
+		var flags []string
+		if w.Straggler {
+			flags = append(flags, "straggler")
+		}
+		if w.Stuck {
+			flags = append(flags, "stuck")
+		}
+		sent := strconv.FormatInt(w.Sent, 10)
+		if w.Expected > 0 {
+			sent += "/" + strconv.Itoa(w.Expected)
+		}
+		log.Printf("    worker %d (%s): sent %s, %d errors, %.0f msg/s, last send %v before the end",
+			w.ID, strings.Join(flags, ", "), sent, w.Errors, w.Rate, time.Duration(w.IdleMs)*time.Millisecond)
+	}
+}
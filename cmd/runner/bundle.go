@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"pulsar-memory-test/pkg/bundle"
+)
+
+// runBundle 实现 runner bundle: 把一次运行的结果打包成适合附到 pulsar-client-go GitHub issue 的 tar.gz
+// (场景配置、解析后的 flag、摘要、内存曲线、heap profile 和环境信息，见 pkg/bundle)。
+// run 布局传入 <output>/<matrix>/<scenario>/<run-id>；flat 布局传入结果目录和 -scenario
+func runBundle(_ context.Context, args []string) int {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	output := fs.String("o", "", "Bundle file to write (empty = <scenario>[-<run-id>]-bundle.tar.gz in the current directory)")
+	scenario := fs.String("scenario", "", "Scenario name for the flat layout, where <results-dir> holds stats_<scenario>.json and friends")
+	maxSize := fs.Int64("max-size", bundle.GitHubAttachmentLimit, "Compressed size budget in bytes; optional files that do not fit are left out and listed in README.md")
+	sanitize := fs.Bool("sanitize", false, "Replace hostnames, IPs, URL hosts and tenant/namespace names with placeholders (host-1, ip-1, tenant-1/namespace-1) so the bundle can be shared publicly")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s bundle [bundle flags] <run-dir | results-dir>\n\nBundle flags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *maxSize <= 0 {
+		fs.Usage()
+		return 1
+	}
+	res, err := bundle.Write(bundle.Options{Dir: fs.Arg(0), Scenario: *scenario, Output: *output, MaxSize: *maxSize, Sanitize: *sanitize})
+	if err != nil {
+		log.Printf("Bundle: %v", err)
+		return 1
+	}
+	res.Log(log.Printf)
+	return 0
+}
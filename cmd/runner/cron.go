@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec 五段式 cron 表达式 (分 时 日 月 周)，每段支持 *、a、a-b、*/n、a-b/n 和逗号分隔的列表；
+// 与 cron 相同，日和周都不是 * 时满足其一即可。周日为 0 (7 也可以)
+type cronSpec struct {
+	expr              string
+	minute, hour, dom []bool
+	month, dow        []bool
+	domStar, dowStar  bool
+}
+
+// cronFields 各段的取值范围
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7},
+}
+
+// cronAliases 常用的简写
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@nightly": "0 2 * * *",
+	"@weekly":  "0 0 * * 0",
+}
+
+// parseCron 解析 cron 表达式或 @hourly/@daily/@nightly/@weekly
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if alias, ok := cronAliases[expr]; ok {
+		fields = strings.Fields(alias)
+	}
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: want 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	c := &cronSpec{expr: expr, domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	sets := make([][]bool, len(fields))
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q %s: %w", expr, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	c.minute, c.hour, c.dom, c.month, c.dow = sets[0], sets[1], sets[2], sets[3], sets[4]
+	c.dow[0] = c.dow[0] || c.dow[7]
+	return c, nil
+}
+
+// parseCronField 一段的取值集合，下标为取值
+func parseCronField(f string, lo, hi int) ([]bool, error) {
+	set := make([]bool, hi+1)
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return nil, fmt.Errorf("invalid value %q", a)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return nil, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				to = hi
+			}
+			if from < lo || to > hi || from > to {
+				return nil, fmt.Errorf("%q out of range %d-%d", rng, lo, hi)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// next after 之后 (不含) 第一个匹配的整分钟，一年内没有匹配时返回零值 (如 2 月 30 日)
+func (c *cronSpec) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(1, 0, 1); t.Before(end); t = t.Add(time.Minute) {
+		if !c.month[t.Month()] || !c.hour[t.Hour()] || !c.minute[t.Minute()] {
+			continue
+		}
+		dom, dow := c.dom[t.Day()], c.dow[t.Weekday()]
+		day := dom && dow
+		if !c.domStar && !c.dowStar {
+			day = dom || dow
+		}
+		if day {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSpec) String() string {
+	return c.expr
+}
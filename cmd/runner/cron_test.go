@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// at UTC 的整分钟时刻 (2026-01-01 是周四)
+func at(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+// TestCronNext next 返回 after 之后 (不含) 第一个匹配的整分钟
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time // 零值表示一年内没有匹配
+	}{
+		// 简写
+		{"@hourly", at(2026, 1, 1, 10, 30), at(2026, 1, 1, 11, 0)},
+		{"@daily", at(2026, 1, 1, 10, 30), at(2026, 1, 2, 0, 0)},
+		{"@nightly", at(2026, 1, 1, 2, 0), at(2026, 1, 2, 2, 0)}, // 正好在匹配时刻时取下一次
+		{"@weekly", at(2026, 1, 1, 0, 0), at(2026, 1, 4, 0, 0)},
+		// 秒被截掉，不会返回 after 所在的分钟
+		{"* * * * *", time.Date(2026, 1, 1, 10, 7, 59, 0, time.UTC), at(2026, 1, 1, 10, 8)},
+		// 步长和列表
+		{"*/15 * * * *", time.Date(2026, 1, 1, 10, 7, 30, 0, time.UTC), at(2026, 1, 1, 10, 15)},
+		{"10-40/15 9 * * *", at(2026, 1, 1, 9, 26), at(2026, 1, 1, 9, 40)},
+		{"10-40/15 9 * * *", at(2026, 1, 1, 9, 41), at(2026, 1, 2, 9, 10)},
+		{"5/20 * * * *", at(2026, 1, 1, 9, 46), at(2026, 1, 1, 10, 5)},
+		{"0 8,20 * * *", at(2026, 1, 1, 8, 0), at(2026, 1, 1, 20, 0)},
+		{"0 0 * 2 *", at(2026, 1, 1, 0, 0), at(2026, 2, 1, 0, 0)},
+		// 周: 0 和 7 都是周日
+		{"0 9 * * 1-5", at(2026, 1, 2, 10, 0), at(2026, 1, 5, 9, 0)},
+		{"0 0 * * 0", at(2026, 1, 1, 0, 0), at(2026, 1, 4, 0, 0)},
+		{"0 0 * * 7", at(2026, 1, 1, 0, 0), at(2026, 1, 4, 0, 0)},
+		{"0 0 * * 5-7", at(2026, 1, 3, 0, 0), at(2026, 1, 4, 0, 0)},
+		// 日和周只有一个受限时按该段匹配
+		{"0 0 13 * *", at(2026, 1, 1, 0, 0), at(2026, 1, 13, 0, 0)},
+		{"0 0 * * 5", at(2026, 1, 3, 0, 0), at(2026, 1, 9, 0, 0)},
+		// 日和周都受限时满足其一即可: 每月 13 日或每个周五
+		{"0 0 13 * 5", at(2026, 1, 1, 0, 0), at(2026, 1, 2, 0, 0)},
+		{"0 0 13 * 5", at(2026, 1, 9, 1, 0), at(2026, 1, 13, 0, 0)},
+		// 一年内没有匹配
+		{"0 0 30 2 *", at(2026, 1, 1, 0, 0), time.Time{}},
+		{"0 0 29 2 *", at(2026, 3, 1, 0, 0), time.Time{}},
+		{"0 0 29 2 *", at(2027, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q next after %v = %v, want %v", tt.expr, tt.after, got, tt.want)
+		}
+	}
+}
+
+// TestParseCronInvalid 段数、取值范围、步长和未知简写在解析时报错
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@yearly",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"pulsar-memory-test/pkg/results"
+)
+
+// historyName 结果库: <output>/history.jsonl，每次矩阵运行一行
+const historyName = "history.jsonl"
+
+// Schedule daemon 的调度文件 (YAML)
+//
+//	jobs:
+//	  - matrix: scenarios/memory-matrix.yaml
+//	    cron: "@nightly"            # 或 "0 2 * * 1-5"
+//	    labels: client_version=master
+type Schedule struct {
+	Jobs []Job `yaml:"jobs"`
+}
+
+// Job 按 Cron 运行一个矩阵文件；Labels 非空时替换 runner 的 -labels
+type Job struct {
+	Matrix string `yaml:"matrix"`
+	Cron   string `yaml:"cron"`
+	Labels string `yaml:"labels"`
+
+	spec *cronSpec
+	name string // 矩阵名，结果在 <output>/<name>/
+	next time.Time
+}
+
+// HistoryEntry 结果库中的一次矩阵运行，保留各场景的关键数字，原始 run 目录被 -retain 删除后仍可画趋势
+type HistoryEntry struct {
+	Matrix      string            `json:"matrix"`
+	RunID       string            `json:"run_id"`
+	Started     time.Time         `json:"started"`
+	Finished    time.Time         `json:"finished"`
+	ExitCode    int               `json:"exit_code"`
+	Summary     string            `json:"summary,omitempty"` // summary-<run-id>.json，运行没有写出汇总时为空
+	Baseline    string            `json:"baseline,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Scenarios   []HistoryScenario `json:"scenarios,omitempty"`
+	Regressions int               `json:"regressions,omitempty"`
+}
+
+// HistoryScenario 一个场景在一次运行中的结果
+type HistoryScenario struct {
+	Name         string         `json:"name"`
+	Dir          string         `json:"dir"`
+	Status       results.Status `json:"status"`
+	MaxRSS       uint64         `json:"max_rss"`
+	HeapRatio    float64        `json:"heap_ratio"`
+	P99LatencyMs float64        `json:"p99_latency_ms,omitempty"`
+	Regression   bool           `json:"regression,omitempty"`
+}
+
+// runDaemon 实现 runner daemon: 按调度文件中各任务的 cron 依次运行矩阵 (每次一个 runner 子进程，
+// 以该矩阵上一次的汇总为 -baseline)，结果追加到 <output>/history.jsonl，并重写该矩阵的趋势报告
+// <output>/<matrix>/trend.md 和 trend.json；-publish 在每次报告更新后执行。收到 SIGINT/SIGTERM 时中断当前运行并退出
+func runDaemon(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	trendRuns := fs.Int("trend-runs", 14, "Most recent runs of a matrix shown in its trend report")
+	retain := fs.Duration("retain", 0, "Delete scenario run directories (profiles, raw stats, logs) of runs older than this; summaries and history are kept (0 = keep everything)")
+	publish := fs.String("publish", "", "Shell command run after each trend report update, with TREND_MD, TREND_JSON, MATRIX, RUN_ID and EXIT_CODE in the environment (e.g. copy to a web root or post to chat)")
+	once := fs.Bool("once", false, "Run every job once now, then exit (for checking a schedule)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] daemon [daemon flags] <schedule.yaml>\n\nDaemon flags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *trendRuns < 1 || *retain < 0 {
+		fs.Usage()
+		return 1
+	}
+	jobs, err := loadSchedule(fs.Arg(0))
+	if err != nil {
+		log.Printf("Invalid schedule: %v", err)
+		return 1
+	}
+	self, err := os.Executable()
+	if err != nil {
+		log.Printf("Cannot locate the runner binary: %v", err)
+		return 1
+	}
+	history := filepath.Join(*outputDir, historyName)
+
+	now := time.Now()
+	log.Printf("Daemon: %d jobs, history in %s", len(jobs), history)
+	for i := range jobs {
+		j := &jobs[i]
+		j.next = j.spec.next(now)
+		if *once {
+			j.next = now
+		}
+		log.Printf("  %s (%s): %s, next at %s", j.name, j.Matrix, j.spec, j.next.Format(time.RFC3339))
+	}
+	if *dryRun {
+		return 0
+	}
+
+	for ctx.Err() == nil {
+		// 下一个到期的任务；同时到期的按调度文件中的顺序依次运行，不并发 (共用一个 broker)
+		var j *Job
+		for i := range jobs {
+			if !jobs[i].next.IsZero() && (j == nil || jobs[i].next.Before(j.next)) {
+				j = &jobs[i]
+			}
+		}
+		if j == nil {
+			break
+		}
+		if d := time.Until(j.next); d > 0 {
+			log.Printf("Next: %s at %s", j.name, j.next.Format(time.RFC3339))
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				continue
+			}
+		}
+
+		entry := runJob(ctx, self, j, history)
+		if err := appendHistory(history, entry); err != nil {
+			log.Printf("Failed to update %s: %v", history, err)
+		}
+		if err := writeTrend(history, j.name, *trendRuns); err != nil {
+			log.Printf("Failed to write the trend report of %s: %v", j.name, err)
+		} else if *publish != "" {
+			publishTrend(ctx, *publish, j.name, entry)
+		}
+		if *retain > 0 {
+			pruneRuns(history, j.name, time.Now().Add(-*retain))
+		}
+
+		if *once {
+			j.next = time.Time{}
+		} else {
+			// 从运行结束的时刻算下一次，运行超过周期时不补跑错过的时刻
+			j.next = j.spec.next(time.Now())
+		}
+	}
+	log.Printf("Daemon stopped")
+	return 0
+}
+
+// loadSchedule 读取调度文件并检查每个任务的 cron 和矩阵
+func loadSchedule(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Schedule
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(s.Jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs", path)
+	}
+	for i := range s.Jobs {
+		j := &s.Jobs[i]
+		if j.spec, err = parseCron(j.Cron); err != nil {
+			return nil, fmt.Errorf("job %d: %w", i+1, err)
+		}
+		if j.spec.next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("job %d: cron %q never fires", i+1, j.Cron)
+		}
+		if _, err := results.ParseLabels(j.Labels); err != nil {
+			return nil, fmt.Errorf("job %d labels: %w", i+1, err)
+		}
+		m, err := LoadMatrix(j.Matrix)
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", i+1, err)
+		}
+		j.name = sanitize(m.Name)
+	}
+	return s.Jobs, nil
+}
+
+// runJob 以 runner 子进程运行一次矩阵。全局参数原样传给子进程 (-run-id、-baseline、-dry-run 除外)，
+// 该矩阵在结果库中最近一次写出汇总的运行作为 -baseline
+func runJob(ctx context.Context, self string, j *Job, history string) HistoryEntry {
+	e := HistoryEntry{Matrix: j.name, RunID: results.NewRunID(), Started: time.Now()}
+	// run ID 精确到秒，同一矩阵的两个任务紧接着运行时等到下一秒，避免覆盖上一次的汇总
+	for prev, _ := readLast(history, j.name); prev == e.RunID; e.RunID = results.NewRunID() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "run-id", "baseline", "dry-run":
+		case "labels":
+			if j.Labels == "" {
+				args = append(args, "-labels="+f.Value.String())
+			}
+		default:
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	if j.Labels != "" {
+		args = append(args, "-labels="+j.Labels)
+	}
+	if prev, ok := lastSummary(history, j.name); ok {
+		e.Baseline = prev
+		args = append(args, "-baseline="+prev)
+	}
+	args = append(args, "-run-id="+e.RunID, j.Matrix)
+
+	log.Printf("========== Job %s, run %s ==========", j.name, e.RunID)
+	cmd := exec.CommandContext(ctx, self, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Minute
+	err := cmd.Run()
+	e.Finished = time.Now()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		e.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		log.Printf("Job %s failed to run: %v", j.name, err)
+		e.ExitCode = results.StatusError.ExitCode()
+	}
+
+	path := filepath.Join(*outputDir, j.name, "summary-"+e.RunID+".json")
+	s, err := loadSummary(path)
+	if err != nil {
+		log.Printf("Job %s wrote no summary: %v", j.name, err)
+		return e
+	}
+	e.Summary, e.Labels = path, s.Labels
+	for _, r := range s.Scenarios {
+		h := HistoryScenario{Name: r.Name, Dir: r.Dir, Status: r.Status, MaxRSS: r.MaxRSS, HeapRatio: r.HeapRatio, P99LatencyMs: r.P99LatencyMs}
+		if r.Baseline != nil && r.Baseline.Regression {
+			h.Regression = true
+			e.Regressions++
+		}
+		e.Scenarios = append(e.Scenarios, h)
+	}
+	log.Printf("Job %s finished with exit code %d, %d regressions (%v)", j.name, e.ExitCode, e.Regressions,
+		e.Finished.Sub(e.Started).Round(time.Second))
+	return e
+}
+
+// readHistory 读取结果库中 matrix 的全部运行 (matrix 为空时全部)，按写入顺序
+func readHistory(path, matrix string) ([]HistoryEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		var e HistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if matrix == "" || e.Matrix == matrix {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// appendHistory 向结果库追加一次运行
+func appendHistory(path string, e HistoryEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readLast 结果库中 matrix 最近一次运行的 run ID
+func readLast(history, matrix string) (string, error) {
+	entries, err := readHistory(history, matrix)
+	if err != nil || len(entries) == 0 {
+		return "", err
+	}
+	return entries[len(entries)-1].RunID, nil
+}
+
+// lastSummary 结果库中 matrix 最近一次写出汇总的运行的 summary 路径
+func lastSummary(history, matrix string) (string, bool) {
+	entries, err := readHistory(history, matrix)
+	if err != nil {
+		log.Printf("Failed to read %s: %v", history, err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if p := entries[i].Summary; p != "" {
+			if _, err := os.Stat(p); err == nil {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Trend 一个矩阵最近若干次运行中各场景的变化，写入 trend.json
+type Trend struct {
+	Matrix    string          `json:"matrix"`
+	Updated   time.Time       `json:"updated"`
+	Runs      []HistoryEntry  `json:"runs"` // 旧的在前
+	Scenarios []TrendScenario `json:"scenarios"`
+}
+
+// TrendScenario 一个场景在各次运行中的 MaxRSS 和 HeapRatio，与 Trend.Runs 一一对应，未运行或失败为 0
+type TrendScenario struct {
+	Name         string    `json:"name"`
+	MaxRSS       []uint64  `json:"max_rss"`
+	HeapRatio    []float64 `json:"heap_ratio"`
+	MaxRSSChange float64   `json:"max_rss_change"` // 最新一次相对窗口内第一次成功运行，0.1 = 增加 10%
+	Regressions  int       `json:"regressions"`    // 窗口内被标记为回归的次数
+}
+
+// writeTrend 按结果库重写 matrix 最近 runs 次运行的 trend.json 和 trend.md
+func writeTrend(history, matrix string, runs int) error {
+	entries, err := readHistory(history, matrix)
+	if err != nil {
+		return err
+	}
+	entries = entries[max(len(entries)-runs, 0):]
+	t := Trend{Matrix: matrix, Updated: time.Now(), Runs: entries}
+	index := make(map[string]int)
+	for i, e := range entries {
+		for _, s := range e.Scenarios {
+			k, ok := index[s.Name]
+			if !ok {
+				k = len(t.Scenarios)
+				index[s.Name] = k
+				t.Scenarios = append(t.Scenarios, TrendScenario{
+					Name: s.Name, MaxRSS: make([]uint64, len(entries)), HeapRatio: make([]float64, len(entries)),
+				})
+			}
+			ts := &t.Scenarios[k]
+			if s.Status == results.StatusOK {
+				ts.MaxRSS[i], ts.HeapRatio[i] = s.MaxRSS, s.HeapRatio
+			}
+			if s.Regression {
+				ts.Regressions++
+			}
+		}
+	}
+	for i := range t.Scenarios {
+		ts := &t.Scenarios[i]
+		var first, last uint64
+		for _, v := range ts.MaxRSS {
+			if v == 0 {
+				continue
+			}
+			if first == 0 {
+				first = v
+			}
+			last = v
+		}
+		if first > 0 {
+			ts.MaxRSSChange = float64(last)/float64(first) - 1
+		}
+	}
+
+	dir := filepath.Join(*outputDir, matrix)
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := results.WriteBytes(filepath.Join(dir, "trend.json"), append(data, '\n')); err != nil {
+		return err
+	}
+	return results.WriteFile(filepath.Join(dir, "trend.md"), func(w io.Writer) error {
+		return writeTrendTable(w, &t)
+	})
+}
+
+// writeTrendTable 每个场景一行，每次运行一列 (MaxRSS MB / HeapRatio)，回归的运行加 ⚠
+func writeTrendTable(w io.Writer, t *Trend) error {
+	fmt.Fprintf(w, "# %s memory trend\n\n", t.Matrix)
+	fmt.Fprintf(w, "Last %d runs, updated %s. Cells are max RSS (MB) / heap ratio; ⚠ marks a regression against the previous run, - a failed or missing scenario.\n\n",
+		len(t.Runs), t.Updated.Format(time.RFC3339))
+	header, sep := []string{"Scenario"}, []string{"---"}
+	for _, r := range t.Runs {
+		col := r.RunID
+		if v := r.Labels["client_version"]; v != "" {
+			col += " (" + v + ")"
+		}
+		header, sep = append(header, col), append(sep, "---:")
+	}
+	header, sep = append(header, "RSS change"), append(sep, "---:")
+	fmt.Fprintf(w, "| %s |\n| %s |\n", strings.Join(header, " | "), strings.Join(sep, " | "))
+
+	regressed := make(map[[2]string]bool)
+	for _, r := range t.Runs {
+		for _, s := range r.Scenarios {
+			if s.Regression {
+				regressed[[2]string{r.RunID, s.Name}] = true
+			}
+		}
+	}
+	for _, s := range t.Scenarios {
+		row := []string{s.Name}
+		for i, r := range t.Runs {
+			cell := "-"
+			if s.MaxRSS[i] > 0 {
+				cell = fmt.Sprintf("%.1f / %.2fx", float64(s.MaxRSS[i])/1024/1024, s.HeapRatio[i])
+			}
+			if regressed[[2]string{r.RunID, s.Name}] {
+				cell += " ⚠"
+			}
+			row = append(row, cell)
+		}
+		row = append(row, fmt.Sprintf("%+.1f%%", s.MaxRSSChange*100))
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+	}
+	return nil
+}
+
+// publishTrend 执行 -publish，失败只记录日志
+func publishTrend(ctx context.Context, command, matrix string, e HistoryEntry) {
+	dir := filepath.Join(*outputDir, matrix)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"TREND_MD="+filepath.Join(dir, "trend.md"),
+		"TREND_JSON="+filepath.Join(dir, "trend.json"),
+		"MATRIX="+matrix,
+		"RUN_ID="+e.RunID,
+		fmt.Sprintf("EXIT_CODE=%d", e.ExitCode),
+	)
+	if err := cmd.Run(); err != nil {
+		log.Printf("Publish failed: %v", err)
+	}
+}
+
+// pruneRuns 删除 matrix 中开始早于 before 的运行的场景 run 目录；
+// 汇总和结果库保留，趋势报告不受影响
+func pruneRuns(history, matrix string, before time.Time) {
+	entries, err := readHistory(history, matrix)
+	if err != nil {
+		log.Printf("Failed to read %s: %v", history, err)
+		return
+	}
+	for _, e := range entries {
+		if !e.Started.Before(before) {
+			continue
+		}
+		for _, s := range e.Scenarios {
+			dir := s.Dir
+			if _, err := os.Stat(dir); dir == "" || err != nil {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				log.Printf("Failed to prune %s: %v", dir, err)
+			} else {
+				log.Printf("Pruned %s", dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// defaultTotal producer -total 的默认值，fan-in 时按它拆分未显式给出的 -total
+const defaultTotal = 200 * 1024 * 1024
+
+// runnerFlags 矩阵中 runner 自身的参数 (flags.runner 或 runner.<flag> 轴)
+var runnerFlags = []string{"producers", "ingest-rate"}
+
+// fanIn 多个 producer 进程同时写同一个 topic (多发布者、单消费者)，
+// consumer 读到的积压由各进程的小批次交错组成，是消费端批次内存压力最大的拓扑
+type fanIn struct {
+	producers int     // producer 进程数，1 为普通场景
+	rate      float64 // 所有进程合计的 msg/s，平均分给各进程 (0 = 不限)
+}
+
+// parseFanIn 解析场景的 runner 参数
+func parseFanIn(flags map[string]string) (fanIn, error) {
+	f := fanIn{producers: 1}
+	for k, v := range flags {
+		var err error
+		switch k {
+		case "producers":
+			if f.producers, err = strconv.Atoi(v); err == nil && f.producers < 1 {
+				err = fmt.Errorf("must be >= 1")
+			}
+		case "ingest-rate":
+			if f.rate, err = strconv.ParseFloat(v, 64); err == nil && f.rate < 0 {
+				err = fmt.Errorf("must be >= 0")
+			}
+		default:
+			err = fmt.Errorf("unknown runner flag (want %v)", runnerFlags)
+		}
+		if err != nil {
+			return f, fmt.Errorf("runner %s=%q: %w", k, v, err)
+		}
+	}
+	return f, nil
+}
+
+// enabled 是否需要按 fan-in 启动 producer
+func (f fanIn) enabled() bool {
+	return f.producers > 1 || f.rate > 0
+}
+
+// producerCommands 场景的 producer 命令行: 普通场景一条；fan-in 时每个进程一条，-total 和 -rate 平均分配，
+// 结果以 flat 布局写到 run 目录的 producers/ 下 (producer_producer-<i>.json 等)，pprof 端口随机以免冲突
+func producerCommands(s Scenario, index int, root string) ([][]string, error) {
+	f, err := parseFanIn(s.Flags["runner"])
+	if err != nil {
+		return nil, err
+	}
+	base := command("producer", s, index, root)
+	if !f.enabled() {
+		return [][]string{base}, nil
+	}
+	total := int64(defaultTotal)
+	if v, ok := s.Flags["producer"]["total"]; ok {
+		if total, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("producer total=%q: %w", v, err)
+		}
+	}
+	dir := filepath.Join(root, s.Name, *runID, "producers")
+	cmds := make([][]string, f.producers)
+	for i := range cmds {
+		// 后面的参数覆盖 command 中的同名参数
+		cmd := append([]string(nil), base...)
+		cmd = append(cmd,
+			"-output="+dir,
+			"-layout=flat",
+			"-scenario=producer-"+strconv.Itoa(i),
+			"-pprof-port=0",
+			"-total="+strconv.FormatInt(total/int64(f.producers), 10),
+		)
+		if f.rate > 0 {
+			cmd = append(cmd, "-rate="+strconv.FormatFloat(f.rate/float64(f.producers), 'f', -1, 64))
+		}
+		cmds[i] = cmd
+	}
+	return cmds, nil
+}
+
+// runProducers 同时运行全部 producer 命令并等它们退出，返回第一个失败
+func runProducers(ctx context.Context, cmds [][]string) error {
+	if len(cmds) == 1 {
+		return run(ctx, cmds[0])
+	}
+	errs := make([]error, len(cmds))
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = run(ctx, cmd)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%d of %d: %w", i, len(cmds), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// initGoal 向导中的测试目标: 决定 consumer 的默认批大小和附加参数
+type initGoal struct {
+	desc       string
+	batchMB    int64
+	flags      []string // consumer 的附加参数，按 YAML 行写出
+	concurrent bool     // producer 和 consumer 同时运行 (consumer 先启动)
+}
+
+var initGoals = []initGoal{
+	{"peak memory while draining a backlog", 50, []string{`release-payload: "true"`}, false},
+	{"steady-state memory with producer and consumer running together", 10, []string{`release-payload: "true"`}, true},
+	{"ReleasePayload effectiveness (A/B in one consumer)", 50, []string{`ab-release-payload: "true"`}, false},
+	{"a memory leak over a long run", 10, []string{`release-payload: "true"`, `progress-interval: "30s"`}, false},
+}
+
+// wizard 从 in 逐行读取回答，提示写到 out；回车或输入结束时使用默认值
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (w *wizard) ask(prompt, def string) string {
+	fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	line, _ := w.in.ReadString('\n')
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+// askInt 读取非负整数，输入无效时重新询问
+func (w *wizard) askInt(prompt string, def int64) int64 {
+	for {
+		v, err := strconv.ParseInt(w.ask(prompt, strconv.FormatInt(def, 10)), 10, 64)
+		if err == nil && v >= 0 {
+			return v
+		}
+		fmt.Fprintln(w.out, "  Please enter a non-negative integer")
+	}
+}
+
+// askFloat 读取非负数，输入无效时重新询问
+func (w *wizard) askFloat(prompt string, def float64) float64 {
+	for {
+		v, err := strconv.ParseFloat(w.ask(prompt, strconv.FormatFloat(def, 'g', -1, 64)), 64)
+		if err == nil && v >= 0 {
+			return v
+		}
+		fmt.Fprintln(w.out, "  Please enter a non-negative number")
+	}
+}
+
+// choose 列出选项并返回选中的序号 (从 1 开始)
+func (w *wizard) choose(prompt string, def int, options ...string) int {
+	fmt.Fprintln(w.out, prompt)
+	for i, opt := range options {
+		fmt.Fprintf(w.out, "  %d) %s\n", i+1, opt)
+	}
+	for {
+		n, err := strconv.Atoi(w.ask("Choice", strconv.Itoa(def)))
+		if err == nil && n >= 1 && n <= len(options) {
+			return n
+		}
+		fmt.Fprintf(w.out, "  Please enter 1-%d\n", len(options))
+	}
+}
+
+// runInit 实现 runner init: 交互式询问 broker 地址、消息大小、速率和测试目标，
+// 写出可直接用 -config 运行的 YAML 场景，并打印创建 topic 的命令和运行命令。
+// 每个问题回车即使用方括号中的默认值；也可以把答案逐行通过管道传入
+func runInit(_ context.Context, args []string) int {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s init [output.yaml]\n\nWrites <scenario name>.yaml when no output file is given.\n", os.Args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 1
+	}
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+
+	fmt.Fprintln(w.out, "========== Scenario Wizard ==========")
+	name := w.ask("Scenario name", "my-scenario")
+	output := fs.Arg(0)
+	if output == "" {
+		output = name + ".yaml"
+	}
+	url := w.ask("Broker URL", "pulsar://localhost:6650")
+	adminURL := w.ask("Admin REST URL", "http://localhost:8080")
+	topic := w.ask("Topic", "persistent://public/default/"+name)
+	partitions := w.askInt("Partitions (0 = non-partitioned)", 0)
+
+	var sizeDist string
+	switch w.choose("Message sizes:", 1, "fixed", "uniform range", "heavy-tailed (exponential)") {
+	case 1:
+		sizeDist = fmt.Sprintf("fixed:%d", w.askInt("Message size (bytes)", 1024))
+	case 2:
+		sizeDist = fmt.Sprintf("uniform:%d-%d", w.askInt("Minimum size (bytes)", 512), w.askInt("Maximum size (bytes)", 8192))
+	case 3:
+		sizeDist = fmt.Sprintf("exp:%d-%d", w.askInt("Mean size (bytes)", 4096), w.askInt("Maximum size (bytes)", 262144))
+	}
+	totalMB := w.askInt("Total data to produce (MB)", 200)
+	// -rate 限制所有 worker 合计的发送速率，并发数只决定不限速时能达到的上限
+	rate := w.askFloat("Producer send rate (messages/s, 0 = as fast as possible)", 0)
+	concurrency := w.askInt("Producer concurrency", 10)
+	flush := w.ask("Producer flush interval (0 = only at the end)", "0")
+	processDelay := w.ask("Consumer processing delay per batch (slower = more backlog)", "0")
+	queueSize := w.askInt("Consumer receiver queue size", 1000)
+	memoryLimitMB := w.askInt("Client memory limit (MB, 0 = client default)", 0)
+
+	descs := make([]string, len(initGoals))
+	for i, g := range initGoals {
+		descs[i] = g.desc
+	}
+	goal := initGoals[w.choose("What do you want to measure?", 1, descs...)-1]
+	batchMB := w.askInt("Consumer batch size (MB)", goal.batchMB)
+
+	topicPath := strings.Replace(topic, "://", "/", 1)
+	bootstrap := fmt.Sprintf("curl -sf -X PUT %s/admin/v2/%s", adminURL, topicPath)
+	if partitions > 0 {
+		bootstrap = fmt.Sprintf("curl -sf -X PUT -H 'Content-Type: application/json' -d %d %s/admin/v2/%s/partitions", partitions, adminURL, topicPath)
+	}
+	run := []string{"./bin/producer -config " + output, "./bin/consumer -config " + output}
+	if goal.concurrent {
+		run = []string{"./bin/consumer -config " + output + " &", "./bin/producer -config " + output}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by runner init on %s\n#\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "# Create the topic:\n#   %s\n# Run:\n", bootstrap)
+	for _, cmd := range run {
+		fmt.Fprintf(&b, "#   %s\n", cmd)
+	}
+	fmt.Fprintf(&b, "name: %q\n", name)
+	fmt.Fprintf(&b, "description: %q\n", fmt.Sprintf("%s messages, %d MB total, %s", sizeDist, totalMB, goal.desc))
+	b.WriteString("flags:\n  producer:\n")
+	fmt.Fprintf(&b, "    url: %q\n    topic: %q\n", url, topic)
+	fmt.Fprintf(&b, "    size-dist: %q\n    total: \"%d\"\n", sizeDist, totalMB<<20)
+	fmt.Fprintf(&b, "    rate: %q\n", strconv.FormatFloat(rate, 'g', -1, 64))
+	fmt.Fprintf(&b, "    concurrency: \"%d\"\n    flush-interval: %q\n", concurrency, flush)
+	if memoryLimitMB > 0 {
+		fmt.Fprintf(&b, "    memory-limit: \"%d\"\n", memoryLimitMB<<20)
+	}
+	fmt.Fprintf(&b, "    scenario: %q\n", name)
+	b.WriteString("  consumer:\n")
+	fmt.Fprintf(&b, "    url: %q\n    topic: %q\n    sub: %q\n", url, topic, name+"-sub")
+	fmt.Fprintf(&b, "    batch-size: \"%d\"\n    queue-size: \"%d\"\n    process-delay: %q\n", batchMB<<20, queueSize, processDelay)
+	if memoryLimitMB > 0 {
+		fmt.Fprintf(&b, "    memory-limit: \"%d\"\n", memoryLimitMB<<20)
+	}
+	for _, f := range goal.flags {
+		fmt.Fprintf(&b, "    %s\n", f)
+	}
+	fmt.Fprintf(&b, "    scenario: %q\n", name)
+
+	if err := os.WriteFile(output, []byte(b.String()), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Write %s: %v\n", output, err)
+		return 1
+	}
+	fmt.Printf("\nScenario written to %s\n\nCreate the topic:\n  %s\n\nRun:\n", output, bootstrap)
+	for _, cmd := range run {
+		fmt.Printf("  %s\n", cmd)
+	}
+	return 0
+}
@@ -0,0 +1,272 @@
+// runner 按矩阵文件依次运行 producer 和 consumer，汇总各场景的内存指标:
+// 矩阵的每个组合 (消息大小、ReceiverQueueSize、MemoryLimitBytes、GOGC、是否 ReleasePayload ...) 是一个场景，
+// 每个场景使用独立的 topic，先由 producer 写入全部数据，再由 consumer 消费到底。
+// 结果使用 run 布局，所有场景共用一个 run ID:
+//
+//	<output>/<matrix>/<scenario>/<run-id>/  stats.json、heap.pprof、result.json、manifest.json 和日志
+//	<output>/<matrix>/summary-<run-id>.json 各场景的 MaxRSS/HeapRatio 等，以及同名的 .md 表格
+//
+// 用法: runner [-baseline summary-<old-run-id>.json] [-labels client_version=v0.14.0] matrix.yaml
+//
+// runner smoke [-url pulsar://...] 不需要矩阵文件: 在正式跑场景之前对配置的 broker 生产并消费一小段固定负载，
+// 检查条数和 payload 校验并打印健康摘要，结果在 <output>/smoke/smoke/<run-id>/
+//
+// runner rebalance [-consumers 2 -join 1 -leave 1] 测量 Shared 订阅的成员变化: 多个 consumer 进程订阅同一个 topic，
+// producer 按速率持续写入，运行中途按时间加入和停止 consumer 进程，比较每次变化前后各进程的吞吐、
+// 重投递和内存，结果在 <output>/rebalance/rebalance/<run-id>/rebalance.json
+//
+// runner init [output.yaml] 交互式场景向导: 依次询问 broker 地址、消息大小、速率和测试目标，
+// 写出可直接用 producer/consumer -config 运行的 YAML 场景，并打印创建 topic 的命令
+//
+// runner bundle [-sanitize] <run-dir> 把一次运行的结果打包成适合附到 pulsar-client-go GitHub issue 的 tar.gz
+//
+// runner daemon schedule.yaml 常驻运行: 按调度文件中各任务的 cron (如 @nightly) 运行矩阵，以上一次的汇总为基线，
+// 每次运行追加到结果库 <output>/history.jsonl，并更新 <output>/<matrix>/trend.md 趋势报告，持续监控客户端升级的内存回归
+//
+// 矩阵文件示例 (axes 见 knownAxes，其它参数用 producer.<flag> / consumer.<flag>):
+//
+//	name: client-upgrade
+//	flags:
+//	  producer: {total: "209715200"}
+//	  consumer: {batch-size: "52428800"}
+//	matrix:
+//	  size: [1024, 102400]
+//	  queue-size: [100, 1000]
+//	  release-payload: [false, true]
+//
+// 轴 producers/ingest-rate (或 flags.runner) 把场景变为 fan-in: 多个 producer 进程同时写同一个 topic，
+// 合计速率为 ingest-rate msg/s，-total 和速率平均分给各进程，全部写完后再由一个 consumer 消费。
+//
+// 传入 -baseline 时与之前的汇总按场景名对比，MaxRSS 或 HeapRatio 增加超过 -max-regression 时
+// 标记为回归并以退出码 2 结束，用来发现 pulsar-client-go 版本之间的内存回归。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+var (
+	producerBin   = flag.String("producer", "bin/producer", "Producer binary")
+	consumerBin   = flag.String("consumer", "bin/consumer", "Consumer binary")
+	outputDir     = flag.String("output", "./results", "Results root; scenarios go to <output>/<matrix>/<scenario>/<run-id>")
+	runID         = flag.String("run-id", "", "Run ID shared by all scenarios (default: current time)")
+	topicBase     = flag.String("topic", "persistent://public/default/runner", "Topic prefix; each scenario uses <topic>-<run-id>-<n> so runs never read each other's data")
+	labels        = flag.String("labels", "", "Labels passed to producer and consumer and recorded in the summary (e.g. client_version=v0.14.0)")
+	timeout       = flag.Duration("timeout", 30*time.Minute, "Per-program time limit; the program is interrupted (SIGINT, results still saved) when it runs longer")
+	baseline      = flag.String("baseline", "", "Earlier summary-<run-id>.json to compare against by scenario name")
+	maxRegression = flag.Float64("max-regression", 0.1, "With -baseline, relative increase of MaxRSS or HeapRatio counted as a regression (0.1 = 10%)")
+	trackPIDs     = flag.String("track-pids", "", "Comma-separated [name=]pid of co-located processes (e.g. a local Pulsar standalone or proxy), passed to producer and consumer so their stats include these processes' RSS and the machine total")
+	dryRun        = flag.Bool("dry-run", false, "Print the commands for every scenario without running them")
+)
+
+// subcommands 不需要矩阵文件的子命令，返回进程退出码
+var subcommands = map[string]func(context.Context, []string) int{
+	"smoke":     runSmoke,
+	"rebalance": runRebalance,
+	"daemon":    runDaemon,
+	"init":      runInit,
+	"bundle":    runBundle,
+}
+
+// reservedFlags 由 runner 为每个场景设置，矩阵文件中不能出现
+var reservedFlags = []string{"topic", "scenario", "output", "layout", "run-id", "labels"}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <matrix.yaml>\n       %s [flags] smoke [-url URL] [-messages N] [-size N]\n       %s [flags] rebalance [-consumers N] [-join N] [-leave N] ...\n       %s [flags] daemon [-retain D] [-publish CMD] <schedule.yaml>\n       %s [flags] init [output.yaml]\n       %s [flags] bundle [-o FILE] [-sanitize] <run-dir>\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetPrefix("[RUNNER] ")
+
+	if sub, ok := subcommands[flag.Arg(0)]; ok {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := sub(ctx, flag.Args()[1:])
+		stop()
+		os.Exit(code)
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *maxRegression < 0 {
+		log.Fatalf("-max-regression must be >= 0")
+	}
+	labelMap, err := results.ParseLabels(*labels)
+	if err != nil {
+		log.Fatalf("Invalid -labels: %v", err)
+	}
+	if _, err := metrics.ParseSidecars(*trackPIDs); err != nil {
+		log.Fatalf("Invalid -track-pids: %v", err)
+	}
+	matrix, err := LoadMatrix(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Invalid matrix: %v", err)
+	}
+	scenarios := matrix.Expand()
+	for _, s := range scenarios {
+		if _, err := parseFanIn(s.Flags["runner"]); err != nil {
+			log.Fatalf("Invalid matrix: %v", err)
+		}
+		for program, flags := range s.Flags {
+			for _, name := range reservedFlags {
+				if _, ok := flags[name]; ok {
+					log.Fatalf("Invalid matrix: %s -%s is set by the runner for each scenario", program, name)
+				}
+			}
+		}
+	}
+	var base Summary
+	if *baseline != "" {
+		if base, err = loadSummary(*baseline); err != nil {
+			log.Fatalf("Invalid -baseline: %v", err)
+		}
+	}
+	if *runID == "" {
+		*runID = results.NewRunID()
+	}
+	root := filepath.Join(*outputDir, sanitize(matrix.Name))
+
+	log.Printf("Matrix %s: %d scenarios, run ID %s, results in %s", matrix.Name, len(scenarios), *runID, root)
+	if *dryRun {
+		for i, s := range scenarios {
+			log.Printf("[%d/%d] %s", i+1, len(scenarios), s.Name)
+			producers, _ := producerCommands(s, i, root)
+			for _, cmd := range append(producers, command("consumer", s, i, root)) {
+				log.Printf("  %s", strings.Join(cmd, " "))
+			}
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary := Summary{
+		Matrix:  matrix.Name,
+		RunID:   *runID,
+		Started: time.Now(),
+		Labels:  labelMap,
+	}
+	for i, s := range scenarios {
+		if ctx.Err() != nil {
+			log.Printf("Interrupted, skipping the remaining %d scenarios", len(scenarios)-i)
+			break
+		}
+		log.Printf("========== [%d/%d] %s ==========", i+1, len(scenarios), s.Name)
+		summary.Scenarios = append(summary.Scenarios, runScenario(ctx, s, i, root))
+		r := summary.Scenarios[len(summary.Scenarios)-1]
+		log.Printf("[%d/%d] %s: %s, max RSS %.2f MB, heap ratio %.2fx (%.0fs)",
+			i+1, len(scenarios), s.Name, r.Status, float64(r.MaxRSS)/1024/1024, r.HeapRatio, r.Seconds)
+	}
+	summary.Finished = time.Now()
+
+	regressions := 0
+	if *baseline != "" {
+		summary.Baseline, summary.Threshold = *baseline, *maxRegression
+		regressions = compareBaseline(&summary, base, *maxRegression)
+	}
+	printTable(&summary)
+	path, err := save(root, &summary)
+	if err != nil {
+		log.Fatalf("Failed to save summary: %v", err)
+	}
+	log.Printf("Summary saved to: %s", path)
+
+	// 退出码: 失败场景中最大的退出码，其次是回归 (与 -max-* 阈值相同的 2)
+	code := 0
+	for _, r := range summary.Scenarios {
+		code = max(code, r.ExitCode)
+	}
+	if regressions > 0 {
+		log.Printf("%d scenarios regressed by more than %.0f%% against %s", regressions, *maxRegression*100, *baseline)
+		code = max(code, results.StatusThreshold.ExitCode())
+	}
+	os.Exit(code)
+}
+
+// runScenario 先运行 producer (fan-in 时同时运行全部 producer 进程) 再运行 consumer；producer 失败时不再运行 consumer
+func runScenario(ctx context.Context, s Scenario, index int, root string) ScenarioResult {
+	r := ScenarioResult{
+		Name:   s.Name,
+		Params: s.Params,
+		Dir:    filepath.Join(root, s.Name, *runID),
+	}
+	start := time.Now()
+	producers, err := producerCommands(s, index, root)
+	if err == nil {
+		if len(producers) > 1 {
+			r.Producers = len(producers)
+		}
+		err = runProducers(ctx, producers)
+	}
+	if err != nil {
+		err = fmt.Errorf("producer: %w", err)
+	} else if err = run(ctx, command("consumer", s, index, root)); err != nil {
+		err = fmt.Errorf("consumer: %w", err)
+	}
+	r.Seconds = time.Since(start).Seconds()
+	collect(&r, err)
+	return r
+}
+
+// command 一个场景中 program 的命令行，矩阵中的参数按名称排序
+func command(program string, s Scenario, index int, root string) []string {
+	bin := *producerBin
+	if program == "consumer" {
+		bin = *consumerBin
+	}
+	args := []string{
+		bin,
+		fmt.Sprintf("-topic=%s-%s-%d", *topicBase, *runID, index),
+		"-scenario=" + s.Name,
+		"-output=" + root,
+		"-layout=run",
+		"-run-id=" + *runID,
+	}
+	if *labels != "" {
+		args = append(args, "-labels="+*labels)
+	}
+	if *trackPIDs != "" {
+		args = append(args, "-track-pids="+*trackPIDs)
+	}
+	names := make([]string, 0, len(s.Flags[program]))
+	for k := range s.Flags[program] {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		args = append(args, fmt.Sprintf("-%s=%s", k, s.Flags[program][k]))
+	}
+	return args
+}
+
+// run 运行一个程序直到退出，输出直接转发；超过 -timeout 或 runner 被中断时先发 SIGINT 让它保存结果
+func run(ctx context.Context, args []string) error {
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Minute
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("interrupted after -timeout %v: %w", *timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matrix 矩阵文件 (YAML，JSON 也可以): Flags 为各场景共用的参数，格式与 presets/-config 相同；
+// Matrix 的每个轴给出一组取值，按全部轴的笛卡尔积展开为场景
+type Matrix struct {
+	Name        string                       `yaml:"name"`
+	Description string                       `yaml:"description"`
+	Flags       map[string]map[string]string `yaml:"flags"`
+	Matrix      map[string][]string          `yaml:"matrix"`
+}
+
+// axisFlag 常用的轴名对应的程序和 flag；其它参数用 <program>.<flag> 作为轴名。
+// 程序 runner 表示 runner 自身的参数 (见 runnerFlags)
+type axisFlag struct {
+	program string
+	flag    string
+}
+
+var knownAxes = map[string]axisFlag{
+	"size":            {"producer", "size"},
+	"queue-size":      {"consumer", "queue-size"},
+	"memory-limit":    {"consumer", "memory-limit"},
+	"gogc":            {"consumer", "gc-percent"},
+	"release-payload": {"consumer", "release-payload"},
+	"producers":       {"runner", "producers"},
+	"ingest-rate":     {"runner", "ingest-rate"},
+}
+
+// knownProgram 矩阵中可以设置参数的程序
+func knownProgram(program string) bool {
+	return program == "producer" || program == "consumer" || program == "runner"
+}
+
+// resolveAxis 返回轴对应的程序和 flag 名
+func resolveAxis(axis string) (axisFlag, error) {
+	if a, ok := knownAxes[axis]; ok {
+		return a, nil
+	}
+	program, name, ok := strings.Cut(axis, ".")
+	if !ok || !knownProgram(program) || name == "" {
+		known := make([]string, 0, len(knownAxes))
+		for k := range knownAxes {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return axisFlag{}, fmt.Errorf("unknown axis %q (want %s, or producer.<flag>/consumer.<flag>/runner.<flag>)", axis, strings.Join(known, ", "))
+	}
+	return axisFlag{program, name}, nil
+}
+
+// Scenario 矩阵中的一个组合
+type Scenario struct {
+	Name   string
+	Params map[string]string            // 轴名 -> 取值
+	Flags  map[string]map[string]string // 程序名 -> 合并后的参数
+}
+
+// LoadMatrix 读取矩阵文件，Name 为空时取文件名
+func LoadMatrix(path string) (Matrix, error) {
+	var m Matrix
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if m.Name == "" {
+		base := filepath.Base(path)
+		m.Name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	for program := range m.Flags {
+		if !knownProgram(program) {
+			return m, fmt.Errorf("%s: flags for unknown program %q (want producer, consumer or runner)", path, program)
+		}
+	}
+	for axis, values := range m.Matrix {
+		if _, err := resolveAxis(axis); err != nil {
+			return m, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(values) == 0 {
+			return m, fmt.Errorf("%s: axis %q has no values", path, axis)
+		}
+	}
+	return m, nil
+}
+
+// Expand 按轴名排序展开全部组合，后面的轴变化最快；
+// 场景名为取值多于一个的轴的 <轴>-<值> 用 _ 连接，只有一个取值的轴对所有场景相同，不进入名称
+func (m Matrix) Expand() []Scenario {
+	axes := make([]string, 0, len(m.Matrix))
+	for axis := range m.Matrix {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+
+	scenarios := []Scenario{{Params: map[string]string{}}}
+	for _, axis := range axes {
+		next := make([]Scenario, 0, len(scenarios)*len(m.Matrix[axis]))
+		for _, s := range scenarios {
+			for _, v := range m.Matrix[axis] {
+				params := make(map[string]string, len(s.Params)+1)
+				for k, pv := range s.Params {
+					params[k] = pv
+				}
+				params[axis] = v
+				next = append(next, Scenario{Params: params})
+			}
+		}
+		scenarios = next
+	}
+
+	for i := range scenarios {
+		s := &scenarios[i]
+		s.Flags = map[string]map[string]string{"producer": {}, "consumer": {}, "runner": {}}
+		for program, flags := range m.Flags {
+			for k, v := range flags {
+				s.Flags[program][k] = v
+			}
+		}
+		parts := make([]string, 0, len(axes))
+		for _, axis := range axes {
+			a, _ := resolveAxis(axis)
+			s.Flags[a.program][a.flag] = s.Params[axis]
+			if len(m.Matrix[axis]) > 1 {
+				parts = append(parts, sanitize(axis)+"-"+sanitize(s.Params[axis]))
+			}
+		}
+		s.Name = strings.Join(parts, "_")
+		if s.Name == "" {
+			s.Name = sanitize(m.Name)
+		}
+	}
+	return scenarios
+}
+
+// sanitize 把场景名中不适合做目录名和 topic 名的字符替换为 -
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
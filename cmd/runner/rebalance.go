@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// rebalanceScenario rebalance 测量的场景名，结果在 <output>/rebalance/rebalance/<run-id>/
+const rebalanceScenario = "rebalance"
+
+// RebalanceReport 写入 rebalance.json
+type RebalanceReport struct {
+	RunID        string              `json:"run_id"`
+	Topic        string              `json:"topic"`
+	Subscription string              `json:"subscription"`
+	WindowMs     int64               `json:"window_ms"` // 成员变化前后各取多长的样本
+	Events       []RebalanceEvent    `json:"events"`
+	Consumers    []RebalanceConsumer `json:"consumers"`
+	Producer     string              `json:"producer,omitempty"` // producer 失败时的错误
+}
+
+// RebalanceEvent 一次成员变化 (加入或离开) 及其前后各 consumer 进程的变化
+type RebalanceEvent struct {
+	Kind      string           `json:"kind"`  // join 或 leave
+	AtMs      int64            `json:"at_ms"` // 距 producer 启动
+	Consumers []string         `json:"consumers"`
+	Shifts    []RebalanceShift `json:"shifts"`
+}
+
+// RebalanceShift 一个 consumer 进程在成员变化前后 -window 内的吞吐、重投递和内存；
+// 变化时尚未加入或已经离开的一侧没有样本，对应字段为 0
+type RebalanceShift struct {
+	Consumer     string  `json:"consumer"`
+	RateBefore   float64 `json:"rate_before"` // msg/s
+	RateAfter    float64 `json:"rate_after"`
+	Redeliveries int64   `json:"redeliveries"`   // 变化之后窗口内收到的重投递
+	HeapBefore   uint64  `json:"heap_before"`    // 变化前 HeapAlloc 平均值
+	HeapAfterMax uint64  `json:"heap_after_max"` // 变化后 HeapAlloc 最大值
+	RSSBefore    uint64  `json:"rss_before"`     // 变化前 RSS 平均值
+	RSSAfterMax  uint64  `json:"rss_after_max"`  // 变化后 RSS 最大值
+	GCAfter      uint32  `json:"gc_after"`       // 变化后窗口内的 GC 次数
+}
+
+// RebalanceConsumer 一个 consumer 进程的整体结果
+type RebalanceConsumer struct {
+	Name         string `json:"name"`
+	JoinedMs     int64  `json:"joined_ms"`         // 距 producer 启动，初始成员为负
+	LeftMs       int64  `json:"left_ms,omitempty"` // 被 -leave 停止的时刻，其余成员在结束时停止
+	Messages     int64  `json:"messages"`
+	Redeliveries int64  `json:"redeliveries"`
+	MaxRSS       uint64 `json:"max_rss"`
+	MaxHeap      uint64 `json:"max_heap_alloc"`
+	Error        string `json:"error,omitempty"`
+}
+
+// member 一个 consumer 进程；stop 以 SIGINT 结束它 (消费端处理完剩余批次并写出结果)
+type member struct {
+	name    string
+	joined  time.Time
+	left    time.Time // 被 -leave 停止的时刻，结束时统一停止的为零值
+	stop    context.CancelFunc
+	done    chan struct{}
+	err     error
+	samples []metrics.MemoryStats
+	summary metrics.MemorySummary
+}
+
+// startMember 启动一个 consumer 进程
+func startMember(ctx context.Context, name string, args []string) (*member, error) {
+	ctx, stop := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Minute
+	if err := cmd.Start(); err != nil {
+		stop()
+		return nil, err
+	}
+	m := &member{name: name, joined: time.Now(), stop: stop, done: make(chan struct{})}
+	go func() {
+		m.err = cmd.Wait()
+		close(m.done)
+	}()
+	return m, nil
+}
+
+// wait 停止进程并等待它退出
+func (m *member) wait() {
+	m.stop()
+	<-m.done
+}
+
+// runRebalance 实现 runner rebalance: -consumers 个 consumer 进程以 Shared 订阅同一个 topic，
+// producer 以 -rate 持续写入 -duration；-join-after 时再加入 -join 个进程，-leave-after 时停止最早的 -leave 个，
+// 比较每次成员变化前后 -window 内各进程的吞吐、重投递和内存，结果写入 rebalance.json。
+// producer 或任一 consumer 失败时以 1 结束
+func runRebalance(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("rebalance", flag.ExitOnError)
+	url := fs.String("url", "", "Pulsar service URL for producer and consumers (empty = their default)")
+	consumers := fs.Int("consumers", 2, "Consumer processes subscribed from the start")
+	join := fs.Int("join", 1, "Consumer processes started at -join-after (0 = no join)")
+	leave := fs.Int("leave", 1, "Consumer processes (earliest first) stopped at -leave-after (0 = no leave)")
+	joinAfter := fs.Duration("join-after", 20*time.Second, "Time after the producer starts when -join consumers join")
+	leaveAfter := fs.Duration("leave-after", 40*time.Second, "Time after the producer starts when -leave consumers leave")
+	duration := fs.Duration("duration", time.Minute, "How long the producer writes at -rate")
+	rate := fs.Float64("rate", 5000, "Producer rate in msg/s")
+	size := fs.Int("size", 1024, "Message size in bytes")
+	batchSize := fs.Int64("batch-size", 1024*1024, "Consumer -batch-size; smaller batches ack sooner, so fewer messages are redelivered on leave")
+	window := fs.Duration("window", 10*time.Second, "Samples before and after each membership change compared per consumer")
+	drain := fs.Duration("drain", 10*time.Second, "Time the remaining consumers keep receiving after the producer finishes")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] rebalance [rebalance flags]\n\nRebalance flags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *consumers < 1 || *join < 0 || *leave < 0 || *leave > *consumers+*join ||
+		*rate <= 0 || *size <= 0 || *duration <= 0 || *window <= 0 {
+		fs.Usage()
+		return 1
+	}
+	if (*join > 0 && *joinAfter >= *duration) || (*leave > 0 && *leaveAfter >= *duration) {
+		log.Printf("-join-after and -leave-after must be within -duration %v", *duration)
+		return 1
+	}
+
+	if *runID == "" {
+		*runID = results.NewRunID()
+	}
+	dir := filepath.Join(*outputDir, rebalanceScenario, rebalanceScenario, *runID)
+	topic := fmt.Sprintf("%s-rebalance-%s", *topicBase, *runID)
+	common := []string{"-topic=" + topic, "-output=" + dir, "-layout=flat", "-run-id=" + *runID, "-pprof-port=0"}
+	if *labels != "" {
+		common = append(common, "-labels="+*labels)
+	}
+	if *trackPIDs != "" {
+		common = append(common, "-track-pids="+*trackPIDs)
+	}
+	if *url != "" {
+		common = append(common, "-url="+*url)
+	}
+	total := int64(*rate*duration.Seconds()) * int64(*size)
+	producer := append([]string{*producerBin}, common...)
+	producer = append(producer, "-scenario=producer", "-total="+strconv.FormatInt(total, 10),
+		"-size="+strconv.Itoa(*size), "-rate="+strconv.FormatFloat(*rate, 'f', -1, 64))
+	consumer := func(i int) []string {
+		cmd := append([]string{*consumerBin}, common...)
+		return append(cmd, "-scenario=consumer-"+strconv.Itoa(i), "-sub="+rebalanceScenario, "-sub-type=shared",
+			"-until-signal", "-batch-size="+strconv.FormatInt(*batchSize, 10))
+	}
+
+	log.Printf("Rebalance: %d consumers on %s (shared), +%d at %v, -%d at %v, %.0f msg/s x %d bytes for %v, results in %s",
+		*consumers, topic, *join, *joinAfter, *leave, *leaveAfter, *rate, *size, *duration, dir)
+	if *dryRun {
+		for i := range *consumers + *join {
+			log.Printf("  %s", strings.Join(consumer(i), " "))
+		}
+		log.Printf("  %s", strings.Join(producer, " "))
+		return 0
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Failed to create %s: %v", dir, err)
+		return 1
+	}
+
+	var (
+		mu      sync.Mutex
+		members []*member
+		events  []RebalanceEvent
+	)
+	start := func(i int) bool {
+		m, err := startMember(ctx, "consumer-"+strconv.Itoa(i), consumer(i))
+		if err != nil {
+			log.Printf("Failed to start consumer-%d: %v", i, err)
+			return false
+		}
+		mu.Lock()
+		members = append(members, m)
+		mu.Unlock()
+		return true
+	}
+	stopAll := func() {
+		mu.Lock()
+		ms := append([]*member(nil), members...)
+		mu.Unlock()
+		var wg sync.WaitGroup
+		for _, m := range ms {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.wait()
+			}()
+		}
+		wg.Wait()
+	}
+	for i := range *consumers {
+		if !start(i) {
+			stopAll()
+			return 1
+		}
+	}
+
+	// producer 与成员变化并行，成员变化的时刻相对 producer 启动
+	begin := time.Now()
+	prodDone := make(chan error, 1)
+	go func() { prodDone <- run(ctx, producer) }()
+
+	changeCtx, cancelChanges := context.WithCancel(ctx)
+	defer cancelChanges()
+	schedule := func(after time.Duration, kind string, change func() []string) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			select {
+			case <-time.After(time.Until(begin.Add(after))):
+			case <-changeCtx.Done():
+				return
+			}
+			at := time.Now()
+			names := change()
+			log.Printf("Rebalance: %s %s at %v", kind, strings.Join(names, ", "), at.Sub(begin).Round(time.Millisecond))
+			mu.Lock()
+			events = append(events, RebalanceEvent{Kind: kind, AtMs: at.Sub(begin).Milliseconds(), Consumers: names})
+			mu.Unlock()
+		}()
+		return done
+	}
+	var changes []<-chan struct{}
+	if *join > 0 {
+		changes = append(changes, schedule(*joinAfter, "join", func() []string {
+			var names []string
+			for i := *consumers; i < *consumers+*join; i++ {
+				if start(i) {
+					names = append(names, "consumer-"+strconv.Itoa(i))
+				}
+			}
+			return names
+		}))
+	}
+	if *leave > 0 {
+		changes = append(changes, schedule(*leaveAfter, "leave", func() []string {
+			mu.Lock()
+			var leaving []*member
+			for _, m := range members {
+				if len(leaving) < *leave && m.left.IsZero() {
+					m.left = time.Now()
+					leaving = append(leaving, m)
+				}
+			}
+			mu.Unlock()
+			names := make([]string, len(leaving))
+			for i, m := range leaving {
+				names[i] = m.name
+				m.stop()
+			}
+			return names
+		}))
+	}
+
+	prodErr := <-prodDone
+	if prodErr != nil {
+		// producer 失败后的成员变化没有意义
+		cancelChanges()
+	}
+	for _, c := range changes {
+		<-c
+	}
+	if prodErr == nil && ctx.Err() == nil {
+		select {
+		case <-time.After(*drain):
+		case <-ctx.Done():
+		}
+	}
+	stopAll()
+
+	rep := RebalanceReport{RunID: *runID, Topic: topic, Subscription: rebalanceScenario, WindowMs: window.Milliseconds()}
+	if prodErr != nil {
+		rep.Producer = prodErr.Error()
+	}
+	failed := prodErr != nil
+	for _, m := range members {
+		c := RebalanceConsumer{Name: m.name, JoinedMs: m.joined.Sub(begin).Milliseconds()}
+		if !m.left.IsZero() {
+			c.LeftMs = m.left.Sub(begin).Milliseconds()
+		}
+		if m.err != nil {
+			c.Error = m.err.Error()
+			failed = true
+		}
+		stats, err := metrics.LoadStats(filepath.Join(dir, "stats_"+m.name+".json"))
+		if err != nil {
+			if c.Error == "" {
+				c.Error = err.Error()
+			}
+			failed = true
+		} else {
+			m.samples, m.summary = stats.Samples, stats.Summary
+			c.Messages, c.Redeliveries = m.summary.MessageCount, m.summary.RedeliveryCount
+			c.MaxRSS, c.MaxHeap = m.summary.MaxRSS, m.summary.MaxHeapAlloc
+		}
+		rep.Consumers = append(rep.Consumers, c)
+	}
+	for i := range events {
+		at := begin.Add(time.Duration(events[i].AtMs) * time.Millisecond)
+		for _, m := range members {
+			events[i].Shifts = append(events[i].Shifts, shift(m, at, *window))
+		}
+	}
+	rep.Events = events
+
+	path := filepath.Join(dir, "rebalance.json")
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err == nil {
+		err = results.WriteBytes(path, append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("Failed to write %s: %v", path, err)
+		failed = true
+	}
+	printRebalance(rep)
+	log.Printf("Results in %s", dir)
+	if failed {
+		return results.StatusError.ExitCode()
+	}
+	return 0
+}
+
+// shift 按样本时间比较一个成员在 at 前后 window 内的吞吐、重投递和内存
+func shift(m *member, at time.Time, window time.Duration) RebalanceShift {
+	s := RebalanceShift{Consumer: m.name}
+	var before, after []metrics.MemoryStats
+	var last *metrics.MemoryStats // at 之前的最后一个样本，重投递从它开始计
+	for i := range m.samples {
+		ts := m.samples[i].Timestamp
+		switch {
+		case ts.Before(at):
+			last = &m.samples[i]
+			if !ts.Before(at.Add(-window)) {
+				before = append(before, m.samples[i])
+			}
+		case !ts.After(at.Add(window)):
+			after = append(after, m.samples[i])
+		}
+	}
+	s.RateBefore, s.RateAfter = sampleRate(before), sampleRate(after)
+	if len(before) > 0 {
+		var heap, rss uint64
+		for _, b := range before {
+			heap += b.HeapAlloc
+			rss += b.RSS
+		}
+		s.HeapBefore, s.RSSBefore = heap/uint64(len(before)), rss/uint64(len(before))
+	}
+	if len(after) > 0 {
+		for _, a := range after {
+			s.HeapAfterMax, s.RSSAfterMax = max(s.HeapAfterMax, a.HeapAlloc), max(s.RSSAfterMax, a.RSS)
+		}
+		end := after[len(after)-1]
+		s.Redeliveries = end.RedeliveryCount
+		gc := after[0].NumGC
+		if last != nil {
+			s.Redeliveries -= last.RedeliveryCount
+			gc = last.NumGC
+		}
+		s.GCAfter = end.NumGC - gc
+	}
+	return s
+}
+
+// sampleRate 样本区间内的 msg/s，少于两个样本时为 0
+func sampleRate(samples []metrics.MemoryStats) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	secs := last.Timestamp.Sub(first.Timestamp).Seconds()
+	if secs <= 0 {
+		return 0
+	}
+	return float64(last.MessageCount-first.MessageCount) / secs
+}
+
+// printRebalance 打印每次成员变化前后各进程的变化和各进程的合计
+func printRebalance(rep RebalanceReport) {
+	mb := func(v uint64) float64 { return float64(v) / 1024 / 1024 }
+	log.Println("")
+	log.Printf("========== Rebalance ==========")
+	for _, e := range rep.Events {
+		log.Printf("  %s %s at %.1fs (window %v):", e.Kind, strings.Join(e.Consumers, ", "),
+			float64(e.AtMs)/1000, time.Duration(rep.WindowMs)*time.Millisecond)
+		for _, s := range e.Shifts {
+			log.Printf("    %-12s %8.0f -> %8.0f msg/s | redelivered %6d | heap %7.2f -> %7.2f MB | RSS %7.2f -> %7.2f MB | %d GCs",
+				s.Consumer, s.RateBefore, s.RateAfter, s.Redeliveries, mb(s.HeapBefore), mb(s.HeapAfterMax),
+				mb(s.RSSBefore), mb(s.RSSAfterMax), s.GCAfter)
+		}
+	}
+	log.Printf("  Totals:")
+	for _, c := range rep.Consumers {
+		line := fmt.Sprintf("    %-12s %9d msgs | redelivered %6d | max RSS %7.2f MB, max heap %7.2f MB",
+			c.Name, c.Messages, c.Redeliveries, mb(c.MaxRSS), mb(c.MaxHeap))
+		if c.Error != "" {
+			line += " | " + c.Error
+		}
+		log.Print(line)
+	}
+	if rep.Producer != "" {
+		log.Printf("  Producer failed: %s", rep.Producer)
+	}
+	log.Println("===============================")
+}
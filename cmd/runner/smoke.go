@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// smokeScenario smoke 自检的场景名，结果在 <output>/smoke/<run-id>/
+const smokeScenario = "smoke"
+
+// smokeProducer producer.json 中自检用到的字段 (完整结构在 cmd/producer 的 ProducerReport)
+type smokeProducer struct {
+	Summary struct {
+		DurationMs   int64 `json:"duration_ms"`
+		MessageCount int64 `json:"message_count"`
+		MessageBytes int64 `json:"message_bytes"`
+		ErrorCount   int64 `json:"error_count"`
+	} `json:"summary"`
+}
+
+// smokeCheck 健康摘要中的一项检查
+type smokeCheck struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+// runSmoke 实现 runner smoke: 对配置的 broker 先生产再消费一小段固定负载 (-messages 条 -size 字节、开启 -verify)，
+// 检查发送数、接收数和 payload 校验，打印一屏的健康摘要。用于正式跑场景之前确认环境可用；
+// 任何一项失败时以 result.json 的退出码 (或 1) 结束
+func runSmoke(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("smoke", flag.ExitOnError)
+	url := fs.String("url", "", "Pulsar service URL for producer and consumer (empty = their default)")
+	adminURL := fs.String("admin-url", "", "Pulsar admin URL for their -precheck (empty = their default)")
+	messages := fs.Int64("messages", 10000, "Messages to produce and consume")
+	size := fs.Int("size", 1024, "Message size in bytes")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] smoke [smoke flags]\n\nSmoke flags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *messages <= 0 || *size <= 0 {
+		fs.Usage()
+		return 1
+	}
+
+	if *runID == "" {
+		*runID = results.NewRunID()
+	}
+	root := filepath.Join(*outputDir, smokeScenario)
+	dir := filepath.Join(root, smokeScenario, *runID)
+	total := *messages * int64(*size)
+	common := []string{
+		fmt.Sprintf("-topic=%s-smoke-%s", *topicBase, *runID),
+		"-scenario=" + smokeScenario,
+		"-output=" + root,
+		"-layout=run",
+		"-run-id=" + *runID,
+	}
+	if *labels != "" {
+		common = append(common, "-labels="+*labels)
+	}
+	if *trackPIDs != "" {
+		common = append(common, "-track-pids="+*trackPIDs)
+	}
+	if *url != "" {
+		common = append(common, "-url="+*url)
+	}
+	if *adminURL != "" {
+		common = append(common, "-admin-url="+*adminURL)
+	}
+	producer := append([]string{*producerBin}, common...)
+	producer = append(producer, "-total="+strconv.FormatInt(total, 10), "-size="+strconv.Itoa(*size))
+	// 批次为总量的四分之一，保证处理过完整批次后 consumer 才会在空闲时结束
+	consumer := append([]string{*consumerBin}, common...)
+	consumer = append(consumer, "-verify", "-batch-size="+strconv.FormatInt(max(total/4, 1), 10))
+
+	log.Printf("Smoke test: %d x %d bytes on %s-smoke-%s, results in %s", *messages, *size, *topicBase, *runID, dir)
+	if *dryRun {
+		log.Printf("  %s", strings.Join(producer, " "))
+		log.Printf("  %s", strings.Join(consumer, " "))
+		return 0
+	}
+
+	start := time.Now()
+	var checks []smokeCheck
+	prodErr := run(ctx, producer)
+	checks = append(checks, smokeCheck{"producer", prodErr == nil, exitDetail(prodErr, dir, "producer")})
+	if prodErr == nil {
+		consErr := run(ctx, consumer)
+		checks = append(checks, smokeCheck{"consumer", consErr == nil, exitDetail(consErr, dir, "consumer")})
+	}
+
+	var prod smokeProducer
+	if prodErr == nil {
+		data, err := os.ReadFile(filepath.Join(dir, "producer.json"))
+		if err == nil {
+			err = json.Unmarshal(data, &prod)
+		}
+		if err != nil {
+			checks = append(checks, smokeCheck{"producer report", false, err.Error()})
+		} else {
+			p := prod.Summary
+			checks = append(checks, smokeCheck{"sent", p.MessageCount == *messages && p.ErrorCount == 0,
+				fmt.Sprintf("%d of %d messages, %d errors", p.MessageCount, *messages, p.ErrorCount)})
+		}
+	}
+	var s metrics.MemorySummary
+	stats, err := metrics.LoadStats(filepath.Join(dir, "stats.json"))
+	if err != nil {
+		if prodErr == nil {
+			checks = append(checks, smokeCheck{"consumer stats", false, err.Error()})
+		}
+	} else {
+		s = stats.Summary
+		checks = append(checks,
+			smokeCheck{"received", s.MessageCount == prod.Summary.MessageCount,
+				fmt.Sprintf("%d of %d sent", s.MessageCount, prod.Summary.MessageCount)},
+			smokeCheck{"integrity", s.CorruptCount == 0 && s.DecodeErrors == 0 && s.VerifiedCount == s.MessageCount,
+				fmt.Sprintf("%d verified, %d corrupt, %d unverifiable, %d decode errors",
+					s.VerifiedCount, s.CorruptCount, s.UnverifiableCount, s.DecodeErrors)})
+	}
+
+	passed := true
+	for _, c := range checks {
+		passed = passed && c.ok
+	}
+	printSmoke(checks, prod, s, passed, time.Since(start), dir)
+	if passed {
+		return 0
+	}
+	// 优先用 producer/consumer 自己的结论 (如校验失败为 StatusVerification)
+	if res, ok := readResult(dir); ok && res.ExitCode != 0 {
+		return res.ExitCode
+	}
+	return results.StatusError.ExitCode()
+}
+
+// printSmoke 打印一屏的健康摘要
+func printSmoke(checks []smokeCheck, prod smokeProducer, s metrics.MemorySummary, passed bool, elapsed time.Duration, dir string) {
+	mb := func(v float64) float64 { return v / 1024 / 1024 }
+	log.Println("")
+	log.Printf("========== Smoke test ==========")
+	for _, c := range checks {
+		mark := "OK  "
+		if !c.ok {
+			mark = "FAIL"
+		}
+		log.Printf("  [%s] %-16s %s", mark, c.name, c.detail)
+	}
+	if p := prod.Summary; p.DurationMs > 0 {
+		secs := float64(p.DurationMs) / 1000
+		log.Printf("  Produce: %.2f MB in %.2fs (%.0f msg/s)", mb(float64(p.MessageBytes)), secs, float64(p.MessageCount)/secs)
+	}
+	if secs := s.Duration.Seconds(); secs > 0 {
+		log.Printf("  Consume: %.2f MB in %.2fs (%.0f msg/s) | max RSS %.2f MB, max heap %.2f MB",
+			mb(float64(s.MessageBytes)), secs, float64(s.MessageCount)/secs, mb(float64(s.MaxRSS)), mb(float64(s.MaxHeapAlloc)))
+	}
+	if s.Latency != nil {
+		log.Printf("  Latency: p50 %.2f ms, p99 %.2f ms", s.Latency.P50Ms, s.Latency.P99Ms)
+	}
+	result := "PASSED"
+	if !passed {
+		result = "FAILED"
+	}
+	log.Printf("  %s in %v, results in %s", result, elapsed.Round(time.Millisecond), dir)
+	log.Println("================================")
+}
+
+// readResult 读取 run 目录中 producer 和 consumer 合并写入的 result.json
+func readResult(dir string) (results.Result, bool) {
+	var res results.Result
+	data, err := os.ReadFile(filepath.Join(dir, "result.json"))
+	if err != nil {
+		return res, false
+	}
+	return res, json.Unmarshal(data, &res) == nil
+}
+
+// exitDetail 进程退出情况的说明，失败时附上该程序在 result.json 中的原因
+func exitDetail(err error, dir, program string) string {
+	if err == nil {
+		return "exited 0"
+	}
+	if res, ok := readResult(dir); ok {
+		if p, ok := res.Programs[program]; ok && p.Reason != "" {
+			return fmt.Sprintf("%v: %s (%s)", err, p.Status, p.Reason)
+		}
+	}
+	return err.Error()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// Summary 一次矩阵运行的汇总，写入 <output>/<matrix>/summary-<run-id>.json，
+// 可作为下一次运行 (如换了 pulsar-client-go 版本) 的 -baseline
+type Summary struct {
+	Matrix    string            `json:"matrix"`
+	RunID     string            `json:"run_id"`
+	Started   time.Time         `json:"started"`
+	Finished  time.Time         `json:"finished"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Baseline  string            `json:"baseline,omitempty"`
+	Threshold float64           `json:"max_regression,omitempty"`
+	Scenarios []ScenarioResult  `json:"scenarios"`
+}
+
+// ScenarioResult 一个场景的结论和 consumer 的关键内存指标
+type ScenarioResult struct {
+	Name         string            `json:"name"`
+	Params       map[string]string `json:"params"`
+	Dir          string            `json:"dir"`                 // run 目录，含 stats.json、heap.pprof 和日志
+	Producers    int               `json:"producers,omitempty"` // fan-in 时同时写入的 producer 进程数
+	Status       results.Status    `json:"status"`
+	ExitCode     int               `json:"exit_code"`
+	Reason       string            `json:"reason,omitempty"`
+	Seconds      float64           `json:"seconds"`
+	Messages     int64             `json:"messages"`
+	MaxRSS       uint64            `json:"max_rss"`
+	MaxHeapAlloc uint64            `json:"max_heap_alloc"`
+	HeapRatio    float64           `json:"heap_ratio"`
+	RSSRatio     float64           `json:"rss_ratio"`
+	P99LatencyMs float64           `json:"p99_latency_ms,omitempty"` // 端到端延迟 p99，旧版 consumer 没有
+	MaxTotalRSS  uint64            `json:"max_total_rss,omitempty"`  // -track-pids 时 consumer 与登记进程合计 RSS 的峰值
+	Baseline     *BaselineDelta    `json:"baseline,omitempty"`
+}
+
+// BaselineDelta 与 -baseline 中同名场景的对比，变化为相对值 (0.1 = 增加 10%)
+type BaselineDelta struct {
+	MaxRSS          uint64  `json:"max_rss"`
+	HeapRatio       float64 `json:"heap_ratio"`
+	MaxRSSChange    float64 `json:"max_rss_change"`
+	HeapRatioChange float64 `json:"heap_ratio_change"`
+	Regression      bool    `json:"regression"`
+}
+
+// collect 从 run 目录读取 result.json 的结论和 stats.json 的摘要；进程异常退出时以 exitErr 为准
+func collect(r *ScenarioResult, exitErr error) {
+	r.Status, r.ExitCode = results.StatusOK, 0
+	if data, err := os.ReadFile(filepath.Join(r.Dir, "result.json")); err == nil {
+		var res results.Result
+		if err := json.Unmarshal(data, &res); err == nil {
+			r.Status, r.ExitCode, r.Reason = res.Status, res.ExitCode, res.Reason
+		}
+	}
+	if exitErr != nil && r.ExitCode == 0 {
+		r.Status, r.ExitCode, r.Reason = results.StatusError, results.StatusError.ExitCode(), exitErr.Error()
+	}
+
+	stats, err := metrics.LoadStats(filepath.Join(r.Dir, "stats.json"))
+	if err != nil {
+		if r.ExitCode == 0 {
+			r.Status, r.ExitCode, r.Reason = results.StatusError, results.StatusError.ExitCode(), fmt.Sprintf("no consumer stats: %v", err)
+		}
+		return
+	}
+	s := stats.Summary
+	r.Messages = s.MessageCount
+	r.MaxRSS, r.MaxHeapAlloc = s.MaxRSS, s.MaxHeapAlloc
+	r.HeapRatio, r.RSSRatio = s.HeapRatio, s.RSSRatio
+	r.MaxTotalRSS = s.MaxTotalRSS
+	if s.Latency != nil {
+		r.P99LatencyMs = s.Latency.P99Ms
+	}
+}
+
+// loadSummary 读取之前写出的 summary JSON
+func loadSummary(path string) (Summary, error) {
+	var s Summary
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// compareBaseline 按场景名与基线对比，MaxRSS 或 HeapRatio 增加超过 threshold 记为回归，返回回归的场景数。
+// 基线中没有或未成功的场景不比较
+func compareBaseline(s *Summary, base Summary, threshold float64) int {
+	prev := make(map[string]ScenarioResult, len(base.Scenarios))
+	for _, b := range base.Scenarios {
+		if b.Status == results.StatusOK {
+			prev[b.Name] = b
+		}
+	}
+	regressions := 0
+	for i := range s.Scenarios {
+		r := &s.Scenarios[i]
+		b, ok := prev[r.Name]
+		if !ok || r.Status != results.StatusOK {
+			continue
+		}
+		d := &BaselineDelta{
+			MaxRSS:          b.MaxRSS,
+			HeapRatio:       b.HeapRatio,
+			MaxRSSChange:    change(float64(r.MaxRSS), float64(b.MaxRSS)),
+			HeapRatioChange: change(r.HeapRatio, b.HeapRatio),
+		}
+		d.Regression = d.MaxRSSChange > threshold || d.HeapRatioChange > threshold
+		if d.Regression {
+			regressions++
+		}
+		r.Baseline = d
+	}
+	return regressions
+}
+
+func change(cur, base float64) float64 {
+	if base == 0 {
+		return 0
+	}
+	return cur/base - 1
+}
+
+// writeTable 输出对比表，markdown 为 false 时输出对齐的纯文本
+func writeTable(w io.Writer, s *Summary, markdown bool) error {
+	params := paramNames(s)
+	header := append(append([]string{"scenario"}, params...), "status", "messages", "max RSS (MB)", "max heap (MB)", "heap ratio", "RSS ratio", "p99 latency (ms)")
+	if s.Baseline != "" {
+		header = append(header, "RSS vs base", "heap ratio vs base")
+	}
+	rows := [][]string{header}
+	for _, r := range s.Scenarios {
+		row := []string{r.Name}
+		for _, p := range params {
+			row = append(row, r.Params[p])
+		}
+		row = append(row, string(r.Status), fmt.Sprint(r.Messages),
+			fmt.Sprintf("%.2f", float64(r.MaxRSS)/1024/1024), fmt.Sprintf("%.2f", float64(r.MaxHeapAlloc)/1024/1024),
+			fmt.Sprintf("%.2fx", r.HeapRatio), fmt.Sprintf("%.2fx", r.RSSRatio), fmt.Sprintf("%.2f", r.P99LatencyMs))
+		if s.Baseline != "" {
+			if d := r.Baseline; d != nil {
+				row = append(row, s.formatChange(d.MaxRSSChange), s.formatChange(d.HeapRatioChange))
+			} else {
+				row = append(row, "-", "-")
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if markdown {
+		for i, row := range rows {
+			if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+				return err
+			}
+			if i == 0 {
+				fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(row)))
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// formatChange 相对变化的百分比，超过 -max-regression 时标记
+func (s *Summary) formatChange(c float64) string {
+	if c > s.Threshold {
+		return fmt.Sprintf("%+.1f%% REGRESSION", c*100)
+	}
+	return fmt.Sprintf("%+.1f%%", c*100)
+}
+
+// paramNames 全部场景出现过的轴名，排序后作为表格的列
+func paramNames(s *Summary) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range s.Scenarios {
+		for k := range r.Params {
+			if !seen[k] {
+				seen[k] = true
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// save 写出 summary-<run-id>.json 和同名的 Markdown 表格，返回 JSON 路径
+func save(dir string, s *Summary) (string, error) {
+	path := filepath.Join(dir, "summary-"+s.RunID+".json")
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return path, err
+	}
+	// 所有场景的 producer 都没能启动时目录还不存在
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return path, err
+	}
+	if err := results.WriteBytes(path, append(data, '\n')); err != nil {
+		return path, err
+	}
+	mdPath := strings.TrimSuffix(path, ".json") + ".md"
+	err = results.WriteFile(mdPath, func(w io.Writer) error {
+		fmt.Fprintf(w, "# %s (%s)\n\n", s.Matrix, s.RunID)
+		return writeTable(w, s, true)
+	})
+	return path, err
+}
+
+// printTable 把对比表打印到日志
+func printTable(s *Summary) {
+	var b strings.Builder
+	writeTable(&b, s, false)
+	log.Println("")
+	log.Printf("========== Matrix %s (%s) ==========", s.Matrix, s.RunID)
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		log.Println(line)
+	}
+}
@@ -0,0 +1,260 @@
+// Package admin 访问 Pulsar admin REST API 的最小客户端，只实现测试需要的查询和少量操作 (触发消息过期)
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultURL 与脚本中 ADMIN_URL 的默认值一致
+const DefaultURL = "http://localhost:8080"
+
+// ErrNotFound admin REST 返回 404，如 topic 或订阅不存在
+var ErrNotFound = errors.New("404 Not Found")
+
+// Client admin REST 客户端
+type Client struct {
+	URL  string
+	http *http.Client
+}
+
+// New 创建客户端，url 如 http://localhost:8080
+func New(url string) *Client {
+	return &Client{URL: strings.TrimRight(url, "/"), http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// topicPath 把 persistent://tenant/ns/topic 或短名称转换为 REST 路径 persistent/tenant/ns/topic
+func topicPath(topic string) string {
+	if domain, rest, ok := strings.Cut(topic, "://"); ok {
+		return domain + "/" + rest
+	}
+	if strings.Count(topic, "/") == 2 {
+		return "persistent/" + topic
+	}
+	return "persistent/public/default/" + topic
+}
+
+// namespacePath topic 所在 namespace 的 REST 路径，如 public/default
+func namespacePath(topic string) string {
+	parts := strings.SplitN(topicPath(topic), "/", 4)
+	return parts[1] + "/" + parts[2]
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, out)
+}
+
+// do 发送请求，out 非 nil 时解码响应；响应体为空 (如未设置的策略) 时 out 保持不变
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+"/admin/v2/"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("admin: %s %s: %w %s", method, path, ErrNotFound, strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("admin: %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// Partitions 返回分区数，非分区 topic 为 0
+func (c *Client) Partitions(ctx context.Context, topic string) (int, error) {
+	var meta struct {
+		Partitions int `json:"partitions"`
+	}
+	if err := c.get(ctx, topicPath(topic)+"/partitioned-metadata", &meta); err != nil {
+		return 0, err
+	}
+	return meta.Partitions, nil
+}
+
+// TopicExists topic 是否存在: 分区 topic 看分区元数据，非分区 topic 看 stats 是否 404
+func (c *Client) TopicExists(ctx context.Context, topic string) (bool, error) {
+	n, err := c.Partitions(ctx, topic)
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+	_, err = c.stats(ctx, topic, 0)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateTopic 创建非分区 topic
+func (c *Client) CreateTopic(ctx context.Context, topic string) error {
+	return c.do(ctx, http.MethodPut, topicPath(topic), nil)
+}
+
+// SubscriptionStats topic stats 中单个订阅的部分字段
+type SubscriptionStats struct {
+	MsgBacklog int64   `json:"msgBacklog"`
+	MsgRateOut float64 `json:"msgRateOut"`
+	// AckHoles mark-delete 位置之后单独确认的区间数，即确认空洞
+	AckHoles   int   `json:"nonContiguousDeletedMessagesRanges"`
+	MsgExpired int64 `json:"totalMsgExpired"` // 因 TTL 过期的累计消息数
+	Consumers  []struct {
+		ConsumerName  string `json:"consumerName"`
+		MsgOutCounter int64  `json:"msgOutCounter"` // 推送给该消费者的消息数，消费者重连后从 0 开始
+	} `json:"consumers"`
+}
+
+// TopicStats topic stats 的部分字段，分区 topic 为所有分区的汇总
+type TopicStats struct {
+	MsgInCounter   int64                        `json:"msgInCounter"`
+	BytesInCounter int64                        `json:"bytesInCounter"`
+	StorageSize    int64                        `json:"storageSize"`
+	BacklogSize    int64                        `json:"backlogSize"`
+	Subscriptions  map[string]SubscriptionStats `json:"subscriptions"`
+}
+
+// Stats 读取 topic stats，分区 topic 使用 partitioned-stats
+func (c *Client) Stats(ctx context.Context, topic string) (TopicStats, error) {
+	n, err := c.Partitions(ctx, topic)
+	if err != nil {
+		return TopicStats{}, err
+	}
+	return c.stats(ctx, topic, n)
+}
+
+func (c *Client) stats(ctx context.Context, topic string, n int) (TopicStats, error) {
+	var stats TopicStats
+	path := topicPath(topic) + "/stats"
+	if n > 0 {
+		path = topicPath(topic) + "/partitioned-stats"
+	}
+	err := c.get(ctx, path, &stats)
+	return stats, err
+}
+
+// Backlog 返回订阅的未消费消息数，订阅不存在时返回错误
+func (c *Client) Backlog(ctx context.Context, topic, subscription string) (int64, error) {
+	sub, err := c.Subscription(ctx, topic, subscription)
+	return sub.MsgBacklog, err
+}
+
+// Subscription 读取单个订阅的 stats，订阅不存在时返回错误
+func (c *Client) Subscription(ctx context.Context, topic, subscription string) (SubscriptionStats, error) {
+	stats, err := c.Stats(ctx, topic)
+	if err != nil {
+		return SubscriptionStats{}, err
+	}
+	sub, ok := stats.Subscriptions[subscription]
+	if !ok {
+		return SubscriptionStats{}, fmt.Errorf("admin: subscription %q not found on %s", subscription, topic)
+	}
+	return sub, nil
+}
+
+// MessageTTL 返回 topic 所在 namespace 的消息 TTL，未设置时为 0
+func (c *Client) MessageTTL(ctx context.Context, topic string) (time.Duration, error) {
+	var seconds int
+	if err := c.get(ctx, "namespaces/"+namespacePath(topic)+"/messageTTL", &seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// ExpireMessages 让订阅立即过期早于 ttl 的消息 (与 broker 定期的 TTL 检查效果相同)，
+// 分区 topic 作用于所有分区
+func (c *Client) ExpireMessages(ctx context.Context, topic, subscription string, ttl time.Duration) error {
+	path := fmt.Sprintf("%s/subscription/%s/expireMessages/%d", topicPath(topic), url.PathEscape(subscription), int(ttl.Seconds()))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
+
+// internalStats internalStats 的部分字段
+type internalStats struct {
+	NumberOfEntries int64 `json:"numberOfEntries"`
+	TotalSize       int64 `json:"totalSize"`
+}
+
+// Entries 返回 managed ledger 中的 entry 数和总字节数，分区 topic 为所有分区之和
+func (c *Client) Entries(ctx context.Context, topic string) (entries, size int64, err error) {
+	n, err := c.Partitions(ctx, topic)
+	if err != nil {
+		return 0, 0, err
+	}
+	return c.entries(ctx, topic, n)
+}
+
+func (c *Client) entries(ctx context.Context, topic string, n int) (entries, size int64, err error) {
+	if n == 0 {
+		var s internalStats
+		err = c.get(ctx, topicPath(topic)+"/internalStats", &s)
+		return s.NumberOfEntries, s.TotalSize, err
+	}
+	var ps struct {
+		Partitions map[string]internalStats `json:"partitions"`
+	}
+	if err := c.get(ctx, topicPath(topic)+"/partitioned-internalStats", &ps); err != nil {
+		return 0, 0, err
+	}
+	for _, s := range ps.Partitions {
+		entries += s.NumberOfEntries
+		size += s.TotalSize
+	}
+	return entries, size, nil
+}
+
+// TopicSnapshot 某一时刻 broker 端的 topic 数据量，用于把客户端内存与实际数据量对照
+type TopicSnapshot struct {
+	Phase          string           `json:"phase"` // 如 producer_before、consumer_after
+	Time           time.Time        `json:"time"`
+	Topic          string           `json:"topic"`
+	Partitions     int              `json:"partitions"`
+	StorageSize    int64            `json:"storage_size"`
+	BacklogSize    int64            `json:"backlog_size"`
+	MsgInCounter   int64            `json:"msg_in_counter"`
+	BytesInCounter int64            `json:"bytes_in_counter"`
+	Entries        int64            `json:"entries"`
+	LedgerSize     int64            `json:"ledger_size"`
+	Backlogs       map[string]int64 `json:"subscription_backlogs,omitempty"` // 按订阅名的 msgBacklog
+}
+
+// Snapshot 读取 topic stats 和 internal stats
+func (c *Client) Snapshot(ctx context.Context, phase, topic string) (TopicSnapshot, error) {
+	s := TopicSnapshot{Phase: phase, Time: time.Now(), Topic: topic}
+	n, err := c.Partitions(ctx, topic)
+	if err != nil {
+		return s, err
+	}
+	s.Partitions = n
+	stats, err := c.stats(ctx, topic, n)
+	if err != nil {
+		return s, err
+	}
+	s.StorageSize = stats.StorageSize
+	s.BacklogSize = stats.BacklogSize
+	s.MsgInCounter = stats.MsgInCounter
+	s.BytesInCounter = stats.BytesInCounter
+	if len(stats.Subscriptions) > 0 {
+		s.Backlogs = make(map[string]int64, len(stats.Subscriptions))
+		for name, sub := range stats.Subscriptions {
+			s.Backlogs[name] = sub.MsgBacklog
+		}
+	}
+	s.Entries, s.LedgerSize, err = c.entries(ctx, topic, n)
+	return s, err
+}
@@ -0,0 +1,448 @@
+// Package app 收拢各命令 main.go 共用的启动和收尾流程:
+// -preset/-config 加载、日志、结果目录、诊断 HTTP 服务 (pprof、/metrics、/healthz)、
+// 信号、MemoryMonitor 创建、result.json 写入和按状态退出，以及指标推送、结果目录的 index.html 和结果上传。
+// 任何退出路径 (正常结束、Exit、Recover 恢复的 panic) 都保存最终的 goroutine 和 heap 快照，见 FinalSnapshot。
+//
+// 各命令仍自行定义 flag，在 flag.Parse 之后依次调用 LoadFlags 和 New:
+//
+//	flag.Parse()
+//	if listed, err := app.LoadFlags("consumer", *preset, *configFile); err != nil || listed { ... }
+//	a, err := app.New(app.Options{Program: "consumer", ...})
+//	defer a.Close()
+//	defer a.Recover()
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pulsar-memory-test/pkg/export"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/precheck"
+	"pulsar-memory-test/pkg/presets"
+	"pulsar-memory-test/pkg/results"
+	"pulsar-memory-test/pkg/watchdog"
+)
+
+// LoadFlags 应用 -config 和 -preset 中的参数默认值，优先级为 命令行 > -config > -preset；
+// preset 为 list 时打印 program 可用的场景并返回 listed = true，调用方应直接退出
+func LoadFlags(program, preset, configFile string) (listed bool, err error) {
+	if preset == "list" {
+		presets.List(os.Stdout, program)
+		return true, nil
+	}
+	if configFile != "" {
+		cfg, err := presets.Load(configFile)
+		if err != nil {
+			return false, fmt.Errorf("invalid -config: %w", err)
+		}
+		applied, err := cfg.Apply(program, flag.CommandLine)
+		if err != nil {
+			return false, fmt.Errorf("invalid -config: %w", err)
+		}
+		log.Printf("Config %s: set %v", configFile, applied)
+	}
+	if preset != "" {
+		applied, err := presets.Apply(preset, program, flag.CommandLine)
+		if err != nil {
+			return false, fmt.Errorf("invalid -preset: %w", err)
+		}
+		log.Printf("Preset %s: set %v", preset, applied)
+	}
+	return false, nil
+}
+
+// Options New 的参数，对应各命令同名的 flag
+type Options struct {
+	Program string // producer|consumer|...，用于 result.json 中的程序名和 run 布局下的日志文件名
+
+	LogLevel      string
+	LogFile       string // 为空且 run 布局时写到结果目录下的 <Program>.log
+	LogMaxSize    int64
+	LogMaxBackups int
+
+	Layout    string // flat|run
+	OutputDir string
+	Scenario  string
+	RunID     string
+	Force     bool // 结果目录中已有本程序同一场景 (run 布局为同一 run ID) 的 result.json 时仍然覆盖
+
+	ArtifactURL string // s3://bucket[/prefix] 或 gs://bucket[/prefix]，为空时不上传
+	Labels      string // -labels "k1=v1,k2=v2"，见 results.ParseLabels
+	TrackPIDs   string // -track-pids "[name=]pid,..."，NewMonitor 创建的监控器一并采集这些进程的 RSS
+	SizeUnit    string // -size-unit MiB|MB，摘要日志中大小的单位，为空时 MiB
+
+	PushGateway  string        // Pushgateway 地址，为空时不推送
+	StatsDAddr   string        // StatsD host:port，为空时不推送
+	StatsDPrefix string        // 加在 StatsD 指标名前
+	PushInterval time.Duration // 推送间隔，结束时 Finish 再推送一次
+
+	TSDB      string // influx|timescale，为空时不写入，见 export.SampleWriter
+	TSDBURL   string
+	TSDBToken string
+}
+
+// App 一个命令运行期间共用的资源
+type App struct {
+	Program       string
+	Layout        *results.Layout
+	ClientMetrics *metrics.ClientMetrics // 已注册到诊断服务的 /metrics
+	Labels        map[string]string      // -labels，已附加到 ClientMetrics、Layout 和 NewMonitor 创建的监控器
+
+	logCloser   io.Closer
+	endpoints   []string // 启动日志中列出的诊断端点
+	artifactURL string
+	exporters   []export.Exporter
+	stopPush    context.CancelFunc
+	samples     *export.SampleWriter // -tsdb，NewMonitor 创建的监控器的样本写入这里
+	metricsMux  *http.ServeMux       // -metrics-port 的独立服务，只有 /metrics 和 /stats/current
+	sidecars    []metrics.Sidecar    // -track-pids
+
+	monitors []appMonitor // NewMonitor/NewPassMonitor 创建的监控器，中途退出时由 flushMonitors 保存
+	snapshot sync.Once    // FinalSnapshot
+	flush    sync.Once    // flushMonitors
+}
+
+// New 打开结果目录、配置日志，并准备诊断服务 (ServeDiagnostics 启动)
+func New(opts Options) (*App, error) {
+	lvl, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -log-level: %w", err)
+	}
+	if opts.ArtifactURL != "" {
+		if err := results.ValidateBucketURL(opts.ArtifactURL); err != nil {
+			return nil, fmt.Errorf("invalid -artifact-url: %w", err)
+		}
+	}
+	labels, err := results.ParseLabels(opts.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -labels: %w", err)
+	}
+	sidecars, err := metrics.ParseSidecars(opts.TrackPIDs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -track-pids: %w", err)
+	}
+	if opts.SizeUnit != "" {
+		unit, err := metrics.ParseSizeUnit(opts.SizeUnit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -size-unit: %w", err)
+		}
+		metrics.SetSizeUnit(unit)
+	}
+	// 结果目录，run 布局下日志默认写在结果旁边
+	layout, err := results.Open(opts.Layout, opts.OutputDir, opts.Scenario, opts.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare results directory: %w", err)
+	}
+	if prev, ok := layout.PreviousResult(opts.Program); ok && !opts.Force {
+		return nil, fmt.Errorf("%s results for scenario %q already exist in %s (%s, finished %s): pass -force to overwrite or choose another -scenario",
+			opts.Program, opts.Scenario, layout.Dir, prev.Status, prev.Finished.Format(time.RFC3339))
+	}
+	layout.Labels = labels
+	logFile := opts.LogFile
+	if logFile == "" && layout.PerRun() {
+		logFile = layout.File("log", opts.Program, "log")
+	}
+	logCloser, err := logging.Setup(logging.Config{
+		Level:      lvl,
+		File:       logFile,
+		MaxSize:    opts.LogMaxSize,
+		MaxBackups: opts.LogMaxBackups,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	a := &App{
+		Program:       opts.Program,
+		Layout:        layout,
+		ClientMetrics: metrics.NewLabeledClientMetrics(labels),
+		Labels:        labels,
+		logCloser:     logCloser,
+		artifactURL:   opts.ArtifactURL,
+		metricsMux:    http.NewServeMux(),
+		sidecars:      sidecars,
+	}
+	// 客户端内部指标，与 pprof 共用 HTTP 服务
+	a.handleMetrics("/metrics", "client metrics", a.ClientMetrics.Handler())
+	if err := a.startExporters(opts); err != nil {
+		return nil, err
+	}
+	if opts.TSDB != "" {
+		tags := a.grouping(opts)
+		tags["program"] = opts.Program
+		for k, v := range labels {
+			tags[k] = v
+		}
+		if a.samples, err = export.NewSampleWriter(opts.TSDB, opts.TSDBURL, opts.TSDBToken, tags); err != nil {
+			return nil, fmt.Errorf("invalid -tsdb/-tsdb-url: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// grouping 区分同一场景各次运行和各进程的标识，用作 Pushgateway 分组键和 StatsD/时序数据库的 tag
+func (a *App) grouping(opts Options) map[string]string {
+	host, _ := os.Hostname()
+	grouping := map[string]string{
+		"scenario": opts.Scenario,
+		"instance": fmt.Sprintf("%s-%d", host, os.Getpid()), // 同一主机上的多个进程互不覆盖
+	}
+	if a.Layout.PerRun() {
+		grouping["run_id"] = a.Layout.RunID
+	}
+	return grouping
+}
+
+// startExporters 按 -push-gateway/-statsd-addr 创建推送并在后台定期推送 ClientMetrics 中的全部指标
+// (客户端指标和 NewMonitor 注册的监控器指标)；-labels 已是指标自身的 label，不放进分组键
+func (a *App) startExporters(opts Options) error {
+	grouping := a.grouping(opts)
+	if opts.PushGateway != "" {
+		p, err := export.NewPushgateway(opts.PushGateway, opts.Program, grouping, a.ClientMetrics.Gatherer())
+		if err != nil {
+			return fmt.Errorf("invalid -push-gateway: %w", err)
+		}
+		a.exporters = append(a.exporters, p)
+	}
+	if opts.StatsDAddr != "" {
+		tags := map[string]string{"program": opts.Program}
+		for k, v := range grouping {
+			tags[k] = v
+		}
+		s, err := export.NewStatsD(opts.StatsDAddr, opts.StatsDPrefix, tags, a.ClientMetrics.Gatherer())
+		if err != nil {
+			return fmt.Errorf("invalid -statsd-addr: %w", err)
+		}
+		a.exporters = append(a.exporters, s)
+	}
+	if len(a.exporters) == 0 {
+		return nil
+	}
+	if opts.PushInterval <= 0 {
+		return fmt.Errorf("invalid -push-interval: must be positive")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopPush = cancel
+	go export.Run(ctx, opts.PushInterval, a.exporters)
+	return nil
+}
+
+// Close 关闭日志文件
+func (a *App) Close() error {
+	return a.logCloser.Close()
+}
+
+// Handle 在诊断服务 (与 pprof 同为 http.DefaultServeMux) 上注册 handler，desc 会出现在启动日志中
+func (a *App) Handle(pattern, desc string, h http.Handler) {
+	http.Handle(pattern, h)
+	a.endpoints = append(a.endpoints, fmt.Sprintf("%s at %s", desc, pattern))
+}
+
+// handleMetrics 同时注册到诊断服务和 ServeMetrics 的服务
+func (a *App) handleMetrics(pattern, desc string, h http.Handler) {
+	a.Handle(pattern, desc, h)
+	a.metricsMux.Handle(pattern, h)
+}
+
+// ServeMetrics 在后台另起只有 /metrics 和 /stats/current 的 HTTP 服务 (-metrics-port)，
+// 不含 pprof，可以监听所有地址供 Prometheus 抓取；监听失败只记录日志
+func (a *App) ServeMetrics(addr string) {
+	go func() {
+		log.Printf("Starting metrics server at http://%s/metrics (and /stats/current)", addr)
+		if err := http.ListenAndServe(addr, a.metricsMux); err != nil {
+			log.Printf("metrics server error: %v", err)
+		}
+	}()
+}
+
+// ServeDiagnostics 在后台启动 pprof 和已注册的诊断端点，监听失败只记录日志
+func (a *App) ServeDiagnostics(addr string) {
+	go func() {
+		log.Printf("Starting pprof server at http://%s/debug/pprof/ (%s)", addr, strings.Join(a.endpoints, ", "))
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("pprof server error: %v", err)
+		}
+	}()
+}
+
+// Watchdog 创建存活检测并注册为 /healthz: 空闲超过 timeout 且 pending 报告仍有待处理的工作时，
+// 保存 goroutine 调用栈并以 stalled 状态退出；timeout 为 0 时只报告状态
+func (a *App) Watchdog(timeout time.Duration, pending watchdog.PendingFunc) *watchdog.Watchdog {
+	w := watchdog.New(timeout, pending, func(reason string) {
+		log.Printf("Stall detected: %s", reason)
+		if err := watchdog.DumpGoroutines(a.Layout.File("profile", "goroutines", "txt")); err != nil {
+			log.Printf("Failed to dump goroutines: %v", err)
+		}
+		a.Exit(results.StatusStalled, "%s", reason)
+	})
+	a.Handle("/healthz", "liveness", w)
+	return w
+}
+
+// Precheck 在创建客户端之前检查资源 (见 precheck.Run)，cfg.OutputDir 为空时检查结果目录；
+// 逐项记录结果，有失败项时以 error 状态 (broker 不可达时为 broker_error) 退出
+func (a *App) Precheck(ctx context.Context, cfg precheck.Config) {
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = a.Layout.Dir
+	}
+	checks, err := precheck.Run(ctx, cfg)
+	status := results.StatusError
+	for _, c := range checks {
+		switch c.Status {
+		case precheck.Fail:
+			logging.Warnf("Precheck %s: FAILED: %s", c.Name, c.Detail)
+			if c.Name == "broker" {
+				status = results.StatusBrokerError
+			}
+		case precheck.Warn:
+			logging.Warnf("Precheck %s: %s", c.Name, c.Detail)
+		default:
+			logging.Debugf("Precheck %s: %s (%s)", c.Name, c.Detail, c.Status)
+		}
+	}
+	if err != nil {
+		a.Exit(status, "precheck failed: %v (-precheck=false skips the checks)", err)
+	}
+	log.Printf("Precheck passed (%d checks)", len(checks))
+}
+
+// Signals 返回接收 SIGINT/SIGTERM 的 channel
+func Signals() chan os.Signal {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	return sigCh
+}
+
+// appMonitor App 创建的监控器及其 stats 文件名后缀
+type appMonitor struct {
+	*metrics.MemoryMonitor
+	suffix string
+}
+
+// NewMonitor 创建内存监控器，关联客户端指标、/stats/current 和 -tsdb 写入，并把全部 flag (-*-token 除外)、Go 版本、GODEBUG 和 run ID
+// 写入 metadata，便于对比不同运行；采集由调用方 Start
+func (a *App) NewMonitor() (*metrics.MemoryMonitor, error) {
+	monitor, err := a.newMonitor("")
+	if err != nil {
+		return nil, err
+	}
+	a.ClientMetrics.Registerer().MustRegister(monitor.Collector())
+	a.handleMetrics("/stats/current", "current sample", monitor.CurrentHandler())
+	return monitor, nil
+}
+
+// NewPassMonitor 同一进程分轮测量 (如 consumer -ab-release) 时每轮一个监控器，配置与 NewMonitor 相同，
+// 但 /metrics 和 /stats/current 仍是 NewMonitor 创建的那个；中途退出时保存为 stats/stats<suffix>.json，
+// 与该轮正常结束时保存的文件同名
+func (a *App) NewPassMonitor(suffix string) (*metrics.MemoryMonitor, error) {
+	return a.newMonitor(suffix)
+}
+
+// newMonitor 创建并登记监控器，stats 文件名带 suffix
+func (a *App) newMonitor(suffix string) (*metrics.MemoryMonitor, error) {
+	monitor, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memory monitor: %w", err)
+	}
+	monitor.SetClientMetrics(a.ClientMetrics)
+	monitor.SetLabels(a.Labels)
+	if a.samples != nil {
+		monitor.SetSampleHook(a.samples.Add)
+	}
+	for _, s := range a.sidecars {
+		if err := monitor.TrackProcess(s.Name, s.PID); err != nil {
+			return nil, fmt.Errorf("invalid -track-pids: %w", err)
+		}
+		log.Printf("Tracking RSS of %s (pid %d)", s.Name, s.PID)
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if strings.HasSuffix(f.Name, "-token") && value != "" {
+			value = "<redacted>" // 凭据不进入 stats 和 manifest
+		}
+		monitor.SetMetadata("flag."+f.Name, value)
+	})
+	monitor.SetMetadata("go_version", runtime.Version())
+	monitor.SetMetadata("godebug", os.Getenv("GODEBUG"))
+	if a.Layout.PerRun() {
+		monitor.SetMetadata("run_id", a.Layout.RunID)
+	}
+	a.monitors = append(a.monitors, appMonitor{monitor, suffix})
+	return monitor, nil
+}
+
+// WriteResult 写入 (合并) result.json，失败只记录日志
+func (a *App) WriteResult(status results.Status, reason string, m map[string]float64) {
+	path, err := a.Layout.WriteResult(a.Program, status, reason, m)
+	if err != nil {
+		log.Printf("Failed to write result: %v", err)
+		return
+	}
+	log.Printf("Result (%s, exit %d) saved to: %s", status, status.ExitCode(), path)
+}
+
+// Exit 运行中途失败时保存最终快照和已采集的 stats，写入 result.json 并 Finish，然后以状态对应的退出码退出
+func (a *App) Exit(status results.Status, format string, args ...any) {
+	reason := fmt.Sprintf(format, args...)
+	log.Printf("Exiting (%s): %s", status, reason)
+	a.FinalSnapshot()
+	a.flushMonitors()
+	a.WriteResult(status, reason, nil)
+	a.Finish()
+	os.Exit(status.ExitCode())
+}
+
+// Finish 保存最终快照 (Exit 中已保存时跳过)，停止定期推送并推送最终指标，写完 -tsdb 缓冲的样本，
+// 写入 index.html 后 Upload；应在所有结果写完后调用一次
+func (a *App) Finish() {
+	a.FinalSnapshot()
+	if a.stopPush != nil {
+		a.stopPush()
+		ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+		if export.PushAll(ctx, a.exporters) == nil {
+			log.Printf("Pushed final metrics to %d exporter(s)", len(a.exporters))
+		}
+		cancel()
+	}
+	if a.samples != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+		if err := a.samples.Close(ctx); err != nil {
+			log.Printf("Failed to flush samples: %v", err)
+		}
+		cancel()
+	}
+	a.WriteIndex()
+	a.Upload()
+}
+
+// Upload 配置了 -artifact-url 时把本次运行的产物上传到 bucket，失败只记录日志；应在所有结果写完后调用
+func (a *App) Upload() {
+	if a.artifactURL == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	if err := a.Layout.Upload(ctx, a.artifactURL); err != nil {
+		log.Printf("Failed to upload results: %v", err)
+	}
+}
+
+// uploadTimeout 上传全部产物的总时限，pushTimeout 最终推送的时限，避免凭据或网络问题让进程挂在退出阶段
+const (
+	uploadTimeout = 10 * time.Minute
+	pushTimeout   = 30 * time.Second
+)
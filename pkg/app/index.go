@@ -0,0 +1,246 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsar-memory-test/pkg/charts"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// indexOrder 产物分组在 index.html 中的顺序，未列出的类型排在最后
+var indexOrder = []string{"result", "report", "stats", "profile", "log"}
+
+// indexPage index.html 的内容
+type indexPage struct {
+	Scenario string
+	RunID    string
+	Updated  string
+	Labels   map[string]string
+	Result   *results.Result
+	Stats    []indexStats
+	Groups   []indexGroup
+}
+
+// indexStats 一个 stats 文件的关键数字和内存曲线
+type indexStats struct {
+	Name    string
+	Numbers [][2]string
+	Chart   template.HTML
+}
+
+// indexGroup 同一类型的产物
+type indexGroup struct {
+	Kind  string
+	Files []indexFile
+}
+
+type indexFile struct {
+	Name string
+	Size string
+}
+
+// WriteIndex 在结果目录写入 index.html (flat 布局为 index_<scenario>.html): 各程序的结论和关键指标、
+// 每个 stats 文件的摘要数字和内存曲线，以及本场景全部产物的相对链接。
+// producer 和 consumer 共用结果目录时后结束的一方重写，包含两者的结果；失败只记录日志
+func (a *App) WriteIndex() {
+	path := a.Layout.File("index", "index", "html")
+	page := indexPage{
+		Scenario: a.Layout.Scenario,
+		RunID:    a.Layout.RunID,
+		Updated:  time.Now().Format(time.RFC3339),
+		Labels:   a.Labels,
+	}
+	if r, err := a.Layout.ReadResult(); err == nil {
+		page.Result = &r
+	}
+	names, err := a.indexNames()
+	if err != nil {
+		log.Printf("Failed to write index: %v", err)
+		return
+	}
+	kinds := a.indexKinds()
+	groups := make(map[string][]indexFile)
+	for _, name := range names {
+		if name == filepath.Base(path) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(a.Layout.Dir, name))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		kind := kinds[name]
+		if kind == "" {
+			kind = guessKind(name)
+		}
+		groups[kind] = append(groups[kind], indexFile{Name: name, Size: metrics.FormatBytes(uint64(info.Size()))})
+		if kind == "stats" && (strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")) {
+			if s, ok := indexStatsOf(name, filepath.Join(a.Layout.Dir, name)); ok {
+				page.Stats = append(page.Stats, s)
+			}
+		}
+	}
+	for _, kind := range indexOrder {
+		if files := groups[kind]; len(files) > 0 {
+			page.Groups = append(page.Groups, indexGroup{Kind: kind, Files: files})
+			delete(groups, kind)
+		}
+	}
+	rest := make([]string, 0, len(groups))
+	for kind := range groups {
+		rest = append(rest, kind)
+	}
+	sort.Strings(rest)
+	for _, kind := range rest {
+		page.Groups = append(page.Groups, indexGroup{Kind: kind, Files: groups[kind]})
+	}
+
+	var b bytes.Buffer
+	if err := indexTemplate.Execute(&b, page); err != nil {
+		log.Printf("Failed to write index: %v", err)
+		return
+	}
+	if err := results.WriteBytes(path, b.Bytes()); err != nil {
+		log.Printf("Failed to write index: %v", err)
+		return
+	}
+	log.Printf("Index page saved to: %s", path)
+}
+
+// indexNames 结果目录中属于本次运行的文件名: run 布局为目录中的全部文件，
+// flat 布局与 bundle 相同，为 results.FlatFiles 匹配的 <base>_<scenario>.<ext>
+func (a *App) indexNames() ([]string, error) {
+	if a.Layout.PerRun() {
+		var names []string
+		entries, err := os.ReadDir(a.Layout.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !strings.HasPrefix(e.Name(), ".") { // WriteFile 残留的临时文件
+				names = append(names, e.Name())
+			}
+		}
+		return names, nil
+	}
+	return results.FlatFiles(a.Layout.Dir, a.Layout.Scenario)
+}
+
+// indexKinds 文件名 -> 类型: run 布局下 manifest.json 登记的 (含另一个程序的产物)，
+// 再用本进程 Layout.File 登记的覆盖
+func (a *App) indexKinds() map[string]string {
+	kinds := make(map[string]string)
+	if a.Layout.PerRun() {
+		if m, err := results.ReadManifest(filepath.Join(a.Layout.Dir, results.ManifestName)); err == nil {
+			for _, f := range m.Files {
+				kinds[f.Name] = f.Kind
+			}
+		}
+	}
+	for name, kind := range a.Layout.Kinds() {
+		kinds[name] = kind
+	}
+	return kinds
+}
+
+// guessKind 没有登记类型的文件 (flat 布局下另一个程序的产物) 按文件名判断
+func guessKind(name string) string {
+	switch {
+	case strings.HasPrefix(name, "stats"), strings.HasPrefix(name, "samples"):
+		return "stats"
+	case strings.HasSuffix(name, ".pprof"), strings.Contains(name, "goroutines"):
+		return "profile"
+	case strings.HasSuffix(name, ".log"):
+		return "log"
+	case strings.HasPrefix(name, "result"):
+		return "result"
+	case strings.HasPrefix(name, "producer"), name == results.ManifestName:
+		return "report"
+	default:
+		return "other"
+	}
+}
+
+// indexStatsOf 读取 stats 文件的关键数字并画内存曲线，无法读取时跳过
+func indexStatsOf(name, path string) (indexStats, bool) {
+	stats, err := metrics.LoadStats(path)
+	if err != nil {
+		log.Printf("Index: skipping %s: %v", name, err)
+		return indexStats{}, false
+	}
+	s := stats.Summary
+	size := func(v uint64) string { return fmt.Sprintf("%.2f %s", metrics.InUnit(v), metrics.Unit()) }
+	out := indexStats{
+		Name: name,
+		Numbers: [][2]string{
+			{"Duration", s.Duration.Round(time.Millisecond).String()},
+			{"Samples", fmt.Sprint(s.SampleCount)},
+			{"Messages", fmt.Sprintf("%d (%s)", s.MessageCount, size(uint64(s.MessageBytes)))},
+			{"Max HeapAlloc", size(s.MaxHeapAlloc)},
+			{"Max RSS", size(s.MaxRSS)},
+			{"Heap ratio", fmt.Sprintf("%.2fx", s.HeapRatio)},
+			{"RSS ratio", fmt.Sprintf("%.2fx", s.RSSRatio)},
+			{"GC", fmt.Sprintf("%d cycles, %.2f ms pause", s.NumGC, s.PauseTotalMs)},
+		},
+	}
+	if f := s.Fragmentation; f != nil {
+		out.Numbers = append(out.Numbers, [2]string{"Fragmentation", fmt.Sprintf("max %s, final %.1f%% of HeapInuse", size(f.MaxBytes), f.FinalRatio*100)})
+	}
+	if svg := charts.Memory(name, stats); svg != nil {
+		out.Chart = template.HTML(svg) // 由 charts 生成，标题已转义
+	}
+	return out, true
+}
+
+// indexFuncs num 与 machine-summary 相同，按最短的十进制表示输出指标值
+var indexFuncs = template.FuncMap{"num": func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }}
+
+var indexTemplate = template.Must(template.New("index").Funcs(indexFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Scenario}}{{with .RunID}} / {{.}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.ok { color: green; } .fail { color: firebrick; }
+</style>
+</head>
+<body>
+<h1>{{.Scenario}}{{with .RunID}} / {{.}}{{end}}</h1>
+<p>Updated {{.Updated}}{{range $k, $v := .Labels}} | {{$k}}={{$v}}{{end}}</p>
+{{with .Result}}
+<h2>Result: <span class="{{if eq .ExitCode 0}}ok{{else}}fail{{end}}">{{.Status}}</span> (exit {{.ExitCode}})</h2>
+{{with .Reason}}<p>{{.}}</p>{{end}}
+<table>
+<tr><th>Program</th><th>Status</th><th>Finished</th><th>Reason</th><th>Metrics</th></tr>
+{{range $name, $p := .Programs}}<tr><td>{{$name}}</td><td class="{{if eq $p.ExitCode 0}}ok{{else}}fail{{end}}">{{$p.Status}}</td><td>{{$p.Finished.Format "2006-01-02 15:04:05"}}</td><td>{{$p.Reason}}</td><td>{{range $k, $v := $p.Metrics}}{{$k}}={{num $v}} {{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Stats}}
+<h2>{{.Name}}</h2>
+<table>
+{{range .Numbers}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{.Chart}}
+{{end}}
+<h2>Files</h2>
+{{range .Groups}}
+<h3>{{.Kind}}</h3>
+<ul>
+{{range .Files}}<li><a href="{{.Name}}">{{.Name}}</a> ({{.Size}})</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
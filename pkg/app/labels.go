@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"runtime/pprof"
+	"slices"
+)
+
+// pprof 标签让诊断服务上的 CPU profile (/debug/pprof/profile) 和 goroutine profile 按角色分组，
+// 例如 go tool pprof -tagfocus=role=process 或 -tags 查看各角色的占比。
+// 角色: main (监控、诊断等框架自身)、client (客户端内部的连接和重连 goroutine，由创建
+// 客户端/生产者/消费者的 goroutine 继承)、worker (producer 的发送 worker)、receive 和 process
+// (consumer 的接收循环和批处理)。Go 的 heap profile 不记录标签，堆分配仍按调用栈区分
+
+// ProfileContext 带 pprof 标签 program、scenario 和 -labels 的 context，作为 Label 的起点
+func (a *App) ProfileContext() context.Context {
+	kv := []string{"program", a.Program, "scenario", a.Layout.Scenario}
+	for _, k := range slices.Sorted(maps.Keys(a.Labels)) {
+		kv = append(kv, k, a.Labels[k])
+	}
+	return pprof.WithLabels(context.Background(), pprof.Labels(kv...))
+}
+
+// Label 在 ctx 的标签上加上 role 和成对的 kv (如 "worker", "3")，设置到当前 goroutine 并返回新的 ctx；
+// 之后由当前 goroutine 启动的 goroutine 继承这些标签。恢复时对原 ctx 调用 pprof.SetGoroutineLabels
+func Label(ctx context.Context, role string, kv ...string) context.Context {
+	ctx = pprof.WithLabels(ctx, pprof.Labels(append([]string{"role", role}, kv...)...))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
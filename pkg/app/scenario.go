@@ -0,0 +1,33 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// AutoScenario 未给 -scenario 时的场景名: 程序名、关键参数和启动时间，
+// 如 consumer-batch50m-q1000-20261015-013052；空参数跳过。同一秒内启动的两个进程仍会同名，由 New 的覆盖检查拦下
+func AutoScenario(program string, params ...string) string {
+	parts := []string{program}
+	for _, p := range params {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(append(parts, time.Now().Format(results.RunIDFormat)), "-")
+}
+
+// SizeParam 把字节数写成场景名中的短形式: 整 MB 为 50m，整 KB 为 512k，否则为字节数
+func SizeParam(prefix string, n int64) string {
+	switch {
+	case n != 0 && n%(1<<20) == 0:
+		return prefix + strconv.FormatInt(n>>20, 10) + "m"
+	case n != 0 && n%(1<<10) == 0:
+		return prefix + strconv.FormatInt(n>>10, 10) + "k"
+	default:
+		return prefix + strconv.FormatInt(n, 10)
+	}
+}
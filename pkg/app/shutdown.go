@@ -0,0 +1,59 @@
+package app
+
+import (
+	"log"
+	"runtime/debug"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+	"pulsar-memory-test/pkg/watchdog"
+)
+
+// FinalSnapshot 保存进程退出前最后的 goroutine 调用栈 (profile/exit-goroutines.txt) 和 heap profile
+// (profile/exit-heap.pprof)，只执行一次；Finish、Exit 和 Recover 都会调用，
+// 正常结束、信号、阈值超限、运行失败和 panic 退出时都留下进程最后的状态
+func (a *App) FinalSnapshot() {
+	a.snapshot.Do(func() {
+		if err := watchdog.DumpGoroutines(a.Layout.File("profile", "exit-goroutines", "txt")); err != nil {
+			log.Printf("Failed to dump final goroutines: %v", err)
+		}
+		path := a.Layout.File("profile", "exit-heap", "pprof")
+		if err := metrics.WriteHeapProfile(path); err != nil {
+			log.Printf("Failed to write final heap profile: %v", err)
+		} else {
+			log.Printf("Final heap profile saved to: %s", path)
+		}
+	})
+}
+
+// flushMonitors 中途退出时停止 NewMonitor/NewPassMonitor 创建的监控器，把已采集的样本保存为
+// stats/stats<suffix>.json (与正常结束时同名，compare 等工具照常读取)；没有样本的监控器跳过
+func (a *App) flushMonitors() {
+	a.flush.Do(func() {
+		for _, m := range a.monitors {
+			m.Stop()
+			if m.GetSummary().SampleCount == 0 {
+				continue
+			}
+			path := a.Layout.File("stats", "stats"+m.suffix, "json")
+			if err := m.SaveToFile(path); err != nil {
+				log.Printf("Failed to save stats: %v", err)
+				continue
+			}
+			log.Printf("Stats saved to: %s", path)
+		}
+	})
+}
+
+// Recover 应在 New 之后 defer: 主 goroutine panic 时记录 panic 和调用栈，保存最终快照和 stats，
+// 以 error 状态经 Exit 退出。其他 goroutine 中的 panic 无法在这里恢复，仍直接结束进程
+func (a *App) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("panic: %v\n%s", r, debug.Stack())
+	// 调用栈在 Recover 返回之前仍包含 panic 的位置，先于 Exit 中的收尾保存
+	a.FinalSnapshot()
+	a.Exit(results.StatusError, "panic: %v", r)
+}
@@ -0,0 +1,185 @@
+// Package batch 按字节数攒批、整批处理后再确认的消费模型: 批次攒满之前消息 (或只有 MessageID)
+// 一直被持有，这正是 ReleasePayload 要优化的内存占用。cmd/consumer 的 BatchProcessor、
+// pkg/workload.RunConsumer 和 pkg/harness 共用这里的攒批逻辑，三者测量的是同一种持有方式；
+// 下游写入、导出、确认比例等只有命令行需要的行为仍留在 cmd/consumer 中。
+package batch
+
+import (
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+)
+
+// DefaultSize 与 cmd/consumer -batch-size 的默认值相同
+const DefaultSize = 50 * 1024 * 1024
+
+// Config 攒批行为
+type Config struct {
+	Size           int64 // 批次累计到此字节数后处理
+	ReleasePayload bool  // 读取后立即 ReleasePayload，只保留 MessageID 等元数据用于确认
+	RetainIDOnly   bool  // 只保留 MessageID 和 payload 大小，pulsar.Message 对象随即可被回收
+	Verify         bool  // 校验 payload CRC
+}
+
+// RetainedID RetainIDOnly 时批次保留的内容，不持有 pulsar.Message 对象
+type RetainedID struct {
+	ID   pulsar.MessageID
+	Size int64
+}
+
+// Batch 当前批次。messages 和 ids 只有一个非空，received 与其一一对应；不是并发安全的，
+// 只由接收 (或流水线处理) 的 goroutine 使用
+type Batch struct {
+	Config
+	monitor      *metrics.MemoryMonitor
+	messages     []pulsar.Message
+	ids          []RetainedID
+	received     []time.Duration // 各消息 Receive 返回时的 HoldClock
+	bytes        int64
+	count        int
+	firstAdd     time.Time // 当前批次第一条消息加入的时间，整批处理完成后记录批次延迟
+	firstPublish time.Time // 消费到的最早发布时间
+}
+
+// New 创建空批次，Size <= 0 时使用 DefaultSize
+func New(cfg Config, monitor *metrics.MemoryMonitor) *Batch {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultSize
+	}
+	b := &Batch{Config: cfg, monitor: monitor}
+	if cfg.RetainIDOnly {
+		b.ids = make([]RetainedID, 0, 10000)
+	} else {
+		b.messages = make([]pulsar.Message, 0, 10000)
+	}
+	return b
+}
+
+// Inspect 记录刚收到的消息的线路大小和重投递，返回 payload 大小；
+// ReleasePayload 会同时释放 properties，必须在释放之前调用
+func (b *Batch) Inspect(msg pulsar.Message) int64 {
+	size := int64(len(msg.Payload()))
+	b.monitor.RecordWireBytes(metrics.EstimateWireSize(int(size), msg.Key(), msg.Properties()))
+	if msg.RedeliveryCount() > 0 {
+		b.monitor.RecordRedelivery()
+	}
+	return size
+}
+
+// VerifyPayload Verify 时校验 payload，结果记入 monitor
+func (b *Batch) VerifyPayload(msg pulsar.Message, data []byte) {
+	if b.Verify {
+		b.monitor.RecordVerification(payload.VerifyMessage(data, msg.Properties()))
+	}
+}
+
+// Release ReleasePayload 时释放消息的 payload 和 properties，返回是否释放
+func (b *Batch) Release(msg pulsar.Message) bool {
+	if !b.ReleasePayload {
+		return false
+	}
+	msg.ReleasePayload()
+	return true
+}
+
+// Append 把处理过 (可能已释放) 的消息加入批次，返回批次是否已满。
+// received 为消息 Receive 返回时的 HoldClock，publishTime 为计算延迟所用的时间戳
+func (b *Batch) Append(msg pulsar.Message, size int64, publishTime time.Time, received time.Duration) bool {
+	if b.firstAdd.IsZero() {
+		b.firstAdd = time.Now()
+	}
+	if b.RetainIDOnly {
+		b.ids = append(b.ids, RetainedID{ID: msg.ID(), Size: size})
+	} else {
+		b.messages = append(b.messages, msg)
+	}
+	b.received = append(b.received, received)
+	b.bytes += size
+	b.monitor.RecordMessage(size)
+	b.monitor.RecordPartition(msg.Topic(), size, msg.ID())
+	b.monitor.RecordPublishTime(publishTime)
+	b.SeePublish(msg.PublishTime())
+	return b.bytes >= b.Size
+}
+
+// SeePublish 记录一条消费到的消息 (包括没有进入批次的) 的发布时间
+func (b *Batch) SeePublish(pt time.Time) {
+	if b.firstPublish.IsZero() || pt.Before(b.firstPublish) {
+		b.firstPublish = pt
+	}
+}
+
+// Begin 开始处理当前批次，返回从 1 开始的批次序号
+func (b *Batch) Begin() int {
+	b.count++
+	return b.count
+}
+
+// AckAll 逐条确认整个批次并记录持有时长，返回确认成功的条数
+func (b *Batch) AckAll(consumer pulsar.Consumer) int {
+	acked := 0
+	for i, msg := range b.messages {
+		if err := consumer.Ack(msg); err != nil {
+			logging.Debugf("  Ack failed: %v", err)
+			continue
+		}
+		b.monitor.RecordHolding(HoldClock() - b.received[i])
+		acked++
+	}
+	for i, e := range b.ids {
+		if err := consumer.AckID(e.ID); err != nil {
+			logging.Debugf("  Ack failed: %v", err)
+			continue
+		}
+		b.monitor.RecordHolding(HoldClock() - b.received[i])
+		acked++
+	}
+	return acked
+}
+
+// Done 批次处理完成 (确认已发出或已交给延迟/攒批确认): 记录批次和批次延迟，调用方随后 Reset
+func (b *Batch) Done() {
+	b.monitor.RecordBatch()
+	b.monitor.RecordBatchLatency(time.Since(b.firstAdd))
+}
+
+// Reset 清空批次，不计为处理完成 (例如整批 Nack)。底层数组保留复用，先清零其中的引用，
+// 否则上一批的消息和 MessageID (连同其批量确认 tracker) 在确认之后仍然可达，扭曲确认后和 GC 后的读数
+func (b *Batch) Reset() {
+	clear(b.messages)
+	b.messages = b.messages[:0]
+	clear(b.ids)
+	b.ids = b.ids[:0]
+	b.received = b.received[:0]
+	b.bytes = 0
+	b.firstAdd = time.Time{}
+}
+
+// Len 当前批次中待确认的消息数
+func (b *Batch) Len() int {
+	if b.RetainIDOnly {
+		return len(b.ids)
+	}
+	return len(b.messages)
+}
+
+// Bytes 当前批次的 payload 字节数
+func (b *Batch) Bytes() int64 { return b.bytes }
+
+// Count 已开始处理的批次数
+func (b *Batch) Count() int { return b.count }
+
+// FirstPublish 消费到的最早发布时间，A/B 测试据此 seek 回起点
+func (b *Batch) FirstPublish() time.Time { return b.firstPublish }
+
+// Messages 当前批次保留的消息 (RetainIDOnly 时为空)
+func (b *Batch) Messages() []pulsar.Message { return b.messages }
+
+// IDs 当前批次保留的 MessageID (RetainIDOnly 时)
+func (b *Batch) IDs() []RetainedID { return b.ids }
+
+// Received 与 Messages 或 IDs 一一对应的 HoldClock
+func (b *Batch) Received() []time.Duration { return b.received }
@@ -0,0 +1,12 @@
+package batch
+
+import "time"
+
+// holdEpoch HoldClock 的起点
+var holdEpoch = time.Now()
+
+// HoldClock 单调时钟上距进程启动的时长。批次为每条消息保存 Receive 返回时的 HoldClock (每条 8 字节，
+// 比 time.Time 少 16 字节)，Ack 发出后与当时的 HoldClock 相减即持有时长，见 MemoryMonitor.RecordHolding
+func HoldClock() time.Duration {
+	return time.Since(holdEpoch)
+}
@@ -0,0 +1,208 @@
+// Package benchmark 把 pkg/workload 的场景包装成 testing.B 基准，在 go test -bench 中
+// 对一个 testcontainers 启动的 Pulsar 运行缩小规模的场景，内存放大倍数等指标通过
+// b.ReportMetric 输出，可以直接用 benchstat 对比回归:
+//
+//	func BenchmarkConsumeRelease(b *testing.B) {
+//		benchmark.Consume(b, benchmark.Pulsar(b), benchmark.Scenario{ReleasePayload: true})
+//	}
+//
+// 设置 PULSAR_URL 时使用已有的 broker，不启动容器；PULSAR_IMAGE 覆盖容器镜像。
+// 不需要 broker 端行为时用 MockPulsar 代替 Pulsar，场景在进程内的 mockbroker 上运行，
+// 无需 Docker，适合在 CI 中比较客户端接收路径的 allocs/op。
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"pulsar-memory-test/pkg/mockbroker"
+	"pulsar-memory-test/pkg/results"
+	"pulsar-memory-test/pkg/workload"
+)
+
+// DefaultImage 与 docker-compose.yml 使用同一版本
+const DefaultImage = "apachepulsar/pulsar:3.1.0"
+
+var (
+	pulsarOnce sync.Once
+	pulsarURL  string
+	pulsarErr  error
+
+	mockOnce sync.Once
+	mockURL  string
+	mockErr  error
+)
+
+// Pulsar 返回 broker URL; 同一进程内只启动一个 standalone 容器，供所有基准共用，
+// 进程退出后由 testcontainers 的 reaper 清理。启动失败时 Skip 而不是 Fail，
+// 没有 Docker 的环境里 go test -bench 仍能跑完其它基准
+func Pulsar(tb testing.TB) string {
+	tb.Helper()
+	if url := os.Getenv("PULSAR_URL"); url != "" {
+		return url
+	}
+	pulsarOnce.Do(func() {
+		image := os.Getenv("PULSAR_IMAGE")
+		if image == "" {
+			image = DefaultImage
+		}
+		pulsarURL, pulsarErr = startPulsar(image)
+	})
+	if pulsarErr != nil {
+		tb.Skipf("pulsar container unavailable: %v", pulsarErr)
+	}
+	return pulsarURL
+}
+
+// MockPulsar 返回进程内 mockbroker 的 URL，同一进程内所有基准共用，进程退出前不关闭。
+// mockbroker 与被测客户端在同一进程中，它的分配同样计入 allocs/op 和内存峰值，
+// 但分发路径不做逐条分配，topic 只保留一个 entry，比较不同客户端版本或配置时可以忽略
+func MockPulsar(tb testing.TB) string {
+	tb.Helper()
+	mockOnce.Do(func() {
+		var b *mockbroker.Broker
+		if b, mockErr = mockbroker.Start("127.0.0.1:0"); mockErr == nil {
+			mockURL = b.URL()
+		}
+	})
+	if mockErr != nil {
+		tb.Fatalf("start mock broker: %v", mockErr)
+	}
+	return mockURL
+}
+
+// startPulsar 启动 standalone 容器；找不到 Docker 时 testcontainers 会 panic，这里转为 error
+func startPulsar(image string) (url string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        image,
+			ExposedPorts: []string{"6650/tcp", "8080/tcp"},
+			Cmd:          []string{"bin/pulsar", "standalone", "-nfw", "-nss"},
+			// admin API 可用时 broker 已能接受 lookup
+			WaitingFor: wait.ForHTTP("/admin/v2/clusters").WithPort("8080/tcp").WithStartupTimeout(4 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return c.PortEndpoint(ctx, "6650/tcp", "pulsar")
+}
+
+// Scenario 一次迭代的规模和消费行为，零值字段使用缩小后的默认值
+type Scenario struct {
+	Bytes          int64 // 每次迭代生产并消费的数据量，0 = 20 MB
+	MessageSize    int   // 0 = 1024
+	BatchSize      int64 // 0 = 2 MB
+	QueueSize      int   // ReceiverQueueSize，0 = 1000
+	ReleasePayload bool
+	ProcessDelay   time.Duration
+}
+
+func (s *Scenario) setDefaults() {
+	if s.Bytes == 0 {
+		s.Bytes = 20 * 1024 * 1024
+	}
+	if s.MessageSize == 0 {
+		s.MessageSize = 1024
+	}
+	if s.BatchSize == 0 {
+		s.BatchSize = 2 * 1024 * 1024
+	}
+}
+
+// topicName 每次迭代使用新 topic，避免上一次的积压影响结果
+func topicName(i int) string {
+	return fmt.Sprintf("persistent://public/default/bench-%d-%d", time.Now().UnixNano(), i)
+}
+
+// Consume 每次迭代先 (不计时) 向新 topic 生产 s.Bytes，再计时消费完整个积压。
+// 除 allocs/op 外报告每次迭代的 heap-MB、rss-MB 峰值和 heap-ratio (峰值堆 / 数据量) 的平均值
+func Consume(b *testing.B, url string, s Scenario) {
+	s.setDefaults()
+	b.ReportAllocs()
+	b.SetBytes(s.Bytes)
+	ctx := context.Background()
+
+	var heap, rss, ratio float64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		topic := topicName(i)
+		if _, err := workload.RunProducer(ctx, workload.ProducerConfig{
+			URL:         url,
+			Topic:       topic,
+			TotalBytes:  s.Bytes,
+			MessageSize: s.MessageSize,
+		}); err != nil {
+			b.Fatalf("produce: %v", err)
+		}
+		b.StartTimer()
+
+		res, err := workload.RunConsumer(ctx, workload.ConsumerConfig{
+			URL:               url,
+			Topic:             topic,
+			Subscription:      "bench",
+			ReceiverQueueSize: s.QueueSize,
+			BatchSize:         s.BatchSize,
+			ReleasePayload:    s.ReleasePayload,
+			ProcessDelay:      s.ProcessDelay,
+			IdleTimeout:       time.Second,
+		})
+		if err != nil {
+			b.Fatalf("consume: %v", err)
+		}
+		if res.Status != results.StatusOK {
+			b.Fatalf("consume: %s: %s", res.Status, res.Reason)
+		}
+		heap += float64(res.Summary.MaxHeapAlloc) / 1024 / 1024
+		rss += float64(res.Summary.MaxRSS) / 1024 / 1024
+		ratio += res.Summary.HeapRatio
+	}
+	n := float64(b.N)
+	b.ReportMetric(heap/n, "heap-MB")
+	b.ReportMetric(rss/n, "rss-MB")
+	b.ReportMetric(ratio/n, "heap-ratio")
+}
+
+// Produce 每次迭代向新 topic 生产 s.Bytes 并等待全部确认，报告 MB/s 和 msgs/s
+func Produce(b *testing.B, url string, s Scenario) {
+	s.setDefaults()
+	b.ReportAllocs()
+	b.SetBytes(s.Bytes)
+	ctx := context.Background()
+
+	var msgs int64
+	var elapsed time.Duration
+	for i := 0; i < b.N; i++ {
+		res, err := workload.RunProducer(ctx, workload.ProducerConfig{
+			URL:         url,
+			Topic:       topicName(i),
+			TotalBytes:  s.Bytes,
+			MessageSize: s.MessageSize,
+		})
+		if err != nil {
+			b.Fatalf("produce: %v", err)
+		}
+		if res.Errors > 0 {
+			b.Fatalf("produce: %d sends failed", res.Errors)
+		}
+		msgs += res.Messages
+		elapsed += res.Duration
+	}
+	if elapsed > 0 {
+		b.ReportMetric(float64(msgs)/elapsed.Seconds(), "msgs/s")
+	}
+}
@@ -0,0 +1,42 @@
+package benchmark_test
+
+import (
+	"testing"
+
+	"pulsar-memory-test/pkg/benchmark"
+)
+
+// consumeScenarios 保留 payload 与 ReleasePayload 的对比，benchstat 按子基准名配对
+var consumeScenarios = []struct {
+	name string
+	s    benchmark.Scenario
+}{
+	{"retain", benchmark.Scenario{}},
+	{"release", benchmark.Scenario{ReleasePayload: true}},
+}
+
+// BenchmarkConsume 在 testcontainers 启动的 Pulsar (或 PULSAR_URL) 上消费，没有 Docker 时跳过
+func BenchmarkConsume(b *testing.B) {
+	url := benchmark.Pulsar(b)
+	for _, c := range consumeScenarios {
+		b.Run(c.name, func(b *testing.B) { benchmark.Consume(b, url, c.s) })
+	}
+}
+
+// BenchmarkConsumeMock 在进程内的 mockbroker 上消费，总是运行
+func BenchmarkConsumeMock(b *testing.B) {
+	url := benchmark.MockPulsar(b)
+	for _, c := range consumeScenarios {
+		b.Run(c.name, func(b *testing.B) { benchmark.Consume(b, url, c.s) })
+	}
+}
+
+// BenchmarkProduce 在 testcontainers 启动的 Pulsar (或 PULSAR_URL) 上生产，没有 Docker 时跳过
+func BenchmarkProduce(b *testing.B) {
+	benchmark.Produce(b, benchmark.Pulsar(b), benchmark.Scenario{})
+}
+
+// BenchmarkProduceMock 在进程内的 mockbroker 上生产，总是运行
+func BenchmarkProduceMock(b *testing.B) {
+	benchmark.Produce(b, benchmark.MockPulsar(b), benchmark.Scenario{})
+}
@@ -0,0 +1,111 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// partitionID 模拟 MessageID，只在生成摘要时格式化
+type partitionID int
+
+func (id partitionID) String() string { return fmt.Sprintf("%d:0:-1", int(id)) }
+
+// MonitorOverhead 测量监控器自身在每条消息上的开销，不需要 broker:
+//
+//	func BenchmarkMonitorOverhead(b *testing.B) { benchmark.MonitorOverhead(b) }
+//
+// 每次迭代执行消费者处理一条消息时的全部记录调用，与消费者一样在单个 goroutine 中记录，
+// 同时后台以 10ms 间隔采样，覆盖采样读取与记录并发的情况；超过 metrics.RecordBudget 时基准失败
+// (-race 下只检查数据竞争，不检查预算)。
+func MonitorOverhead(b *testing.B) {
+	monitor := startMonitor(b)
+	publish := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recordMessage(monitor, publish, i)
+	}
+	b.StopTimer()
+
+	perMsg := b.Elapsed() / time.Duration(b.N)
+	b.ReportMetric(float64(perMsg.Nanoseconds()), "ns/msg")
+	// 框架先用很小的 b.N 校准，此时 goroutine 启动开销占主导，不参与预算判断
+	if !raceEnabled && b.N >= 100000 && perMsg > metrics.RecordBudget {
+		b.Errorf("monitor overhead %v per message exceeds budget %v", perMsg, metrics.RecordBudget)
+	}
+}
+
+// MonitorOverheadParallel 与 MonitorOverhead 相同的记录调用，由 RunParallel 的多个 goroutine 同时执行，
+// 对应 -fanout、-route-by 和流水线处理时多个批次同时记录；配合 -race 检查计数器的并发安全，
+// 配合 -cpu 1,4,8 观察原子计数器在多核上的竞争。ns/op 为墙钟时间除以总次数，不与预算比较
+func MonitorOverheadParallel(b *testing.B) {
+	monitor := startMonitor(b)
+	publish := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			recordMessage(monitor, publish, i)
+		}
+	})
+}
+
+// startMonitor 创建并以 10ms 间隔启动监控器，基准结束时停止
+func startMonitor(b *testing.B) *metrics.MemoryMonitor {
+	monitor, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		b.Fatalf("create monitor: %v", err)
+	}
+	// 与 consumer 默认相同，端到端、批次和持有时长的直方图都开启
+	monitor.EnableLatency()
+	ctx, cancel := context.WithCancel(context.Background())
+	monitor.Start(ctx, 10*time.Millisecond)
+	b.Cleanup(func() {
+		cancel()
+		monitor.Stop()
+	})
+	return monitor
+}
+
+// benchTopic recordMessage 记录的分区
+const benchTopic = "persistent://public/default/bench-partition-0"
+
+// recordMessage 消费者处理一条消息时在监控器上的全部记录调用: 接收、batch.Batch.Inspect/Append
+// 中的大小、分区和发布时间，延迟，以及确认时的持有时长 (重投递和校验只在相应情况下发生，不计入)
+func recordMessage(monitor *metrics.MemoryMonitor, publish time.Time, i int) {
+	pt := publish.Add(time.Duration(i))
+	monitor.RecordReceive(time.Microsecond, true)
+	monitor.RecordWireBytes(1100)
+	monitor.RecordMessage(1024)
+	monitor.RecordPartition(benchTopic, 1024, partitionID(0))
+	monitor.RecordPublishTime(pt)
+	monitor.RecordLatency(time.Millisecond)
+	monitor.RecordHolding(time.Millisecond)
+}
+
+// PartitionOverhead 测量 RecordPartition 在已知分区上的开销，partitions 个分区轮流记录
+// (多于一个分区时每次都换分区，不走同一分区的快速路径，是最坏情况)；
+// 使用 RunParallel，配合 -cpu 1,4,8 观察多个 goroutine 同时记录时的竞争
+func PartitionOverhead(b *testing.B, partitions int) {
+	monitor, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		b.Fatalf("create monitor: %v", err)
+	}
+	topics := make([]string, partitions)
+	for i := range topics {
+		topics[i] = fmt.Sprintf("persistent://public/default/bench-partition-%d", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			p := i % partitions
+			monitor.RecordPartition(topics[p], 1024, partitionID(p))
+		}
+	})
+}
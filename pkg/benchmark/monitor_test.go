@@ -0,0 +1,19 @@
+package benchmark_test
+
+import (
+	"fmt"
+	"testing"
+
+	"pulsar-memory-test/pkg/benchmark"
+)
+
+func BenchmarkMonitorOverhead(b *testing.B) { benchmark.MonitorOverhead(b) }
+
+func BenchmarkMonitorOverheadParallel(b *testing.B) { benchmark.MonitorOverheadParallel(b) }
+
+// BenchmarkPartitionOverhead 单分区时所有 goroutine 争用同一个计数器，分区多时竞争分散
+func BenchmarkPartitionOverhead(b *testing.B) {
+	for _, n := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("partitions=%d", n), func(b *testing.B) { benchmark.PartitionOverhead(b, n) })
+	}
+}
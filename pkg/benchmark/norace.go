@@ -0,0 +1,6 @@
+//go:build !race
+
+package benchmark
+
+// raceEnabled 以 -race 构建时为 true，竞争检测使每次原子操作慢一个数量级，不检查耗时预算
+const raceEnabled = false
@@ -0,0 +1,375 @@
+// Package bundle 把一次运行的结果打包成一个 tar.gz，大小适合附到 pulsar-client-go 的 GitHub issue:
+// 场景配置和解析后的 flag、摘要 (去掉原始样本)、内存曲线、heap profile 以及环境信息，
+// 另附 README.md 汇总关键数字和复现命令，可直接贴进 issue 正文。
+// runner bundle 和独立的 bundle 命令都通过 Write 打包。
+//
+// run 布局 (-layout=run) 传入 results/<scenario>/<run-id>；flat 布局传入 results 目录和场景名。
+// Sanitize 把文本文件中的主机名、IP 和 tenant/namespace 替换为占位名，公开的 issue 中不会暴露内部基础设施。
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+	"pulsar-memory-test/pkg/charts"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// GitHubAttachmentLimit GitHub issue 附件的大小上限 (25MB)，默认留出余量
+const GitHubAttachmentLimit = 24 << 20
+
+// Options 打包参数
+type Options struct {
+	Dir      string // run 目录，或 flat 布局的结果目录 (此时需要 Scenario)
+	Scenario string // flat 布局的场景名，Dir 下的 stats_<scenario>.json 等
+	Output   string // 写出的文件，空为当前目录下的 <scenario>[-<run-id>]-bundle.tar.gz
+	MaxSize  int64  // 压缩后的大小预算，放不下的可选产物舍弃并列在 README.md 中；0 = GitHubAttachmentLimit
+	Sanitize bool   // 替换文本文件中的主机名、IP、URL 主机和 tenant/namespace
+}
+
+// Result 写出的包
+type Result struct {
+	File      string
+	Size      int64
+	Included  []string
+	Skipped   []string // 超出 MaxSize 舍弃的文件及其原始大小
+	Sanitized string   // Sanitize 时替换了哪些值
+}
+
+// Write 收集 opts.Dir 中的产物，打包并写到 opts.Output
+func Write(opts Options) (*Result, error) {
+	if opts.MaxSize < 0 {
+		return nil, fmt.Errorf("max size must be positive")
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = GitHubAttachmentLimit
+	}
+	src, err := collect(opts.Dir, opts.Scenario)
+	if err != nil {
+		return nil, err
+	}
+	out := opts.Output
+	if out == "" {
+		name := src.scenario
+		if src.runID != "" {
+			name += "-" + src.runID
+		}
+		out = strings.ReplaceAll(name, string(filepath.Separator), "_") + "-bundle.tar.gz"
+	}
+	var san *sanitizer
+	if opts.Sanitize {
+		san = newSanitizer()
+	}
+	b, err := build(src, opts.MaxSize, san)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(out, b.data, 0644); err != nil {
+		return nil, fmt.Errorf("write %s: %v", out, err)
+	}
+	return &Result{File: out, Size: int64(len(b.data)), Included: b.included, Skipped: b.skipped, Sanitized: b.sanitized}, nil
+}
+
+// Log 用 logf 打印写出的文件、舍弃的产物和脱敏摘要
+func (r *Result) Log(logf func(format string, args ...any)) {
+	logf("Bundle saved to %s (%.2f MB, %d files)", r.File, float64(r.Size)/1024/1024, len(r.Included))
+	for _, name := range r.Skipped {
+		logf("  left out (over -max-size): %s", name)
+	}
+	if r.Sanitized != "" {
+		logf("  sanitized: %s", r.Sanitized)
+	}
+}
+
+// entry 包内的一个文件
+type entry struct {
+	name string
+	data []byte
+}
+
+// bundle 打包结果: 压缩后的 tar.gz 和包含/舍弃的文件名
+type bundle struct {
+	data      []byte
+	included  []string
+	skipped   []string
+	sanitized string // -sanitize 时替换了哪些值 (sanitizer.summary)
+}
+
+// environment 包内 environment.json: 打包所在主机 (通常就是运行测试的主机) 和运行时设置
+type environment struct {
+	BundledAt           time.Time         `json:"bundled_at"`
+	Host                hostInfo          `json:"host"`
+	GoVersion           string            `json:"go_version,omitempty"`
+	PulsarClientVersion string            `json:"pulsar_client_version,omitempty"`
+	GODEBUG             string            `json:"godebug,omitempty"`
+	GOGC                int64             `json:"gogc"`
+	GOMemLimit          int64             `json:"gomemlimit"`
+	Labels              map[string]string `json:"labels,omitempty"`
+}
+
+type hostInfo struct {
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	Platform    string `json:"platform,omitempty"`
+	Kernel      string `json:"kernel,omitempty"`
+	CPUs        int    `json:"cpus"`
+	MemoryTotal uint64 `json:"memory_total,omitempty"`
+}
+
+// build 生成包内文件并按 budget 舍弃放不下的可选产物。
+// 摘要、曲线、环境信息和 README 总是包含；其余产物按 kindOrder 依次加入，
+// 用单独压缩后的大小估算占用。san 不为 nil 时所有文本文件先经过脱敏
+func build(src *source, budget int64, san *sanitizer) (*bundle, error) {
+	var required []entry
+	for _, s := range src.stats {
+		summary := s.stats
+		summary.Samples, summary.Rollups, summary.Keys, summary.GCTrace, summary.Regions = nil, nil, nil, nil, nil
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		required = append(required, entry{s.name + "-summary.json", append(data, '\n')})
+		if svg := charts.Memory(src.scenario+" "+s.name, s.stats); svg != nil {
+			required = append(required, entry{s.name + "-memory.svg", svg})
+		}
+	}
+	env, err := json.MarshalIndent(newEnvironment(src.stats[0].stats), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	required = append(required, entry{"environment.json", append(env, '\n')})
+
+	optional := make([]entry, len(src.files))
+	for i, f := range src.files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		optional[i] = entry{f.name, data}
+	}
+	b := &bundle{}
+	if san != nil {
+		// 先从全部文件收集要替换的值，同一个值在各文件中得到同一个占位名
+		all := append(append([]entry(nil), required...), optional...)
+		for _, e := range all {
+			if isText(e.data) {
+				san.learn(e.data)
+			}
+		}
+		for _, list := range [][]entry{required, optional} {
+			for i := range list {
+				if isText(list[i].data) {
+					list[i].data = san.apply(list[i].data)
+				}
+			}
+		}
+		b.sanitized = san.summary()
+	}
+
+	var used int64
+	for _, e := range required {
+		used += compressedSize(e.data)
+	}
+	entries := required
+	for i, e := range optional {
+		size := compressedSize(e.data)
+		if used+size > budget {
+			b.skipped = append(b.skipped, fmt.Sprintf("%s (%.2f MB)", e.name, float64(src.files[i].size)/1024/1024))
+			continue
+		}
+		used += size
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		b.included = append(b.included, e.name)
+	}
+	intro := entry{"README.md", readme(src, b)}
+	if san != nil {
+		intro.data = san.apply(intro.data)
+	}
+	b.included = append([]string{intro.name}, b.included...)
+
+	dir := strings.ReplaceAll(src.scenario, "/", "_")
+	if src.runID != "" {
+		dir += "-" + src.runID
+	}
+	b.data, err = writeTarGz(dir, append([]entry{intro}, entries...))
+	return b, err
+}
+
+func newEnvironment(stats metrics.StatsOutput) environment {
+	meta := stats.Metadata
+	env := environment{
+		BundledAt:           time.Now(),
+		Host:                hostInfo{OS: runtime.GOOS, Arch: runtime.GOARCH, CPUs: runtime.NumCPU()},
+		GoVersion:           meta["go_version"],
+		PulsarClientVersion: meta["pulsar_client_version"],
+		GODEBUG:             meta["godebug"],
+		GOGC:                stats.Summary.GOGC,
+		GOMemLimit:          stats.Summary.GOMemLimit,
+		Labels:              stats.Labels,
+	}
+	if info, err := host.Info(); err == nil {
+		env.Host.Platform = strings.TrimSpace(info.Platform + " " + info.PlatformVersion)
+		env.Host.Kernel = info.KernelVersion
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		env.Host.MemoryTotal = vm.Total
+	}
+	return env
+}
+
+// compressedSize data 单独 gzip 后的大小加上 tar 头，作为在包内占用的估算
+func compressedSize(data []byte) int64 {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return int64(buf.Len()) + 512
+}
+
+// writeTarGz 所有文件放在 dir/ 下，解包后不会散落在当前目录
+func writeTarGz(dir string, entries []entry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	for _, e := range entries {
+		hdr := &tar.Header{Name: path.Join(dir, e.name), Mode: 0644, Size: int64(len(e.data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readme 汇总关键数字、最大跳变、复现命令和包内文件，可直接贴进 issue 正文
+func readme(src *source, b *bundle) []byte {
+	primary := src.stats[0]
+	s := primary.stats.Summary
+	meta := primary.stats.Metadata
+	mb := func(v uint64) string { return fmt.Sprintf("%.2f MB", float64(v)/1024/1024) }
+
+	var w bytes.Buffer
+	title := src.scenario
+	if src.runID != "" {
+		title += " (" + src.runID + ")"
+	}
+	fmt.Fprintf(&w, "# pulsar-client-go memory report: %s\n\n", title)
+	fmt.Fprintf(&w, "- pulsar-client-go: %s\n", orUnknown(meta["pulsar_client_version"]))
+	fmt.Fprintf(&w, "- Go: %s, GOGC %d, GOMEMLIMIT %s, GODEBUG %q\n", orUnknown(meta["go_version"]), s.GOGC, memLimit(s.GOMemLimit), meta["godebug"])
+	fmt.Fprintf(&w, "- Host: %s/%s, %d CPUs (see environment.json)\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	if len(primary.stats.Labels) > 0 {
+		fmt.Fprintf(&w, "- Labels: %s\n", joinMap(primary.stats.Labels))
+	}
+	if b.sanitized != "" {
+		fmt.Fprintf(&w, "- Sanitized: %s replaced by placeholders (host-N, ip-N, tenant-N/namespace-N); binary profiles are unchanged\n", b.sanitized)
+	}
+
+	fmt.Fprintf(&w, "\n## Summary (%s)\n\n", primary.name)
+	fmt.Fprintf(&w, "| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&w, "| Duration | %v |\n", s.Duration.Round(time.Second))
+	fmt.Fprintf(&w, "| Messages | %d (%s) |\n", s.MessageCount, mb(uint64(s.MessageBytes)))
+	fmt.Fprintf(&w, "| HeapAlloc max / avg / final | %s / %s / %s |\n", mb(s.MaxHeapAlloc), mb(uint64(s.AvgHeapAlloc)), mb(s.FinalHeapAlloc))
+	fmt.Fprintf(&w, "| RSS max / avg / final | %s / %s / %s |\n", mb(s.MaxRSS), mb(uint64(s.AvgRSS)), mb(s.FinalRSS))
+	fmt.Fprintf(&w, "| GC | %d cycles, %.2f ms total pause |\n", s.NumGC, s.PauseTotalMs)
+	fmt.Fprintf(&w, "| Amplification (max / data) | heap %.2fx, RSS %.2fx |\n", s.HeapRatio, s.RSSRatio)
+	fmt.Fprintf(&w, "\n![memory](%s-memory.svg)\n", primary.name)
+
+	if len(s.Jumps) > 0 {
+		fmt.Fprintf(&w, "\n## Largest jumps\n\n")
+		for _, j := range s.Jumps[:min(len(s.Jumps), 5)] {
+			fmt.Fprintf(&w, "- %s %s +%s at batch %d", j.Time.Format("15:04:05"), j.Metric, mb(uint64(j.Delta)), j.Batches)
+			if j.Event != "" {
+				fmt.Fprintf(&w, ", near %s (%+.1fs)", j.Event, float64(j.EventOffsetMs)/1000)
+			}
+			w.WriteString("\n")
+		}
+	}
+
+	if cmd := reproduceCommand(meta); cmd != "" {
+		fmt.Fprintf(&w, "\n## Reproduce\n\n```\n%s\n```\n", cmd)
+	}
+
+	fmt.Fprintf(&w, "\n## Files\n\n")
+	for _, name := range b.included {
+		fmt.Fprintf(&w, "- %s\n", name)
+	}
+	for _, name := range b.skipped {
+		fmt.Fprintf(&w, "- left out (size budget): %s\n", name)
+	}
+	return w.Bytes()
+}
+
+// shellSafe 不需要加引号的 flag 值
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9._:/=,+@%-]*$`)
+
+// reproduceCommand 由 metadata 中的 flag.* 拼出的命令行，空值 flag 省略；
+// stats 由 consumer 或 entities 写出，带 -stages 的是 entities
+func reproduceCommand(meta map[string]string) string {
+	var args []string
+	program := "./bin/consumer"
+	for k, v := range meta {
+		name, ok := strings.CutPrefix(k, "flag.")
+		if !ok || v == "" {
+			continue
+		}
+		if name == "stages" {
+			program = "./bin/entities"
+		}
+		if !shellSafe.MatchString(v) {
+			v = "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+		}
+		args = append(args, "-"+name+"="+v)
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	sort.Strings(args)
+	return program + " \\\n  " + strings.Join(args, " \\\n  ")
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func memLimit(v int64) string {
+	if v <= 0 || v == 1<<63-1 {
+		return "off"
+	}
+	return fmt.Sprintf("%.0f MB", float64(v)/1024/1024)
+}
+
+func joinMap(m map[string]string) string {
+	kv := make([]string, 0, len(m))
+	for k, v := range m {
+		kv = append(kv, k+"="+v)
+	}
+	sort.Strings(kv)
+	return strings.Join(kv, ",")
+}
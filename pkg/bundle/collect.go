@@ -0,0 +1,137 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// artifact 结果目录中的一个文件
+type artifact struct {
+	name string // 在包内的文件名
+	path string
+	kind string // stats|profile|report|log|other
+	size int64
+}
+
+// statsFile 解析后的 stats 文件，打包时替换为去掉样本的摘要和内存曲线
+type statsFile struct {
+	name  string // 去掉扩展名的包内名字，如 stats、stats_keep
+	stats metrics.StatsOutput
+}
+
+// source 待打包的一次运行
+type source struct {
+	dir      string
+	scenario string
+	runID    string
+	stats    []statsFile // 第一个为主 stats，用于 README 和复现命令
+	files    []artifact  // stats 以外的产物，按打包优先级排序
+}
+
+// kindOrder 可选产物的打包顺序，超出预算时从后往前舍弃
+var kindOrder = map[string]int{"report": 0, "other": 1, "profile": 2, "log": 3}
+
+// collect 读取 run 目录 (scenario 为空) 或 flat 布局下某个场景的产物
+func collect(dir, scenario string) (*source, error) {
+	src := &source{dir: dir, scenario: scenario}
+	var names []string
+	if scenario == "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				names = append(names, e.Name())
+			}
+		}
+		if err := src.readManifest(); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if names, err = results.FlatFiles(dir, scenario); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		kind := kindOf(name)
+		switch kind {
+		case "skip":
+			continue
+		case "stats":
+			stats, err := metrics.LoadStats(path)
+			if err != nil {
+				return nil, err
+			}
+			base := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".json")
+			src.stats = append(src.stats, statsFile{name: base, stats: stats})
+			continue
+		}
+		src.files = append(src.files, artifact{name: name, path: path, kind: kind, size: info.Size()})
+	}
+	if len(src.stats) == 0 {
+		return nil, fmt.Errorf("no stats file in %s", dir)
+	}
+	// 名字最短的为主 stats (stats.json 先于 stats_keep.json)
+	sort.SliceStable(src.stats, func(i, j int) bool { return len(src.stats[i].name) < len(src.stats[j].name) })
+	sort.SliceStable(src.files, func(i, j int) bool { return kindOrder[src.files[i].kind] < kindOrder[src.files[j].kind] })
+
+	meta := src.stats[0].stats.Metadata
+	if src.scenario == "" {
+		src.scenario = meta["flag.scenario"]
+	}
+	if src.runID == "" {
+		src.runID = meta["run_id"]
+	}
+	if src.scenario == "" {
+		src.scenario = filepath.Base(filepath.Clean(dir))
+	}
+	return src, nil
+}
+
+// readManifest run 目录下有 manifest.json 时读取场景名和 run ID
+func (s *source) readManifest() error {
+	path := filepath.Join(s.dir, results.ManifestName)
+	if _, err := os.Stat(path); err != nil {
+		return nil // 进程中途退出时可能没有清单
+	}
+	m, err := results.ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	s.scenario, s.runID = m.Scenario, m.RunID
+	return nil
+}
+
+// kindOf 按文件名判断产物类型: stats 会被替换为摘要，sink 为下游模拟写出的数据不打包，
+// index.html 链接的是结果目录中的原始文件，在包内无用
+func kindOf(name string) string {
+	switch {
+	case strings.HasPrefix(name, "stats") && (strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")):
+		return "stats"
+	case strings.HasPrefix(name, "sink"), strings.HasPrefix(name, "index"):
+		return "skip"
+	case strings.HasSuffix(name, ".pprof"), strings.Contains(name, "goroutines"):
+		return "profile"
+	case strings.HasSuffix(name, ".log"):
+		return "log"
+	case strings.HasPrefix(name, "producer"), strings.HasPrefix(name, "result"), name == results.ManifestName:
+		return "report"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,207 @@
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// urlPattern scheme://authority[/path]，authority 中可能带 user@ 和 :port
+	// (pulsar://a:6650,b:6650 形式的多个主机以逗号分隔)
+	urlPattern = regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*)://([^\s"'<>/;)]+)(/[^\s"'<>,;)]*)?`)
+	// ipPattern IPv4 和 IPv6 的候选，再由 net.ParseIP 确认
+	ipPattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|(?:[0-9a-fA-F]{0,4}:){2,7}[0-9a-fA-F]{1,4}\b`)
+	// adminPathPattern admin REST 路径中的 tenant/namespace (topic 和 namespace 两类接口)
+	adminPathPattern = regexp.MustCompile(`^/admin/v2/(?:persistent|non-persistent|namespaces)/([^/]+)/([^/]+)`)
+)
+
+// topicSchemes 的 authority 是 tenant 而不是主机
+var topicSchemes = map[string]bool{"persistent": true, "non-persistent": true}
+
+// sanitizer -sanitize: 把主机名、URL 中的主机、IP 和 tenant/namespace 替换为占位名 (host-1、ip-1、tenant-1/namespace-1)。
+// 先 learn 全部文本收集要替换的值，再 apply；同一个值在所有文件中替换为同一个占位名，
+// 跨文件的对应关系 (哪个进程连的是哪个 broker) 保持不变。回环地址和未指定地址不是基础设施信息，保留原样
+type sanitizer struct {
+	names   map[string]string // 原值 -> 占位名
+	counts  map[string]int    // 每类已分配的占位名个数
+	local   string            // 本机主机名
+	rules   []rule            // URL 之外按文本替换的主机名和 tenant/namespace
+	learned int               // 生成 rules 时 names 的大小
+}
+
+// rule 一个文本替换
+type rule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+func newSanitizer() *sanitizer {
+	s := &sanitizer{names: make(map[string]string), counts: make(map[string]int)}
+	// 打包通常就在运行测试的主机上，主机名会出现在 instance 等标识中
+	if host, err := os.Hostname(); err == nil {
+		s.local = host
+		s.addHost(host)
+	}
+	return s
+}
+
+// placeholder 原值对应的占位名，第一次出现时按类别分配
+func (s *sanitizer) placeholder(kind, value string) string {
+	key := kind + "\x00" + value
+	if p, ok := s.names[key]; ok {
+		return p
+	}
+	s.counts[kind]++
+	p := fmt.Sprintf("%s-%d", kind, s.counts[kind])
+	s.names[key] = p
+	return p
+}
+
+func (s *sanitizer) addHost(host string) {
+	host = strings.Trim(host, "[]")
+	if host == "" || host == "localhost" || net.ParseIP(host) != nil {
+		return
+	}
+	s.placeholder("host", host)
+}
+
+func (s *sanitizer) addNamespace(tenant, namespace string) {
+	if tenant == "" || namespace == "" {
+		return
+	}
+	ns := tenant + "/" + namespace
+	if _, ok := s.names["tenant/namespace\x00"+ns]; !ok {
+		s.names["tenant/namespace\x00"+ns] = s.placeholder("tenant", tenant) + "/" + s.placeholder("namespace", ns)
+	}
+}
+
+// learn 从文本中的 URL、topic 和 admin REST 路径收集主机名和 tenant/namespace
+func (s *sanitizer) learn(data []byte) {
+	for _, m := range urlPattern.FindAllSubmatch(data, -1) {
+		scheme, authority, path := strings.ToLower(string(m[1])), string(m[2]), string(m[3])
+		if topicSchemes[scheme] {
+			namespace, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+			s.addNamespace(authority, namespace)
+			continue
+		}
+		_, hosts, _ := cutLast(authority, "@")
+		for _, hostport := range strings.Split(hosts, ",") {
+			s.addHost(hostOnly(hostport))
+		}
+		if sub := adminPathPattern.FindStringSubmatch(path); sub != nil {
+			s.addNamespace(sub[1], sub[2])
+		}
+	}
+}
+
+// buildRules 按已收集的值生成文本替换，长的在前。带点的主机名和本机主机名按整词替换；
+// 单段的主机名 (如 docker compose 中的 pulsar、broker) 容易与普通单词重合，只替换 host:port 形式
+func (s *sanitizer) buildRules() {
+	if s.learned == len(s.names) {
+		return
+	}
+	s.learned = len(s.names)
+	var keys []string
+	for key := range s.names {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	s.rules = s.rules[:0]
+	for _, key := range keys {
+		kind, value, _ := strings.Cut(key, "\x00")
+		p := s.names[key]
+		switch {
+		case kind == "tenant/namespace":
+			s.rules = append(s.rules, rule{regexp.MustCompile(`\b` + regexp.QuoteMeta(value) + `\b`), p})
+		case kind != "host":
+		case strings.Contains(value, ".") || value == s.local:
+			s.rules = append(s.rules, rule{regexp.MustCompile(`\b` + regexp.QuoteMeta(value) + `\b`), p})
+		default:
+			s.rules = append(s.rules, rule{regexp.MustCompile(`\b` + regexp.QuoteMeta(value) + `(:\d+)`), p + "$1"})
+		}
+	}
+}
+
+// apply 替换文本中的 URL、IP、已知主机名和 tenant/namespace
+func (s *sanitizer) apply(data []byte) []byte {
+	data = urlPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := urlPattern.FindSubmatch(m)
+		scheme, authority, path := string(sub[1]), string(sub[2]), string(sub[3])
+		if topicSchemes[strings.ToLower(scheme)] {
+			namespace, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+			if p, ok := s.names["tenant/namespace\x00"+authority+"/"+namespace]; ok {
+				return []byte(scheme + "://" + p + "/" + rest)
+			}
+			return m
+		}
+		// 去掉 user:password@
+		_, hosts, _ := cutLast(authority, "@")
+		list := strings.Split(hosts, ",")
+		for i, hostport := range list {
+			host := hostOnly(hostport)
+			if p := s.hostPlaceholder(host); p != "" {
+				list[i] = strings.Replace(hostport, host, p, 1)
+			}
+		}
+		return []byte(scheme + "://" + strings.Join(list, ",") + path)
+	})
+	data = ipPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		ip := net.ParseIP(string(m))
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+			return m
+		}
+		return []byte(s.placeholder("ip", ip.String()))
+	})
+	s.buildRules()
+	for _, r := range s.rules {
+		data = r.re.ReplaceAll(data, []byte(r.repl))
+	}
+	return data
+}
+
+// hostPlaceholder 主机名或 IP 的占位名，回环地址、localhost 和空值返回空
+func (s *sanitizer) hostPlaceholder(host string) string {
+	if host == "" || host == "localhost" {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() || ip.IsUnspecified() {
+			return ""
+		}
+		return s.placeholder("ip", ip.String())
+	}
+	return s.placeholder("host", host)
+}
+
+// summary 各类被替换的值的个数，写进 README
+func (s *sanitizer) summary() string {
+	return fmt.Sprintf("%d hostnames, %d IPs, %d tenants, %d namespaces",
+		s.counts["host"], s.counts["ip"], s.counts["tenant"], s.counts["namespace"])
+}
+
+// isText 只处理文本文件，heap profile 等二进制产物原样打包
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// hostOnly 去掉 host:port 和 [v6]:port 中的端口
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+// cutLast 与 strings.Cut 相同但按最后一个 sep 切分，没有 sep 时整个 s 作为 after
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return "", s, false
+}
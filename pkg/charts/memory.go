@@ -0,0 +1,95 @@
+// Package charts 把 stats 文件画成不依赖外部资源的 SVG，供 bundle 打包和结果目录的 index.html 内嵌
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// maxChartPoints 曲线最多的点数，更长的序列按步长抽取，控制 SVG 体积
+const maxChartPoints = 1000
+
+// chartPoint 曲线上的一个点
+type chartPoint struct {
+	t         time.Time
+	heap, rss uint64
+}
+
+// chartPoints 取原始样本，没有样本 (-samples=rollup) 时取 rollup 行的最大值
+func chartPoints(stats metrics.StatsOutput) []chartPoint {
+	var points []chartPoint
+	for _, s := range stats.Samples {
+		points = append(points, chartPoint{t: s.Timestamp, heap: s.HeapAlloc, rss: s.RSS})
+	}
+	if len(points) == 0 {
+		for _, r := range stats.Rollups {
+			points = append(points, chartPoint{t: r.Start, heap: r.HeapAlloc.Max, rss: r.RSS.Max})
+		}
+	}
+	if step := (len(points) + maxChartPoints - 1) / maxChartPoints; step > 1 {
+		sampled := make([]chartPoint, 0, maxChartPoints+1)
+		for i := 0; i < len(points); i += step {
+			sampled = append(sampled, points[i])
+		}
+		points = append(sampled, points[len(points)-1])
+	}
+	return points
+}
+
+// Memory HeapAlloc 和 RSS 随时间变化的 SVG，最大的几次跳变用竖线标出；没有点时返回 nil
+func Memory(title string, stats metrics.StatsOutput) []byte {
+	points := chartPoints(stats)
+	if len(points) < 2 {
+		return nil
+	}
+	const width, height, pad = 900, 420, 60
+	start := points[0].t
+	span := points[len(points)-1].t.Sub(start).Seconds()
+	if span <= 0 {
+		span = 1
+	}
+	var top uint64 = 1
+	for _, p := range points {
+		top = max(top, p.heap, p.rss)
+	}
+	topMB := float64(top) * 1.1 / 1024 / 1024
+	x := func(t time.Time) float64 { return pad + t.Sub(start).Seconds()/span*(width-2*pad) }
+	y := func(v uint64) float64 { return height - pad - float64(v)/1024/1024/topMB*(height-2*pad) }
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="20" text-anchor="middle" font-size="13">%s</text>`+"\n", width/2, html.EscapeString(title))
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", pad, height-pad, width-pad, height-pad)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", pad, pad, pad, height-pad)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">seconds (0 - %.0f)</text>`+"\n", width/2, height-20, span)
+	fmt.Fprintf(&b, `<text x="15" y="%d" text-anchor="middle" transform="rotate(-90 15 %d)">MB (0 - %.0f)</text>`+"\n", height/2, height/2, topMB)
+
+	for _, j := range stats.Summary.Jumps {
+		if j.Time.Before(start) || j.Time.After(points[len(points)-1].t) {
+			continue
+		}
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="orange" stroke-dasharray="3 3"/>`+"\n", x(j.Time), pad, x(j.Time), height-pad)
+	}
+	for _, series := range []struct {
+		name, color string
+		value       func(chartPoint) uint64
+	}{
+		{"HeapAlloc", "steelblue", func(p chartPoint) uint64 { return p.heap }},
+		{"RSS", "firebrick", func(p chartPoint) uint64 { return p.rss }},
+	} {
+		b.WriteString(`<polyline fill="none" stroke="` + series.color + `" points="`)
+		for _, p := range points {
+			fmt.Fprintf(&b, "%.1f,%.1f ", x(p.t), y(series.value(p)))
+		}
+		b.WriteString("\"/>\n")
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="steelblue">HeapAlloc</text>`+"\n", width-pad-120, pad-10)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="firebrick">RSS</text>`+"\n", width-pad-50, pad-10)
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
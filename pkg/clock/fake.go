@@ -0,0 +1,195 @@
+package clock
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake 只在 Advance/Set 时前进的时钟。到期的 Ticker/Timer 向缓冲为 1 的 C 非阻塞发送
+// (与 time 包相同，接收方来不及时丢弃)，AfterFunc 的函数在 Advance 的调用方中按到期顺序同步运行
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFake 创建从 start 开始的 Fake
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// fakeWaiter Fake 上的一个 Ticker、Timer 或 AfterFunc
+type fakeWaiter struct {
+	clock  *Fake
+	due    time.Time
+	period time.Duration // Ticker 的间隔，0 表示只触发一次
+	c      chan time.Time
+	f      func()
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{clock: f, period: d, c: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return fakeTicker{w}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	f.fire()
+	return fakeTimer{w}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &fakeWaiter{clock: f, f: fn}
+	f.schedule(w, d)
+	f.fire()
+	return fakeTimer{w}
+}
+
+// Advance 时间前进 d，按到期顺序触发其间到期的定时器；回调中创建的已到期定时器也在返回前触发
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	target := f.now.Add(d)
+	f.mu.Unlock()
+	f.advanceTo(target)
+}
+
+// Set 时间前进到 t，早于当前时间时什么也不做
+func (f *Fake) Set(t time.Time) {
+	f.advanceTo(t)
+}
+
+// Waiters 尚未触发或停止的定时器个数 (Ticker 停止前一直计入)，
+// 测试可据此等待被测 goroutine 创建好定时器之后再 Advance
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// advanceTo 逐个触发 target 之前到期的定时器，每次触发前把当前时间设为其到期时间
+func (f *Fake) advanceTo(target time.Time) {
+	for {
+		f.mu.Lock()
+		if len(f.waiters) == 0 || f.waiters[0].due.After(target) {
+			if target.After(f.now) {
+				f.now = target
+			}
+			f.mu.Unlock()
+			return
+		}
+		w := f.waiters[0]
+		due := w.due
+		if due.After(f.now) {
+			f.now = due
+		}
+		f.pop(w)
+		f.mu.Unlock()
+		w.run(due)
+	}
+}
+
+// fire 触发已经到期的定时器 (d <= 0 的 Timer 和 AfterFunc)，不推进时间
+func (f *Fake) fire() {
+	f.advanceTo(f.Now())
+}
+
+// schedule 在 d 之后到期 (重新) 加入等待列表，d <= 0 时立即到期；返回 w 此前是否还在等待
+func (f *Fake) schedule(w *fakeWaiter, d time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	active := f.remove(w)
+	w.due = f.now.Add(max(d, 0))
+	f.insert(w)
+	return active
+}
+
+// pop 取出到期的 w，Ticker 按间隔重新加入；调用方持有 mu
+func (f *Fake) pop(w *fakeWaiter) {
+	f.remove(w)
+	if w.period > 0 {
+		// 与 time.Ticker 相同，积压的多个周期只发送一次
+		w.due = w.due.Add(w.period)
+		for !w.due.After(f.now) {
+			w.due = w.due.Add(w.period)
+		}
+		f.insert(w)
+	}
+}
+
+// insert 按 due 插入等待列表，同一时刻到期的按加入顺序触发；调用方持有 mu
+func (f *Fake) insert(w *fakeWaiter) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].due.After(w.due) })
+	f.waiters = slices.Insert(f.waiters, i, w)
+}
+
+// remove 从等待列表中删除 w，返回 w 是否在列表中；调用方持有 mu
+func (f *Fake) remove(w *fakeWaiter) bool {
+	if i := slices.Index(f.waiters, w); i >= 0 {
+		f.waiters = slices.Delete(f.waiters, i, i+1)
+		return true
+	}
+	return false
+}
+
+func (w *fakeWaiter) run(t time.Time) {
+	if w.f != nil {
+		w.f()
+		return
+	}
+	select {
+	case w.c <- t:
+	default:
+	}
+}
+
+// stop 停止 w，返回 w 停止前是否还在等待
+func (w *fakeWaiter) stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.remove(w)
+}
+
+// reset 在 d 之后重新到期，返回 w 重置前是否还在等待
+func (w *fakeWaiter) reset(d time.Duration) bool {
+	active := w.clock.schedule(w, d)
+	w.clock.fire()
+	return active
+}
+
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.c }
+func (t fakeTicker) Stop()               { t.w.stop() }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	t.w.clock.mu.Lock()
+	t.w.period = d
+	t.w.clock.mu.Unlock()
+	t.w.reset(d)
+}
+
+type fakeTimer struct{ w *fakeWaiter }
+
+func (t fakeTimer) C() <-chan time.Time        { return t.w.c }
+func (t fakeTimer) Stop() bool                 { return t.w.stop() }
+func (t fakeTimer) Reset(d time.Duration) bool { return t.w.reset(d) }
@@ -0,0 +1,184 @@
+package clock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestFakeAdvanceOrder Advance 按到期顺序触发，同一时刻按创建顺序；回调看到的 Now 是自己的到期时间，
+// 回调中创建的已到期定时器也在 Advance 返回前触发
+func TestFakeAdvanceOrder(t *testing.T) {
+	f := NewFake(start)
+	var got []string
+	record := func(name string) func() {
+		return func() { got = append(got, name+"@"+f.Since(start).String()) }
+	}
+	f.AfterFunc(3*time.Second, record("c"))
+	f.AfterFunc(time.Second, func() {
+		record("a")()
+		f.AfterFunc(0, record("a-now"))
+		f.AfterFunc(500*time.Millisecond, record("a-later"))
+	})
+	f.AfterFunc(2*time.Second, record("b1"))
+	f.AfterFunc(2*time.Second, record("b2"))
+	f.AfterFunc(10*time.Second, record("d"))
+
+	f.Advance(5 * time.Second)
+	want := []string{"a@1s", "a-now@1s", "a-later@1.5s", "b1@2s", "b2@2s", "c@3s"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("fired %v, want %v", got, want)
+	}
+	if now := f.Since(start); now != 5*time.Second {
+		t.Fatalf("Now after Advance = start+%v, want start+5s", now)
+	}
+	if n := f.Waiters(); n != 1 {
+		t.Fatalf("Waiters = %d, want 1 (d)", n)
+	}
+
+	// Set 到过去什么也不做
+	f.Set(start)
+	if now := f.Since(start); now != 5*time.Second {
+		t.Fatalf("Set to the past moved Now to start+%v", now)
+	}
+}
+
+// TestFakeTickerCatchUp 一次 Advance 跨过多个周期时 C 只保留第一次触发，下一次到期排在当前时间之后
+func TestFakeTickerCatchUp(t *testing.T) {
+	f := NewFake(start)
+	tk := f.NewTicker(time.Second)
+	defer tk.Stop()
+
+	f.Advance(3500 * time.Millisecond)
+	select {
+	case got := <-tk.C():
+		if want := start.Add(time.Second); !got.Equal(want) {
+			t.Fatalf("tick at %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("no tick after 3.5 periods")
+	}
+	select {
+	case got := <-tk.C():
+		t.Fatalf("backlogged tick at %v delivered, want dropped", got)
+	default:
+	}
+
+	f.Advance(499 * time.Millisecond)
+	select {
+	case got := <-tk.C():
+		t.Fatalf("tick at %v before the next period", got)
+	default:
+	}
+	f.Advance(time.Millisecond)
+	if got, want := <-tk.C(), start.Add(4*time.Second); !got.Equal(want) {
+		t.Fatalf("tick at %v, want %v", got, want)
+	}
+
+	// Reset 从当前时间重新计算周期
+	tk.Reset(2 * time.Second)
+	f.Advance(time.Second)
+	select {
+	case got := <-tk.C():
+		t.Fatalf("tick at %v before the reset period", got)
+	default:
+	}
+	f.Advance(time.Second)
+	if got, want := <-tk.C(), start.Add(6*time.Second); !got.Equal(want) {
+		t.Fatalf("tick after Reset at %v, want %v", got, want)
+	}
+}
+
+// TestFakeTimerStopReset Stop 和 Reset 的返回值与 time.Timer 相同: 定时器此前是否还在等待
+func TestFakeTimerStopReset(t *testing.T) {
+	f := NewFake(start)
+	tm := f.NewTimer(time.Second)
+	if !tm.Stop() {
+		t.Fatal("Stop of a pending timer returned false")
+	}
+	if tm.Stop() {
+		t.Fatal("second Stop returned true")
+	}
+	f.Advance(time.Second)
+	select {
+	case <-tm.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	if tm.Reset(time.Second) {
+		t.Fatal("Reset of a stopped timer returned true")
+	}
+	if !tm.Reset(2 * time.Second) {
+		t.Fatal("Reset of a pending timer returned false")
+	}
+	f.Advance(time.Second)
+	select {
+	case <-tm.C():
+		t.Fatal("timer fired at the replaced deadline")
+	default:
+	}
+	f.Advance(time.Second)
+	if got, want := <-tm.C(), start.Add(3*time.Second); !got.Equal(want) {
+		t.Fatalf("timer fired at %v, want %v", got, want)
+	}
+	if tm.Stop() {
+		t.Fatal("Stop of a fired timer returned true")
+	}
+
+	// d <= 0 的 Timer 和 AfterFunc 在创建时立即到期
+	if got := <-f.NewTimer(0).C(); !got.Equal(f.Now()) {
+		t.Fatalf("zero timer fired at %v, want %v", got, f.Now())
+	}
+	ran := false
+	af := f.AfterFunc(-time.Second, func() { ran = true })
+	if !ran {
+		t.Fatal("AfterFunc with negative duration did not run")
+	}
+	if af.Stop() {
+		t.Fatal("Stop after AfterFunc ran returned true")
+	}
+
+	ran = false
+	af = f.AfterFunc(time.Second, func() { ran = true })
+	if !af.Stop() {
+		t.Fatal("Stop of a pending AfterFunc returned false")
+	}
+	f.Advance(time.Second)
+	if ran {
+		t.Fatal("stopped AfterFunc ran")
+	}
+}
+
+// TestFakeWaiters Waiters 计入未触发的 Timer 和未停止的 Ticker，另一个 goroutine 创建定时器后测试据此再 Advance
+func TestFakeWaiters(t *testing.T) {
+	f := NewFake(start)
+	tk := f.NewTicker(time.Second)
+	f.NewTimer(2 * time.Second)
+	if n := f.Waiters(); n != 2 {
+		t.Fatalf("Waiters = %d, want 2", n)
+	}
+	f.Advance(2 * time.Second)
+	if n := f.Waiters(); n != 1 {
+		t.Fatalf("Waiters after the timer fired = %d, want 1", n)
+	}
+	tk.Stop()
+	if n := f.Waiters(); n != 0 {
+		t.Fatalf("Waiters after Ticker.Stop = %d, want 0", n)
+	}
+
+	done := make(chan time.Time)
+	go func() {
+		tm := f.NewTimer(time.Minute)
+		done <- <-tm.C()
+	}()
+	for f.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	f.Advance(time.Minute)
+	if got, want := <-done, start.Add(2*time.Second+time.Minute); !got.Equal(want) {
+		t.Fatalf("goroutine's timer fired at %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+// Package clock 用 SNTP 估算本机时钟相对 NTP 服务器的偏差，
+// 使不同主机上的 producer 和 consumer 时间戳可以换算到同一时间轴；
+// 并提供可替换的时钟 (Clock)，测试中用 Fake 手动推进时间
+package clock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ntpEpoch NTP 时间戳起点 1900-01-01 与 unix 起点之差 (秒)
+const ntpEpoch = 2208988800
+
+// Estimate 一次偏差估算的结果
+type Estimate struct {
+	Server  string
+	Offset  time.Duration // NTP 时间 - 本机时间，正值表示本机时钟偏慢
+	RTT     time.Duration // 选中样本的往返时延，偏差误差不超过 RTT/2
+	Samples int           // 成功的样本数
+}
+
+// Now 按偏差校正后的当前时间 (NTP 时间轴)
+func (e *Estimate) Now() time.Time {
+	return time.Now().Add(e.Offset)
+}
+
+// ToLocal 把 NTP 时间轴上的时间换算为本机时钟
+func (e *Estimate) ToLocal(t time.Time) time.Time {
+	return t.Add(-e.Offset)
+}
+
+func (e *Estimate) String() string {
+	return fmt.Sprintf("%s offset %v (±%v, %d samples)",
+		e.Server, e.Offset.Round(time.Microsecond), (e.RTT / 2).Round(time.Microsecond), e.Samples)
+}
+
+// Query 向 server (host 或 host:port，默认端口 123) 发送 samples 次请求，
+// 取往返时延最小的一次作为估算结果，全部失败时返回最后一个错误
+func Query(server string, samples int, timeout time.Duration) (*Estimate, error) {
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(strings.Trim(server, "[]"), "123")
+	}
+
+	best := &Estimate{Server: server}
+	var lastErr error
+	for i := 0; i < max(samples, 1); i++ {
+		offset, rtt, err := query(addr, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best.Samples == 0 || rtt < best.RTT {
+			best.Offset, best.RTT = offset, rtt
+		}
+		best.Samples++
+	}
+	if best.Samples == 0 {
+		return nil, fmt.Errorf("ntp %s: %w", server, lastErr)
+	}
+	return best, nil
+}
+
+// query 一次 SNTP (RFC 4330) 请求:
+// offset = ((t2 - t1) + (t3 - t4)) / 2，rtt = (t4 - t1) - (t3 - t2)
+func query(addr string, timeout time.Duration) (offset, rtt time.Duration, err error) {
+	conn, err := net.DialTimeout("udp", addr, timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, 0, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI 0, VN 4, Mode 3 (client)
+	t1 := time.Now()
+	putTime(req[40:], t1)
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, 0, err
+	}
+	// 用单调时钟推算 t4，避免读取期间本机时钟被调整
+	t4 := t1.Add(time.Since(t1))
+
+	if n < 48 {
+		return 0, 0, errors.New("short response")
+	}
+	if mode := resp[0] & 0x07; mode != 4 {
+		return 0, 0, fmt.Errorf("unexpected mode %d", mode)
+	}
+	if resp[1] == 0 {
+		return 0, 0, fmt.Errorf("kiss-of-death %q", resp[12:16])
+	}
+	t2, t3 := getTime(resp[32:]), getTime(resp[40:])
+	offset = (t2.Sub(t1) + t3.Sub(t4)) / 2
+	rtt = t4.Sub(t1) - t3.Sub(t2)
+	return offset, max(rtt, 0), nil
+}
+
+func putTime(b []byte, t time.Time) {
+	nsec := t.UnixNano()
+	sec := uint64(nsec/1e9) + ntpEpoch
+	frac := uint64(nsec%1e9) << 32 / 1e9
+	binary.BigEndian.PutUint32(b, uint32(sec))
+	binary.BigEndian.PutUint32(b[4:], uint32(frac))
+}
+
+func getTime(b []byte) time.Time {
+	sec := int64(binary.BigEndian.Uint32(b)) - ntpEpoch
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(sec, frac*1e9>>32)
+}
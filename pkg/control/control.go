@@ -0,0 +1,112 @@
+// Package control 在 producer 和 consumer 之间交换精确的进度计数:
+// 每个进程在诊断服务上暴露 /control/status，另一方通过 Client 读取。
+//
+// 受控积压实验中 producer 读取 consumer 的已处理计数，保持固定的领先量 (见 Lead)；
+// consumer 也可以读取 producer 的已发送计数，按计数而不是接收超时判断是否消费完。
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Path 状态端点的路径
+const Path = "/control/status"
+
+// Status 一个进程的进度计数
+type Status struct {
+	Program  string    `json:"program"`
+	Messages int64     `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+	Done     bool      `json:"done"` // 不会再有新的消息 (producer 发送完毕、consumer 退出消费循环)
+	Time     time.Time `json:"time"`
+}
+
+// SourceFunc 返回当前计数
+type SourceFunc func() (messages, bytes int64, done bool)
+
+// Endpoint 状态端点；SetSource 之前返回 503，便于在计数器就绪前先注册到诊断服务
+type Endpoint struct {
+	program  string
+	source   atomic.Pointer[SourceFunc]
+	polled   atomic.Bool
+	doneRead chan struct{} // Done 状态第一次被读取后关闭
+	doneOnce sync.Once
+}
+
+// NewEndpoint 创建状态端点
+func NewEndpoint(program string) *Endpoint {
+	return &Endpoint{program: program, doneRead: make(chan struct{})}
+}
+
+// SetSource 设置计数来源
+func (e *Endpoint) SetSource(fn SourceFunc) {
+	e.source.Store(&fn)
+}
+
+func (e *Endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn := e.source.Load()
+	if fn == nil {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	s := Status{Program: e.program, Time: time.Now()}
+	s.Messages, s.Bytes, s.Done = (*fn)()
+	e.polled.Store(true)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err == nil && s.Done {
+		e.doneOnce.Do(func() { close(e.doneRead) })
+	}
+}
+
+// WaitDoneRead 在进程退出前调用: 端点被读取过时，最多等待 timeout 直到对方读到 Done 状态，
+// 使对方拿到最终计数；从未被读取过时立即返回。返回对方是否已读到 Done
+func (e *Endpoint) WaitDoneRead(timeout time.Duration) bool {
+	if !e.polled.Load() {
+		return false
+	}
+	select {
+	case <-e.doneRead:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Client 读取另一进程的状态端点
+type Client struct {
+	URL  string
+	http *http.Client
+}
+
+// NewClient 创建客户端，url 为对方诊断服务的地址，如 http://localhost:6060
+func NewClient(url string) *Client {
+	return &Client{URL: strings.TrimRight(url, "/"), http: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Status 读取一次状态
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var s Status
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+Path, nil)
+	if err != nil {
+		return s, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return s, fmt.Errorf("control: GET %s: %s %s", c.URL+Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	return s, err
+}
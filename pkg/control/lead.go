@@ -0,0 +1,144 @@
+package control
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Lead 闭环控制 producer 相对 consumer 的领先量: 已发出 - consumer 已处理 达到上限时，
+// Wait 阻塞到 consumer 追上为止，使积压稳定在 Messages 条或 Bytes 字节 (先到者生效)。
+//
+// consumer 计数按 poll 间隔刷新，积压会在上限以下一个轮询周期的消费量内波动；
+// 并发发送时还可能超出最多 concurrency 条。
+type Lead struct {
+	client   *Client
+	messages int64
+	bytes    int64
+	poll     time.Duration
+
+	mu       sync.Mutex
+	remote   Status // 已扣除 base
+	base     Status // 第一次读到的 consumer 计数，之前消费的旧积压不计入
+	ready    bool
+	updated  chan struct{} // 每次轮询后关闭并替换，唤醒所有等待者
+	stats    LeadStats
+	samples  int64
+	sumMsgs  float64
+	sumBytes float64
+}
+
+// LeadStats 领先量控制的统计，写入 producer 报告
+type LeadStats struct {
+	TargetMessages int64   `json:"target_messages,omitempty"`
+	TargetBytes    int64   `json:"target_bytes,omitempty"`
+	AvgLagMessages float64 `json:"avg_lag_messages"` // 每次轮询时 已发出 - consumer 已处理 的平均值
+	MaxLagMessages int64   `json:"max_lag_messages"`
+	AvgLagBytes    float64 `json:"avg_lag_bytes"`
+	MaxLagBytes    int64   `json:"max_lag_bytes"`
+	Waits          int64   `json:"waits"`   // 因领先量达到上限而等待的次数
+	WaitMs         float64 `json:"wait_ms"` // 等待总时长
+	PollErrors     int64   `json:"poll_errors"`
+}
+
+// NewLead 创建领先量控制，messages/bytes 为 0 表示不限制该维度
+func NewLead(client *Client, messages, bytes int64, poll time.Duration) *Lead {
+	return &Lead{
+		client:   client,
+		messages: messages,
+		bytes:    bytes,
+		poll:     poll,
+		updated:  make(chan struct{}),
+		stats:    LeadStats{TargetMessages: messages, TargetBytes: bytes},
+	}
+}
+
+// Run 每隔 poll 读取 consumer 状态，直到 ctx 取消；sent 返回当前已发出的消息数和字节数，用于记录积压
+func (l *Lead) Run(ctx context.Context, sent func() (messages, bytes int64)) {
+	ticker := time.NewTicker(l.poll)
+	defer ticker.Stop()
+	failing := false
+	for {
+		s, err := l.client.Status(ctx)
+		l.mu.Lock()
+		if err != nil {
+			l.stats.PollErrors++
+			if !failing && ctx.Err() == nil {
+				log.Printf("Lead control: waiting for consumer at %s: %v", l.client.URL, err)
+			}
+			failing = true
+		} else {
+			if !l.ready {
+				log.Printf("Lead control: consumer at %s has processed %d messages, counting from here", l.client.URL, s.Messages)
+				l.base = s
+			}
+			failing = false
+			s.Messages -= l.base.Messages
+			s.Bytes -= l.base.Bytes
+			l.remote, l.ready = s, true
+			msgs, bytes := sent()
+			l.record(msgs-s.Messages, bytes-s.Bytes)
+			close(l.updated)
+			l.updated = make(chan struct{})
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// record 记录一次轮询时的积压；调用方持有锁
+func (l *Lead) record(msgs, bytes int64) {
+	l.samples++
+	l.sumMsgs += float64(msgs)
+	l.sumBytes += float64(bytes)
+	l.stats.MaxLagMessages = max(l.stats.MaxLagMessages, msgs)
+	l.stats.MaxLagBytes = max(l.stats.MaxLagBytes, bytes)
+}
+
+// Wait 在发出下一条 size 字节的消息前调用，issued/issuedBytes 为已发出的数量；
+// 领先量未达上限时立即返回，否则等到 consumer 追上或 ctx 取消。第一次读到 consumer 状态之前一直等待
+func (l *Lead) Wait(ctx context.Context, issued, issuedBytes, size int64) error {
+	var start time.Time
+	for {
+		l.mu.Lock()
+		ok := l.ready &&
+			(l.messages <= 0 || issued-l.remote.Messages < l.messages) &&
+			(l.bytes <= 0 || issuedBytes+size-l.remote.Bytes <= l.bytes)
+		updated := l.updated
+		if ok {
+			if !start.IsZero() {
+				l.stats.Waits++
+				l.stats.WaitMs += float64(time.Since(start)) / float64(time.Millisecond)
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+		if start.IsZero() {
+			start = time.Now()
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Stats 返回统计
+func (l *Lead) Stats() LeadStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.stats
+	if l.samples > 0 {
+		s.AvgLagMessages = l.sumMsgs / float64(l.samples)
+		s.AvgLagBytes = l.sumBytes / float64(l.samples)
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+// Package export 把 Prometheus Registry 中的指标主动推送出去，
+// 供运行时间短于抓取周期、/metrics 来不及被抓到的测试使用。
+//
+// 支持 Prometheus Pushgateway 和 StatsD (DogStatsD 标签格式，Datadog agent 和 Telegraf 均可接收)。
+// Run 按固定间隔推送直到 ctx 取消，结束时调用方再 PushAll 一次，保证最终值被送达。
+// SampleWriter 另外把 MemoryMonitor 的逐秒样本直接写入 InfluxDB 或 TimescaleDB。
+package export
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Exporter 一个推送目标
+type Exporter interface {
+	Name() string
+	Push(ctx context.Context) error
+}
+
+// Run 每隔 interval 推送一次，直到 ctx 取消；推送失败只记录日志
+func Run(ctx context.Context, interval time.Duration, exporters []Exporter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			PushAll(ctx, exporters)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// PushAll 依次推送到全部目标，失败记录日志并合并返回
+func PushAll(ctx context.Context, exporters []Exporter) error {
+	var errs []error
+	for _, e := range exporters {
+		if err := e.Push(ctx); err != nil {
+			log.Printf("Push to %s failed: %v", e.Name(), err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sample 一个带 label 的数值
+type sample struct {
+	name   string
+	labels []*dto.LabelPair
+	value  float64
+}
+
+// flatten 展开 Gather 的结果; histogram/summary 与 ClientMetrics.Snapshot 一样只取 _count 和 _sum
+func flatten(g prometheus.Gatherer) ([]sample, error) {
+	families, err := g.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+	var out []sample
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := m.GetLabel()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				out = append(out, sample{name, labels, m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				out = append(out, sample{name, labels, m.GetGauge().GetValue()})
+			case dto.MetricType_UNTYPED:
+				out = append(out, sample{name, labels, m.GetUntyped().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				out = append(out,
+					sample{name + "_count", labels, float64(m.GetHistogram().GetSampleCount())},
+					sample{name + "_sum", labels, m.GetHistogram().GetSampleSum()})
+			case dto.MetricType_SUMMARY:
+				out = append(out,
+					sample{name + "_count", labels, float64(m.GetSummary().GetSampleCount())},
+					sample{name + "_sum", labels, m.GetSummary().GetSampleSum()})
+			}
+		}
+	}
+	return out, nil
+}
+
+// sortedKeys map 的键，用于生成稳定的输出
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Pushgateway 推送到 Prometheus Pushgateway
+//
+// 每次推送使用 PUT 整体替换同一 grouping key 下的指标，进程结束后最终值保留在 Pushgateway 上，
+// 需要清理时由调用方按 job/instance 删除。
+type Pushgateway struct {
+	url    string
+	pusher *push.Pusher
+}
+
+// NewPushgateway 创建 Pushgateway 推送，job 和 grouping 组成分组键
+func NewPushgateway(gatewayURL, job string, grouping map[string]string, g prometheus.Gatherer) (*Pushgateway, error) {
+	u, err := url.Parse(gatewayURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported Pushgateway URL %q: want http(s)://host:port", gatewayURL)
+	}
+	pusher := push.New(gatewayURL, job).Gatherer(g)
+	for _, k := range sortedKeys(grouping) {
+		pusher = pusher.Grouping(k, grouping[k])
+	}
+	return &Pushgateway{url: gatewayURL, pusher: pusher}, nil
+}
+
+func (p *Pushgateway) Name() string {
+	return "pushgateway " + p.url
+}
+
+func (p *Pushgateway) Push(ctx context.Context) error {
+	return p.pusher.PushContext(ctx)
+}
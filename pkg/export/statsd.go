@@ -0,0 +1,104 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsdPacketSize 单个 UDP 包的上限，留在常见 MTU 以内避免分片
+const statsdPacketSize = 1432
+
+// StatsD 以 DogStatsD 格式 (name:value|g|#tag:value) 通过 UDP 发送
+//
+// Prometheus 中的 counter 是累计值，而 StatsD 的 counter 是增量，
+// 因此全部以 gauge 发送，由后端按需求差 (Datadog 的 monotonic_diff、Telegraf 的 derivative)。
+type StatsD struct {
+	addr   string
+	prefix string
+	tags   string // 附加到每一行的公共标签，已格式化
+	g      prometheus.Gatherer
+	conn   net.Conn
+}
+
+// NewStatsD 创建 StatsD 推送，prefix 加在每个指标名前，tags 附加到每个指标
+func NewStatsD(addr, prefix string, tags map[string]string, g prometheus.Gatherer) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, k := range sortedKeys(tags) {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(statsdTag(k) + ":" + statsdTag(tags[k]))
+	}
+	return &StatsD{addr: addr, prefix: prefix, tags: b.String(), g: g, conn: conn}, nil
+}
+
+func (s *StatsD) Name() string {
+	return "statsd " + s.addr
+}
+
+// Push 把全部指标按包大小分批写出；UDP 不保证送达，只返回本地的发送错误
+func (s *StatsD) Push(ctx context.Context) error {
+	samples, err := flatten(s.g)
+	if err != nil {
+		return err
+	}
+	var packet, line bytes.Buffer
+	for _, smp := range samples {
+		line.Reset()
+		line.WriteString(s.prefix + smp.name + ":")
+		line.WriteString(strconv.FormatFloat(smp.value, 'g', -1, 64))
+		line.WriteString("|g")
+		sep := "|#"
+		if s.tags != "" {
+			line.WriteString(sep + s.tags)
+			sep = ","
+		}
+		for _, l := range smp.labels {
+			line.WriteString(sep + statsdTag(l.GetName()) + ":" + statsdTag(l.GetValue()))
+			sep = ","
+		}
+
+		if packet.Len() > 0 && packet.Len()+1+line.Len() > statsdPacketSize {
+			if err := s.send(ctx, &packet); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.Write(line.Bytes())
+	}
+	if packet.Len() > 0 {
+		return s.send(ctx, &packet)
+	}
+	return nil
+}
+
+func (s *StatsD) send(ctx context.Context, packet *bytes.Buffer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(packet.Bytes())
+	packet.Reset()
+	return err
+}
+
+// statsdTag 去掉 DogStatsD 协议中的分隔符
+func statsdTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,175 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// TSDBKinds -tsdb 可选的时序数据库
+var TSDBKinds = []string{"influx", "timescale"}
+
+// sampleQueue 等待写出的样本上限；数据库变慢时先在这里缓冲，满了丢弃新样本而不阻塞采集
+const sampleQueue = 1024
+
+// SampleWriter 把 MemoryMonitor 的每个样本在采集后立即写入时序数据库，长时间的 fleet 测试不需要事后导入。
+// 与 Pushgateway/StatsD 推送的 Prometheus 指标不同，写入的是 stats 文件中的完整样本 (列与 -stats-format=csv 相同)。
+//
+//   - influx: 以 line protocol POST 到写入地址，如 http://host:8086/api/v2/write?org=o&bucket=b
+//     (1.x 为 /write?db=d)，token 作为 "Authorization: Token"，measurement 为 pulsar_memory，tags 作为 tag
+//   - timescale: 经 PostgREST 以 JSON POST 到表的地址，如 http://host:3000/pulsar_memory，
+//     token 作为 "Authorization: Bearer" (JWT)，tags 写入 jsonb 列 labels；建表语句见 scripts/timescale-samples.sql
+//
+// 写入在后台 goroutine 中逐条进行，失败不重试，只计数。
+type SampleWriter struct {
+	kind   string
+	url    string
+	token  string
+	client *http.Client
+	encode func(s *metrics.MemoryStats) ([]byte, error)
+	ctype  string
+
+	mu     sync.Mutex
+	closed bool
+	ch     chan metrics.MemoryStats
+	done   chan struct{}
+
+	written atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+}
+
+// NewSampleWriter 创建写入并启动后台 goroutine，tags 附加到每个样本；Close 写完缓冲的样本后结束
+func NewSampleWriter(kind, rawURL, token string, tags map[string]string) (*SampleWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported URL %q: want http(s)://host:port/path", rawURL)
+	}
+	w := &SampleWriter{
+		kind:   kind,
+		url:    rawURL,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		ch:     make(chan metrics.MemoryStats, sampleQueue),
+		done:   make(chan struct{}),
+	}
+	switch kind {
+	case "influx":
+		lines := metrics.NewInfluxLines("pulsar_memory", tags)
+		w.encode = func(s *metrics.MemoryStats) ([]byte, error) { return lines.Append(nil, s), nil }
+		w.ctype = "text/plain; charset=utf-8"
+	case "timescale":
+		w.encode = func(s *metrics.MemoryStats) ([]byte, error) {
+			rec := metrics.SampleRecord(s)
+			rec["labels"] = tags
+			return json.Marshal(rec)
+		}
+		w.ctype = "application/json"
+	default:
+		return nil, fmt.Errorf("unknown time-series database %q (want %s)", kind, strings.Join(TSDBKinds, "|"))
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *SampleWriter) Name() string {
+	return w.kind + " " + w.url
+}
+
+// Add 把样本放入写出队列，不阻塞；队列已满或已 Close 时丢弃。可作为 MemoryMonitor.SetSampleHook
+func (w *SampleWriter) Add(s metrics.MemoryStats) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return
+	}
+	select {
+	case w.ch <- s:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+func (w *SampleWriter) run() {
+	defer close(w.done)
+	for s := range w.ch {
+		err := w.write(&s)
+		if err == nil {
+			w.written.Add(1)
+			continue
+		}
+		// 数据库不可用时每个样本都会失败，只有第一次用 Warn
+		if w.failed.Add(1) == 1 {
+			logging.Warnf("Write to %s failed (further failures at debug level): %v", w.Name(), err)
+		} else {
+			logging.Debugf("Write to %s failed: %v", w.Name(), err)
+		}
+	}
+}
+
+func (w *SampleWriter) write(s *metrics.MemoryStats) error {
+	body, err := w.encode(s)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.ctype)
+	if w.token != "" {
+		scheme := "Token"
+		if w.kind == "timescale" {
+			scheme = "Bearer"
+		}
+		req.Header.Set("Authorization", scheme+" "+w.token)
+	}
+	if w.kind == "timescale" {
+		req.Header.Set("Prefer", "return=minimal")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close 不再接收样本，等待队列中的样本写完 (最多到 ctx 结束) 并记录写入结果
+func (w *SampleWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.ch)
+	}
+	w.mu.Unlock()
+	var err error
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		err = fmt.Errorf("%s: %d samples not written: %w", w.Name(), len(w.ch), ctx.Err())
+	}
+	log.Printf("Samples to %s: %d written, %d failed, %d dropped", w.Name(), w.written.Load(), w.failed.Load(), w.dropped.Load())
+	return err
+}
@@ -0,0 +1,124 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pulsar-memory-test/pkg/workload"
+)
+
+// DefaultIdleTimeout ConsumerOptions.IdleTimeout 为 0 时的空闲超时
+const DefaultIdleTimeout = 10 * time.Second
+
+// ConsumerOptions NewConsumerRun 的参数，零值字段取括号中的默认值
+type ConsumerOptions struct {
+	URL              string // Pulsar 服务地址 (pulsar://localhost:6650)
+	Topic            string // 必填
+	Subscription     string // 订阅名 (memory-test-sub)
+	SubscriptionType string // exclusive、shared、failover 或 key_shared (shared)
+	StartLatest      bool   // 新订阅从最新位置开始，默认从最早的消息开始
+
+	ReceiverQueueSize int   // consumer ReceiverQueueSize (客户端默认 1000)
+	MemoryLimit       int64 // 客户端内存上限字节数 (客户端默认 64MB)
+
+	Messages    int64         // 处理这么多条消息后结束 (0 = 直到 IdleTimeout 内收不到消息)
+	IdleTimeout time.Duration // 这么久收不到消息时结束，收到第一条之前从订阅起算 (DefaultIdleTimeout)
+
+	// 与 consumer 命令行相同，消息按字节数攒批，整批处理后逐条确认并 GC；
+	// 攒批期间持有的消息正是要测量的内存
+	BatchSize      int64 // 批次累计到此字节数后确认 (50MB，与 consumer -batch-size 相同)
+	ReleasePayload bool  // 读取后立即 ReleasePayload，批次只为确认保留消息对象
+
+	Monitor   MonitorOptions // 内存采样，始终记录按发布时间计算的端到端延迟
+	StatsFile string         // 非空时结束后把 stats 保存到该文件
+}
+
+// ConsumerRun 一次消费测试：订阅、攒批接收并确认消息、采样内存。
+// 消费逻辑就是 workload.RunConsumer，与 consumer 命令行共用同一套攒批实现
+type ConsumerRun struct {
+	opts    ConsumerOptions
+	monitor *Monitor
+}
+
+// Result 一次运行的结果
+type Result struct {
+	Messages int64         // 处理 (生产端为发送成功) 的消息数
+	Bytes    int64         // 消息 payload 字节数
+	Errors   int64         // 生产端为发送失败，消费端为 payload 校验失败
+	Duration time.Duration // 第一条到最后一条消息
+	Summary  Summary       // 运行期间的内存汇总
+}
+
+// NewConsumerRun 校验参数并创建采样器，Run 时才连接 broker
+func NewConsumerRun(opts ConsumerOptions) (*ConsumerRun, error) {
+	if opts.Topic == "" {
+		return nil, errors.New("harness: Topic is required")
+	}
+	if opts.Messages < 0 || opts.IdleTimeout < 0 || opts.ReceiverQueueSize < 0 || opts.MemoryLimit < 0 || opts.BatchSize < 0 {
+		return nil, errors.New("harness: Messages, IdleTimeout, ReceiverQueueSize, MemoryLimit and BatchSize must be >= 0")
+	}
+	if opts.URL == "" {
+		opts.URL = DefaultURL
+	}
+	if opts.Subscription == "" {
+		opts.Subscription = "memory-test-sub"
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	if _, err := workload.ParseSubscriptionType(opts.SubscriptionType); err != nil {
+		return nil, fmt.Errorf("harness: %w", err)
+	}
+	r := &ConsumerRun{opts: opts}
+	opts.Monitor.Latency = true
+	monitor, err := NewMonitor(opts.Monitor)
+	if err != nil {
+		return nil, err
+	}
+	r.monitor = monitor
+	return r, nil
+}
+
+// Monitor 本次运行的采样器，可在 Run 之前 SetMetadata
+func (r *ConsumerRun) Monitor() *Monitor {
+	return r.monitor
+}
+
+// Run 订阅并消费到 Messages 条、空闲超过 IdleTimeout 或 ctx 取消为止；ctx 取消不算错误，
+// 返回已处理部分的结果 (未满的批次也会确认)
+func (r *ConsumerRun) Run(ctx context.Context) (Result, error) {
+	wr, err := workload.RunConsumer(ctx, workload.ConsumerConfig{
+		URL:               r.opts.URL,
+		Topic:             r.opts.Topic,
+		Subscription:      r.opts.Subscription,
+		SubscriptionType:  r.opts.SubscriptionType,
+		StartLatest:       r.opts.StartLatest,
+		ReceiverQueueSize: r.opts.ReceiverQueueSize,
+		MemoryLimit:       r.opts.MemoryLimit,
+		BatchSize:         r.opts.BatchSize,
+		MaxMessages:       r.opts.Messages,
+		ReleasePayload:    r.opts.ReleasePayload,
+		Verify:            true,
+		IdleTimeout:       r.opts.IdleTimeout,
+		SampleInterval:    r.monitor.interval,
+		Monitor:           r.monitor.m,
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("harness: %w", err)
+	}
+	res := Result{
+		Messages: wr.Summary.MessageCount,
+		Bytes:    wr.Summary.MessageBytes,
+		Errors:   wr.Summary.CorruptCount,
+		Duration: wr.Active,
+		Summary:  newSummary(wr.Summary),
+	}
+	if r.opts.StatsFile != "" {
+		if err := r.monitor.Save(r.opts.StatsFile); err != nil {
+			return res, fmt.Errorf("harness: save stats: %w", err)
+		}
+	}
+	return res, nil
+}
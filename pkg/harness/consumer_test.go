@@ -0,0 +1,98 @@
+package harness_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pulsar-memory-test/pkg/harness"
+	"pulsar-memory-test/pkg/mockbroker"
+)
+
+// startBroker 每个测试一个进程内 mockbroker，测试结束时关闭
+func startBroker(t *testing.T) string {
+	t.Helper()
+	b, err := mockbroker.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start mock broker: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b.URL()
+}
+
+// TestConsumerRun 消费 ProducerRun 写入的全部消息，payload 头校验通过，stats 文件写出
+func TestConsumerRun(t *testing.T) {
+	url := startBroker(t)
+	ctx := context.Background()
+	p, err := harness.NewProducerRun(harness.ProducerOptions{URL: url, Topic: "consume", Messages: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr, err := p.Run(ctx); err != nil || pr.Messages != 500 {
+		t.Fatalf("produce: %d messages, %v", pr.Messages, err)
+	}
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	c, err := harness.NewConsumerRun(harness.ConsumerOptions{
+		URL:       url,
+		Topic:     "consume",
+		Messages:  500,
+		BatchSize: 100 << 10,
+		StatsFile: stats,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Messages != 500 || res.Bytes != 500*harness.DefaultMessageSize || res.Errors != 0 {
+		t.Fatalf("consumed %d messages, %d bytes, %d errors; want 500, %d, 0",
+			res.Messages, res.Bytes, res.Errors, 500*harness.DefaultMessageSize)
+	}
+	if res.Summary.Messages != res.Messages || res.Summary.Samples == 0 {
+		t.Fatalf("summary: %d messages, %d samples", res.Summary.Messages, res.Summary.Samples)
+	}
+	if _, err := os.Stat(stats); err != nil {
+		t.Fatalf("stats file: %v", err)
+	}
+}
+
+// TestConsumerRunEmptyTopic Messages 为 0 时一条消息也收不到，IdleTimeout 从订阅起算后结束，不等 ctx 取消
+func TestConsumerRunEmptyTopic(t *testing.T) {
+	url := startBroker(t)
+	c, err := harness.NewConsumerRun(harness.ConsumerOptions{URL: url, Topic: "empty", IdleTimeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	res, err := c.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("Run returned only after ctx expired (%v)", time.Since(start))
+	}
+	if res.Messages != 0 || res.Duration != 0 {
+		t.Fatalf("empty topic: %d messages, duration %v", res.Messages, res.Duration)
+	}
+}
+
+// TestNewConsumerRunValidation 缺少 Topic、负数参数和未知订阅类型在 Run 之前报错
+func TestNewConsumerRunValidation(t *testing.T) {
+	for _, opts := range []harness.ConsumerOptions{
+		{},
+		{Topic: "t", Messages: -1},
+		{Topic: "t", BatchSize: -1},
+		{Topic: "t", SubscriptionType: "round_robin"},
+	} {
+		if _, err := harness.NewConsumerRun(opts); err == nil {
+			t.Errorf("NewConsumerRun(%+v) succeeded, want error", opts)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package harness 是本模块对外的 Go API：在其他项目的测试或工具中以代码方式运行内存测试，
+// 不必调用 producer/consumer 命令行。
+//
+// 兼容性承诺：本包导出的标识符按 semver 保持稳定，大版本内只增加 (新函数、Options/Summary 的新字段)，
+// 不删除、不改名、不改变已有字段的含义；Options 的零值始终是有效的默认值。
+// pkg 下的其他包 (metrics、payload、results 等) 是内部实现，随命令行工具的需要重构，
+// 外部代码不应直接依赖。
+//
+// 典型用法：
+//
+//	run, err := harness.NewConsumerRun(harness.ConsumerOptions{
+//		URL:      "pulsar://localhost:6650",
+//		Topic:    "persistent://public/default/memory-test",
+//		Messages: 100000,
+//	})
+//	if err != nil { ... }
+//	res, err := run.Run(ctx)
+//	fmt.Println(res.Summary.MaxRSS, res.Summary.HeapRatio)
+//
+// 只需要内存采样时 (被测代码不是 Pulsar 消费)，直接用 NewMonitor 并自行 RecordMessage。
+package harness
@@ -0,0 +1,127 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// DefaultSampleInterval MonitorOptions.Interval 为 0 时的采样间隔
+const DefaultSampleInterval = time.Second
+
+// MonitorOptions NewMonitor 的参数
+type MonitorOptions struct {
+	Interval time.Duration     // 采样间隔，0 为 DefaultSampleInterval
+	Labels   map[string]string // 写入 stats 文件的标签
+	Latency  bool              // 记录 RecordLatency 的端到端延迟分布
+}
+
+// Monitor 进程内存采样器：按间隔记录 HeapAlloc、RSS、GC 等，结束时汇总为 Summary，
+// 可保存为 producer/consumer 相同格式的 stats 文件 (compare 脚本、merge、bundle 均可读取)
+type Monitor struct {
+	m        *metrics.MemoryMonitor
+	interval time.Duration
+}
+
+// NewMonitor 创建采样器，Start 之后开始采样
+func NewMonitor(opts MonitorOptions) (*Monitor, error) {
+	if opts.Interval < 0 {
+		return nil, fmt.Errorf("harness: negative sample interval %v", opts.Interval)
+	}
+	m, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		return nil, err
+	}
+	m.SetLabels(opts.Labels)
+	if opts.Latency {
+		m.EnableLatency()
+	}
+	interval := opts.Interval
+	if interval == 0 {
+		interval = DefaultSampleInterval
+	}
+	return &Monitor{m: m, interval: interval}, nil
+}
+
+// Start 立即采集一个样本并在后台按间隔采样，直到 Stop 或 ctx 取消
+func (m *Monitor) Start(ctx context.Context) {
+	m.m.Start(ctx, m.interval)
+}
+
+// Stop 停止采样并采集最后一个样本
+func (m *Monitor) Stop() {
+	m.m.Stop()
+}
+
+// RecordMessage 记录处理了一条 bytes 字节的消息，用于计算内存放大倍数
+func (m *Monitor) RecordMessage(bytes int64) {
+	m.m.RecordMessage(bytes)
+}
+
+// RecordLatency 记录一条消息的端到端延迟，MonitorOptions.Latency 为 false 时忽略
+func (m *Monitor) RecordLatency(d time.Duration) {
+	m.m.RecordLatency(d)
+}
+
+// SetMetadata 附加写入 stats 文件 metadata 的键值
+func (m *Monitor) SetMetadata(key, value string) {
+	m.m.SetMetadata(key, value)
+}
+
+// Summary 到目前为止的汇总
+func (m *Monitor) Summary() Summary {
+	return newSummary(m.m.GetSummary())
+}
+
+// Save 保存 stats 文件 (含逐样本数据)，path 以 .gz 结尾时 gzip 压缩
+func (m *Monitor) Save(path string) error {
+	return m.m.Save(path, metrics.SamplesFull)
+}
+
+// Summary 一次运行的内存汇总，字段名和 JSON 名与 stats 文件的 summary 一致；大小为字节
+type Summary struct {
+	Duration     time.Duration `json:"duration"`
+	Samples      int           `json:"sample_count"`
+	Messages     int64         `json:"message_count"`
+	MessageBytes int64         `json:"message_bytes"`
+
+	MaxHeapAlloc   uint64  `json:"max_heap_alloc"`
+	AvgHeapAlloc   float64 `json:"avg_heap_alloc"`
+	FinalHeapAlloc uint64  `json:"final_heap_alloc"`
+	MaxRSS         uint64  `json:"max_rss"`
+	AvgRSS         float64 `json:"avg_rss"`
+	FinalRSS       uint64  `json:"final_rss"`
+	NumGC          uint32  `json:"num_gc"`
+
+	HeapRatio float64 `json:"heap_ratio"` // MaxHeapAlloc / MessageBytes
+	RSSRatio  float64 `json:"rss_ratio"`  // MaxRSS / MessageBytes
+
+	// 端到端延迟 (毫秒)，未记录延迟时为 0
+	LatencyP50Ms float64 `json:"latency_p50_ms,omitempty"`
+	LatencyP99Ms float64 `json:"latency_p99_ms,omitempty"`
+	LatencyMaxMs float64 `json:"latency_max_ms,omitempty"`
+}
+
+func newSummary(s metrics.MemorySummary) Summary {
+	out := Summary{
+		Duration:       s.Duration,
+		Samples:        s.SampleCount,
+		Messages:       s.MessageCount,
+		MessageBytes:   s.MessageBytes,
+		MaxHeapAlloc:   s.MaxHeapAlloc,
+		AvgHeapAlloc:   s.AvgHeapAlloc,
+		FinalHeapAlloc: s.FinalHeapAlloc,
+		MaxRSS:         s.MaxRSS,
+		AvgRSS:         s.AvgRSS,
+		FinalRSS:       s.FinalRSS,
+		NumGC:          s.NumGC,
+		HeapRatio:      s.HeapRatio,
+		RSSRatio:       s.RSSRatio,
+	}
+	if l := s.Latency; l != nil {
+		out.LatencyP50Ms, out.LatencyP99Ms, out.LatencyMaxMs = l.P50Ms, l.P99Ms, l.MaxMs
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pulsar-memory-test/pkg/workload"
+)
+
+// DefaultURL Options.URL 为空时的 Pulsar 服务地址
+const DefaultURL = "pulsar://localhost:6650"
+
+// DefaultMessageSize ProducerOptions.Size 为 0 时的消息大小
+const DefaultMessageSize = 1024
+
+// ProducerOptions NewProducerRun 的参数，零值字段取括号中的默认值
+type ProducerOptions struct {
+	URL   string // Pulsar 服务地址 (DefaultURL)
+	Topic string // 必填
+
+	Messages int64   // 发送的消息数，必填
+	Size     int     // 每条消息的字节数 (DefaultMessageSize)，不小于 payload 头时消息带头部，consumer 据此校验
+	Rate     float64 // 每秒最多发送的消息数 (0 = 不限速)
+
+	DisableBatching bool
+	MaxPending      int   // producer MaxPendingMessages (客户端默认)
+	MemoryLimit     int64 // 客户端内存上限字节数 (客户端默认 64MB)
+
+	Monitor   MonitorOptions // 内存采样
+	StatsFile string         // 非空时结束后把 stats 保存到该文件
+}
+
+// ProducerRun 一次生产测试：按速率发送消息并采样内存。
+// 发送逻辑就是 workload.RunProducer，payload 与 producer 命令行格式相同
+type ProducerRun struct {
+	opts    ProducerOptions
+	monitor *Monitor
+}
+
+// NewProducerRun 校验参数并创建采样器，Run 时才连接 broker
+func NewProducerRun(opts ProducerOptions) (*ProducerRun, error) {
+	if opts.Topic == "" || opts.Messages <= 0 {
+		return nil, errors.New("harness: Topic and Messages > 0 are required")
+	}
+	if opts.Size < 0 || opts.Rate < 0 || opts.MaxPending < 0 || opts.MemoryLimit < 0 {
+		return nil, errors.New("harness: Size, Rate, MaxPending and MemoryLimit must be >= 0")
+	}
+	if opts.URL == "" {
+		opts.URL = DefaultURL
+	}
+	if opts.Size == 0 {
+		opts.Size = DefaultMessageSize
+	}
+	monitor, err := NewMonitor(opts.Monitor)
+	if err != nil {
+		return nil, err
+	}
+	return &ProducerRun{opts: opts, monitor: monitor}, nil
+}
+
+// Monitor 本次运行的采样器，可在 Run 之前 SetMetadata
+func (r *ProducerRun) Monitor() *Monitor {
+	return r.monitor
+}
+
+// Run 发送 Messages 条消息并等待全部确认；ctx 取消时停止发送，返回已确认部分的结果
+func (r *ProducerRun) Run(ctx context.Context) (Result, error) {
+	wr, err := workload.RunProducer(ctx, workload.ProducerConfig{
+		URL:             r.opts.URL,
+		Topic:           r.opts.Topic,
+		Messages:        r.opts.Messages,
+		MessageSize:     r.opts.Size,
+		Rate:            r.opts.Rate,
+		DisableBatching: r.opts.DisableBatching,
+		MaxPending:      r.opts.MaxPending,
+		MemoryLimit:     r.opts.MemoryLimit,
+		Monitor:         r.monitor.m,
+		SampleInterval:  r.monitor.interval,
+	})
+	// ctx 取消不算错误
+	if err != nil && !errors.Is(err, ctx.Err()) {
+		return Result{}, fmt.Errorf("harness: %w", err)
+	}
+	res := Result{
+		Messages: wr.Messages,
+		Bytes:    wr.Bytes,
+		Errors:   wr.Errors,
+		Duration: wr.Duration,
+		Summary:  r.monitor.Summary(),
+	}
+	if r.opts.StatsFile != "" {
+		if err := r.monitor.Save(r.opts.StatsFile); err != nil {
+			return res, fmt.Errorf("harness: save stats: %w", err)
+		}
+	}
+	return res, nil
+}
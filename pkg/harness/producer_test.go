@@ -0,0 +1,50 @@
+package harness_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pulsar-memory-test/pkg/harness"
+)
+
+// TestProducerRun 发送 Messages 条并按 Rate 限速，汇总中的消息数与发送成功的条数一致
+func TestProducerRun(t *testing.T) {
+	url := startBroker(t)
+	p, err := harness.NewProducerRun(harness.ProducerOptions{URL: url, Topic: "produce", Messages: 50, Size: 256, Rate: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Messages != 50 || res.Bytes != 50*256 || res.Errors != 0 {
+		t.Fatalf("sent %d messages, %d bytes, %d errors; want 50, %d, 0", res.Messages, res.Bytes, res.Errors, 50*256)
+	}
+	// 第 50 条 (序号 49) 最早在 49/200 秒后发出
+	if res.Duration < 245*time.Millisecond {
+		t.Fatalf("50 messages at 200/s took %v, want >= 245ms", res.Duration)
+	}
+	if res.Summary.Messages != 50 {
+		t.Fatalf("summary has %d messages, want 50", res.Summary.Messages)
+	}
+}
+
+// TestProducerRunCanceled ctx 取消不算错误，返回已发送部分的结果
+func TestProducerRunCanceled(t *testing.T) {
+	url := startBroker(t)
+	p, err := harness.NewProducerRun(harness.ProducerOptions{URL: url, Topic: "cancel", Messages: 1000, Rate: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := p.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run after cancel: %v", err)
+	}
+	if res.Messages == 0 || res.Messages >= 1000 {
+		t.Fatalf("sent %d messages before cancel, want some but not all (%+v)", res.Messages, res)
+	}
+}
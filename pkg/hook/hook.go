@@ -0,0 +1,90 @@
+// Package hook 是 consumer 逐条消息处理插件 (-hook-plugin) 的接口。
+//
+// 插件是以 -buildmode=plugin 编译的 Go 包 (package main)，导出名为 NewProcessor 的构造函数:
+//
+//	func NewProcessor(config string) (hook.Processor, error)
+//
+// config 为 -hook-config 的原样内容。harness 对每条收到的消息调用 Processor.Process，
+// 根据返回的 Action 决定消息进入批次、立即确认丢弃还是 Nack；攒批、确认和内存统计仍由 harness 负责，
+// 插件只写业务逻辑，不需要 fork consumer。示例见 plugins/example。
+//
+// Go plugin 只能被同一工具链、同一版本依赖编译出的程序加载: 插件需要在本仓库中与 consumer 一起编译
+// (make build-hook-example)，且只支持 Linux/macOS 和开启 cgo 的构建。
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"plugin"
+	"time"
+)
+
+// Symbol 插件必须导出的构造函数名
+const Symbol = "NewProcessor"
+
+// Message 交给插件的一条消息。Payload 只在 Process 调用期间有效 (之后可能被 -release-payload 释放)，
+// 需要保留时自行复制；Properties 不应修改
+type Message struct {
+	Topic           string
+	Key             string
+	Properties      map[string]string
+	Payload         []byte
+	PublishTime     time.Time
+	RedeliveryCount uint32
+}
+
+// Action 处理结果
+type Action int
+
+const (
+	Keep Action = iota // 进入批次，由 harness 按批次处理和确认
+	Drop               // 立即确认、不进入批次，计入 filtered (与 -filter-ratio 相同)
+	Nack               // 立即 Nack，等待重投递
+)
+
+func (a Action) String() string {
+	switch a {
+	case Keep:
+		return "keep"
+	case Drop:
+		return "drop"
+	case Nack:
+		return "nack"
+	default:
+		return fmt.Sprintf("action(%d)", int(a))
+	}
+}
+
+// Processor 逐条消息的处理逻辑。返回 error 时消息按 Nack 处理；
+// -fanout 时多个订阅的消费 goroutine 会并发调用 Process。
+// 实现 io.Closer 时 consumer 结束消费后调用 Close
+type Processor interface {
+	Process(msg *Message) (Action, error)
+}
+
+// Constructor 插件导出的 NewProcessor 的类型
+type Constructor = func(config string) (Processor, error)
+
+// Load 打开 path 处的插件并以 config 调用其 NewProcessor
+func Load(path, config string) (Processor, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(Symbol)
+	if err != nil {
+		return nil, err
+	}
+	newProcessor, ok := sym.(Constructor)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s has type %T, want func(string) (hook.Processor, error)", path, Symbol, sym)
+	}
+	proc, err := newProcessor(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", Symbol, err)
+	}
+	if proc == nil {
+		return nil, errors.New(Symbol + " returned a nil Processor")
+	}
+	return proc, nil
+}
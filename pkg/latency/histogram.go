@@ -0,0 +1,171 @@
+// Package latency 端到端和批次处理延迟的直方图
+//
+// Histogram 是 HDR 风格的对数线性直方图: 以微秒计，0-63µs 每微秒一个桶，
+// 之后每个 2 的幂区间等分为 64 个桶，任意值的相对误差不超过 1/64 (约 1.6%)，
+// 上限约 2^41µs (25 天)，总共 2304 个桶 (18 KB)。Record 只做原子加，不分配内存，
+// 可以在每条消息的处理路径上调用；Interval 给出两次调用之间的分布，用于逐秒样本。
+package latency
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	subBucketBits = 6
+	subBuckets    = 1 << subBucketBits // 每个 2 的幂区间的线性桶数
+	maxExponent   = 35                 // 最大值约 2^41 µs
+	bucketCount   = subBuckets + maxExponent*subBuckets
+)
+
+// bucketIndex 微秒值所在的桶
+func bucketIndex(us uint64) int {
+	if us < subBuckets {
+		return int(us)
+	}
+	exp := bits.Len64(us) - subBucketBits - 1 // us>>exp 落在 [subBuckets, 2*subBuckets)
+	if exp >= maxExponent {
+		return bucketCount - 1
+	}
+	return subBuckets + exp*subBuckets + int(us>>exp) - subBuckets
+}
+
+// bucketUpper 桶中最大的微秒值，分位数按桶上界报告 (与 HDR 的 highest equivalent value 相同)
+func bucketUpper(i int) uint64 {
+	if i < subBuckets {
+		return uint64(i)
+	}
+	exp := (i - subBuckets) / subBuckets
+	sub := uint64((i-subBuckets)%subBuckets + subBuckets)
+	return (sub+1)<<exp - 1
+}
+
+// Histogram 并发安全的延迟直方图，零值不可用，用 New 创建
+type Histogram struct {
+	counts      [bucketCount]atomic.Int64
+	sum         atomic.Int64 // µs
+	max         atomic.Int64 // µs
+	intervalMax atomic.Int64 // 上次 Interval 以来的最大值 (µs)
+
+	mu   sync.Mutex
+	prev Snapshot // 上次 Interval 时的累计值
+}
+
+// New 创建直方图
+func New() *Histogram {
+	return &Histogram{}
+}
+
+// Record 记录一个延迟，负值 (时钟偏差) 记为 0
+func (h *Histogram) Record(d time.Duration) {
+	us := max(d.Microseconds(), 0)
+	h.counts[bucketIndex(uint64(us))].Add(1)
+	h.sum.Add(us)
+	storeMax(&h.max, us)
+	storeMax(&h.intervalMax, us)
+}
+
+func storeMax(v *atomic.Int64, x int64) {
+	for {
+		cur := v.Load()
+		if x <= cur || v.CompareAndSwap(cur, x) {
+			return
+		}
+	}
+}
+
+// Snapshot 某一时刻的累计分布，或 Interval 返回的区间分布
+type Snapshot struct {
+	counts []int64
+	Count  int64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+// Snapshot 返回自创建以来的累计分布；Count 取各桶之和，与并发的 Record 之间不需要额外同步
+func (h *Histogram) Snapshot() Snapshot {
+	s := Snapshot{
+		counts: make([]int64, bucketCount),
+		Sum:    time.Duration(h.sum.Load()) * time.Microsecond,
+		Max:    time.Duration(h.max.Load()) * time.Microsecond,
+	}
+	for i := range h.counts {
+		s.counts[i] = h.counts[i].Load()
+		s.Count += s.counts[i]
+	}
+	return s
+}
+
+// Interval 返回上次调用 Interval 以来的分布，第一次调用返回自创建以来的分布
+func (h *Histogram) Interval() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cur := h.Snapshot()
+	out := Snapshot{
+		counts: make([]int64, bucketCount),
+		Count:  cur.Count - h.prev.Count,
+		Sum:    cur.Sum - h.prev.Sum,
+		Max:    time.Duration(h.intervalMax.Swap(0)) * time.Microsecond,
+	}
+	for i := range cur.counts {
+		out.counts[i] = cur.counts[i]
+		if h.prev.counts != nil {
+			out.counts[i] -= h.prev.counts[i]
+		}
+	}
+	h.prev = cur
+	return out
+}
+
+// Quantile 返回 q (0-1) 分位数，按桶上界估算且不超过 Max；没有数据时为 0
+func (s Snapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	target := int64(q * float64(s.Count))
+	var cum int64
+	for i, c := range s.counts {
+		cum += c
+		if cum > target || cum == s.Count {
+			return min(time.Duration(bucketUpper(i))*time.Microsecond, s.Max)
+		}
+	}
+	return s.Max
+}
+
+// Summary 延迟分布的摘要，写入 stats JSON
+type Summary struct {
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// Summary 计算摘要，没有数据时返回 nil
+func (s Snapshot) Summary() *Summary {
+	if s.Count == 0 {
+		return nil
+	}
+	return &Summary{
+		Count:  s.Count,
+		MeanMs: ms(s.Sum) / float64(s.Count),
+		P50Ms:  ms(s.Quantile(0.5)),
+		P95Ms:  ms(s.Quantile(0.95)),
+		P99Ms:  ms(s.Quantile(0.99)),
+		MaxMs:  ms(s.Max),
+	}
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("p50 %.3f ms, p95 %.3f ms, p99 %.3f ms, max %.3f ms | mean %.3f ms over %d",
+		s.P50Ms, s.P95Ms, s.P99Ms, s.MaxMs, s.MeanMs, s.Count)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// AckStats AckWithResponse 开启时的确认耗时；确认返回前消息结构一直被批次持有
+type AckStats struct {
+	Acks       int64   `json:"acks"`
+	Errors     int64   `json:"errors"`
+	AvgMs      float64 `json:"avg_ms"` // 单次 Ack 往返
+	MaxMs      float64 `json:"max_ms"`
+	Batches    int64   `json:"batches"`
+	BatchAvgMs float64 `json:"batch_avg_ms"` // 每批次确认全部消息的总耗时
+	BatchMaxMs float64 `json:"batch_max_ms"`
+
+	total      time.Duration
+	max        time.Duration
+	batchTotal time.Duration
+	batchMax   time.Duration
+}
+
+// RecordAck 记录一次 Ack 往返耗时
+func (m *MemoryMonitor) RecordAck(d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := &m.ack
+	a.Acks++
+	if err != nil {
+		a.Errors++
+	}
+	a.total += d
+	a.max = max(a.max, d)
+}
+
+// RecordPendingAcks 调整推迟中的确认数: 推迟一个批次的确认时加上其消息数，发出后减去
+func (m *MemoryMonitor) RecordPendingAcks(n int64) {
+	m.counters.pendingAcks.Add(n)
+}
+
+// RecordBatchAck 记录一个批次确认全部消息的总耗时
+func (m *MemoryMonitor) RecordBatchAck(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := &m.ack
+	a.Batches++
+	a.batchTotal += d
+	a.batchMax = max(a.batchMax, d)
+}
+
+// ackStats 生成确认耗时统计，没有记录时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) ackStats() *AckStats {
+	if m.ack.Acks == 0 {
+		return nil
+	}
+	a := m.ack
+	a.AvgMs = ms(a.total) / float64(a.Acks)
+	a.MaxMs = ms(a.max)
+	if a.Batches > 0 {
+		a.BatchAvgMs = ms(a.batchTotal) / float64(a.Batches)
+		a.BatchMaxMs = ms(a.batchMax)
+	}
+	return &a
+}
+
+// String 一行摘要
+func (a *AckStats) String() string {
+	return fmt.Sprintf("%d acks (%d errors) | avg %.3f ms, max %.3f ms | per batch avg %.1f ms, max %.1f ms",
+		a.Acks, a.Errors, a.AvgMs, a.MaxMs, a.BatchAvgMs, a.BatchMaxMs)
+}
+
+// AckFlushCause 确认批次发出的原因
+type AckFlushCause int
+
+const (
+	AckFlushSize     AckFlushCause = iota // 达到 -ack-batch-size
+	AckFlushTimer                         // 最早的确认已等待 -ack-batch-interval
+	AckFlushShutdown                      // 消费结束时发出剩余的确认
+)
+
+// AckBatchStats 确认批次: 确认与处理批次解耦，攒到一定数量或等待一定时间后一起发出
+type AckBatchStats struct {
+	Flushes    int64   `json:"flushes"`
+	Acks       int64   `json:"acks"`
+	BySize     int64   `json:"by_size"`
+	ByTimer    int64   `json:"by_timer"`
+	AtShutdown int64   `json:"at_shutdown,omitempty"`
+	AvgSize    float64 `json:"avg_size"`
+	AvgAgeMs   float64 `json:"avg_age_ms"` // 发出时批次中最早的确认已等待的时长
+	MaxAgeMs   float64 `json:"max_age_ms"`
+
+	totalAge time.Duration
+	maxAge   time.Duration
+}
+
+// RecordBufferedAcks 调整确认批次中等待发出的确认数: 加入时加一，批次发出后减去其大小
+func (m *MemoryMonitor) RecordBufferedAcks(n int64) {
+	m.counters.bufferedAcks.Add(n)
+}
+
+// RecordAckFlush 记录发出一个 n 条确认的批次，age 为其中最早的确认等待的时长
+func (m *MemoryMonitor) RecordAckFlush(n int, age time.Duration, cause AckFlushCause) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := &m.ackBatches
+	b.Flushes++
+	b.Acks += int64(n)
+	switch cause {
+	case AckFlushSize:
+		b.BySize++
+	case AckFlushTimer:
+		b.ByTimer++
+	case AckFlushShutdown:
+		b.AtShutdown++
+	}
+	b.totalAge += age
+	b.maxAge = max(b.maxAge, age)
+}
+
+// ackBatchStats 生成确认批次统计，没有记录时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) ackBatchStats() *AckBatchStats {
+	if m.ackBatches.Flushes == 0 {
+		return nil
+	}
+	b := m.ackBatches
+	b.AvgSize = float64(b.Acks) / float64(b.Flushes)
+	b.AvgAgeMs = ms(b.totalAge) / float64(b.Flushes)
+	b.MaxAgeMs = ms(b.maxAge)
+	return &b
+}
+
+// String 一行摘要
+func (b *AckBatchStats) String() string {
+	return fmt.Sprintf("%d flushes of %d acks (avg %.1f) | by size %d, by timer %d, at shutdown %d | oldest ack waited avg %.1f ms, max %.1f ms",
+		b.Flushes, b.Acks, b.AvgSize, b.BySize, b.ByTimer, b.AtShutdown, b.AvgAgeMs, b.MaxAgeMs)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"log"
+	"strings"
+)
+
+// AckHoleStats 批次索引确认 (EnableBatchIndexAcknowledgment) 下的确认空洞检查 (consumer -check-ack-holes):
+// 一个批次 entry 的部分索引已确认，其余索引在退出时仍未确认时，broker 会一直保留整个 entry，
+// 订阅的 mark-delete 位置停在这里。Holes 只计收到后既没有确认成功、也没有按 -ack-ratio 跳过或 Nack 的索引
+type AckHoleStats struct {
+	Entries     int64    `json:"entries"`            // 收到过的批次 entry (BatchSize > 1)
+	Complete    int64    `json:"complete"`           // 全部索引都已确认
+	Partial     int64    `json:"partial"`            // 退出时部分索引已确认
+	Holes       int64    `json:"holes"`              // Partial 中收到却未确认的索引
+	AckFailed   int64    `json:"ack_failed"`         // Holes 中 Ack 返回错误的
+	Skipped     int64    `json:"skipped"`            // Partial 中按 -ack-ratio 故意不确认的索引
+	Nacked      int64    `json:"nacked"`             // Partial 中 Nack 之后退出前没有再收到的索引
+	NotReceived int64    `json:"not_received"`       // Partial 中从未交给批处理的索引 (退出时仍在接收队列中)
+	Examples    []string `json:"examples,omitempty"` // 最多 10 个有空洞的 entry: ledger:entry 和未确认的索引
+}
+
+// SetAckHoles 设置退出时的确认空洞检查结果，随统计数据一起保存
+func (m *MemoryMonitor) SetAckHoles(s *AckHoleStats) {
+	m.mu.Lock()
+	m.ackHoles = s
+	m.mu.Unlock()
+}
+
+// printAckHoles 打印确认空洞检查结果，未检查时不打印
+func printAckHoles(s *AckHoleStats) {
+	if s == nil {
+		return
+	}
+	log.Printf("  Ack holes:     %d in %d partially acked of %d batched entries (%d complete) | ack failed %d, skipped %d, nacked %d, not received %d",
+		s.Holes, s.Partial, s.Entries, s.Complete, s.AckFailed, s.Skipped, s.Nacked, s.NotReceived)
+	if len(s.Examples) > 0 {
+		log.Printf("    e.g. %s", strings.Join(s.Examples, "; "))
+	}
+}
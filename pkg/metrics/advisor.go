@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 建议的阈值
+const (
+	minQueueSize     = 100     // 建议的 ReceiverQueueSize 下限，更小时 broker 往返会直接暴露给 Receive
+	minAdviceSaving  = 1 << 20 // 节省低于 1MB 的建议不输出
+	batchShareAdvice = 0.5     // 批次占预测存活堆的比例超过此值时建议减小 -batch-size
+	gcCPUAdvice      = 0.05    // GC CPU 占比低于此值时才建议调低 GOGC
+	adviceGOGC       = 50
+)
+
+// Advice 一条 what-if 建议，SavingBytes 为按内存模型估算的峰值堆减少量
+type Advice struct {
+	Setting     string `json:"setting"` // 对应的 flag
+	Current     string `json:"current"`
+	Suggested   string `json:"suggested"`
+	SavingBytes int64  `json:"saving_bytes"`
+	Text        string `json:"text"`
+}
+
+// advise 基于内存模型和本次运行的分布生成建议，按节省量从大到小排序；没有模型时返回 nil。
+// 调用方持有读锁，summary 中的 Model、Receive、MessageSizes 和 GC 字段应已填好
+func (m *MemoryMonitor) advise(summary *MemorySummary) []Advice {
+	cfg, r := m.model, summary.Model
+	if cfg == nil || r == nil || r.BytesPerMessage <= 0 {
+		return nil
+	}
+	consumers := float64(cfg.consumers())
+	factor := 1.0 // 存活堆到峰值堆的放大
+	if r.GOGC > 0 {
+		factor = 1 + float64(r.GOGC)/100
+	}
+	size := sizeLabel(int64(r.AvgMessageSize))
+	if s := summary.MessageSizes; s != nil && float64(s.P99) > 4*r.AvgMessageSize {
+		size += fmt.Sprintf(" (p99 %s)", sizeLabel(s.P99))
+	}
+	var out []Advice
+
+	// ReceiverQueueSize: 处理是瓶颈 (client-queued) 时队列始终是满的，缩小它不影响吞吐；
+	// broker-starved 时队列基本是空的，按观测到的最大占用留出余量
+	if q := cfg.QueueSize; q > minQueueSize && summary.Receive != nil {
+		target := 0
+		switch summary.Receive.Verdict {
+		case "client-queued":
+			target = max(q/5, minQueueSize)
+		case "broker-starved":
+			if summary.Queue != nil {
+				target = max(roundUp(int(float64(summary.Queue.MaxMessages)/consumers*1.25), 10), minQueueSize)
+			}
+		}
+		if target > 0 && target < q {
+			saving := float64(q-target) * consumers * r.BytesPerMessage * factor
+			out = append(out, Advice{
+				Setting: "queue-size", Current: fmt.Sprint(q), Suggested: fmt.Sprint(target), SavingBytes: int64(saving),
+				Text: fmt.Sprintf("reducing ReceiverQueueSize from %d to %d would cut estimated buffer memory by ~%.0f MB given your %s messages (Receive verdict: %s)",
+					q, target, saving/1024/1024, size, summary.Receive.Verdict),
+			})
+		}
+	}
+
+	// -batch-size: 批次占预测存活堆的大头时，减半批次的效果最直接，代价是批次数 (处理和 ack 次数) 翻倍
+	if cfg.BatchBytes > 0 && r.PredictedLive > 0 {
+		batch := float64(cfg.BatchBytes) / r.AvgMessageSize * r.BytesPerMessage * consumers
+		if share := batch / float64(r.PredictedLive); share > batchShareAdvice {
+			saving := batch / 2 * factor
+			out = append(out, Advice{
+				Setting: "batch-size", Current: fmt.Sprint(cfg.BatchBytes), Suggested: fmt.Sprint(cfg.BatchBytes / 2), SavingBytes: int64(saving),
+				Text: fmt.Sprintf("halving -batch-size from %.0f MB to %.0f MB would cut estimated peak heap by ~%.0f MB (batches hold %.0f%% of predicted live heap; twice as many batches)",
+					float64(cfg.BatchBytes)/1024/1024, float64(cfg.BatchBytes)/2/1024/1024, saving/1024/1024, share*100),
+			})
+		}
+	}
+
+	// -release-payload: 拟合的每条开销仍包含大部分 payload，说明 payload 一直保留到批次确认
+	if !cfg.ReleasePayload && !cfg.RetainIDOnly && cfg.BatchBytes > 0 && r.OverheadPerMessage > -r.AvgMessageSize/2 {
+		saving := float64(cfg.BatchBytes) * consumers * factor
+		out = append(out, Advice{
+			Setting: "release-payload", Current: "false", Suggested: "true", SavingBytes: int64(saving),
+			Text: fmt.Sprintf("releasing payloads after processing (-release-payload) would free ~%.0f MB of %s payloads held until the batch is acked",
+				saving/1024/1024, size),
+		})
+	}
+
+	// GOGC: GC CPU 占比低时可以用更多 GC 换更低的峰值
+	if r.GOGC > adviceGOGC && summary.GCCPUFraction < gcCPUAdvice {
+		saving := float64(r.PredictedLive) * float64(r.GOGC-adviceGOGC) / 100
+		out = append(out, Advice{
+			Setting: "gc-percent", Current: fmt.Sprint(r.GOGC), Suggested: fmt.Sprint(adviceGOGC), SavingBytes: int64(saving),
+			Text: fmt.Sprintf("lowering GOGC from %d to %d would cut the heap goal by ~%.0f MB; GC currently uses %.1f%% CPU and would run ~%.1fx as often",
+				r.GOGC, adviceGOGC, saving/1024/1024, summary.GCCPUFraction*100, float64(r.GOGC)/adviceGOGC),
+		})
+	}
+
+	out = filterAdvice(out)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].SavingBytes > out[j].SavingBytes })
+	return out
+}
+
+// filterAdvice 去掉节省量太小的建议
+func filterAdvice(in []Advice) []Advice {
+	out := in[:0]
+	for _, a := range in {
+		if a.SavingBytes >= minAdviceSaving {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func roundUp(n, step int) int {
+	return (n + step - 1) / step * step
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import "fmt"
+
+// BatchPhase 批次生命周期中测量内存的时间点
+type BatchPhase int
+
+const (
+	PhaseBuffered   BatchPhase = iota // 消息已累积进批次、处理开始前
+	PhaseProcessing                   // 处理和确认完成、批次释放前
+	PhasePostAck                      // 批次释放并按 -gc-after-batch GC 之后
+	batchPhaseCount
+)
+
+var batchPhaseNames = [batchPhaseCount]string{"buffered", "processing", "post_ack"}
+
+func (p BatchPhase) String() string {
+	if p < 0 || p >= batchPhaseCount {
+		return fmt.Sprintf("BatchPhase(%d)", int(p))
+	}
+	return batchPhaseNames[p]
+}
+
+// PhaseAmplification 一个批次阶段的内存放大倍数: 该时刻的 HeapAlloc/RSS 除以批次的 payload 字节数，
+// 按批次取平均和最大。比较三个阶段可以看出倍数是在消息累积时、处理时还是确认后仍未释放时产生的
+type PhaseAmplification struct {
+	Phase        string  `json:"phase"`
+	Batches      int     `json:"batches"`
+	AvgHeapAlloc float64 `json:"avg_heap_alloc"`
+	AvgHeapRatio float64 `json:"avg_heap_ratio"`
+	MaxHeapRatio float64 `json:"max_heap_ratio"`
+	AvgRSSRatio  float64 `json:"avg_rss_ratio"`
+	MaxRSSRatio  float64 `json:"max_rss_ratio"`
+}
+
+// phaseAmp 一个阶段的累计值，逐批次只累加，不保存每个批次
+type phaseAmp struct {
+	batches   int
+	heap      float64
+	heapRatio float64
+	maxHeap   float64
+	rssRatio  float64
+	maxRSS    float64
+}
+
+// RecordBatchPhase 记录批次在 phase 时的内存，batchBytes 为批次中消息的 payload 字节数，
+// s 取自 Collect 或 Point。批次为空时忽略
+func (m *MemoryMonitor) RecordBatchPhase(phase BatchPhase, batchBytes int64, s MemoryStats) {
+	if batchBytes <= 0 || phase < 0 || phase >= batchPhaseCount {
+		return
+	}
+	heap := float64(s.HeapAlloc) / float64(batchBytes)
+	rss := float64(s.RSS) / float64(batchBytes)
+	m.mu.Lock()
+	a := &m.batchPhases[phase]
+	a.batches++
+	a.heap += float64(s.HeapAlloc)
+	a.heapRatio += heap
+	a.maxHeap = max(a.maxHeap, heap)
+	a.rssRatio += rss
+	a.maxRSS = max(a.maxRSS, rss)
+	m.mu.Unlock()
+}
+
+// batchPhaseStats 各阶段的放大倍数，没有 RecordBatchPhase 时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) batchPhaseStats() []PhaseAmplification {
+	var out []PhaseAmplification
+	for i, a := range m.batchPhases {
+		if a.batches == 0 {
+			continue
+		}
+		n := float64(a.batches)
+		out = append(out, PhaseAmplification{
+			Phase:        BatchPhase(i).String(),
+			Batches:      a.batches,
+			AvgHeapAlloc: a.heap / n,
+			AvgHeapRatio: a.heapRatio / n,
+			MaxHeapRatio: a.maxHeap,
+			AvgRSSRatio:  a.rssRatio / n,
+			MaxRSSRatio:  a.maxRSS,
+		})
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// ConfigChange 审计日志的一行: 运行中 harness 对自身行为的一次修改 (暂停/恢复接收、seek、切换压缩方式等)。
+// 启动时由 flag 决定的配置在 metadata 的 flag.* 中，不在此记录
+type ConfigChange struct {
+	Seq     int       `json:"seq"` // 从 1 开始，按发生顺序
+	Time    time.Time `json:"time"`
+	Elapsed float64   `json:"elapsed"` // 单调时钟上距 monitor 启动的秒数，与样本的 elapsed 对应
+	Setting string    `json:"setting"`
+	Old     string    `json:"old,omitempty"`
+	New     string    `json:"new"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// RecordChange 记录一次运行中的配置修改并打印到日志，可并发调用
+func (m *MemoryMonitor) RecordChange(setting, old, new, reason string) {
+	now := m.clock.Now()
+	m.mu.Lock()
+	c := ConfigChange{
+		Seq:     len(m.changes) + 1,
+		Time:    now,
+		Elapsed: now.Sub(m.startTime).Seconds(),
+		Setting: setting,
+		Old:     old,
+		New:     new,
+		Reason:  reason,
+	}
+	m.changes = append(m.changes, c)
+	m.mu.Unlock()
+	log.Printf("Config change #%d: %s %q -> %q (%s)", c.Seq, setting, old, new, reason)
+}
+
+// GetChanges 按发生顺序返回记录的配置修改
+func (m *MemoryMonitor) GetChanges() []ConfigChange {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]ConfigChange(nil), m.changes...)
+}
+
+// SaveAuditLog 把配置修改按顺序写成 JSON Lines，分析时据此还原 harness 在运行中做了什么；
+// 没有修改时也写出空文件，表示运行期间配置未变
+func (m *MemoryMonitor) SaveAuditLog(filename string) error {
+	changes := m.GetChanges()
+	return results.WriteFile(filename, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, c := range changes {
+			if err := enc.Encode(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
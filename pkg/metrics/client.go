@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ClientMetrics 收集 pulsar-client-go 内部的 Prometheus 指标
+// (receiver queue 预取量、pending 消息、连接数、lookup 次数等)
+//
+// 使用独立的 Registry 而不是全局默认 Registry，避免混入 Go runtime 等无关指标
+type ClientMetrics struct {
+	registry *prometheus.Registry
+	labels   prometheus.Labels
+}
+
+// NewClientMetrics 创建客户端指标收集器
+func NewClientMetrics() *ClientMetrics {
+	return NewLabeledClientMetrics(nil)
+}
+
+// NewLabeledClientMetrics 创建客户端指标收集器，labels 作为常量 label 加到之后注册的全部指标上
+func NewLabeledClientMetrics(labels map[string]string) *ClientMetrics {
+	return &ClientMetrics{registry: prometheus.NewRegistry(), labels: labels}
+}
+
+// Registerer 传给 pulsar.ClientOptions.MetricsRegisterer
+func (c *ClientMetrics) Registerer() prometheus.Registerer {
+	if len(c.labels) > 0 {
+		return prometheus.WrapRegistererWith(c.labels, c.registry)
+	}
+	return c.registry
+}
+
+// Gatherer 供推送导出 (Pushgateway、StatsD) 读取全部指标
+func (c *ClientMetrics) Gatherer() prometheus.Gatherer {
+	return c.registry
+}
+
+// Handler 以 Prometheus 文本格式暴露客户端指标
+func (c *ClientMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
+}
+
+// Snapshot 按指标名汇总所有 label 组合的当前值；histogram/summary 记录 _count 和 _sum
+func (c *ClientMetrics) Snapshot() map[string]float64 {
+	families, err := c.registry.Gather()
+	if err != nil && len(families) == 0 {
+		return nil
+	}
+	result := make(map[string]float64, len(families))
+	for _, mf := range families {
+		name := mf.GetName()
+		// 同一 Registry 中注册的监控器指标不属于客户端
+		if strings.HasPrefix(name, monitorMetricPrefix) {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				result[name] += m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				result[name] += m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				result[name] += m.GetUntyped().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				result[name+"_count"] += float64(m.GetHistogram().GetSampleCount())
+				result[name+"_sum"] += m.GetHistogram().GetSampleSum()
+			case dto.MetricType_SUMMARY:
+				result[name+"_count"] += float64(m.GetSummary().GetSampleCount())
+				result[name+"_sum"] += m.GetSummary().GetSampleSum()
+			}
+		}
+	}
+	return result
+}
+
+// ClientSample 每次采样记录的客户端关键指标，与进程内存放在一起便于对照
+type ClientSample struct {
+	PrefetchedMessages float64 `json:"prefetched_messages"` // receiver queue 中的消息数
+	PrefetchedBytes    float64 `json:"prefetched_bytes"`    // receiver queue 中的字节数
+	PendingMessages    float64 `json:"pending_messages"`    // 生产者待确认消息数
+	PendingBytes       float64 `json:"pending_bytes"`       // 生产者待确认字节数
+	Connections        float64 `json:"connections"`         // 当前连接数 (opened - closed)
+	Lookups            float64 `json:"lookups"`             // 累计 lookup 次数
+}
+
+// MemoryUsed 客户端按 MemoryLimitBytes 预留的内存的估算: consumer 为收到的消息预留 (prefetched)，
+// producer 为待确认的消息预留 (pending)；客户端不导出预留量本身
+func (c *ClientSample) MemoryUsed() float64 {
+	return c.PrefetchedBytes + c.PendingBytes
+}
+
+func newClientSample(s map[string]float64) *ClientSample {
+	return &ClientSample{
+		PrefetchedMessages: s["pulsar_client_consumer_prefetched_messages"],
+		PrefetchedBytes:    s["pulsar_client_consumer_prefetched_bytes"],
+		PendingMessages:    s["pulsar_client_producer_pending_messages"],
+		PendingBytes:       s["pulsar_client_producer_pending_bytes"],
+		Connections:        s["pulsar_client_connections_opened"] - s["pulsar_client_connections_closed"],
+		Lookups:            s["pulsar_client_lookup_count"],
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"pulsar-memory-test/pkg/clock"
+)
+
+// ClockGapThreshold 相邻样本之间墙钟与单调时钟的差超过这个值时，样本流标记为不连续 (MemoryStats.GapMs)
+//
+// Go 的单调时钟在 Linux (CLOCK_MONOTONIC)、macOS 和 Windows 上都不计入系统休眠/挂起的时间，
+// 也不受 NTP 跳变和手动调整墙钟的影响。笔记本上的运行合盖休眠后，墙钟前进了几十分钟而单调时钟没有，
+// 按墙钟算出的消息速率、GC 频率和追赶速度在这一段都是错的。所有时长因此按单调时钟计算，
+// 两者之差只用来发现不连续。
+const ClockGapThreshold = time.Second
+
+// 元数据中的时钟锚点: clock.start_wall 为 MemoryStats.Elapsed 的零点，
+// clock.end_wall 与 clock.end_elapsed 为保存时同一时刻的墙钟和单调时钟读数，
+// 两者与 start_wall 的差额即整个运行中休眠/墙钟调整的总量
+const (
+	metaStartWall  = "clock.start_wall"
+	metaEndWall    = "clock.end_wall"
+	metaEndElapsed = "clock.end_elapsed"
+)
+
+// clockGap s 与上一个样本 prev 之间墙钟比单调时钟多走的毫秒数 (墙钟被往回调时为负)，未超过 ClockGapThreshold 时为 0
+//
+// 两个样本都带有进程内的单调时钟读数；Round(0) 去掉单调读数后 Sub 得到墙钟之差
+func clockGap(prev, s *MemoryStats) int64 {
+	wall := s.Timestamp.Round(0).Sub(prev.Timestamp.Round(0))
+	gap := wall - s.Timestamp.Sub(prev.Timestamp)
+	if gap.Abs() < ClockGapThreshold {
+		return 0
+	}
+	return gap.Milliseconds()
+}
+
+// SampleSeconds prev 到 s 的秒数，按单调时钟 (Elapsed) 计算；
+// 从文件读出的旧样本没有 Elapsed 时退回墙钟之差
+func SampleSeconds(prev, s *MemoryStats) float64 {
+	if s.Elapsed > 0 || prev.Elapsed > 0 {
+		return s.Elapsed - prev.Elapsed
+	}
+	return s.Timestamp.Sub(prev.Timestamp).Seconds()
+}
+
+// clockGapStats 样本流中的不连续次数和墙钟多走的总毫秒数
+func clockGapStats(samples []MemoryStats) (n int, ms int64) {
+	for i := range samples {
+		if g := samples[i].GapMs; g != 0 {
+			n++
+			ms += g
+		}
+	}
+	return n, ms
+}
+
+// SetClock 替换采样周期、样本时间戳和各种记录时间的来源 (默认 clock.Real)，并以 c 的当前时间为起点；
+// 应在 Start 和第一次记录之前调用。测试用 clock.Fake 推进时间即可确定地得到样本、rollup 和摘要中的时长。
+// 采样自身的耗时 (Overhead) 仍按真实时间测量
+func (m *MemoryMonitor) SetClock(c clock.Clock) {
+	start := c.Now()
+	m.mu.Lock()
+	m.clock = c
+	m.startTime = start
+	m.metadata[metaStartWall] = start.Format(time.RFC3339Nano)
+	m.mu.Unlock()
+}
+
+// Clock 采样使用的时钟，同一次运行中与采样对齐的定时器 (进度输出、确认攒批) 也应使用它
+func (m *MemoryMonitor) Clock() clock.Clock {
+	return m.clock
+}
+
+// setClockMetadata 记录结束时的时钟锚点，保存 stats 时调用
+func (m *MemoryMonitor) setClockMetadata() {
+	now := m.clock.Now()
+	m.SetMetadata(metaEndWall, now.Format(time.RFC3339Nano))
+	m.SetMetadata(metaEndElapsed, strconv.FormatFloat(now.Sub(m.startTime).Seconds(), 'f', 3, 64))
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// monitorMetricPrefix 监控器导出指标的名称前缀
+const monitorMetricPrefix = "pulsar_memtest_"
+
+// monitorCollector 以 Prometheus 指标暴露最近一次采样，计数器直接读取原子值
+type monitorCollector struct {
+	m *MemoryMonitor
+}
+
+var (
+	descHeapAlloc = prometheus.NewDesc(monitorMetricPrefix+"heap_alloc_bytes", "HeapAlloc at the last sample", nil, nil)
+	descHeapInuse = prometheus.NewDesc(monitorMetricPrefix+"heap_inuse_bytes", "HeapInuse at the last sample", nil, nil)
+	descRSS       = prometheus.NewDesc(monitorMetricPrefix+"rss_bytes", "Process RSS at the last sample", nil, nil)
+	descNumGC     = prometheus.NewDesc(monitorMetricPrefix+"gc_cycles_total", "Completed GC cycles at the last sample", nil, nil)
+	descLag       = prometheus.NewDesc(monitorMetricPrefix+"lag_seconds", "Time since the publish time of the latest consumed message at the last sample", nil, nil)
+	descMessages  = prometheus.NewDesc(monitorMetricPrefix+"messages_total", "Messages processed", nil, nil)
+	descBytes     = prometheus.NewDesc(monitorMetricPrefix+"message_bytes_total", "Payload bytes processed", nil, nil)
+	descBatches   = prometheus.NewDesc(monitorMetricPrefix+"batches_total", "Batches processed", nil, nil)
+	descQueued    = prometheus.NewDesc(monitorMetricPrefix+"queued_messages", "Estimated messages buffered in the receiver queue at the last sample", nil, nil)
+	descMemLimit  = prometheus.NewDesc(monitorMetricPrefix+"client_memory_limit_bytes", "Client MemoryLimitBytes in effect", nil, nil)
+	descMemUsed   = prometheus.NewDesc(monitorMetricPrefix+"client_memory_used_bytes", "Estimated client memory reserved against MemoryLimitBytes (prefetched + pending bytes) at the last sample", nil, nil)
+)
+
+// Collector 返回暴露监控数据的 prometheus.Collector，注册到 ClientMetrics 后随 /metrics 和推送导出
+func (m *MemoryMonitor) Collector() prometheus.Collector {
+	return monitorCollector{m}
+}
+
+func (c monitorCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{descHeapAlloc, descHeapInuse, descRSS, descNumGC, descLag, descMessages, descBytes, descBatches, descQueued, descMemLimit, descMemUsed} {
+		ch <- d
+	}
+}
+
+func (c monitorCollector) Collect(ch chan<- prometheus.Metric) {
+	counters := c.m.counters.snapshot()
+	limit := c.m.memoryLimit.Load()
+	if limit > 0 {
+		ch <- prometheus.MustNewConstMetric(descMemLimit, prometheus.GaugeValue, float64(limit))
+	}
+	ch <- prometheus.MustNewConstMetric(descMessages, prometheus.CounterValue, float64(counters.messageCount))
+	ch <- prometheus.MustNewConstMetric(descBytes, prometheus.CounterValue, float64(counters.messageBytes))
+	ch <- prometheus.MustNewConstMetric(descBatches, prometheus.CounterValue, float64(counters.batchCount))
+
+	samples := c.m.samples()
+	if len(samples) == 0 {
+		return
+	}
+	s := samples[len(samples)-1]
+	ch <- prometheus.MustNewConstMetric(descHeapAlloc, prometheus.GaugeValue, float64(s.HeapAlloc))
+	ch <- prometheus.MustNewConstMetric(descHeapInuse, prometheus.GaugeValue, float64(s.HeapInuse))
+	ch <- prometheus.MustNewConstMetric(descRSS, prometheus.GaugeValue, float64(s.RSS))
+	ch <- prometheus.MustNewConstMetric(descNumGC, prometheus.CounterValue, float64(s.NumGC))
+	ch <- prometheus.MustNewConstMetric(descQueued, prometheus.GaugeValue, float64(s.QueuedMessages))
+	if s.LastPublishTime != 0 {
+		ch <- prometheus.MustNewConstMetric(descLag, prometheus.GaugeValue, float64(s.LagMs)/1000)
+	}
+	if s.Client != nil {
+		ch <- prometheus.MustNewConstMetric(descMemUsed, prometheus.GaugeValue, s.Client.MemoryUsed())
+	}
+}
+
+// defaultClientMemoryLimit 与 pulsar-client-go 的 defaultMemoryLimitBytes 相同，MemoryLimitBytes 为 0 时生效
+const defaultClientMemoryLimit = 64 * 1024 * 1024
+
+// SetClientMemoryLimit 记录 -memory-limit (ClientOptions.MemoryLimitBytes)，0 按客户端默认的 64MB，负数表示不限制
+func (m *MemoryMonitor) SetClientMemoryLimit(bytes int64) {
+	if bytes == 0 {
+		bytes = defaultClientMemoryLimit
+	}
+	m.memoryLimit.Store(max(bytes, 0))
+}
+
+// CurrentStats /stats/current 的响应: 最近一次采样，以及请求时刻的计数器
+type CurrentStats struct {
+	Timestamp         time.Time         `json:"timestamp"`
+	UptimeSeconds     float64           `json:"uptime_seconds"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Samples           int               `json:"samples"`
+	MessageCount      int64             `json:"message_count"`
+	MessageBytes      int64             `json:"message_bytes"`
+	BatchCount        int64             `json:"batch_count"`
+	ClientMemoryLimit int64             `json:"client_memory_limit,omitempty"`
+	ClientMemoryUsed  float64           `json:"client_memory_used,omitempty"` // 最近一次采样的估算，见 ClientSample.MemoryUsed
+	LastSample        *MemoryStats      `json:"last_sample,omitempty"`
+}
+
+// Current 返回当前状态，运行中随时可调用
+func (m *MemoryMonitor) Current() CurrentStats {
+	counters := m.counters.snapshot()
+	samples := m.samples()
+	now := m.clock.Now()
+	cur := CurrentStats{
+		Timestamp:         now,
+		UptimeSeconds:     now.Sub(m.startTime).Seconds(),
+		Labels:            m.GetLabels(),
+		Samples:           len(samples),
+		MessageCount:      counters.messageCount,
+		MessageBytes:      counters.messageBytes,
+		BatchCount:        counters.batchCount,
+		ClientMemoryLimit: m.memoryLimit.Load(),
+	}
+	if len(samples) > 0 {
+		last := samples[len(samples)-1]
+		cur.LastSample = &last
+		if last.Client != nil {
+			cur.ClientMemoryUsed = last.Client.MemoryUsed()
+		}
+	}
+	return cur
+}
+
+// CurrentHandler 以 JSON 返回 Current，注册为 /stats/current，长时间的测试不必等到最终的 stats 文件
+func (m *MemoryMonitor) CurrentHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(m.Current())
+	})
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ConnectionStats 客户端到 broker 的连接数，来自 pulsar_client_connections_opened/closed。
+// 连接池大小 (MaxConnectionsPerBroker) 和空闲回收 (ConnectionMaxIdleTime) 决定连接数
+// 和重建次数，每条连接有自己的读写缓冲区和 goroutine
+type ConnectionStats struct {
+	Samples int     `json:"samples"`
+	Max     float64 `json:"max"`
+	Avg     float64 `json:"avg"`
+	Final   float64 `json:"final"`
+	Opened  float64 `json:"opened"` // 累计建立的连接数，远大于 Max 说明连接被反复关闭重建
+	Closed  float64 `json:"closed"`
+}
+
+// ConnectionPoint 某一时刻的连接数
+type ConnectionPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Connections float64   `json:"connections"`
+}
+
+// connectionStats 由样本中的客户端指标计算连接数统计，没有客户端指标时返回 nil；
+// snapshot 为结束时的客户端指标快照
+func connectionStats(stats []MemoryStats, snapshot map[string]float64) *ConnectionStats {
+	if snapshot == nil {
+		return nil
+	}
+	c := &ConnectionStats{
+		Opened: snapshot["pulsar_client_connections_opened"],
+		Closed: snapshot["pulsar_client_connections_closed"],
+	}
+	c.Final = c.Opened - c.Closed
+	var total float64
+	for _, s := range stats {
+		if s.Client == nil {
+			continue
+		}
+		c.Samples++
+		c.Max = max(c.Max, s.Client.Connections)
+		total += s.Client.Connections
+	}
+	c.Max = max(c.Max, c.Final)
+	if c.Samples > 0 {
+		c.Avg = total / float64(c.Samples)
+	}
+	return c
+}
+
+// ConnectionSampler 没有 MemoryMonitor 的程序 (producer) 用它定期记录连接数
+type ConnectionSampler struct {
+	client *ClientMetrics
+	mu     sync.Mutex
+	points []ConnectionPoint
+}
+
+// NewConnectionSampler 创建采样器，Run 开始采样
+func NewConnectionSampler(client *ClientMetrics) *ConnectionSampler {
+	return &ConnectionSampler{client: client}
+}
+
+// Run 每 interval 采样一次，直到 ctx 取消
+func (s *ConnectionSampler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.sample()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *ConnectionSampler) sample() {
+	snap := s.client.Snapshot()
+	p := ConnectionPoint{
+		Timestamp:   time.Now(),
+		Connections: snap["pulsar_client_connections_opened"] - snap["pulsar_client_connections_closed"],
+	}
+	s.mu.Lock()
+	s.points = append(s.points, p)
+	s.mu.Unlock()
+}
+
+// Stats 连接数统计和逐次采样，在 Run 返回之后调用
+func (s *ConnectionSampler) Stats() (*ConnectionStats, []ConnectionPoint) {
+	s.mu.Lock()
+	points := s.points
+	s.mu.Unlock()
+	stats := make([]MemoryStats, len(points))
+	for i, p := range points {
+		stats[i].Client = &ClientSample{Connections: p.Connections}
+	}
+	return connectionStats(stats, s.client.Snapshot()), points
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// MemoryDelta 两次采样之间的变化量 (after - before)
+//
+// 内存字段为有符号字节数，GC 后下降时为负；Allocated 为期间累计分配的字节数 (TotalAlloc 之差)，
+// 与 HeapAlloc 的净变化不同，反映这段时间的分配压力。
+type MemoryDelta struct {
+	Duration     time.Duration `json:"duration"`
+	HeapAlloc    int64         `json:"heap_alloc"`
+	HeapInuse    int64         `json:"heap_inuse"`
+	HeapObjects  int64         `json:"heap_objects"`
+	RSS          int64         `json:"rss"`
+	Allocated    uint64        `json:"allocated"`
+	NumGC        uint32        `json:"num_gc"`
+	GCPause      time.Duration `json:"gc_pause"`
+	Messages     int64         `json:"messages"`
+	MessageBytes int64         `json:"message_bytes"`
+}
+
+// Diff 计算 before 到 after 的变化量，两者应来自同一进程
+func Diff(before, after MemoryStats) MemoryDelta {
+	return MemoryDelta{
+		Duration:     after.Timestamp.Sub(before.Timestamp),
+		HeapAlloc:    int64(after.HeapAlloc) - int64(before.HeapAlloc),
+		HeapInuse:    int64(after.HeapInuse) - int64(before.HeapInuse),
+		HeapObjects:  int64(after.HeapObjects) - int64(before.HeapObjects),
+		RSS:          int64(after.RSS) - int64(before.RSS),
+		Allocated:    after.TotalAlloc - before.TotalAlloc,
+		NumGC:        after.NumGC - before.NumGC,
+		GCPause:      time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+		Messages:     after.MessageCount - before.MessageCount,
+		MessageBytes: after.MessageBytes - before.MessageBytes,
+	}
+}
+
+// String 一行摘要，如 "HeapAlloc: +12.50 MB, RSS: +3.00 MB | allocated 40.00 MB, 2 GCs (1.2ms pause)"
+func (d MemoryDelta) String() string {
+	s := fmt.Sprintf("HeapAlloc: %+.2f MB, RSS: %+.2f MB | allocated %.2f MB",
+		mb(d.HeapAlloc), mb(d.RSS), float64(d.Allocated)/1024/1024)
+	if d.NumGC > 0 {
+		s += fmt.Sprintf(", %d GCs (%v pause)", d.NumGC, d.GCPause.Round(time.Microsecond))
+	}
+	return s
+}
+
+// Fields 结构化字段，供 progress.Reporter 或元数据使用
+func (d MemoryDelta) Fields() map[string]any {
+	return map[string]any{
+		"duration_ms":   d.Duration.Milliseconds(),
+		"heap_alloc":    d.HeapAlloc,
+		"heap_inuse":    d.HeapInuse,
+		"heap_objects":  d.HeapObjects,
+		"rss":           d.RSS,
+		"allocated":     d.Allocated,
+		"num_gc":        d.NumGC,
+		"gc_pause_ms":   ms(d.GCPause),
+		"messages":      d.Messages,
+		"message_bytes": d.MessageBytes,
+	}
+}
+
+func mb(b int64) float64 {
+	return float64(b) / 1024 / 1024
+}
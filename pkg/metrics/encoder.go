@@ -0,0 +1,335 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Encoder stats 文件的输出格式 (-stats-format)。
+// JSON 写出完整的 StatsOutput；CSV、Parquet 和 InfluxDB line protocol 是逐秒样本的表格/时序格式，
+// 每个样本一行，摘要等汇总信息不在其中 (调用方另存一份只含摘要的 JSON)
+type Encoder interface {
+	Name() string
+	Ext() string
+	Encode(w *bufio.Writer, out *StatsOutput, samples []MemoryStats) error
+}
+
+// StatsFormats -stats-format 可选的格式
+var StatsFormats = []string{"json", "csv", "parquet", "influx"}
+
+// NewEncoder 按 -stats-format 的名称返回 Encoder
+func NewEncoder(format string) (Encoder, error) {
+	switch format {
+	case "json":
+		return jsonEncoder{}, nil
+	case "csv":
+		return csvEncoder{}, nil
+	case "parquet":
+		return parquetEncoder{}, nil
+	case "influx":
+		return influxEncoder{Measurement: "pulsar_memory"}, nil
+	default:
+		return nil, fmt.Errorf("unknown stats format %q (want %s)", format, strings.Join(StatsFormats, "|"))
+	}
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Name() string { return "json" }
+func (jsonEncoder) Ext() string  { return "json" }
+
+func (jsonEncoder) Encode(w *bufio.Writer, out *StatsOutput, samples []MemoryStats) error {
+	return encodeStats(w, out, samples)
+}
+
+// sampleRow 表格格式中的一行: MemoryStats 展开 Client 后的全部字段，列名与 JSON 字段名一致 (client 字段加 client_ 前缀)
+type sampleRow struct {
+	Timestamp          time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	HeapAlloc          uint64    `parquet:"heap_alloc"`
+	HeapSys            uint64    `parquet:"heap_sys"`
+	HeapInuse          uint64    `parquet:"heap_inuse"`
+	HeapIdle           uint64    `parquet:"heap_idle"`
+	HeapReleased       uint64    `parquet:"heap_released"`
+	HeapObjects        uint64    `parquet:"heap_objects"`
+	StackInuse         uint64    `parquet:"stack_inuse"`
+	StackSys           uint64    `parquet:"stack_sys"`
+	Goroutines         int64     `parquet:"goroutines"`
+	MSpanInuse         uint64    `parquet:"mspan_inuse"`
+	MCacheInuse        uint64    `parquet:"mcache_inuse"`
+	Sys                uint64    `parquet:"sys"`
+	TotalAlloc         uint64    `parquet:"total_alloc"`
+	NumGC              uint32    `parquet:"num_gc"`
+	PauseTotalNs       uint64    `parquet:"pause_total_ns"`
+	GCCPUFraction      float64   `parquet:"gc_cpu_fraction"`
+	GCCPUSeconds       float64   `parquet:"gc_cpu_seconds"`
+	GCAssistSeconds    float64   `parquet:"gc_assist_seconds"`
+	NextGC             uint64    `parquet:"next_gc"`
+	HeapLive           uint64    `parquet:"heap_live"`
+	LiveGoalRatio      float64   `parquet:"live_goal_ratio"`
+	GOGC               int64     `parquet:"gogc"`
+	GOMemLimit         int64     `parquet:"gomemlimit"`
+	RSS                uint64    `parquet:"rss"`
+	VMS                uint64    `parquet:"vms"`
+	MessageCount       int64     `parquet:"message_count"`
+	MessageBytes       int64     `parquet:"message_bytes"`
+	WireBytes          int64     `parquet:"wire_bytes"`
+	BatchCount         int64     `parquet:"batch_count"`
+	UnackedCount       int64     `parquet:"unacked_count"`
+	FilteredCount      int64     `parquet:"filtered_count"`
+	PendingAcks        int64     `parquet:"pending_acks"`
+	BufferedAcks       int64     `parquet:"buffered_acks"`
+	RedeliveryCount    int64     `parquet:"redelivery_count"`
+	CorruptCount       int64     `parquet:"corrupt_count"`
+	LastPublishTime    int64     `parquet:"last_publish_time"`
+	LagMs              int64     `parquet:"lag_ms"`
+	LatencyP50Ms       float64   `parquet:"latency_p50_ms"`
+	LatencyP95Ms       float64   `parquet:"latency_p95_ms"`
+	LatencyP99Ms       float64   `parquet:"latency_p99_ms"`
+	LatencyMaxMs       float64   `parquet:"latency_max_ms"`
+	PrefetchedMessages float64   `parquet:"client_prefetched_messages"`
+	PrefetchedBytes    float64   `parquet:"client_prefetched_bytes"`
+	PendingMessages    float64   `parquet:"client_pending_messages"`
+	PendingBytes       float64   `parquet:"client_pending_bytes"`
+	Connections        float64   `parquet:"client_connections"`
+	Lookups            float64   `parquet:"client_lookups"`
+	QueuedMessages     int64     `parquet:"queued_messages"`
+	QueuedBytes        int64     `parquet:"queued_bytes"`
+	Elapsed            float64   `parquet:"elapsed"`
+	GapMs              int64     `parquet:"gap_ms"`
+	TotalRSS           uint64    `parquet:"total_rss"`
+	SysMemTotal        uint64    `parquet:"sys_mem_total"`
+	SysMemAvailable    uint64    `parquet:"sys_mem_available"`
+	SwapUsed           uint64    `parquet:"swap_used"`
+	MemPressure        float64   `parquet:"mem_pressure"`
+}
+
+func newSampleRow(s *MemoryStats) sampleRow {
+	r := sampleRow{
+		Timestamp:       s.Timestamp,
+		HeapAlloc:       s.HeapAlloc,
+		HeapSys:         s.HeapSys,
+		HeapInuse:       s.HeapInuse,
+		HeapIdle:        s.HeapIdle,
+		HeapReleased:    s.HeapReleased,
+		HeapObjects:     s.HeapObjects,
+		StackInuse:      s.StackInuse,
+		StackSys:        s.StackSys,
+		Goroutines:      int64(s.Goroutines),
+		MSpanInuse:      s.MSpanInuse,
+		MCacheInuse:     s.MCacheInuse,
+		Sys:             s.Sys,
+		TotalAlloc:      s.TotalAlloc,
+		NumGC:           s.NumGC,
+		PauseTotalNs:    s.PauseTotalNs,
+		GCCPUFraction:   s.GCCPUFraction,
+		GCCPUSeconds:    s.GCCPUSeconds,
+		GCAssistSeconds: s.GCAssistSeconds,
+		NextGC:          s.NextGC,
+		HeapLive:        s.HeapLive,
+		LiveGoalRatio:   s.LiveGoalRatio,
+		GOGC:            s.GOGC,
+		GOMemLimit:      s.GOMemLimit,
+		RSS:             s.RSS,
+		VMS:             s.VMS,
+		MessageCount:    s.MessageCount,
+		MessageBytes:    s.MessageBytes,
+		WireBytes:       s.WireBytes,
+		BatchCount:      s.BatchCount,
+		UnackedCount:    s.UnackedCount,
+		FilteredCount:   s.FilteredCount,
+		PendingAcks:     s.PendingAcks,
+		BufferedAcks:    s.BufferedAcks,
+		RedeliveryCount: s.RedeliveryCount,
+		CorruptCount:    s.CorruptCount,
+		LastPublishTime: s.LastPublishTime,
+		LagMs:           s.LagMs,
+		LatencyP50Ms:    s.LatencyP50Ms,
+		LatencyP95Ms:    s.LatencyP95Ms,
+		LatencyP99Ms:    s.LatencyP99Ms,
+		LatencyMaxMs:    s.LatencyMaxMs,
+		QueuedMessages:  s.QueuedMessages,
+		QueuedBytes:     s.QueuedBytes,
+		Elapsed:         s.Elapsed,
+		GapMs:           s.GapMs,
+		TotalRSS:        s.TotalRSS,
+		SysMemTotal:     s.SysMemTotal,
+		SysMemAvailable: s.SysMemAvailable,
+		SwapUsed:        s.SwapUsed,
+		MemPressure:     s.MemPressure,
+	}
+	if c := s.Client; c != nil {
+		r.PrefetchedMessages, r.PrefetchedBytes = c.PrefetchedMessages, c.PrefetchedBytes
+		r.PendingMessages, r.PendingBytes = c.PendingMessages, c.PendingBytes
+		r.Connections, r.Lookups = c.Connections, c.Lookups
+	}
+	return r
+}
+
+// sampleColumns sampleRow 除 timestamp 外的列名，按字段顺序
+var sampleColumns = func() []string {
+	t := reflect.TypeOf(sampleRow{})
+	cols := make([]string, 0, t.NumField()-1)
+	for i := 1; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("parquet"), ",")
+		cols = append(cols, name)
+	}
+	return cols
+}()
+
+// appendValues 把 timestamp 之外的字段按 sampleColumns 的顺序格式化追加到 dst
+func (r *sampleRow) appendValues(dst []string, intSuffix string) []string {
+	v := reflect.ValueOf(r).Elem()
+	for i := 1; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.Uint32, reflect.Uint64:
+			dst = append(dst, strconv.FormatUint(f.Uint(), 10)+intSuffix)
+		case reflect.Int64:
+			dst = append(dst, strconv.FormatInt(f.Int(), 10)+intSuffix)
+		case reflect.Float64:
+			dst = append(dst, strconv.FormatFloat(f.Float(), 'g', -1, 64))
+		}
+	}
+	return dst
+}
+
+// csvEncoder 首行为列名，timestamp 为 RFC 3339 (毫秒)，其余列与 JSON 字段同名
+type csvEncoder struct{}
+
+func (csvEncoder) Name() string { return "csv" }
+func (csvEncoder) Ext() string  { return "csv" }
+
+func (csvEncoder) Encode(w *bufio.Writer, _ *StatsOutput, samples []MemoryStats) error {
+	cw := csv.NewWriter(w)
+	record := append([]string{"timestamp"}, sampleColumns...)
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for i := range samples {
+		r := newSampleRow(&samples[i])
+		record = append(record[:0], r.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		if err := cw.Write(r.appendValues(record, "")); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parquetEncoder 按 sampleRow 的 schema 写出，timestamp 为毫秒精度的 TIMESTAMP 逻辑类型
+type parquetEncoder struct{}
+
+func (parquetEncoder) Name() string { return "parquet" }
+func (parquetEncoder) Ext() string  { return "parquet" }
+
+func (parquetEncoder) Encode(w *bufio.Writer, _ *StatsOutput, samples []MemoryStats) error {
+	pw := parquet.NewGenericWriter[sampleRow](w)
+	rows := make([]sampleRow, 0, 1024)
+	for i := range samples {
+		rows = append(rows, newSampleRow(&samples[i]))
+		if len(rows) == cap(rows) || i == len(samples)-1 {
+			if _, err := pw.Write(rows); err != nil {
+				return err
+			}
+			rows = rows[:0]
+		}
+	}
+	return pw.Close()
+}
+
+// influxEncoder 每个样本一行 InfluxDB line protocol，-labels 作为 tag，整数字段带 i 后缀，时间戳为纳秒
+type influxEncoder struct {
+	Measurement string
+}
+
+func (influxEncoder) Name() string { return "influx" }
+func (influxEncoder) Ext() string  { return "lp" }
+
+func (e influxEncoder) Encode(w *bufio.Writer, out *StatsOutput, samples []MemoryStats) error {
+	lines := NewInfluxLines(e.Measurement, out.Labels)
+	var buf []byte
+	for i := range samples {
+		buf = lines.Append(buf[:0], &samples[i])
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InfluxLines 把样本逐个格式化为 line protocol，-stats-format=influx 和直接写入 InfluxDB (export.SampleWriter) 共用
+type InfluxLines struct {
+	prefix string // measurement 与 tag，对所有样本相同，只拼接一次
+	values []string
+}
+
+// NewInfluxLines tags 中值为空的忽略，其余按 key 排序 (InfluxDB 推荐的写法)
+func NewInfluxLines(measurement string, tags map[string]string) *InfluxLines {
+	prefix := influxEscape(measurement, ", ")
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := tags[k]; v != "" {
+			prefix += "," + influxEscape(k, ",= ") + "=" + influxEscape(v, ",= ")
+		}
+	}
+	return &InfluxLines{prefix: prefix, values: make([]string, 0, len(sampleColumns))}
+}
+
+// Append 把一个样本的一行 (含换行) 追加到 dst；不是并发安全的
+func (l *InfluxLines) Append(dst []byte, s *MemoryStats) []byte {
+	r := newSampleRow(s)
+	l.values = r.appendValues(l.values[:0], "i")
+	dst = append(dst, l.prefix...)
+	for j, col := range sampleColumns {
+		if j == 0 {
+			dst = append(dst, ' ')
+		} else {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, col...)
+		dst = append(dst, '=')
+		dst = append(dst, l.values[j]...)
+	}
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, r.Timestamp.UnixNano(), 10)
+	return append(dst, '\n')
+}
+
+// SampleRecord 样本展开为 列名 -> 值，列与 CSV/Parquet 相同，用于按行写入数据库
+func SampleRecord(s *MemoryStats) map[string]any {
+	r := newSampleRow(s)
+	v := reflect.ValueOf(r)
+	rec := make(map[string]any, len(sampleColumns)+1)
+	rec["timestamp"] = r.Timestamp
+	for i, col := range sampleColumns {
+		rec[col] = v.Field(i + 1).Interface()
+	}
+	return rec
+}
+
+// influxEscape 按 line protocol 的规则用反斜杠转义 chars 中的字符
+func influxEscape(s, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(chars, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
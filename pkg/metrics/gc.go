@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+// runtime/metrics 中 GC CPU 相关的指标，是 runtime 按调度时间估算的值
+const (
+	metricGCCPU    = "/cpu/classes/gc/total:cpu-seconds"
+	metricGCAssist = "/cpu/classes/gc/mark/assist:cpu-seconds"
+	metricHeapLive = "/gc/heap/live:bytes"
+	metricGOGC     = "/gc/gogc:percent"
+	metricMemLimit = "/gc/gomemlimit:bytes"
+)
+
+// gcCPU 读取累计的 GC CPU 时间和其中 mark assist 的部分 (秒)
+//
+// mark assist 是分配过快时业务 goroutine 被迫协助标记的时间，
+// 直接拖慢消费，比后台 GC worker 更值得关注
+func gcCPU() (total, assist float64) {
+	samples := []metrics.Sample{{Name: metricGCCPU}, {Name: metricGCAssist}}
+	metrics.Read(samples)
+	return float64Value(samples[0]), float64Value(samples[1])
+}
+
+// RecordForcedGC 记录一次主动触发的 GC，d 为调用方被阻塞的时长
+func (m *MemoryMonitor) RecordForcedGC(d time.Duration) {
+	m.counters.forcedGCs.Add(1)
+	m.counters.forcedGCNs.Add(int64(d))
+}
+
+// gcPacing GC 步调相关的状态
+type gcPacing struct {
+	heapLive uint64 // 上次 GC 标记的存活堆
+	gogc     int64  // 生效的 GOGC，关闭时为 -1
+	memLimit int64  // 生效的 GOMEMLIMIT，未设置时为 math.MaxInt64
+}
+
+func readGCPacing() gcPacing {
+	samples := []metrics.Sample{{Name: metricHeapLive}, {Name: metricGOGC}, {Name: metricMemLimit}}
+	metrics.Read(samples)
+	return gcPacing{
+		heapLive: uint64Value(samples[0]),
+		gogc:     int64(uint64Value(samples[1])),
+		memLimit: int64(uint64Value(samples[2])),
+	}
+}
+
+// formatMemLimit 打印 GOMEMLIMIT，未设置时显示 off
+func formatMemLimit(limit int64) string {
+	if limit <= 0 || limit == math.MaxInt64 {
+		return "off"
+	}
+	return fmt.Sprintf("%.2f MB", float64(limit)/1024/1024)
+}
+
+func uint64Value(s metrics.Sample) uint64 {
+	if s.Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return s.Value.Uint64()
+}
+
+func float64Value(s metrics.Sample) float64 {
+	if s.Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return s.Value.Float64()
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// GCTraceRecord GODEBUG=gctrace=1 输出的一次 GC，Cycle 与样本中的 NumGC 对应
+type GCTraceRecord struct {
+	Timestamp  time.Time `json:"timestamp"`   // 读到该行的时间 (GC 结束附近)
+	Cycle      uint32    `json:"cycle"`       // 第几次 GC
+	SinceStart float64   `json:"since_start"` // GC 开始时距进程启动的秒数
+	CPUPercent int       `json:"cpu_percent"` // 进程启动以来 GC 占用的 CPU 百分比
+
+	// 墙钟时间 (ms): STW sweep termination + 并发标记 + STW mark termination
+	SweepTermMs float64 `json:"sweep_term_ms"`
+	MarkMs      float64 `json:"mark_ms"`
+	MarkTermMs  float64 `json:"mark_term_ms"`
+
+	// CPU 时间 (ms): 标记阶段的 assist / 后台 / 空闲
+	AssistCPUMs     float64 `json:"assist_cpu_ms"`
+	BackgroundCPUMs float64 `json:"background_cpu_ms"`
+	IdleCPUMs       float64 `json:"idle_cpu_ms"`
+
+	// 堆大小 (MB): GC 开始时 -> 标记结束时 -> 存活
+	HeapStartMB uint64 `json:"heap_start_mb"`
+	HeapEndMB   uint64 `json:"heap_end_mb"`
+	HeapLiveMB  uint64 `json:"heap_live_mb"`
+	HeapGoalMB  uint64 `json:"heap_goal_mb"`
+	Procs       int    `json:"procs"`
+	Forced      bool   `json:"forced,omitempty"`
+}
+
+// PauseMs 本次 GC 的 STW 时间
+func (r GCTraceRecord) PauseMs() float64 {
+	return r.SweepTermMs + r.MarkTermMs
+}
+
+// gc 1 @0.012s 2%: 0.011+1.2+0.003 ms clock, 0.045+0.35/1.1/0.62+0.013 ms cpu, 4->4->0 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 4 P (forced)
+var gcTraceLine = regexp.MustCompile(`^gc (\d+) @([\d.]+)s (\d+)%(?: \([^)]*\))?: ` +
+	`([\d.]+)\+([\d.]+)\+([\d.]+) ms clock, ` +
+	`[\d.]+\+([\d.]+)/([\d.]+)/([\d.]+)\+[\d.]+ ms cpu, ` +
+	`(\d+)->(\d+)->(\d+) MB, (\d+) MB goal, .*?(\d+) P( \(forced\))?`)
+
+// ParseGCTraceLine 解析一行 gctrace 输出，不是 gctrace 行时返回 false
+func ParseGCTraceLine(line string) (GCTraceRecord, bool) {
+	m := gcTraceLine.FindStringSubmatch(line)
+	if m == nil {
+		return GCTraceRecord{}, false
+	}
+	f := func(i int) float64 {
+		v, _ := strconv.ParseFloat(m[i], 64)
+		return v
+	}
+	u := func(i int) uint64 {
+		v, _ := strconv.ParseUint(m[i], 10, 64)
+		return v
+	}
+	return GCTraceRecord{
+		Cycle:           uint32(u(1)),
+		SinceStart:      f(2),
+		CPUPercent:      int(u(3)),
+		SweepTermMs:     f(4),
+		MarkMs:          f(5),
+		MarkTermMs:      f(6),
+		AssistCPUMs:     f(7),
+		BackgroundCPUMs: f(8),
+		IdleCPUMs:       f(9),
+		HeapStartMB:     u(10),
+		HeapEndMB:       u(11),
+		HeapLiveMB:      u(12),
+		HeapGoalMB:      u(13),
+		Procs:           int(u(14)),
+		Forced:          m[15] != "",
+	}, true
+}
+
+// AddGCTrace 加入监控期间 (Start 之后) 的 GC 记录，随统计数据一起保存
+func (m *MemoryMonitor) AddGCTrace(records []GCTraceRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range records {
+		if !r.Timestamp.Before(m.startTime) {
+			m.gcTrace = append(m.gcTrace, r)
+		}
+	}
+	sort.Slice(m.gcTrace, func(i, j int) bool { return m.gcTrace[i].Cycle < m.gcTrace[j].Cycle })
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// DumpGoroutines 写入全部 goroutine 的调用栈 (debug=2)，并把写入前的 goroutine 数和 StackInuse/StackSys
+// 记入 metadata (goroutine_dump.*)。heap profile 不含栈内存，scripts/goroutine-stacks.py 用这两份数据
+// 按创建位置和包估算栈占用
+func (m *MemoryMonitor) DumpGoroutines(filename string) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	n := runtime.NumGoroutine()
+	err := results.WriteFile(filename, func(w io.Writer) error {
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	if err != nil {
+		return err
+	}
+	m.SetMetadata("goroutine_dump.goroutines", strconv.Itoa(n))
+	m.SetMetadata("goroutine_dump.stack_inuse", strconv.FormatUint(ms.StackInuse, 10))
+	m.SetMetadata("goroutine_dump.stack_sys", strconv.FormatUint(ms.StackSys, 10))
+	return nil
+}
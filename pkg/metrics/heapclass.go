@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"runtime/metrics"
+	"strings"
+)
+
+// runtime/metrics 中按 size class 分桶的累计分配和释放对象数，两者之差为各 size class 的存活对象数；
+// 不含 tiny 分配器合并在 16B 块中的微小对象 (只计块本身)；释放在 GC 清扫之后才计入，两次 GC 之间死去的对象仍算存活
+const (
+	metricAllocsBySize = "/gc/heap/allocs-by-size:bytes"
+	metricFreesBySize  = "/gc/heap/frees-by-size:bytes"
+)
+
+// heapClassBounds 样本中合并 size class 的区间上界 (字节)，约 68 个 size class 逐个保存会让每个样本多出几十个数；
+// 最后一个区间是超过 32KB、直接从 mheap 分配的大对象
+var heapClassBounds = [...]uint64{
+	16,
+	64,
+	256,
+	1 << 10,
+	4 << 10,
+	8 << 10,
+	32 << 10,
+}
+
+// readHeapClasses 读取各区间的存活堆对象数，与 heapClassBounds 一一对应，最后一个为大对象
+func readHeapClasses() []uint64 {
+	samples := []metrics.Sample{{Name: metricAllocsBySize}, {Name: metricFreesBySize}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindFloat64Histogram || samples[1].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	allocs, frees := samples[0].Value.Float64Histogram(), samples[1].Value.Float64Histogram()
+	if len(allocs.Counts) != len(frees.Counts) {
+		return nil
+	}
+	out := make([]uint64, len(heapClassBounds)+1)
+	for i, n := range allocs.Counts {
+		if n < frees.Counts[i] {
+			continue // 两次读取之间的释放，忽略
+		}
+		// 桶 i 为 [Buckets[i], Buckets[i+1])，上界是 size class 的大小加一，大对象的桶上界为 +Inf
+		j := len(heapClassBounds)
+		if upper := allocs.Buckets[i+1]; !math.IsInf(upper, 1) {
+			j = 0
+			for j < len(heapClassBounds) && uint64(upper)-1 > heapClassBounds[j] {
+				j++
+			}
+		}
+		out[j] += n - frees.Counts[i]
+	}
+	return out
+}
+
+// HeapClassStats 一个 size class 区间的存活堆对象数，LeBytes 为上界，最后一个区间 (大对象) 为 0
+type HeapClassStats struct {
+	LeBytes      uint64 `json:"le_bytes"`
+	MaxObjects   uint64 `json:"max_objects"`
+	FinalObjects uint64 `json:"final_objects"`
+}
+
+// HeapFragmentation HeapInuse 与 HeapAlloc 之差: 已占用的 span 中没有对象的槽位。
+// 一个 span 只服务一个 size class，某个 size class 的对象大量释放后，它的 span 只要还剩一个对象
+// 就既不能归还 OS 也不能给其他 size class 使用，这部分内存计入 RSS 却不计入 HeapAlloc
+type HeapFragmentation struct {
+	MaxBytes   uint64  `json:"max_bytes"`
+	AvgBytes   float64 `json:"avg_bytes"`
+	MaxRatio   float64 `json:"max_ratio"` // (HeapInuse - HeapAlloc) / HeapInuse
+	AvgRatio   float64 `json:"avg_ratio"`
+	FinalRatio float64 `json:"final_ratio"`
+}
+
+// fragmentationStats 汇总各样本的碎片，没有样本时返回 nil
+func fragmentationStats(stats []MemoryStats) *HeapFragmentation {
+	if len(stats) == 0 {
+		return nil
+	}
+	f := &HeapFragmentation{}
+	var totalBytes uint64
+	var totalRatio float64
+	for _, s := range stats {
+		gap, ratio := heapGap(&s)
+		f.MaxBytes = max(f.MaxBytes, gap)
+		f.MaxRatio = max(f.MaxRatio, ratio)
+		totalBytes += gap
+		totalRatio += ratio
+	}
+	n := float64(len(stats))
+	f.AvgBytes = float64(totalBytes) / n
+	f.AvgRatio = totalRatio / n
+	_, f.FinalRatio = heapGap(&stats[len(stats)-1])
+	return f
+}
+
+// heapGap 一个样本的 HeapInuse - HeapAlloc 及其占 HeapInuse 的比例；两者不是同一时刻读取的，差为负时按 0
+func heapGap(s *MemoryStats) (uint64, float64) {
+	if s.HeapInuse == 0 || s.HeapAlloc >= s.HeapInuse {
+		return 0, 0
+	}
+	gap := s.HeapInuse - s.HeapAlloc
+	return gap, float64(gap) / float64(s.HeapInuse)
+}
+
+// heapClassStats 各区间存活对象数的峰值和最后一个样本的值，样本中没有分区间计数时返回 nil
+func heapClassStats(stats []MemoryStats) []HeapClassStats {
+	var out []HeapClassStats
+	for _, s := range stats {
+		if len(s.HeapClassObjects) != len(heapClassBounds)+1 {
+			continue
+		}
+		if out == nil {
+			out = make([]HeapClassStats, len(heapClassBounds)+1)
+			for i, le := range heapClassBounds {
+				out[i].LeBytes = le
+			}
+		}
+		for i, n := range s.HeapClassObjects {
+			out[i].MaxObjects = max(out[i].MaxObjects, n)
+			out[i].FinalObjects = n
+		}
+	}
+	return out
+}
+
+// printHeapClasses 打印碎片和各区间最终/峰值的存活对象数
+func printHeapClasses(summary MemorySummary) {
+	if f := summary.Fragmentation; f != nil {
+		logf("    Fragmentation (HeapInuse - HeapAlloc): max %.2f MB, avg %.2f MB | avg %.1f%%, max %.1f%%, final %.1f%% of HeapInuse",
+			InUnit(f.MaxBytes), InUnit(f.AvgBytes), f.AvgRatio*100, f.MaxRatio*100, f.FinalRatio*100)
+	}
+	if len(summary.HeapClasses) == 0 {
+		return
+	}
+	parts := make([]string, 0, len(summary.HeapClasses))
+	for _, c := range summary.HeapClasses {
+		name := ">32K"
+		if c.LeBytes > 0 {
+			name = "<=" + formatClassSize(c.LeBytes)
+		}
+		parts = append(parts, fmt.Sprintf("%s %d/%d", name, c.FinalObjects, c.MaxObjects))
+	}
+	log.Printf("    Live objects by size class (final/max): %s", strings.Join(parts, ", "))
+}
+
+// formatClassSize 区间上界的简写，如 16、1K、32K
+func formatClassSize(b uint64) string {
+	if b >= 1<<10 {
+		return fmt.Sprintf("%dK", b>>10)
+	}
+	return fmt.Sprintf("%d", b)
+}
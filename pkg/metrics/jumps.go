@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// maxJumps 摘要中保留的最大跳变数
+const maxJumps = 10
+
+// Jump 相邻两个样本之间 HeapAlloc 或 RSS 的一次上升，用于在长时间序列中直接定位值得看的时刻。
+// 只统计上升: 下降通常是 GC 或归还内存，不是要找的异常
+type Jump struct {
+	Metric   string    `json:"metric"` // heap_alloc|rss
+	Time     time.Time `json:"time"`   // 跳变后样本的时间
+	From     uint64    `json:"from"`
+	To       uint64    `json:"to"`
+	Delta    int64     `json:"delta"`
+	Batches  int64     `json:"batches"`  // 跳变后样本时已处理的批次数
+	Messages int64     `json:"messages"` // 跳变后样本时已处理的消息数
+	// 离跳变最近的区域 (batch-N、cycle-N 等)、phase 或重投递风暴，与两个样本之间的区间重叠时偏移为 0
+	Event         string `json:"event,omitempty"`
+	EventOffsetMs int64  `json:"event_offset_ms,omitempty"` // 事件开始时间相对跳变后样本，为负表示在其之前
+
+	since time.Time // 跳变前样本的时间
+}
+
+// jumpEvent 可以和跳变对齐的事件
+type jumpEvent struct {
+	name       string
+	start, end time.Time
+}
+
+// jumps 样本间最大的 maxJumps 次上升 (HeapAlloc 和 RSS 一起排序)，并关联最近的事件；
+// 调用方持有读锁
+func (m *MemoryMonitor) jumps(stats []MemoryStats, phases []PhaseStats, storms []StormStats) []Jump {
+	var out []Jump
+	for i := 1; i < len(stats); i++ {
+		prev, cur := stats[i-1], stats[i]
+		if cur.HeapAlloc > prev.HeapAlloc {
+			out = append(out, newJump("heap_alloc", prev, cur))
+		}
+		if prev.RSS > 0 && cur.RSS > prev.RSS {
+			out = append(out, newJump("rss", prev, cur))
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Delta > out[j].Delta })
+	if len(out) > maxJumps {
+		out = out[:maxJumps]
+	}
+
+	events := make([]jumpEvent, 0, len(m.regions)+len(phases)+len(storms))
+	for _, r := range m.regions {
+		events = append(events, jumpEvent{name: r.Name, start: r.Start, end: r.Start.Add(r.Duration)})
+	}
+	for _, p := range phases {
+		events = append(events, jumpEvent{name: "phase " + p.Name, start: p.Start, end: p.Start})
+	}
+	for _, s := range storms {
+		events = append(events, jumpEvent{name: "storm", start: s.Start, end: s.Start})
+	}
+	for i := range out {
+		out[i].nearestEvent(events)
+	}
+	return out
+}
+
+func newJump(metric string, prev, cur MemoryStats) Jump {
+	from, to := prev.HeapAlloc, cur.HeapAlloc
+	if metric == "rss" {
+		from, to = prev.RSS, cur.RSS
+	}
+	return Jump{
+		Metric:   metric,
+		Time:     cur.Timestamp,
+		From:     from,
+		To:       to,
+		Delta:    int64(to - from),
+		Batches:  cur.BatchCount,
+		Messages: cur.MessageCount,
+		since:    prev.Timestamp,
+	}
+}
+
+// nearestEvent 找出与两个样本之间的区间 (since, Time] 距离最近的事件
+func (j *Jump) nearestEvent(events []jumpEvent) {
+	best := time.Duration(-1)
+	for _, e := range events {
+		var d time.Duration
+		switch {
+		case e.end.Before(j.since):
+			d = j.since.Sub(e.end)
+		case e.start.After(j.Time):
+			d = e.start.Sub(j.Time)
+		}
+		if best < 0 || d < best {
+			best = d
+			j.Event = e.name
+			j.EventOffsetMs = e.start.Sub(j.Time).Milliseconds()
+			if d == 0 {
+				j.EventOffsetMs = 0
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	keyRecordLimit = 100000 // stats 文件中逐 key 记录的上限，超出时保留消息数最多的 key
+	keyTopN        = 5      // 摘要中列出的 key 数
+)
+
+// keyStream 同一 key 下同一 producer worker 的消息，序号应严格递增
+type keyStream struct {
+	key    string
+	worker uint32
+}
+
+// keyState 单个 key 的累计值
+type keyState struct {
+	messages    int64
+	first, last time.Time
+	maxGap      time.Duration
+	outOfOrder  int64
+	duplicates  int64
+}
+
+// keyTracker 按 key 记录到达时间和顺序，EnableKeyStats 之后才创建。
+// 状态随 key 数增长，key 空间很大时它本身会出现在堆的测量结果中
+type keyTracker struct {
+	mu        sync.Mutex
+	keys      map[string]*keyState
+	streams   map[keyStream]uint64 // 已收到的最大序号
+	unordered int64
+}
+
+// KeyRecord 单个 key 的消费记录，写入 stats 文件，跨进程合并时据此判断 key 的归属变化
+type KeyRecord struct {
+	Key        string    `json:"key"`
+	Messages   int64     `json:"messages"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+	MaxGapMs   float64   `json:"max_gap_ms"` // 相邻两条消息的最大到达间隔
+	OutOfOrder int64     `json:"out_of_order,omitempty"`
+	Duplicates int64     `json:"duplicates,omitempty"`
+}
+
+// KeyStats 按 key 的顺序和饥饿统计
+type KeyStats struct {
+	Keys     int   `json:"keys"`
+	Messages int64 `json:"messages"`
+	// 序号小于同一 key、同一 producer worker 已收到的最大序号 (重投递除外)
+	OutOfOrder     int64 `json:"out_of_order"`
+	OutOfOrderKeys int   `json:"out_of_order_keys"`
+	Duplicates     int64 `json:"duplicates"` // 序号重复且不是重投递
+	Unordered      int64 `json:"unordered"`  // 没有序号或重投递的消息，只计数不检查顺序
+	// 各 key 最大到达间隔的分布，长间隔说明 key 被搁置 (饥饿或归属切换)
+	MaxGapMs       float64     `json:"max_gap_ms"`
+	MedianMaxGapMs float64     `json:"median_max_gap_ms"`
+	Starved        []KeyRecord `json:"starved,omitempty"` // 最大间隔最长的 key
+	RecordsDropped int         `json:"records_dropped,omitempty"`
+}
+
+// EnableKeyStats 开启按 key 的统计，RecordKey 在此之前调用会被忽略
+func (m *MemoryMonitor) EnableKeyStats() {
+	m.mu.Lock()
+	if m.keys == nil {
+		m.keys = &keyTracker{keys: make(map[string]*keyState), streams: make(map[keyStream]uint64)}
+	}
+	m.mu.Unlock()
+}
+
+// RecordKey 记录一条带 key 的消息；ordered 为 false (没有序号或是重投递) 时只记录到达，不检查顺序。
+// 空 key 忽略
+func (m *MemoryMonitor) RecordKey(key string, worker uint32, seq uint64, ordered bool) {
+	m.mu.RLock()
+	t := m.keys
+	m.mu.RUnlock()
+	if t == nil || key == "" {
+		return
+	}
+	now := m.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k, ok := t.keys[key]
+	if !ok {
+		k = &keyState{first: now}
+		t.keys[key] = k
+	} else {
+		k.maxGap = max(k.maxGap, now.Sub(k.last))
+	}
+	k.messages++
+	k.last = now
+	if !ordered {
+		t.unordered++
+		return
+	}
+	s := keyStream{key: key, worker: worker}
+	last, seen := t.streams[s]
+	switch {
+	case !seen || seq > last:
+		t.streams[s] = seq
+	case seq == last:
+		k.duplicates++
+	default:
+		k.outOfOrder++
+	}
+}
+
+// keyResults 摘要和逐 key 记录，未开启时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) keyResults() (*KeyStats, []KeyRecord) {
+	t := m.keys
+	if t == nil {
+		return nil, nil
+	}
+	t.mu.Lock()
+	stats := &KeyStats{Keys: len(t.keys), Unordered: t.unordered}
+	records := make([]KeyRecord, 0, len(t.keys))
+	for key, k := range t.keys {
+		records = append(records, KeyRecord{
+			Key:        key,
+			Messages:   k.messages,
+			First:      k.first,
+			Last:       k.last,
+			MaxGapMs:   float64(k.maxGap) / float64(time.Millisecond),
+			OutOfOrder: k.outOfOrder,
+			Duplicates: k.duplicates,
+		})
+	}
+	t.mu.Unlock()
+	if len(records) == 0 {
+		return stats, nil
+	}
+
+	for _, r := range records {
+		stats.Messages += r.Messages
+		stats.OutOfOrder += r.OutOfOrder
+		stats.Duplicates += r.Duplicates
+		if r.OutOfOrder > 0 {
+			stats.OutOfOrderKeys++
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].MaxGapMs > records[j].MaxGapMs })
+	stats.MaxGapMs = records[0].MaxGapMs
+	stats.MedianMaxGapMs = records[len(records)/2].MaxGapMs
+	stats.Starved = append([]KeyRecord(nil), records[:min(keyTopN, len(records))]...)
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Messages != records[j].Messages {
+			return records[i].Messages > records[j].Messages
+		}
+		return records[i].Key < records[j].Key
+	})
+	if len(records) > keyRecordLimit {
+		stats.RecordsDropped = len(records) - keyRecordLimit
+		records = records[:keyRecordLimit]
+	}
+	return stats, records
+}
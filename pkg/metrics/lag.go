@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// LagEstimate 消费延迟估算
+//
+// Lag 为当前时间与最新已消费消息发布时间之差。CatchUpRate 为窗口内
+// 发布时间推进速度与本地单调时钟速度之比: >1 表示在追赶，<1 表示越落越远。
+// TimeToDrain 假设生产端持续写入 (head 随墙钟推进)，= Lag / (CatchUpRate - 1)；
+// 生产端已停止时实际耗时会更短。
+type LagEstimate struct {
+	Lag         time.Duration
+	CatchUpRate float64
+	TimeToDrain time.Duration // CatchUpRate <= 1 或样本不足时为 -1
+}
+
+func (e LagEstimate) String() string {
+	if e.TimeToDrain < 0 {
+		return fmt.Sprintf("%v behind (catch-up %.2fx, not draining)", e.Lag.Round(time.Millisecond), e.CatchUpRate)
+	}
+	return fmt.Sprintf("%v behind (catch-up %.2fx, drain in ~%v)",
+		e.Lag.Round(time.Millisecond), e.CatchUpRate, e.TimeToDrain.Round(time.Second))
+}
+
+// RecordPublishTime 记录已消费消息的发布时间，只保留最新值
+func (m *MemoryMonitor) RecordPublishTime(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	storeMax(&m.counters.lastPublish, t.UnixNano())
+}
+
+// EstimateLag 用最近 window 内的采样估算延迟和追赶速度，没有发布时间时 ok 为 false
+func (m *MemoryMonitor) EstimateLag(window time.Duration) (LagEstimate, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := len(m.stats)
+	if n == 0 || m.stats[n-1].LastPublishTime == 0 {
+		return LagEstimate{}, false
+	}
+	last := m.stats[n-1]
+	est := LagEstimate{
+		Lag:         time.Duration(last.LagMs) * time.Millisecond,
+		TimeToDrain: -1,
+	}
+
+	// 找窗口内最早的一个有发布时间的样本，不跨过休眠等时钟不连续: 发布时间是墙钟，窗口是单调时钟
+	first := -1
+	for i := n - 2; i >= 0; i-- {
+		s := m.stats[i]
+		if last.Timestamp.Sub(s.Timestamp) > window || s.LastPublishTime == 0 || m.stats[i+1].GapMs != 0 {
+			break
+		}
+		first = i
+	}
+	if first < 0 {
+		return est, true
+	}
+	s0 := m.stats[first]
+	elapsed := last.Timestamp.Sub(s0.Timestamp)
+	if elapsed <= 0 {
+		return est, true
+	}
+	published := time.Duration(last.LastPublishTime-s0.LastPublishTime) * time.Millisecond
+	est.CatchUpRate = float64(published) / float64(elapsed)
+	if est.CatchUpRate > 1 {
+		est.TimeToDrain = time.Duration(float64(est.Lag) / (est.CatchUpRate - 1))
+	}
+	return est, true
+}
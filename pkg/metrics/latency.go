@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"time"
+
+	"pulsar-memory-test/pkg/latency"
+)
+
+// latencyHistograms consumer 的端到端、批次延迟和消息持有时长，EnableLatency 之前为 nil
+type latencyHistograms struct {
+	e2e   *latency.Histogram
+	batch *latency.Histogram
+	hold  *latency.Histogram
+}
+
+// EnableLatency 开始记录延迟: 之后每个样本带上采样区间内端到端延迟的 p50/p95/p99/max，
+// 摘要中有全程的 latency 和 batch_latency。须在 Start 和 RecordLatency 之前调用
+func (m *MemoryMonitor) EnableLatency() {
+	m.mu.Lock()
+	m.latency = latencyHistograms{e2e: latency.New(), batch: latency.New(), hold: latency.New()}
+	m.mu.Unlock()
+}
+
+// RecordLatency 记录一条消息从发布到被处理 (加入批次) 的端到端延迟，不分配内存
+func (m *MemoryMonitor) RecordLatency(d time.Duration) {
+	if h := m.latency.e2e; h != nil {
+		h.Record(d)
+	}
+}
+
+// RecordBatchLatency 记录一个批次从第一条消息加入到整批确认完成的时长
+func (m *MemoryMonitor) RecordBatchLatency(d time.Duration) {
+	if h := m.latency.batch; h != nil {
+		h.Record(d)
+	}
+}
+
+// RecordHolding 记录一条消息从 Receive 返回到 Ack 发出的持有时长，不分配内存。
+// 持有时长乘以到达速率即平均缓冲的消息数 (Little 定律)，是缓冲内存的真正决定因素
+func (m *MemoryMonitor) RecordHolding(d time.Duration) {
+	if h := m.latency.hold; h != nil {
+		h.Record(d)
+	}
+}
+
+// sampleLatency 把上一个样本以来的端到端延迟分布写入样本，区间内没有消息时留空
+func (m *MemoryMonitor) sampleLatency(s *MemoryStats) {
+	h := m.latency.e2e
+	if h == nil {
+		return
+	}
+	iv := h.Interval()
+	if iv.Count == 0 {
+		return
+	}
+	s.LatencyP50Ms = ms(iv.Quantile(0.5))
+	s.LatencyP95Ms = ms(iv.Quantile(0.95))
+	s.LatencyP99Ms = ms(iv.Quantile(0.99))
+	s.LatencyMaxMs = ms(iv.Max)
+}
+
+// latencySummaries 全程的端到端和批次延迟摘要，未 EnableLatency 或没有数据时为 nil
+func (m *MemoryMonitor) latencySummaries() (e2e, batch *latency.Summary) {
+	if m.latency.e2e == nil {
+		return nil, nil
+	}
+	return m.latency.e2e.Snapshot().Summary(), m.latency.batch.Snapshot().Summary()
+}
+
+// holdingStats 全程的持有时长摘要，以及按 Little 定律估算的平均缓冲字节数:
+// 平均持有时长 x 字节到达速率 (MessageBytes / Duration)。未 EnableLatency 或没有数据时为 nil
+func (m *MemoryMonitor) holdingStats(s *MemorySummary) (*latency.Summary, float64) {
+	if m.latency.hold == nil {
+		return nil, 0
+	}
+	h := m.latency.hold.Snapshot().Summary()
+	if h == nil || s.Duration <= 0 {
+		return h, 0
+	}
+	return h, h.MeanMs / 1000 * float64(s.MessageBytes) / s.Duration.Seconds()
+}
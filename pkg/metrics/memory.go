@@ -1,63 +1,156 @@
 package metrics
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/process"
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/latency"
+	"pulsar-memory-test/pkg/payload"
+	"pulsar-memory-test/pkg/results"
 )
 
 // MemoryStats 内存统计数据
 type MemoryStats struct {
-	Timestamp   time.Time `json:"timestamp"`
+	Timestamp time.Time `json:"timestamp"`
+	Elapsed   float64   `json:"elapsed"`          // 单调时钟上距 monitor 启动 (元数据 clock.start_wall) 的秒数，系统休眠期间不前进
+	GapMs     int64     `json:"gap_ms,omitempty"` // 与上一个样本之间墙钟比单调时钟多走的毫秒数，非 0 表示样本流在此不连续，见 ClockGapThreshold
 
 	// Go runtime 内存统计
-	HeapAlloc    uint64 `json:"heap_alloc"`     // 堆上已分配的字节数
-	HeapSys      uint64 `json:"heap_sys"`       // 从OS获取的堆内存
-	HeapInuse    uint64 `json:"heap_inuse"`     // 正在使用的堆内存
-	HeapIdle     uint64 `json:"heap_idle"`      // 空闲的堆内存
-	HeapReleased uint64 `json:"heap_released"`  // 释放回OS的内存
-	HeapObjects  uint64 `json:"heap_objects"`   // 堆上对象数量
+	HeapAlloc    uint64 `json:"heap_alloc"`    // 堆上已分配的字节数
+	HeapSys      uint64 `json:"heap_sys"`      // 从OS获取的堆内存
+	HeapInuse    uint64 `json:"heap_inuse"`    // 正在使用的堆内存
+	HeapIdle     uint64 `json:"heap_idle"`     // 空闲的堆内存
+	HeapReleased uint64 `json:"heap_released"` // 释放回OS的内存
+	HeapObjects  uint64 `json:"heap_objects"`  // 堆上对象数量
 
-	StackInuse   uint64 `json:"stack_inuse"`    // 栈使用内存
-	StackSys     uint64 `json:"stack_sys"`      // 栈系统内存
+	// 按 size class 区间 (<=16B、<=64B、<=256B、<=1K、<=4K、<=8K、<=32K、大对象) 的存活堆对象数，见 heapclass.go
+	HeapClassObjects []uint64 `json:"heap_class_objects,omitempty"`
 
-	MSpanInuse   uint64 `json:"mspan_inuse"`
-	MCacheInuse  uint64 `json:"mcache_inuse"`
+	StackInuse uint64 `json:"stack_inuse"` // 栈使用内存
+	StackSys   uint64 `json:"stack_sys"`   // 栈系统内存
+	Goroutines int    `json:"goroutines"`  // 采样时的 goroutine 数，持续增长说明 goroutine 泄漏
 
-	Sys          uint64 `json:"sys"`            // 从OS获取的总内存
-	TotalAlloc   uint64 `json:"total_alloc"`    // 累计分配的字节数
+	MSpanInuse  uint64 `json:"mspan_inuse"`
+	MCacheInuse uint64 `json:"mcache_inuse"`
+
+	Sys        uint64 `json:"sys"`         // 从OS获取的总内存
+	TotalAlloc uint64 `json:"total_alloc"` // 累计分配的字节数
 
 	NumGC        uint32 `json:"num_gc"`         // GC次数
 	PauseTotalNs uint64 `json:"pause_total_ns"` // GC总暂停时间
 
+	GCCPUFraction   float64 `json:"gc_cpu_fraction"`   // 进程启动以来 GC 占用的 CPU 比例
+	GCCPUSeconds    float64 `json:"gc_cpu_seconds"`    // 累计 GC CPU 时间
+	GCAssistSeconds float64 `json:"gc_assist_seconds"` // 累计 mark assist CPU 时间
+
+	// GC 步调
+	NextGC        uint64  `json:"next_gc"`         // 本轮 GC 的堆目标 (heap goal)
+	HeapLive      uint64  `json:"heap_live"`       // 上次 GC 标记的存活堆
+	LiveGoalRatio float64 `json:"live_goal_ratio"` // HeapLive / NextGC
+	GOGC          int64   `json:"gogc"`            // 生效的 GOGC，关闭时为 -1
+	GOMemLimit    int64   `json:"gomemlimit"`      // 生效的 GOMEMLIMIT，未设置时为 math.MaxInt64
+
 	// 进程级内存统计
-	RSS          uint64 `json:"rss"`            // 驻留内存
-	VMS          uint64 `json:"vms"`            // 虚拟内存
+	RSS uint64 `json:"rss"` // 驻留内存
+	VMS uint64 `json:"vms"` // 虚拟内存
+
+	// TrackProcess 登记的同机进程 (按名称) 的 RSS，以及本进程与它们的合计；未登记时为空
+	SidecarRSS map[string]uint64 `json:"sidecar_rss,omitempty"`
+	TotalRSS   uint64            `json:"total_rss,omitempty"`
+
+	// 整机内存状况，区分进程自身增长和整机内存压力下的内核回收
+	SysMemTotal     uint64  `json:"sys_mem_total,omitempty"`
+	SysMemAvailable uint64  `json:"sys_mem_available,omitempty"`
+	SwapUsed        uint64  `json:"swap_used,omitempty"`
+	MemPressure     float64 `json:"mem_pressure"` // 内存 PSI some avg10 (%)，系统不支持时为 -1
 
 	// 业务统计
-	MessageCount    int64  `json:"message_count"`    // 已处理消息数
-	MessageBytes    int64  `json:"message_bytes"`    // 已处理消息字节数
-	BatchCount      int64  `json:"batch_count"`      // 批次数
+	MessageCount    int64 `json:"message_count"`            // 已处理消息数
+	MessageBytes    int64 `json:"message_bytes"`            // 已处理消息字节数
+	WireBytes       int64 `json:"wire_bytes"`               // 估算的线路字节数 (含 key/properties/协议开销)
+	BatchCount      int64 `json:"batch_count"`              // 批次数
+	UnackedCount    int64 `json:"unacked_count"`            // 故意未确认的消息数
+	FilteredCount   int64 `json:"filtered_count,omitempty"` // 过滤掉 (立即确认、不进入批次) 的消息数，已计入 MessageCount
+	PendingAcks     int64 `json:"pending_acks,omitempty"`   // 已处理但确认仍被推迟 (-ack-delay) 的消息数
+	BufferedAcks    int64 `json:"buffered_acks,omitempty"`  // 已处理、在确认批次中等待发出 (-ack-batch-size/-ack-batch-interval) 的确认数
+	RedeliveryCount int64 `json:"redelivery_count"`         // 收到的重投递消息数
+	CorruptCount    int64 `json:"corrupt_count"`            // 校验失败的消息数
+
+	// 消费延迟
+	LastPublishTime int64 `json:"last_publish_time,omitempty"` // 最新已消费消息的发布时间 (unix ms)
+	LagMs           int64 `json:"lag_ms,omitempty"`            // 采样时刻距 LastPublishTime 的毫秒数
+
+	// 上一个样本以来处理的消息的端到端延迟 (毫秒)，EnableLatency 之后才有
+	LatencyP50Ms float64 `json:"latency_p50_ms,omitempty"`
+	LatencyP95Ms float64 `json:"latency_p95_ms,omitempty"`
+	LatencyP99Ms float64 `json:"latency_p99_ms,omitempty"`
+	LatencyMaxMs float64 `json:"latency_max_ms,omitempty"`
+
+	// pulsar-client-go 内部指标，未调用 SetClientMetrics 时为空
+	Client *ClientSample `json:"client,omitempty"`
+
+	// receiver queue 中缓存的消息估算，来源见 QueueSource
+	QueuedMessages int64 `json:"queued_messages,omitempty"`
+	QueuedBytes    int64 `json:"queued_bytes,omitempty"`
 }
 
 // MemoryMonitor 内存监控器
 type MemoryMonitor struct {
 	mu            sync.RWMutex
 	stats         []MemoryStats
-	messageCount  int64
-	messageBytes  int64
-	batchCount    int64
+	counters      counters
 	startTime     time.Time
+	clock         clock.Clock // 采样周期和样本时间戳的来源，SetClock
 	pid           int32
 	proc          *process.Process
-	stopCh        chan struct{}
+	cancel        context.CancelFunc
+	stopped       bool  // 已调用 Stop，之后的 Start 直接返回
+	skipped       int64 // 超过期限被丢弃的采样
+	overhead      overheadCounters
+	regions       []RegionRecord
+	harnessAllocs []AllocProbe // -alloc-audit 测得的框架自身分配
+	latency       latencyHistograms
+	metadata      map[string]string
+	labels        map[string]string
+	client        *ClientMetrics
+	partitions    map[string]*partitionCounter
+	lastPartition atomic.Pointer[partitionCounter] // 最近记录的分区，RecordPartition 的快速路径
+	retainers     []Retainer
+	heapGrowth    *HeapGrowth
+	batchPhases   [batchPhaseCount]phaseAmp
+	release       ReleaseCheck
+	ackHoles      *AckHoleStats
+	receive       receiveCounters
+	sizes         sizeCounters
+	ack           AckStats
+	ackBatches    AckBatchStats
+	queueSize     int
+	queueSource   QueueSource
+	memoryLimit   atomic.Int64 // SetClientMemoryLimit，0 表示不限制
+	model         *ModelConfig
+	queue         queueCounters
+	gcTrace       []GCTraceRecord
+	phases        []phaseMark
+	phase         atomic.Pointer[string] // 当前 phase，RecordPhase 的快速路径
+	keys          *keyTracker
+	storms        []stormMark
+	sampleHook    func(MemoryStats)
+	messageRollup int64 // SetMessageRollup，0 表示不输出按消息数的 rollup
+	sidecars      []trackedProcess
+	changes       []ConfigChange // RecordChange，审计日志
 	wg            sync.WaitGroup
 }
 
@@ -69,105 +162,387 @@ func NewMemoryMonitor() (*MemoryMonitor, error) {
 		return nil, fmt.Errorf("failed to get process: %w", err)
 	}
 
+	start := time.Now()
 	return &MemoryMonitor{
-		stats:     make([]MemoryStats, 0, 1000),
-		startTime: time.Now(),
-		pid:       pid,
-		proc:      proc,
-		stopCh:    make(chan struct{}),
+		stats:      make([]MemoryStats, 0, 1000),
+		startTime:  start,
+		clock:      clock.Real,
+		pid:        pid,
+		proc:       proc,
+		metadata:   map[string]string{metaStartWall: start.Format(time.RFC3339Nano)},
+		partitions: make(map[string]*partitionCounter),
 	}, nil
 }
 
-// Start 开始定期采集内存数据
-func (m *MemoryMonitor) Start(interval time.Duration) {
+// Start 开始定期采集内存数据，ctx 取消或调用 Stop 后停止
+//
+// 每次采集以 interval 为期限，/proc 读取或客户端指标汇总卡住时该次采样被丢弃，
+// 不会拖住采集循环。每个 MemoryMonitor 只应 Start 一次，Stop 之后再 Start 什么也不做。
+func (m *MemoryMonitor) Start(ctx context.Context, interval time.Duration) {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+	// 与 stopped 在同一把锁下登记，并发的 Stop 要么看到 cancel 并等待循环退出，要么让 Start 直接返回
 	m.wg.Add(1)
+	m.mu.Unlock()
+
 	go func() {
 		defer m.wg.Done()
-		ticker := time.NewTicker(interval)
+		ticker := m.clock.NewTicker(interval)
 		defer ticker.Stop()
 
+		collect := func() {
+			sctx, cancel := context.WithTimeout(ctx, interval)
+			defer cancel()
+			if _, err := m.CollectContext(sctx); err != nil && ctx.Err() == nil {
+				log.Printf("Memory sample skipped: %v", err)
+			}
+		}
+
 		// 立即采集一次
-		m.Collect()
+		collect()
 
 		for {
 			select {
-			case <-ticker.C:
-				m.Collect()
-			case <-m.stopCh:
+			case <-ticker.C():
+				collect()
+			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 }
 
-// Stop 停止采集
+// Stop 停止采集并等待采集循环退出，可重复调用；未 Start 时直接返回，之后的 Start 也不再采集
+//
+// 进行中的采样随 ctx 一起取消，因此 Stop 不会被卡住的采样阻塞
 func (m *MemoryMonitor) Stop() {
-	close(m.stopCh)
+	m.mu.Lock()
+	m.stopped = true
+	cancel := m.cancel
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
 	m.wg.Wait()
 }
 
 // Collect 采集一次内存数据
 func (m *MemoryMonitor) Collect() MemoryStats {
+	return m.collect(context.Background())
+}
+
+// CollectContext 在 ctx 期限内采集一次内存数据，超时返回 ctx.Err() 且不记录该样本
+func (m *MemoryMonitor) CollectContext(ctx context.Context) (MemoryStats, error) {
+	done := make(chan MemoryStats, 1)
+	go func() { done <- m.collect(ctx) }()
+	var s MemoryStats
+	select {
+	case s = <-done:
+	case <-ctx.Done():
+	}
+	if err := ctx.Err(); err != nil {
+		m.mu.Lock()
+		m.skipped++
+		m.mu.Unlock()
+		return MemoryStats{}, err
+	}
+	return s, nil
+}
+
+func (m *MemoryMonitor) collect(ctx context.Context) MemoryStats {
+	start := time.Now()
 	var ms runtime.MemStats
 	runtime.ReadMemStats(&ms)
+	memStatsTime := time.Since(start)
+
+	gcTotal, gcAssist := gcCPU()
+	pacing := readGCPacing()
+	heapClasses := readHeapClasses()
 
 	var rss, vms uint64
-	if memInfo, err := m.proc.MemoryInfo(); err == nil {
+	procStart := time.Now()
+	if memInfo, err := m.proc.MemoryInfoWithContext(ctx); err == nil {
 		rss = memInfo.RSS
 		vms = memInfo.VMS
 	}
+	m.mu.RLock()
+	sidecars := m.sidecars
+	m.mu.RUnlock()
+	sidecarRSS := readSidecars(ctx, sidecars)
+	system := readSystemMemory(ctx)
+	procTime := time.Since(procStart)
 
 	m.mu.RLock()
-	msgCount := m.messageCount
-	msgBytes := m.messageBytes
-	batchCount := m.batchCount
+	client := m.client
+	queueSource := m.queueSourceLocked()
 	m.mu.RUnlock()
+	c := m.counters.snapshot()
 
 	stats := MemoryStats{
-		Timestamp:    time.Now(),
-		HeapAlloc:    ms.HeapAlloc,
-		HeapSys:      ms.HeapSys,
-		HeapInuse:    ms.HeapInuse,
-		HeapIdle:     ms.HeapIdle,
-		HeapReleased: ms.HeapReleased,
-		HeapObjects:  ms.HeapObjects,
-		StackInuse:   ms.StackInuse,
-		StackSys:     ms.StackSys,
-		MSpanInuse:   ms.MSpanInuse,
-		MCacheInuse:  ms.MCacheInuse,
-		Sys:          ms.Sys,
-		TotalAlloc:   ms.TotalAlloc,
-		NumGC:        ms.NumGC,
-		PauseTotalNs: ms.PauseTotalNs,
-		RSS:          rss,
-		VMS:          vms,
-		MessageCount: msgCount,
-		MessageBytes: msgBytes,
-		BatchCount:   batchCount,
+		Timestamp:       m.clock.Now(),
+		HeapAlloc:       ms.HeapAlloc,
+		HeapSys:         ms.HeapSys,
+		HeapInuse:       ms.HeapInuse,
+		HeapIdle:        ms.HeapIdle,
+		HeapReleased:    ms.HeapReleased,
+		HeapObjects:     ms.HeapObjects,
+		StackInuse:      ms.StackInuse,
+		StackSys:        ms.StackSys,
+		Goroutines:      runtime.NumGoroutine(),
+		MSpanInuse:      ms.MSpanInuse,
+		MCacheInuse:     ms.MCacheInuse,
+		Sys:             ms.Sys,
+		TotalAlloc:      ms.TotalAlloc,
+		NumGC:           ms.NumGC,
+		PauseTotalNs:    ms.PauseTotalNs,
+		GCCPUFraction:   ms.GCCPUFraction,
+		GCCPUSeconds:    gcTotal,
+		GCAssistSeconds: gcAssist,
+		NextGC:          ms.NextGC,
+		HeapLive:        pacing.heapLive,
+		GOGC:            pacing.gogc,
+		GOMemLimit:      pacing.memLimit,
+		RSS:             rss,
+		VMS:             vms,
+		MessageCount:    c.messageCount,
+		MessageBytes:    c.messageBytes,
+		WireBytes:       c.wireBytes,
+		BatchCount:      c.batchCount,
+		UnackedCount:    c.unackedCount,
+		FilteredCount:   c.filtered,
+		PendingAcks:     c.pendingAcks,
+		BufferedAcks:    c.bufferedAcks,
+		RedeliveryCount: c.redeliveries,
+		CorruptCount:    c.corrupted,
+		SysMemTotal:     system.total,
+		SysMemAvailable: system.available,
+		SwapUsed:        system.swapUsed,
+		MemPressure:     system.pressure,
 	}
+	stats.Elapsed = stats.Timestamp.Sub(m.startTime).Seconds()
+	stats.HeapClassObjects = heapClasses
+	if sidecarRSS != nil {
+		stats.SidecarRSS, stats.TotalRSS = sidecarRSS, rss
+		for _, v := range sidecarRSS {
+			stats.TotalRSS += v
+		}
+	}
+	if ms.NextGC > 0 {
+		stats.LiveGoalRatio = float64(pacing.heapLive) / float64(ms.NextGC)
+	}
+	var clientTime time.Duration
+	if client != nil {
+		clientStart := time.Now()
+		stats.Client = newClientSample(client.Snapshot())
+		clientTime = time.Since(clientStart)
+	}
+	m.estimateQueue(queueSource, &stats)
+	if !c.lastPublish.IsZero() {
+		stats.LastPublishTime = c.lastPublish.UnixMilli()
+		stats.LagMs = stats.Timestamp.Sub(c.lastPublish).Milliseconds()
+	}
+	m.sampleLatency(&stats)
 
+	// 期限已过的样本 RSS 可能不完整，丢弃而不是混入统计
 	m.mu.Lock()
-	m.stats = append(m.stats, stats)
+	m.overhead.record(time.Since(start), memStatsTime, procTime, clientTime)
+	kept := ctx.Err() == nil
+	if kept {
+		if n := len(m.stats); n > 0 {
+			stats.GapMs = clockGap(&m.stats[n-1], &stats)
+		}
+		m.stats = append(m.stats, stats)
+	}
+	hook := m.sampleHook
 	m.mu.Unlock()
+	if kept && hook != nil {
+		hook(stats)
+	}
 
 	return stats
 }
 
-// RecordMessage 记录消息处理
-func (m *MemoryMonitor) RecordMessage(bytes int64) {
+// SetSampleHook 每个保留下来的样本采集后调用 f (在采集 goroutine 中，f 不应阻塞)，用于逐条推送到时序数据库
+func (m *MemoryMonitor) SetSampleHook(f func(MemoryStats)) {
 	m.mu.Lock()
-	m.messageCount++
-	m.messageBytes += bytes
+	m.sampleHook = f
 	m.mu.Unlock()
 }
 
+// SetClientMetrics 关联客户端指标，之后每次采样同时记录客户端关键指标
+func (m *MemoryMonitor) SetClientMetrics(c *ClientMetrics) {
+	m.mu.Lock()
+	m.client = c
+	m.mu.Unlock()
+}
+
+// SetTopRetainers 设置最终堆 profile 的 top retainers，随统计数据一起保存
+func (m *MemoryMonitor) SetTopRetainers(r []Retainer) {
+	m.mu.Lock()
+	m.retainers = r
+	m.mu.Unlock()
+}
+
+// RecordMessage 记录消息处理，bytes 同时计入消息大小分布
+func (m *MemoryMonitor) RecordMessage(bytes int64) {
+	m.counters.messageCount.Add(1)
+	m.counters.messageBytes.Add(bytes)
+	m.sizes.record(bytes)
+}
+
+// partitionCounter 单个分区的累计值，lastID 在生成摘要时才格式化，避免每条消息分配字符串
+type partitionCounter struct {
+	topic  string
+	count  atomic.Int64
+	bytes  atomic.Int64
+	mu     sync.Mutex // 只保护 lastID，各分区互不竞争
+	lastID fmt.Stringer
+}
+
+// RecordPartition 记录消息所属的分区 (分区 topic 名) 及其 MessageID。
+// 与上一条消息同一分区时 (非分区 topic 总是如此，分区 topic 也常连续收到同一分区的消息)
+// 只做一次原子读取和字符串比较；其他已存在的分区持有读锁查找，新分区才需要写锁
+func (m *MemoryMonitor) RecordPartition(topic string, bytes int64, id fmt.Stringer) {
+	p := m.lastPartition.Load()
+	if p == nil || p.topic != topic {
+		p = m.partition(topic)
+		m.lastPartition.Store(p)
+	}
+	p.count.Add(1)
+	p.bytes.Add(bytes)
+	p.mu.Lock()
+	p.lastID = id
+	p.mu.Unlock()
+}
+
+// partition 查找或创建 topic 的计数器
+func (m *MemoryMonitor) partition(topic string) *partitionCounter {
+	m.mu.RLock()
+	p, ok := m.partitions[topic]
+	m.mu.RUnlock()
+	if ok {
+		return p
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok = m.partitions[topic]; !ok {
+		p = &partitionCounter{topic: topic}
+		m.partitions[topic] = p
+	}
+	return p
+}
+
+// PartitionStats 单个分区的消费统计
+type PartitionStats struct {
+	MessageCount  int64  `json:"message_count"`
+	MessageBytes  int64  `json:"message_bytes"`
+	LastMessageID string `json:"last_message_id"`
+}
+
+// GetPartitionStats 获取各分区统计
+func (m *MemoryMonitor) GetPartitionStats() map[string]PartitionStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[string]PartitionStats, len(m.partitions))
+	for topic, p := range m.partitions {
+		s := PartitionStats{MessageCount: p.count.Load(), MessageBytes: p.bytes.Load()}
+		p.mu.Lock()
+		if p.lastID != nil {
+			s.LastMessageID = p.lastID.String()
+		}
+		p.mu.Unlock()
+		result[topic] = s
+	}
+	return result
+}
+
+// RecordWireBytes 记录消息的估算线路字节数
+func (m *MemoryMonitor) RecordWireBytes(bytes int64) {
+	m.counters.wireBytes.Add(bytes)
+}
+
 // RecordBatch 记录批次完成
 func (m *MemoryMonitor) RecordBatch() {
+	m.counters.batchCount.Add(1)
+}
+
+// RecordUnacked 记录一条故意跳过确认的消息
+func (m *MemoryMonitor) RecordUnacked() {
+	m.counters.unackedCount.Add(1)
+}
+
+// RecordFiltered 记录一条过滤掉的消息，消息本身仍需通过 RecordMessage 计入
+func (m *MemoryMonitor) RecordFiltered(bytes int64) {
+	m.counters.filtered.Add(1)
+	m.counters.filteredSize.Add(bytes)
+}
+
+// RecordRedelivery 记录一条重投递的消息
+func (m *MemoryMonitor) RecordRedelivery() {
+	m.counters.redeliveries.Add(1)
+}
+
+// SetMetadata 记录一项运行元数据 (配置、seed 等)，随统计数据一起保存
+func (m *MemoryMonitor) SetMetadata(key, value string) {
 	m.mu.Lock()
-	m.batchCount++
+	m.metadata[key] = value
 	m.mu.Unlock()
 }
 
+// GetMetadata 获取运行元数据副本
+func (m *MemoryMonitor) GetMetadata() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[string]string, len(m.metadata))
+	for k, v := range m.metadata {
+		result[k] = v
+	}
+	return result
+}
+
+// SetLabels 设置 -labels 标签，写入 stats 文件和摘要，并随 Collector 导出 (由 ClientMetrics 附加)
+func (m *MemoryMonitor) SetLabels(labels map[string]string) {
+	m.mu.Lock()
+	m.labels = labels
+	m.mu.Unlock()
+}
+
+// GetLabels 获取标签，未设置时为 nil
+func (m *MemoryMonitor) GetLabels() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.labels
+}
+
+// RecordVerification 记录一次 payload 校验结果: nil 为通过，
+// payload.ErrNoHeader 为无法校验 (没有头部或 checksum)，其余为损坏
+func (m *MemoryMonitor) RecordVerification(err error) {
+	switch {
+	case err == nil:
+		m.counters.verified.Add(1)
+	case errors.Is(err, payload.ErrNoHeader):
+		m.counters.unverifiable.Add(1)
+	default:
+		m.counters.corrupted.Add(1)
+	}
+}
+
+// RecordDecodeError 记录一次 payload 反序列化失败
+func (m *MemoryMonitor) RecordDecodeError() {
+	m.counters.decodeErrors.Add(1)
+}
+
+// GetVerification 获取校验计数
+func (m *MemoryMonitor) GetVerification() (verified, corrupted, unverifiable int64) {
+	c := m.counters.snapshot()
+	return c.verified, c.corrupted, c.unverifiable
+}
+
 // GetStats 获取所有统计数据
 func (m *MemoryMonitor) GetStats() []MemoryStats {
 	m.mu.RLock()
@@ -179,50 +554,189 @@ func (m *MemoryMonitor) GetStats() []MemoryStats {
 
 // GetCurrentStats 获取当前统计
 func (m *MemoryMonitor) GetCurrentStats() (msgCount, msgBytes, batchCount int64) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.messageCount, m.messageBytes, m.batchCount
+	c := m.counters.snapshot()
+	return c.messageCount, c.messageBytes, c.batchCount
 }
 
 // MemorySummary 内存统计摘要
 type MemorySummary struct {
-	Duration     time.Duration `json:"duration"`
-	MessageCount int64         `json:"message_count"`
-	MessageBytes int64         `json:"message_bytes"`
-	BatchCount   int64         `json:"batch_count"`
-	SampleCount  int           `json:"sample_count"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Duration       time.Duration     `json:"duration"`
+	MessageCount   int64             `json:"message_count"`
+	MessageBytes   int64             `json:"message_bytes"`
+	WireBytes      int64             `json:"wire_bytes"`
+	BatchCount     int64             `json:"batch_count"`
+	SampleCount    int               `json:"sample_count"`
+	SkippedSamples int64             `json:"skipped_samples,omitempty"` // 超过采集期限被丢弃的采样数
+
+	// 样本流中墙钟与单调时钟的不连续 (系统休眠/挂起或墙钟跳变)；Duration 和各项速率按单调时钟计算，不含休眠时间
+	ClockGaps  int   `json:"clock_gaps,omitempty"`
+	ClockGapMs int64 `json:"clock_gap_ms,omitempty"` // 各次不连续中墙钟多走的毫秒数之和
+
+	UnackedCount    int64 `json:"unacked_count"`
+	RedeliveryCount int64 `json:"redelivery_count"`
+	// 过滤掉的消息，已计入 MessageCount/MessageBytes
+	FilteredCount int64 `json:"filtered_count,omitempty"`
+	FilteredBytes int64 `json:"filtered_bytes,omitempty"`
+	// 推迟中的确认数 (-ack-delay) 的峰值和均值，这些消息在客户端和 broker 上仍按未确认跟踪
+	MaxPendingAcks int64   `json:"max_pending_acks,omitempty"`
+	AvgPendingAcks float64 `json:"avg_pending_acks,omitempty"`
+
+	MaxBufferedAcks int64   `json:"max_buffered_acks,omitempty"`
+	AvgBufferedAcks float64 `json:"avg_buffered_acks,omitempty"`
+
+	// payload 校验
+	VerifiedCount     int64 `json:"verified_count"`
+	CorruptCount      int64 `json:"corrupt_count"`
+	UnverifiableCount int64 `json:"unverifiable_count"`
+	DecodeErrors      int64 `json:"decode_errors"`
+
+	// ReleasePayload 之后访问 payload 的检查结果，未开启检查时为空
+	ReleaseCheck *ReleaseCheck `json:"release_check,omitempty"`
+
+	// 批次索引确认的空洞检查结果，未开启 -check-ack-holes 时为空
+	AckHoles *AckHoleStats `json:"ack_holes,omitempty"`
+
+	// 端到端 (发布到处理) 和批次 (第一条消息加入到整批确认) 延迟，EnableLatency 之后才有
+	Latency      *latency.Summary `json:"latency,omitempty"`
+	BatchLatency *latency.Summary `json:"batch_latency,omitempty"`
+
+	// 每条消息从 Receive 到 Ack 的持有时长，以及按 Little 定律 (平均持有时长 x 字节到达速率) 估算的平均缓冲字节数
+	Holding      *latency.Summary `json:"holding,omitempty"`
+	HoldingBytes float64          `json:"holding_bytes,omitempty"`
+
+	// Receive 阻塞时长直方图和 receiver queue 占用，生产端为空
+	Receive *ReceiveStats `json:"receive,omitempty"`
+	Queue   *QueueStats   `json:"queue,omitempty"`
+
+	// 消费端内存模型的预测与实际峰值对比，未 SetModel 时为空
+	Model *ModelReport `json:"model,omitempty"`
+	// 基于模型的 what-if 配置建议，按估算节省量排序
+	Advice []Advice `json:"advice,omitempty"`
+
+	// 消费到的 payload 大小分布，生产端为空
+	MessageSizes *SizeStats `json:"message_sizes,omitempty"`
+
+	// AckWithResponse 的确认往返耗时，未开启时为空
+	Ack *AckStats `json:"ack,omitempty"`
+
+	// 确认批次 (-ack-batch-size/-ack-batch-interval) 的发出次数和原因，未开启时为空
+	AckBatches *AckBatchStats `json:"ack_batches,omitempty"`
+
+	// 按消息 phase property 划分的各段，未收到带 phase 的消息时为空
+	Phases []PhaseStats `json:"phases,omitempty"`
+
+	// consumer -redelivery-storm 的各次风暴及其后的内存，未触发时为空
+	Storms []StormStats `json:"storms,omitempty"`
+
+	// 样本间最大的 HeapAlloc/RSS 上升及其附近的批次/事件，按上升量排序
+	Jumps []Jump `json:"jumps,omitempty"`
+
+	// 按 key 的顺序和到达间隔，EnableKeyStats 之后才有，逐 key 明细见 StatsOutput.Keys
+	Keys *KeyStats `json:"keys,omitempty"`
+
+	// 定期 heap profile 快照 (consumer -profile-every/-profile-interval) 首尾之间增长最多的分配位置
+	HeapGrowth *HeapGrowth `json:"heap_growth,omitempty"`
+
+	// BeginRegion/End 记录的区域数，明细见 StatsOutput.Regions
+	RegionCount int `json:"region_count,omitempty"`
+
+	// 运行中的配置修改数，明细见审计日志 (SaveAuditLog)
+	ConfigChanges int `json:"config_changes,omitempty"`
+
+	// 监控器自身的采集耗时和内存占用
+	MonitorOverhead *MonitorOverhead `json:"monitor_overhead,omitempty"`
+
+	// 框架自身每条消息代码的分配 (-alloc-audit)
+	HarnessAllocs []AllocProbe `json:"harness_allocs,omitempty"`
 
 	// HeapAlloc 统计 (字节)
-	MinHeapAlloc uint64  `json:"min_heap_alloc"`
-	MaxHeapAlloc uint64  `json:"max_heap_alloc"`
-	AvgHeapAlloc float64 `json:"avg_heap_alloc"`
-	FinalHeapAlloc uint64 `json:"final_heap_alloc"`
+	MinHeapAlloc   uint64  `json:"min_heap_alloc"`
+	MaxHeapAlloc   uint64  `json:"max_heap_alloc"`
+	AvgHeapAlloc   float64 `json:"avg_heap_alloc"`
+	FinalHeapAlloc uint64  `json:"final_heap_alloc"`
 
 	// RSS 统计 (字节)
-	MinRSS uint64  `json:"min_rss"`
-	MaxRSS uint64  `json:"max_rss"`
-	AvgRSS float64 `json:"avg_rss"`
-	FinalRSS uint64 `json:"final_rss"`
+	MinRSS   uint64  `json:"min_rss"`
+	MaxRSS   uint64  `json:"max_rss"`
+	AvgRSS   float64 `json:"avg_rss"`
+	FinalRSS uint64  `json:"final_rss"`
+
+	// TrackProcess 登记的同机进程的 RSS，以及本进程与它们合计 RSS 的峰值 (整机内存占用)
+	Sidecars    []SidecarSummary `json:"sidecars,omitempty"`
+	MaxTotalRSS uint64           `json:"max_total_rss,omitempty"`
+
+	// 运行期间整机的内存、swap 和内存 PSI，样本中没有整机数据时为空
+	System *SystemMemoryStats `json:"system,omitempty"`
 
 	// HeapInuse 统计 (字节)
 	MinHeapInuse uint64  `json:"min_heap_inuse"`
 	MaxHeapInuse uint64  `json:"max_heap_inuse"`
 	AvgHeapInuse float64 `json:"avg_heap_inuse"`
 
+	// HeapInuse 与 HeapAlloc 之差 (span 中的空闲槽位) 和按 size class 区间的存活对象数，
+	// 用于判断 RSS 放大是否来自 size class 碎片
+	Fragmentation *HeapFragmentation `json:"fragmentation,omitempty"`
+	HeapClasses   []HeapClassStats   `json:"heap_classes,omitempty"`
+
 	// GC 统计
-	NumGC        uint32 `json:"num_gc"`
+	NumGC        uint32  `json:"num_gc"`
 	PauseTotalMs float64 `json:"pause_total_ms"`
 
+	// GC CPU 开销: 高分配速率下 GC 抢走的 CPU 与峰值堆同样重要
+	GCCPUFraction   float64 `json:"gc_cpu_fraction"`   // 最后一个样本的 GCCPUFraction
+	GCCPUSeconds    float64 `json:"gc_cpu_seconds"`    // 采样期间的 GC CPU 时间
+	GCAssistSeconds float64 `json:"gc_assist_seconds"` // 采样期间的 mark assist CPU 时间
+
+	// GC 步调
+	MaxNextGC        uint64  `json:"max_next_gc"`
+	AvgLiveGoalRatio float64 `json:"avg_live_goal_ratio"`
+	MaxLiveGoalRatio float64 `json:"max_live_goal_ratio"`
+	GOGC             int64   `json:"gogc"`       // 最后一个样本
+	GOMemLimit       int64   `json:"gomemlimit"` // 最后一个样本
+
+	// 批次之间主动触发的 GC (runtime.GC 或 FreeOSMemory) 次数和调用方阻塞的总时长
+	ForcedGCs  int64   `json:"forced_gcs,omitempty"`
+	ForcedGCMs float64 `json:"forced_gc_ms,omitempty"`
+
+	// gctrace 统计，未开启 -gctrace 时为 0
+	GCTraceCycles int     `json:"gc_trace_cycles,omitempty"`
+	MaxGCPauseMs  float64 `json:"max_gc_pause_ms,omitempty"` // 单次 GC 最长 STW
+	AvgGCPauseMs  float64 `json:"avg_gc_pause_ms,omitempty"`
+
 	// 内存放大倍数
-	HeapRatio float64 `json:"heap_ratio"` // MaxHeapAlloc / MessageBytes
-	RSSRatio  float64 `json:"rss_ratio"`  // MaxRSS / MessageBytes
+	HeapRatio     float64 `json:"heap_ratio"`      // MaxHeapAlloc / MessageBytes
+	RSSRatio      float64 `json:"rss_ratio"`       // MaxRSS / MessageBytes
+	HeapWireRatio float64 `json:"heap_wire_ratio"` // MaxHeapAlloc / WireBytes
+	RSSWireRatio  float64 `json:"rss_wire_ratio"`  // MaxRSS / WireBytes
+
+	// 按批次阶段 (处理前、确认后释放前、释放并 GC 后) 拆分的放大倍数，consumer 逐批次记录
+	BatchPhases []PhaseAmplification `json:"batch_phases,omitempty"`
+
+	// 客户端指标: 采样期间的峰值和结束时的完整快照
+	MaxPrefetchedMessages float64            `json:"max_prefetched_messages,omitempty"`
+	MaxPrefetchedBytes    float64            `json:"max_prefetched_bytes,omitempty"`
+	MaxConnections        float64            `json:"max_connections,omitempty"`
+	Connections           *ConnectionStats   `json:"connections,omitempty"`
+	ClientMetrics         map[string]float64 `json:"client_metrics,omitempty"`
+
+	// 消费延迟 (毫秒)
+	MaxLagMs      int64   `json:"max_lag_ms,omitempty"`
+	FinalLagMs    int64   `json:"final_lag_ms,omitempty"`
+	CatchUpRate   float64 `json:"catch_up_rate,omitempty"`    // 结束前 10s 窗口内的追赶速度
+	TimeToDrainMs int64   `json:"time_to_drain_ms,omitempty"` // 按 CatchUpRate 推算，-1 表示未在追赶
+
+	// 分区统计，PartitionSkew = 最多分区的消息数 / 平均每分区消息数
+	Partitions    map[string]PartitionStats `json:"partitions,omitempty"`
+	PartitionSkew float64                   `json:"partition_skew,omitempty"`
 }
 
 // GetSummary 计算内存统计摘要
 func (m *MemoryMonitor) GetSummary() MemorySummary {
-	stats := m.GetStats()
+	stats := m.samples()
 	summary := MemorySummary{
-		Duration:    time.Since(m.startTime),
+		Labels:      m.GetLabels(),
+		Duration:    m.clock.Since(m.startTime),
 		SampleCount: len(stats),
 	}
 
@@ -238,6 +752,8 @@ func (m *MemoryMonitor) GetSummary() MemorySummary {
 
 	// 计算总和用于平均值
 	var totalHeap, totalRSS, totalHeapInuse uint64
+	var totalLiveGoal float64
+	var totalPendingAcks, totalBufferedAcks int64
 
 	for _, s := range stats {
 		// HeapAlloc
@@ -266,30 +782,134 @@ func (m *MemoryMonitor) GetSummary() MemorySummary {
 			summary.MaxHeapInuse = s.HeapInuse
 		}
 		totalHeapInuse += s.HeapInuse
+
+		summary.MaxLagMs = max(summary.MaxLagMs, s.LagMs)
+		summary.MaxPendingAcks = max(summary.MaxPendingAcks, s.PendingAcks)
+		totalPendingAcks += s.PendingAcks
+		summary.MaxBufferedAcks = max(summary.MaxBufferedAcks, s.BufferedAcks)
+		totalBufferedAcks += s.BufferedAcks
+
+		summary.MaxNextGC = max(summary.MaxNextGC, s.NextGC)
+		summary.MaxLiveGoalRatio = max(summary.MaxLiveGoalRatio, s.LiveGoalRatio)
+		totalLiveGoal += s.LiveGoalRatio
+
+		if c := s.Client; c != nil {
+			summary.MaxPrefetchedMessages = max(summary.MaxPrefetchedMessages, c.PrefetchedMessages)
+			summary.MaxPrefetchedBytes = max(summary.MaxPrefetchedBytes, c.PrefetchedBytes)
+			summary.MaxConnections = max(summary.MaxConnections, c.Connections)
+		}
 	}
 
 	// 计算平均值
 	n := uint64(len(stats))
 	summary.AvgHeapAlloc = float64(totalHeap) / float64(n)
+	summary.AvgPendingAcks = float64(totalPendingAcks) / float64(n)
+	summary.AvgBufferedAcks = float64(totalBufferedAcks) / float64(n)
 	summary.AvgRSS = float64(totalRSS) / float64(n)
 	summary.AvgHeapInuse = float64(totalHeapInuse) / float64(n)
+	summary.AvgLiveGoalRatio = totalLiveGoal / float64(n)
 
 	// 最后一个样本的数据
 	last := stats[len(stats)-1]
 	summary.MessageCount = last.MessageCount
 	summary.MessageBytes = last.MessageBytes
+	summary.WireBytes = last.WireBytes
 	summary.BatchCount = last.BatchCount
+	summary.UnackedCount = last.UnackedCount
+	summary.RedeliveryCount = last.RedeliveryCount
+	summary.FilteredCount = last.FilteredCount
+	summary.FilteredBytes = m.counters.filteredSize.Load()
+	summary.VerifiedCount, summary.CorruptCount, summary.UnverifiableCount = m.GetVerification()
+	m.mu.RLock()
+	summary.DecodeErrors = m.counters.decodeErrors.Load()
+	summary.SkippedSamples = m.skipped
+	summary.ClockGaps, summary.ClockGapMs = clockGapStats(stats)
+	summary.Sidecars, summary.MaxTotalRSS = m.sidecarStats(stats)
+	summary.System = systemStats(stats)
+	summary.Fragmentation = fragmentationStats(stats)
+	summary.HeapClasses = heapClassStats(stats)
+	if n := len(m.gcTrace); n > 0 {
+		var total float64
+		for _, r := range m.gcTrace {
+			summary.MaxGCPauseMs = max(summary.MaxGCPauseMs, r.PauseMs())
+			total += r.PauseMs()
+		}
+		summary.GCTraceCycles = n
+		summary.AvgGCPauseMs = total / float64(n)
+	}
+	if m.release.Checked > 0 {
+		release := m.release
+		summary.ReleaseCheck = &release
+	}
+	summary.AckHoles = m.ackHoles
+	summary.Receive = m.receiveStats(stats, summary.Duration)
+	summary.Latency, summary.BatchLatency = m.latencySummaries()
+	summary.Holding, summary.HoldingBytes = m.holdingStats(&summary)
+	summary.Queue = m.queueStats(stats)
+	summary.Model = m.modelReport(stats, &summary)
+	summary.Phases = m.phaseStats(stats, last.Timestamp)
+	summary.Keys, _ = m.keyResults()
+	summary.Storms = m.stormStats(stats, last.Timestamp)
+	summary.Jumps = m.jumps(stats, summary.Phases, summary.Storms)
+	summary.MessageSizes = m.sizeStats()
+	summary.Ack = m.ackStats()
+	summary.AckBatches = m.ackBatchStats()
+	summary.MonitorOverhead = m.overheadStats(summary.Duration)
+	summary.HarnessAllocs = m.harnessAllocs
+	summary.RegionCount = len(m.regions)
+	summary.ConfigChanges = len(m.changes)
+	summary.HeapGrowth = m.heapGrowth
+	summary.BatchPhases = m.batchPhaseStats()
+	client := m.client
+	m.mu.RUnlock()
+	if client != nil {
+		summary.ClientMetrics = client.Snapshot()
+		summary.Connections = connectionStats(stats, summary.ClientMetrics)
+	}
+	summary.Partitions = m.GetPartitionStats()
+	if len(summary.Partitions) > 0 {
+		var total, most int64
+		for _, p := range summary.Partitions {
+			total += p.MessageCount
+			most = max(most, p.MessageCount)
+		}
+		if total > 0 {
+			summary.PartitionSkew = float64(most) / (float64(total) / float64(len(summary.Partitions)))
+		}
+	}
 	summary.FinalHeapAlloc = last.HeapAlloc
+	summary.FinalLagMs = last.LagMs
+	if est, ok := m.EstimateLag(10 * time.Second); ok {
+		summary.CatchUpRate = est.CatchUpRate
+		summary.TimeToDrainMs = est.TimeToDrain.Milliseconds()
+		if est.TimeToDrain < 0 {
+			summary.TimeToDrainMs = -1
+		}
+	}
 	summary.FinalRSS = last.RSS
 	summary.NumGC = last.NumGC
 	summary.PauseTotalMs = float64(last.PauseTotalNs) / 1e6
+	summary.GCCPUFraction = last.GCCPUFraction
+	summary.GCCPUSeconds = last.GCCPUSeconds - first.GCCPUSeconds
+	summary.ForcedGCs = m.counters.forcedGCs.Load()
+	summary.ForcedGCMs = float64(m.counters.forcedGCNs.Load()) / float64(time.Millisecond)
+	summary.GCAssistSeconds = last.GCAssistSeconds - first.GCAssistSeconds
+	summary.GOGC = last.GOGC
+	summary.GOMemLimit = last.GOMemLimit
 
 	// 计算内存放大倍数
 	if last.MessageBytes > 0 {
 		summary.HeapRatio = float64(summary.MaxHeapAlloc) / float64(last.MessageBytes)
 		summary.RSSRatio = float64(summary.MaxRSS) / float64(last.MessageBytes)
 	}
+	if last.WireBytes > 0 {
+		summary.HeapWireRatio = float64(summary.MaxHeapAlloc) / float64(last.WireBytes)
+		summary.RSSWireRatio = float64(summary.MaxRSS) / float64(last.WireBytes)
+	}
 
+	m.mu.RLock()
+	summary.Advice = m.advise(&summary)
+	m.mu.RUnlock()
 	return summary
 }
 
@@ -305,32 +925,224 @@ func (m *MemoryMonitor) PrintSummary() {
 	log.Println("========== Memory Summary ==========")
 	log.Printf("  Duration:      %v", summary.Duration.Round(time.Second))
 	log.Printf("  Samples:       %d", summary.SampleCount)
+	if summary.SkippedSamples > 0 {
+		log.Printf("  Skipped:       %d samples (collection deadline exceeded)", summary.SkippedSamples)
+	}
+	if summary.ClockGaps > 0 {
+		log.Printf("  Clock gaps:    %d (wall clock moved %v more than monotonic; suspend or clock step, excluded from Duration and rates)",
+			summary.ClockGaps, (time.Duration(summary.ClockGapMs) * time.Millisecond).Round(time.Second))
+	}
 	log.Printf("  Messages:      %d", summary.MessageCount)
-	log.Printf("  Data size:     %.2f MB", float64(summary.MessageBytes)/1024/1024)
+	logf("  Data size:     %.2f MB", InUnit(summary.MessageBytes))
+	logf("  Wire size:     %.2f MB (estimated)", InUnit(summary.WireBytes))
 	log.Printf("  Batches:       %d", summary.BatchCount)
+	if summary.UnackedCount > 0 || summary.RedeliveryCount > 0 {
+		log.Printf("  Unacked:       %d", summary.UnackedCount)
+		log.Printf("  Redelivered:   %d", summary.RedeliveryCount)
+	}
+	if summary.MaxPendingAcks > 0 {
+		log.Printf("  Pending acks:  max %d, avg %.0f (acks delayed after processing)", summary.MaxPendingAcks, summary.AvgPendingAcks)
+	}
+	if summary.FilteredCount > 0 {
+		logf("  Filtered:      %d (%.1f%%), %.2f MB acked without processing", summary.FilteredCount,
+			float64(summary.FilteredCount)/float64(summary.MessageCount)*100, InUnit(summary.FilteredBytes))
+	}
+	if summary.VerifiedCount > 0 || summary.CorruptCount > 0 || summary.UnverifiableCount > 0 {
+		log.Printf("  Verified:      %d | Corrupt: %d | Unverifiable: %d",
+			summary.VerifiedCount, summary.CorruptCount, summary.UnverifiableCount)
+	}
+	if summary.DecodeErrors > 0 {
+		log.Printf("  Decode errors: %d", summary.DecodeErrors)
+	}
+	if c := summary.ReleaseCheck; c != nil {
+		log.Printf("  Release check: %d checked | nil %d | empty %d | stale %d | changed %d | properties retained %d",
+			c.Checked, c.Nil, c.Empty, c.Stale, c.Changed, c.PropertiesRetained)
+		if c.Violations() > 0 {
+			log.Printf("  WARNING: Payload() returned data after ReleasePayload %d times", c.Violations())
+		}
+	}
+	if l := summary.Latency; l != nil {
+		log.Printf("  E2E latency:   %s", l)
+	}
+	if l := summary.BatchLatency; l != nil {
+		log.Printf("  Batch latency: %s", l)
+	}
+	if l := summary.Holding; l != nil {
+		log.Printf("  Holding:       %s (receive to ack)", l)
+		logf("                 mean holding x arrival rate = %.2f MB buffered on average (Little's law)", InUnit(summary.HoldingBytes))
+	}
+	if r := summary.Receive; r != nil {
+		log.Printf("  Receive:       %s", r)
+	}
+	if q := summary.Queue; q != nil {
+		log.Printf("  Queued:        %s", q)
+	}
+	if r := summary.Model; r != nil {
+		log.Printf("  Model:         %s", r)
+		log.Printf("                 %s", r.Formula())
+	}
+	if s := summary.MessageSizes; s != nil {
+		log.Printf("  Msg sizes:     %s", s)
+	}
+	if a := summary.Ack; a != nil {
+		log.Printf("  Ack:           %s", a)
+	}
+	if b := summary.AckBatches; b != nil {
+		log.Printf("  Ack batches:   %s | buffered max %d, avg %.0f", b, summary.MaxBufferedAcks, summary.AvgBufferedAcks)
+	}
+	printAckHoles(summary.AckHoles)
+	if summary.RegionCount > 0 {
+		regions := m.GetRegions()
+		top := regions[0]
+		for _, r := range regions[1:] {
+			if r.Allocated > top.Allocated {
+				top = r
+			}
+		}
+		log.Printf("  Regions:       %d recorded | most allocating %q: %v, %s", summary.RegionCount, top.Name, top.Duration.Round(time.Millisecond), top.MemoryDelta)
+	}
+	if summary.ConfigChanges > 0 {
+		log.Printf("  Changes:       %d configuration changes during the run (see the audit log)", summary.ConfigChanges)
+	}
+	if o := summary.MonitorOverhead; o != nil {
+		log.Printf("  Monitor:       %s", o)
+	}
+	if len(summary.HarnessAllocs) > 0 {
+		log.Printf("  Harness:       %s per call", FormatAllocs(summary.HarnessAllocs))
+	}
+	if summary.MaxLagMs > 0 {
+		drain := "n/a"
+		if summary.TimeToDrainMs >= 0 {
+			drain = fmt.Sprintf("%.1fs", float64(summary.TimeToDrainMs)/1000)
+		}
+		log.Printf("  Lag:           max %.1fs | final %.1fs | catch-up %.2fx | drain %s",
+			float64(summary.MaxLagMs)/1000, float64(summary.FinalLagMs)/1000, summary.CatchUpRate, drain)
+	}
 	log.Println("")
-	log.Println("  --- HeapAlloc (MB) ---")
+	logf("  --- HeapAlloc (MB) ---")
 	log.Printf("    Min: %.2f | Max: %.2f | Avg: %.2f | Final: %.2f",
-		float64(summary.MinHeapAlloc)/1024/1024,
-		float64(summary.MaxHeapAlloc)/1024/1024,
-		summary.AvgHeapAlloc/1024/1024,
-		float64(summary.FinalHeapAlloc)/1024/1024)
+		InUnit(summary.MinHeapAlloc),
+		InUnit(summary.MaxHeapAlloc),
+		InUnit(summary.AvgHeapAlloc),
+		InUnit(summary.FinalHeapAlloc))
 	log.Println("")
-	log.Println("  --- RSS (MB) ---")
+	logf("  --- RSS (MB) ---")
 	log.Printf("    Min: %.2f | Max: %.2f | Avg: %.2f | Final: %.2f",
-		float64(summary.MinRSS)/1024/1024,
-		float64(summary.MaxRSS)/1024/1024,
-		summary.AvgRSS/1024/1024,
-		float64(summary.FinalRSS)/1024/1024)
+		InUnit(summary.MinRSS),
+		InUnit(summary.MaxRSS),
+		InUnit(summary.AvgRSS),
+		InUnit(summary.FinalRSS))
+	printSidecars(summary)
+	printSystem(summary.System)
 	log.Println("")
-	log.Println("  --- HeapInuse (MB) ---")
+	logf("  --- HeapInuse (MB) ---")
 	log.Printf("    Min: %.2f | Max: %.2f | Avg: %.2f",
-		float64(summary.MinHeapInuse)/1024/1024,
-		float64(summary.MaxHeapInuse)/1024/1024,
-		summary.AvgHeapInuse/1024/1024)
+		InUnit(summary.MinHeapInuse),
+		InUnit(summary.MaxHeapInuse),
+		InUnit(summary.AvgHeapInuse))
+	printHeapClasses(summary)
 	log.Println("")
 	log.Printf("  --- GC ---")
 	log.Printf("    Count: %d | Total pause: %.2f ms", summary.NumGC, summary.PauseTotalMs)
+	log.Printf("    CPU fraction: %.2f%% | GC CPU: %.2fs (mark assist %.2fs)",
+		summary.GCCPUFraction*100, summary.GCCPUSeconds, summary.GCAssistSeconds)
+	logf("    Heap goal: max %.2f MB | live/goal avg %.2f, max %.2f | GOGC %d | GOMEMLIMIT %s",
+		InUnit(summary.MaxNextGC), summary.AvgLiveGoalRatio, summary.MaxLiveGoalRatio,
+		summary.GOGC, formatMemLimit(summary.GOMemLimit))
+	if summary.ForcedGCs > 0 {
+		log.Printf("    Forced between batches: %d | blocked %.2f ms total, %.2f ms avg",
+			summary.ForcedGCs, summary.ForcedGCMs, summary.ForcedGCMs/float64(summary.ForcedGCs))
+	}
+	if summary.GCTraceCycles > 0 {
+		log.Printf("    gctrace: %d cycles | STW pause avg %.3f ms, max %.3f ms",
+			summary.GCTraceCycles, summary.AvgGCPauseMs, summary.MaxGCPauseMs)
+	}
+
+	if len(summary.Partitions) > 1 {
+		log.Println("")
+		log.Printf("  --- Partitions (skew %.2fx) ---", summary.PartitionSkew)
+		topics := make([]string, 0, len(summary.Partitions))
+		for t := range summary.Partitions {
+			topics = append(topics, t)
+		}
+		sort.Strings(topics)
+		for _, t := range topics {
+			p := summary.Partitions[t]
+			logf("    %s: %d msgs, %.2f MB, last %s",
+				t, p.MessageCount, InUnit(p.MessageBytes), p.LastMessageID)
+		}
+	}
+
+	if len(summary.Phases) > 0 {
+		log.Println("")
+		log.Println("  --- Phases ---")
+		for _, p := range summary.Phases {
+			logf("    %s: %d msgs, %.2f MB in %.1fs (%.2f MB/s) | max heap %.2f MB, avg heap %.2f MB, max RSS %.2f MB (%d samples)",
+				p.Name, p.Messages, InUnit(p.Bytes), float64(p.DurationMs)/1000, InUnit(p.BytesPerSec),
+				InUnit(p.MaxHeapAlloc), InUnit(p.AvgHeapAlloc), InUnit(p.MaxRSS), p.Samples)
+		}
+	}
+
+	if len(summary.Storms) > 0 {
+		log.Println("")
+		log.Println("  --- Redelivery storms ---")
+		for i, s := range summary.Storms {
+			logf("    #%d %s: nacked %d, redelivered %d | heap %.2f MB before, max %.2f MB after | max RSS %.2f MB | max queued %d (%d samples)",
+				i+1, s.Start.Format("15:04:05"), s.Nacked, s.Redelivered, InUnit(s.HeapBefore),
+				InUnit(s.MaxHeapAlloc), InUnit(s.MaxRSS), s.MaxQueued, s.Samples)
+		}
+	}
+
+	if len(summary.Jumps) > 0 {
+		log.Println("")
+		log.Println("  --- Largest jumps ---")
+		for i, j := range summary.Jumps {
+			event := ""
+			if j.Event != "" {
+				event = fmt.Sprintf(" | near %s (%+.1fs)", j.Event, float64(j.EventOffsetMs)/1000)
+			}
+			logf("    #%d %s %-10s +%.2f MB (%.2f -> %.2f MB) at batch %d, %d msgs%s",
+				i+1, j.Time.Format("15:04:05"), j.Metric, InUnit(j.Delta),
+				InUnit(j.From), InUnit(j.To), j.Batches, j.Messages, event)
+		}
+	}
+
+	if g := summary.HeapGrowth; g != nil {
+		log.Println("")
+		log.Printf("  --- Heap growth (snapshot #%d -> #%d over %v) ---", g.First.Seq, g.Last.Seq, g.Last.Time.Sub(g.First.Time).Round(time.Second))
+		logf("    inuse %+.2f MB | goroutines %d -> %d (%+d) | %d snapshots",
+			InUnit(g.InuseDelta), g.First.Goroutines, g.Last.Goroutines, g.GoroutineDelta, g.Snapshots)
+		for i, site := range g.Sites[:min(len(g.Sites), 10)] {
+			logf("    #%d %+.2f MB (%.2f -> %.2f MB) %s", i+1, InUnit(site.Delta),
+				InUnit(site.FirstBytes), InUnit(site.LastBytes), site.Function)
+		}
+	}
+
+	if k := summary.Keys; k != nil {
+		log.Println("")
+		log.Println("  --- Keys ---")
+		log.Printf("    %d keys, %d msgs | out-of-order: %d msgs in %d keys | duplicates: %d | unordered: %d",
+			k.Keys, k.Messages, k.OutOfOrder, k.OutOfOrderKeys, k.Duplicates, k.Unordered)
+		log.Printf("    Max gap per key: max %.0f ms, median %.0f ms", k.MaxGapMs, k.MedianMaxGapMs)
+		for _, r := range k.Starved {
+			log.Printf("    %s: max gap %.0f ms, %d msgs, %s - %s", r.Key, r.MaxGapMs, r.Messages,
+				r.First.Format("15:04:05.000"), r.Last.Format("15:04:05.000"))
+		}
+		if k.OutOfOrder > 0 {
+			log.Printf("    WARNING: %d messages arrived out of order within their key", k.OutOfOrder)
+		}
+	}
+
+	if summary.ClientMetrics != nil {
+		log.Println("")
+		log.Println("  --- Client ---")
+		logf("    Max prefetched: %.0f msgs, %.2f MB | Max connections: %.0f | Lookups: %.0f",
+			summary.MaxPrefetchedMessages, InUnit(summary.MaxPrefetchedBytes),
+			summary.MaxConnections, summary.ClientMetrics["pulsar_client_lookup_count"])
+		if c := summary.Connections; c != nil {
+			log.Printf("    Connections: avg %.1f, final %.0f | opened %.0f, closed %.0f", c.Avg, c.Final, c.Opened, c.Closed)
+		}
+	}
 
 	// 计算内存放大倍数
 	if summary.MessageBytes > 0 {
@@ -338,59 +1150,59 @@ func (m *MemoryMonitor) PrintSummary() {
 		log.Println("  --- Memory Amplification ---")
 		log.Printf("    MaxHeapAlloc/DataSize: %.2fx", summary.HeapRatio)
 		log.Printf("    MaxRSS/DataSize:       %.2fx", summary.RSSRatio)
+		log.Printf("    MaxHeapAlloc/WireSize: %.2fx", summary.HeapWireRatio)
+		log.Printf("    MaxRSS/WireSize:       %.2fx", summary.RSSWireRatio)
 	}
+	if len(summary.BatchPhases) > 0 {
+		log.Println("")
+		log.Println("  --- Amplification by batch phase (memory / batch payload) ---")
+		for _, p := range summary.BatchPhases {
+			logf("    %-10s heap avg %.2fx, max %.2fx | RSS avg %.2fx, max %.2fx | avg HeapAlloc %.2f MB over %d batches",
+				p.Phase, p.AvgHeapRatio, p.MaxHeapRatio, p.AvgRSSRatio, p.MaxRSSRatio, InUnit(p.AvgHeapAlloc), p.Batches)
+		}
+	}
+
+	if len(summary.Advice) > 0 {
+		log.Println("")
+		log.Println("  --- What-if ---")
+		for _, a := range summary.Advice {
+			log.Printf("    -%s=%s: %s", a.Setting, a.Suggested, a.Text)
+		}
+	}
+	log.Println("")
+	log.Println(MachineSummary(summary))
 	log.Println("====================================")
 }
 
 // StatsOutput 保存到文件的输出格式
 type StatsOutput struct {
-	Summary MemorySummary `json:"summary"`
-	Samples []MemoryStats `json:"samples,omitempty"`
-}
-
-// SaveToFile 保存统计数据到文件
-func (m *MemoryMonitor) SaveToFile(filename string) error {
-	output := StatsOutput{
-		Summary: m.GetSummary(),
-		Samples: m.GetStats(),
-	}
-
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(output)
+	SchemaVersion int               `json:"schema_version"` // StatsSchemaVersion，旧文件由 LoadStats 迁移
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"` // -labels，适用于文件中的全部样本和 rollup
+	Summary       MemorySummary     `json:"summary"`
+	TopRetainers  []Retainer        `json:"top_retainers,omitempty"` // 最终堆 profile 中 inuse_space 最大的调用栈
+	GCTrace       []GCTraceRecord   `json:"gc_trace,omitempty"`      // gctrace 解析出的每次 GC，按 cycle 与样本的 num_gc 对应
+	Regions       []RegionRecord    `json:"regions,omitempty"`       // BeginRegion/End 记录的测量区域
+	Rollups       []RollupRow       `json:"rollups,omitempty"`       // 按 RollupInterval 汇总的样本
+	MsgRollups    []MsgRollupRow    `json:"msg_rollups,omitempty"`   // SetMessageRollup 时按累计消息数汇总的样本
+	Keys          []KeyRecord       `json:"keys,omitempty"`          // EnableKeyStats 时的逐 key 记录，按消息数排序
+	Samples       []MemoryStats     `json:"samples,omitempty"`
 }
 
 // SaveSummaryToFile 仅保存摘要到文件
 func (m *MemoryMonitor) SaveSummaryToFile(filename string) error {
 	summary := m.GetSummary()
-
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(summary)
+	return results.WriteFile(filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summary)
+	})
 }
 
 // WriteHeapProfile 写入堆内存 profile
 func WriteHeapProfile(filename string) error {
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
 	runtime.GC() // 先触发 GC 获取更准确的数据
-	return pprof.WriteHeapProfile(f)
+	return results.WriteFile(filename, pprof.WriteHeapProfile)
 }
 
 // ForceGC 强制执行 GC
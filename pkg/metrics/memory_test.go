@@ -0,0 +1,90 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/metrics"
+)
+
+// waitFor 等待采样 goroutine 处理完 Fake 发出的事件
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestMonitorFakeClock 用 clock.Fake 驱动采样: 每次 Advance 一个间隔得到一个样本，
+// 样本时间戳、Elapsed、摘要时长和按分钟的 rollup 都由 Fake 的时间决定
+func TestMonitorFakeClock(t *testing.T) {
+	m, err := metrics.NewMemoryMonitor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 30, 0, time.UTC)
+	fake := clock.NewFake(start)
+	m.SetClock(fake)
+
+	const interval = 10 * time.Second
+	m.Start(context.Background(), interval)
+	// Start 立即采集一个样本，Ticker 建好后才能 Advance
+	waitFor(t, "first sample", func() bool { return fake.Waiters() == 1 && len(m.GetStats()) == 1 })
+	for i := 1; i <= 9; i++ {
+		m.RecordMessage(100)
+		fake.Advance(interval)
+		waitFor(t, "sample", func() bool { return len(m.GetStats()) == i+1 })
+	}
+	m.Stop()
+	if n := fake.Waiters(); n != 0 {
+		t.Fatalf("Waiters after Stop = %d, want 0 (ticker stopped)", n)
+	}
+
+	stats := m.GetStats()
+	for i, s := range stats {
+		want := start.Add(time.Duration(i) * interval)
+		if !s.Timestamp.Equal(want) {
+			t.Errorf("sample %d at %v, want %v", i, s.Timestamp, want)
+		}
+		if want := float64(i) * interval.Seconds(); s.Elapsed != want {
+			t.Errorf("sample %d elapsed %v, want %v", i, s.Elapsed, want)
+		}
+		if s.MessageCount != int64(i) {
+			t.Errorf("sample %d message count %d, want %d", i, s.MessageCount, i)
+		}
+	}
+
+	s := m.GetSummary()
+	if s.SampleCount != 10 || s.Duration != 90*time.Second || s.MessageCount != 9 || s.MessageBytes != 900 {
+		t.Fatalf("summary: %d samples, %v, %d messages, %d bytes; want 10, 1m30s, 9, 900",
+			s.SampleCount, s.Duration, s.MessageCount, s.MessageBytes)
+	}
+
+	// 00:00:30-00:00:50、00:01:00-00:01:50、00:02:00 三个整分钟区间
+	rows := metrics.Rollup(stats, metrics.RollupInterval)
+	want := []struct {
+		start    time.Time
+		samples  int
+		messages int64
+	}{
+		{start.Truncate(time.Minute), 3, 2},
+		{start.Truncate(time.Minute).Add(time.Minute), 6, 6},
+		{start.Truncate(time.Minute).Add(2 * time.Minute), 1, 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("%d rollup rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		r := rows[i]
+		if !r.Start.Equal(w.start) || r.Samples != w.samples || r.Messages != w.messages || r.MessageBytes != w.messages*100 {
+			t.Errorf("rollup %d: start %v, %d samples, %d messages, %d bytes; want %v, %d, %d, %d",
+				i, r.Start, r.Samples, r.Messages, r.MessageBytes, w.start, w.samples, w.messages, w.messages*100)
+		}
+	}
+}
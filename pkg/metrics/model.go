@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+// ModelConfig 消费端内存模型的配置输入，由消费者在创建完成后通过 SetModel 设置
+type ModelConfig struct {
+	BaselineHeap  uint64 // 客户端和消费者创建完成、开始消费前的 HeapAlloc
+	BaselineRSS   uint64 // 同一时刻的 RSS
+	Consumers     int    // 消费者 (订阅) 数，每个各有一个队列和批次，0 视为 1
+	QueueSize     int    // 每个消费者的 ReceiverQueueSize (消息数)
+	BatchBytes    int64  // 每个消费者触发批处理的累计字节数
+	PipelineDepth int    // Receive 与处理之间的 channel 容量，同步模式为 0
+
+	// 以下只用于 Advise 生成建议
+	ReleasePayload bool
+	RetainIDOnly   bool
+}
+
+// consumers Consumers，未设置时为 1
+func (c *ModelConfig) consumers() int {
+	return max(c.Consumers, 1)
+}
+
+// ModelReport 内存模型的拟合结果、按配置上限的预测值和实际峰值
+//
+// 模型: 常驻消息数 N = Consumers × (QueueSize + BatchBytes/AvgMessageSize) + PipelineDepth，
+// 存活堆 live = BaselineHeap + N × BytesPerMessage，峰值堆 heap = live × (1 + GOGC/100)，
+// RSS = heap + (BaselineRSS - BaselineHeap)。BytesPerMessage 由本次运行的样本拟合:
+// 各样本的 HeapLive - BaselineHeap 对常驻消息数 (批次内消息数 + 队列估算) 做过原点的最小二乘，
+// 因此已包含 payload、Message 对象、ReleasePayload/-retain=id 的效果等全部按消息计的开销。
+type ModelReport struct {
+	BaselineHeap       uint64  `json:"baseline_heap"`
+	AvgMessageSize     float64 `json:"avg_message_size"`
+	BytesPerMessage    float64 `json:"bytes_per_message"`    // 每条常驻消息的存活堆开销 (拟合)
+	OverheadPerMessage float64 `json:"overhead_per_message"` // BytesPerMessage - AvgMessageSize，负值表示 payload 未常驻
+	FitSamples         int     `json:"fit_samples"`
+	ResidentMessages   float64 `json:"resident_messages"` // 配置上限下的常驻消息数 N
+	GOGC               int64   `json:"gogc"`
+
+	PredictedLive uint64 `json:"predicted_live"`
+	PredictedHeap uint64 `json:"predicted_heap"`
+	PredictedRSS  uint64 `json:"predicted_rss"`
+	ObservedLive  uint64 `json:"observed_live"` // 样本中 HeapLive 的最大值
+	ObservedHeap  uint64 `json:"observed_heap"` // MaxHeapAlloc
+	ObservedRSS   uint64 `json:"observed_rss"`  // MaxRSS
+
+	// (实际 - 预测) / 预测；接近 0 说明公式可以用于容量规划，明显为负说明运行未达到配置上限
+	HeapError float64 `json:"heap_error"`
+	RSSError  float64 `json:"rss_error"`
+}
+
+// SetModel 设置内存模型的配置，GetSummary 时据此生成 ModelReport
+func (m *MemoryMonitor) SetModel(cfg ModelConfig) {
+	m.mu.Lock()
+	m.model = &cfg
+	m.mu.Unlock()
+}
+
+// modelReport 拟合并预测，未 SetModel、没有消息或没有可用样本时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) modelReport(stats []MemoryStats, summary *MemorySummary) *ModelReport {
+	cfg := m.model
+	if cfg == nil || summary.MessageCount == 0 || len(stats) == 0 {
+		return nil
+	}
+	r := &ModelReport{
+		BaselineHeap:   cfg.BaselineHeap,
+		AvgMessageSize: float64(summary.MessageBytes) / float64(summary.MessageCount),
+		GOGC:           stats[len(stats)-1].GOGC,
+		ObservedHeap:   summary.MaxHeapAlloc,
+		ObservedRSS:    summary.MaxRSS,
+	}
+
+	// 批次内消息数: 距最近一次 BatchCount 增加时的 MessageCount 增量，过滤掉的消息不进入批次
+	var sumXY, sumXX float64
+	batchStart := stats[0].MessageCount - stats[0].FilteredCount
+	for i, s := range stats {
+		if i > 0 && s.BatchCount > stats[i-1].BatchCount {
+			batchStart = s.MessageCount - s.FilteredCount
+		}
+		r.ObservedLive = max(r.ObservedLive, s.HeapLive)
+		resident := float64(s.MessageCount-s.FilteredCount-batchStart) + float64(s.QueuedMessages)
+		if s.HeapLive == 0 || resident == 0 {
+			continue
+		}
+		y := float64(s.HeapLive) - float64(cfg.BaselineHeap)
+		sumXY += resident * y
+		sumXX += resident * resident
+		r.FitSamples++
+	}
+	if sumXX == 0 {
+		return nil
+	}
+	r.BytesPerMessage = sumXY / sumXX
+	r.OverheadPerMessage = r.BytesPerMessage - r.AvgMessageSize
+
+	r.ResidentMessages = float64(cfg.consumers())*(float64(cfg.QueueSize)+float64(cfg.BatchBytes)/r.AvgMessageSize) + float64(cfg.PipelineDepth)
+	live := math.Max(float64(cfg.BaselineHeap)+r.ResidentMessages*r.BytesPerMessage, 0)
+	heap := live
+	if r.GOGC > 0 {
+		heap = live * (1 + float64(r.GOGC)/100)
+	}
+	rss := math.Max(heap+float64(cfg.BaselineRSS)-float64(cfg.BaselineHeap), 0)
+	r.PredictedLive, r.PredictedHeap, r.PredictedRSS = uint64(live), uint64(heap), uint64(rss)
+	if heap > 0 {
+		r.HeapError = (float64(r.ObservedHeap) - heap) / heap
+	}
+	if rss > 0 {
+		r.RSSError = (float64(r.ObservedRSS) - rss) / rss
+	}
+	return r
+}
+
+// Formula 以本次运行的参数写出的容量规划公式
+func (r *ModelReport) Formula() string {
+	f := fmt.Sprintf("%.1f MB + (consumers × (queue_size + batch_bytes/%.0f) + pipeline_depth) × %.0f B",
+		float64(r.BaselineHeap)/1024/1024, r.AvgMessageSize, r.BytesPerMessage)
+	if r.GOGC > 0 {
+		return fmt.Sprintf("heap ≈ (%s) × (1 + %d/100)", f, r.GOGC)
+	}
+	return "heap ≈ " + f
+}
+
+// String 一行摘要
+func (r *ModelReport) String() string {
+	return fmt.Sprintf("%.0f B/msg (payload %.0f + overhead %.0f, %d samples) | N=%.0f | heap predicted %.2f MB, observed %.2f MB (%+.1f%%) | RSS predicted %.2f MB, observed %.2f MB (%+.1f%%)",
+		r.BytesPerMessage, r.AvgMessageSize, r.OverheadPerMessage, r.FitSamples, r.ResidentMessages,
+		float64(r.PredictedHeap)/1024/1024, float64(r.ObservedHeap)/1024/1024, r.HeapError*100,
+		float64(r.PredictedRSS)/1024/1024, float64(r.ObservedRSS)/1024/1024, r.RSSError*100)
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// SampleMode stats 文件中保存哪些逐秒数据
+type SampleMode string
+
+const (
+	SamplesFull   SampleMode = "full"   // 原始样本和 rollup
+	SamplesRollup SampleMode = "rollup" // 只保存 rollup，长时间运行时文件小两个数量级
+	SamplesNone   SampleMode = "none"   // 只保存摘要等汇总信息
+)
+
+// ParseSampleMode 解析 -samples 参数
+func ParseSampleMode(s string) (SampleMode, error) {
+	switch m := SampleMode(s); m {
+	case SamplesFull, SamplesRollup, SamplesNone:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown sample mode %q (want full|rollup|none)", s)
+	}
+}
+
+// SetMessageRollup 保存时另外按每 every 条已处理消息汇总样本 (StatsOutput.MsgRollups)，0 关闭
+func (m *MemoryMonitor) SetMessageRollup(every int64) {
+	m.mu.Lock()
+	m.messageRollup = every
+	m.mu.Unlock()
+}
+
+// SaveToFile 保存全部统计数据到文件，见 Save
+func (m *MemoryMonitor) SaveToFile(filename string) error {
+	return m.Save(filename, SamplesFull)
+}
+
+// Save 以 JSON 格式保存统计数据到文件，filename 以 .gz 结尾时 gzip 压缩；经 results.WriteFile 原子写入
+//
+// 样本逐个编码写出，不会先把整个 StatsOutput 序列化到内存，也不复制样本切片，
+// 退出时保存长时间运行的结果不会让内存翻倍。输出与 StatsOutput 的 JSON 格式一致。
+func (m *MemoryMonitor) Save(filename string, mode SampleMode) error {
+	return m.SaveAs(filename, mode, jsonEncoder{})
+}
+
+// SaveAs 与 Save 相同，用 enc 编码 (-stats-format)
+func (m *MemoryMonitor) SaveAs(filename string, mode SampleMode, enc Encoder) error {
+	m.mu.RLock()
+	out := StatsOutput{
+		SchemaVersion: StatsSchemaVersion,
+		TopRetainers:  m.retainers,
+		GCTrace:       m.gcTrace,
+	}
+	_, out.Keys = m.keyResults()
+	every := m.messageRollup
+	m.mu.RUnlock()
+	m.setClockMetadata()
+	out.Metadata = m.GetMetadata()
+	out.Labels = m.GetLabels()
+	out.Summary = m.GetSummary()
+	out.Regions = m.GetRegions()
+	samples := m.samples()
+	if mode != SamplesNone {
+		out.Rollups = Rollup(samples, RollupInterval)
+		if every > 0 {
+			out.MsgRollups = MessageRollup(samples, every)
+		}
+	}
+	if mode != SamplesFull {
+		samples = nil
+	}
+
+	return results.WriteFile(filename, func(w io.Writer) error {
+		var gz *gzip.Writer
+		if strings.HasSuffix(filename, ".gz") {
+			gz = gzip.NewWriter(w)
+			w = gz
+		}
+		bw := bufio.NewWriterSize(w, 256<<10)
+		if err := enc.Encode(bw, &out, samples); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			return gz.Close()
+		}
+		return nil
+	})
+}
+
+// samples 返回样本切片的只读视图；样本只追加不修改，持有视图期间继续采样也是安全的
+func (m *MemoryMonitor) samples() []MemoryStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.stats[:len(m.stats):len(m.stats)]
+}
+
+// encodeStats 按 StatsOutput 的字段顺序写出缩进 JSON，samples 逐个编码
+func encodeStats(w *bufio.Writer, out *StatsOutput, samples []MemoryStats) error {
+	// 除 samples 外的字段按原样序列化，再去掉末尾的 "}" 接上样本数组
+	head, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		_, err := w.Write(append(head, '\n'))
+		return err
+	}
+	head = head[:len(head)-len("\n}")]
+	w.Write(head)
+	w.WriteString(",\n  \"samples\": [")
+	for i := range samples {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString("\n    ")
+		b, err := json.MarshalIndent(&samples[i], "    ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err = w.WriteString("\n  ]\n}\n")
+	return err
+}
+
+// LoadStats 读取 Save 写出的 stats 文件，.gz 结尾时先解压；旧版本的文件迁移到当前 schema (MigrateStats)
+func LoadStats(filename string) (StatsOutput, error) {
+	var out StatsOutput
+	f, err := os.Open(filename)
+	if err != nil {
+		return out, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return out, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if err := json.NewDecoder(r).Decode(&out); err != nil {
+		return out, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	if err := MigrateStats(&out); err != nil {
+		return out, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// overheadCounters 监控器自身的采集耗时，只在 collect 中更新 (采样频率，不在热路径上)；由 mu 保护
+type overheadCounters struct {
+	collects int64
+	total    time.Duration
+	max      time.Duration
+	memStats time.Duration // runtime.ReadMemStats，期间 stop-the-world
+	proc     time.Duration // gopsutil 读取 /proc
+	client   time.Duration // 客户端 Registry.Gather
+}
+
+func (o *overheadCounters) record(total, memStats, proc, client time.Duration) {
+	o.collects++
+	o.total += total
+	o.max = max(o.max, total)
+	o.memStats += memStats
+	o.proc += proc
+	o.client += client
+}
+
+// MonitorOverhead 监控器自身的内存和 CPU 开销，便于从上报的数字中扣除观测者的影响
+//
+// 采集耗时为墙钟时间，采集过程几乎全是 CPU (含读取 /proc 的系统调用)，可近似看作 CPU 时间。
+// RetainedBytes 已经包含在堆统计中，对比不同运行时可以直接减去。
+type MonitorOverhead struct {
+	Collections      int64   `json:"collections"`
+	CollectMs        float64 `json:"collect_ms"` // 所有采集的总耗时
+	AvgCollectMs     float64 `json:"avg_collect_ms"`
+	MaxCollectMs     float64 `json:"max_collect_ms"`
+	ReadMemStatsMs   float64 `json:"read_memstats_ms"`
+	ProcReadMs       float64 `json:"proc_read_ms"`
+	ClientSnapshotMs float64 `json:"client_snapshot_ms"`
+	CPURatio         float64 `json:"cpu_ratio"` // CollectMs / 运行时长
+
+	// 样本切片 (按容量)、客户端样本、gctrace 和区域记录占用的堆内存
+	SampleBytes   uint64 `json:"sample_bytes"`
+	ClientBytes   uint64 `json:"client_bytes"`
+	GCTraceBytes  uint64 `json:"gctrace_bytes"`
+	RegionBytes   uint64 `json:"region_bytes"`
+	RetainedBytes uint64 `json:"retained_bytes"`
+}
+
+// overheadStats 生成自身开销统计，没有采集过时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) overheadStats(duration time.Duration) *MonitorOverhead {
+	o := m.overhead
+	if o.collects == 0 {
+		return nil
+	}
+	r := &MonitorOverhead{
+		Collections:      o.collects,
+		CollectMs:        ms(o.total),
+		AvgCollectMs:     ms(o.total) / float64(o.collects),
+		MaxCollectMs:     ms(o.max),
+		ReadMemStatsMs:   ms(o.memStats),
+		ProcReadMs:       ms(o.proc),
+		ClientSnapshotMs: ms(o.client),
+		SampleBytes:      uint64(cap(m.stats)) * uint64(unsafe.Sizeof(MemoryStats{})),
+		GCTraceBytes:     uint64(cap(m.gcTrace)) * uint64(unsafe.Sizeof(GCTraceRecord{})),
+		RegionBytes:      uint64(cap(m.regions)) * uint64(unsafe.Sizeof(RegionRecord{})),
+	}
+	for i := range m.stats {
+		if m.stats[i].Client != nil {
+			r.ClientBytes += uint64(unsafe.Sizeof(ClientSample{}))
+		}
+	}
+	r.RetainedBytes = r.SampleBytes + r.ClientBytes + r.GCTraceBytes + r.RegionBytes
+	if duration > 0 {
+		r.CPURatio = float64(o.total) / float64(duration)
+	}
+	return r
+}
+
+// String 一行摘要
+func (o *MonitorOverhead) String() string {
+	return fmt.Sprintf("%d collections, %.2f MB retained | collect avg %.3f ms, max %.3f ms, %.3f%% of run | memstats %.1f ms, proc %.1f ms, client %.1f ms",
+		o.Collections, float64(o.RetainedBytes)/1024/1024, o.AvgCollectMs, o.MaxCollectMs, o.CPURatio*100,
+		o.ReadMemStatsMs, o.ProcReadMs, o.ClientSnapshotMs)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"time"
+)
+
+// PhaseStats 按消息 phase property 划分的一段消费 (如 producer -compression-sweep 的一种压缩设置)。
+// 段内峰值取自段内的样本，前一段留在队列和批次中的消息也计入；短于采样间隔的段没有样本
+type PhaseStats struct {
+	Name         string    `json:"name"`
+	Start        time.Time `json:"start"`
+	DurationMs   int64     `json:"duration_ms"`
+	Messages     int64     `json:"messages"`
+	Bytes        int64     `json:"bytes"`
+	MsgsPerSec   float64   `json:"msgs_per_s"`
+	BytesPerSec  float64   `json:"bytes_per_s"`
+	Samples      int       `json:"samples"`
+	MaxHeapAlloc uint64    `json:"max_heap_alloc"`
+	AvgHeapAlloc float64   `json:"avg_heap_alloc"`
+	MaxRSS       uint64    `json:"max_rss"`
+
+	LegacyMBPerSec float64 `json:"mb_per_s,omitempty"` // 版本 1 的文件中以 MiB/s 记录的速率，迁移为 BytesPerSec 后清零
+}
+
+// phaseMark 某个 phase 第一条消息到达时的计数
+type phaseMark struct {
+	name     string
+	start    time.Time
+	messages int64
+	bytes    int64
+}
+
+// RecordPhase 在记录消息前调用，name 为消息的 phase property；与上一条消息不同时开始新的一段。
+// 空 name 忽略，相同 name 只做一次原子读取
+func (m *MemoryMonitor) RecordPhase(name string) {
+	if name == "" {
+		return
+	}
+	if cur := m.phase.Load(); cur != nil && *cur == name {
+		return
+	}
+	c := m.counters.snapshot()
+	m.mu.Lock()
+	m.phases = append(m.phases, phaseMark{name: name, start: m.clock.Now(), messages: c.messageCount, bytes: c.messageBytes})
+	m.mu.Unlock()
+	m.phase.Store(&name)
+}
+
+// phaseStats 各段的统计，没有 RecordPhase 时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) phaseStats(stats []MemoryStats, end time.Time) []PhaseStats {
+	if len(m.phases) == 0 {
+		return nil
+	}
+	c := m.counters.snapshot()
+	out := make([]PhaseStats, len(m.phases))
+	for i, p := range m.phases {
+		next := phaseMark{start: end, messages: c.messageCount, bytes: c.messageBytes}
+		if i+1 < len(m.phases) {
+			next = m.phases[i+1]
+		}
+		ps := PhaseStats{
+			Name:       p.name,
+			Start:      p.start,
+			DurationMs: next.start.Sub(p.start).Milliseconds(),
+			Messages:   next.messages - p.messages,
+			Bytes:      next.bytes - p.bytes,
+		}
+		if secs := next.start.Sub(p.start).Seconds(); secs > 0 {
+			ps.MsgsPerSec = float64(ps.Messages) / secs
+			ps.BytesPerSec = float64(ps.Bytes) / secs
+		}
+		var sum float64
+		for _, s := range stats {
+			if s.Timestamp.Before(p.start) || !s.Timestamp.Before(next.start) {
+				continue
+			}
+			ps.Samples++
+			ps.MaxHeapAlloc = max(ps.MaxHeapAlloc, s.HeapAlloc)
+			ps.MaxRSS = max(ps.MaxRSS, s.RSS)
+			sum += float64(s.HeapAlloc)
+		}
+		if ps.Samples > 0 {
+			ps.AvgHeapAlloc = sum / float64(ps.Samples)
+		}
+		out[i] = ps
+	}
+	return out
+}
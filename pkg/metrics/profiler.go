@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// Profiler 每隔 N 个批次或每隔一段时间保存 heap 和 goroutine profile，结束时比较第一个和最后一个 heap profile，
+// 找出 inuse_space 增长最多的分配位置。结束时的单个 heap profile 分不清峰值高还是持续泄漏，
+// 多个时间点之间的差才能说明客户端是否随时间泄漏。
+//
+// 定期快照不主动触发 GC，heap profile 中的 inuse 数据截至最近一次完成的 GC。
+type Profiler struct {
+	everyBatches int64
+	interval     time.Duration
+	path         func(kind string, seq int) string
+
+	batches   atomic.Int64
+	mu        sync.Mutex
+	snapshots []ProfileSnapshot
+}
+
+// ProfileSnapshot 一次快照
+type ProfileSnapshot struct {
+	Seq           int       `json:"seq"`
+	Time          time.Time `json:"time"`
+	Reason        string    `json:"reason"` // batches|interval|final
+	Batches       int64     `json:"batches"`
+	Goroutines    int       `json:"goroutines"`
+	HeapInuse     uint64    `json:"heap_inuse"`
+	HeapFile      string    `json:"heap_file"`
+	GoroutineFile string    `json:"goroutine_file"`
+}
+
+// NewProfiler everyBatches 和 interval 为 0 的一项不触发快照；path 给出第 seq 个快照的文件名，kind 为 heap 或 goroutine
+func NewProfiler(everyBatches int, interval time.Duration, path func(kind string, seq int) string) *Profiler {
+	return &Profiler{everyBatches: int64(everyBatches), interval: interval, path: path}
+}
+
+// Run 每隔 interval 快照一次直到 ctx 取消，interval 为 0 时直接返回
+func (p *Profiler) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.Capture("interval")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RecordBatch 每处理完一个批次调用，批次数达到 everyBatches 的倍数时快照
+func (p *Profiler) RecordBatch() {
+	n := p.batches.Add(1)
+	if p.everyBatches > 0 && n%p.everyBatches == 0 {
+		p.Capture("batches")
+	}
+}
+
+// Capture 立即保存一次快照，失败只记录日志
+func (p *Profiler) Capture(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := ProfileSnapshot{
+		Seq:        len(p.snapshots) + 1,
+		Time:       time.Now(),
+		Reason:     reason,
+		Batches:    p.batches.Load(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapInuse:  ms.HeapInuse,
+	}
+	s.HeapFile = p.path("heap", s.Seq)
+	s.GoroutineFile = p.path("goroutine", s.Seq)
+	for _, f := range []struct{ name, path string }{{"heap", s.HeapFile}, {"goroutine", s.GoroutineFile}} {
+		err := results.WriteFile(f.path, func(w io.Writer) error {
+			return pprof.Lookup(f.name).WriteTo(w, 0)
+		})
+		if err != nil {
+			log.Printf("Failed to write %s profile snapshot: %v", f.name, err)
+			return
+		}
+	}
+	p.snapshots = append(p.snapshots, s)
+	log.Printf("Profile snapshot #%d (%s, batch %d): %d goroutines, HeapInuse %.2f MB",
+		s.Seq, reason, s.Batches, s.Goroutines, float64(s.HeapInuse)/1024/1024)
+}
+
+// Snapshots 已保存的快照
+func (p *Profiler) Snapshots() []ProfileSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProfileSnapshot(nil), p.snapshots...)
+}
+
+// HeapGrowth 第一个和最后一个快照之间 inuse_space 的变化，Sites 为增长最多的调用栈
+type HeapGrowth struct {
+	First          ProfileSnapshot `json:"first"`
+	Last           ProfileSnapshot `json:"last"`
+	Snapshots      int             `json:"snapshots"`
+	InuseDelta     int64           `json:"inuse_delta"` // profile 中全部 inuse_space 之差
+	GoroutineDelta int             `json:"goroutine_delta"`
+	Sites          []GrowthSite    `json:"sites,omitempty"`
+}
+
+// GrowthSite 一个调用栈的 inuse_space 变化
+type GrowthSite struct {
+	Function   string   `json:"function"`
+	Stack      []string `json:"stack"`
+	FirstBytes int64    `json:"first_bytes"`
+	LastBytes  int64    `json:"last_bytes"`
+	Delta      int64    `json:"delta"`
+}
+
+// Growth 比较第一个和最后一个快照的 heap profile，返回增长最多的 n 个调用栈；少于两个快照时返回 nil
+func (p *Profiler) Growth(n int) (*HeapGrowth, error) {
+	snaps := p.Snapshots()
+	if len(snaps) < 2 {
+		return nil, nil
+	}
+	first, last := snaps[0], snaps[len(snaps)-1]
+	before, beforeTotal, err := inuseByStack(first.HeapFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", first.HeapFile, err)
+	}
+	after, afterTotal, err := inuseByStack(last.HeapFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", last.HeapFile, err)
+	}
+
+	g := &HeapGrowth{
+		First:          first,
+		Last:           last,
+		Snapshots:      len(snaps),
+		InuseDelta:     afterTotal - beforeTotal,
+		GoroutineDelta: last.Goroutines - first.Goroutines,
+	}
+	for key, r := range after {
+		var from int64
+		if b, ok := before[key]; ok {
+			from = b.Bytes
+		}
+		if d := r.Bytes - from; d > 0 {
+			g.Sites = append(g.Sites, GrowthSite{Function: r.Function, Stack: r.Stack, FirstBytes: from, LastBytes: r.Bytes, Delta: d})
+		}
+	}
+	sort.Slice(g.Sites, func(i, j int) bool { return g.Sites[i].Delta > g.Sites[j].Delta })
+	if len(g.Sites) > n {
+		g.Sites = g.Sites[:n]
+	}
+	return g, nil
+}
+
+// SetHeapGrowth 设置定期 profile 快照的首尾对比，写入摘要
+func (m *MemoryMonitor) SetHeapGrowth(g *HeapGrowth) {
+	m.mu.Lock()
+	m.heapGrowth = g
+	m.mu.Unlock()
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// QueueSource receiver queue 占用的估算来源
+type QueueSource string
+
+const (
+	// QueueClient 取 pulsar-client-go 的 prefetched_messages/prefetched_bytes 指标，需要 SetClientMetrics
+	QueueClient QueueSource = "client"
+	// QueueBroker broker 已推送给本消费者的消息数 (topic stats 的 msgOutCounter) 减去 Receive 取走的消息数，
+	// 由调用方定期 SetBrokerDispatched；字节数按平均消息大小估算
+	QueueBroker QueueSource = "broker"
+)
+
+// ParseQueueSource 解析 -queue-estimate 参数
+func ParseQueueSource(s string) (QueueSource, error) {
+	switch q := QueueSource(s); q {
+	case QueueClient, QueueBroker:
+		return q, nil
+	default:
+		return "", fmt.Errorf("unknown queue estimate source %q (want client|broker)", s)
+	}
+}
+
+// queueCounters broker 来源的最新推送计数，由轮询 goroutine 写入
+type queueCounters struct {
+	dispatched atomic.Int64
+	polled     atomic.Bool
+}
+
+// SetQueueSource 设置估算来源，默认在 SetClientMetrics 后使用 QueueClient
+func (m *MemoryMonitor) SetQueueSource(src QueueSource) {
+	m.mu.Lock()
+	m.queueSource = src
+	m.mu.Unlock()
+}
+
+// SetBrokerDispatched 记录 broker 累计推送给本进程消费者的消息数，QueueBroker 来源使用
+func (m *MemoryMonitor) SetBrokerDispatched(messages int64) {
+	m.queue.dispatched.Store(messages)
+	m.queue.polled.Store(true)
+}
+
+// queueSourceLocked 生效的估算来源，无法估算时为空；调用方持有锁
+func (m *MemoryMonitor) queueSourceLocked() QueueSource {
+	if m.queueSource != "" {
+		return m.queueSource
+	}
+	if m.client != nil {
+		return QueueClient
+	}
+	return ""
+}
+
+// estimateQueue 估算采样时刻 receiver queue 中的消息数和字节数，写入 QueuedMessages/QueuedBytes
+//
+// broker 来源的推送计数按轮询间隔更新，总是略旧于本地的 Receive 计数，结果偏低，负值按 0 处理
+func (m *MemoryMonitor) estimateQueue(src QueueSource, s *MemoryStats) {
+	switch src {
+	case QueueClient:
+		if s.Client != nil {
+			s.QueuedMessages = int64(s.Client.PrefetchedMessages)
+			s.QueuedBytes = int64(s.Client.PrefetchedBytes)
+		}
+	case QueueBroker:
+		if !m.queue.polled.Load() {
+			return
+		}
+		s.QueuedMessages = max(0, m.queue.dispatched.Load()-m.receive.received.Load())
+		if s.MessageCount > 0 {
+			s.QueuedBytes = s.QueuedMessages * (s.MessageBytes / s.MessageCount)
+		}
+	}
+}
+
+// QueueStats receiver queue 中缓存的消息，即不体现在业务计数里、只能从堆增长推断的那部分内存
+type QueueStats struct {
+	Source       QueueSource `json:"source"`
+	AvgMessages  float64     `json:"avg_messages"`
+	MaxMessages  int64       `json:"max_messages"`
+	AvgBytes     float64     `json:"avg_bytes"`
+	MaxBytes     int64       `json:"max_bytes"`
+	MaxHeapShare float64     `json:"max_heap_share"` // 各样本 QueuedBytes / HeapInuse 的最大值
+}
+
+// queueStats 由样本生成队列统计，无法估算时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) queueStats(stats []MemoryStats) *QueueStats {
+	src := m.queueSourceLocked()
+	if src == "" || len(stats) == 0 {
+		return nil
+	}
+	q := &QueueStats{Source: src}
+	var msgs, bytes int64
+	for _, s := range stats {
+		msgs += s.QueuedMessages
+		bytes += s.QueuedBytes
+		q.MaxMessages = max(q.MaxMessages, s.QueuedMessages)
+		q.MaxBytes = max(q.MaxBytes, s.QueuedBytes)
+		if s.HeapInuse > 0 {
+			q.MaxHeapShare = max(q.MaxHeapShare, float64(s.QueuedBytes)/float64(s.HeapInuse))
+		}
+	}
+	q.AvgMessages = float64(msgs) / float64(len(stats))
+	q.AvgBytes = float64(bytes) / float64(len(stats))
+	return q
+}
+
+// String 一行摘要
+func (q *QueueStats) String() string {
+	return fmt.Sprintf("avg %.0f msgs (%.2f MB), max %d msgs (%.2f MB) | max %.1f%% of heap in use (%s)",
+		q.AvgMessages, q.AvgBytes/1024/1024, q.MaxMessages, float64(q.MaxBytes)/1024/1024, q.MaxHeapShare*100, q.Source)
+}
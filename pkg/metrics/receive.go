@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// receiveBounds Receive 耗时直方图的桶上界；最后一个桶收集超过 1s 的调用
+var receiveBounds = [...]time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// immediateReceive 低于此耗时的 Receive 视为直接从 receiver queue 取到消息
+const immediateReceive = 100 * time.Microsecond
+
+// receiveCounters 每次 Receive 更新的原子计数，生成摘要时通过 snapshot 转为 receiveHistogram
+type receiveCounters struct {
+	counts   [len(receiveBounds) + 1]atomic.Int64
+	received atomic.Int64
+	timeouts atomic.Int64
+	blocked  atomic.Int64 // ns
+	max      atomic.Int64 // ns
+}
+
+func (c *receiveCounters) snapshot() receiveHistogram {
+	h := receiveHistogram{
+		counts:   make([]int64, len(c.counts)),
+		received: c.received.Load(),
+		timeouts: c.timeouts.Load(),
+		blocked:  time.Duration(c.blocked.Load()),
+		max:      time.Duration(c.max.Load()),
+	}
+	for i := range c.counts {
+		h.counts[i] = c.counts[i].Load()
+	}
+	return h
+}
+
+// receiveHistogram 累计的 Receive 耗时
+type receiveHistogram struct {
+	counts   []int64 // len(receiveBounds)+1
+	received int64
+	timeouts int64
+	blocked  time.Duration // 所有调用 (含超时) 的阻塞总时长
+	max      time.Duration
+}
+
+// ReceiveBucket 直方图的一个桶，LeMs 为上界 (毫秒)，最后一个桶为 0 表示 +Inf
+type ReceiveBucket struct {
+	LeMs  float64 `json:"le_ms"`
+	Count int64   `json:"count"`
+}
+
+// ReceiveStats Receive 阻塞时长与 receiver queue 占用情况
+//
+// 消息已在 receiver queue 中时 Receive 几乎立即返回，内存主要被预取的消息占用 (client-queued)；
+// 队列为空时 Receive 阻塞等待 broker 推送，内存压力来自处理而非预取 (broker-starved)。
+type ReceiveStats struct {
+	Received       int64           `json:"received"`
+	Timeouts       int64           `json:"timeouts"`        // 超时返回 (没有消息) 的调用
+	BlockedMs      float64         `json:"blocked_ms"`      // Receive 阻塞总时长，含超时
+	BlockedRatio   float64         `json:"blocked_ratio"`   // BlockedMs / 运行时长
+	ImmediateRatio float64         `json:"immediate_ratio"` // 收到的消息中耗时 < 100µs 的比例
+	P50Ms          float64         `json:"p50_ms"`          // 按桶上界估算，仅统计收到消息的调用
+	P90Ms          float64         `json:"p90_ms"`
+	P99Ms          float64         `json:"p99_ms"`
+	MaxMs          float64         `json:"max_ms"`
+	Buckets        []ReceiveBucket `json:"buckets"`
+
+	// receiver queue 占用 = 估算的队列消息数 (见 QueueStats) / ReceiverQueueSize，需要 SetReceiverQueueSize
+	QueueSize         int     `json:"queue_size,omitempty"`
+	AvgQueueOccupancy float64 `json:"avg_queue_occupancy,omitempty"`
+	MaxQueueOccupancy float64 `json:"max_queue_occupancy,omitempty"`
+
+	Verdict string `json:"verdict"` // client-queued|broker-starved|mixed
+}
+
+// RecordReceive 记录一次 Receive 调用的耗时，ok 为 false 表示超时没有收到消息
+func (m *MemoryMonitor) RecordReceive(d time.Duration, ok bool) {
+	c := &m.receive
+	c.blocked.Add(int64(d))
+	if !ok {
+		c.timeouts.Add(1)
+		return
+	}
+	i := 0
+	for i < len(receiveBounds) && d > receiveBounds[i] {
+		i++
+	}
+	c.counts[i].Add(1)
+	c.received.Add(1)
+	storeMax(&c.max, int64(d))
+}
+
+// SetReceiverQueueSize 设置 ReceiverQueueSize，用于计算队列占用率
+func (m *MemoryMonitor) SetReceiverQueueSize(n int) {
+	m.mu.Lock()
+	m.queueSize = n
+	m.mu.Unlock()
+}
+
+// percentile 返回累计计数达到 q 的桶上界 (毫秒)，不超过最大值
+func (h *receiveHistogram) percentile(q float64) float64 {
+	target := int64(q * float64(h.received))
+	var cum int64
+	for i, c := range h.counts {
+		cum += c
+		if cum > target || cum == h.received {
+			if i < len(receiveBounds) {
+				return ms(min(receiveBounds[i], h.max))
+			}
+			break
+		}
+	}
+	return ms(h.max)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// receiveStats 生成 Receive 统计，没有 Receive 调用时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) receiveStats(stats []MemoryStats, duration time.Duration) *ReceiveStats {
+	h := m.receive.snapshot()
+	if h.received == 0 && h.timeouts == 0 {
+		return nil
+	}
+	r := &ReceiveStats{
+		Received:  h.received,
+		Timeouts:  h.timeouts,
+		BlockedMs: ms(h.blocked),
+		MaxMs:     ms(h.max),
+		QueueSize: m.queueSize,
+	}
+	if duration > 0 {
+		r.BlockedRatio = float64(h.blocked) / float64(duration)
+	}
+	if h.received > 0 {
+		var immediate int64
+		for i, c := range h.counts {
+			if i < len(receiveBounds) && receiveBounds[i] <= immediateReceive {
+				immediate += c
+			}
+			var le float64
+			if i < len(receiveBounds) {
+				le = ms(receiveBounds[i])
+			}
+			r.Buckets = append(r.Buckets, ReceiveBucket{LeMs: le, Count: c})
+		}
+		r.ImmediateRatio = float64(immediate) / float64(h.received)
+		r.P50Ms, r.P90Ms, r.P99Ms = h.percentile(0.5), h.percentile(0.9), h.percentile(0.99)
+	}
+
+	if m.queueSize > 0 && m.queueSourceLocked() != "" && len(stats) > 0 {
+		var total float64
+		for _, s := range stats {
+			occ := float64(s.QueuedMessages) / float64(m.queueSize)
+			r.MaxQueueOccupancy = max(r.MaxQueueOccupancy, occ)
+			total += occ
+		}
+		r.AvgQueueOccupancy = total / float64(len(stats))
+	}
+
+	switch {
+	case r.ImmediateRatio >= 0.9 && r.BlockedRatio < 0.1:
+		r.Verdict = "client-queued"
+	case r.ImmediateRatio < 0.5 || r.BlockedRatio >= 0.5:
+		r.Verdict = "broker-starved"
+	default:
+		r.Verdict = "mixed"
+	}
+	return r
+}
+
+// String 一行摘要
+func (r *ReceiveStats) String() string {
+	s := fmt.Sprintf("%d received, %d timeouts | p50 %.3f ms, p90 %.3f ms, p99 %.3f ms, max %.3f ms | immediate %.1f%% | blocked %.1f%% of run",
+		r.Received, r.Timeouts, r.P50Ms, r.P90Ms, r.P99Ms, r.MaxMs, r.ImmediateRatio*100, r.BlockedRatio*100)
+	if r.QueueSize > 0 {
+		s += fmt.Sprintf(" | queue occupancy avg %.1f%%, max %.1f%% of %d", r.AvgQueueOccupancy*100, r.MaxQueueOccupancy*100, r.QueueSize)
+	}
+	return s + " => " + r.Verdict
+}
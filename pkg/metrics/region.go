@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// RegionRecord 一个测量区域从 BeginRegion 到 End 的变化量
+type RegionRecord struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	MemoryDelta
+}
+
+// Region 进行中的测量区域，由 BeginRegion 创建，End 结束并记录
+//
+// 边界处各读取一次 MemStats (stop-the-world) 和 /proc，适合批次、阶段这样的粒度，
+// 不要用在每条消息上。Region 不是并发安全的，应在同一个 goroutine 中 Begin 和 End。
+type Region struct {
+	m      *MemoryMonitor
+	name   string
+	before MemoryStats
+	ended  bool
+}
+
+// BeginRegion 开始一个测量区域，End 时区域的耗时、分配量和 GC 次数写入统计输出
+func (m *MemoryMonitor) BeginRegion(name string) *Region {
+	return &Region{m: m, name: name, before: m.Point()}
+}
+
+// End 结束区域并返回记录；重复调用只记录第一次
+func (r *Region) End() RegionRecord {
+	rec := RegionRecord{Name: r.name, Start: r.before.Timestamp}
+	if r.ended {
+		return rec
+	}
+	r.ended = true
+	rec.MemoryDelta = Diff(r.before, r.m.Point())
+
+	r.m.mu.Lock()
+	r.m.regions = append(r.m.regions, rec)
+	r.m.mu.Unlock()
+	return rec
+}
+
+// GetRegions 获取已结束区域的副本
+func (m *MemoryMonitor) GetRegions() []RegionRecord {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]RegionRecord, len(m.regions))
+	copy(result, m.regions)
+	return result
+}
+
+// Point 读取 Diff 需要的字段，不记录为样本；比 Collect 便宜，适合批次内的中间时间点
+func (m *MemoryMonitor) Point() MemoryStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	c := m.counters.snapshot()
+	s := MemoryStats{
+		Timestamp:    m.clock.Now(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		TotalAlloc:   ms.TotalAlloc,
+		NumGC:        ms.NumGC,
+		PauseTotalNs: ms.PauseTotalNs,
+		MessageCount: c.messageCount,
+		MessageBytes: c.messageBytes,
+	}
+	if memInfo, err := m.proc.MemoryInfo(); err == nil {
+		s.RSS = memInfo.RSS
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package metrics
+
+// ReleaseOutcome ReleasePayload 之后再次访问 Payload() 的结果
+type ReleaseOutcome int
+
+const (
+	ReleaseNil     ReleaseOutcome = iota // 返回 nil，符合当前 API 约定
+	ReleaseEmpty                         // 返回非 nil 的空切片
+	ReleaseStale                         // 仍返回释放前的数据，内存实际未释放
+	ReleaseChanged                       // 返回与释放前不同的数据，底层内存已被复用
+)
+
+func (o ReleaseOutcome) String() string {
+	switch o {
+	case ReleaseNil:
+		return "nil"
+	case ReleaseEmpty:
+		return "empty"
+	case ReleaseStale:
+		return "stale"
+	case ReleaseChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// ReleaseCheck 释放后访问检查的计数
+type ReleaseCheck struct {
+	Checked            int64 `json:"checked"`
+	Nil                int64 `json:"nil"`
+	Empty              int64 `json:"empty"`
+	Stale              int64 `json:"stale"`
+	Changed            int64 `json:"changed"`
+	PropertiesRetained int64 `json:"properties_retained"` // Properties() 释放后仍非空
+}
+
+// Violations 违反 "释放后 Payload() 返回 nil" 约定的次数 (空切片不算)
+func (c ReleaseCheck) Violations() int64 {
+	return c.Stale + c.Changed
+}
+
+// RecordReleaseCheck 记录一次释放后访问的结果
+func (m *MemoryMonitor) RecordReleaseCheck(o ReleaseOutcome, propsRetained bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release.Checked++
+	switch o {
+	case ReleaseNil:
+		m.release.Nil++
+	case ReleaseEmpty:
+		m.release.Empty++
+	case ReleaseStale:
+		m.release.Stale++
+	case ReleaseChanged:
+		m.release.Changed++
+	}
+	if propsRetained {
+		m.release.PropertiesRetained++
+	}
+}
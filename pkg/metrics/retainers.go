@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// retainerStackDepth 每个 retainer 记录的调用栈深度
+const retainerStackDepth = 8
+
+// Retainer 按调用栈聚合的常驻内存 (inuse_space)
+type Retainer struct {
+	Function string   `json:"function"` // 分配发生的函数 (栈顶)
+	Stack    []string `json:"stack"`    // 从栈顶开始的调用链
+	Bytes    int64    `json:"bytes"`
+	Percent  float64  `json:"percent"` // 占全部 inuse_space 的百分比
+}
+
+// TopRetainers 解析堆 profile，返回 inuse_space 最大的 n 个调用栈
+func TopRetainers(path string, n int) ([]Retainer, error) {
+	byStack, total, err := inuseByStack(path)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Retainer, 0, len(byStack))
+	for _, r := range byStack {
+		if total > 0 {
+			r.Percent = float64(r.Bytes) / float64(total) * 100
+		}
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Bytes > result[j].Bytes })
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result, nil
+}
+
+// inuseByStack 解析堆 profile，按调用栈 (换行连接) 汇总 inuse_space，返回各调用栈和总量
+func inuseByStack(path string) (map[string]*Retainer, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse heap profile: %w", err)
+	}
+
+	idx := -1
+	for i, st := range p.SampleType {
+		if st.Type == "inuse_space" {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil, 0, fmt.Errorf("heap profile has no inuse_space samples")
+	}
+
+	byStack := make(map[string]*Retainer)
+	var total int64
+	for _, s := range p.Sample {
+		v := s.Value[idx]
+		if v == 0 {
+			continue
+		}
+		total += v
+		stack := sampleStack(s)
+		key := strings.Join(stack, "\n")
+		r, ok := byStack[key]
+		if !ok {
+			r = &Retainer{Stack: stack}
+			if len(stack) > 0 {
+				r.Function = stack[0]
+			}
+			byStack[key] = r
+		}
+		r.Bytes += v
+	}
+	return byStack, total, nil
+}
+
+// sampleStack 取样本的函数调用链 (内联函数展开)，最多 retainerStackDepth 层
+func sampleStack(s *profile.Sample) []string {
+	stack := make([]string, 0, retainerStackDepth)
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			stack = append(stack, line.Function.Name)
+			if len(stack) == retainerStackDepth {
+				return stack
+			}
+		}
+	}
+	return stack
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import "time"
+
+// RollupInterval 输出中 rollup 行的时间粒度
+const RollupInterval = time.Minute
+
+// Range 一个指标在区间内的最小、最大和平均值
+type Range struct {
+	Min uint64  `json:"min"`
+	Max uint64  `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+func (r *Range) add(v uint64, n int) {
+	if n == 0 || v < r.Min {
+		r.Min = v
+	}
+	r.Max = max(r.Max, v)
+	// 增量平均，n 为加入 v 之前的样本数
+	r.Avg += (float64(v) - r.Avg) / float64(n+1)
+}
+
+// RollupRow 一个区间内样本的汇总，多天的运行只看 rollup 就能画图，不需要加载全部原始样本
+//
+// Messages/MessageBytes/NumGC 为区间内的增量 (相对上一区间最后一个样本)，第一个区间相对其首个样本。
+type RollupRow struct {
+	Start        time.Time `json:"start"`
+	Samples      int       `json:"samples"`
+	HeapAlloc    Range     `json:"heap_alloc"`
+	HeapInuse    Range     `json:"heap_inuse"`
+	RSS          Range     `json:"rss"`
+	Messages     int64     `json:"messages"`
+	MessageBytes int64     `json:"message_bytes"`
+	NumGC        uint32    `json:"num_gc"`
+	MaxLagMs     int64     `json:"max_lag_ms,omitempty"`
+	MaxQueued    int64     `json:"max_queued_messages,omitempty"`
+}
+
+// Rollup 按 interval 对齐到墙钟 (如整分钟) 汇总样本，样本应按时间排序；没有样本的区间不输出
+func Rollup(samples []MemoryStats, interval time.Duration) []RollupRow {
+	var rows []RollupRow
+	var prev *MemoryStats
+	for i := range samples {
+		s := &samples[i]
+		start := s.Timestamp.Truncate(interval)
+		if len(rows) == 0 || !rows[len(rows)-1].Start.Equal(start) {
+			rows = append(rows, RollupRow{Start: start})
+			if prev == nil {
+				prev = s
+			}
+		}
+		r := &rows[len(rows)-1]
+		r.HeapAlloc.add(s.HeapAlloc, r.Samples)
+		r.HeapInuse.add(s.HeapInuse, r.Samples)
+		r.RSS.add(s.RSS, r.Samples)
+		r.MaxLagMs = max(r.MaxLagMs, s.LagMs)
+		r.MaxQueued = max(r.MaxQueued, s.QueuedMessages)
+		r.Samples++
+		r.Messages += s.MessageCount - prev.MessageCount
+		r.MessageBytes += s.MessageBytes - prev.MessageBytes
+		r.NumGC += s.NumGC - prev.NumGC
+		prev = s
+	}
+	return rows
+}
+
+// MsgRollupRow 已处理消息数的一个区间内样本的汇总。横轴是累计消息数而不是墙钟，
+// 吞吐不同的运行也能逐行对齐比较每条消息的内存行为
+//
+// Seconds/TotalAlloc/NumGC 为区间内的增量，计算方式与 RollupRow 的 Messages 相同；Seconds 按单调时钟，不含系统休眠。
+type MsgRollupRow struct {
+	Messages        int64   `json:"messages"` // 区间起点的累计消息数 (every 的整数倍)
+	Samples         int     `json:"samples"`
+	Seconds         float64 `json:"seconds"`
+	HeapAlloc       Range   `json:"heap_alloc"`
+	HeapInuse       Range   `json:"heap_inuse"`
+	RSS             Range   `json:"rss"`
+	TotalAlloc      uint64  `json:"total_alloc"`
+	AllocPerMessage float64 `json:"alloc_per_message"` // TotalAlloc / 区间内处理的消息数
+	NumGC           uint32  `json:"num_gc"`
+	MaxQueued       int64   `json:"max_queued_messages,omitempty"`
+}
+
+// MessageRollup 按累计消息数每 every 条汇总样本，样本应按时间排序；没有样本落入的区间不输出，
+// 处理消息之前的样本 (message_count 为 0) 归入第一个区间
+func MessageRollup(samples []MemoryStats, every int64) []MsgRollupRow {
+	var rows []MsgRollupRow
+	var processed []int64 // 各区间内处理的消息数
+	var prev *MemoryStats
+	for i := range samples {
+		s := &samples[i]
+		start := s.MessageCount / every * every
+		if len(rows) == 0 || rows[len(rows)-1].Messages != start {
+			rows = append(rows, MsgRollupRow{Messages: start})
+			processed = append(processed, 0)
+			if prev == nil {
+				prev = s
+			}
+		}
+		r := &rows[len(rows)-1]
+		r.HeapAlloc.add(s.HeapAlloc, r.Samples)
+		r.HeapInuse.add(s.HeapInuse, r.Samples)
+		r.RSS.add(s.RSS, r.Samples)
+		r.MaxQueued = max(r.MaxQueued, s.QueuedMessages)
+		r.Samples++
+		r.Seconds += SampleSeconds(prev, s)
+		r.TotalAlloc += s.TotalAlloc - prev.TotalAlloc
+		r.NumGC += s.NumGC - prev.NumGC
+		processed[len(processed)-1] += s.MessageCount - prev.MessageCount
+		prev = s
+	}
+	for i := range rows {
+		if n := processed[i]; n > 0 {
+			rows[i].AllocPerMessage = float64(rows[i].TotalAlloc) / float64(n)
+		}
+	}
+	return rows
+}
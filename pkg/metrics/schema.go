@@ -0,0 +1,79 @@
+package metrics
+
+import "fmt"
+
+// StatsSchemaVersion 当前 stats 文件的 schema 版本，写在 StatsOutput.SchemaVersion。
+// MemoryStats/MemorySummary 新增字段时旧文件中该字段为零值；若新字段能由已有字段推导，
+// 或字段改名、含义变化，把版本加一并在 statsMigrations 末尾追加一步迁移，
+// LoadStats 读到旧文件时逐步迁移到当前版本，对比和趋势工具只需按当前 schema 处理
+const StatsSchemaVersion = 2
+
+// statsMigrations[v] 把版本 v 的内容迁移到 v+1
+var statsMigrations = []func(*StatsOutput){
+	migrateStatsV0,
+	migrateStatsV1,
+}
+
+// MigrateStats 把 out 从其 SchemaVersion 迁移到当前版本。没有 schema_version 的文件为版本 0；
+// 比当前版本新的文件 (新版本的工具写出) 原样保留，未知字段在解码时已被忽略；
+// 负的版本号不是任何工具写出的，返回错误
+func MigrateStats(out *StatsOutput) error {
+	if out.SchemaVersion < 0 {
+		return fmt.Errorf("invalid schema_version %d", out.SchemaVersion)
+	}
+	for out.SchemaVersion < StatsSchemaVersion {
+		statsMigrations[out.SchemaVersion](out)
+		out.SchemaVersion++
+	}
+	return nil
+}
+
+// migrateStatsV0 版本 0 是引入 schema_version 之前的文件，最早的文件缺少以下可推导的字段:
+// 样本的 elapsed (单调时钟秒数，用相对首个样本的墙钟时间代替)、摘要的 sample_count、duration、
+// heap_ratio 和 rss_ratio
+func migrateStatsV0(out *StatsOutput) {
+	samples := out.Samples
+	if len(samples) > 0 {
+		noElapsed := true
+		for i := range samples {
+			if samples[i].Elapsed != 0 {
+				noElapsed = false
+				break
+			}
+		}
+		if noElapsed {
+			start := samples[0].Timestamp
+			for i := range samples {
+				samples[i].Elapsed = samples[i].Timestamp.Sub(start).Seconds()
+			}
+		}
+	}
+
+	s := &out.Summary
+	if s.SampleCount == 0 {
+		s.SampleCount = len(samples)
+	}
+	if s.Duration == 0 && len(samples) > 1 {
+		s.Duration = samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp)
+	}
+	if s.MessageBytes > 0 {
+		if s.HeapRatio == 0 {
+			s.HeapRatio = float64(s.MaxHeapAlloc) / float64(s.MessageBytes)
+		}
+		if s.RSSRatio == 0 {
+			s.RSSRatio = float64(s.MaxRSS) / float64(s.MessageBytes)
+		}
+	}
+}
+
+// migrateStatsV1 版本 1 的 phase 速率以 MiB/s 记在 mb_per_s，版本 2 改为 bytes_per_s，
+// 与文件中其他大小一样是字节，显示时才按 -size-unit 换算
+func migrateStatsV1(out *StatsOutput) {
+	for i := range out.Summary.Phases {
+		p := &out.Summary.Phases[i]
+		if p.BytesPerSec == 0 {
+			p.BytesPerSec = p.LegacyMBPerSec * (1 << 20)
+		}
+		p.LegacyMBPerSec = 0
+	}
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Sidecar 与 harness 同机运行、需要一并统计内存的进程 (如本机的 Pulsar standalone、proxy)
+type Sidecar struct {
+	Name string
+	PID  int32
+}
+
+// ParseSidecars 解析 -track-pids: 逗号分隔的 [name=]pid，省略 name 时为 pid<N>
+func ParseSidecars(s string) ([]Sidecar, error) {
+	var sidecars []Sidecar
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(f, "=")
+		if !ok {
+			name, value = "", f
+		}
+		pid, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid pid in %q (want [name=]pid)", f)
+		}
+		if name == "" {
+			name = "pid" + value
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate name %q", name)
+		}
+		seen[name] = true
+		sidecars = append(sidecars, Sidecar{Name: name, PID: int32(pid)})
+	}
+	return sidecars, nil
+}
+
+// trackedProcess TrackProcess 登记的进程
+type trackedProcess struct {
+	Sidecar
+	proc *process.Process
+}
+
+// TrackProcess 之后每个样本同时读取 pid 的 RSS，记入 MemoryStats.SidecarRSS 和 TotalRSS；
+// pid 不存在时返回错误。进程中途退出后该进程不再出现在样本中
+func (m *MemoryMonitor) TrackProcess(name string, pid int32) error {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return fmt.Errorf("track %s (pid %d): %w", name, pid, err)
+	}
+	m.mu.Lock()
+	m.sidecars = append(m.sidecars, trackedProcess{Sidecar{name, pid}, proc})
+	m.mu.Unlock()
+	m.SetMetadata("sidecar."+name, strconv.Itoa(int(pid)))
+	return nil
+}
+
+// readSidecars 读取登记进程的 RSS，读不到 (已退出) 的进程不出现在结果中
+func readSidecars(ctx context.Context, sidecars []trackedProcess) map[string]uint64 {
+	if len(sidecars) == 0 {
+		return nil
+	}
+	rss := make(map[string]uint64, len(sidecars))
+	for _, p := range sidecars {
+		if info, err := p.proc.MemoryInfoWithContext(ctx); err == nil {
+			rss[p.Name] = info.RSS
+		}
+	}
+	return rss
+}
+
+// SidecarSummary 一个登记进程在运行期间的 RSS
+type SidecarSummary struct {
+	Name     string  `json:"name"`
+	PID      int32   `json:"pid"`
+	Samples  int     `json:"samples"` // 读到 RSS 的样本数，少于总样本数说明进程中途退出
+	MaxRSS   uint64  `json:"max_rss"`
+	AvgRSS   float64 `json:"avg_rss"`
+	FinalRSS uint64  `json:"final_rss"` // 最后一次读到的 RSS
+}
+
+// sidecarStats 各登记进程的 RSS 统计和 harness 加登记进程的 RSS 峰值；调用方持有 mu
+func (m *MemoryMonitor) sidecarStats(samples []MemoryStats) ([]SidecarSummary, uint64) {
+	if len(m.sidecars) == 0 {
+		return nil, 0
+	}
+	out := make([]SidecarSummary, len(m.sidecars))
+	var maxTotal uint64
+	for i, p := range m.sidecars {
+		s := SidecarSummary{Name: p.Name, PID: p.PID}
+		var sum float64
+		for j := range samples {
+			rss, ok := samples[j].SidecarRSS[p.Name]
+			if !ok {
+				continue
+			}
+			s.Samples++
+			s.MaxRSS = max(s.MaxRSS, rss)
+			s.FinalRSS = rss
+			sum += float64(rss)
+		}
+		if s.Samples > 0 {
+			s.AvgRSS = sum / float64(s.Samples)
+		}
+		out[i] = s
+	}
+	for j := range samples {
+		maxTotal = max(maxTotal, samples[j].TotalRSS)
+	}
+	return out, maxTotal
+}
+
+// printSidecars 打印各登记进程的 RSS 和合计峰值
+func printSidecars(summary MemorySummary) {
+	if len(summary.Sidecars) == 0 {
+		return
+	}
+	mb := InUnit[float64]
+	log.Println("")
+	logf("  --- Sidecar RSS (MB) ---")
+	for _, s := range summary.Sidecars {
+		if s.Samples == 0 {
+			log.Printf("    %s (pid %d): not running", s.Name, s.PID)
+			continue
+		}
+		log.Printf("    %s (pid %d): Max: %.2f | Avg: %.2f | Final: %.2f (%d samples)",
+			s.Name, s.PID, mb(float64(s.MaxRSS)), mb(s.AvgRSS), mb(float64(s.FinalRSS)), s.Samples)
+	}
+	log.Printf("    Total with this process: Max: %.2f", mb(float64(summary.MaxTotalRSS)))
+}
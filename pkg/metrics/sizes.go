@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+)
+
+// sizeBounds 消息大小直方图的桶上界 (字节)，按 4 倍递增；最后一个桶收集超过 4MB 的消息
+var sizeBounds = [...]int64{
+	256,
+	1 << 10,
+	4 << 10,
+	16 << 10,
+	64 << 10,
+	256 << 10,
+	1 << 20,
+	4 << 20,
+}
+
+// sizeCounters 每条消息更新的大小分布，原子计数，生成摘要时读取
+type sizeCounters struct {
+	counts [len(sizeBounds) + 1]atomic.Int64
+	bytes  [len(sizeBounds) + 1]atomic.Int64
+	min    atomic.Int64 // 存储 MaxInt64-size 以复用 storeMax；0 表示尚未记录
+	max    atomic.Int64
+}
+
+func (c *sizeCounters) record(size int64) {
+	i := 0
+	for i < len(sizeBounds) && size > sizeBounds[i] {
+		i++
+	}
+	c.counts[i].Add(1)
+	c.bytes[i].Add(size)
+	storeMax(&c.max, size)
+	storeMax(&c.min, math.MaxInt64-size)
+}
+
+// SizeBucket 直方图的一个桶，LeBytes 为上界，最后一个桶为 0 表示 +Inf
+type SizeBucket struct {
+	LeBytes int64 `json:"le_bytes"`
+	Count   int64 `json:"count"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// SizeStats 消费到的 payload 大小分布
+//
+// 混合大小的流量下分配器行为 (size class、大对象直接走 mheap) 差异很大，
+// 只看总字节数无法解释，需要结合各桶的消息数和字节占比。
+type SizeStats struct {
+	Count   int64        `json:"count"`
+	AvgSize float64      `json:"avg_size"`
+	MinSize int64        `json:"min_size"`
+	MaxSize int64        `json:"max_size"`
+	P50     int64        `json:"p50"` // 按桶上界估算，不超过最大值
+	P90     int64        `json:"p90"`
+	P99     int64        `json:"p99"`
+	Buckets []SizeBucket `json:"buckets"`
+}
+
+// sizeStats 生成消息大小分布，没有消息时返回 nil
+func (m *MemoryMonitor) sizeStats() *SizeStats {
+	c := &m.sizes
+	s := &SizeStats{MaxSize: c.max.Load()}
+	var total int64
+	for i := range c.counts {
+		b := SizeBucket{Count: c.counts[i].Load(), Bytes: c.bytes[i].Load()}
+		if i < len(sizeBounds) {
+			b.LeBytes = sizeBounds[i]
+		}
+		s.Count += b.Count
+		total += b.Bytes
+		s.Buckets = append(s.Buckets, b)
+	}
+	if s.Count == 0 {
+		return nil
+	}
+	s.MinSize = math.MaxInt64 - c.min.Load()
+	s.AvgSize = float64(total) / float64(s.Count)
+	s.P50, s.P90, s.P99 = s.percentile(0.5), s.percentile(0.9), s.percentile(0.99)
+	return s
+}
+
+func (s *SizeStats) percentile(q float64) int64 {
+	target := int64(q * float64(s.Count))
+	var cum int64
+	for _, b := range s.Buckets {
+		cum += b.Count
+		if cum > target || cum == s.Count {
+			if b.LeBytes > 0 {
+				return min(b.LeBytes, s.MaxSize)
+			}
+			break
+		}
+	}
+	return s.MaxSize
+}
+
+// String 一行摘要，桶只列出有消息的部分
+func (s *SizeStats) String() string {
+	var buckets []string
+	for _, b := range s.Buckets {
+		if b.Count == 0 {
+			continue
+		}
+		le := ">" + sizeLabel(sizeBounds[len(sizeBounds)-1])
+		if b.LeBytes > 0 {
+			le = "≤" + sizeLabel(b.LeBytes)
+		}
+		buckets = append(buckets, fmt.Sprintf("%s %.1f%%", le, float64(b.Count)*100/float64(s.Count)))
+	}
+	return fmt.Sprintf("avg %s, min %s, p50 %s, p99 %s, max %s | %s",
+		sizeLabel(int64(s.AvgSize)), sizeLabel(s.MinSize), sizeLabel(s.P50), sizeLabel(s.P99), sizeLabel(s.MaxSize),
+		strings.Join(buckets, ", "))
+}
+
+func sizeLabel(b int64) string {
+	switch {
+	case b >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(b)/(1<<20))
+	case b >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(b)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", b)
+	}
+}
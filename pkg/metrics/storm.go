@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"time"
+)
+
+// StormStats 一次重投递风暴 (consumer -redelivery-storm) 及其到下一次风暴 (或结束) 之间的影响。
+// 窗口内的峰值取自窗口内的样本，短于采样间隔的窗口没有样本
+type StormStats struct {
+	Start        time.Time `json:"start"`
+	Nacked       int64     `json:"nacked"`      // 这次一起 Nack 的未确认消息数
+	Redelivered  int64     `json:"redelivered"` // 窗口内收到的重投递消息数
+	Samples      int       `json:"samples"`
+	HeapBefore   uint64    `json:"heap_before"` // 风暴前最后一个样本的 HeapAlloc
+	MaxHeapAlloc uint64    `json:"max_heap_alloc"`
+	MaxRSS       uint64    `json:"max_rss"`
+	MaxQueued    int64     `json:"max_queued_messages,omitempty"` // 窗口内 receiver queue 的最大估算占用
+}
+
+// stormMark 一次风暴开始时的计数
+type stormMark struct {
+	start        time.Time
+	nacked       int64
+	redeliveries int64
+}
+
+// RecordStorm 记录一次重投递风暴，nacked 为一起 Nack 的消息数
+func (m *MemoryMonitor) RecordStorm(nacked int64) {
+	redeliveries := m.counters.redeliveries.Load()
+	m.mu.Lock()
+	m.storms = append(m.storms, stormMark{start: m.clock.Now(), nacked: nacked, redeliveries: redeliveries})
+	m.mu.Unlock()
+}
+
+// stormStats 各次风暴的统计，没有 RecordStorm 时返回 nil；调用方持有读锁
+func (m *MemoryMonitor) stormStats(stats []MemoryStats, end time.Time) []StormStats {
+	if len(m.storms) == 0 {
+		return nil
+	}
+	redeliveries := m.counters.redeliveries.Load()
+	out := make([]StormStats, len(m.storms))
+	for i, s := range m.storms {
+		next := stormMark{start: end, redeliveries: redeliveries}
+		if i+1 < len(m.storms) {
+			next = m.storms[i+1]
+		}
+		st := StormStats{Start: s.start, Nacked: s.nacked, Redelivered: next.redeliveries - s.redeliveries}
+		for _, sample := range stats {
+			if sample.Timestamp.Before(s.start) {
+				st.HeapBefore = sample.HeapAlloc
+				continue
+			}
+			if !sample.Timestamp.Before(next.start) {
+				break
+			}
+			st.Samples++
+			st.MaxHeapAlloc = max(st.MaxHeapAlloc, sample.HeapAlloc)
+			st.MaxRSS = max(st.MaxRSS, sample.RSS)
+			st.MaxQueued = max(st.MaxQueued, sample.QueuedMessages)
+		}
+		out[i] = st
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// psiMemoryFile Linux 4.20+ 的内存 PSI (pressure stall information)，其它系统或未开启 PSI 时不存在
+const psiMemoryFile = "/proc/pressure/memory"
+
+// 摘要中判断整机处于内存压力的阈值: 可用内存低于总量的比例、PSI some avg10 (%)
+const (
+	lowAvailableRatio = 0.1
+	highMemPressure   = 10.0
+)
+
+// systemMemory 一次采样时整机的内存状况
+type systemMemory struct {
+	total     uint64
+	available uint64
+	swapUsed  uint64
+	pressure  float64 // PSI some avg10，不可用时为 -1
+}
+
+// readSystemMemory 读取整机的内存、swap 和内存 PSI，读取失败的项为 0 (pressure 为 -1)
+func readSystemMemory(ctx context.Context) systemMemory {
+	s := systemMemory{pressure: -1}
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		s.total, s.available = vm.Total, vm.Available
+		if vm.SwapTotal > vm.SwapFree {
+			s.swapUsed = vm.SwapTotal - vm.SwapFree
+		}
+	}
+	if data, err := os.ReadFile(psiMemoryFile); err == nil {
+		s.pressure = parsePSISome(string(data))
+	}
+	return s
+}
+
+// parsePSISome 从 PSI 文件内容中取 "some avg10=" 的值，格式不符时为 -1
+func parsePSISome(data string) float64 {
+	for _, line := range strings.Split(data, "\n") {
+		rest, ok := strings.CutPrefix(line, "some ")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(rest) {
+			if v, ok := strings.CutPrefix(f, "avg10="); ok {
+				if p, err := strconv.ParseFloat(v, 64); err == nil {
+					return p
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// SystemMemoryStats 运行期间整机的内存状况，用于区分 "进程本身增长" 和 "机器本来就缺内存、内核在积极回收"
+type SystemMemoryStats struct {
+	Total           uint64  `json:"total"`
+	MinAvailable    uint64  `json:"min_available"`
+	AvgAvailable    float64 `json:"avg_available"`
+	MaxSwapUsed     uint64  `json:"max_swap_used"`
+	SwapGrowth      int64   `json:"swap_growth"`            // 最后一个样本与第一个样本的 swap 用量之差
+	MaxPressure     float64 `json:"max_pressure,omitempty"` // 内存 PSI some avg10 (%)，系统不支持 PSI 时为 0
+	AvgPressure     float64 `json:"avg_pressure,omitempty"`
+	PressureSamples int     `json:"pressure_samples,omitempty"`      // PSI some avg10 超过 highMemPressure 的样本数
+	LowAvailable    int     `json:"low_available_samples,omitempty"` // 可用内存低于总量 lowAvailableRatio 的样本数
+	UnderPressure   bool    `json:"under_pressure"`                  // 以上任一情况出现或 swap 增长
+}
+
+// systemStats 汇总样本中的整机内存，样本中没有整机数据时为 nil
+func systemStats(samples []MemoryStats) *SystemMemoryStats {
+	var s SystemMemoryStats
+	var sumAvailable, sumPressure float64
+	n, psi := 0, 0
+	var firstSwap, lastSwap uint64
+	for i := range samples {
+		sm := &samples[i]
+		if sm.SysMemTotal == 0 {
+			continue
+		}
+		if n == 0 {
+			s.MinAvailable, firstSwap = sm.SysMemAvailable, sm.SwapUsed
+		}
+		n++
+		lastSwap = sm.SwapUsed
+		s.Total = max(s.Total, sm.SysMemTotal)
+		s.MinAvailable = min(s.MinAvailable, sm.SysMemAvailable)
+		sumAvailable += float64(sm.SysMemAvailable)
+		s.MaxSwapUsed = max(s.MaxSwapUsed, sm.SwapUsed)
+		if float64(sm.SysMemAvailable) < float64(sm.SysMemTotal)*lowAvailableRatio {
+			s.LowAvailable++
+		}
+		if sm.MemPressure >= 0 {
+			psi++
+			sumPressure += sm.MemPressure
+			s.MaxPressure = max(s.MaxPressure, sm.MemPressure)
+			if sm.MemPressure > highMemPressure {
+				s.PressureSamples++
+			}
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	s.AvgAvailable = sumAvailable / float64(n)
+	if psi > 0 {
+		s.AvgPressure = sumPressure / float64(psi)
+	}
+	s.SwapGrowth = int64(lastSwap) - int64(firstSwap)
+	s.UnderPressure = s.LowAvailable > 0 || s.PressureSamples > 0 || s.SwapGrowth > 0
+	return &s
+}
+
+// printSystem 打印整机内存状况，处于压力下时提示结果可能受内核回收影响
+func printSystem(s *SystemMemoryStats) {
+	if s == nil {
+		return
+	}
+	mb := InUnit[float64]
+	log.Println("")
+	logf("  --- System memory (MB) ---")
+	log.Printf("    Total: %.2f | Available min: %.2f, avg: %.2f | Swap used max: %.2f (%+.2f over the run) | PSI some avg10 max: %.2f%%, avg: %.2f%%",
+		mb(float64(s.Total)), mb(float64(s.MinAvailable)), mb(s.AvgAvailable), mb(float64(s.MaxSwapUsed)),
+		mb(float64(s.SwapGrowth)), s.MaxPressure, s.AvgPressure)
+	if s.UnderPressure {
+		logf("    WARNING: the machine was under memory pressure (%d samples with <%.0f%% available, %d with PSI >%.0f%%, swap %+.2f MB); "+
+			"RSS may reflect kernel reclaim rather than the process", s.LowAvailable, lowAvailableRatio*100, s.PressureSamples, highMemPressure, mb(float64(s.SwapGrowth)))
+	}
+}
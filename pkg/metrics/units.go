@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SizeUnit 日志中大小的显示单位 (-size-unit)。stats 和报告文件中的大小始终是字节，不受影响
+type SizeUnit string
+
+const (
+	UnitMiB SizeUnit = "MiB" // 1024*1024 字节，默认；以前标为 "MB" 的数值就是这个单位
+	UnitMB  SizeUnit = "MB"  // SI，1000*1000 字节
+)
+
+// SizeUnitUsage 各命令 -size-unit 参数的帮助文本
+const SizeUnitUsage = "Unit for sizes in the summary logs: MiB (1024*1024 bytes) or MB (SI, 1000*1000 bytes); " +
+	"stats and report files always hold exact bytes, and the summary ends with a machine-summary line of exact byte counts"
+
+// ParseSizeUnit 解析 -size-unit 参数
+func ParseSizeUnit(s string) (SizeUnit, error) {
+	switch u := SizeUnit(s); u {
+	case UnitMiB, UnitMB:
+		return u, nil
+	default:
+		return "", fmt.Errorf("unknown size unit %q (want MiB|MB)", s)
+	}
+}
+
+// sizeUnit 当前的显示单位，进程内所有摘要日志一致
+var sizeUnit = UnitMiB
+
+// SetSizeUnit 设置摘要日志的大小单位，在打印任何摘要之前调用
+func SetSizeUnit(u SizeUnit) {
+	sizeUnit = u
+}
+
+// Unit 当前的显示单位
+func Unit() SizeUnit {
+	return sizeUnit
+}
+
+// Bytes 单位对应的字节数
+func (u SizeUnit) Bytes() float64 {
+	if u == UnitMB {
+		return 1e6
+	}
+	return 1 << 20
+}
+
+// InUnit 字节数换算为当前单位
+func InUnit[T ~int | ~int64 | ~uint64 | ~float64](v T) float64 {
+	return float64(v) / sizeUnit.Bytes()
+}
+
+// mbLabel 日志格式串中作为单位的 MB (含 MB/s)
+var mbLabel = regexp.MustCompile(`\bMB\b`)
+
+// Unitf 把格式串中的 MB 标签换成当前单位，与 InUnit 换算的数值配套使用
+func Unitf(format string) string {
+	if sizeUnit == UnitMB {
+		return format
+	}
+	return mbLabel.ReplaceAllString(format, string(sizeUnit))
+}
+
+// logf 格式串经 Unitf 的 log.Printf
+func logf(format string, args ...any) {
+	log.Printf(Unitf(format), args...)
+}
+
+// MachineField 机器可读摘要的一项
+type MachineField struct {
+	Key   string
+	Value any // 整数或 float64
+}
+
+// FormatMachine 机器可读的摘要行: key=value 以空格分隔，大小为字节，时长为纳秒；
+// 数值不舍入、不带千位分隔符，与 locale 和 -size-unit 无关，脚本可直接解析
+func FormatMachine(prefix string, fields []MachineField) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		switch v := f.Value.(type) {
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// MachineSummary 内存摘要的机器可读行，PrintSummary 的最后一行
+func MachineSummary(s MemorySummary) string {
+	return FormatMachine("machine-summary:", []MachineField{
+		{"duration_ns", int64(s.Duration)},
+		{"samples", s.SampleCount},
+		{"messages", s.MessageCount},
+		{"message_bytes", s.MessageBytes},
+		{"wire_bytes", s.WireBytes},
+		{"min_heap_alloc_bytes", s.MinHeapAlloc},
+		{"max_heap_alloc_bytes", s.MaxHeapAlloc},
+		{"avg_heap_alloc_bytes", s.AvgHeapAlloc},
+		{"final_heap_alloc_bytes", s.FinalHeapAlloc},
+		{"min_rss_bytes", s.MinRSS},
+		{"max_rss_bytes", s.MaxRSS},
+		{"avg_rss_bytes", s.AvgRSS},
+		{"final_rss_bytes", s.FinalRSS},
+		{"max_heap_inuse_bytes", s.MaxHeapInuse},
+		{"heap_ratio", s.HeapRatio},
+		{"rss_ratio", s.RSSRatio},
+		{"heap_wire_ratio", s.HeapWireRatio},
+		{"rss_wire_ratio", s.RSSWireRatio},
+		{"num_gc", s.NumGC},
+	})
+}
@@ -0,0 +1,25 @@
+package metrics
+
+// 批量消息中每条消息的协议开销估计 (字节)
+//
+// 每条消息在 batch 中由 4 字节长度前缀 + SingleMessageMetadata + payload 组成。
+// SingleMessageMetadata 固定字段 (payload_size, sequence_id 等) 约 6 字节，
+// 每个 property 是一个 KeyValue: 2 字节 tag/len + key/value 各 2 字节 tag/len。
+// 按 batch 摊销的 MessageMetadata 与命令帧开销不计入。
+const (
+	wireFrameOverhead    = 4 + 6
+	wirePropertyOverhead = 6
+	wireKeyOverhead      = 2
+)
+
+// EstimateWireSize 估算一条消息在线路上的大小 (payload + key + properties + 协议开销)
+func EstimateWireSize(payloadLen int, key string, properties map[string]string) int64 {
+	size := int64(payloadLen) + wireFrameOverhead
+	if key != "" {
+		size += int64(len(key)) + wireKeyOverhead
+	}
+	for k, v := range properties {
+		size += int64(len(k)+len(v)) + wirePropertyOverhead
+	}
+	return size
+}
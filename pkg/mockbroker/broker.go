@@ -0,0 +1,381 @@
+// Package mockbroker 是进程内的最小 Pulsar 二进制协议桩，让 pkg/workload 和 pkg/benchmark
+// 不依赖真实 broker 运行，用于在 CI 中快速比较客户端接收路径的分配:
+//
+//	b, err := mockbroker.Start("127.0.0.1:0")
+//	defer b.Close()
+//	workload.RunProducer(ctx, workload.ProducerConfig{URL: b.URL(), Topic: topic, ...})
+//	workload.RunConsumer(ctx, workload.ConsumerConfig{URL: b.URL(), Topic: topic, ...})
+//
+// 只实现单分区 topic 上的 lookup、生产、订阅和按 FLOW 许可分发；ACK 和重投请求被忽略，
+// 不支持的请求返回 NotAllowedError。为了不让桩自身的内存混进测量结果，topic 只保存收到的
+// 第一个 entry (批次)，消费时按收到的 entry 数重放它，因此各条消息内容相同，消息数和字节数
+// 与生产的大致相等 (最后一个不满的批次按满批次计)。分发路径在复用的缓冲区中编码，不产生逐条分配。
+//
+// 协议消息使用客户端注册到 protobuf 全局注册表的 pulsar.proto 类型 (客户端的
+// pulsar_proto 包是 internal 的，不能直接导入)，控制命令以 text 格式书写。
+package mockbroker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	_ "github.com/apache/pulsar-client-go/pulsar" // 注册 pulsar.proto 消息类型
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"pulsar-memory-test/pkg/logging"
+)
+
+// maxFrameSize 与 broker 默认的 maxMessageSize 一致，通过 CONNECTED 告知客户端
+const maxFrameSize = 5 * 1024 * 1024
+
+// Broker 监听一个 TCP 地址，Close 前一直接受连接
+type Broker struct {
+	ln  net.Listener
+	url string
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	cond   *sync.Cond // topic 有新 entry、消费者获得许可或关闭时广播
+	topics map[string]*topic
+	conns  map[*conn]struct{}
+	closed bool
+}
+
+// topic 收到的第一个 entry 和 entry 计数，订阅的游标在分发时前进，不等待 ACK
+type topic struct {
+	entry       []byte // SEND 帧中命令之后的部分 (magic、checksum、metadata、payload)
+	numMessages int    // entry 中的消息数，分发时消耗同样多的许可
+	entries     int64
+	cursors     map[string]int64 // subscription -> 下一个分发的 entry
+}
+
+// Start 在 addr 上监听，addr 的端口为 0 时随机选择，URL 返回实际地址
+func Start(addr string) (*Broker, error) {
+	if baseCommand == nil {
+		return nil, errors.New("mockbroker: pulsar.proto.BaseCommand not registered")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("mockbroker: %w", err)
+	}
+	b := &Broker{
+		ln:     ln,
+		url:    "pulsar://" + ln.Addr().String(),
+		topics: make(map[string]*topic),
+		conns:  make(map[*conn]struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	b.wg.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+// URL 客户端连接使用的 service URL，lookup 也返回它
+func (b *Broker) URL() string {
+	return b.url
+}
+
+// Close 停止监听，断开所有连接并等待分发 goroutine 退出
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	for c := range b.conns {
+		c.nc.Close()
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	err := b.ln.Close()
+	b.wg.Wait()
+	return err
+}
+
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		nc, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{broker: b, nc: nc, consumers: make(map[uint64]*consumer), producers: make(map[uint64]*topic)}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			nc.Close()
+			return
+		}
+		b.conns[c] = struct{}{}
+		b.mu.Unlock()
+		b.wg.Add(1)
+		go c.serve()
+	}
+}
+
+// topic 返回名为 name 的 topic，不存在时创建；调用方持有 b.mu
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{cursors: make(map[string]int64)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// conn 一个客户端连接: 读 goroutine 处理命令，每个消费者一个分发 goroutine，写入由 wmu 串行化
+type conn struct {
+	broker *Broker
+	nc     net.Conn
+
+	wmu  sync.Mutex
+	wbuf []byte // MESSAGE 帧头和命令，只在持有 wmu 时使用
+
+	// 以下由 broker.mu 保护
+	consumers map[uint64]*consumer
+	producers map[uint64]*topic
+}
+
+// consumer 一个订阅上的消费者，permits 为 FLOW 给出的剩余许可
+type consumer struct {
+	id      uint64
+	topic   *topic
+	sub     string
+	permits int
+	closed  bool
+}
+
+func (c *conn) serve() {
+	defer c.broker.wg.Done()
+	defer c.close()
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(c.nc, header[:]); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size < 4 || size > maxFrameSize+64*1024 {
+			logging.Warnf("mockbroker: invalid frame size %d from %s", size, c.nc.RemoteAddr())
+			return
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(c.nc, frame); err != nil {
+			return
+		}
+		cmdSize := binary.BigEndian.Uint32(frame)
+		if cmdSize > size-4 {
+			logging.Warnf("mockbroker: invalid command size %d from %s", cmdSize, c.nc.RemoteAddr())
+			return
+		}
+		cmd := baseCommand.New()
+		if err := (proto.UnmarshalOptions{AllowPartial: true}).Unmarshal(frame[4:4+cmdSize], cmd.Interface()); err != nil {
+			logging.Warnf("mockbroker: decode command: %v", err)
+			return
+		}
+		if err := c.handle(cmd, frame[4+cmdSize:]); err != nil {
+			logging.Debugf("mockbroker: %v", err)
+			return
+		}
+	}
+}
+
+// close 连接断开时关闭其上的消费者，让分发 goroutine 退出
+func (c *conn) close() {
+	c.nc.Close()
+	b := c.broker
+	b.mu.Lock()
+	for _, cons := range c.consumers {
+		cons.closed = true
+	}
+	delete(b.conns, c)
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// handle 处理一个命令，payload 为帧中命令之后的部分 (只有 SEND 带有)
+func (c *conn) handle(cmd protoreflect.Message, payload []byte) error {
+	b := c.broker
+	typ := commandType(cmd)
+	switch typ {
+	case "CONNECT":
+		return c.send(`type: CONNECTED connected {server_version: "mockbroker" protocol_version: 21 max_message_size: %d}`, maxFrameSize)
+	case "PING":
+		return c.send(`type: PONG pong {}`)
+	case "PONG", "ACK", "REDELIVER_UNACKNOWLEDGED_MESSAGES":
+		return nil
+	case "PARTITIONED_METADATA":
+		return c.send(`type: PARTITIONED_METADATA_RESPONSE partitionMetadataResponse {partitions: 0 request_id: %d response: Success}`,
+			field(cmd, "partitionMetadata", "request_id").Uint())
+	case "LOOKUP":
+		return c.send(`type: LOOKUP_RESPONSE lookupTopicResponse {brokerServiceUrl: %q response: Connect request_id: %d authoritative: true}`,
+			b.url, field(cmd, "lookupTopic", "request_id").Uint())
+
+	case "PRODUCER":
+		id := field(cmd, "producer", "producer_id").Uint()
+		name := field(cmd, "producer", "producer_name").String()
+		if name == "" {
+			name = fmt.Sprintf("mockbroker-%d", id)
+		}
+		b.mu.Lock()
+		c.producers[id] = b.topic(field(cmd, "producer", "topic").String())
+		b.mu.Unlock()
+		return c.send(`type: PRODUCER_SUCCESS producer_success {request_id: %d producer_name: %q last_sequence_id: -1}`,
+			field(cmd, "producer", "request_id").Uint(), name)
+	case "SEND":
+		id := field(cmd, "send", "producer_id").Uint()
+		b.mu.Lock()
+		t, ok := c.producers[id]
+		var entryID int64
+		if ok {
+			if t.entry == nil {
+				t.entry = append([]byte(nil), payload...)
+				t.numMessages = int(field(cmd, "send", "num_messages").Int())
+			}
+			entryID = t.entries
+			t.entries++
+			b.cond.Broadcast()
+		}
+		b.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("send on unknown producer %d", id)
+		}
+		return c.send(`type: SEND_RECEIPT send_receipt {producer_id: %d sequence_id: %d highest_sequence_id: %d message_id {ledgerId: 1 entryId: %d}}`,
+			id, field(cmd, "send", "sequence_id").Uint(), field(cmd, "send", "highest_sequence_id").Uint(), entryID)
+	case "CLOSE_PRODUCER":
+		b.mu.Lock()
+		delete(c.producers, field(cmd, "close_producer", "producer_id").Uint())
+		b.mu.Unlock()
+		return c.send(`type: SUCCESS success {request_id: %d}`, field(cmd, "close_producer", "request_id").Uint())
+
+	case "SUBSCRIBE":
+		cons := &consumer{id: field(cmd, "subscribe", "consumer_id").Uint(), sub: field(cmd, "subscribe", "subscription").String()}
+		b.mu.Lock()
+		cons.topic = b.topic(field(cmd, "subscribe", "topic").String())
+		c.consumers[cons.id] = cons
+		b.mu.Unlock()
+		if err := c.send(`type: SUCCESS success {request_id: %d}`, field(cmd, "subscribe", "request_id").Uint()); err != nil {
+			return err
+		}
+		b.wg.Add(1)
+		go c.dispatch(cons)
+		return nil
+	case "FLOW":
+		b.mu.Lock()
+		if cons, ok := c.consumers[field(cmd, "flow", "consumer_id").Uint()]; ok {
+			cons.permits += int(field(cmd, "flow", "messagePermits").Uint())
+			b.cond.Broadcast()
+		}
+		b.mu.Unlock()
+		return nil
+	case "CLOSE_CONSUMER", "UNSUBSCRIBE":
+		sub := "close_consumer"
+		if typ == "UNSUBSCRIBE" {
+			sub = "unsubscribe"
+		}
+		b.mu.Lock()
+		if cons, ok := c.consumers[field(cmd, sub, "consumer_id").Uint()]; ok {
+			cons.closed = true
+			delete(c.consumers, cons.id)
+			if typ == "UNSUBSCRIBE" {
+				delete(cons.topic.cursors, cons.sub)
+			}
+			b.cond.Broadcast()
+		}
+		b.mu.Unlock()
+		return c.send(`type: SUCCESS success {request_id: %d}`, field(cmd, sub, "request_id").Uint())
+
+	default:
+		requestID, ok := requestID(cmd)
+		if !ok {
+			logging.Debugf("mockbroker: ignoring %s", typ)
+			return nil
+		}
+		return c.send(`type: ERROR error {request_id: %d error: NotAllowedError message: "mockbroker: %s not supported"}`, requestID, typ)
+	}
+}
+
+// dispatch 有许可且有未分发的 entry 时发送下一个 entry，直到消费者或连接关闭
+func (c *conn) dispatch(cons *consumer) {
+	b := c.broker
+	defer b.wg.Done()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		t := cons.topic
+		for !cons.closed && !b.closed && (cons.permits <= 0 || t.cursors[cons.sub] >= t.entries) {
+			b.cond.Wait()
+		}
+		if cons.closed || b.closed {
+			return
+		}
+		entryID := t.cursors[cons.sub]
+		t.cursors[cons.sub]++
+		cons.permits -= t.numMessages
+		entry := t.entry
+		b.mu.Unlock()
+		err := c.writeMessage(cons.id, entryID, entry)
+		b.mu.Lock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeMessage 发送一个 MESSAGE 帧: 命令用 protowire 按 PulsarApi.proto 的字段号直接编码
+// (BaseCommand.type=1、message=9; CommandMessage.consumer_id=1、message_id=2;
+// MessageIdData.ledgerId=1、entryId=2)，entry 原样跟在命令之后
+func (c *conn) writeMessage(consumerID uint64, entryID int64, entry []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var idBuf [24]byte
+	id := protowire.AppendTag(idBuf[:0], 1, protowire.VarintType)
+	id = protowire.AppendVarint(id, 1)
+	id = protowire.AppendTag(id, 2, protowire.VarintType)
+	id = protowire.AppendVarint(id, uint64(entryID))
+
+	msgSize := protowire.SizeTag(1) + protowire.SizeVarint(consumerID) + protowire.SizeTag(2) + protowire.SizeBytes(len(id))
+	buf := append(c.wbuf[:0], 0, 0, 0, 0, 0, 0, 0, 0)
+	buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(typeMessage))
+	buf = protowire.AppendTag(buf, 9, protowire.BytesType)
+	buf = protowire.AppendVarint(buf, uint64(msgSize))
+	buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, consumerID)
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, id)
+
+	cmdSize := len(buf) - 8
+	binary.BigEndian.PutUint32(buf[0:], uint32(4+cmdSize+len(entry)))
+	binary.BigEndian.PutUint32(buf[4:], uint32(cmdSize))
+	c.wbuf = buf
+	if _, err := c.nc.Write(buf); err != nil {
+		return err
+	}
+	_, err := c.nc.Write(entry)
+	return err
+}
+
+// send 按 text 格式构造 BaseCommand 并发送，用于低频的控制命令
+func (c *conn) send(format string, args ...any) error {
+	cmd := baseCommand.New().Interface()
+	if err := prototext.Unmarshal([]byte(fmt.Sprintf(format, args...)), cmd); err != nil {
+		return fmt.Errorf("build command: %w", err)
+	}
+	data, err := proto.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(frame[0:], uint32(4+len(data)))
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.nc.Write(frame)
+	return err
+}
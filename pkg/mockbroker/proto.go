@@ -0,0 +1,62 @@
+package mockbroker
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// baseCommand 客户端注册的 pulsar.proto.BaseCommand 类型，未注册时为 nil
+var baseCommand = func() protoreflect.MessageType {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName("pulsar.proto.BaseCommand")
+	if err != nil {
+		return nil
+	}
+	return mt
+}()
+
+// typeMessage BaseCommand.Type 中 MESSAGE 的值
+const typeMessage = 9
+
+// commandType BaseCommand.type 的枚举名，如 CONNECT、SUBSCRIBE
+func commandType(cmd protoreflect.Message) string {
+	fd := cmd.Descriptor().Fields().ByName("type")
+	value := fd.Enum().Values().ByNumber(cmd.Get(fd).Enum())
+	if value == nil {
+		return "UNKNOWN"
+	}
+	return string(value.Name())
+}
+
+// field 按字段名逐层取值，如 field(cmd, "subscribe", "consumer_id")；未设置的字段返回默认值
+func field(m protoreflect.Message, path ...string) protoreflect.Value {
+	var v protoreflect.Value
+	for i, name := range path {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return protoreflect.Value{}
+		}
+		v = m.Get(fd)
+		if i < len(path)-1 {
+			m = v.Message()
+		}
+	}
+	return v
+}
+
+// requestID 在已设置的子命令中查找 request_id，用于给不支持的请求回复错误
+func requestID(cmd protoreflect.Message) (uint64, bool) {
+	var id uint64
+	var found bool
+	cmd.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind {
+			return true
+		}
+		sub := v.Message()
+		if rd := sub.Descriptor().Fields().ByName("request_id"); rd != nil && sub.Has(rd) {
+			id, found = sub.Get(rd).Uint(), true
+			return false
+		}
+		return true
+	})
+	return id, found
+}
@@ -0,0 +1,217 @@
+package payload
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// randomPoolSize 每个 Generator 预生成的随机字节池大小，body 从池中随机偏移处拷贝
+// 超过池大小的消息会出现重复内容，对窗口足够大的压缩算法可压缩性偏高
+const randomPoolSize = 1 << 20
+
+// SizeDistribution 消息大小分布
+type SizeDistribution interface {
+	// Next 返回下一条消息的大小
+	Next(rng *rand.Rand) int
+	// Mean 返回分布的期望大小，用于按总量估算消息数
+	Mean() int
+	String() string
+}
+
+// Fixed 固定大小
+type Fixed int
+
+func (f Fixed) Next(*rand.Rand) int { return int(f) }
+func (f Fixed) Mean() int           { return int(f) }
+func (f Fixed) String() string      { return fmt.Sprintf("fixed:%d", int(f)) }
+
+// Uniform [Min, Max] 均匀分布
+type Uniform struct{ Min, Max int }
+
+func (u Uniform) Next(rng *rand.Rand) int { return u.Min + rng.Intn(u.Max-u.Min+1) }
+func (u Uniform) Mean() int               { return (u.Min + u.Max) / 2 }
+func (u Uniform) String() string          { return fmt.Sprintf("uniform:%d-%d", u.Min, u.Max) }
+
+// Exponential 指数分布，MeanSize 为期望值，Max > 0 时截断到 Max
+type Exponential struct{ MeanSize, Max int }
+
+func (e Exponential) Next(rng *rand.Rand) int {
+	n := int(math.Ceil(rng.ExpFloat64() * float64(e.MeanSize)))
+	if e.Max > 0 && n > e.Max {
+		n = e.Max
+	}
+	return n
+}
+func (e Exponential) Mean() int { return e.MeanSize }
+func (e Exponential) String() string {
+	if e.Max > 0 {
+		return fmt.Sprintf("exp:%d-%d", e.MeanSize, e.Max)
+	}
+	return fmt.Sprintf("exp:%d", e.MeanSize)
+}
+
+// ParseSizeDistribution 解析大小分布描述:
+//
+//	fixed:1024        固定 1024 字节
+//	uniform:512-4096  512~4096 均匀分布
+//	exp:1024          期望 1024 的指数分布
+//	exp:1024-8388608  同上，截断到 8MB
+func ParseSizeDistribution(s string) (SizeDistribution, error) {
+	kind, args, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid size distribution %q: want kind:args", s)
+	}
+	lo, hi, hasHi := strings.Cut(args, "-")
+	a, err := strconv.Atoi(lo)
+	if err != nil || a <= 0 {
+		return nil, fmt.Errorf("invalid size distribution %q: bad size %q", s, lo)
+	}
+	b := 0
+	if hasHi {
+		if b, err = strconv.Atoi(hi); err != nil || b < a {
+			return nil, fmt.Errorf("invalid size distribution %q: bad upper bound %q", s, hi)
+		}
+	}
+
+	switch kind {
+	case "fixed":
+		return Fixed(a), nil
+	case "uniform":
+		if !hasHi {
+			return nil, fmt.Errorf("invalid size distribution %q: uniform needs min-max", s)
+		}
+		return Uniform{Min: a, Max: b}, nil
+	case "exp":
+		return Exponential{MeanSize: a, Max: b}, nil
+	default:
+		return nil, fmt.Errorf("unknown size distribution kind %q", kind)
+	}
+}
+
+// Config payload 生成配置
+type Config struct {
+	Sizes SizeDistribution
+	// Compressibility 可压缩比例: 0 = 完全随机，1 = body 全部为重复字节
+	Compressibility float64
+	// Header 是否在开头嵌入头部 (序号、发布时间、CRC)
+	Header bool
+	// Encoding 非 none 时 body 为按该格式编码的 Record，用于消费端反序列化测试
+	Encoding Encoding
+	Seed     int64
+	// NTPTime 传入的 publish 时间已按 NTP 校正，在头部 flags 中标记
+	NTPTime bool
+}
+
+// Generator 生成 payload，非并发安全，每个 worker 使用独立实例
+type Generator struct {
+	cfg  Config
+	rng  *rand.Rand
+	pool []byte
+}
+
+// NewGenerator 创建生成器，stream 区分同一 seed 下的不同 worker，保证各自可复现
+func NewGenerator(cfg Config, stream int64) *Generator {
+	rng := rand.New(rand.NewSource(cfg.Seed + stream*1000003))
+	pool := make([]byte, randomPoolSize)
+	rng.Read(pool)
+	return &Generator{cfg: cfg, rng: rng, pool: pool}
+}
+
+// flags 头部 flags 字段
+func (g *Generator) flags() uint8 {
+	if g.cfg.NTPTime {
+		return FlagNTPTime
+	}
+	return 0
+}
+
+// NextSize 按分布返回下一条消息的大小
+func (g *Generator) NextSize() int {
+	return g.cfg.Sizes.Next(g.rng)
+}
+
+// Fill 填充 buf: 头部 (若启用且放得下) + 不可压缩部分 + 可压缩部分
+func (g *Generator) Fill(buf []byte, worker uint32, seq uint64, publish time.Time) {
+	body := buf
+	withHeader := g.cfg.Header && len(buf) >= HeaderSize
+	if withHeader {
+		body = buf[HeaderSize:]
+	}
+
+	random := int(float64(len(body)) * (1 - g.cfg.Compressibility))
+	for off := 0; off < random; {
+		start := g.rng.Intn(len(g.pool))
+		off += copy(body[off:random], g.pool[start:])
+	}
+	for i := random; i < len(body); i++ {
+		body[i] = 'x'
+	}
+
+	if withHeader {
+		writeHeader(buf, worker, seq, publish, g.flags())
+	}
+}
+
+// Build 生成一条约 size 字节的 payload: Encoding 为 none 时等同 Fill，
+// 否则为头部 + 编码后的 Record，大小按编码开销近似
+func (g *Generator) Build(size int, worker uint32, seq uint64, publish time.Time) []byte {
+	if g.cfg.Encoding == EncodingNone {
+		buf := make([]byte, size)
+		g.Fill(buf, worker, seq, publish)
+		return buf
+	}
+
+	rec := Record{
+		ID:        fmt.Sprintf("%d-%d", worker, seq),
+		Worker:    worker,
+		Sequence:  seq,
+		Timestamp: publish.UnixNano(),
+		Tags:      recordTags(worker),
+	}
+	// 先编码空 body 得到固定开销，再补足 body 长度
+	empty, _ := rec.Marshal(g.cfg.Encoding)
+	bodyLen := size - len(empty)
+	if g.cfg.Header {
+		bodyLen -= HeaderSize
+	}
+	rec.Body = g.text(max(bodyLen, 0))
+	encoded, err := rec.Marshal(g.cfg.Encoding)
+	if err != nil {
+		// Record 只含基本类型，编码不会失败
+		panic(err)
+	}
+
+	if !g.cfg.Header {
+		return encoded
+	}
+	buf := make([]byte, HeaderSize+len(encoded))
+	copy(buf[HeaderSize:], encoded)
+	writeHeader(buf, worker, seq, publish, g.flags())
+	return buf
+}
+
+// textAlphabet 编码模式下 body 使用的字符，保证是合法 UTF-8 且 JSON 无需转义
+const textAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// text 生成 n 字节文本，不可压缩部分由随机池映射到 textAlphabet
+func (g *Generator) text(n int) string {
+	b := make([]byte, n)
+	random := int(float64(n) * (1 - g.cfg.Compressibility))
+	start := g.rng.Intn(len(g.pool))
+	for i := 0; i < random; i++ {
+		b[i] = textAlphabet[int(g.pool[(start+i)%len(g.pool)])%len(textAlphabet)]
+	}
+	for i := random; i < n; i++ {
+		b[i] = 'x'
+	}
+	return string(b)
+}
+
+// Next 生成一条按分布取大小的 payload
+func (g *Generator) Next(worker uint32, seq uint64, publish time.Time) []byte {
+	return g.Build(g.NextSize(), worker, seq, publish)
+}
@@ -0,0 +1,123 @@
+package payload
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"time"
+)
+
+// 每条消息 payload 开头嵌入的定长头部 (大端序):
+//
+//	offset size field
+//	0      2    magic "PM"
+//	2      1    version
+//	3      1    flags (bit 0 = FlagNTPTime)
+//	4      4    worker ID
+//	8      8    sequence
+//	16     8    publish time (unix nano)
+//	24     4    body CRC32 (IEEE, 覆盖 HeaderSize 之后的全部字节)
+const (
+	HeaderSize = 28
+
+	magic0  = 'P'
+	magic1  = 'M'
+	version = 1
+)
+
+// FlagNTPTime publish time 已按 NTP 偏差校正 (producer -ntp-server)，
+// consumer 换算到本机时钟后可跨主机计算延迟
+const FlagNTPTime = 1 << 0
+
+var (
+	// ErrNoHeader payload 太短或不是本工具生成的
+	ErrNoHeader = errors.New("payload: no header")
+	// ErrUnsupportedVersion 头部版本无法识别
+	ErrUnsupportedVersion = errors.New("payload: unsupported header version")
+	// ErrChecksum body CRC 与头部记录的不一致
+	ErrChecksum = errors.New("payload: checksum mismatch")
+)
+
+// Header 解析出的消息头部
+type Header struct {
+	Worker      uint32
+	Sequence    uint64
+	PublishTime time.Time
+	BodyCRC     uint32
+	Flags       uint8
+}
+
+// HasHeader 判断 payload 是否以本工具的头部开头
+func HasHeader(buf []byte) bool {
+	return len(buf) >= HeaderSize && buf[0] == magic0 && buf[1] == magic1
+}
+
+// writeHeader 在 buf 开头写入头部，body CRC 基于 buf[HeaderSize:] 计算
+func writeHeader(buf []byte, worker uint32, seq uint64, publish time.Time, flags uint8) {
+	buf[0] = magic0
+	buf[1] = magic1
+	buf[2] = version
+	buf[3] = flags
+	binary.BigEndian.PutUint32(buf[4:], worker)
+	binary.BigEndian.PutUint64(buf[8:], seq)
+	binary.BigEndian.PutUint64(buf[16:], uint64(publish.UnixNano()))
+	binary.BigEndian.PutUint32(buf[24:], crc32.ChecksumIEEE(buf[HeaderSize:]))
+}
+
+// Parse 解析 payload 头部，不校验 body
+func Parse(buf []byte) (Header, error) {
+	if !HasHeader(buf) {
+		return Header{}, ErrNoHeader
+	}
+	if buf[2] != version {
+		return Header{}, ErrUnsupportedVersion
+	}
+	return Header{
+		Worker:      binary.BigEndian.Uint32(buf[4:]),
+		Sequence:    binary.BigEndian.Uint64(buf[8:]),
+		PublishTime: time.Unix(0, int64(binary.BigEndian.Uint64(buf[16:]))),
+		BodyCRC:     binary.BigEndian.Uint32(buf[24:]),
+		Flags:       buf[3],
+	}, nil
+}
+
+// Verify 解析头部并校验 body CRC
+func Verify(buf []byte) (Header, error) {
+	h, err := Parse(buf)
+	if err != nil {
+		return h, err
+	}
+	if crc32.ChecksumIEEE(buf[HeaderSize:]) != h.BodyCRC {
+		return h, ErrChecksum
+	}
+	return h, nil
+}
+
+// ChecksumProperty 未嵌入头部时携带 payload CRC32 的消息 property 名
+const ChecksumProperty = "crc32"
+
+// PhaseProperty 标记消息所属阶段的 property 名 (如 producer -compression-sweep 的压缩设置)，
+// 消费端据此分段统计
+const PhaseProperty = "phase"
+
+// Checksum 计算整个 payload 的 CRC32，用于 ChecksumProperty
+func Checksum(buf []byte) string {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE(buf)), 16)
+}
+
+// VerifyMessage 校验一条消息的完整性: 优先使用头部 CRC，其次使用 ChecksumProperty；
+// 两者都没有时返回 ErrNoHeader
+func VerifyMessage(buf []byte, properties map[string]string) error {
+	if HasHeader(buf) {
+		_, err := Verify(buf)
+		return err
+	}
+	if want, ok := properties[ChecksumProperty]; ok {
+		if Checksum(buf) != want {
+			return ErrChecksum
+		}
+		return nil
+	}
+	return ErrNoHeader
+}
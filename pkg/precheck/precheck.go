@@ -0,0 +1,282 @@
+// Package precheck 运行开始前的资源检查: broker 连通性、topic 是否存在 (可自动创建)、
+// 结果目录的磁盘空间、文件描述符上限，以及可用内存与配置的内存上限。
+//
+// 长时间运行 (数小时的 soak/fleet 测试) 常在中途因为这些本可预见的问题失败: 磁盘写满时
+// stats 和 profile 保存失败，fd 耗尽时连接和文件打开失败，cgroup 内存上限低于客户端的
+// memory limit 时进程被 OOM kill。检查在创建客户端之前进行，失败时给出原因和建议。
+package precheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"pulsar-memory-test/pkg/admin"
+)
+
+// 阈值: 低于 Fail 的值检查失败，低于 Warn 的值只提示
+const (
+	diskFail  = 256 << 20
+	diskWarn  = 1 << 30
+	filesFail = 256
+	filesWarn = 4096
+	// 预计内存超过可用内存的这个比例时提示，超过可用内存时失败
+	memoryWarnRatio = 0.8
+
+	dialTimeout = 5 * time.Second
+)
+
+// Status 单项检查的结论
+type Status string
+
+const (
+	OK   Status = "ok"
+	Warn Status = "warn"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Check 一项检查的结果
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Config 要检查的资源，零值的项跳过
+type Config struct {
+	ServiceURL  string // pulsar://host:port[,host:port]，逐个尝试 TCP 连接
+	AdminURL    string // 检查 Topics 是否存在；为空时跳过 topic 检查
+	Topics      []string
+	CreateTopic bool   // topic 不存在时经 admin REST 创建 (非分区)，否则只提示
+	OutputDir   string // 检查所在文件系统的剩余空间
+	MemoryBytes int64  // 预计的内存峰值 (客户端 memory limit、批次等)，与可用内存和 cgroup 上限比较
+}
+
+// Run 依次执行检查；有失败项时返回的 error 列出全部失败
+func Run(ctx context.Context, cfg Config) ([]Check, error) {
+	checks := []Check{
+		checkBroker(cfg.ServiceURL),
+	}
+	for _, topic := range cfg.Topics {
+		checks = append(checks, checkTopic(ctx, cfg.AdminURL, topic, cfg.CreateTopic))
+	}
+	checks = append(checks, checkDisk(cfg.OutputDir), checkFiles(), checkMemory(cfg.MemoryBytes))
+
+	var failed []string
+	for _, c := range checks {
+		if c.Status == Fail {
+			failed = append(failed, c.Name+": "+c.Detail)
+		}
+	}
+	if len(failed) > 0 {
+		return checks, errors.New(strings.Join(failed, "; "))
+	}
+	return checks, nil
+}
+
+// brokerAddrs 服务 URL 中的 host:port 列表，未写端口时按 scheme 补默认端口
+func brokerAddrs(serviceURL string) ([]string, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, err
+	}
+	port := map[string]string{"pulsar": "6650", "pulsar+ssl": "6651", "http": "8080", "https": "443"}[u.Scheme]
+	if port == "" || u.Host == "" {
+		return nil, fmt.Errorf("unsupported service URL %q", serviceURL)
+	}
+	var addrs []string
+	for _, h := range strings.Split(u.Host, ",") {
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(h, port)
+		}
+		addrs = append(addrs, h)
+	}
+	return addrs, nil
+}
+
+func checkBroker(serviceURL string) Check {
+	c := Check{Name: "broker"}
+	if serviceURL == "" {
+		c.Status, c.Detail = Skip, "no service URL"
+		return c
+	}
+	addrs, err := brokerAddrs(serviceURL)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		return c
+	}
+	var down []string
+	for _, addr := range addrs {
+		conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+		if err != nil {
+			down = append(down, err.Error())
+			continue
+		}
+		conn.Close()
+	}
+	switch {
+	case len(down) == 0:
+		c.Status, c.Detail = OK, strings.Join(addrs, ",")+" reachable"
+	case len(down) < len(addrs):
+		c.Status, c.Detail = Warn, fmt.Sprintf("%d of %d hosts unreachable: %s", len(down), len(addrs), strings.Join(down, "; "))
+	default:
+		c.Status, c.Detail = Fail, strings.Join(down, "; ")+" (is the broker running? check -url)"
+	}
+	return c
+}
+
+// checkTopic admin REST 不可用时只提示: 有的部署只开放了 binary 协议端口
+func checkTopic(ctx context.Context, adminURL, topic string, create bool) Check {
+	c := Check{Name: "topic " + topic}
+	if adminURL == "" {
+		c.Status, c.Detail = Skip, "no admin URL"
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	client := admin.New(adminURL)
+	exists, err := client.TopicExists(ctx, topic)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = Warn, fmt.Sprintf("cannot check via %s: %v", adminURL, err)
+	case exists:
+		c.Status, c.Detail = OK, "exists"
+	case !create:
+		c.Status, c.Detail = Warn, "does not exist yet; the broker creates it on first use if auto topic creation is enabled (-precheck-create-topic creates it now)"
+	default:
+		if err := client.CreateTopic(ctx, topic); err != nil {
+			c.Status, c.Detail = Fail, fmt.Sprintf("create failed: %v", err)
+		} else {
+			c.Status, c.Detail = OK, "created"
+		}
+	}
+	return c
+}
+
+func checkDisk(dir string) Check {
+	c := Check{Name: "disk"}
+	if dir == "" {
+		c.Status, c.Detail = Skip, "no output directory"
+		return c
+	}
+	// 目录可能尚未创建，向上找到第一个存在的目录
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	u, err := disk.Usage(dir)
+	if err != nil {
+		c.Status, c.Detail = Warn, err.Error()
+		return c
+	}
+	c.Detail = fmt.Sprintf("%s free in %s", formatBytes(u.Free), dir)
+	switch {
+	case u.Free < diskFail:
+		c.Status = Fail
+		c.Detail += fmt.Sprintf(" (need at least %s for stats and profiles; free space or change -output)", formatBytes(diskFail))
+	case u.Free < diskWarn:
+		c.Status = Warn
+	default:
+		c.Status = OK
+	}
+	return c
+}
+
+func checkFiles() Check {
+	c := Check{Name: "file descriptors"}
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		c.Status, c.Detail = Skip, err.Error()
+		return c
+	}
+	limits, err := p.Rlimit()
+	if err != nil {
+		c.Status, c.Detail = Skip, err.Error()
+		return c
+	}
+	for _, l := range limits {
+		if l.Resource != process.RLIMIT_NOFILE {
+			continue
+		}
+		c.Detail = fmt.Sprintf("soft limit %d, hard limit %d", l.Soft, l.Hard)
+		switch {
+		case l.Soft < filesFail:
+			c.Status = Fail
+			c.Detail += fmt.Sprintf(", at least %d needed for connections, logs and profiles (raise with ulimit -n)", filesFail)
+		case l.Soft < filesWarn:
+			c.Status = Warn
+			c.Detail += " (raise with ulimit -n for long runs)"
+		default:
+			c.Status = OK
+		}
+		return c
+	}
+	c.Status, c.Detail = Skip, "RLIMIT_NOFILE not reported"
+	return c
+}
+
+func checkMemory(need int64) Check {
+	c := Check{Name: "memory"}
+	if need <= 0 {
+		c.Status, c.Detail = Skip, "no configured limit to compare"
+		return c
+	}
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		c.Status, c.Detail = Skip, err.Error()
+		return c
+	}
+	avail, source := vm.Available, "available"
+	if limit, usage, ok := cgroupMemory(); ok && limit-min(usage, limit) < avail {
+		avail, source = limit-min(usage, limit), "left in the cgroup limit"
+	}
+	c.Detail = fmt.Sprintf("about %s needed, %s %s", formatBytes(uint64(need)), formatBytes(avail), source)
+	switch {
+	case uint64(need) > avail:
+		c.Status = Fail
+		c.Detail += " (lower -memory-limit/-batch-size or give the process more memory)"
+	case float64(need) > memoryWarnRatio*float64(avail):
+		c.Status = Warn
+	default:
+		c.Status = OK
+	}
+	return c
+}
+
+// cgroupMemory cgroup v2 的 memory.max 和 memory.current，不在 cgroup 中或没有上限时 ok 为 false
+func cgroupMemory() (limit, usage uint64, ok bool) {
+	read := func(name string) (uint64, bool) {
+		data, err := os.ReadFile(filepath.Join("/sys/fs/cgroup", name))
+		if err != nil {
+			return 0, false
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		return v, err == nil // memory.max 为 "max" 时没有上限
+	}
+	if limit, ok = read("memory.max"); !ok {
+		return 0, 0, false
+	}
+	usage, _ = read("memory.current")
+	return limit, usage, true
+}
+
+func formatBytes(n uint64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%.0f MB", float64(n)/(1<<20))
+}
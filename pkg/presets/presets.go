@@ -0,0 +1,112 @@
+// Package presets 内置的标准内存测试场景，producer 和 consumer 通过 -preset 选择；
+// 同样格式的 YAML 场景文件 (runner init 生成) 通过 -config 加载
+package presets
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed presets.json
+var presetsJSON []byte
+
+// Preset 一个命名场景，Flags 按程序名 (producer/consumer) 给出参数默认值
+type Preset struct {
+	Name        string                       `json:"name" yaml:"name"`
+	Description string                       `json:"description" yaml:"description"`
+	Flags       map[string]map[string]string `json:"flags" yaml:"flags"`
+}
+
+var presets = func() []Preset {
+	var list []Preset
+	if err := json.Unmarshal(presetsJSON, &list); err != nil {
+		panic(fmt.Sprintf("presets: invalid presets.json: %v", err))
+	}
+	return list
+}()
+
+// All 返回所有内置场景
+func All() []Preset {
+	return presets
+}
+
+// Get 按名称查找场景
+func Get(name string) (Preset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Load 读取 YAML 场景文件
+func Load(path string) (Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Preset{}, err
+	}
+	var p Preset
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return Preset{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = path
+	}
+	return p, nil
+}
+
+// Apply 把内置场景中 program 的参数写入 fs，命令行上显式指定的参数优先，返回实际设置的参数名
+func Apply(name, program string, fs *flag.FlagSet) ([]string, error) {
+	p, ok := Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (use -preset=list)", name)
+	}
+	return p.Apply(program, fs)
+}
+
+// Apply 把场景中 program 的参数写入 fs，已经设置过的参数 (命令行或先加载的场景) 优先
+func (p Preset) Apply(program string, fs *flag.FlagSet) ([]string, error) {
+	name := p.Name
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var applied []string
+	for k, v := range p.Flags[program] {
+		if fs.Lookup(k) == nil {
+			return nil, fmt.Errorf("preset %q: unknown %s flag -%s", name, program, k)
+		}
+		if explicit[k] {
+			continue
+		}
+		if err := fs.Set(k, v); err != nil {
+			return nil, fmt.Errorf("preset %q: -%s=%s: %w", name, k, v, err)
+		}
+		applied = append(applied, k)
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
+
+// List 打印所有场景及其中 program 的参数
+func List(w io.Writer, program string) {
+	for _, p := range presets {
+		fmt.Fprintf(w, "%s\n    %s\n", p.Name, p.Description)
+		flags := p.Flags[program]
+		keys := make([]string, 0, len(flags))
+		for k := range flags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "    -%s=%s\n", k, flags[k])
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package profview 在已有的诊断 HTTP 服务下内嵌 pprof Web UI (github.com/google/pprof/driver)，
+// 远程测试机上查看已保存的 profile 无需安装 Go 工具链
+package profview
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/driver"
+)
+
+// Viewer 列出 dir 下的 *.pprof，并为每个 profile 按需创建 pprof Web UI
+//
+// 路由 (prefix 以 / 结尾):
+//
+//	<prefix>              profile 列表
+//	<prefix><name>/...    该 profile 的 pprof UI (Graph/Top/Flame Graph/...)
+type Viewer struct {
+	dir    string
+	prefix string
+
+	mu    sync.Mutex
+	views map[string]map[string]http.Handler // profile 文件名 -> pprof 路由表
+}
+
+// New 创建 Viewer
+func New(dir, prefix string) *Viewer {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Viewer{dir: dir, prefix: prefix, views: make(map[string]map[string]http.Handler)}
+}
+
+// Prefix 挂载路径
+func (v *Viewer) Prefix() string {
+	return v.prefix
+}
+
+func (v *Viewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, v.prefix)
+	if rest == "" {
+		v.serveIndex(w)
+		return
+	}
+	name, sub, ok := strings.Cut(rest, "/")
+	if !ok {
+		// pprof 页面使用相对链接，必须以 / 结尾
+		http.Redirect(w, r, v.prefix+name+"/", http.StatusMovedPermanently)
+		return
+	}
+	handlers, err := v.view(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h, ok := handlers["/"+sub]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><title>Profiles</title></head><body>
+<h1>Profiles in {{.Dir}}</h1>
+{{if .Files}}<ul>{{range .Files}}<li>{{.}}: <a href="{{.}}/top">top</a> · <a href="{{.}}/flamegraph">flame graph</a> · <a href="{{.}}/">graph</a> (needs Graphviz)</li>{{end}}</ul>
+{{else}}<p>No *.pprof files yet.</p>{{end}}
+</body></html>
+`))
+
+func (v *Viewer) serveIndex(w http.ResponseWriter) {
+	files, err := v.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, struct {
+		Dir   string
+		Files []string
+	}{v.dir, files})
+}
+
+func (v *Viewer) list() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(v.dir, "*.pprof"))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(matches))
+	for _, m := range matches {
+		files = append(files, filepath.Base(m))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// view 返回 profile 的 pprof 路由表，首次访问时解析 profile；
+// 同一文件之后被覆盖 (如下一次运行) 不会刷新，需重启进程
+func (v *Viewer) view(name string) (map[string]http.Handler, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".pprof") {
+		return nil, fmt.Errorf("invalid profile name %q", name)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok := v.views[name]; ok {
+		return h, nil
+	}
+
+	path := filepath.Join(v.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	var handlers map[string]http.Handler
+	err := driver.PProf(&driver.Options{
+		Flagset: newFlagSet([]string{"-http=localhost:0", "-no_browser", "-symbolize=none", path}),
+		Writer:  discardWriter{},
+		HTTPServer: func(args *driver.HTTPServerArgs) error {
+			// 不启动独立服务，只取出路由表挂在已有的服务下
+			handlers = args.Handlers
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", name, err)
+	}
+	if handlers == nil {
+		return nil, fmt.Errorf("load %s: pprof did not start a web UI", name)
+	}
+	v.views[name] = handlers
+	return handlers, nil
+}
+
+// discardWriter pprof 的 Writer 接口，丢弃 -output 之类的文件输出
+type discardWriter struct{}
+
+func (discardWriter) Open(string) (io.WriteCloser, error) {
+	return nopWriteCloser{io.Discard}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// flagSet 用固定参数实现 driver.FlagSet，不读取进程自身的命令行
+type flagSet struct {
+	*flag.FlagSet
+	args  []string
+	usage []string
+}
+
+func newFlagSet(args []string) *flagSet {
+	fs := flag.NewFlagSet("pprof", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return &flagSet{FlagSet: fs, args: args}
+}
+
+type stringList struct{ values *[]*string }
+
+func (s stringList) String() string { return "" }
+func (s stringList) Set(v string) error {
+	*s.values = append(*s.values, &v)
+	return nil
+}
+
+func (f *flagSet) StringList(name, def, usage string) *[]*string {
+	values := &[]*string{}
+	if def != "" {
+		*values = append(*values, &def)
+	}
+	f.Var(stringList{values}, name, usage)
+	return values
+}
+
+func (f *flagSet) ExtraUsage() string { return strings.Join(f.usage, "\n") }
+
+func (f *flagSet) AddExtraUsage(eu string) { f.usage = append(f.usage, eu) }
+
+func (f *flagSet) Parse(usage func()) []string {
+	if err := f.FlagSet.Parse(f.args); err != nil {
+		usage()
+		return nil
+	}
+	return f.Args()
+}
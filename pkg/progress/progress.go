@@ -0,0 +1,112 @@
+// Package progress 输出周期性进度报告，支持人读的日志格式和便于脚本解析的 JSON 行格式
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"pulsar-memory-test/pkg/clock"
+	"pulsar-memory-test/pkg/logging"
+)
+
+// Format 进度输出格式
+type Format int
+
+const (
+	// FormatLog 通过 log 输出一行可读文本
+	FormatLog Format = iota
+	// FormatJSON 向 stdout 输出一行 JSON，不带日志前缀
+	FormatJSON
+	// FormatNone 不输出进度
+	FormatNone
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatNone:
+		return "none"
+	default:
+		return "log"
+	}
+}
+
+// ParseFormat 解析 -progress-format 参数
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "log":
+		return FormatLog, nil
+	case "json":
+		return FormatJSON, nil
+	case "none":
+		return FormatNone, nil
+	default:
+		return FormatLog, fmt.Errorf("unknown progress format %q: want log, json or none", s)
+	}
+}
+
+// Reporter 按格式输出进度
+type Reporter struct {
+	format Format
+	source string            // json 中的 "source" 字段，如 producer/consumer
+	labels map[string]string // json 中的 "labels" 字段，-labels
+	clock  clock.Clock       // json 中 "ts" 字段的来源，SetClock
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewReporter 创建进度输出器
+func NewReporter(format Format, source string) *Reporter {
+	return &Reporter{format: format, source: source, out: os.Stdout, clock: clock.Real}
+}
+
+// SetLabels 设置 json 格式每行附带的标签，应在第一次 Report 之前调用
+func (r *Reporter) SetLabels(labels map[string]string) {
+	r.labels = labels
+}
+
+// SetClock 替换 json 格式 "ts" 字段的时钟，测试中与 MemoryMonitor.SetClock 使用同一个 clock.Fake
+func (r *Reporter) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Enabled 是否需要输出，none 时调用方可跳过采集
+func (r *Reporter) Enabled() bool {
+	return r.format != FormatNone
+}
+
+// Report 输出一条进度: log 格式打印 text，json 格式把 fields 连同时间戳和来源编码为一行
+func (r *Reporter) Report(text string, fields map[string]any) {
+	switch r.format {
+	case FormatNone:
+		return
+	case FormatLog:
+		logging.Infof("%s", text)
+		return
+	}
+
+	line := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		line[k] = v
+	}
+	line["type"] = "progress"
+	line["source"] = r.source
+	if len(r.labels) > 0 {
+		line["labels"] = r.labels
+	}
+	line["ts"] = r.clock.Now().UnixMilli()
+	data, err := json.Marshal(line)
+	if err != nil {
+		log.Printf("Failed to encode progress: %v", err)
+		return
+	}
+	r.mu.Lock()
+	r.out.Write(append(data, '\n'))
+	r.mu.Unlock()
+}
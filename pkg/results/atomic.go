@@ -0,0 +1,93 @@
+package results
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// writeAttempts WriteFile 的总尝试次数，retryBackoff 为首次重试前的等待，之后每次翻倍
+const (
+	writeAttempts = 3
+	retryBackoff  = 200 * time.Millisecond
+)
+
+// WriteFile 原子地写入 path: 先由 write 写到同目录下的临时文件，fsync 后 rename 覆盖，
+// 再 fsync 目录，进程在写入中途崩溃时 path 要么是旧内容要么是完整的新内容。
+// 失败时 (如磁盘暂满、网络文件系统抖动) 按退避重试，write 每次都从头写起。
+func WriteFile(path string, write func(io.Writer) error) error {
+	var err error
+	backoff := retryBackoff
+	for attempt := 1; attempt <= writeAttempts; attempt++ {
+		if err = writeOnce(path, write); err == nil {
+			return nil
+		}
+		if attempt < writeAttempts {
+			log.Printf("Write %s failed (attempt %d/%d), retrying in %v: %v", path, attempt, writeAttempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// WriteBytes 以 WriteFile 的方式写入 data
+func WriteBytes(path string, data []byte) error {
+	return WriteFile(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+func writeOnce(path string, write func(io.Writer) error) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("fsync: %w", err)
+	}
+	// CreateTemp 使用 0600，与 os.Create 的结果保持一致
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir fsync 目录使 rename 持久化；部分文件系统不支持对目录 fsync，忽略这类错误
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, errors.ErrUnsupported) {
+		return fmt.Errorf("fsync dir: %w", err)
+	}
+	return nil
+}
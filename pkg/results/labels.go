@@ -0,0 +1,50 @@
+package results
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// labelName 与 Prometheus label 名称规则一致，标签会作为常量 label 加到导出的指标上
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels 推送分组键 (job/instance/scenario/run_id)、StatsD 公共标签 (program) 和
+// pulsar-client-go 指标自带的 label，用户标签不能与之重名
+var reservedLabels = map[string]bool{
+	"job": true, "instance": true, "scenario": true, "run_id": true, "program": true,
+	"client": true, "topic": true,
+}
+
+// ParseLabels 解析 -labels 参数 "k1=v1,k2=v2"，如 client_version=v0.14.0,host_class=c5.2xlarge,experiment=exp-42
+func ParseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || !labelName.MatchString(k) {
+			return nil, fmt.Errorf("invalid key=value pair %q: key must match %s", pair, labelName)
+		}
+		if reservedLabels[k] || strings.HasPrefix(k, "pulsar_") || strings.HasPrefix(k, "__") {
+			return nil, fmt.Errorf("label %q is reserved", k)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// mergeLabels 把 labels 合并进 dst (nil 时新建)，返回合并结果；producer 和 consumer 写同一文件时共用
+func mergeLabels(dst, labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		dst[k] = v
+	}
+	return dst
+}
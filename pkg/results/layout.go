@@ -0,0 +1,228 @@
+// Package results 管理结果目录布局
+//
+// flat 布局沿用历史文件名 (results/stats_<scenario>.json 等)，供现有脚本使用；
+// run 布局为每次运行创建 results/<scenario>/<run-id>/，目录内使用短文件名
+// (stats.json、heap.pprof、consumer.log ...)，并写入 manifest.json 记录产物和配置，
+// 同一场景的多次运行不再相互覆盖。
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pulsar-memory-test/pkg/admin"
+)
+
+// RunIDFormat 默认 run ID 的时间格式
+const RunIDFormat = "20060102-150405"
+
+// ManifestName run 布局下的清单文件名
+const ManifestName = "manifest.json"
+
+// Layout 一次运行的结果目录
+type Layout struct {
+	Root     string
+	Scenario string
+	RunID    string            // flat 布局时为空
+	Dir      string            // 实际写入文件的目录
+	Labels   map[string]string // -labels，写入 result.json 和 manifest.json
+
+	mu         sync.Mutex
+	files      map[string]string // 文件名 -> 类型
+	topicStats []admin.TopicSnapshot
+}
+
+// New 创建结果目录: runID 为空时使用 flat 布局
+func New(root, scenario, runID string) (*Layout, error) {
+	l := &Layout{Root: root, Scenario: scenario, RunID: runID, Dir: root, files: make(map[string]string)}
+	if runID != "" {
+		l.Dir = filepath.Join(root, scenario, runID)
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create results dir: %w", err)
+	}
+	return l, nil
+}
+
+// NewRunID 基于当前时间生成 run ID
+func NewRunID() string {
+	return time.Now().Format(RunIDFormat)
+}
+
+// PerRun 是否为 run 布局
+func (l *Layout) PerRun() bool {
+	return l.RunID != ""
+}
+
+// File 返回某类产物的路径并登记到清单:
+// flat 布局为 <root>/<base>_<scenario>.<ext>，run 布局为 <dir>/<base>.<ext>
+func (l *Layout) File(kind, base, ext string) string {
+	path := l.path(base, ext)
+	l.mu.Lock()
+	l.files[filepath.Base(path)] = kind
+	l.mu.Unlock()
+	return path
+}
+
+// Kinds 本进程用 File 登记的文件名 -> 类型
+func (l *Layout) Kinds() map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kinds := make(map[string]string, len(l.files))
+	for name, kind := range l.files {
+		kinds[name] = kind
+	}
+	return kinds
+}
+
+// path 与 File 相同但不登记到清单
+func (l *Layout) path(base, ext string) string {
+	name := base + "." + ext
+	if !l.PerRun() {
+		name = fmt.Sprintf("%s_%s.%s", base, l.Scenario, ext)
+	}
+	return filepath.Join(l.Dir, name)
+}
+
+// FlatFiles flat 布局下 dir 中属于 scenario 的文件名，按名称排序。只接受 File 生成的 <base>_<scenario>.<ext>
+// (base 中没有 '.')，不用 glob: 场景 test 不会匹配 stats_test_2.json，场景名中的 *、? 和 [ 也按字面比较
+func FlatFiles(dir, scenario string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if isFlatFile(e.Name(), scenario) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isFlatFile name 是否为 <base>_<scenario>.<ext>
+func isFlatFile(name, scenario string) bool {
+	i := strings.Index(name, "_"+scenario+".")
+	if i <= 0 || strings.Contains(name[:i], ".") {
+		return false
+	}
+	return len(name) > i+len(scenario)+2
+}
+
+// ManifestFile 清单中的一个产物
+type ManifestFile struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Size int64  `json:"size"`
+}
+
+// Manifest run 目录下的 manifest.json，producer 和 consumer 共用同一个 run ID 时合并写入
+type Manifest struct {
+	Scenario string                       `json:"scenario"`
+	RunID    string                       `json:"run_id"`
+	Updated  time.Time                    `json:"updated"`
+	Files    []ManifestFile               `json:"files"`
+	Config   map[string]map[string]string `json:"config,omitempty"` // 按程序名 (producer/consumer) 记录的配置
+	Labels   map[string]string            `json:"labels,omitempty"` // -labels，各程序的标签合并
+
+	// 各阶段前后 broker 端的 topic 数据量，按 Phase 去重
+	TopicStats []admin.TopicSnapshot `json:"topic_stats,omitempty"`
+}
+
+// RecordTopicStats 登记一个阶段的 topic 快照，WriteManifest 时写入清单
+func (l *Layout) RecordTopicStats(s admin.TopicSnapshot) {
+	l.mu.Lock()
+	l.topicStats = append(l.topicStats, s)
+	l.mu.Unlock()
+}
+
+// ReadManifest 读取 run 目录下的 manifest.json
+func ReadManifest(path string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// WriteManifest 合并写入清单，config 为当前程序的配置；flat 布局下不做任何事
+func (l *Layout) WriteManifest(program string, config map[string]string) error {
+	if !l.PerRun() {
+		return nil
+	}
+	path := filepath.Join(l.Dir, ManifestName)
+
+	m, err := ReadManifest(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if m.Config == nil {
+		m.Config = make(map[string]map[string]string)
+	}
+	m.Scenario = l.Scenario
+	m.RunID = l.RunID
+	m.Updated = time.Now()
+	m.Labels = mergeLabels(m.Labels, l.Labels)
+	if config != nil {
+		m.Config[program] = config
+	}
+
+	// 已有条目按最新文件大小刷新，再加入本程序登记的产物
+	kinds := make(map[string]string, len(m.Files))
+	for _, f := range m.Files {
+		kinds[f.Name] = f.Kind
+	}
+	l.mu.Lock()
+	for name, kind := range l.files {
+		kinds[name] = kind
+	}
+	for _, s := range l.topicStats {
+		m.TopicStats = slices.DeleteFunc(m.TopicStats, func(old admin.TopicSnapshot) bool { return old.Phase == s.Phase })
+		m.TopicStats = append(m.TopicStats, s)
+	}
+	l.mu.Unlock()
+	sort.SliceStable(m.TopicStats, func(i, j int) bool { return m.TopicStats[i].Time.Before(m.TopicStats[j].Time) })
+	m.Files = m.Files[:0]
+	for name, kind := range kinds {
+		info, err := os.Stat(filepath.Join(l.Dir, name))
+		if err != nil {
+			continue // 登记了但未生成 (如被禁用的可选输出)
+		}
+		m.Files = append(m.Files, ManifestFile{Name: name, Kind: kind, Size: info.Size()})
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteBytes(path, append(data, '\n'))
+}
+
+// Open 按 -layout/-run-id 参数创建结果目录: mode 为 flat 或 run，run 布局下 runID 为空时自动生成
+func Open(mode, root, scenario, runID string) (*Layout, error) {
+	switch mode {
+	case "flat":
+		return New(root, scenario, "")
+	case "run":
+		if runID == "" {
+			runID = NewRunID()
+		}
+		return New(root, scenario, runID)
+	default:
+		return nil, fmt.Errorf("unknown layout %q: want flat or run", mode)
+	}
+}
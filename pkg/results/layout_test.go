@@ -0,0 +1,67 @@
+package results_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"pulsar-memory-test/pkg/results"
+)
+
+// TestFlatFiles 只匹配完整的场景名: 前缀相同的其它场景、临时文件和 glob 元字符都不会混进来
+func TestFlatFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"stats_test.json",
+		"stats_test.json.gz",
+		"sub_cycles_test.json",
+		"consumer_test.log",
+		"stats_test_2.json",
+		"heap_test_2.pprof",
+		"stats_testing.json",
+		"test.json",
+		"_test.json",
+		"stats_test.",
+		".stats_test.json.tmp123",
+		"stats_t[e]st.json",
+		"stats_t*.json",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		scenario string
+		want     []string
+	}{
+		{"test", []string{"consumer_test.log", "stats_test.json", "stats_test.json.gz", "sub_cycles_test.json"}},
+		{"test_2", []string{"heap_test_2.pprof", "stats_test_2.json"}},
+		{"t[e]st", []string{"stats_t[e]st.json"}},
+		{"t*", []string{"stats_t*.json"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		got, err := results.FlatFiles(dir, tt.scenario)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("FlatFiles(%q) = %v, want %v", tt.scenario, got, tt.want)
+		}
+	}
+
+	// Layout.File 生成的文件名总能匹配
+	l, err := results.New(dir, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := l.File("profile", "exit-heap", "pprof")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := results.FlatFiles(dir, "test"); !slices.Contains(got, filepath.Base(path)) {
+		t.Errorf("FlatFiles(%q) = %v, want it to include %s", "test", got, filepath.Base(path))
+	}
+}
@@ -0,0 +1,132 @@
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Status 一次运行的结论，与退出码一一对应，供编排脚本分支
+type Status string
+
+const (
+	StatusOK           Status = "ok"
+	StatusError        Status = "error"                // 其它失败，退出码 1
+	StatusThreshold    Status = "threshold_breach"     // 超过 -max-* 阈值，退出码 2
+	StatusBrokerError  Status = "broker_error"         // 连接/订阅/发送失败，退出码 3
+	StatusVerification Status = "verification_failure" // 数据校验失败，退出码 4
+	StatusStalled      Status = "stalled"              // 长时间没有进展，退出码 5
+)
+
+// ExitCode 状态对应的进程退出码
+func (s Status) ExitCode() int {
+	switch s {
+	case StatusOK:
+		return 0
+	case StatusThreshold:
+		return 2
+	case StatusBrokerError:
+		return 3
+	case StatusVerification:
+		return 4
+	case StatusStalled:
+		return 5
+	default:
+		return 1
+	}
+}
+
+// ProgramResult 单个程序的结论和关键指标
+type ProgramResult struct {
+	Status   Status             `json:"status"`
+	Reason   string             `json:"reason,omitempty"`
+	ExitCode int                `json:"exit_code"`
+	Finished time.Time          `json:"finished"`
+	Metrics  map[string]float64 `json:"metrics,omitempty"`
+}
+
+// Result result.json 的内容，producer 和 consumer 写入同一文件时合并，
+// 顶层 Status/ExitCode 取各程序中退出码最大的一个
+type Result struct {
+	Scenario string                   `json:"scenario"`
+	RunID    string                   `json:"run_id,omitempty"`
+	Status   Status                   `json:"status"`
+	Reason   string                   `json:"reason,omitempty"`
+	ExitCode int                      `json:"exit_code"`
+	Labels   map[string]string        `json:"labels,omitempty"` // -labels，各程序的标签合并
+	Programs map[string]ProgramResult `json:"programs"`
+}
+
+// PreviousResult 结果目录的 result.json 中 program 已有的结论，用于在运行前发现会被覆盖的结果；
+// 文件不存在、无法解析或没有该程序时 ok 为 false
+func (l *Layout) PreviousResult(program string) (prev ProgramResult, ok bool) {
+	r, err := l.ReadResult()
+	if err != nil {
+		return prev, false
+	}
+	prev, ok = r.Programs[program]
+	return prev, ok
+}
+
+// ReadResult 读取结果目录的 result.json，各程序都还没写入时返回 os.ErrNotExist
+func (l *Layout) ReadResult() (Result, error) {
+	var r Result
+	data, err := os.ReadFile(l.path("result", "json"))
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("parse result: %w", err)
+	}
+	return r, nil
+}
+
+// WriteResult 合并写入 result.json (flat 布局为 result_<scenario>.json)，返回文件路径
+func (l *Layout) WriteResult(program string, status Status, reason string, metrics map[string]float64) (string, error) {
+	path := l.File("result", "result", "json")
+
+	r := Result{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &r); err != nil {
+			return path, fmt.Errorf("parse existing result: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return path, err
+	}
+	if r.Programs == nil {
+		r.Programs = make(map[string]ProgramResult)
+	}
+	r.Scenario = l.Scenario
+	r.RunID = l.RunID
+	r.Labels = mergeLabels(r.Labels, l.Labels)
+	r.Programs[program] = ProgramResult{
+		Status:   status,
+		Reason:   reason,
+		ExitCode: status.ExitCode(),
+		Finished: time.Now(),
+		Metrics:  metrics,
+	}
+
+	r.Status, r.Reason, r.ExitCode = StatusOK, "", 0
+	names := make([]string, 0, len(r.Programs))
+	for name := range r.Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := r.Programs[name]
+		if p.ExitCode > r.ExitCode {
+			r.Status, r.ExitCode = p.Status, p.ExitCode
+			r.Reason = name + ": " + p.Reason
+		}
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return path, err
+	}
+	return path, WriteBytes(path, append(data, '\n'))
+}
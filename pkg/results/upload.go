@@ -0,0 +1,123 @@
+package results
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// uploaders bucket URL scheme 对应的上传命令，凭据沿用各 CLI 自身的配置 (环境变量、profile、ADC)，
+// 不引入云厂商 SDK 依赖
+var uploaders = map[string]func(ctx context.Context, src, dst string) *exec.Cmd{
+	"s3": func(ctx context.Context, src, dst string) *exec.Cmd {
+		return exec.CommandContext(ctx, "aws", "s3", "cp", "--only-show-errors", src, dst)
+	},
+	"gs": func(ctx context.Context, src, dst string) *exec.Cmd {
+		return exec.CommandContext(ctx, "gcloud", "storage", "cp", "--quiet", src, dst)
+	},
+}
+
+// ValidateBucketURL 检查 -artifact-url，支持 s3://bucket[/prefix] 和 gs://bucket[/prefix]
+func ValidateBucketURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if _, ok := uploaders[u.Scheme]; !ok || u.Host == "" {
+		return fmt.Errorf("unsupported bucket URL %q: want s3://bucket[/prefix] or gs://bucket[/prefix]", raw)
+	}
+	return nil
+}
+
+// noUpload 不上传的产物类型: 下游模拟写出的数据文件体积与消费量相当，不属于结果
+var noUpload = map[string]bool{"sink": true}
+
+// Upload 把本次运行的产物上传到 bucketURL，目标路径保持与本地结果目录相同的相对结构
+//
+// run 布局下上传整个运行目录 (含同一 run ID 的其它程序写入的文件和 manifest.json)；
+// flat 布局的目录由多个场景共用，只上传本进程登记且已生成的产物。
+// 单个文件失败不影响其余文件，返回第一个错误。
+func (l *Layout) Upload(ctx context.Context, bucketURL string) error {
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return err
+	}
+	upload, ok := uploaders[u.Scheme]
+	if !ok {
+		return ValidateBucketURL(bucketURL)
+	}
+
+	names, err := l.uploadNames()
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(l.Root, l.Dir)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(bucketURL, "/")
+	if rel != "." {
+		prefix += "/" + path.Clean(filepath.ToSlash(rel))
+	}
+
+	var first error
+	uploaded := 0
+	for _, name := range names {
+		src := filepath.Join(l.Dir, name)
+		if _, err := os.Stat(src); err != nil {
+			continue // 登记了但未生成
+		}
+		dst := prefix + "/" + name
+		if out, err := upload(ctx, src, dst).CombinedOutput(); err != nil {
+			err = fmt.Errorf("upload %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+			log.Printf("%v", err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		uploaded++
+	}
+	log.Printf("Uploaded %d file(s) to %s", uploaded, prefix)
+	return first
+}
+
+// uploadNames 待上传的文件名，按名称排序
+func (l *Layout) uploadNames() ([]string, error) {
+	l.mu.Lock()
+	kinds := make(map[string]string, len(l.files))
+	for name, kind := range l.files {
+		kinds[name] = kind
+	}
+	l.mu.Unlock()
+
+	var names []string
+	if l.PerRun() {
+		entries, err := os.ReadDir(l.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			// 跳过子目录和 WriteFile 残留的临时文件
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") && !noUpload[kinds[e.Name()]] {
+				names = append(names, e.Name())
+			}
+		}
+		return names, nil
+	}
+	for name, kind := range kinds {
+		if !noUpload[kind] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
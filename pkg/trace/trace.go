@@ -0,0 +1,227 @@
+// Package trace 读写消息到达轨迹文件 (相对时间、大小、key、topic)，
+// 用生产环境记录的真实到达模式回放，代替均匀的合成负载
+//
+// 文件为制表符分隔的文本，每行一条消息:
+//
+//	# pulsar-memory-test trace v1 start=2024-05-01T10:00:00Z
+//	<offset_us>\t<size>\t<key>\t<topic>
+//
+// offset_us 为距 start 的微秒数 (多分区按发布时间记录时可能为负)，key 为空时写 "-"，包含制表符、换行或本身为 "-" 时用 Go 字符串字面量引用；
+// 以 .gz 结尾的文件自动 gzip 压缩。
+package trace
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// header 文件首行前缀
+const header = "# pulsar-memory-test trace v1"
+
+// Record 轨迹中的一条消息
+type Record struct {
+	Offset time.Duration // 距轨迹开始的时间
+	Size   int
+	Key    string
+	Topic  string // 含分区后缀，回放时仅作参考
+}
+
+// Trace 整个轨迹文件
+type Trace struct {
+	Start   time.Time // 记录开始的时间，文件头没有时为零值
+	Records []Record
+}
+
+// Bytes 轨迹中 payload 总字节数
+func (t *Trace) Bytes() int64 {
+	var n int64
+	for _, r := range t.Records {
+		n += int64(r.Size)
+	}
+	return n
+}
+
+// Duration 第一条到最后一条消息的时间跨度
+func (t *Trace) Duration() time.Duration {
+	if len(t.Records) == 0 {
+		return 0
+	}
+	return t.Records[len(t.Records)-1].Offset - t.Records[0].Offset
+}
+
+// Read 读取整个轨迹文件，记录按 offset 排序后返回
+func Read(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("trace %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	t := &Trace{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	sorted := true
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			if rest, ok := strings.CutPrefix(text, header); ok {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(rest), "start="); ok {
+					if t.Start, err = time.Parse(time.RFC3339Nano, v); err != nil {
+						return nil, fmt.Errorf("trace %s:%d: bad start: %w", path, line, err)
+					}
+				}
+			}
+			continue
+		}
+		rec, err := parseRecord(text)
+		if err != nil {
+			return nil, fmt.Errorf("trace %s:%d: %w", path, line, err)
+		}
+		if n := len(t.Records); n > 0 && rec.Offset < t.Records[n-1].Offset {
+			sorted = false
+		}
+		t.Records = append(t.Records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("trace %s: %w", path, err)
+	}
+	if !sorted {
+		sortRecords(t.Records)
+	}
+	return t, nil
+}
+
+func parseRecord(text string) (Record, error) {
+	fields := strings.Split(text, "\t")
+	if len(fields) < 2 {
+		return Record{}, fmt.Errorf("want <offset_us>\\t<size>[\\t<key>[\\t<topic>]], got %q", text)
+	}
+	us, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("bad offset %q", fields[0])
+	}
+	size, err := strconv.Atoi(fields[1])
+	if err != nil || size < 0 {
+		return Record{}, fmt.Errorf("bad size %q", fields[1])
+	}
+	rec := Record{Offset: time.Duration(us) * time.Microsecond, Size: size}
+	if len(fields) > 2 {
+		if rec.Key, err = unquote(fields[2]); err != nil {
+			return Record{}, fmt.Errorf("bad key %q: %w", fields[2], err)
+		}
+	}
+	if len(fields) > 3 {
+		rec.Topic = fields[3]
+	}
+	return rec, nil
+}
+
+func unquote(s string) (string, error) {
+	switch {
+	case s == "-":
+		return "", nil
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// sortRecords 按 offset 稳定排序，多个 topic 交错写入时可能乱序
+func sortRecords(records []Record) {
+	slices.SortStableFunc(records, func(a, b Record) int { return cmp.Compare(a.Offset, b.Offset) })
+}
+
+// Writer 顺序写入轨迹文件，第一条记录的时间作为 start
+type Writer struct {
+	f     *os.File
+	gz    *gzip.Writer
+	w     *bufio.Writer
+	start time.Time
+	n     int64
+}
+
+// Create 创建轨迹文件，以 .gz 结尾时 gzip 压缩
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	tw := &Writer{f: f}
+	if strings.HasSuffix(path, ".gz") {
+		tw.gz = gzip.NewWriter(f)
+		tw.w = bufio.NewWriter(tw.gz)
+	} else {
+		tw.w = bufio.NewWriter(f)
+	}
+	return tw, nil
+}
+
+// Write 写入一条在 t 时刻到达的消息
+func (tw *Writer) Write(t time.Time, size int, key, topic string) error {
+	if tw.start.IsZero() {
+		tw.start = t
+		if _, err := fmt.Fprintf(tw.w, "%s start=%s\n", header, t.UTC().Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+	}
+	tw.n++
+	b := tw.w.AvailableBuffer()
+	b = strconv.AppendInt(b, t.Sub(tw.start).Microseconds(), 10)
+	b = append(b, '\t')
+	b = strconv.AppendInt(b, int64(size), 10)
+	b = append(b, '\t')
+	b = appendKey(b, key)
+	b = append(b, '\t')
+	b = append(b, topic...)
+	b = append(b, '\n')
+	_, err := tw.w.Write(b)
+	return err
+}
+
+// Count 已写入的记录数
+func (tw *Writer) Count() int64 {
+	return tw.n
+}
+
+// Close 刷新缓冲并关闭文件
+func (tw *Writer) Close() error {
+	err := tw.w.Flush()
+	if tw.gz != nil {
+		err = errors.Join(err, tw.gz.Close())
+	}
+	return errors.Join(err, tw.f.Close())
+}
+
+func appendKey(b []byte, key string) []byte {
+	switch {
+	case key == "":
+		return append(b, '-')
+	case key == "-" || strings.HasPrefix(key, `"`) || strings.ContainsAny(key, "\t\n\r"):
+		return strconv.AppendQuote(b, key)
+	}
+	return append(b, key...)
+}
@@ -0,0 +1,128 @@
+// Package watchdog 检测运行卡住 (长时间没有收发消息但仍有待处理的数据)，
+// 并通过 /healthz 暴露存活状态
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PendingFunc 判断是否仍有待处理的数据 (如订阅 backlog > 0)，返回的 detail 写入卡住的原因
+type PendingFunc func(ctx context.Context) (pending bool, detail string, err error)
+
+// Watchdog 记录最后一次活动时间，空闲超过 timeout 且仍有待处理数据时调用 onStall
+type Watchdog struct {
+	timeout time.Duration
+	pending PendingFunc
+	onStall func(reason string)
+
+	start   time.Time
+	last    atomic.Int64 // 最后一次活动的 unix 纳秒
+	mu      sync.Mutex
+	status  string // ok|idle|stalled
+	stalled string
+}
+
+// New 创建 watchdog；pending 为 nil 时空闲即视为卡住
+func New(timeout time.Duration, pending PendingFunc, onStall func(reason string)) *Watchdog {
+	w := &Watchdog{timeout: timeout, pending: pending, onStall: onStall, start: time.Now(), status: "ok"}
+	w.last.Store(w.start.UnixNano())
+	return w
+}
+
+// Touch 记录一次活动 (收到或发出一条消息)，w 为 nil 时不做任何事
+func (w *Watchdog) Touch() {
+	if w == nil {
+		return
+	}
+	w.last.Store(time.Now().UnixNano())
+}
+
+func (w *Watchdog) idleFor() time.Duration {
+	return time.Since(time.Unix(0, w.last.Load()))
+}
+
+func (w *Watchdog) setStatus(status string) {
+	w.mu.Lock()
+	w.status = status
+	w.mu.Unlock()
+}
+
+// Run 定期检查直到 ctx 取消或判定卡住
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(w.timeout/10, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		idle := w.idleFor()
+		if idle < w.timeout {
+			w.setStatus("ok")
+			continue
+		}
+		reason := fmt.Sprintf("no messages for %v", idle.Round(time.Second))
+		if w.pending != nil {
+			pending, detail, err := w.pending(ctx)
+			switch {
+			case err != nil:
+				// 无法确认 backlog 时按卡住处理，避免无声地空转
+				reason += fmt.Sprintf(" (backlog unknown: %v)", err)
+			case !pending:
+				w.setStatus("idle")
+				continue
+			default:
+				reason += " with " + detail
+			}
+		}
+		w.mu.Lock()
+		w.status, w.stalled = "stalled", reason
+		w.mu.Unlock()
+		w.onStall(reason)
+		return
+	}
+}
+
+// ServeHTTP /healthz: 返回状态和最后一次活动时间，卡住时返回 503
+func (w *Watchdog) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	w.mu.Lock()
+	status, reason := w.status, w.stalled
+	w.mu.Unlock()
+	last := time.Unix(0, w.last.Load())
+	rw.Header().Set("Content-Type", "application/json")
+	if status == "stalled" {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(rw).Encode(map[string]any{
+		"status":         status,
+		"reason":         reason,
+		"uptime_seconds": time.Since(w.start).Seconds(),
+		"last_activity":  last,
+		"idle_seconds":   time.Since(last).Seconds(),
+		"stall_timeout":  w.timeout.String(),
+	})
+}
+
+// DumpGoroutines 把所有 goroutine 的调用栈写入文件 (debug=2，与 panic 输出格式相同)
+func DumpGoroutines(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		return err
+	}
+	log.Printf("Goroutine stacks saved to: %s", path)
+	return nil
+}
@@ -0,0 +1,211 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/batch"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// ConsumerConfig 消费场景配置，零值字段取与 cmd/consumer 相同的默认值 (IdleTimeout 除外，见其说明)
+type ConsumerConfig struct {
+	URL               string
+	Client            pulsar.Client // 非 nil 时复用该客户端 (不会关闭)，URL 和 MemoryLimit 被忽略
+	Topic             string
+	Subscription      string
+	SubscriptionType  string // exclusive、shared、failover 或 key_shared，"" = shared (-sub-type)
+	StartLatest       bool   // 新订阅从最新位置开始，默认从最早的消息开始
+	ReceiverQueueSize int    // 0 = 1000 (-queue-size)
+	MemoryLimit       int64  // 客户端内存限制，0 = 客户端默认
+
+	BatchSize      int64         // 批次累计到此字节数后处理，0 = batch.DefaultSize (-batch-size，50 MB)
+	MaxBatches     int           // 处理满此批次数后结束，0 = 不限制
+	MaxMessages    int64         // 收到此消息数后结束，0 = 不限制
+	ProcessDelay   time.Duration // 每个批次模拟的处理耗时
+	ReleasePayload bool          // 读取后立即 ReleasePayload，只保留消息对象用于确认
+	RetainIDOnly   bool          // 批次只保留 MessageID (-retain=id)
+	Verify         bool          // 校验 payload CRC，损坏时 Status 为 verification_failure
+
+	// IdleTimeout 超过此时长没有新消息即认为积压已消费完，收到第一条之前从订阅起算
+	// (空 topic 同样在此时长后结束)，0 = 2s。
+	// cmd/consumer 在第一次 100ms 接收超时时就处理剩余批次并结束；测试中 producer 与 consumer
+	// 常在同一进程里先后运行，默认放宽以免 broker 投递稍慢时提前结束
+	IdleTimeout    time.Duration
+	SampleInterval time.Duration // 内存采样间隔，0 = 1s
+	// Monitor 非 nil 时在该 monitor 上采样和记录 (调用方已按需开启延迟统计、设置标签)，
+	// RunConsumer 照常 Start/Stop，返回后调用方仍可 Save
+	Monitor *metrics.MemoryMonitor
+
+	MaxHeapMB int // 超过时 Status 为 threshold_breach，0 = 不检查
+	MaxRSSMB  int
+}
+
+// Result 一次运行的结论和内存统计
+type Result struct {
+	Status   results.Status
+	Reason   string
+	Duration time.Duration
+	Active   time.Duration // 收到第一条到最后一条消息
+	Summary  metrics.MemorySummary
+	Samples  []metrics.MemoryStats
+}
+
+func (c *ConsumerConfig) setDefaults() {
+	if c.ReceiverQueueSize == 0 {
+		c.ReceiverQueueSize = 1000
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = batch.DefaultSize
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = 2 * time.Second
+	}
+	if c.SampleInterval == 0 {
+		c.SampleInterval = time.Second
+	}
+}
+
+// RunConsumer 订阅 cfg.Topic，用与 cmd/consumer 相同的 batch.Batch 消费: 累计到 BatchSize 后
+// 模拟处理、逐条确认并强制 GC (-gc-after-batch=gc)，直到 ctx 取消、达到 MaxBatches/MaxMessages
+// 或空闲超过 IdleTimeout。连接或订阅失败时返回 error，Status 为 broker_error；超过阈值不算 error，体现在 Status 中
+func RunConsumer(ctx context.Context, cfg ConsumerConfig) (Result, error) {
+	cfg.setDefaults()
+	if cfg.Topic == "" || cfg.Subscription == "" {
+		return Result{Status: results.StatusError}, errors.New("workload: Topic and Subscription are required")
+	}
+	subType, err := ParseSubscriptionType(cfg.SubscriptionType)
+	if err != nil {
+		return Result{Status: results.StatusError}, fmt.Errorf("workload: %w", err)
+	}
+
+	monitor := cfg.Monitor
+	if monitor == nil {
+		if monitor, err = metrics.NewMemoryMonitor(); err != nil {
+			return Result{Status: results.StatusError}, err
+		}
+	}
+	clientMetrics := metrics.NewClientMetrics()
+	if cfg.Client == nil {
+		monitor.SetClientMetrics(clientMetrics)
+	}
+	monitor.SetReceiverQueueSize(cfg.ReceiverQueueSize)
+
+	client, closeClient, err := newClient(cfg.Client, cfg.URL, cfg.MemoryLimit, clientMetrics)
+	if err != nil {
+		return Result{Status: results.StatusBrokerError, Reason: err.Error()}, err
+	}
+	defer closeClient()
+
+	position := pulsar.SubscriptionPositionEarliest
+	if cfg.StartLatest {
+		position = pulsar.SubscriptionPositionLatest
+	}
+	consumer, err := client.Subscribe(pulsar.ConsumerOptions{
+		Topic:                          cfg.Topic,
+		SubscriptionName:               cfg.Subscription,
+		Type:                           subType,
+		SubscriptionInitialPosition:    position,
+		ReceiverQueueSize:              cfg.ReceiverQueueSize,
+		EnableBatchIndexAcknowledgment: true,
+	})
+	if err != nil {
+		err = fmt.Errorf("subscribe %s: %w", cfg.Subscription, err)
+		return Result{Status: results.StatusBrokerError, Reason: err.Error()}, err
+	}
+	defer consumer.Close()
+
+	monitor.Start(ctx, cfg.SampleInterval)
+	start := time.Now()
+	b := batch.New(batch.Config{
+		Size:           cfg.BatchSize,
+		ReleasePayload: cfg.ReleasePayload,
+		RetainIDOnly:   cfg.RetainIDOnly,
+		Verify:         cfg.Verify,
+	}, monitor)
+	var received int64
+	var first time.Time
+	last := start // 收到第一条消息之前从订阅起算空闲
+	for ctx.Err() == nil {
+		recvCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		recvStart := time.Now()
+		msg, err := consumer.Receive(recvCtx)
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+		monitor.RecordReceive(time.Since(recvStart), err == nil)
+		if err != nil {
+			if time.Since(last) >= cfg.IdleTimeout {
+				logging.Debugf("workload: idle for %v, stopping", cfg.IdleTimeout)
+				break
+			}
+			continue
+		}
+		received++
+		last = time.Now()
+		if first.IsZero() {
+			first = last
+		}
+
+		if add(b, monitor, msg) {
+			process(b, consumer, cfg.ProcessDelay)
+			if cfg.MaxBatches > 0 && b.Count() >= cfg.MaxBatches {
+				break
+			}
+		}
+		if cfg.MaxMessages > 0 && received >= cfg.MaxMessages {
+			break
+		}
+	}
+	process(b, consumer, cfg.ProcessDelay)
+	monitor.Stop()
+	// 汇总的消息计数取自最后一个样本，短于采样间隔的运行也要包含最后一个批次
+	monitor.Collect()
+
+	res := Result{
+		Duration: time.Since(start),
+		Summary:  monitor.GetSummary(),
+		Samples:  monitor.GetStats(),
+	}
+	if received > 0 {
+		res.Active = last.Sub(first)
+	}
+	res.Status, res.Reason = evaluate(res.Summary, cfg.MaxHeapMB, cfg.MaxRSSMB)
+	return res, nil
+}
+
+// add 与 cmd/consumer 的 BatchProcessor.AddReceived 相同的顺序: 释放前记录线路大小和校验，
+// 然后释放 payload 并加入批次；延迟按发布时间计算 (-latency-source=publish)，monitor 开启延迟统计时记录。
+// 返回批次是否已满
+func add(b *batch.Batch, monitor *metrics.MemoryMonitor, msg pulsar.Message) bool {
+	received := batch.HoldClock()
+	size := b.Inspect(msg)
+	publishTime := msg.PublishTime()
+	monitor.RecordLatency(time.Since(publishTime))
+	b.VerifyPayload(msg, msg.Payload())
+	b.Release(msg)
+	return b.Append(msg, size, publishTime, received)
+}
+
+// process 模拟处理并确认整个批次，随后强制 GC 观察内存释放
+func process(b *batch.Batch, consumer pulsar.Consumer, delay time.Duration) {
+	if b.Len() == 0 {
+		return
+	}
+	n := b.Begin()
+	logging.Debugf("workload: batch #%d, %d messages, %.2f MB", n, b.Len(), float64(b.Bytes())/1024/1024)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	b.AckAll(consumer)
+	b.Done()
+	b.Reset()
+	runtime.GC()
+}
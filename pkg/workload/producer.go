@@ -0,0 +1,175 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/logging"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/payload"
+)
+
+// ProducerConfig 生产场景配置，零值字段取与 cmd/producer 相同的默认值
+type ProducerConfig struct {
+	URL         string
+	Client      pulsar.Client // 非 nil 时复用该客户端 (不会关闭)
+	Topic       string
+	TotalBytes  int64   // 0 = 200 MB
+	Messages    int64   // 发送的消息数，非 0 时代替 TotalBytes / MessageSize
+	MessageSize int     // 0 = 1024
+	Rate        float64 // 所有 worker 合计每秒最多发送的消息数，0 = 不限速 (-rate)
+	Concurrency int     // 并发发送的 worker 数，0 = 10
+	Compression pulsar.CompressionType
+	Seed        int64 // payload 生成种子，0 = 按时间
+	// NoHeader 不在 payload 开头嵌入头部，改用 crc32 property 携带校验和
+	NoHeader bool
+
+	DisableBatching bool
+	MaxPending      int   // producer MaxPendingMessages，0 = 客户端默认
+	MemoryLimit     int64 // 客户端内存限制，0 = 客户端默认
+
+	// Monitor 非 nil 时 RunProducer 按 SampleInterval (0 = 1s) Start 并在结束时 Stop，
+	// 每条发送成功的消息记入 RecordMessage，返回后调用方仍可 Save
+	Monitor        *metrics.MemoryMonitor
+	SampleInterval time.Duration
+}
+
+// ProducerResult 生产结果
+type ProducerResult struct {
+	Messages int64
+	Bytes    int64
+	Errors   int64
+	Duration time.Duration
+}
+
+// RunProducer 向 cfg.Topic 写入 Messages 条或约 TotalBytes 字节 (消息数向下取整)，payload 与 cmd/producer 格式相同，
+// consumer 可用 Verify 校验；ctx 取消时停止发起新的发送，返回已发送部分的统计和 ctx.Err()
+func RunProducer(ctx context.Context, cfg ProducerConfig) (ProducerResult, error) {
+	if cfg.Topic == "" {
+		return ProducerResult{}, errors.New("workload: Topic is required")
+	}
+	if cfg.TotalBytes == 0 {
+		cfg.TotalBytes = 200 * 1024 * 1024
+	}
+	if cfg.MessageSize == 0 {
+		cfg.MessageSize = 1024
+	}
+	if cfg.SampleInterval == 0 {
+		cfg.SampleInterval = time.Second
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 10
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	client, closeClient, err := newClient(cfg.Client, cfg.URL, cfg.MemoryLimit, metrics.NewClientMetrics())
+	if err != nil {
+		return ProducerResult{}, err
+	}
+	defer closeClient()
+	producer, err := client.CreateProducer(pulsar.ProducerOptions{
+		Topic:                   cfg.Topic,
+		CompressionType:         cfg.Compression,
+		BatchingMaxPublishDelay: 10 * time.Millisecond,
+		BatchingMaxMessages:     1000,
+		DisableBatching:         cfg.DisableBatching,
+		MaxPendingMessages:      cfg.MaxPending,
+	})
+	if err != nil {
+		return ProducerResult{}, fmt.Errorf("create producer: %w", err)
+	}
+	defer producer.Close()
+
+	genConfig := payload.Config{
+		Sizes:  payload.Fixed(cfg.MessageSize),
+		Header: !cfg.NoHeader,
+		Seed:   cfg.Seed,
+	}
+	total := cfg.TotalBytes / int64(cfg.MessageSize)
+	if cfg.Messages > 0 {
+		total = cfg.Messages
+	}
+	if cfg.Monitor != nil {
+		cfg.Monitor.Start(ctx, cfg.SampleInterval)
+	}
+	var next, sent, sentBytes, failed int64
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			gen := payload.NewGenerator(genConfig, int64(worker))
+			for ctx.Err() == nil {
+				seq := atomic.AddInt64(&next, 1) - 1
+				if seq >= total {
+					return
+				}
+				if cfg.Rate > 0 && !waitUntil(ctx, start.Add(time.Duration(float64(seq)/cfg.Rate*float64(time.Second)))) {
+					return
+				}
+				data := gen.Build(cfg.MessageSize, uint32(worker), uint64(seq), time.Now())
+				msg := &pulsar.ProducerMessage{
+					Payload: data,
+					Properties: map[string]string{
+						"worker":   strconv.Itoa(worker),
+						"sequence": strconv.FormatInt(seq, 10),
+					},
+				}
+				if cfg.NoHeader || len(data) < payload.HeaderSize {
+					msg.Properties[payload.ChecksumProperty] = payload.Checksum(data)
+				}
+				if _, err := producer.Send(ctx, msg); err != nil {
+					atomic.AddInt64(&failed, 1)
+					logging.Debugf("workload: send failed: %v", err)
+					continue
+				}
+				atomic.AddInt64(&sent, 1)
+				atomic.AddInt64(&sentBytes, int64(len(data)))
+				if cfg.Monitor != nil {
+					cfg.Monitor.RecordMessage(int64(len(data)))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := producer.Flush(); err != nil {
+		logging.Debugf("workload: flush failed: %v", err)
+	}
+	if cfg.Monitor != nil {
+		cfg.Monitor.Stop()
+		// 汇总的消息计数取自最后一个样本
+		cfg.Monitor.Collect()
+	}
+
+	return ProducerResult{
+		Messages: sent,
+		Bytes:    sentBytes,
+		Errors:   failed,
+		Duration: time.Since(start),
+	}, ctx.Err()
+}
+
+// waitUntil 等到 t (按速率分配给该序号的发送时间)，ctx 先取消时返回 false
+func waitUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
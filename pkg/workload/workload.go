@@ -0,0 +1,76 @@
+// Package workload 以库的形式提供 producer/consumer 的核心测试场景，
+// 供 go test 中的基准和集成测试直接调用，而不必启动二进制:
+//
+//	res, err := workload.RunConsumer(ctx, workload.ConsumerConfig{
+//		URL:            "pulsar://localhost:6650",
+//		Topic:          topic,
+//		Subscription:   "bench",
+//		ReleasePayload: true,
+//	})
+//	if res.Summary.MaxHeapAlloc > limit { ... }
+//
+// 只覆盖最常用的参数 (批次大小、ReleasePayload、receiver queue、处理延迟、阈值)；
+// 下游模拟、A/B、fan-out 等仍需使用 cmd/consumer。
+// MemoryMonitor 统计的是整个进程，测试中应一次只运行一个 workload，
+// 并注意测试框架自身的分配也会计入。
+package workload
+
+import (
+	"fmt"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"pulsar-memory-test/pkg/metrics"
+	"pulsar-memory-test/pkg/results"
+)
+
+// DefaultURL 未指定 URL 时连接的 broker
+const DefaultURL = "pulsar://localhost:6650"
+
+// newClient 创建客户端并关联客户端指标；client 非 nil 时直接复用，close 为空操作
+func newClient(client pulsar.Client, url string, memoryLimit int64, m *metrics.ClientMetrics) (pulsar.Client, func(), error) {
+	if client != nil {
+		return client, func() {}, nil
+	}
+	if url == "" {
+		url = DefaultURL
+	}
+	opts := pulsar.ClientOptions{URL: url, MetricsRegisterer: m.Registerer()}
+	if memoryLimit > 0 {
+		opts.MemoryLimitBytes = memoryLimit
+	}
+	c, err := pulsar.NewClient(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create client: %w", err)
+	}
+	return c, c.Close, nil
+}
+
+// ParseSubscriptionType 解析 exclusive、shared、failover、key_shared，与 cmd/consumer -sub-type 相同；空串为 shared
+func ParseSubscriptionType(s string) (pulsar.SubscriptionType, error) {
+	switch s {
+	case "exclusive":
+		return pulsar.Exclusive, nil
+	case "", "shared":
+		return pulsar.Shared, nil
+	case "failover":
+		return pulsar.Failover, nil
+	case "key_shared":
+		return pulsar.KeyShared, nil
+	default:
+		return pulsar.Shared, fmt.Errorf("unknown subscription type %q", s)
+	}
+}
+
+// evaluate 按阈值判定结论，与 cmd/consumer 的 -max-heap-mb/-max-rss-mb 一致
+func evaluate(s metrics.MemorySummary, maxHeapMB, maxRSSMB int) (results.Status, string) {
+	if s.CorruptCount > 0 {
+		return results.StatusVerification, fmt.Sprintf("%d corrupted payloads", s.CorruptCount)
+	}
+	if maxHeapMB > 0 && s.MaxHeapAlloc > uint64(maxHeapMB)<<20 {
+		return results.StatusThreshold, fmt.Sprintf("max HeapAlloc %.2f MB exceeds %d MB", float64(s.MaxHeapAlloc)/1024/1024, maxHeapMB)
+	}
+	if maxRSSMB > 0 && s.MaxRSS > uint64(maxRSSMB)<<20 {
+		return results.StatusThreshold, fmt.Sprintf("max RSS %.2f MB exceeds %d MB", float64(s.MaxRSS)/1024/1024, maxRSSMB)
+	}
+	return results.StatusOK, ""
+}
@@ -199,6 +199,12 @@ type ConsumerOptions struct {
 	// Name specifies the consumer name.
 	Name string
 
+	// PriorityLevel sets the consumer priority for Shared subscriptions. The broker dispatches messages to
+	// consumers with a lower value first (0 is the highest priority), and only falls back to lower priority
+	// consumers once the higher ones have no permits left.
+	// Default is nil, which leaves the priority unset (broker default 0).
+	PriorityLevel *int32
+
 	// ReadCompacted, if enabled, the consumer will read messages from the compacted topic rather than reading the
 	// full message backlog of the topic. This means that, if the topic has been compacted, the consumer will only
 	// see the latest value for each key in the topic, up until the point in the topic message backlog that has been
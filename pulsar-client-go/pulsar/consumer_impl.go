@@ -461,6 +461,7 @@ func newPartitionConsumerOpts(topic, consumerName string, idx int, options Consu
 		nackPrecisionBit:            options.NackPrecisionBit,
 		metadata:                    options.Properties,
 		subProperties:               options.SubscriptionProperties,
+		priorityLevel:               options.PriorityLevel,
 		replicateSubscriptionState:  options.ReplicateSubscriptionState,
 		startMessageID:              options.startMessageID,
 		startMessageIDInclusive:     options.StartMessageIDInclusive,
@@ -105,6 +105,7 @@ type partitionConsumerOpts struct {
 	nackPrecisionBit            *int64
 	metadata                    map[string]string
 	subProperties               map[string]string
+	priorityLevel               *int32
 	replicateSubscriptionState  bool
 	startMessageID              *trackingMessageID
 	startMessageIDInclusive     bool
@@ -2012,7 +2013,7 @@ func (pc *partitionConsumer) grabConn(assignedBrokerURL string) error {
 		ConsumerId:                 proto.Uint64(pc.consumerID),
 		RequestId:                  proto.Uint64(requestID),
 		ConsumerName:               proto.String(pc.name),
-		PriorityLevel:              nil,
+		PriorityLevel:              pc.options.priorityLevel,
 		Durable:                    proto.Bool(pc.options.subscriptionMode == Durable),
 		Metadata:                   internal.ConvertFromStringMap(pc.options.metadata),
 		SubscriptionProperties:     internal.ConvertFromStringMap(pc.options.subProperties),
@@ -146,6 +146,9 @@ type Message interface {
 	// This is useful for batch consumption scenarios where you want to
 	// keep only the MessageID for ACK while releasing the payload memory.
 	// Note: Properties are also released to maximize memory savings.
+	// Contract: after release, Payload() and Properties() return nil (never the
+	// old data or a reused buffer); ID(), Topic(), PublishTime() and the other
+	// metadata accessors keep working, so the message can still be acked.
 	ReleasePayload()
 }
 
@@ -0,0 +1,41 @@
+#!/bin/bash
+
+# 通过 admin REST API 触发 topic 压缩并等待完成
+# 用法: ./scripts/compact-topic.sh <topic> [admin-url]
+
+set -e
+
+TOPIC=${1:?"Usage: $0 <topic> [admin-url]"}
+ADMIN_URL=${2:-${ADMIN_URL:-"http://localhost:8080"}}
+MAX_RETRIES=${MAX_RETRIES:-120}
+
+# persistent://tenant/ns/topic -> persistent/tenant/ns/topic
+TOPIC_PATH=$(echo "$TOPIC" | sed 's#://#/#')
+COMPACTION_URL="$ADMIN_URL/admin/v2/$TOPIC_PATH/compaction"
+
+echo "Triggering compaction: $TOPIC"
+curl -sf -X PUT "$COMPACTION_URL" > /dev/null
+
+# 轮询压缩状态: NOT_RUN / RUNNING / SUCCESS / ERROR
+RETRY_COUNT=0
+while [ $RETRY_COUNT -lt $MAX_RETRIES ]; do
+    STATUS=$(curl -sf "$COMPACTION_URL" | sed -n 's/.*"status" *: *"\([A-Z_]*\)".*/\1/p')
+    case "$STATUS" in
+        SUCCESS)
+            echo "Compaction finished"
+            exit 0
+            ;;
+        ERROR)
+            echo "Error: compaction failed"
+            curl -s "$COMPACTION_URL"
+            exit 1
+            ;;
+    esac
+
+    RETRY_COUNT=$((RETRY_COUNT + 1))
+    echo "Waiting for compaction... ($STATUS, $RETRY_COUNT/$MAX_RETRIES)"
+    sleep 1
+done
+
+echo "Error: compaction did not finish within expected time"
+exit 1
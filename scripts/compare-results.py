@@ -4,12 +4,14 @@ import sys
 import json
 import os
 
+from stats_schema import migrate
+
 def load_stats(filename):
-    """加载统计数据"""
+    """加载统计数据，旧版本的文件迁移到当前 schema"""
     if not os.path.exists(filename):
         return None
     with open(filename, 'r') as f:
-        return json.load(f)
+        return migrate(json.load(f))
 
 def load_external_rss(filename):
     """加载外部 RSS 数据"""
@@ -0,0 +1,371 @@
+#!/usr/bin/env python3
+"""对比任意多个场景的内存统计 (第一个场景作为基准)
+
+用法: compare-scenarios.py [-from-version V] [-to-version V] [-changelog] [-html FILE [-x time|messages]]
+                           <results_dir> <baseline> <scenario> [scenario...]
+  -from-version/-to-version 基准和最后一个场景所用的 pulsar-client-go 版本 (tag，如 v0.14.0)，
+  写入报告标题；不给时取各自的 labels.client_version
+  -changelog 从 GitHub 取两个 tag 之间的提交，为最后一个场景相对基准上升超过 5% 的指标
+  列出相关提交 (按关键词匹配)；设置 GITHUB_TOKEN 可避免匿名请求的频率限制
+  -html 另把报告写成 HTML: 对比表格，以及各场景 HeapAlloc 和 RSS 曲线叠加在同一坐标轴上的 SVG，
+  -x 为横轴: time (距各自第一个样本的秒数，默认) 或 messages (已处理的消息数，吞吐不同的运行也能逐点对齐)；
+  曲线取 samples，-samples=rollup 的结果取各区间的最大值 (-x messages 时优先用 consumer -rollup-messages 的 msg_rollups)
+"""
+import argparse
+import contextlib
+import gzip
+import html
+import io
+import sys
+import json
+import os
+import re
+import urllib.request
+from datetime import datetime
+
+from stats_schema import migrate
+
+CLIENT_REPO = 'apache/pulsar-client-go'
+# 超过该百分比的上升视为回归
+REGRESSION_PERCENT = 5.0
+# 指标 -> 提交信息中可能相关的关键词
+METRIC_KEYWORDS = {
+    'max_heap_alloc': ('memory', 'heap', 'alloc', 'buffer', 'pool', 'leak', 'payload', 'queue', 'batch', 'chunk'),
+    'avg_heap_alloc': ('memory', 'heap', 'alloc', 'buffer', 'pool', 'leak', 'payload', 'queue', 'batch', 'chunk'),
+    'max_rss': ('memory', 'rss', 'buffer', 'pool', 'leak', 'goroutine', 'connection'),
+    'avg_rss': ('memory', 'rss', 'buffer', 'pool', 'leak', 'goroutine', 'connection'),
+    'final_rss': ('memory', 'rss', 'leak', 'release', 'close', 'goroutine'),
+}
+# HTML 曲线最多的点数，更长的序列按步长抽取
+MAX_CHART_POINTS = 1000
+# 各场景曲线的颜色，基准为第一个
+COLORS = ('black', 'firebrick', 'steelblue', 'darkorange', 'seagreen', 'purple', 'goldenrod', 'teal', 'deeppink', 'slategray')
+
+def load_stats(results_dir, scenario):
+    """加载 stats_<scenario>.json，不存在时尝试 -stats-gzip 写出的 .json.gz；旧版本的文件迁移到当前 schema"""
+    filename = os.path.join(results_dir, f'stats_{scenario}.json')
+    if os.path.exists(filename):
+        with open(filename, 'r') as f:
+            return migrate(json.load(f))
+    if os.path.exists(filename + '.gz'):
+        with gzip.open(filename + '.gz', 'rt') as f:
+            return migrate(json.load(f))
+    return None
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def print_comparison(scenarios, versions=None, changelog=False):
+    """打印对比表格，差值相对第一个场景；versions 为 (基准版本, 最后一个场景的版本)，
+    changelog 时附上两个版本之间与回归指标相关的提交"""
+    name_width = max(15, max(len(name) for name, _ in scenarios))
+    base = scenarios[0][1]['summary']
+
+    print("")
+    print("=" * 70)
+    print("              SCENARIO COMPARISON REPORT")
+    print(f"              (baseline: {scenarios[0][0]})")
+    if versions and any(versions):
+        print(f"              (pulsar-client-go: {versions[0] or '?'} -> {versions[1] or '?'})")
+    print("=" * 70)
+
+    metrics = [
+        ('Max HeapAlloc', 'max_heap_alloc'),
+        ('Avg HeapAlloc', 'avg_heap_alloc'),
+        ('Max RSS', 'max_rss'),
+        ('Avg RSS', 'avg_rss'),
+        ('Final RSS', 'final_rss'),
+    ]
+    for title, key in metrics:
+        print("-" * 70)
+        print(f"  {title} - Unit: MB")
+        print("-" * 70)
+        print(f"  {'Scenario':<{name_width}} {'Value':>10} {'Delta':>10} {'Change':>10}")
+        base_value = mb(base[key])
+        for name, stats in scenarios:
+            value = mb(stats['summary'][key])
+            delta = value - base_value
+            pct = (delta / base_value * 100) if base_value > 0 else 0
+            print(f"  {name:<{name_width}} {value:>10.2f} {delta:>+10.2f} {pct:>+9.1f}%")
+        print("")
+
+    print("-" * 70)
+    print("  Memory Amplification (Max Memory / Data Size)")
+    print("-" * 70)
+    print(f"  {'Scenario':<{name_width}} {'Messages':>12} {'Heap':>8} {'RSS':>8}")
+    for name, stats in scenarios:
+        s = stats['summary']
+        print(f"  {name:<{name_width}} {s['message_count']:>12,} {s['heap_ratio']:>7.2f}x {s['rss_ratio']:>7.2f}x")
+
+    print_madvise_note(scenarios, name_width)
+    print_setup_cost(scenarios, name_width)
+    print_batch_gc(scenarios, name_width)
+    print_connection_pool(scenarios, name_width)
+    if changelog:
+        print_changelog(scenarios, *versions)
+    print("=" * 70)
+
+def madvdontneed(stats):
+    """从 metadata.godebug 读取 madvdontneed 设置，未设置时为 Go 1.16+ 的默认值 1"""
+    godebug = stats.get('metadata', {}).get('godebug', '')
+    value = '1'
+    for kv in godebug.split(','):
+        k, _, v = kv.strip().partition('=')
+        if k == 'madvdontneed':
+            value = v
+    return value
+
+def print_madvise_note(scenarios, name_width):
+    """场景间 madvdontneed 不同时提示 RSS 的含义差异"""
+    values = [madvdontneed(stats) for _, stats in scenarios]
+    if len(set(values)) < 2:
+        return
+    print("")
+    print("-" * 70)
+    print("  Page Release (GODEBUG madvdontneed)")
+    print("-" * 70)
+    print(f"  {'Scenario':<{name_width}} {'madvise':>14} {'Final Heap':>11} {'Final RSS':>10}")
+    for (name, stats), value in zip(scenarios, values):
+        s = stats['summary']
+        advice = 'MADV_DONTNEED' if value == '1' else 'MADV_FREE'
+        print(f"  {name:<{name_width}} {advice:>14} {mb(s['final_heap_alloc']):>10.2f}M {mb(s['final_rss']):>9.2f}M")
+    print("")
+    print("  MADV_FREE 释放的页只有在系统内存紧张时才会被内核回收，进程 RSS 在此之前")
+    print("  不会下降；RSS 偏高不代表堆没有释放，应结合 HeapAlloc/HeapReleased 判断。")
+    print("  MADV_DONTNEED 立即归还页面，RSS 能如实反映 Go 已释放的内存。")
+
+def print_setup_cost(scenarios, name_width):
+    """有 metadata.setup_heap_alloc 时打印客户端/消费者的创建开销 (如共享客户端 vs 每个消费者一个客户端)"""
+    if not all('setup_heap_alloc' in stats.get('metadata', {}) for _, stats in scenarios):
+        return
+    print("")
+    print("-" * 70)
+    print("  Setup Cost (clients + consumers, before consuming)")
+    print("-" * 70)
+    print(f"  {'Scenario':<{name_width}} {'Clients':>8} {'Heap':>10} {'RSS':>10} {'Max Conns':>10}")
+    for name, stats in scenarios:
+        meta, s = stats['metadata'], stats['summary']
+        print(f"  {name:<{name_width}} {meta.get('clients', '1'):>8} {mb(int(meta['setup_heap_alloc'])):>+9.2f}M "
+              f"{mb(int(meta['setup_rss'])):>+9.2f}M {s.get('max_connections', 0):>10.0f}")
+
+def batch_gc(stats):
+    """consumer 的 -gc-after-batch/-gc-every，旧结果没有这两个 flag 时为默认的每批次 runtime.GC"""
+    meta = stats.get('metadata', {})
+    return f"{meta.get('flag.gc-after-batch', 'gc')}/{meta.get('flag.gc-every', '1')}"
+
+def print_batch_gc(scenarios, name_width):
+    """场景间 -gc-after-batch 不同时打印主动 GC 的代价: 次数、阻塞时长、GC CPU 和吞吐"""
+    variants = [batch_gc(stats) for _, stats in scenarios]
+    if len(set(variants)) < 2:
+        return
+    print("")
+    print("-" * 70)
+    print("  GC after batch (-gc-after-batch/-gc-every)")
+    print("-" * 70)
+    print(f"  {'Scenario':<{name_width}} {'Variant':>10} {'Forced':>7} {'Blocked':>9} {'GCs':>6} {'GC CPU':>7} {'MB/s':>8}")
+    for (name, stats), variant in zip(scenarios, variants):
+        s = stats['summary']
+        secs = s['duration'] / 1e9
+        rate = mb(s['message_bytes']) / secs if secs > 0 else 0
+        print(f"  {name:<{name_width}} {variant:>10} {s.get('forced_gcs', 0):>7} {s.get('forced_gc_ms', 0):>7.0f}ms "
+              f"{s['num_gc']:>6} {s['gc_cpu_seconds']:>6.2f}s {rate:>8.2f}")
+
+def connection_pool(stats):
+    """-max-connections-per-broker/-connection-max-idle，0 为客户端默认值"""
+    meta = stats.get('metadata', {})
+    return f"{meta.get('flag.max-connections-per-broker', '0')}/{meta.get('flag.connection-max-idle', '0s')}"
+
+def print_connection_pool(scenarios, name_width):
+    """场景间连接池参数不同时打印连接数和内存"""
+    variants = [connection_pool(stats) for _, stats in scenarios]
+    if len(set(variants)) < 2:
+        return
+    print("")
+    print("-" * 70)
+    print("  Connection pool (-max-connections-per-broker/-connection-max-idle)")
+    print("-" * 70)
+    print(f"  {'Scenario':<{name_width}} {'Pool':>10} {'Max':>5} {'Avg':>6} {'Opened':>7} {'Closed':>7} {'Max Heap':>10} {'Max RSS':>10}")
+    for (name, stats), variant in zip(scenarios, variants):
+        s = stats['summary']
+        c = s.get('connections') or {}
+        print(f"  {name:<{name_width}} {variant:>10} {c.get('max', 0):>5.0f} {c.get('avg', 0):>6.1f} "
+              f"{c.get('opened', 0):>7.0f} {c.get('closed', 0):>7.0f} {mb(s['max_heap_alloc']):>9.2f}M {mb(s['max_rss']):>9.2f}M")
+
+def client_version(stats):
+    """-labels client_version=...，没有时返回 None"""
+    return (stats.get('labels') or {}).get('client_version')
+
+def regressions(scenarios):
+    """最后一个场景相对基准上升超过 REGRESSION_PERCENT 的指标: [(指标, 百分比)]"""
+    base, last = scenarios[0][1]['summary'], scenarios[-1][1]['summary']
+    found = []
+    for key in METRIC_KEYWORDS:
+        if base.get(key, 0) > 0:
+            pct = (last[key] - base[key]) / base[key] * 100
+            if pct > REGRESSION_PERCENT:
+                found.append((key, pct))
+    return found
+
+def fetch_commits(from_version, to_version):
+    """GitHub compare API 返回的两个 tag 之间的提交 (最多 250 个)"""
+    url = f'https://api.github.com/repos/{CLIENT_REPO}/compare/{from_version}...{to_version}'
+    req = urllib.request.Request(url, headers={'Accept': 'application/vnd.github+json'})
+    if os.environ.get('GITHUB_TOKEN'):
+        req.add_header('Authorization', f"Bearer {os.environ['GITHUB_TOKEN']}")
+    with urllib.request.urlopen(req, timeout=30) as resp:
+        return json.load(resp).get('commits') or []
+
+def print_changelog(scenarios, from_version, to_version):
+    """把回归的指标关联到两个版本之间标题含相关关键词的提交"""
+    print("")
+    print("-" * 70)
+    print(f"  Changelog {CLIENT_REPO} {from_version}...{to_version}")
+    print("-" * 70)
+    found = regressions(scenarios)
+    if not found:
+        print(f"  No metric of {scenarios[-1][0]} regressed more than {REGRESSION_PERCENT:.0f}% over the baseline")
+        return
+    try:
+        commits = fetch_commits(from_version, to_version)
+    except (OSError, ValueError) as e:
+        print(f"  Failed to fetch commits from GitHub: {e}")
+        return
+    print(f"  {len(commits)} commits between the tags")
+    for key, pct in found:
+        related = []
+        for c in commits:
+            title = c['commit']['message'].splitlines()[0]
+            if any(k in title.lower() for k in METRIC_KEYWORDS[key]):
+                related.append((title, c['html_url']))
+        print(f"  {key} {pct:+.1f}%: {len(related)} possibly related commits")
+        for title, url in related:
+            print(f"    - {title}")
+            print(f"      {url}")
+
+def parse_time(value):
+    """Go 的 RFC 3339 时间，小数秒截到 Python 支持的微秒"""
+    return datetime.fromisoformat(re.sub(r'(\.\d{6})\d+', r'\1', value.replace('Z', '+00:00')))
+
+def series(stats, x_axis):
+    """[(x, heap_alloc, rss)]，x 为距第一个点的秒数或累计消息数"""
+    points = []
+    samples = stats.get('samples') or []
+    if samples:
+        start = parse_time(samples[0]['timestamp'])
+        for s in samples:
+            if x_axis == 'messages':
+                x = s['message_count']
+            elif 'elapsed' in s:
+                # 单调时钟: 休眠/挂起的时间不占横轴，曲线在不连续处不会出现长长的一段直线
+                x = s['elapsed'] - samples[0]['elapsed']
+            else:
+                x = (parse_time(s['timestamp']) - start).total_seconds()
+            points.append((x, s['heap_alloc'], s['rss']))
+    elif x_axis == 'messages' and stats.get('msg_rollups'):
+        for r in stats['msg_rollups']:
+            points.append((r['messages'], r['heap_alloc']['max'], r['rss']['max']))
+    else:
+        rollups = stats.get('rollups') or []
+        messages = 0
+        for r in rollups:
+            # rollup 的 messages 是区间增量，区间起点对应此前的累计值
+            x = messages if x_axis == 'messages' else (parse_time(r['start']) - parse_time(rollups[0]['start'])).total_seconds()
+            points.append((x, r['heap_alloc']['max'], r['rss']['max']))
+            messages += r['messages']
+    step = (len(points) + MAX_CHART_POINTS - 1) // MAX_CHART_POINTS
+    if step > 1:
+        points = points[::step] + [points[-1]]
+    return points
+
+def overlay_svg(title, x_label, curves, index):
+    """不依赖 matplotlib 的折线图: curves 为 [(名称, 颜色, points)]，index 选 points 中的 HeapAlloc (1) 或 RSS (2)"""
+    width, height, pad = 900, 420, 60
+    max_x = max((p[0] for _, _, pts in curves for p in pts), default=0) or 1
+    max_y = mb(max((p[index] for _, _, pts in curves for p in pts), default=0)) * 1.1 or 1
+
+    def xy(p):
+        return (pad + p[0] / max_x * (width - 2 * pad),
+                height - pad - mb(p[index]) / max_y * (height - 2 * pad))
+
+    out = [f'<svg xmlns="http://www.w3.org/2000/svg" width="{width}" height="{height}" font-family="sans-serif" font-size="11">',
+           f'<rect width="{width}" height="{height}" fill="white"/>',
+           f'<text x="{width / 2}" y="20" text-anchor="middle" font-size="13">{html.escape(title)}</text>',
+           f'<line x1="{pad}" y1="{height - pad}" x2="{width - pad}" y2="{height - pad}" stroke="black"/>',
+           f'<line x1="{pad}" y1="{pad}" x2="{pad}" y2="{height - pad}" stroke="black"/>',
+           f'<text x="{width / 2}" y="{height - 20}" text-anchor="middle">{x_label} (0 - {max_x:,.6g})</text>',
+           f'<text x="15" y="{height / 2}" text-anchor="middle" transform="rotate(-90 15 {height / 2})">MB (0 - {max_y / 1.1:.1f})</text>']
+    for i, (name, color, pts) in enumerate(curves):
+        line = ' '.join(f'{x:.1f},{y:.1f}' for x, y in map(xy, pts))
+        out.append(f'<polyline points="{line}" fill="none" stroke="{color}" stroke-width="1.5"/>')
+        out.append(f'<text x="{width - pad - 200}" y="{pad + 14 * i}" fill="{color}">{html.escape(name)}</text>')
+    out.append('</svg>')
+    return '\n'.join(out)
+
+def write_html(path, scenarios, report, x_axis):
+    """文本报告加上叠加的 HeapAlloc/RSS 曲线"""
+    curves = [(name, COLORS[i % len(COLORS)], series(stats, x_axis)) for i, (name, stats) in enumerate(scenarios)]
+    curves = [c for c in curves if len(c[2]) >= 2]
+    x_label = 'messages processed' if x_axis == 'messages' else 'seconds since first sample'
+    title = ' vs '.join(name for name, _ in scenarios)
+    out = ['<!DOCTYPE html>', '<html><head><meta charset="utf-8">',
+           f'<title>{html.escape(title)}</title>',
+           '<style>body { font-family: sans-serif; margin: 2em; } pre { background: #f6f6f6; padding: 1em; }</style>',
+           '</head><body>', f'<h1>{html.escape(title)}</h1>']
+    if curves:
+        out.append(overlay_svg('HeapAlloc', x_label, curves, 1))
+        out.append(overlay_svg('RSS', x_label, curves, 2))
+    else:
+        out.append('<p>No samples or rollups to plot.</p>')
+    out += [f'<pre>{html.escape(report)}</pre>', '</body></html>']
+    with open(path, 'w') as f:
+        f.write('\n'.join(out) + '\n')
+
+def main():
+    parser = argparse.ArgumentParser(
+        usage='%(prog)s [-from-version V] [-to-version V] [-changelog] [-html FILE [-x time|messages]] <results_dir> <baseline> <scenario> [scenario...]')
+    parser.add_argument('-from-version', help='pulsar-client-go tag of the baseline')
+    parser.add_argument('-to-version', help='pulsar-client-go tag of the last scenario')
+    parser.add_argument('-changelog', action='store_true',
+                        help='link regressions to commits between the two tags on GitHub')
+    parser.add_argument('-html', help='also write the report with overlaid HeapAlloc/RSS charts to this file')
+    parser.add_argument('-x', choices=('time', 'messages'), default='time',
+                        help='x axis of the -html charts: elapsed time or messages processed')
+    parser.add_argument('results_dir')
+    parser.add_argument('names', nargs='*')
+    args = parser.parse_args()
+    if len(args.names) < 2:
+        print(__doc__)
+        sys.exit(1)
+
+    results_dir = args.results_dir
+    scenarios = []
+    for name in args.names:
+        stats = load_stats(results_dir, name)
+        if stats is None:
+            print(f"Warning: stats_{name}.json not found in {results_dir}, skipped")
+            continue
+        scenarios.append((name, stats))
+
+    if len(scenarios) < 2:
+        print("Need at least two scenarios to compare")
+        sys.exit(1)
+
+    from_version = args.from_version or client_version(scenarios[0][1])
+    to_version = args.to_version or client_version(scenarios[-1][1])
+    if args.changelog and (not from_version or not to_version):
+        print("-changelog needs -from-version and -to-version (or client_version labels)")
+        sys.exit(1)
+    if not args.html:
+        print_comparison(scenarios, (from_version, to_version), args.changelog)
+        return
+    # 文本报告同时打印和嵌入 HTML，-changelog 只请求一次 GitHub
+    buf = io.StringIO()
+    with contextlib.redirect_stdout(buf):
+        print_comparison(scenarios, (from_version, to_version), args.changelog)
+    print(buf.getvalue(), end='')
+    write_html(args.html, scenarios, buf.getvalue(), args.x)
+    print(f"HTML report saved to: {args.html}")
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,92 @@
+#!/usr/bin/env python3
+"""合并 producer -compression-sweep 的各阶段结果与 consumer 的分段内存统计
+
+用法: compression-sweep.py <results_dir> <producer_scenario> [consumer_scenario]
+  读取 producer_<producer_scenario>.json 的 summary.sweep 和
+  stats_<consumer_scenario>.json (或 .json.gz，默认与 producer 相同) 的 summary.phases，
+  按压缩设置 (消息的 phase property) 对齐，写入 <results_dir>/sweep_<producer_scenario>.json
+"""
+import gzip
+import json
+import os
+import sys
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def load_json(path):
+    """加载 JSON，.gz 自动解压；文件不存在时返回 None"""
+    for p, opener in ((path, open), (path + '.gz', gzip.open)):
+        if os.path.exists(p):
+            with opener(p, 'rt') as f:
+                return json.load(f)
+    return None
+
+def merge(sweep, phases):
+    """按压缩设置合并；同一设置在 consumer 端出现多段时 (如并发发送导致边界交错) 合并计数、取峰值"""
+    by_name = {}
+    for p in phases:
+        c = by_name.setdefault(p['name'], {'messages': 0, 'bytes': 0, 'duration_ms': 0,
+                                           'max_heap_alloc': 0, 'max_rss': 0})
+        c['messages'] += p['messages']
+        c['bytes'] += p['bytes']
+        c['duration_ms'] += p['duration_ms']
+        c['max_heap_alloc'] = max(c['max_heap_alloc'], p['max_heap_alloc'])
+        c['max_rss'] = max(c['max_rss'], p['max_rss'])
+    rows = []
+    for s in sweep:
+        row = {'compression': s['compression'], 'producer': s, 'consumer': by_name.get(s['compression'])}
+        rows.append(row)
+    return rows
+
+def print_table(rows):
+    print("")
+    print("=" * 96)
+    print("              COMPRESSION SWEEP")
+    print("=" * 96)
+    print(f"  {'Compression':<14} {'Messages':>10} {'MB':>9} {'Ratio':>7} {'Prod MB/s':>10} "
+          f"{'Cons MB/s':>10} {'Max Heap':>10} {'Max RSS':>10}")
+    for r in rows:
+        p, c = r['producer'], r['consumer']
+        ratio = f"{p['compression_ratio']:.2f}x" if p.get('compression_ratio') else '-'
+        # 旧版 producer 报告以 MiB/s 记在 mb_per_s
+        prod_rate = mb(p['bytes_per_s']) if 'bytes_per_s' in p else p.get('mb_per_s', 0)
+        line = f"  {r['compression']:<14} {p['messages']:>10,} {mb(p['bytes']):>9.2f} {ratio:>7} {prod_rate:>10.2f} "
+        if c:
+            secs = c['duration_ms'] / 1000
+            rate = mb(c['bytes']) / secs if secs > 0 else 0
+            line += f"{rate:>10.2f} {mb(c['max_heap_alloc']):>9.2f}M {mb(c['max_rss']):>9.2f}M"
+        else:
+            line += f"{'-':>10} {'-':>10} {'-':>10}"
+        print(line)
+    print("")
+    print("  Ratio 需要 producer -topic-stats；consumer 各段峰值包含上一段仍在队列和批次中的消息")
+    print("=" * 96)
+
+def main():
+    if len(sys.argv) < 3:
+        print(__doc__)
+        sys.exit(1)
+
+    results_dir, producer_scenario = sys.argv[1], sys.argv[2]
+    consumer_scenario = sys.argv[3] if len(sys.argv) > 3 else producer_scenario
+    report = load_json(os.path.join(results_dir, f'producer_{producer_scenario}.json'))
+    if not report or not report['summary'].get('sweep'):
+        print(f"Error: no summary.sweep in producer_{producer_scenario}.json (run the producer with -compression-sweep)")
+        sys.exit(1)
+    stats = load_json(os.path.join(results_dir, f'stats_{consumer_scenario}.json'))
+    phases = []
+    if stats is None:
+        print(f"Warning: no stats_{consumer_scenario}.json in {results_dir}, consumer columns left empty")
+    else:
+        phases = stats['summary'].get('phases') or []
+
+    rows = merge(report['summary']['sweep'], phases)
+    path = os.path.join(results_dir, f'sweep_{producer_scenario}.json')
+    with open(path, 'w') as f:
+        json.dump(rows, f, indent=2)
+    print_table(rows)
+
+if __name__ == '__main__':
+    main()
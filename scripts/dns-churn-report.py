@@ -0,0 +1,147 @@
+#!/usr/bin/env python3
+"""对齐 DNS 切换事件 (dns-churn.sh churn) 与 producer/consumer 的内存样本，
+报告每次地址切换、断线重连前后的内存变化
+
+用法: dns-churn-report.py <results_dir> <scenario> <events_file> [window_sec]
+  读取 <results_dir> 下的:
+    stats_<scenario>.json (或 .json.gz)       consumer 的 HeapAlloc/RSS 样本和连接数
+    external_rss_<scenario>_producer.txt      monitor-rss.sh 采集的 producer RSS
+    external_rss_<scenario>_consumer.txt      monitor-rss.sh 采集的 consumer RSS
+  每次切换的前后窗口各 window_sec 秒 (默认 10)，应小于 DNS_CHURN_INTERVAL 以免窗口重叠。
+  汇总写入 <results_dir>/dns_churn_<scenario>.json
+"""
+import gzip
+import json
+import os
+import re
+import sys
+from datetime import datetime
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def parse_time(value):
+    """解析 Go 写出的 RFC3339 时间，纳秒截断到微秒"""
+    m = re.match(r'(.*?T\d\d:\d\d:\d\d)(\.\d+)?(Z|[+-]\d\d:\d\d)$', value)
+    frac = (m.group(2) or '.0')[:7]
+    zone = '+00:00' if m.group(3) == 'Z' else m.group(3)
+    return datetime.fromisoformat(m.group(1) + frac + zone).timestamp()
+
+def load_events(path):
+    """所有 switch 事件: [(时间, 旧地址, 新地址)]"""
+    events = []
+    with open(path) as f:
+        for line in f:
+            parts = line.split()
+            if len(parts) == 5 and parts[1] == 'switch':
+                events.append((int(parts[0]) / 1000, parts[3], parts[4]))
+    return events
+
+def load_rss(path):
+    """monitor-rss.sh 的输出，返回 [(时间, RSS 字节)]"""
+    if not os.path.exists(path):
+        return []
+    samples = []
+    with open(path) as f:
+        for line in f:
+            parts = line.strip().split(',')
+            if len(parts) < 3 or parts[0] == 'timestamp':
+                continue
+            try:
+                samples.append((float(parts[0]), int(parts[2]) * 1024))
+            except ValueError:
+                continue
+    return samples
+
+def load_stats(results_dir, scenario):
+    """consumer 的 stats 文件，不存在时返回 None"""
+    for name, opener in ((f'stats_{scenario}.json', open), (f'stats_{scenario}.json.gz', gzip.open)):
+        path = os.path.join(results_dir, name)
+        if os.path.exists(path):
+            with opener(path, 'rt') as f:
+                return json.load(f)
+    return None
+
+def window(samples, event, seconds):
+    """事件前后窗口内样本的均值和峰值，样本为 [(时间, 值)]"""
+    before = [v for t, v in samples if event - seconds <= t < event]
+    after = [v for t, v in samples if event <= t < event + seconds]
+    if not before or not after:
+        return None
+    before_avg = sum(before) / len(before)
+    after_avg = sum(after) / len(after)
+    return {
+        'before_avg': before_avg,
+        'after_avg': after_avg,
+        'after_max': max(after),
+        'delta_avg': after_avg - before_avg,
+        'delta_max': max(after) - before_avg,
+    }
+
+def main():
+    if len(sys.argv) < 4:
+        print(__doc__.strip(), file=sys.stderr)
+        sys.exit(1)
+    results_dir, scenario, events_file = sys.argv[1:4]
+    seconds = float(sys.argv[4]) if len(sys.argv) > 4 else 10
+
+    events = load_events(events_file)
+    if not events:
+        print(f"Error: no switch event in {events_file}", file=sys.stderr)
+        sys.exit(1)
+
+    series = {
+        'producer_rss': load_rss(os.path.join(results_dir, f'external_rss_{scenario}_producer.txt')),
+        'consumer_rss': load_rss(os.path.join(results_dir, f'external_rss_{scenario}_consumer.txt')),
+    }
+    stats = load_stats(results_dir, scenario)
+    connections = None
+    if stats is not None:
+        samples = [(parse_time(s['timestamp']), s) for s in stats.get('samples') or []]
+        series['consumer_heap'] = [(t, s['heap_alloc']) for t, s in samples]
+        series['consumer_conns'] = [(t, s['client']['connections']) for t, s in samples if s.get('client')]
+        connections = stats['summary'].get('connections')
+
+    report = {'scenario': scenario, 'window_sec': seconds, 'switches': [], 'connections': connections}
+    for at, old, new in events:
+        entry = {'time': at, 'from': old, 'to': new}
+        for name, values in series.items():
+            entry[name] = window(values, at, seconds)
+        report['switches'].append(entry)
+
+    # 各次切换后峰值相对切换前均值的增量取平均，反映一次重连带来的瞬时内存
+    report['avg_delta_max'] = {}
+    for name in series:
+        deltas = [s[name]['delta_max'] for s in report['switches'] if s[name] is not None]
+        if deltas:
+            report['avg_delta_max'][name] = sum(deltas) / len(deltas)
+
+    print(f"========== DNS churn: {len(events)} address switches ({scenario}) ==========")
+    print(f"  Window: {seconds:.0f}s before and after each switch (delta = after max - before avg)")
+    print(f"  {'#':>3} {'switch':<28} {'producer RSS':>13} {'consumer RSS':>13} {'consumer heap':>14} {'conns after':>12}")
+    for i, s in enumerate(report['switches'], 1):
+        cols = []
+        for name in ('producer_rss', 'consumer_rss', 'consumer_heap'):
+            w = s.get(name)
+            cols.append(f"{mb(w['delta_max']):>+10.2f} MB" if w else f"{'-':>13}")
+        conns = s.get('consumer_conns')
+        conns_col = f"{conns['after_max']:>12.0f}" if conns else f"{'-':>12}"
+        print(f"  {i:>3} {s['from'] + ' -> ' + s['to']:<28} {cols[0]:>13} {cols[1]:>13} {cols[2]:>14} {conns_col}")
+    for name, delta in report['avg_delta_max'].items():
+        if name != 'consumer_conns':
+            print(f"  Average spike {name}: {mb(delta):+.2f} MB")
+    if connections:
+        print(f"  Consumer connections: opened {connections['opened']:.0f}, closed {connections['closed']:.0f}, "
+              f"final {connections['final']:.0f}")
+        if connections['opened'] < len(events):
+            print("  WARNING: fewer connections opened than address switches; the clients may not have "
+                  "reconnected (check that they used the churned host name)")
+
+    out = os.path.join(results_dir, f'dns_churn_{scenario}.json')
+    with open(out, 'w') as f:
+        json.dump(report, f, indent=2)
+    print(f"Report saved to: {out}")
+
+if __name__ == '__main__':
+    main()
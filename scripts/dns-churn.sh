@@ -0,0 +1,80 @@
+#!/bin/bash
+
+# 测试期间周期性地改变主机名的解析地址，模拟 broker (或 proxy) 换了 IP，
+# 让客户端走断线重连 + 重新解析新地址的路径，测量其内存抖动
+# 用法: ./scripts/dns-churn.sh init <host> <addr>
+#       ./scripts/dns-churn.sh churn <host> <addr>=<container>,<addr>=<container>[,...] [events-file]
+#       ./scripts/dns-churn.sh clean <host>
+#   init  在 HOSTS_FILE 中把 <host> 解析到 <addr>
+#   churn 每 DNS_CHURN_INTERVAL 秒把 <host> 切换到列表中的下一个地址，等待客户端的
+#         hosts 缓存过期后重启旧地址上的容器断开已有连接，迫使客户端重连到新地址；
+#         事件写入 events-file 供 dns-churn-report.py 对齐内存样本
+#   clean 删除 init/churn 写入的条目
+#
+# 需要 HOSTS_FILE 的写权限 (通常是 root)；地址需要都能到达同一个集群，
+# 如 WITH_DNS_CHURN=1 make start-pulsar 启动的 127.0.0.2/127.0.0.3 两个 proxy
+#
+# 环境变量:
+#   DNS_CHURN_INTERVAL  每次切换间隔秒数 (默认 30)
+#   DNS_CHURN_ROUNDS    切换次数 (默认 6)
+#   HOSTS_SETTLE        切换后等待多少秒再断开旧连接，需大于 Go 的 hosts 缓存 5 秒 (默认 6)
+#   HOSTS_FILE          hosts 文件 (默认 /etc/hosts)
+
+set -e
+
+CMD=${1:?"Usage: $0 init|churn|clean <host> [addr|addr=container,...] [events-file]"}
+HOST=${2:?"Usage: $0 init|churn|clean <host> [addr|addr=container,...] [events-file]"}
+DNS_CHURN_INTERVAL=${DNS_CHURN_INTERVAL:-30}
+DNS_CHURN_ROUNDS=${DNS_CHURN_ROUNDS:-6}
+HOSTS_SETTLE=${HOSTS_SETTLE:-6}
+HOSTS_FILE=${HOSTS_FILE:-/etc/hosts}
+
+MARKER="# dns-churn"
+
+# 原地改写 hosts 文件而不是 sed -i 替换，容器中的 /etc/hosts 是 bind mount，不能换 inode
+set_host() {
+    local tmp
+    tmp=$(mktemp)
+    grep -v " $HOST $MARKER\$" "$HOSTS_FILE" > "$tmp" || true
+    if [ -n "$1" ]; then
+        echo "$1 $HOST $MARKER" >> "$tmp"
+    fi
+    cat "$tmp" > "$HOSTS_FILE"
+    rm -f "$tmp"
+}
+
+case "$CMD" in
+    init)
+        ADDR=${3:?"Usage: $0 init <host> <addr>"}
+        set_host "$ADDR"
+        echo "[dns] $HOST -> $ADDR"
+        ;;
+    churn)
+        TARGETS=${3:?"Usage: $0 churn <host> <addr>=<container>,... [events-file]"}
+        EVENTS_FILE=${4:-/dev/null}
+        IFS=',' read -r -a PAIRS <<< "$TARGETS"
+        if [ ${#PAIRS[@]} -lt 2 ]; then
+            echo "churn needs at least two addr=container targets" >&2
+            exit 1
+        fi
+        for i in $(seq 1 "$DNS_CHURN_ROUNDS"); do
+            sleep "$DNS_CHURN_INTERVAL"
+            FROM=${PAIRS[$(((i - 1) % ${#PAIRS[@]}))]}
+            TO=${PAIRS[$((i % ${#PAIRS[@]}))]}
+            set_host "${TO%%=*}"
+            sleep "$HOSTS_SETTLE"
+            # 事件格式: <unix_ms> switch <host> <from-addr> <to-addr>，时间为断开旧连接的时刻
+            echo "$(date +%s%3N) switch $HOST ${FROM%%=*} ${TO%%=*}" >> "$EVENTS_FILE"
+            docker restart -t 0 "${FROM#*=}" > /dev/null
+            echo "[dns] round $i: $HOST ${FROM%%=*} -> ${TO%%=*}, restarted ${FROM#*=}"
+        done
+        ;;
+    clean)
+        set_host ""
+        echo "[dns] removed $HOST"
+        ;;
+    *)
+        echo "Unknown command $CMD (init|churn|clean)" >&2
+        exit 1
+        ;;
+esac
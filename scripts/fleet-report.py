@@ -0,0 +1,113 @@
+#!/usr/bin/env python3
+"""汇总同一 fleet 中多个消费者进程的 stats，并对比不同规模的 fleet
+
+用法: fleet-report.py <results_dir> <fleet> [fleet...]
+  fleet 为 scale-consumers.sh 使用的前缀 (如 scale-k4)，匹配 stats_<fleet>-c*.json (或 .json.gz)
+  每个 fleet 的汇总写入 <results_dir>/fleet_<fleet>.json
+"""
+import glob
+import gzip
+import json
+import os
+import re
+import sys
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def load_fleet(results_dir, fleet):
+    """加载 fleet 中所有进程的 stats，按进程序号排序"""
+    pattern = re.compile(re.escape(f'stats_{fleet}-c') + r'(\d+)\.json(\.gz)?$')
+    procs = []
+    for path in glob.glob(os.path.join(results_dir, f'stats_{fleet}-c*.json*')):
+        m = pattern.search(os.path.basename(path))
+        if not m:
+            continue
+        opener = gzip.open if m.group(2) else open
+        with opener(path, 'rt') as f:
+            procs.append((int(m.group(1)), json.load(f)['summary']))
+    procs.sort()
+    return procs
+
+def summarize(fleet, procs):
+    """每个进程的关键指标和 fleet 合计"""
+    processes = []
+    for idx, s in procs:
+        processes.append({
+            'process': idx,
+            'messages': s['message_count'],
+            'message_bytes': s['message_bytes'],
+            'max_heap_alloc': s['max_heap_alloc'],
+            'max_rss': s['max_rss'],
+            'heap_ratio': s['heap_ratio'],
+        })
+    n = len(processes)
+    heaps = [p['max_heap_alloc'] for p in processes]
+    rss = [p['max_rss'] for p in processes]
+    return {
+        'fleet': fleet,
+        'processes': processes,
+        'total': {
+            'consumers': n,
+            'messages': sum(p['messages'] for p in processes),
+            'message_bytes': sum(p['message_bytes'] for p in processes),
+            # 各进程峰值之和: 各进程峰值不一定同时出现，是 fleet 内存的上界
+            'sum_max_heap_alloc': sum(heaps),
+            'sum_max_rss': sum(rss),
+            'avg_max_heap_alloc': sum(heaps) / n,
+            'max_max_heap_alloc': max(heaps),
+            'avg_max_rss': sum(rss) / n,
+            'max_max_rss': max(rss),
+        },
+    }
+
+def print_fleets(reports):
+    print("")
+    print("=" * 78)
+    print("              CONSUMER FLEET REPORT")
+    print("=" * 78)
+    for r in reports:
+        print(f"  {r['fleet']}")
+        print(f"    {'Process':>8} {'Messages':>12} {'MB':>10} {'Max Heap':>10} {'Max RSS':>10}")
+        for p in r['processes']:
+            print(f"    {p['process']:>8} {p['messages']:>12,} {mb(p['message_bytes']):>10.2f} "
+                  f"{mb(p['max_heap_alloc']):>9.2f}M {mb(p['max_rss']):>9.2f}M")
+        print("")
+    print("-" * 78)
+    print("  Scaling (per-process memory vs fleet size)")
+    print("-" * 78)
+    print(f"  {'Fleet':<20} {'K':>3} {'Messages':>12} {'Avg Heap':>10} {'Max Heap':>10} "
+          f"{'Avg RSS':>10} {'Sum RSS':>10}")
+    for r in reports:
+        t = r['total']
+        print(f"  {r['fleet']:<20} {t['consumers']:>3} {t['messages']:>12,} {mb(t['avg_max_heap_alloc']):>9.2f}M "
+              f"{mb(t['max_max_heap_alloc']):>9.2f}M {mb(t['avg_max_rss']):>9.2f}M {mb(t['sum_max_rss']):>9.2f}M")
+    print("")
+    print("  Sum RSS 为各进程峰值之和，峰值不一定同时出现，是 fleet 内存的上界")
+    print("=" * 78)
+
+def main():
+    if len(sys.argv) < 3:
+        print(__doc__)
+        sys.exit(1)
+
+    results_dir = sys.argv[1]
+    reports = []
+    for fleet in sys.argv[2:]:
+        procs = load_fleet(results_dir, fleet)
+        if not procs:
+            print(f"Warning: no stats_{fleet}-c*.json in {results_dir}, skipped")
+            continue
+        report = summarize(fleet, procs)
+        path = os.path.join(results_dir, f'fleet_{fleet}.json')
+        with open(path, 'w') as f:
+            json.dump(report, f, indent=2)
+        reports.append(report)
+
+    if not reports:
+        sys.exit(1)
+    print_fleets(reports)
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,182 @@
+#!/usr/bin/env python3
+"""按组件估算 goroutine 栈内存: heap profile 不含栈，上千个客户端 goroutine 的栈可占可观的 RSS
+
+用法: goroutine-stacks.py <goroutines.txt> [stats.json]
+  goroutines.txt 为 consumer/entities 结束时写入的 goroutine 调用栈 (debug=2，如 results/goroutines_<scenario>.txt)；
+  stats 默认取同目录下把文件名中 goroutines 换成 stats 的 .json 或 .json.gz。
+  栈总量取 stats metadata 中写调用栈时记录的 goroutine_dump.stack_inuse，没有时退回最后一个样本的 stack_inuse。
+  goroutine 按创建位置 (created by 的函数) 分组并汇总到包，栈总量按调用深度比例分摊给各 goroutine:
+  Go 的栈从 2KB 起按倍数增长，调用越深越可能已经扩栈。StackInuse 还包含 g0 等运行时栈，一并按比例摊入，
+  因此是估算而非精确值；没有 stats 时只按每个 goroutine 至少 2KB 给出下限。
+  结果写入调用栈同目录的 goroutine-stacks*.json (文件名中 goroutines 换成 goroutine-stacks)
+"""
+import gzip
+import json
+import os
+import re
+import sys
+
+MIN_STACK = 2048
+HEADER = re.compile(r'^goroutine (\d+) .*\[([^\]]*)\]:$')
+CREATED_BY = re.compile(r'^created by (\S+?)(?: in goroutine \d+)?$')
+
+# 模块路径前缀 -> 显示名
+MODULES = [
+    ('github.com/apache/pulsar-client-go/', ''),
+    ('pulsar-memory-test/', ''),
+]
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def load_stats(path):
+    opener = gzip.open if path.endswith('.gz') else open
+    with opener(path, 'rt') as f:
+        return json.load(f)
+
+def parse_dump(path):
+    """解析 debug=2 调用栈，返回 [{id, state, frames, creator}]，frames 为函数名列表 (栈顶在前)"""
+    goroutines = []
+    current = None
+    with open(path) as f:
+        for line in f:
+            line = line.rstrip('\n')
+            m = HEADER.match(line)
+            if m:
+                current = {'id': int(m.group(1)), 'state': m.group(2).split(',')[0], 'frames': [], 'creator': None}
+                goroutines.append(current)
+                continue
+            if current is None or not line or line.startswith('\t'):
+                continue
+            m = CREATED_BY.match(line)
+            if m:
+                current['creator'] = m.group(1)
+            elif not line.startswith('...'):
+                current['frames'].append(line[:line.rfind('(')] if line.endswith(')') else line)
+    return goroutines
+
+def package(func):
+    """函数名所在的包，如 github.com/apache/pulsar-client-go/pulsar/internal.(*connection).run -> pulsar/internal"""
+    slash = func.rfind('/')
+    dot = func.find('.', slash + 1)
+    pkg = func[:dot] if dot > 0 else func
+    for prefix, short in MODULES:
+        if pkg.startswith(prefix):
+            return short + pkg[len(prefix):]
+    return pkg
+
+def site(g):
+    """创建位置: created by 的函数，main goroutine 没有创建者"""
+    if g['creator']:
+        return g['creator']
+    return g['frames'][-1] if g['frames'] else 'unknown'
+
+def stack_total(stats):
+    """写调用栈时的 (stack_inuse, stack_sys, 来源)，没有数据时返回 (None, None, None)"""
+    meta = stats.get('metadata') or {}
+    if meta.get('goroutine_dump.stack_inuse'):
+        return int(meta['goroutine_dump.stack_inuse']), int(meta.get('goroutine_dump.stack_sys') or 0), 'at dump'
+    samples = stats.get('samples') or []
+    if samples and samples[-1].get('stack_inuse'):
+        return samples[-1]['stack_inuse'], samples[-1].get('stack_sys', 0), 'last sample'
+    return None, None, None
+
+def group(goroutines, key, estimate):
+    """按 key 分组: goroutine 数、平均深度、估算栈字节数、状态分布，按估算降序"""
+    groups = {}
+    for g in goroutines:
+        k = key(g)
+        e = groups.setdefault(k, {'name': k, 'goroutines': 0, 'frames': 0, 'stack_bytes': 0, 'states': {}})
+        e['goroutines'] += 1
+        e['frames'] += len(g['frames'])
+        e['stack_bytes'] += estimate(g)
+        e['states'][g['state']] = e['states'].get(g['state'], 0) + 1
+    result = []
+    for e in groups.values():
+        e['avg_depth'] = round(e.pop('frames') / e['goroutines'], 1)
+        e['stack_bytes'] = int(e['stack_bytes'])
+        result.append(e)
+    return sorted(result, key=lambda e: (-e['stack_bytes'], -e['goroutines'], e['name']))
+
+def print_table(title, rows, total, limit):
+    print(f'\n{title}')
+    print(f'  {"goroutines":>10} {"avg depth":>9} {"stack MB":>9} {"share":>6}  name (states)')
+    for e in rows[:limit]:
+        share = e['stack_bytes'] / total * 100 if total else 0
+        states = ', '.join(f'{s} {n}' for s, n in sorted(e['states'].items(), key=lambda kv: -kv[1]))
+        print(f'  {e["goroutines"]:>10} {e["avg_depth"]:>9} {mb(e["stack_bytes"]):>9.2f} {share:>5.1f}%  {e["name"]} ({states})')
+    if len(rows) > limit:
+        print(f'  ... {len(rows) - limit} more')
+
+def default_stats(dump_path):
+    base = os.path.basename(dump_path).replace('goroutines', 'stats', 1)
+    base = base[:-len('.txt')] if base.endswith('.txt') else base
+    for ext in ('.json', '.json.gz'):
+        path = os.path.join(os.path.dirname(dump_path), base + ext)
+        if os.path.exists(path):
+            return path
+    return None
+
+def main():
+    if len(sys.argv) < 2:
+        print(__doc__)
+        sys.exit(1)
+    dump_path = sys.argv[1]
+    stats_path = sys.argv[2] if len(sys.argv) > 2 else default_stats(dump_path)
+
+    goroutines = parse_dump(dump_path)
+    if not goroutines:
+        print(f'No goroutines found in {dump_path}')
+        sys.exit(1)
+
+    stack_inuse, stack_sys, source = None, None, None
+    rss = None
+    if stats_path:
+        stats = load_stats(stats_path)
+        stack_inuse, stack_sys, source = stack_total(stats)
+        rss = (stats.get('summary') or {}).get('final_rss')
+
+    total_frames = sum(max(len(g['frames']), 1) for g in goroutines)
+    if stack_inuse:
+        def estimate(g):
+            return stack_inuse * max(len(g['frames']), 1) / total_frames
+    else:
+        def estimate(g):
+            return MIN_STACK
+
+    by_site = group(goroutines, site, estimate)
+    by_package = group(goroutines, lambda g: package(site(g)), estimate)
+    total = stack_inuse or MIN_STACK * len(goroutines)
+
+    print(f'Goroutine stacks: {dump_path}')
+    print(f'  Goroutines: {len(goroutines)}')
+    if stack_inuse:
+        print(f'  StackInuse: {mb(stack_inuse):.2f} MB ({source}, {stack_inuse / len(goroutines) / 1024:.1f} KB/goroutine), '
+              f'StackSys: {mb(stack_sys):.2f} MB')
+        if rss:
+            print(f'  Stack share of final RSS: {stack_inuse / rss * 100:.1f}% ({mb(rss):.2f} MB)')
+    else:
+        print(f'  No stack_inuse in stats, lower bound {MIN_STACK // 1024} KB/goroutine: {mb(total):.2f} MB')
+    print_table('By package (creator):', by_package, total, 20)
+    print_table('By creation site:', by_site, total, 30)
+
+    out_dir = os.path.dirname(dump_path)
+    out_name = os.path.basename(dump_path).replace('goroutines', 'goroutine-stacks', 1)
+    out_path = os.path.join(out_dir, (out_name[:-len('.txt')] if out_name.endswith('.txt') else out_name) + '.json')
+    with open(out_path, 'w') as f:
+        json.dump({
+            'dump': dump_path,
+            'stats': stats_path,
+            'goroutines': len(goroutines),
+            'stack_inuse': stack_inuse,
+            'stack_sys': stack_sys,
+            'stack_source': source or 'lower bound',
+            'by_package': by_package,
+            'by_site': by_site,
+        }, f, indent=2)
+        f.write('\n')
+    print(f'\nSaved to: {out_path}')
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,148 @@
+#!/usr/bin/env python3
+"""汇总 Key_Shared fleet 中各进程的按 key 统计 (consumer -key-stats)，
+报告 key 的归属变化、key 内乱序和各进程的饥饿程度
+
+用法: key-shared-report.py <results_dir> <fleet>
+  fleet 为 scale-consumers.sh 使用的前缀 (如 key-shared-k3)，匹配 stats_<fleet>-c*.json (或 .json.gz)
+  汇总写入 <results_dir>/key_shared_<fleet>.json
+
+归属变化按每个 key 在各进程中的 [first, last] 区间判断: 区间按开始时间排序后，相邻区间属于
+不同进程记一次切换；区间重叠说明切换期间两个进程同时收到了该 key 的消息。
+同一进程内的切换 (离开后又回来) 只能从该 key 的最大到达间隔看出。
+"""
+import glob
+import gzip
+import json
+import os
+import re
+import sys
+from datetime import datetime
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def parse_time(value):
+    """解析 Go 写出的 RFC3339 时间，纳秒截断到微秒"""
+    m = re.match(r'(.*?T\d\d:\d\d:\d\d)(\.\d+)?(Z|[+-]\d\d:\d\d)$', value)
+    frac = (m.group(2) or '.0')[:7]
+    zone = '+00:00' if m.group(3) == 'Z' else m.group(3)
+    return datetime.fromisoformat(m.group(1) + frac + zone).timestamp()
+
+def load_fleet(results_dir, fleet):
+    """加载 fleet 中所有进程的 stats，按进程序号排序"""
+    pattern = re.compile(re.escape(f'stats_{fleet}-c') + r'(\d+)\.json(\.gz)?$')
+    procs = []
+    for path in glob.glob(os.path.join(results_dir, f'stats_{fleet}-c*.json*')):
+        m = pattern.search(os.path.basename(path))
+        if not m:
+            continue
+        opener = gzip.open if m.group(2) else open
+        with opener(path, 'rt') as f:
+            procs.append((int(m.group(1)), json.load(f)))
+    procs.sort(key=lambda p: p[0])
+    return procs
+
+def summarize(fleet, procs):
+    """各进程的 key 统计和跨进程的归属变化"""
+    total = sum(s['summary'].get('keys', {}).get('messages', 0) for _, s in procs)
+    processes = []
+    spans = {}  # key -> [(first, last, process)]
+    for idx, s in procs:
+        k = s['summary'].get('keys')
+        if k is None:
+            print(f"Warning: {fleet}-c{idx} has no key stats (run the consumer with -key-stats)")
+            continue
+        processes.append({
+            'process': idx,
+            'keys': k['keys'],
+            'messages': k['messages'],
+            'share': k['messages'] / total if total else 0,
+            'out_of_order': k['out_of_order'],
+            'duplicates': k['duplicates'],
+            'max_gap_ms': k['max_gap_ms'],
+            'median_max_gap_ms': k['median_max_gap_ms'],
+            'max_heap_alloc': s['summary']['max_heap_alloc'],
+            'records_dropped': k.get('records_dropped', 0),
+        })
+        for r in s.get('keys', []):
+            spans.setdefault(r['key'], []).append((parse_time(r['first']), parse_time(r['last']), idx))
+
+    moved = 0
+    handovers = 0
+    overlapping = 0
+    for key_spans in spans.values():
+        if len(key_spans) < 2:
+            continue
+        moved += 1
+        key_spans.sort()
+        for prev, cur in zip(key_spans, key_spans[1:]):
+            if prev[2] != cur[2]:
+                handovers += 1
+            if cur[0] < prev[1]:
+                overlapping += 1
+
+    n = len(processes)
+    shares = [p['share'] for p in processes]
+    return {
+        'fleet': fleet,
+        'processes': processes,
+        'total': {
+            'consumers': n,
+            'keys': len(spans),
+            'messages': total,
+            'out_of_order': sum(p['out_of_order'] for p in processes),
+            'duplicates': sum(p['duplicates'] for p in processes),
+            'keys_moved': moved,        # 被多个进程收到过的 key
+            'handovers': handovers,     # 归属切换次数的下界
+            'overlapping_handovers': overlapping,
+            # 消息最多的进程相对平均份额的倍数，1 表示完全均衡
+            'imbalance': max(shares) * n if n and total else 0,
+            'min_share': min(shares) if shares else 0,
+        },
+    }
+
+def print_report(r):
+    t = r['total']
+    print("")
+    print("=" * 78)
+    print("              KEY_SHARED REPORT")
+    print("=" * 78)
+    print(f"  {r['fleet']}: {t['consumers']} consumers, {t['keys']:,} keys, {t['messages']:,} msgs")
+    print(f"    {'Process':>8} {'Keys':>8} {'Messages':>12} {'Share':>7} {'OOO':>8} {'Dup':>8} "
+          f"{'Max Gap':>10} {'Med Gap':>10} {'Max Heap':>10}")
+    for p in r['processes']:
+        print(f"    {p['process']:>8} {p['keys']:>8,} {p['messages']:>12,} {p['share']*100:>6.1f}% "
+              f"{p['out_of_order']:>8,} {p['duplicates']:>8,} {p['max_gap_ms']:>8.0f}ms "
+              f"{p['median_max_gap_ms']:>8.0f}ms {mb(p['max_heap_alloc']):>9.2f}M")
+    print("")
+    print(f"  Out-of-order: {t['out_of_order']:,} msgs | duplicates: {t['duplicates']:,}")
+    print(f"  Keys moved between consumers: {t['keys_moved']:,} ({t['handovers']:,} handovers, "
+          f"{t['overlapping_handovers']:,} overlapping)")
+    print(f"  Imbalance: busiest consumer {t['imbalance']:.2f}x the even share, quietest {t['min_share']*100:.1f}%")
+    if t['out_of_order']:
+        print("  WARNING: messages arrived out of order within their key")
+    if any(p['records_dropped'] for p in r['processes']):
+        print("  Note: some processes dropped per-key records; moved keys are undercounted")
+    print("=" * 78)
+
+def main():
+    if len(sys.argv) != 3:
+        print(__doc__)
+        sys.exit(1)
+
+    results_dir, fleet = sys.argv[1], sys.argv[2]
+    procs = load_fleet(results_dir, fleet)
+    if not procs:
+        print(f"Warning: no stats_{fleet}-c*.json in {results_dir}")
+        sys.exit(1)
+    report = summarize(fleet, procs)
+    if not report['processes']:
+        sys.exit(1)
+    path = os.path.join(results_dir, f'key_shared_{fleet}.json')
+    with open(path, 'w') as f:
+        json.dump(report, f, indent=2)
+    print_report(report)
+
+if __name__ == '__main__':
+    main()
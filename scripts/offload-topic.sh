@@ -0,0 +1,78 @@
+#!/bin/bash
+
+# 通过 admin REST API 把非分区 topic 已关闭的 ledger 卸载 (offload) 到分层存储并等待完成
+# 用法: ./scripts/offload-topic.sh <topic> [admin-url]
+#
+# 先 unload topic 让 broker 关闭当前 ledger，之后对 topic 的访问会打开新的 ledger，
+# 于是原有数据都在已关闭的 ledger 中，offload 到新 ledger 之前的全部 ledger。
+# 需要 broker 配置了 offloader (managedLedgerOffloadDriver，如 filesystem 或 aws-s3，
+# 以及 offloadersDirectory 中的 offloader 包，apachepulsar/pulsar-all 镜像自带)；
+# 未配置时 offload 返回错误，脚本以非 0 退出
+
+set -e
+
+TOPIC=${1:?"Usage: $0 <topic> [admin-url]"}
+ADMIN_URL=${2:-${ADMIN_URL:-"http://localhost:8080"}}
+MAX_RETRIES=${MAX_RETRIES:-300}
+
+# persistent://tenant/ns/topic -> persistent/tenant/ns/topic
+TOPIC_PATH=$(echo "$TOPIC" | sed 's#://#/#')
+TOPIC_URL="$ADMIN_URL/admin/v2/$TOPIC_PATH"
+
+echo "Unloading topic to close the current ledger: $TOPIC"
+curl -sf -X PUT "$TOPIC_URL/unload" > /dev/null
+
+# 重新加载 topic 并取最后一个 (新打开的) ledger
+LEDGER=""
+for i in $(seq 1 30); do
+    LEDGER=$(curl -sf "$TOPIC_URL/internalStats" | python3 -c '
+import json, sys
+ledgers = json.load(sys.stdin).get("ledgers") or []
+print(ledgers[-1]["ledgerId"] if len(ledgers) > 1 else "")
+' || true)
+    [ -n "$LEDGER" ] && break
+    sleep 1
+done
+if [ -z "$LEDGER" ]; then
+    echo "Error: no closed ledgers to offload on $TOPIC"
+    exit 1
+fi
+
+echo "Offloading ledgers before $LEDGER"
+RESPONSE=$(curl -s -w '\n%{http_code}' -X PUT -H 'Content-Type: application/json' \
+    -d "{\"ledgerId\": $LEDGER, \"entryId\": 0, \"partitionIndex\": -1}" "$TOPIC_URL/offload")
+CODE=$(echo "$RESPONSE" | tail -n 1)
+if [ "${CODE:0:1}" != "2" ]; then
+    echo "Error: offload request failed (HTTP $CODE): $(echo "$RESPONSE" | head -n -1)"
+    echo "The broker needs an offloader configured (managedLedgerOffloadDriver), see the header of $0"
+    exit 1
+fi
+
+# 轮询 offload 状态: NOT_RUN / RUNNING / SUCCESS / ERROR
+RETRY_COUNT=0
+while [ $RETRY_COUNT -lt $MAX_RETRIES ]; do
+    STATUS=$(curl -sf "$TOPIC_URL/offload" | sed -n 's/.*"status" *: *"\([A-Z_]*\)".*/\1/p')
+    case "$STATUS" in
+        SUCCESS)
+            OFFLOADED=$(curl -sf "$TOPIC_URL/internalStats" | python3 -c '
+import json, sys
+ledgers = json.load(sys.stdin).get("ledgers") or []
+print(sum(1 for l in ledgers if l.get("offloaded")), "of", len(ledgers))
+')
+            echo "Offload finished: $OFFLOADED ledgers offloaded"
+            exit 0
+            ;;
+        ERROR)
+            echo "Error: offload failed"
+            curl -s "$TOPIC_URL/offload"
+            exit 1
+            ;;
+    esac
+
+    RETRY_COUNT=$((RETRY_COUNT + 1))
+    echo "Waiting for offload... ($STATUS, $RETRY_COUNT/$MAX_RETRIES)"
+    sleep 1
+done
+
+echo "Error: offload did not finish within expected time"
+exit 1
@@ -0,0 +1,133 @@
+#!/usr/bin/env python3
+"""把一组配置 (场景) 画成 p99 延迟 vs 最大 RSS 的散点，找出 Pareto 前沿
+
+用法: pareto-report.py <results_dir> [scenario|glob...]
+  读取 <results_dir> 下各场景的 stats_<scenario>.json (或 .json.gz)，不给场景时读取全部 stats_*.json；
+  场景名可以是 glob，如 'lead-*'。
+  延迟优先取 summary.latency.p99_ms (逐条消息端到端延迟直方图的 p99)，旧结果没有时取样本 lag_ms
+  (采样时刻距最新已消费消息发布时间) 的 p99，再退回 summary.max_lag_ms；
+  内存取 summary.max_rss。两者都更小的配置支配另一个，不被任何配置支配的构成 Pareto 前沿。
+  结果写入 <results_dir>/pareto.json 和 <results_dir>/pareto.svg (散点图，前沿连线)
+"""
+import glob
+import gzip
+import json
+import os
+import sys
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def load_stats(path):
+    opener = gzip.open if path.endswith('.gz') else open
+    with opener(path, 'rt') as f:
+        return json.load(f)
+
+def find_scenarios(results_dir, patterns):
+    """场景名 -> stats 文件路径，同名的 .json 优先于 .json.gz"""
+    found = {}
+    for pattern in patterns or ['*']:
+        for ext in ('.json.gz', '.json'):
+            for path in glob.glob(os.path.join(results_dir, f'stats_{pattern}{ext}')):
+                name = os.path.basename(path)[len('stats_'):-len(ext)]
+                found[name] = path
+    return found
+
+def percentile(values, p):
+    values = sorted(values)
+    return values[min(len(values) - 1, int(p * len(values)))]
+
+def point(name, stats):
+    """场景的 (p99 延迟 ms, 最大 RSS 字节, 延迟来源)，缺数据时返回 None"""
+    summary = stats.get('summary') or {}
+    max_rss = summary.get('max_rss')
+    if not max_rss:
+        return None
+    e2e = summary.get('latency') or {}
+    if e2e.get('count'):
+        return e2e['p99_ms'], max_rss, 'p99 e2e'
+    lags = [s['lag_ms'] for s in stats.get('samples') or [] if s.get('last_publish_time')]
+    if lags:
+        return percentile(lags, 0.99), max_rss, 'p99 lag'
+    if summary.get('max_lag_ms'):
+        return summary['max_lag_ms'], max_rss, 'max lag'
+    return None
+
+def frontier(points):
+    """不被支配的点，按延迟升序"""
+    result = []
+    for p in points:
+        dominated = any(q['latency_ms'] <= p['latency_ms'] and q['max_rss'] <= p['max_rss'] and
+                        (q['latency_ms'] < p['latency_ms'] or q['max_rss'] < p['max_rss'])
+                        for q in points)
+        if not dominated:
+            result.append(p)
+    return sorted(result, key=lambda p: p['latency_ms'])
+
+def write_svg(path, points, front):
+    """不依赖 matplotlib 的散点图: x 为 p99 延迟，y 为最大 RSS，前沿点红色并连线"""
+    width, height, pad = 720, 480, 60
+    max_x = max(p['latency_ms'] for p in points) * 1.1 or 1
+    max_y = mb(max(p['max_rss'] for p in points)) * 1.1 or 1
+
+    def xy(p):
+        return (pad + p['latency_ms'] / max_x * (width - 2 * pad),
+                height - pad - mb(p['max_rss']) / max_y * (height - 2 * pad))
+
+    out = [f'<svg xmlns="http://www.w3.org/2000/svg" width="{width}" height="{height}" font-family="sans-serif" font-size="11">',
+           f'<rect width="{width}" height="{height}" fill="white"/>',
+           f'<line x1="{pad}" y1="{height - pad}" x2="{width - pad}" y2="{height - pad}" stroke="black"/>',
+           f'<line x1="{pad}" y1="{pad}" x2="{pad}" y2="{height - pad}" stroke="black"/>',
+           f'<text x="{width / 2}" y="{height - 20}" text-anchor="middle">p99 latency (ms, max {max_x / 1.1:.0f})</text>',
+           f'<text x="15" y="{height / 2}" text-anchor="middle" transform="rotate(-90 15 {height / 2})">max RSS (MB, max {max_y / 1.1:.1f})</text>']
+    if len(front) > 1:
+        line = ' '.join(f'{x:.1f},{y:.1f}' for x, y in map(xy, front))
+        out.append(f'<polyline points="{line}" fill="none" stroke="red" stroke-dasharray="4 3"/>')
+    names = {p['scenario'] for p in front}
+    for p in points:
+        x, y = xy(p)
+        color = 'red' if p['scenario'] in names else 'steelblue'
+        out.append(f'<circle cx="{x:.1f}" cy="{y:.1f}" r="4" fill="{color}"/>')
+        out.append(f'<text x="{x + 6:.1f}" y="{y - 6:.1f}">{p["scenario"]}</text>')
+    out.append('</svg>')
+    with open(path, 'w') as f:
+        f.write('\n'.join(out) + '\n')
+
+def main():
+    if len(sys.argv) < 2:
+        print(__doc__.strip(), file=sys.stderr)
+        sys.exit(1)
+    results_dir = sys.argv[1]
+
+    points, skipped = [], []
+    for name, path in sorted(find_scenarios(results_dir, sys.argv[2:]).items()):
+        p = point(name, load_stats(path))
+        if p is None:
+            skipped.append(name)
+            continue
+        latency, max_rss, source = p
+        points.append({'scenario': name, 'latency_ms': latency, 'max_rss': max_rss, 'latency_source': source})
+    if not points:
+        print(f"Error: no scenario in {results_dir} has both latency and RSS data", file=sys.stderr)
+        sys.exit(1)
+
+    front = frontier(points)
+    names = {p['scenario'] for p in front}
+    name_width = max(15, max(len(p['scenario']) for p in points))
+    print(f"========== Latency vs memory: {len(points)} configurations ==========")
+    print(f"  {'Scenario':<{name_width}} {'Latency ms':>12} {'Source':>8} {'Max RSS MB':>11}  Pareto")
+    for p in sorted(points, key=lambda p: p['latency_ms']):
+        mark = '*' if p['scenario'] in names else ''
+        print(f"  {p['scenario']:<{name_width}} {p['latency_ms']:>12.1f} {p['latency_source']:>8} {mb(p['max_rss']):>11.2f}  {mark}".rstrip())
+    if skipped:
+        print(f"  Skipped (no lag or RSS data): {', '.join(skipped)}")
+    print(f"  Pareto frontier (lower latency costs more memory along it): {' -> '.join(p['scenario'] for p in front)}")
+
+    with open(os.path.join(results_dir, 'pareto.json'), 'w') as f:
+        json.dump({'points': points, 'frontier': [p['scenario'] for p in front], 'skipped': skipped}, f, indent=2)
+    write_svg(os.path.join(results_dir, 'pareto.svg'), points, front)
+    print(f"Report saved to: {os.path.join(results_dir, 'pareto.json')} and pareto.svg")
+
+if __name__ == '__main__':
+    main()
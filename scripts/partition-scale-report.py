@@ -0,0 +1,138 @@
+#!/usr/bin/env python3
+"""对齐分区扩容事件 (scale-partitions.sh scale) 与 producer/consumer 的内存样本，
+报告客户端发现并连接新分区前后的内存变化
+
+用法: partition-scale-report.py <results_dir> <scenario> <events_file> [window_sec]
+  读取 <results_dir> 下的:
+    stats_<scenario>.json (或 .json.gz)       consumer 的 HeapAlloc/RSS 样本和各分区消息数
+    external_rss_<scenario>_producer.txt      monitor-rss.sh 采集的 producer RSS
+    external_rss_<scenario>_consumer.txt      monitor-rss.sh 采集的 consumer RSS
+  扩容前窗口为事件前 window_sec 秒 (默认 30)，扩容后窗口为事件后 window_sec 秒，
+  窗口需要覆盖客户端的分区发现周期 (producer -partition-discovery、consumer -auto-discovery-period)。
+  汇总写入 <results_dir>/partition_scale_<scenario>.json
+"""
+import gzip
+import json
+import os
+import re
+import sys
+from datetime import datetime
+
+def mb(value):
+    """字节转 MB"""
+    return value / 1024 / 1024
+
+def parse_time(value):
+    """解析 Go 写出的 RFC3339 时间，纳秒截断到微秒"""
+    m = re.match(r'(.*?T\d\d:\d\d:\d\d)(\.\d+)?(Z|[+-]\d\d:\d\d)$', value)
+    frac = (m.group(2) or '.0')[:7]
+    zone = '+00:00' if m.group(3) == 'Z' else m.group(3)
+    return datetime.fromisoformat(m.group(1) + frac + zone).timestamp()
+
+def load_event(path):
+    """第一个 scale 事件: (时间, 扩容前分区数, 扩容后分区数)"""
+    with open(path) as f:
+        for line in f:
+            parts = line.split()
+            if len(parts) == 5 and parts[1] == 'scale':
+                return int(parts[0]) / 1000, int(parts[3] or 0), int(parts[4])
+    return None
+
+def load_rss(path):
+    """monitor-rss.sh 的输出，返回 [(时间, RSS 字节)]"""
+    if not os.path.exists(path):
+        return []
+    samples = []
+    with open(path) as f:
+        for line in f:
+            parts = line.strip().split(',')
+            if len(parts) < 3 or parts[0] == 'timestamp':
+                continue
+            try:
+                samples.append((float(parts[0]), int(parts[2]) * 1024))
+            except ValueError:
+                continue
+    return samples
+
+def load_stats(results_dir, scenario):
+    """consumer 的 stats 文件，不存在时返回 None"""
+    for name, opener in ((f'stats_{scenario}.json', open), (f'stats_{scenario}.json.gz', gzip.open)):
+        path = os.path.join(results_dir, name)
+        if os.path.exists(path):
+            with opener(path, 'rt') as f:
+                return json.load(f)
+    return None
+
+def window(samples, event, seconds):
+    """事件前后窗口内样本的均值和峰值，样本为 [(时间, 值)]"""
+    before = [v for t, v in samples if event - seconds <= t < event]
+    after = [v for t, v in samples if event <= t < event + seconds]
+    if not before or not after:
+        return None
+    before_avg = sum(before) / len(before)
+    after_avg = sum(after) / len(after)
+    return {
+        'before_avg': before_avg,
+        'before_max': max(before),
+        'after_avg': after_avg,
+        'after_max': max(after),
+        'delta_avg': after_avg - before_avg,
+        'delta_max': max(after) - max(before),
+        'samples': [len(before), len(after)],
+    }
+
+def print_window(label, w):
+    if w is None:
+        print(f"  {label:<18} no samples on both sides of the event")
+        return
+    print(f"  {label:<18} {mb(w['before_avg']):>10.2f} {mb(w['after_avg']):>10.2f} {mb(w['delta_avg']):>+10.2f}"
+          f" {mb(w['before_max']):>10.2f} {mb(w['after_max']):>10.2f} {mb(w['delta_max']):>+10.2f}")
+
+def main():
+    if len(sys.argv) < 4:
+        print(__doc__.strip(), file=sys.stderr)
+        sys.exit(1)
+    results_dir, scenario, events_file = sys.argv[1:4]
+    seconds = float(sys.argv[4]) if len(sys.argv) > 4 else 30
+
+    event = load_event(events_file)
+    if event is None:
+        print(f"Error: no scale event in {events_file}", file=sys.stderr)
+        sys.exit(1)
+    at, before, after = event
+    report = {'scenario': scenario, 'event_time': at, 'partitions_before': before,
+              'partitions_after': after, 'window_sec': seconds, 'memory': {}}
+
+    producer_rss = load_rss(os.path.join(results_dir, f'external_rss_{scenario}_producer.txt'))
+    consumer_rss = load_rss(os.path.join(results_dir, f'external_rss_{scenario}_consumer.txt'))
+    report['memory']['producer_rss'] = window(producer_rss, at, seconds)
+    report['memory']['consumer_rss'] = window(consumer_rss, at, seconds)
+
+    stats = load_stats(results_dir, scenario)
+    if stats is not None:
+        samples = [(parse_time(s['timestamp']), s) for s in stats.get('samples') or []]
+        report['memory']['consumer_heap'] = window([(t, s['heap_alloc']) for t, s in samples], at, seconds)
+        partitions = stats['summary'].get('partitions') or {}
+        report['consumer_partitions'] = {t: p['message_count'] for t, p in sorted(partitions.items())}
+
+    print(f"========== Partition scale-up: {before} -> {after} partitions ({scenario}) ==========")
+    print(f"  Window: {seconds:.0f}s before and after the event")
+    print(f"  {'':<18} {'avg before':>10} {'avg after':>10} {'delta MB':>10} {'max before':>10} {'max after':>10} {'delta MB':>10}")
+    print_window('producer RSS', report['memory']['producer_rss'])
+    print_window('consumer RSS', report['memory']['consumer_rss'])
+    if 'consumer_heap' in report['memory']:
+        print_window('consumer HeapAlloc', report['memory']['consumer_heap'])
+    if 'consumer_partitions' in report:
+        parts = report['consumer_partitions']
+        print(f"  Consumer received messages from {len(parts)}/{after} partitions")
+        if len(parts) < after:
+            print("  WARNING: the consumer never attached to some new partitions; "
+                  "check -auto-discovery-period and that the run outlasted it")
+
+    out = os.path.join(results_dir, f'partition_scale_{scenario}.json')
+    with open(out, 'w') as f:
+        json.dump(report, f, indent=2)
+    print(f"Report saved to: {out}")
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,130 @@
+#!/bin/bash
+
+# 在受限的 cgroup v2 中运行命令，模拟容器的内存/CPU 限制，并记录节流和 OOM 事件
+# 用法: ./scripts/run-in-cgroup.sh <result-json> <command> [args...]
+#
+# 环境变量:
+#   CGROUP_MEMORY  memory.max，如 512M (默认 max，不限制)
+#   CGROUP_CPUS    可用 CPU 数，可为小数，如 0.5 (默认不限制)
+#   CGROUP_PERIOD  cpu.max 周期，微秒 (默认 100000)
+#
+# 优先直接操作 /sys/fs/cgroup (需要 root)，否则回退到 systemd-run --user --scope。
+# 结果 JSON 包含限制、memory.peak、memory.events 中的 oom/oom_kill 以及 cpu.stat 中的节流计数。
+
+set -e
+
+RESULT=${1:?"Usage: $0 <result-json> <command> [args...]"}
+shift
+[ $# -gt 0 ] || { echo "Usage: $0 <result-json> <command> [args...]"; exit 1; }
+
+CGROUP_MEMORY=${CGROUP_MEMORY:-max}
+CGROUP_CPUS=${CGROUP_CPUS:-}
+CGROUP_PERIOD=${CGROUP_PERIOD:-100000}
+CGROUP_ROOT=/sys/fs/cgroup
+
+if [ ! -f "$CGROUP_ROOT/cgroup.controllers" ]; then
+    echo "[cgroup] cgroup v2 not mounted at $CGROUP_ROOT"
+    exit 1
+fi
+
+CPU_MAX="max $CGROUP_PERIOD"
+if [ -n "$CGROUP_CPUS" ]; then
+    CPU_MAX="$(awk -v c="$CGROUP_CPUS" -v p="$CGROUP_PERIOD" 'BEGIN { printf "%d", c * p }') $CGROUP_PERIOD"
+fi
+
+# 读取 key value 格式文件中的某个字段
+stat_field() {
+    awk -v k="$2" '$1 == k { print $2 }' "$1" 2>/dev/null || true
+}
+
+# 快照 cgroup 计数器；systemd scope 在进程退出后即被回收，需要在运行期间反复读取
+SNAPSHOT=$(mktemp)
+snapshot() {
+    local dir=$1
+    [ -d "$dir" ] || return 0
+    {
+        echo "memory_peak $(cat "$dir/memory.peak" 2>/dev/null || echo 0)"
+        echo "memory_current $(cat "$dir/memory.current" 2>/dev/null || echo 0)"
+        echo "oom $(stat_field "$dir/memory.events" oom)"
+        echo "oom_kill $(stat_field "$dir/memory.events" oom_kill)"
+        echo "memory_high_events $(stat_field "$dir/memory.events" high)"
+        echo "memory_max_events $(stat_field "$dir/memory.events" max)"
+        echo "nr_periods $(stat_field "$dir/cpu.stat" nr_periods)"
+        echo "nr_throttled $(stat_field "$dir/cpu.stat" nr_throttled)"
+        echo "throttled_usec $(stat_field "$dir/cpu.stat" throttled_usec)"
+    } > "$SNAPSHOT.tmp" && mv "$SNAPSHOT.tmp" "$SNAPSHOT"
+}
+
+EXIT_CODE=0
+if [ -w "$CGROUP_ROOT" ]; then
+    MODE=direct
+    CG="$CGROUP_ROOT/pulsar-memtest-$$"
+    # 子 cgroup 需要父级开启 memory/cpu 控制器
+    echo "+memory +cpu" > "$CGROUP_ROOT/cgroup.subtree_control" 2>/dev/null || true
+    mkdir "$CG"
+    trap 'rmdir "$CG" 2>/dev/null || true; rm -f "$SNAPSHOT"' EXIT
+    echo "$CGROUP_MEMORY" > "$CG/memory.max"
+    echo "$CPU_MAX" > "$CG/cpu.max"
+    echo "[cgroup] $CG memory.max=$CGROUP_MEMORY cpu.max=$CPU_MAX"
+
+    # 先把子 shell 移入 cgroup 再 exec，保证命令从第一条指令起就受限
+    set +e
+    sh -c 'echo $$ > "$1/cgroup.procs" && shift && exec "$@"' sh "$CG" "$@"
+    EXIT_CODE=$?
+    set -e
+    snapshot "$CG"
+else
+    MODE=systemd
+    UNIT="pulsar-memtest-$$"
+    PROPS=(-p "MemoryMax=$CGROUP_MEMORY")
+    if [ -n "$CGROUP_CPUS" ]; then
+        PROPS+=(-p "CPUQuota=$(awk -v c="$CGROUP_CPUS" 'BEGIN { printf "%d", c * 100 }')%")
+    fi
+    trap 'rm -f "$SNAPSHOT"' EXIT
+    echo "[cgroup] systemd scope $UNIT.scope ${PROPS[*]}"
+
+    set +e
+    systemd-run --user --scope --quiet --unit="$UNIT" "${PROPS[@]}" "$@" &
+    RUN_PID=$!
+    CG=""
+    while kill -0 $RUN_PID 2>/dev/null; do
+        if [ -z "$CG" ]; then
+            CG=$(systemctl --user show -p ControlGroup --value "$UNIT.scope" 2>/dev/null)
+            [ -n "$CG" ] && CG="$CGROUP_ROOT$CG"
+        fi
+        [ -n "$CG" ] && snapshot "$CG"
+        sleep 1
+    done
+    wait $RUN_PID
+    EXIT_CODE=$?
+    set -e
+fi
+
+value() {
+    local v
+    v=$(awk -v k="$1" '$1 == k { print $2 }' "$SNAPSHOT")
+    echo "${v:-0}"
+}
+mkdir -p "$(dirname "$RESULT")"
+cat > "$RESULT" <<EOF
+{
+  "mode": "$MODE",
+  "command": "$(echo "$*" | sed 's/["\\]/\\&/g')",
+  "memory_max": "$CGROUP_MEMORY",
+  "cpu_max": "$CPU_MAX",
+  "exit_code": $EXIT_CODE,
+  "memory_peak": $(value memory_peak),
+  "oom": $(value oom),
+  "oom_kill": $(value oom_kill),
+  "memory_high_events": $(value memory_high_events),
+  "memory_max_events": $(value memory_max_events),
+  "cpu_nr_periods": $(value nr_periods),
+  "cpu_nr_throttled": $(value nr_throttled),
+  "cpu_throttled_usec": $(value throttled_usec)
+}
+EOF
+
+# exit 137 = SIGKILL，配合 oom_kill > 0 即被 OOM killer 杀掉
+echo "[cgroup] exit=$EXIT_CODE oom_kill=$(value oom_kill) throttled=$(value nr_throttled)/$(value nr_periods) peak=$(value memory_peak)"
+echo "[cgroup] result saved to $RESULT"
+exit $EXIT_CODE
@@ -15,6 +15,7 @@ BATCH_SIZE=${BATCH_SIZE:-50}  # MB
 MAX_BATCHES=${MAX_BATCHES:-4}
 SCENARIO=${SCENARIO:-"default"}
 COMPRESSION=${COMPRESSION:-"none"}
+FORCE=${FORCE:-}  # 非空时覆盖同名场景已有的结果
 
 echo "=========================================="
 echo "Pulsar Memory Test"
@@ -46,7 +47,7 @@ echo ""
 echo "=========================================="
 echo "Phase 1: Producing test data..."
 echo "=========================================="
-./bin/producer \
+./bin/producer ${FORCE:+-force} \
     -total=$((TOTAL_SIZE * 1024 * 1024)) \
     -size=${MESSAGE_SIZE} \
     -compression=${COMPRESSION}
@@ -58,7 +59,7 @@ echo ""
 echo "=========================================="
 echo "Phase 2: Consuming and analyzing memory..."
 echo "=========================================="
-./bin/consumer \
+./bin/consumer ${FORCE:+-force} \
     -batch-size=$((BATCH_SIZE * 1024 * 1024)) \
     -queue-size=${QUEUE_SIZE} \
     -max-batches=${MAX_BATCHES} \
@@ -0,0 +1,63 @@
+#!/bin/bash
+
+# 在同一个 Shared (或 SUB_TYPE) 订阅上启动 K 个消费者进程，模拟水平扩容，结束后汇总为 fleet 报告
+# 用法: ./scripts/scale-consumers.sh <topic> <K> [consumer args...]
+#
+# 环境变量:
+#   SCALE_SUB        订阅名 (默认 scale-<时间戳>，所有进程共用)
+#   SUB_TYPE         订阅类型，shared 或 key_shared (默认 shared)
+#   SCENARIO         场景名前缀，第 i 个进程为 <SCENARIO>-k<K>-c<i> (默认 scale)
+#   BASE_PPROF_PORT  第 i 个进程的 pprof 端口为 BASE_PPROF_PORT+i (默认 6060)
+#   OUTPUT           结果目录 (默认 ./results)
+#
+# 每个进程的日志写入 <OUTPUT>/consumer_<scenario>.log；汇总见 scripts/fleet-report.py，
+# 按时间对齐的合并序列由 bin/merge 写入 <OUTPUT>/merged_<SCENARIO>-k<K>.json。
+
+set -e
+
+TOPIC=${1:?"Usage: $0 <topic> <K> [consumer args...]"}
+K=${2:?"Usage: $0 <topic> <K> [consumer args...]"}
+shift 2
+
+SCALE_SUB=${SCALE_SUB:-"scale-$(date +%s)"}
+SUB_TYPE=${SUB_TYPE:-shared}
+SCENARIO=${SCENARIO:-scale}
+BASE_PPROF_PORT=${BASE_PPROF_PORT:-6060}
+OUTPUT=${OUTPUT:-./results}
+FLEET="${SCENARIO}-k${K}"
+
+mkdir -p "$OUTPUT"
+echo "[scale] $K consumers on $TOPIC, $SUB_TYPE subscription $SCALE_SUB (fleet $FLEET)"
+
+PIDS=()
+trap 'kill "${PIDS[@]}" 2>/dev/null || true' INT TERM
+for i in $(seq 0 $((K - 1))); do
+    NAME="${FLEET}-c${i}"
+    ./bin/consumer \
+        -topic="$TOPIC" \
+        -sub="$SCALE_SUB" \
+        -sub-type="$SUB_TYPE" \
+        -name="$NAME" \
+        -pprof-port=$((BASE_PPROF_PORT + i)) \
+        -scenario="$NAME" \
+        -output="$OUTPUT" \
+        "$@" > "$OUTPUT/consumer_${NAME}.log" 2>&1 &
+    PIDS+=($!)
+    echo "[scale] started $NAME (pid $!, pprof :$((BASE_PPROF_PORT + i)))"
+done
+
+FAILED=0
+for i in "${!PIDS[@]}"; do
+    CODE=0
+    wait "${PIDS[$i]}" || CODE=$?
+    if [ $CODE -ne 0 ]; then
+        echo "[scale] ${FLEET}-c${i} exited with $CODE"
+        FAILED=1
+    fi
+done
+
+python3 ./scripts/fleet-report.py "$OUTPUT" "$FLEET"
+if [ -x ./bin/merge ]; then
+    ./bin/merge -o "$OUTPUT/merged_${FLEET}.json" "$OUTPUT"/stats_"${FLEET}"-c*.json*
+fi
+exit $FAILED
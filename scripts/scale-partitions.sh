@@ -0,0 +1,43 @@
+#!/bin/bash
+
+# 测试期间增加分区 topic 的分区数，测量客户端发现并连接新分区的内存开销
+# 用法: ./scripts/scale-partitions.sh create <topic> <partitions>
+#       ./scripts/scale-partitions.sh scale <topic> <partitions> [events-file]
+#   create 创建分区 topic；scale 等待 SCALE_AFTER 秒后把分区数增加到 <partitions>，
+#   并把事件写入 events-file 供 partition-scale-report.py 对齐内存样本
+#
+# 环境变量:
+#   SCALE_AFTER  scale 前等待的秒数 (默认 20)
+#   ADMIN_URL    admin REST 地址 (默认 http://localhost:8080)
+
+set -e
+
+CMD=${1:?"Usage: $0 create|scale <topic> <partitions> [events-file]"}
+TOPIC=${2:?"Usage: $0 create|scale <topic> <partitions> [events-file]"}
+PARTITIONS=${3:?"Usage: $0 create|scale <topic> <partitions> [events-file]"}
+EVENTS_FILE=${4:-/dev/null}
+SCALE_AFTER=${SCALE_AFTER:-20}
+ADMIN_URL=${ADMIN_URL:-"http://localhost:8080"}
+
+TOPIC_PATH=$(echo "$TOPIC" | sed 's#://#/#')
+URL="$ADMIN_URL/admin/v2/$TOPIC_PATH/partitions"
+
+case "$CMD" in
+    create)
+        curl -sf -X PUT -H "Content-Type: application/json" -d "$PARTITIONS" "$URL" > /dev/null
+        echo "[partitions] created $TOPIC with $PARTITIONS partitions"
+        ;;
+    scale)
+        sleep "$SCALE_AFTER"
+        FROM=$(curl -sf "$ADMIN_URL/admin/v2/$TOPIC_PATH/partitioned-metadata" | sed 's/.*"partitions":\([0-9]*\).*/\1/')
+        # POST 只能增加分区数
+        curl -sf -X POST -H "Content-Type: application/json" -d "$PARTITIONS" "$URL" > /dev/null
+        # 事件格式: <unix_ms> scale <topic> <from> <to>
+        echo "$(date +%s%3N) scale $TOPIC $FROM $PARTITIONS" >> "$EVENTS_FILE"
+        echo "[partitions] $TOPIC: $FROM -> $PARTITIONS partitions"
+        ;;
+    *)
+        echo "Unknown command $CMD (create|scale)" >&2
+        exit 1
+        ;;
+esac
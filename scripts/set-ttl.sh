@@ -0,0 +1,31 @@
+#!/bin/bash
+
+# 通过 admin REST API 设置或清除 namespace 的消息 TTL，namespace 不存在时先创建
+# 用法: ./scripts/set-ttl.sh <tenant/namespace> <seconds|off> [admin-url]
+#   例如 ./scripts/set-ttl.sh public/ttl-expiry 30
+
+set -e
+
+NAMESPACE=${1:?"Usage: $0 <tenant/namespace> <seconds|off> [admin-url]"}
+TTL=${2:?"Usage: $0 <tenant/namespace> <seconds|off> [admin-url]"}
+ADMIN_URL=${3:-${ADMIN_URL:-"http://localhost:8080"}}
+
+NS_URL="$ADMIN_URL/admin/v2/namespaces/$NAMESPACE"
+
+# 已存在时返回 409，忽略
+STATUS=$(curl -s -o /dev/null -w '%{http_code}' -X PUT "$NS_URL")
+case "$STATUS" in
+    204|409) ;;
+    *)
+        echo "Error: failed to create namespace $NAMESPACE (HTTP $STATUS)"
+        exit 1
+        ;;
+esac
+
+if [ "$TTL" = "off" ]; then
+    curl -sf -X DELETE "$NS_URL/messageTTL" > /dev/null
+    echo "Message TTL removed from $NAMESPACE"
+else
+    curl -sf -X POST -H 'Content-Type: application/json' -d "$TTL" "$NS_URL/messageTTL" > /dev/null
+    echo "Message TTL of $NAMESPACE: $(curl -sf "$NS_URL/messageTTL") seconds"
+fi
@@ -18,10 +18,18 @@ if ! docker info > /dev/null 2>&1; then
 fi
 
 # 停止已有的容器
-docker-compose down 2>/dev/null || true
+docker-compose --profile proxy --profile dns down 2>/dev/null || true
 
-# 启动 Pulsar
-docker-compose up -d
+# 启动 Pulsar，WITH_PROXY=1 时同时启动 Pulsar proxy (pulsar://localhost:6651)，
+# WITH_DNS_CHURN=1 时同时启动 DNS 抖动测试的两个 proxy (127.0.0.2:6652 和 127.0.0.3:6652)
+PROFILES=""
+if [ "${WITH_PROXY:-0}" = "1" ]; then
+    PROFILES="$PROFILES --profile proxy"
+fi
+if [ "${WITH_DNS_CHURN:-0}" = "1" ]; then
+    PROFILES="$PROFILES --profile dns"
+fi
+docker-compose $PROFILES up -d
 
 echo "Waiting for Pulsar to be ready..."
 
@@ -56,4 +64,10 @@ echo "Pulsar is running!"
 echo "  Broker URL: pulsar://localhost:6650"
 echo "  Admin URL:  http://localhost:8080"
 echo "  Topic:      persistent://public/default/memory-test"
+if [ "${WITH_PROXY:-0}" = "1" ]; then
+    echo "  Proxy URL:  pulsar://localhost:6651 (admin http://localhost:8081)"
+fi
+if [ "${WITH_DNS_CHURN:-0}" = "1" ]; then
+    echo "  DNS churn:  pulsar://127.0.0.2:6652 and pulsar://127.0.0.3:6652 (see scripts/dns-churn.sh)"
+fi
 echo "=========================================="
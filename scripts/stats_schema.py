@@ -0,0 +1,62 @@
+"""stats 文件的 schema 迁移，与 pkg/metrics/schema.go 的 MigrateStats 对应
+
+对比脚本用 migrate(json.load(f)) 读取 stats 文件，旧版本的文件补齐可推导的字段后按当前 schema 处理；
+schema.go 增加迁移步骤时同步在 MIGRATIONS 末尾追加
+"""
+from datetime import datetime
+import re
+
+# 与 metrics.StatsSchemaVersion 相同
+SCHEMA_VERSION = 2
+
+
+def _parse_time(value):
+    """Go 的 RFC 3339 时间，小数秒截到 Python 支持的微秒"""
+    return datetime.fromisoformat(re.sub(r'(\.\d{6})\d+', r'\1', value.replace('Z', '+00:00')))
+
+
+def _migrate_v0(stats):
+    """引入 schema_version 之前的文件: 补齐样本的 elapsed 和摘要的 sample_count、duration、heap_ratio、rss_ratio"""
+    samples = stats.get('samples') or []
+    if samples and not any(s.get('elapsed') for s in samples):
+        start = _parse_time(samples[0]['timestamp'])
+        for s in samples:
+            s['elapsed'] = (_parse_time(s['timestamp']) - start).total_seconds()
+
+    summary = stats.setdefault('summary', {})
+    if not summary.get('sample_count'):
+        summary['sample_count'] = len(samples)
+    if not summary.get('duration') and len(samples) > 1:
+        summary['duration'] = int((samples[-1]['elapsed'] - samples[0]['elapsed']) * 1e9)
+    data = summary.get('message_bytes') or 0
+    if data > 0:
+        if not summary.get('heap_ratio'):
+            summary['heap_ratio'] = summary.get('max_heap_alloc', 0) / data
+        if not summary.get('rss_ratio'):
+            summary['rss_ratio'] = summary.get('max_rss', 0) / data
+
+
+def _migrate_v1(stats):
+    """版本 1 的 phase 速率以 MiB/s 记在 mb_per_s，版本 2 改为 bytes_per_s (字节)"""
+    for p in (stats.get('summary') or {}).get('phases') or []:
+        mb = p.pop('mb_per_s', 0)
+        if not p.get('bytes_per_s'):
+            p['bytes_per_s'] = mb * (1 << 20)
+
+
+# MIGRATIONS[v] 把版本 v 迁移到 v+1
+MIGRATIONS = [_migrate_v0, _migrate_v1]
+
+
+def migrate(stats):
+    """把 stats 迁移到当前 schema 并返回；比当前版本新的文件原样返回"""
+    if stats is None:
+        return None
+    version = stats.get('schema_version', 0)
+    if version < 0:
+        raise ValueError(f'invalid schema_version {version}')
+    while version < SCHEMA_VERSION:
+        MIGRATIONS[version](stats)
+        version += 1
+        stats['schema_version'] = version
+    return stats
@@ -8,6 +8,6 @@ PROJECT_DIR="$(dirname "$SCRIPT_DIR")"
 cd "$PROJECT_DIR"
 
 echo "Stopping Pulsar..."
-docker-compose down
+docker-compose --profile proxy --profile dns down
 
 echo "Pulsar stopped."
@@ -0,0 +1,72 @@
+-- consumer -tsdb=timescale 写入的表 (经 PostgREST)，列与 -stats-format=csv 相同
+--
+-- 用法: psql -f scripts/timescale-samples.sql，然后让 PostgREST 暴露 pulsar_memory，
+--       consumer -tsdb=timescale -tsdb-url=http://host:3000/pulsar_memory -tsdb-token=<JWT>
+-- labels 为 scenario、instance、program、run_id (run 布局) 和 -labels
+CREATE TABLE IF NOT EXISTS pulsar_memory (
+    timestamp timestamptz NOT NULL,
+    labels jsonb NOT NULL DEFAULT '{}',
+    heap_alloc bigint,
+    heap_sys bigint,
+    heap_inuse bigint,
+    heap_idle bigint,
+    heap_released bigint,
+    heap_objects bigint,
+    stack_inuse bigint,
+    stack_sys bigint,
+    goroutines bigint,
+    mspan_inuse bigint,
+    mcache_inuse bigint,
+    sys bigint,
+    total_alloc bigint,
+    num_gc bigint,
+    pause_total_ns bigint,
+    gc_cpu_fraction double precision,
+    gc_cpu_seconds double precision,
+    gc_assist_seconds double precision,
+    next_gc bigint,
+    heap_live bigint,
+    live_goal_ratio double precision,
+    gogc bigint,
+    gomemlimit bigint,
+    rss bigint,
+    vms bigint,
+    message_count bigint,
+    message_bytes bigint,
+    wire_bytes bigint,
+    batch_count bigint,
+    unacked_count bigint,
+    filtered_count bigint,
+    pending_acks bigint,
+    redelivery_count bigint,
+    corrupt_count bigint,
+    last_publish_time bigint,
+    lag_ms bigint,
+    latency_p50_ms double precision,
+    latency_p95_ms double precision,
+    latency_p99_ms double precision,
+    latency_max_ms double precision,
+    client_prefetched_messages double precision,
+    client_prefetched_bytes double precision,
+    client_pending_messages double precision,
+    client_pending_bytes double precision,
+    client_connections double precision,
+    client_lookups double precision,
+    queued_messages bigint,
+    queued_bytes bigint,
+    elapsed double precision,
+    gap_ms bigint,
+    total_rss bigint,
+    sys_mem_total bigint,
+    sys_mem_available bigint,
+    swap_used bigint,
+    mem_pressure double precision
+);
+-- 之前创建的表补上后来增加的列
+ALTER TABLE pulsar_memory ADD COLUMN IF NOT EXISTS elapsed double precision, ADD COLUMN IF NOT EXISTS gap_ms bigint,
+    ADD COLUMN IF NOT EXISTS total_rss bigint,
+    ADD COLUMN IF NOT EXISTS sys_mem_total bigint, ADD COLUMN IF NOT EXISTS sys_mem_available bigint,
+    ADD COLUMN IF NOT EXISTS swap_used bigint, ADD COLUMN IF NOT EXISTS mem_pressure double precision;
+
+SELECT create_hypertable('pulsar_memory', 'timestamp', if_not_exists => TRUE);
+CREATE INDEX IF NOT EXISTS pulsar_memory_scenario ON pulsar_memory ((labels->>'scenario'), timestamp DESC);
@@ -0,0 +1,42 @@
+#!/bin/bash
+
+# 在测试期间周期性地创建/删除匹配 pattern 的 topic，制造 topic 发现抖动
+# 用法: ./scripts/topic-churn.sh <topic-prefix> [events-file]
+#   topic-prefix 例如 persistent://public/default/churn-
+#
+# 环境变量:
+#   CHURN_INTERVAL  每次变更间隔秒数 (默认 10)
+#   CHURN_LIVE      同时存活的 churn topic 数 (默认 5)
+#   CHURN_ROUNDS    变更轮数 (默认 30)
+#   ADMIN_URL       admin REST 地址 (默认 http://localhost:8080)
+
+set -e
+
+PREFIX=${1:?"Usage: $0 <topic-prefix> [events-file]"}
+EVENTS_FILE=${2:-/dev/null}
+CHURN_INTERVAL=${CHURN_INTERVAL:-10}
+CHURN_LIVE=${CHURN_LIVE:-5}
+CHURN_ROUNDS=${CHURN_ROUNDS:-30}
+ADMIN_URL=${ADMIN_URL:-"http://localhost:8080"}
+
+TOPIC_PATH=$(echo "$PREFIX" | sed 's#://#/#')
+
+# 事件格式: <unix_ms> <create|delete> <topic>
+record() {
+    echo "$(date +%s%3N) $1 $2" >> "$EVENTS_FILE"
+    echo "[churn] $1 $2"
+}
+
+for i in $(seq 1 "$CHURN_ROUNDS"); do
+    curl -sf -X PUT "$ADMIN_URL/admin/v2/${TOPIC_PATH}$i" > /dev/null || true
+    record create "${PREFIX}$i"
+
+    OLD=$((i - CHURN_LIVE))
+    if [ $OLD -gt 0 ]; then
+        # force=true: 即使有活跃的消费者也删除
+        curl -sf -X DELETE "$ADMIN_URL/admin/v2/${TOPIC_PATH}$OLD?force=true" > /dev/null || true
+        record delete "${PREFIX}$OLD"
+    fi
+
+    sleep "$CHURN_INTERVAL"
+done